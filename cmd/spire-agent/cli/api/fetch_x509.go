@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"time"
 
 	"github.com/mitchellh/cli"
@@ -18,6 +19,8 @@ import (
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
 	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/pkg/common/fips"
+	"github.com/spiffe/spire/pkg/common/keystore"
 )
 
 func NewFetchX509Command() cli.Command {
@@ -28,9 +31,16 @@ func newFetchX509Command(env *common_cli.Env, clientMaker workloadClientMaker) c
 	return adaptCommand(env, clientMaker, new(fetchX509Command))
 }
 
+const (
+	formatPEM    = "pem"
+	formatPKCS12 = "pkcs12"
+	formatJKS    = "jks"
+)
+
 type fetchX509Command struct {
 	silent    bool
 	writePath string
+	format    string
 }
 
 func (*fetchX509Command) name() string {
@@ -42,6 +52,16 @@ func (*fetchX509Command) synopsis() string {
 }
 
 func (c *fetchX509Command) run(ctx context.Context, env *common_cli.Env, client *workloadClient) error {
+	switch c.format {
+	case formatPEM:
+	case formatPKCS12, formatJKS:
+		if fips.Enabled() {
+			return fmt.Errorf("the %q format is not available in FIPS mode", c.format)
+		}
+	default:
+		return fmt.Errorf("unsupported format %q; expected %q, %q or %q", c.format, formatPEM, formatPKCS12, formatJKS)
+	}
+
 	start := time.Now()
 	resp, err := c.fetchX509SVID(ctx, client)
 	respTime := time.Since(start)
@@ -70,6 +90,7 @@ func (c *fetchX509Command) run(ctx context.Context, env *common_cli.Env, client
 func (c *fetchX509Command) appendFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&c.silent, "silent", false, "Suppress stdout")
 	fs.StringVar(&c.writePath, "write", "", "Write SVID data to the specified path (optional)")
+	fs.StringVar(&c.format, "format", formatPEM, "Format of the SVID data written: pem, pkcs12 or jks. The pkcs12 and jks key stores are protected with a generated password, written alongside")
 }
 
 func (c *fetchX509Command) fetchX509SVID(ctx context.Context, client *workloadClient) (*workload.X509SVIDResponse, error) {
@@ -85,6 +106,10 @@ func (c *fetchX509Command) fetchX509SVID(ctx context.Context, client *workloadCl
 }
 
 func (c *fetchX509Command) writeResponse(svids []*X509SVID) error {
+	if c.format != formatPEM {
+		return c.writeKeyStores(svids)
+	}
+
 	for i, svid := range svids {
 		svidPath := path.Join(c.writePath, fmt.Sprintf("svid.%v.pem", i))
 		keyPath := path.Join(c.writePath, fmt.Sprintf("svid.%v.key", i))
@@ -127,6 +152,55 @@ func (c *fetchX509Command) writeResponse(svids []*X509SVID) error {
 	return nil
 }
 
+// writeKeyStores writes each SVID as a key store holding the SVID key and
+// chain, and the bundle and federated bundles as trusted certificates, along
+// with the generated password protecting it.
+func (c *fetchX509Command) writeKeyStores(svids []*X509SVID) error {
+	encode, ext := keystore.EncodePKCS12, "p12"
+	if c.format == formatJKS {
+		encode, ext = keystore.EncodeJKS, "jks"
+	}
+
+	for i, svid := range svids {
+		keyStorePath := path.Join(c.writePath, fmt.Sprintf("svid.%v.%s", i, ext))
+		passwordPath := path.Join(c.writePath, fmt.Sprintf("svid.%v.pass", i))
+
+		// sort the federated bundles by trust domain so the output is consistent
+		federatedDomains := make([]string, 0, len(svid.FederatedBundles))
+		for trustDomain := range svid.FederatedBundles {
+			federatedDomains = append(federatedDomains, trustDomain)
+		}
+		sort.Strings(federatedDomains)
+
+		var trusted []*x509.Certificate
+		trusted = append(trusted, svid.Bundle...)
+		for _, trustDomain := range federatedDomains {
+			trusted = append(trusted, svid.FederatedBundles[trustDomain]...)
+		}
+
+		password, err := keystore.NewPassword()
+		if err != nil {
+			return err
+		}
+		data, err := encode(svid.PrivateKey, svid.Certificates, trusted, password)
+		if err != nil {
+			return fmt.Errorf("unable to encode SVID #%d: %w", i, err)
+		}
+
+		fmt.Printf("Writing password #%d to file %s.\n", i, passwordPath)
+		if err := os.WriteFile(passwordPath, []byte(password), 0600); err != nil {
+			return err
+		}
+
+		fmt.Printf("Writing SVID #%d, its key and bundles to file %s.\n", i, keyStorePath)
+		if err := os.WriteFile(keyStorePath, data, 0600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // writeCerts takes a slice of data, which may contain multiple certificates,
 // and encodes them as PEM blocks, writing them to filename
 func (c *fetchX509Command) writeCerts(filename string, certs []*x509.Certificate) error {
@@ -7,6 +7,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
@@ -20,10 +21,17 @@ import (
 	"github.com/imdario/mergo"
 	"github.com/mitchellh/cli"
 	"github.com/sirupsen/logrus"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/spiffe/spire/cmd/spire-agent/cli/common"
 	"github.com/spiffe/spire/pkg/agent"
+	workload_attestor "github.com/spiffe/spire/pkg/agent/attestor/workload"
+	"github.com/spiffe/spire/pkg/agent/canary"
+	"github.com/spiffe/spire/pkg/agent/client"
+	"github.com/spiffe/spire/pkg/agent/quarantine"
 	"github.com/spiffe/spire/pkg/common/catalog"
 	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/pkg/common/clockskew"
+	"github.com/spiffe/spire/pkg/common/fips"
 	"github.com/spiffe/spire/pkg/common/health"
 	"github.com/spiffe/spire/pkg/common/log"
 	"github.com/spiffe/spire/pkg/common/pemutil"
@@ -41,6 +49,10 @@ const (
 	defaultLogLevel          = "INFO"
 	defaultDefaultSVIDName   = "default"
 	defaultDefaultBundleName = "ROOTCA"
+
+	// adminProfilingSocketName is the name of the socket serving the runtime
+	// profiles, next to the admin socket
+	adminProfilingSocketName = "pprof.sock"
 )
 
 // Config contains all available configurables, arranged by section
@@ -55,6 +67,9 @@ type Config struct {
 type agentConfig struct {
 	DataDir                       string    `hcl:"data_dir"`
 	AdminSocketPath               string    `hcl:"admin_socket_path"`
+	AdminProfilingEnabled         bool      `hcl:"admin_profiling_enabled"`
+	BundleSocketPath              string    `hcl:"bundle_socket_path"`
+	FIPSMode                      bool      `hcl:"fips_mode"`
 	InsecureBootstrap             bool      `hcl:"insecure_bootstrap"`
 	JoinToken                     string    `hcl:"join_token"`
 	LogFile                       string    `hcl:"log_file"`
@@ -67,8 +82,10 @@ type agentConfig struct {
 	TrustBundlePath               string    `hcl:"trust_bundle_path"`
 	TrustBundleURL                string    `hcl:"trust_bundle_url"`
 	TrustDomain                   string    `hcl:"trust_domain"`
+	WorkloadAPIVsockPort          int       `hcl:"workload_api_vsock_port"`
 	AllowUnauthenticatedVerifiers bool      `hcl:"allow_unauthenticated_verifiers"`
 	AllowedForeignJWTClaims       []string  `hcl:"allowed_foreign_jwt_claims"`
+	ClockSkewTolerance            string    `hcl:"clock_skew_tolerance"`
 
 	ConfigPath string
 	ExpandEnv  bool
@@ -89,11 +106,41 @@ type sdsConfig struct {
 }
 
 type experimentalConfig struct {
-	SyncInterval string `hcl:"sync_interval"`
+	SyncInterval        string `hcl:"sync_interval"`
+	SyncKickInterval    string `hcl:"sync_kick_interval"`
+	X509AuthoritiesOnly bool   `hcl:"x509_authorities_only"`
+	ServerProxyURL      string `hcl:"server_proxy_url"`
+	CompressSync        bool   `hcl:"compress_sync"`
+	DeltaSync           bool   `hcl:"delta_sync"`
+	Ephemeral           bool   `hcl:"ephemeral"`
+
+	CanaryProbe         *canaryProbeConfig         `hcl:"canary_probe"`
+	WorkloadQuarantine  *workloadQuarantineConfig  `hcl:"workload_quarantine"`
+	WorkloadAttestation *workloadAttestationConfig `hcl:"workload_attestation"`
+
+	UnusedKeys []string `hcl:",unusedKeys"`
+}
 
+type canaryProbeConfig struct {
+	SPIFFEID   string   `hcl:"spiffe_id"`
+	Interval   string   `hcl:"interval"`
+	Timeout    string   `hcl:"timeout"`
 	UnusedKeys []string `hcl:",unusedKeys"`
 }
 
+type workloadQuarantineConfig struct {
+	SocketPath  string   `hcl:"socket_path"`
+	MaxDuration string   `hcl:"max_duration"`
+	UnusedKeys  []string `hcl:",unusedKeys"`
+}
+
+type workloadAttestationConfig struct {
+	Required          []string `hcl:"required"`
+	Fallback          []string `hcl:"fallback"`
+	AttestorSelectors bool     `hcl:"attestor_selectors"`
+	UnusedKeys        []string `hcl:",unusedKeys"`
+}
+
 type Command struct {
 	logOptions         []log.Option
 	env                *common_cli.Env
@@ -337,6 +384,119 @@ func setupTrustBundle(ac *agent.Config, c *Config) error {
 	return nil
 }
 
+func parseServerProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		// Leave the URL, which may hold credentials, out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("could not parse server proxy URL: %w", err)
+	}
+	if err := client.ValidateProxyURL(proxyURL); err != nil {
+		return nil, fmt.Errorf("invalid server proxy URL: %w", err)
+	}
+	return proxyURL, nil
+}
+
+func parseCanaryProbeConfig(c *canaryProbeConfig, td spiffeid.TrustDomain) (*canary.Config, error) {
+	id, err := spiffeid.FromString(c.SPIFFEID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spiffe_id %q: %w", c.SPIFFEID, err)
+	}
+	if !id.MemberOf(td) {
+		return nil, fmt.Errorf("invalid spiffe_id %q: must be in the trust domain %q", c.SPIFFEID, td)
+	}
+
+	canaryConfig := &canary.Config{
+		SPIFFEID: id,
+	}
+	if c.Interval != "" {
+		canaryConfig.Interval, err = time.ParseDuration(c.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval: %w", err)
+		}
+		if canaryConfig.Interval <= 0 {
+			return nil, errors.New("interval must be positive")
+		}
+	}
+	if c.Timeout != "" {
+		canaryConfig.Timeout, err = time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		if canaryConfig.Timeout <= 0 {
+			return nil, errors.New("timeout must be positive")
+		}
+	}
+	return canaryConfig, nil
+}
+
+func parseWorkloadQuarantineConfig(c *workloadQuarantineConfig) (*quarantine.Config, error) {
+	quarantineConfig := &quarantine.Config{
+		SocketPath: c.SocketPath,
+	}
+	if c.MaxDuration != "" {
+		var err error
+		quarantineConfig.MaxDuration, err = time.ParseDuration(c.MaxDuration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_duration: %w", err)
+		}
+		if quarantineConfig.MaxDuration <= 0 {
+			return nil, errors.New("max_duration must be positive")
+		}
+	}
+	return quarantineConfig, nil
+}
+
+func parseWorkloadAttestationConfig(c *workloadAttestationConfig) workload_attestor.Policy {
+	// The names are validated against the loaded plugins when the agent
+	// starts
+	return workload_attestor.Policy{
+		Required:          c.Required,
+		Fallback:          c.Fallback,
+		AttestorSelectors: c.AttestorSelectors,
+	}
+}
+
+// parseFIPSMode returns whether FIPS mode is on, i.e. it is enabled by the
+// config or the agent was built for it. In FIPS mode, the key material
+// configured for the plugins is validated.
+func parseFIPSMode(enabled bool, plugins catalog.HCLPluginConfigMap, logger logrus.FieldLogger) (bool, error) {
+	if err := fips.CheckBuild(); err != nil {
+		return false, err
+	}
+	if !enabled && !fips.BuildEnabled() {
+		return false, nil
+	}
+
+	pluginConfigs, err := catalog.PluginConfigsFromHCL(plugins)
+	if err != nil {
+		return false, err
+	}
+	if err := fips.ValidatePluginConfigs(pluginConfigs, logger); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// validateEphemeralMode checks that the keys of ephemeral agents are kept in
+// memory only, since they attest on every start and their keys must not
+// outlive them
+func validateEphemeralMode(plugins catalog.HCLPluginConfigMap) error {
+	pluginConfigs, err := catalog.PluginConfigsFromHCL(plugins)
+	if err != nil {
+		return err
+	}
+	for _, pluginConfig := range pluginConfigs {
+		if pluginConfig.Type == "KeyManager" && !pluginConfig.Disabled && pluginConfig.Name != "memory" {
+			return fmt.Errorf("ephemeral mode requires the \"memory\" KeyManager; %q is configured", pluginConfig.Name)
+		}
+	}
+	return nil
+}
+
 func NewAgentConfig(c *Config, logOptions []log.Option, allowUnknownConfig bool) (*agent.Config, error) {
 	ac := &agent.Config{}
 
@@ -351,10 +511,49 @@ func NewAgentConfig(c *Config, logOptions []log.Option, allowUnknownConfig bool)
 			return nil, fmt.Errorf("could not parse synchronization interval: %w", err)
 		}
 	}
+	if c.Agent.Experimental.SyncKickInterval != "" {
+		var err error
+		ac.SyncKickInterval, err = time.ParseDuration(c.Agent.Experimental.SyncKickInterval)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse sync kick interval: %w", err)
+		}
+	}
+	ac.ClockSkewTolerance = clockskew.DefaultTolerance
+	if c.Agent.ClockSkewTolerance != "" {
+		var err error
+		ac.ClockSkewTolerance, err = time.ParseDuration(c.Agent.ClockSkewTolerance)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse clock skew tolerance: %w", err)
+		}
+		if ac.ClockSkewTolerance <= 0 {
+			return nil, errors.New("clock skew tolerance must be positive")
+		}
+	}
+	ac.X509AuthoritiesOnly = c.Agent.Experimental.X509AuthoritiesOnly
+	ac.CompressSync = c.Agent.Experimental.CompressSync
+	ac.DeltaSync = c.Agent.Experimental.DeltaSync
+
+	if c.Agent.Experimental.Ephemeral {
+		if err := validateEphemeralMode(*c.Plugins); err != nil {
+			return nil, err
+		}
+		ac.Ephemeral = true
+	}
 
-	serverHostPort := net.JoinHostPort(c.Agent.ServerAddress, strconv.Itoa(c.Agent.ServerPort))
+	serverHostPort := util.JoinHostPort(c.Agent.ServerAddress, strconv.Itoa(c.Agent.ServerPort))
 	ac.ServerAddress = fmt.Sprintf("dns:///%s", serverHostPort)
 
+	if c.Agent.Experimental.ServerProxyURL != "" {
+		proxyURL, err := parseServerProxyURL(c.Agent.Experimental.ServerProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		ac.ProxyURL = proxyURL
+		// The server address is resolved by the proxy, since the agent may
+		// not be able to resolve it when it can only reach the proxy
+		ac.ServerAddress = fmt.Sprintf("passthrough:///%s", serverHostPort)
+	}
+
 	logOptions = append(logOptions,
 		log.WithLevel(c.Agent.LogLevel),
 		log.WithFormat(c.Agent.LogFormat),
@@ -372,6 +571,26 @@ func NewAgentConfig(c *Config, logOptions []log.Option, allowUnknownConfig bool)
 	}
 	ac.TrustDomain = td
 
+	if c.Agent.Experimental.CanaryProbe != nil {
+		canaryProbe, err := parseCanaryProbeConfig(c.Agent.Experimental.CanaryProbe, td)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse canary probe config: %w", err)
+		}
+		ac.CanaryProbe = canaryProbe
+	}
+
+	if c.Agent.Experimental.WorkloadQuarantine != nil {
+		workloadQuarantine, err := parseWorkloadQuarantineConfig(c.Agent.Experimental.WorkloadQuarantine)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse workload quarantine config: %w", err)
+		}
+		ac.WorkloadQuarantine = workloadQuarantine
+	}
+
+	if c.Agent.Experimental.WorkloadAttestation != nil {
+		ac.WorkloadAttestation = parseWorkloadAttestationConfig(c.Agent.Experimental.WorkloadAttestation)
+	}
+
 	ac.BindAddress = &net.UnixAddr{
 		Name: c.Agent.SocketPath,
 		Net:  "unix",
@@ -395,6 +614,36 @@ func NewAgentConfig(c *Config, logOptions []log.Option, allowUnknownConfig bool)
 			Name: c.Agent.AdminSocketPath,
 			Net:  "unix",
 		}
+
+		if c.Agent.AdminProfilingEnabled {
+			profilingSocketPath := filepath.Join(filepath.Dir(c.Agent.AdminSocketPath), adminProfilingSocketName)
+			if filepath.Clean(c.Agent.AdminSocketPath) == profilingSocketPath {
+				return nil, fmt.Errorf("admin socket cannot be named %s when admin_profiling_enabled is set", adminProfilingSocketName)
+			}
+			ac.AdminProfilingBindAddress = &net.UnixAddr{
+				Name: profilingSocketPath,
+				Net:  "unix",
+			}
+		}
+	} else if c.Agent.AdminProfilingEnabled {
+		return nil, errors.New("admin_profiling_enabled requires admin_socket_path")
+	}
+
+	if c.Agent.BundleSocketPath != "" {
+		if filepath.Clean(c.Agent.BundleSocketPath) == filepath.Clean(c.Agent.SocketPath) {
+			return nil, errors.New("bundle_socket_path cannot be the same as socket_path")
+		}
+		ac.BundleBindAddress = &net.UnixAddr{
+			Name: c.Agent.BundleSocketPath,
+			Net:  "unix",
+		}
+	}
+	if c.Agent.WorkloadAPIVsockPort != 0 {
+		// The highest port is reserved for binding to any port
+		if c.Agent.WorkloadAPIVsockPort < 0 || int64(c.Agent.WorkloadAPIVsockPort) >= math.MaxUint32 {
+			return nil, fmt.Errorf("invalid workload_api_vsock_port %d", c.Agent.WorkloadAPIVsockPort)
+		}
+		ac.WorkloadAPIVsockPort = uint32(c.Agent.WorkloadAPIVsockPort)
 	}
 	ac.JoinToken = c.Agent.JoinToken
 	ac.DataDir = c.Agent.DataDir
@@ -417,6 +666,12 @@ func NewAgentConfig(c *Config, logOptions []log.Option, allowUnknownConfig bool)
 	ac.Telemetry = c.Telemetry
 	ac.HealthChecks = c.HealthChecks
 
+	fipsMode, err := parseFIPSMode(c.Agent.FIPSMode, *c.Plugins, logger)
+	if err != nil {
+		return nil, err
+	}
+	ac.FIPSMode = fipsMode
+
 	if !allowUnknownConfig {
 		if err := checkForUnknownConfig(c, logger); err != nil {
 			return nil, err
@@ -0,0 +1,150 @@
+package sidecar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/hashicorp/hcl"
+	"github.com/spiffe/spire/cmd/spire-agent/cli/common"
+	"github.com/spiffe/spire/pkg/common/fips"
+)
+
+const (
+	formatPEM    = "pem"
+	formatPKCS12 = "pkcs12"
+	formatJKS    = "jks"
+
+	defaultReloadTimeout = 30 * time.Second
+)
+
+// sidecarConfig is the HCL configuration of the sidecar
+type sidecarConfig struct {
+	SocketPath              string           `hcl:"socket_path"`
+	CertDir                 string           `hcl:"cert_dir"`
+	Format                  string           `hcl:"format"`
+	SVIDFileName            string           `hcl:"svid_file_name"`
+	SVIDKeyFileName         string           `hcl:"svid_key_file_name"`
+	SVIDBundleFileName      string           `hcl:"svid_bundle_file_name"`
+	IncludeFederatedBundles bool             `hcl:"include_federated_bundles"`
+	KeyStoreFileName        string           `hcl:"key_store_file_name"`
+	KeyStorePasswordFile    string           `hcl:"key_store_password_file_name"`
+	ReloadCmd               []string         `hcl:"reload_cmd"`
+	ReloadTimeout           string           `hcl:"reload_timeout"`
+	Templates               []templateConfig `hcl:"template"`
+}
+
+type templateConfig struct {
+	Source      string `hcl:"source"`
+	Destination string `hcl:"destination"`
+}
+
+// Config is the validated configuration of the sidecar, with the paths of
+// the files it maintains.
+type Config struct {
+	SocketPath              string
+	Format                  string
+	SVIDPath                string
+	SVIDKeyPath             string
+	SVIDBundlePath          string
+	IncludeFederatedBundles bool
+	KeyStorePath            string
+	KeyStorePasswordPath    string
+	ReloadCmd               []string
+	ReloadTimeout           time.Duration
+	Templates               []Template
+}
+
+// Template is a parsed template and where it is rendered
+type Template struct {
+	Template    *template.Template
+	Destination string
+}
+
+// LoadConfig loads the sidecar configuration from the HCL file at path
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration at %q: %w", path, err)
+	}
+	return ParseConfig(string(data))
+}
+
+// ParseConfig parses and validates the sidecar configuration
+func ParseConfig(data string) (*Config, error) {
+	c := new(sidecarConfig)
+	if err := hcl.Decode(c, data); err != nil {
+		return nil, fmt.Errorf("unable to decode configuration: %w", err)
+	}
+	return newConfig(c)
+}
+
+func newConfig(c *sidecarConfig) (*Config, error) {
+	if c.CertDir == "" {
+		return nil, errors.New("cert_dir must be set")
+	}
+
+	config := &Config{
+		SocketPath:              c.SocketPath,
+		Format:                  c.Format,
+		IncludeFederatedBundles: c.IncludeFederatedBundles,
+		ReloadCmd:               c.ReloadCmd,
+		ReloadTimeout:           defaultReloadTimeout,
+	}
+	if config.SocketPath == "" {
+		config.SocketPath = common.DefaultSocketPath
+	}
+
+	switch c.Format {
+	case "", formatPEM:
+		config.Format = formatPEM
+		config.SVIDPath = certPath(c.CertDir, c.SVIDFileName, "svid.pem")
+		config.SVIDKeyPath = certPath(c.CertDir, c.SVIDKeyFileName, "svid_key.pem")
+		config.SVIDBundlePath = certPath(c.CertDir, c.SVIDBundleFileName, "svid_bundle.pem")
+	case formatPKCS12:
+		config.KeyStorePath = certPath(c.CertDir, c.KeyStoreFileName, "svid.p12")
+		config.KeyStorePasswordPath = certPath(c.CertDir, c.KeyStorePasswordFile, "svid.pass")
+	case formatJKS:
+		config.KeyStorePath = certPath(c.CertDir, c.KeyStoreFileName, "svid.jks")
+		config.KeyStorePasswordPath = certPath(c.CertDir, c.KeyStorePasswordFile, "svid.pass")
+	default:
+		return nil, fmt.Errorf("unsupported format %q; expected %q, %q or %q", c.Format, formatPEM, formatPKCS12, formatJKS)
+	}
+	if config.Format != formatPEM && fips.Enabled() {
+		return nil, fmt.Errorf("the %q format is not available in FIPS mode", c.Format)
+	}
+
+	if c.ReloadTimeout != "" {
+		timeout, err := time.ParseDuration(c.ReloadTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse reload timeout: %w", err)
+		}
+		config.ReloadTimeout = timeout
+	}
+
+	for _, t := range c.Templates {
+		if t.Source == "" || t.Destination == "" {
+			return nil, errors.New("templates must have a source and a destination")
+		}
+		tmpl, err := template.New(filepath.Base(t.Source)).Option("missingkey=error").ParseFiles(t.Source)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse template: %w", err)
+		}
+		config.Templates = append(config.Templates, Template{
+			Template:    tmpl,
+			Destination: t.Destination,
+		})
+	}
+
+	return config, nil
+}
+
+func certPath(certDir, fileName, defaultFileName string) string {
+	if fileName == "" {
+		fileName = defaultFileName
+	}
+	return filepath.Join(certDir, fileName)
+}
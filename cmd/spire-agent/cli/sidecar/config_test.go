@@ -0,0 +1,156 @@
+package sidecar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	templatePath := filepath.Join(dir, "crt-list.tmpl")
+	require.NoError(t, os.WriteFile(templatePath, []byte("{{ .SVIDPath }}\n"), 0600))
+
+	for _, tt := range []struct {
+		name      string
+		hcl       string
+		expectErr string
+		test      func(*testing.T, *Config)
+	}{
+		{
+			name: "pem defaults",
+			hcl:  `cert_dir = "/certs"`,
+			test: func(t *testing.T, c *Config) {
+				assert.Equal(t, "/tmp/spire-agent/public/api.sock", c.SocketPath)
+				assert.Equal(t, formatPEM, c.Format)
+				assert.Equal(t, "/certs/svid.pem", c.SVIDPath)
+				assert.Equal(t, "/certs/svid_key.pem", c.SVIDKeyPath)
+				assert.Equal(t, "/certs/svid_bundle.pem", c.SVIDBundlePath)
+				assert.Empty(t, c.KeyStorePath)
+				assert.Empty(t, c.ReloadCmd)
+				assert.Equal(t, defaultReloadTimeout, c.ReloadTimeout)
+			},
+		},
+		{
+			name: "pem file names",
+			hcl: `
+				socket_path = "/run/agent.sock"
+				cert_dir = "/certs"
+				svid_file_name = "cert.pem"
+				svid_key_file_name = "key.pem"
+				svid_bundle_file_name = "ca.pem"
+				include_federated_bundles = true
+				reload_cmd = ["nginx", "-s", "reload"]
+				reload_timeout = "5s"
+			`,
+			test: func(t *testing.T, c *Config) {
+				assert.Equal(t, "/run/agent.sock", c.SocketPath)
+				assert.Equal(t, "/certs/cert.pem", c.SVIDPath)
+				assert.Equal(t, "/certs/key.pem", c.SVIDKeyPath)
+				assert.Equal(t, "/certs/ca.pem", c.SVIDBundlePath)
+				assert.True(t, c.IncludeFederatedBundles)
+				assert.Equal(t, []string{"nginx", "-s", "reload"}, c.ReloadCmd)
+				assert.Equal(t, 5*time.Second, c.ReloadTimeout)
+			},
+		},
+		{
+			name: "pkcs12",
+			hcl: `
+				cert_dir = "/certs"
+				format = "pkcs12"
+			`,
+			test: func(t *testing.T, c *Config) {
+				assert.Equal(t, "/certs/svid.p12", c.KeyStorePath)
+				assert.Equal(t, "/certs/svid.pass", c.KeyStorePasswordPath)
+				assert.Empty(t, c.SVIDPath)
+			},
+		},
+		{
+			name: "jks",
+			hcl: `
+				cert_dir = "/certs"
+				format = "jks"
+				key_store_file_name = "keystore.jks"
+				key_store_password_file_name = "keystore.pass"
+			`,
+			test: func(t *testing.T, c *Config) {
+				assert.Equal(t, "/certs/keystore.jks", c.KeyStorePath)
+				assert.Equal(t, "/certs/keystore.pass", c.KeyStorePasswordPath)
+			},
+		},
+		{
+			name: "templates",
+			hcl: `
+				cert_dir = "/certs"
+				template {
+					source = "` + templatePath + `"
+					destination = "/etc/haproxy/crt-list"
+				}
+			`,
+			test: func(t *testing.T, c *Config) {
+				require.Len(t, c.Templates, 1)
+				assert.Equal(t, "crt-list.tmpl", c.Templates[0].Template.Name())
+				assert.Equal(t, "/etc/haproxy/crt-list", c.Templates[0].Destination)
+			},
+		},
+		{
+			name:      "no cert dir",
+			hcl:       `format = "pem"`,
+			expectErr: "cert_dir must be set",
+		},
+		{
+			name: "bad format",
+			hcl: `
+				cert_dir = "/certs"
+				format = "der"
+			`,
+			expectErr: `unsupported format "der"; expected "pem", "pkcs12" or "jks"`,
+		},
+		{
+			name: "bad reload timeout",
+			hcl: `
+				cert_dir = "/certs"
+				reload_timeout = "soon"
+			`,
+			expectErr: `could not parse reload timeout: time: invalid duration "soon"`,
+		},
+		{
+			name: "template without destination",
+			hcl: `
+				cert_dir = "/certs"
+				template {
+					source = "` + templatePath + `"
+				}
+			`,
+			expectErr: "templates must have a source and a destination",
+		},
+		{
+			name: "missing template",
+			hcl: `
+				cert_dir = "/certs"
+				template {
+					source = "` + filepath.Join(dir, "missing.tmpl") + `"
+					destination = "/etc/haproxy/crt-list"
+				}
+			`,
+			expectErr: "unable to parse template: open " + filepath.Join(dir, "missing.tmpl") + ": no such file or directory",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseConfig(tt.hcl)
+			if tt.expectErr != "" {
+				require.EqualError(t, err, tt.expectErr)
+				require.Nil(t, config)
+				return
+			}
+			require.NoError(t, err)
+			tt.test(t, config)
+		})
+	}
+}
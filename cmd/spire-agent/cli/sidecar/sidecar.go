@@ -0,0 +1,286 @@
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/pkg/common/diskutil"
+	"github.com/spiffe/spire/pkg/common/keystore"
+	"github.com/spiffe/spire/pkg/common/pemutil"
+)
+
+func NewSidecarCommand() cli.Command {
+	return newSidecarCommand(common_cli.DefaultEnv)
+}
+
+func newSidecarCommand(env *common_cli.Env) *sidecarCommand {
+	return &sidecarCommand{
+		env: env,
+	}
+}
+
+type sidecarCommand struct {
+	env *common_cli.Env
+
+	configPath string
+	socketPath string
+}
+
+func (c *sidecarCommand) Help() string {
+	// ignoring parsing errors since "-h" is always supported by the flags package
+	_ = c.parseFlags([]string{"-h"})
+	return ""
+}
+
+func (c *sidecarCommand) Synopsis() string {
+	return "Maintains the X509-SVID of the workload on disk and reloads it on rotation"
+}
+
+func (c *sidecarCommand) Run(args []string) int {
+	if err := c.parseFlags(args); err != nil {
+		return 1
+	}
+
+	config, err := LoadConfig(c.configPath)
+	if err != nil {
+		_ = c.env.ErrPrintln(err)
+		return 1
+	}
+	if c.socketPath != "" {
+		config.SocketPath = c.socketPath
+	}
+
+	s, err := New(config, c.env)
+	if err != nil {
+		_ = c.env.ErrPrintln(err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := s.Run(ctx); err != nil {
+		_ = c.env.ErrPrintln(err)
+		return 1
+	}
+	return 0
+}
+
+func (c *sidecarCommand) parseFlags(args []string) error {
+	fs := flag.NewFlagSet("sidecar", flag.ContinueOnError)
+	fs.SetOutput(c.env.Stderr)
+	fs.StringVar(&c.configPath, "config", "sidecar.conf", "Path to the sidecar config file")
+	fs.StringVar(&c.socketPath, "socketPath", "", "Path to the SPIRE Agent API socket; overrides the socket_path of the config file")
+	return fs.Parse(args)
+}
+
+// Sidecar watches the X509-SVID of the workload on the Workload API. On each
+// update, it writes the SVID to disk, renders the templates, and runs the
+// reload command.
+type Sidecar struct {
+	config *Config
+	env    *common_cli.Env
+
+	// keyStorePassword protects the key stores. It is generated once so
+	// that it does not change when the SVID rotates.
+	keyStorePassword string
+
+	// runReloadCmd is used to manipulate the reload command in unit tests
+	runReloadCmd func(ctx context.Context, args []string) ([]byte, error)
+
+	// updateMtx serializes the updates
+	updateMtx sync.Mutex
+}
+
+// New creates a new sidecar
+func New(config *Config, env *common_cli.Env) (*Sidecar, error) {
+	s := &Sidecar{
+		config:       config,
+		env:          env,
+		runReloadCmd: runReloadCmd,
+	}
+	if config.KeyStorePath != "" {
+		password, err := keystore.NewPassword()
+		if err != nil {
+			return nil, err
+		}
+		s.keyStorePassword = password
+	}
+	return s, nil
+}
+
+// Run watches the Workload API until the context is done
+func (s *Sidecar) Run(ctx context.Context) error {
+	err := workloadapi.WatchX509Context(ctx, s, workloadapi.WithAddr("unix://"+s.config.SocketPath))
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// OnX509ContextUpdate is called by the Workload API client with each update
+func (s *Sidecar) OnX509ContextUpdate(x509Context *workloadapi.X509Context) {
+	if err := s.Update(context.Background(), x509Context); err != nil {
+		_ = s.env.ErrPrintf("Failed to update the SVID: %v\n", err)
+	}
+}
+
+// OnX509ContextWatchError is called by the Workload API client when the watch
+// fails. The client retries on its own.
+func (s *Sidecar) OnX509ContextWatchError(err error) {
+	_ = s.env.ErrPrintf("Failed to watch the Workload API: %v\n", err)
+}
+
+// Update writes the default SVID of the X509 context, renders the templates,
+// and runs the reload command.
+func (s *Sidecar) Update(ctx context.Context, x509Context *workloadapi.X509Context) error {
+	s.updateMtx.Lock()
+	defer s.updateMtx.Unlock()
+
+	svid := x509Context.DefaultSVID()
+	trusted, err := s.trustedCerts(svid, x509Context.Bundles)
+	if err != nil {
+		return err
+	}
+
+	if s.config.KeyStorePath != "" {
+		err = s.writeKeyStore(svid, trusted)
+	} else {
+		err = s.writePEM(svid, trusted)
+	}
+	if err != nil {
+		return err
+	}
+	_ = s.env.Printf("Wrote the SVID of %q, valid until %s.\n", svid.ID, svid.Certificates[0].NotAfter.Format(time.RFC3339))
+
+	if err := s.renderTemplates(svid); err != nil {
+		return err
+	}
+
+	return s.reload(ctx)
+}
+
+func (s *Sidecar) trustedCerts(svid *x509svid.SVID, bundles *x509bundle.Set) ([]*x509.Certificate, error) {
+	bundle, err := bundles.GetX509BundleForTrustDomain(svid.ID.TrustDomain())
+	if err != nil {
+		return nil, err
+	}
+	trusted := bundle.X509Authorities()
+
+	if s.config.IncludeFederatedBundles {
+		// the bundles are sorted by trust domain so the output is consistent
+		for _, federatedBundle := range bundles.Bundles() {
+			if federatedBundle.TrustDomain() != svid.ID.TrustDomain() {
+				trusted = append(trusted, federatedBundle.X509Authorities()...)
+			}
+		}
+	}
+	return trusted, nil
+}
+
+func (s *Sidecar) writePEM(svid *x509svid.SVID, trusted []*x509.Certificate) error {
+	key, err := pemutil.EncodePKCS8PrivateKey(svid.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	if err := diskutil.AtomicWriteFile(s.config.SVIDKeyPath, key, 0600); err != nil {
+		return fmt.Errorf("unable to write the SVID key: %w", err)
+	}
+	if err := diskutil.AtomicWriteFile(s.config.SVIDPath, pemutil.EncodeCertificates(svid.Certificates), 0644); err != nil {
+		return fmt.Errorf("unable to write the SVID: %w", err)
+	}
+	if err := diskutil.AtomicWriteFile(s.config.SVIDBundlePath, pemutil.EncodeCertificates(trusted), 0644); err != nil {
+		return fmt.Errorf("unable to write the bundle: %w", err)
+	}
+	return nil
+}
+
+func (s *Sidecar) writeKeyStore(svid *x509svid.SVID, trusted []*x509.Certificate) error {
+	encode := keystore.EncodePKCS12
+	if s.config.Format == formatJKS {
+		encode = keystore.EncodeJKS
+	}
+	data, err := encode(svid.PrivateKey, svid.Certificates, trusted, s.keyStorePassword)
+	if err != nil {
+		return err
+	}
+
+	if err := diskutil.AtomicWriteFile(s.config.KeyStorePasswordPath, []byte(s.keyStorePassword), 0600); err != nil {
+		return fmt.Errorf("unable to write the key store password: %w", err)
+	}
+	if err := diskutil.AtomicWriteFile(s.config.KeyStorePath, data, 0600); err != nil {
+		return fmt.Errorf("unable to write the key store: %w", err)
+	}
+	return nil
+}
+
+// TemplateData is the data the templates are rendered with
+type TemplateData struct {
+	SPIFFEID             string
+	NotAfter             time.Time
+	SVIDPath             string
+	SVIDKeyPath          string
+	SVIDBundlePath       string
+	KeyStorePath         string
+	KeyStorePasswordPath string
+}
+
+func (s *Sidecar) renderTemplates(svid *x509svid.SVID) error {
+	data := TemplateData{
+		SPIFFEID:             svid.ID.String(),
+		NotAfter:             svid.Certificates[0].NotAfter,
+		SVIDPath:             s.config.SVIDPath,
+		SVIDKeyPath:          s.config.SVIDKeyPath,
+		SVIDBundlePath:       s.config.SVIDBundlePath,
+		KeyStorePath:         s.config.KeyStorePath,
+		KeyStorePasswordPath: s.config.KeyStorePasswordPath,
+	}
+	for _, t := range s.config.Templates {
+		buf := new(bytes.Buffer)
+		if err := t.Template.Execute(buf, data); err != nil {
+			return fmt.Errorf("unable to render template %q: %w", t.Template.Name(), err)
+		}
+		if err := diskutil.AtomicWriteFile(t.Destination, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("unable to write rendered template: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Sidecar) reload(ctx context.Context) error {
+	if len(s.config.ReloadCmd) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.ReloadTimeout)
+	defer cancel()
+
+	output, err := s.runReloadCmd(ctx, s.config.ReloadCmd)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("reload command timed out after %s", s.config.ReloadTimeout)
+		}
+		return fmt.Errorf("reload command failed: %w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+func runReloadCmd(ctx context.Context, args []string) ([]byte, error) {
+	return exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput() // nolint: gosec // the command is configured by the operator
+}
@@ -0,0 +1,195 @@
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/pkg/common/pemutil"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/spiffe/spire/test/testca"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	td          = spiffeid.RequireTrustDomainFromString("example.org")
+	federatedTD = spiffeid.RequireTrustDomainFromString("federated.org")
+	workloadID  = td.NewID("/workload")
+)
+
+func TestUpdatePEM(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	ca := testca.New(t, td)
+	federatedCA := testca.New(t, federatedTD)
+	svid := ca.CreateX509SVID(workloadID)
+	x509Context := newX509Context(svid, ca.X509Bundle(), federatedCA.X509Bundle())
+
+	s, stdout := newTestSidecar(t, &Config{
+		Format:         formatPEM,
+		SVIDPath:       filepath.Join(dir, "svid.pem"),
+		SVIDKeyPath:    filepath.Join(dir, "svid_key.pem"),
+		SVIDBundlePath: filepath.Join(dir, "svid_bundle.pem"),
+	})
+	require.NoError(t, s.Update(context.Background(), x509Context))
+
+	certs, err := pemutil.LoadCertificates(filepath.Join(dir, "svid.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, svid.Certificates, certs)
+
+	key, err := pemutil.LoadPrivateKey(filepath.Join(dir, "svid_key.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, svid.PrivateKey, key)
+	assertMode(t, filepath.Join(dir, "svid_key.pem"), 0600)
+
+	// The federated bundles are not included by default
+	bundle, err := pemutil.LoadCertificates(filepath.Join(dir, "svid_bundle.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, ca.X509Authorities(), bundle)
+
+	assert.Contains(t, stdout.String(), `Wrote the SVID of "spiffe://example.org/workload", valid until`)
+
+	// Until they are
+	s.config.IncludeFederatedBundles = true
+	require.NoError(t, s.Update(context.Background(), x509Context))
+	bundle, err = pemutil.LoadCertificates(filepath.Join(dir, "svid_bundle.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, append(ca.X509Authorities(), federatedCA.X509Authorities()...), bundle)
+}
+
+func TestUpdateKeyStore(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	ca := testca.New(t, td)
+
+	s, _ := newTestSidecar(t, &Config{
+		Format:               formatPKCS12,
+		KeyStorePath:         filepath.Join(dir, "svid.p12"),
+		KeyStorePasswordPath: filepath.Join(dir, "svid.pass"),
+	})
+
+	// The password does not change when the SVID rotates
+	var passwords []string
+	for i := 0; i < 2; i++ {
+		svid := ca.CreateX509SVID(workloadID)
+		require.NoError(t, s.Update(context.Background(), newX509Context(svid, ca.X509Bundle())))
+
+		password, err := os.ReadFile(filepath.Join(dir, "svid.pass"))
+		require.NoError(t, err)
+		assertMode(t, filepath.Join(dir, "svid.pass"), 0600)
+		passwords = append(passwords, string(password))
+
+		data, err := os.ReadFile(filepath.Join(dir, "svid.p12"))
+		require.NoError(t, err)
+		assertMode(t, filepath.Join(dir, "svid.p12"), 0600)
+		// The certificates are not encrypted; the encoding is covered by
+		// the keystore package tests
+		assert.True(t, bytes.Contains(data, svid.Certificates[0].Raw))
+		assert.True(t, bytes.Contains(data, ca.X509Authorities()[0].Raw))
+	}
+	assert.Equal(t, passwords[0], passwords[1])
+}
+
+func TestUpdateRendersTemplatesAndReloads(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	templatePath := filepath.Join(dir, "crt-list.tmpl")
+	require.NoError(t, os.WriteFile(templatePath, []byte("{{ .SVIDPath }} [alpn h2] {{ .SPIFFEID }}\n"), 0600))
+
+	config, err := ParseConfig(`
+		cert_dir = "` + dir + `"
+		reload_cmd = ["haproxy", "-sf", "1"]
+		template {
+			source = "` + templatePath + `"
+			destination = "` + filepath.Join(dir, "crt-list") + `"
+		}
+	`)
+	require.NoError(t, err)
+
+	s, _ := newTestSidecar(t, config)
+	var reloads [][]string
+	s.runReloadCmd = func(ctx context.Context, args []string) ([]byte, error) {
+		// The files are in place when the reload command runs
+		assert.FileExists(t, filepath.Join(dir, "svid.pem"))
+		assert.FileExists(t, filepath.Join(dir, "crt-list"))
+		reloads = append(reloads, args)
+		return nil, nil
+	}
+
+	ca := testca.New(t, td)
+	require.NoError(t, s.Update(context.Background(), newX509Context(ca.CreateX509SVID(workloadID), ca.X509Bundle())))
+
+	rendered, err := os.ReadFile(filepath.Join(dir, "crt-list"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "svid.pem")+" [alpn h2] spiffe://example.org/workload\n", string(rendered))
+	assert.Equal(t, [][]string{{"haproxy", "-sf", "1"}}, reloads)
+}
+
+func TestUpdateReloadFailure(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	config, err := ParseConfig(`
+		cert_dir = "` + dir + `"
+		reload_cmd = ["nginx", "-s", "reload"]
+		reload_timeout = "1ms"
+	`)
+	require.NoError(t, err)
+
+	ca := testca.New(t, td)
+	x509Context := newX509Context(ca.CreateX509SVID(workloadID), ca.X509Bundle())
+	s, _ := newTestSidecar(t, config)
+
+	s.runReloadCmd = func(ctx context.Context, args []string) ([]byte, error) {
+		return []byte("nginx: [error] invalid PID number\n"), errors.New("exit status 1")
+	}
+	err = s.Update(context.Background(), x509Context)
+	require.EqualError(t, err, "reload command failed: exit status 1: nginx: [error] invalid PID number")
+
+	s.runReloadCmd = func(ctx context.Context, args []string) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	err = s.Update(context.Background(), x509Context)
+	require.EqualError(t, err, "reload command timed out after 1ms")
+}
+
+func TestRunReloadCmd(t *testing.T) {
+	output, err := runReloadCmd(context.Background(), []string{"sh", "-c", "echo reloaded"})
+	require.NoError(t, err)
+	assert.Equal(t, "reloaded\n", string(output))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = runReloadCmd(ctx, []string{"sleep", "10"})
+	require.Error(t, err)
+}
+
+func newTestSidecar(t *testing.T, config *Config) (*Sidecar, *bytes.Buffer) {
+	stdout := new(bytes.Buffer)
+	s, err := New(config, &common_cli.Env{
+		Stdout: stdout,
+		Stderr: new(bytes.Buffer),
+	})
+	require.NoError(t, err)
+	return s, stdout
+}
+
+func newX509Context(svid *x509svid.SVID, bundles ...*x509bundle.Bundle) *workloadapi.X509Context {
+	return &workloadapi.X509Context{
+		SVIDs:   []*x509svid.SVID{svid},
+		Bundles: x509bundle.NewSet(bundles...),
+	}
+}
+
+func assertMode(t *testing.T, path string, mode os.FileMode) {
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, mode, info.Mode().Perm())
+	}
+}
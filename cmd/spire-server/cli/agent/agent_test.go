@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"testing"
+	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -298,6 +299,108 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestSVIDReportHelp(t *testing.T) {
+	test := setupTest(t, agent.NewSVIDReportCommandWithEnv)
+
+	test.client.Help()
+	require.Equal(t, `Usage of agent svid-report:
+  -all
+    	List the agents of the last bucket too
+  -buckets string
+    	Comma separated upper bounds of the time-to-expiry buckets, in increasing order (default "1h,6h,24h,168h")
+  -registrationUDSPath string
+    	Path to the SPIRE Server API socket (deprecated; use -socketPath)
+  -socketPath string
+    	Path to the SPIRE Server API socket (default "/tmp/spire-server/private/api.sock")
+`, test.stderr.String())
+}
+
+func TestSVIDReport(t *testing.T) {
+	now := time.Now()
+	agents := []*types.Agent{
+		{
+			Id:                &types.SPIFFEID{TrustDomain: "example.org", Path: "/spire/agent/healthy"},
+			AttestationType:   "join_token",
+			X509SvidExpiresAt: now.Add(30 * time.Minute).Unix(),
+		},
+		{
+			Id:                &types.SPIFFEID{TrustDomain: "example.org", Path: "/spire/agent/stuck"},
+			AttestationType:   "join_token",
+			X509SvidExpiresAt: now.Add(-time.Hour).Unix(),
+		},
+		{
+			Id:                &types.SPIFFEID{TrustDomain: "example.org", Path: "/spire/agent/long-lived"},
+			AttestationType:   "x509pop",
+			X509SvidExpiresAt: now.Add(30 * 24 * time.Hour).Unix(),
+		},
+		{
+			Id:                &types.SPIFFEID{TrustDomain: "example.org", Path: "/spire/agent/banned"},
+			X509SvidExpiresAt: now.Add(-time.Hour).Unix(),
+			Banned:            true,
+		},
+	}
+	expiresAt := func(i int) string {
+		return time.Unix(agents[i].X509SvidExpiresAt, 0).UTC().Format(time.RFC3339)
+	}
+
+	for _, tt := range []struct {
+		name               string
+		args               []string
+		expectedReturnCode int
+		expectedStdout     []string
+		unexpectedStdout   []string
+		expectedStderr     string
+		serverErr          error
+	}{
+		{
+			name: "default buckets",
+			expectedStdout: []string{
+				"SVID expiration of 3 agents at ",
+				"expired     : 1\n< 1h        : 1\n1h - 6h     : 0\n6h - 24h    : 0\n24h - 168h  : 0\n>= 168h     : 1\n",
+				"\nExpiration expired:\n  " + expiresAt(1) + "  spiffe://example.org/spire/agent/stuck  join_token\n",
+				"\nExpiration < 1h:\n  " + expiresAt(0) + "  spiffe://example.org/spire/agent/healthy  join_token\n",
+			},
+			unexpectedStdout: []string{"long-lived", "banned"},
+		},
+		{
+			name: "all agents",
+			args: []string{"-all", "-buckets", "10m,48h"},
+			expectedStdout: []string{
+				"expired     : 1\n< 10m       : 0\n10m - 48h   : 1\n>= 48h      : 1\n",
+				"\nExpiration >= 48h:\n  " + expiresAt(2) + "  spiffe://example.org/spire/agent/long-lived  x509pop\n",
+			},
+		},
+		{
+			name:               "invalid buckets",
+			args:               []string{"-buckets", "6h,1h"},
+			expectedReturnCode: 1,
+			expectedStderr:     "Error: invalid bucket \"1h\": buckets must be in increasing order\n",
+		},
+		{
+			name:               "server error",
+			expectedReturnCode: 1,
+			serverErr:          status.Error(codes.Internal, "internal server error"),
+			expectedStderr:     "Error: rpc error: code = Internal desc = internal server error\n",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			test := setupTest(t, agent.NewSVIDReportCommandWithEnv)
+			test.server.agents = agents
+			test.server.err = tt.serverErr
+			returnCode := test.client.Run(append(test.args, tt.args...))
+			for _, expected := range tt.expectedStdout {
+				require.Contains(t, test.stdout.String(), expected)
+			}
+			for _, unexpected := range tt.unexpectedStdout {
+				require.NotContains(t, test.stdout.String(), unexpected)
+			}
+			require.Equal(t, tt.expectedStderr, test.stderr.String())
+			require.Equal(t, tt.expectedReturnCode, returnCode)
+		})
+	}
+}
+
 func TestShowHelp(t *testing.T) {
 	test := setupTest(t, agent.NewShowCommandWithEnv)
 
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"flag"
+	"time"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	agentv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/agent/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/cmd/spire-server/util"
+	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/pkg/server/endpoints/admin"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"golang.org/x/net/context"
+)
+
+type svidReportCommand struct {
+	// buckets are the comma separated upper bounds of the buckets
+	buckets string
+	// all lists the agents of the last bucket too
+	all bool
+}
+
+// NewSVIDReportCommand creates a new "svid-report" subcommand for "agent" command.
+func NewSVIDReportCommand() cli.Command {
+	return NewSVIDReportCommandWithEnv(common_cli.DefaultEnv)
+}
+
+// NewSVIDReportCommandWithEnv creates a new "svid-report" subcommand for "agent" command
+// using the environment specified
+func NewSVIDReportCommandWithEnv(env *common_cli.Env) cli.Command {
+	return util.AdaptCommand(env, new(svidReportCommand))
+}
+
+func (*svidReportCommand) Name() string {
+	return "agent svid-report"
+}
+
+func (svidReportCommand) Synopsis() string {
+	return "Reports the expiration of the agent SVIDs, bucketed by time to expiry"
+}
+
+// Run reports the expiration of the SVIDs of the agents that are not banned
+func (c *svidReportCommand) Run(ctx context.Context, env *common_cli.Env, serverClient util.ServerClient) error {
+	bounds, err := admin.ParseSVIDReportBuckets(c.buckets)
+	if err != nil {
+		return err
+	}
+
+	agents, err := listUnbannedAgents(ctx, serverClient.NewAgentClient())
+	if err != nil {
+		return err
+	}
+
+	svids := make([]admin.AgentSVID, 0, len(agents))
+	for _, agent := range agents {
+		id, err := spiffeid.New(agent.Id.TrustDomain, agent.Id.Path)
+		if err != nil {
+			return err
+		}
+		svids = append(svids, admin.AgentSVID{
+			ID:              id.String(),
+			AttestationType: agent.AttestationType,
+			SerialNumber:    agent.X509SvidSerialNumber,
+			ExpiresAt:       time.Unix(agent.X509SvidExpiresAt, 0).UTC(),
+		})
+	}
+	report := admin.NewSVIDReport(time.Now(), bounds, svids)
+
+	if err := env.Printf("SVID expiration of %d agents at %s:\n\n", report.AgentCount, report.GeneratedAt.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	for _, bucket := range report.Buckets {
+		if err := env.Printf("%-12s: %d\n", bucket.Name, len(bucket.Agents)); err != nil {
+			return err
+		}
+	}
+
+	// The agents of the last bucket are rotating fine, so they are only
+	// listed on demand
+	for i, bucket := range report.Buckets {
+		if len(bucket.Agents) == 0 || (i == len(report.Buckets)-1 && !c.all) {
+			continue
+		}
+		if err := env.Printf("\nExpiration %s:\n", bucket.Name); err != nil {
+			return err
+		}
+		for _, agent := range bucket.Agents {
+			if err := env.Printf("  %s  %s  %s\n", agent.ExpiresAt.Format(time.RFC3339), agent.ID, agent.AttestationType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *svidReportCommand) AppendFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.buckets, "buckets", "1h,6h,24h,168h", "Comma separated upper bounds of the time-to-expiry buckets, in increasing order")
+	fs.BoolVar(&c.all, "all", false, "List the agents of the last bucket too")
+}
+
+func listUnbannedAgents(ctx context.Context, client agentv1.AgentClient) ([]*types.Agent, error) {
+	req := &agentv1.ListAgentsRequest{
+		Filter: &agentv1.ListAgentsRequest_Filter{
+			ByBanned: wrapperspb.Bool(false),
+		},
+		PageSize: 1000,
+	}
+
+	var agents []*types.Agent
+	for {
+		resp, err := client.ListAgents(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, agent := range resp.Agents {
+			if !agent.Banned {
+				agents = append(agents, agent)
+			}
+		}
+		if resp.NextPageToken == "" {
+			return agents, nil
+		}
+		req.PageToken = resp.NextPageToken
+	}
+}
@@ -0,0 +1,358 @@
+package bench
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	agentv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/agent/v1"
+	bundlev1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/bundle/v1"
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	svidv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/svid/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/cmd/spire-server/util"
+	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	scenarioEntry = "entry"
+	scenarioAgent = "agent"
+	scenarioX509  = "x509"
+	scenarioJWT   = "jwt"
+
+	// pathPrefix is the path prefix of the SPIFFE IDs used by the benchmarks
+	pathPrefix = "spire-bench"
+
+	// benchNodes is the number of parent IDs the synthetic entries are
+	// spread across
+	benchNodes = 100
+
+	// benchTTL is the TTL, in seconds, of the join tokens and SVIDs minted
+	// by the benchmarks
+	benchTTL = 60
+)
+
+// NewBenchCommand creates a new "bench" command
+func NewBenchCommand() cli.Command {
+	return newBenchCommand(common_cli.DefaultEnv)
+}
+
+func newBenchCommand(env *common_cli.Env) cli.Command {
+	return util.AdaptCommand(env, new(benchCommand))
+}
+
+type benchCommand struct {
+	scenarios   string
+	count       int
+	concurrency int
+	batchSize   int
+	keep        bool
+}
+
+func (*benchCommand) Name() string {
+	return "bench"
+}
+
+func (*benchCommand) Synopsis() string {
+	return "Generates synthetic load against the server and reports throughput and latencies"
+}
+
+func (c *benchCommand) AppendFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.scenarios, "scenarios", "entry,agent,x509,jwt", "Comma-separated scenarios to run: entry, agent, x509 or jwt")
+	fs.IntVar(&c.count, "count", 1000, "Number of operations per scenario; number of entries for the entry scenario")
+	fs.IntVar(&c.concurrency, "concurrency", 10, "Number of concurrent requests")
+	fs.IntVar(&c.batchSize, "batchSize", 50, "Number of entries created or deleted per request by the entry scenario")
+	fs.BoolVar(&c.keep, "keep", false, "Keep the entries created by the entry scenario instead of deleting them")
+}
+
+// Run runs the scenarios one after the other and prints their results
+func (c *benchCommand) Run(ctx context.Context, env *common_cli.Env, serverClient util.ServerClient) error {
+	scenarios, err := c.parseScenarios()
+	if err != nil {
+		return err
+	}
+
+	bundle, err := serverClient.NewBundleClient().GetBundle(ctx, &bundlev1.GetBundleRequest{})
+	if err != nil {
+		return fmt.Errorf("unable to get bundle: %w", err)
+	}
+	td, err := spiffeid.TrustDomainFromString(bundle.TrustDomain)
+	if err != nil {
+		return fmt.Errorf("invalid trust domain %q: %w", bundle.TrustDomain, err)
+	}
+	runID, err := newRunID()
+	if err != nil {
+		return err
+	}
+
+	b := &bencher{
+		c:            c,
+		serverClient: serverClient,
+		td:           td,
+		runID:        runID,
+	}
+	if err := env.Printf("Running benchmark %s against trust domain %q\n", runID, td); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, scenario := range scenarios {
+		var results []*result
+		switch scenario {
+		case scenarioEntry:
+			results = b.runEntry(ctx)
+		case scenarioAgent:
+			results = []*result{b.runAgent(ctx)}
+		case scenarioX509:
+			r, err := b.runX509(ctx)
+			if err != nil {
+				return err
+			}
+			results = []*result{r}
+		case scenarioJWT:
+			results = []*result{b.runJWT(ctx)}
+		}
+		for _, r := range results {
+			if err := printResult(env, r); err != nil {
+				return err
+			}
+			failed += r.errors
+		}
+		if scenario == scenarioEntry && c.keep {
+			if err := env.Printf("Kept the entries under %s\n", b.id()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d operations failed", failed)
+	}
+	return nil
+}
+
+func (c *benchCommand) parseScenarios() ([]string, error) {
+	switch {
+	case c.count <= 0:
+		return nil, errors.New("count must be greater than 0")
+	case c.concurrency <= 0:
+		return nil, errors.New("concurrency must be greater than 0")
+	case c.batchSize <= 0:
+		return nil, errors.New("batchSize must be greater than 0")
+	}
+
+	var scenarios []string
+	for _, scenario := range strings.Split(c.scenarios, ",") {
+		scenario = strings.TrimSpace(scenario)
+		switch scenario {
+		case scenarioEntry, scenarioAgent, scenarioX509, scenarioJWT:
+			scenarios = append(scenarios, scenario)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown scenario %q", scenario)
+		}
+	}
+	if len(scenarios) == 0 {
+		return nil, errors.New("at least one scenario must be specified")
+	}
+	return scenarios, nil
+}
+
+// bencher runs the scenarios of a benchmark. The SPIFFE IDs it uses are all
+// under a path unique to the run, so concurrent runs don't collide.
+type bencher struct {
+	c            *benchCommand
+	serverClient util.ServerClient
+	td           spiffeid.TrustDomain
+	runID        string
+}
+
+// runEntry creates count entries, in batches of batchSize, then deletes them
+// unless they are kept
+func (b *bencher) runEntry(ctx context.Context) []*result {
+	client := b.serverClient.NewEntryClient()
+	batchSize := b.c.batchSize
+
+	var mu sync.Mutex
+	var ids []string
+	create := runOps(ctx, "entry create", batches(b.c.count, batchSize), b.c.concurrency, func(ctx context.Context, batch int) error {
+		var entries []*types.Entry
+		for i := batch * batchSize; i < b.c.count && i < (batch+1)*batchSize; i++ {
+			entries = append(entries, &types.Entry{
+				SpiffeId:  b.spiffeID("workload-%d", i),
+				ParentId:  b.spiffeID("node-%d", i%benchNodes),
+				Selectors: []*types.Selector{{Type: pathPrefix, Value: fmt.Sprintf("id:%s-%d", b.runID, i)}},
+			})
+		}
+
+		resp, err := client.BatchCreateEntry(ctx, &entryv1.BatchCreateEntryRequest{Entries: entries})
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		var failed error
+		for _, r := range resp.Results {
+			if r.Status.Code != int32(codes.OK) {
+				if failed == nil {
+					failed = fmt.Errorf("failed to create entry: %s", r.Status.Message)
+				}
+				continue
+			}
+			ids = append(ids, r.Entry.Id)
+		}
+		return failed
+	})
+
+	if b.c.keep || len(ids) == 0 {
+		return []*result{create}
+	}
+
+	remove := runOps(ctx, "entry delete", batches(len(ids), batchSize), b.c.concurrency, func(ctx context.Context, batch int) error {
+		end := (batch + 1) * batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		resp, err := client.BatchDeleteEntry(ctx, &entryv1.BatchDeleteEntryRequest{Ids: ids[batch*batchSize : end]})
+		if err != nil {
+			return err
+		}
+		for _, r := range resp.Results {
+			if r.Status.Code != int32(codes.OK) {
+				return fmt.Errorf("failed to delete entry %q: %s", r.Id, r.Status.Message)
+			}
+		}
+		return nil
+	})
+	return []*result{create, remove}
+}
+
+// runAgent creates join tokens, i.e. the datastore writes of agent
+// enrollment. Tokens that are not used expire and are pruned by the server.
+func (b *bencher) runAgent(ctx context.Context) *result {
+	client := b.serverClient.NewAgentClient()
+	return runOps(ctx, "agent join token", b.c.count, b.c.concurrency, func(ctx context.Context, i int) error {
+		_, err := client.CreateJoinToken(ctx, &agentv1.CreateJoinTokenRequest{Ttl: benchTTL})
+		return err
+	})
+}
+
+// runX509 mints X509-SVIDs. All of them are signed from the same CSR, since
+// the key generation cost is on the side of the workloads.
+func (b *bencher) runX509(ctx context.Context) (*result, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		URIs: []*url.URL{b.id("x509").URL()},
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate CSR: %w", err)
+	}
+
+	client := b.serverClient.NewSVIDClient()
+	return runOps(ctx, "x509 mint", b.c.count, b.c.concurrency, func(ctx context.Context, i int) error {
+		_, err := client.MintX509SVID(ctx, &svidv1.MintX509SVIDRequest{Csr: csr, Ttl: benchTTL})
+		return err
+	}), nil
+}
+
+// runJWT mints JWT-SVIDs
+func (b *bencher) runJWT(ctx context.Context) *result {
+	client := b.serverClient.NewSVIDClient()
+	id := b.spiffeID("jwt")
+	return runOps(ctx, "jwt mint", b.c.count, b.c.concurrency, func(ctx context.Context, i int) error {
+		_, err := client.MintJWTSVID(ctx, &svidv1.MintJWTSVIDRequest{Id: id, Audience: []string{pathPrefix}, Ttl: benchTTL})
+		return err
+	})
+}
+
+// id returns the SPIFFE ID with the given path segments under the path of
+// the run
+func (b *bencher) id(segments ...string) spiffeid.ID {
+	return b.td.NewID(path.Join(append([]string{pathPrefix, b.runID}, segments...)...))
+}
+
+func (b *bencher) spiffeID(format string, args ...interface{}) *types.SPIFFEID {
+	return &types.SPIFFEID{
+		TrustDomain: b.td.String(),
+		Path:        b.id(fmt.Sprintf(format, args...)).Path(),
+	}
+}
+
+// runOps runs the operation n times, with up to concurrency operations in
+// flight, and records their latencies
+func runOps(ctx context.Context, name string, n, concurrency int, op func(ctx context.Context, i int) error) *result {
+	r := &result{name: name}
+	ops := make(chan int)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ops {
+				opStart := time.Now()
+				err := op(ctx, i)
+				r.record(time.Since(opStart), err)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		ops <- i
+	}
+	close(ops)
+	wg.Wait()
+	r.elapsed = time.Since(start)
+	return r
+}
+
+func printResult(env *common_cli.Env, r *result) error {
+	if err := env.Printf("%s: %d ops, %d errors in %s (%.1f ops/s)\n", r.name, r.ops(), r.errors, r.elapsed.Round(time.Millisecond), r.throughput()); err != nil {
+		return err
+	}
+	if err := env.Printf("  latency: p50=%s p90=%s p99=%s max=%s\n",
+		roundLatency(r.percentile(50)), roundLatency(r.percentile(90)),
+		roundLatency(r.percentile(99)), roundLatency(r.percentile(100))); err != nil {
+		return err
+	}
+	if r.firstErr != nil {
+		return env.Printf("  first error: %v\n", r.firstErr)
+	}
+	return nil
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+// batches returns the number of batches of the given size needed for n items
+func batches(n, size int) int {
+	return (n + size - 1) / size
+}
+
+func newRunID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate run ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,192 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	agentv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/agent/v1"
+	bundlev1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/bundle/v1"
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	svidv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/svid/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBenchSynopsis(t *testing.T) {
+	assert.Equal(t, "Generates synthetic load against the server and reports throughput and latencies", NewBenchCommand().Synopsis())
+}
+
+func TestBenchRun(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		args         []string
+		failJWT      bool
+		expectCode   int
+		expectOut    []string
+		expectStderr string
+		expectKept   int
+	}{
+		{
+			name: "all scenarios",
+			args: []string{"-count", "5", "-batchSize", "2", "-concurrency", "2"},
+			expectOut: []string{
+				"entry create: 3 ops, 0 errors",
+				"entry delete: 3 ops, 0 errors",
+				"agent join token: 5 ops, 0 errors",
+				"x509 mint: 5 ops, 0 errors",
+				"jwt mint: 5 ops, 0 errors",
+			},
+		},
+		{
+			name:       "keep entries",
+			args:       []string{"-scenarios", "entry", "-count", "5", "-keep"},
+			expectOut:  []string{"entry create: 1 ops, 0 errors", "Kept the entries under spiffe://example.org/spire-bench/"},
+			expectKept: 5,
+		},
+		{
+			name:         "failed operations",
+			args:         []string{"-scenarios", "jwt", "-count", "3"},
+			failJWT:      true,
+			expectCode:   1,
+			expectOut:    []string{"jwt mint: 3 ops, 3 errors", "first error: rpc error: code = Internal desc = oh no"},
+			expectStderr: "Error: 3 operations failed\n",
+		},
+		{
+			name:         "unknown scenario",
+			args:         []string{"-scenarios", "entry,foo"},
+			expectCode:   1,
+			expectStderr: "Error: unknown scenario \"foo\"\n",
+		},
+		{
+			name:         "invalid count",
+			args:         []string{"-count", "0"},
+			expectCode:   1,
+			expectStderr: "Error: count must be greater than 0\n",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			socketPath := filepath.Join(spiretest.TempDir(t), "socket")
+			server := &fakeServer{entries: make(map[string]*types.Entry), failJWT: tt.failJWT}
+			spiretest.StartGRPCSocketServer(t, socketPath, func(s *grpc.Server) {
+				agentv1.RegisterAgentServer(s, server)
+				bundlev1.RegisterBundleServer(s, server)
+				entryv1.RegisterEntryServer(s, server)
+				svidv1.RegisterSVIDServer(s, server)
+			})
+
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+			cmd := newBenchCommand(&common_cli.Env{
+				Stdin:  new(bytes.Buffer),
+				Stdout: stdout,
+				Stderr: stderr,
+			})
+			code := cmd.Run(append([]string{"-socketPath", socketPath}, tt.args...))
+			assert.Equal(t, tt.expectCode, code)
+			assert.Equal(t, tt.expectStderr, stderr.String())
+			for _, out := range tt.expectOut {
+				assert.Contains(t, stdout.String(), out)
+			}
+			assert.Len(t, server.entries, tt.expectKept)
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	r := new(result)
+	assert.Equal(t, time.Duration(0), r.percentile(50))
+
+	for i := 10; i >= 1; i-- {
+		r.record(time.Duration(i)*time.Millisecond, nil)
+	}
+	r.record(0, errors.New("oh no"))
+
+	assert.Equal(t, 11, r.ops())
+	assert.Equal(t, 5*time.Millisecond, r.percentile(50))
+	assert.Equal(t, 9*time.Millisecond, r.percentile(90))
+	assert.Equal(t, 10*time.Millisecond, r.percentile(99))
+	assert.Equal(t, 10*time.Millisecond, r.percentile(100))
+}
+
+type fakeServer struct {
+	agentv1.AgentServer
+	bundlev1.BundleServer
+	entryv1.EntryServer
+	svidv1.SVIDServer
+
+	failJWT bool
+
+	mu      sync.Mutex
+	entries map[string]*types.Entry
+}
+
+func (s *fakeServer) GetBundle(context.Context, *bundlev1.GetBundleRequest) (*types.Bundle, error) {
+	return &types.Bundle{TrustDomain: "example.org"}, nil
+}
+
+func (s *fakeServer) BatchCreateEntry(ctx context.Context, req *entryv1.BatchCreateEntryRequest) (*entryv1.BatchCreateEntryResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := new(entryv1.BatchCreateEntryResponse)
+	for _, entry := range req.Entries {
+		if !strings.HasPrefix(entry.SpiffeId.Path, "/spire-bench/") {
+			return nil, errors.New("unexpected SPIFFE ID")
+		}
+		entry.Id = entry.SpiffeId.Path
+		s.entries[entry.Id] = entry
+		resp.Results = append(resp.Results, &entryv1.BatchCreateEntryResponse_Result{
+			Status: &types.Status{Code: int32(codes.OK)},
+			Entry:  entry,
+		})
+	}
+	return resp, nil
+}
+
+func (s *fakeServer) BatchDeleteEntry(ctx context.Context, req *entryv1.BatchDeleteEntryRequest) (*entryv1.BatchDeleteEntryResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := new(entryv1.BatchDeleteEntryResponse)
+	for _, id := range req.Ids {
+		delete(s.entries, id)
+		resp.Results = append(resp.Results, &entryv1.BatchDeleteEntryResponse_Result{
+			Status: &types.Status{Code: int32(codes.OK)},
+			Id:     id,
+		})
+	}
+	return resp, nil
+}
+
+func (s *fakeServer) CreateJoinToken(context.Context, *agentv1.CreateJoinTokenRequest) (*types.JoinToken, error) {
+	return &types.JoinToken{Value: "token"}, nil
+}
+
+func (s *fakeServer) MintX509SVID(ctx context.Context, req *svidv1.MintX509SVIDRequest) (*svidv1.MintX509SVIDResponse, error) {
+	if len(req.Csr) == 0 {
+		return nil, errors.New("missing CSR")
+	}
+	return &svidv1.MintX509SVIDResponse{Svid: &types.X509SVID{}}, nil
+}
+
+func (s *fakeServer) MintJWTSVID(ctx context.Context, req *svidv1.MintJWTSVIDRequest) (*svidv1.MintJWTSVIDResponse, error) {
+	if s.failJWT {
+		return nil, status.Error(codes.Internal, "oh no")
+	}
+	if req.Id == nil {
+		return nil, errors.New("missing SPIFFE ID")
+	}
+	return &svidv1.MintJWTSVIDResponse{Svid: &types.JWTSVID{}}, nil
+}
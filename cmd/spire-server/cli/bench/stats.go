@@ -0,0 +1,64 @@
+package bench
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// result holds the outcome of the operations of a scenario
+type result struct {
+	name    string
+	elapsed time.Duration
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+	firstErr  error
+}
+
+func (r *result) record(latency time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.errors++
+		if r.firstErr == nil {
+			r.firstErr = err
+		}
+		return
+	}
+	r.latencies = append(r.latencies, latency)
+}
+
+// ops returns the number of operations, failed or not
+func (r *result) ops() int {
+	return len(r.latencies) + r.errors
+}
+
+// throughput returns the number of successful operations per second
+func (r *result) throughput() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(len(r.latencies)) / r.elapsed.Seconds()
+}
+
+// percentile returns the latency under which the given percentage of the
+// successful operations completed, using the nearest-rank method
+func (r *result) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	sort.Slice(r.latencies, func(i, j int) bool {
+		return r.latencies[i] < r.latencies[j]
+	})
+	rank := int(math.Ceil(p / 100 * float64(len(r.latencies))))
+	switch {
+	case rank < 1:
+		rank = 1
+	case rank > len(r.latencies):
+		rank = len(r.latencies)
+	}
+	return r.latencies[rank-1]
+}
@@ -5,7 +5,9 @@ import (
 
 	"github.com/mitchellh/cli"
 	"github.com/spiffe/spire/cmd/spire-server/cli/agent"
+	"github.com/spiffe/spire/cmd/spire-server/cli/bench"
 	"github.com/spiffe/spire/cmd/spire-server/cli/bundle"
+	"github.com/spiffe/spire/cmd/spire-server/cli/datastore"
 	"github.com/spiffe/spire/cmd/spire-server/cli/entry"
 	"github.com/spiffe/spire/cmd/spire-server/cli/healthcheck"
 	"github.com/spiffe/spire/cmd/spire-server/cli/jwt"
@@ -43,6 +45,12 @@ func (cc *CLI) Run(args []string) int {
 		"agent show": func() (cli.Command, error) {
 			return agent.NewShowCommand(), nil
 		},
+		"agent svid-report": func() (cli.Command, error) {
+			return agent.NewSVIDReportCommand(), nil
+		},
+		"bench": func() (cli.Command, error) {
+			return bench.NewBenchCommand(), nil
+		},
 		"bundle count": func() (cli.Command, error) {
 			return bundle.NewCountCommand(), nil
 		},
@@ -58,6 +66,12 @@ func (cc *CLI) Run(args []string) int {
 		"bundle delete": func() (cli.Command, error) {
 			return bundle.NewDeleteCommand(), nil
 		},
+		"datastore backup": func() (cli.Command, error) {
+			return datastore.NewBackupCommand(), nil
+		},
+		"datastore restore": func() (cli.Command, error) {
+			return datastore.NewRestoreCommand(), nil
+		},
 		"entry count": func() (cli.Command, error) {
 			return entry.NewCountCommand(), nil
 		},
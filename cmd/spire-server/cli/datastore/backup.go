@@ -0,0 +1,86 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mitchellh/cli"
+	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/pkg/common/diskutil"
+	"github.com/spiffe/spire/pkg/server/ca"
+	"github.com/spiffe/spire/pkg/server/datastore/backup"
+)
+
+// NewBackupCommand creates a new "datastore backup" command
+func NewBackupCommand() cli.Command {
+	return newBackupCommand(common_cli.DefaultEnv, time.Now)
+}
+
+func newBackupCommand(env *common_cli.Env, now func() time.Time) cli.Command {
+	return adaptCommand(env, &backupCommand{now: now})
+}
+
+type backupCommand struct {
+	now    func() time.Time
+	output string
+}
+
+func (*backupCommand) Name() string {
+	return "datastore backup"
+}
+
+func (*backupCommand) Synopsis() string {
+	return "Writes a portable snapshot of the datastore and the CA journal to a file"
+}
+
+func (c *backupCommand) AppendFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.output, "output", "", "Path to write the snapshot to")
+}
+
+// Run takes a snapshot of the datastore and writes it, with the CA journal
+// of the server, to the output file
+func (c *backupCommand) Run(ctx context.Context, env *common_cli.Env, server *serverConfig) error {
+	if c.output == "" {
+		return errors.New("an output path is required")
+	}
+
+	ds, err := server.openDataStore(env)
+	if err != nil {
+		return err
+	}
+	snapshot, err := backup.Take(ctx, ds)
+	if err != nil {
+		return fmt.Errorf("unable to take snapshot: %w", err)
+	}
+	snapshot.TrustDomain = server.trustDomain.String()
+	snapshot.TakenAt = c.now()
+
+	journalPath := ca.JournalPath(server.dataDir)
+	snapshot.CAJournal, err = os.ReadFile(journalPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read CA journal: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := backup.Write(&buf, snapshot); err != nil {
+		return err
+	}
+	// The snapshot describes every agent and workload, so it is only
+	// readable by its owner
+	if err := diskutil.AtomicWriteFile(c.output, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("unable to write snapshot: %w", err)
+	}
+
+	if len(snapshot.CAJournal) == 0 {
+		if err := env.Printf("No CA journal found at %s\n", journalPath); err != nil {
+			return err
+		}
+	}
+	return env.Printf("Wrote %d bundles, %d agents and %d entries to %s\n",
+		len(snapshot.Bundles), len(snapshot.Agents), len(snapshot.Entries), c.output)
+}
@@ -0,0 +1,125 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/cmd/spire-server/cli/run"
+	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/pkg/server/catalog"
+	"github.com/spiffe/spire/pkg/server/datastore"
+)
+
+// command is a datastore command. Unlike the other commands, it works on the
+// datastore configured for the server rather than through the server API, so
+// it works while the server is down.
+type command interface {
+	Name() string
+	Synopsis() string
+	AppendFlags(*flag.FlagSet)
+	Run(ctx context.Context, env *common_cli.Env, server *serverConfig) error
+}
+
+// serverConfig is the part of the server configuration the datastore
+// commands use
+type serverConfig struct {
+	trustDomain spiffeid.TrustDomain
+	dataDir     string
+	plugins     catalog.HCLPluginConfigMap
+}
+
+// openDataStore opens the datastore the server is configured with, logging
+// warnings and errors to stderr
+func (c *serverConfig) openDataStore(env *common_cli.Env) (datastore.DataStore, error) {
+	log := logrus.New()
+	log.SetOutput(env.Stderr)
+	log.SetLevel(logrus.WarnLevel)
+
+	ds, err := catalog.LoadDataStore(log, c.plugins)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open datastore: %w", err)
+	}
+	return ds, nil
+}
+
+type adapter struct {
+	cmd   command
+	env   *common_cli.Env
+	flags *flag.FlagSet
+
+	configPath string
+	expandEnv  bool
+}
+
+func adaptCommand(env *common_cli.Env, cmd command) *adapter {
+	a := &adapter{
+		cmd: cmd,
+		env: env,
+	}
+
+	f := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	f.SetOutput(env.Stderr)
+	f.StringVar(&a.configPath, "config", "", "Path to the SPIRE server config file")
+	f.BoolVar(&a.expandEnv, "expandEnv", false, "Expand environment variables in SPIRE config file")
+	a.cmd.AppendFlags(f)
+	a.flags = f
+
+	return a
+}
+
+func (a *adapter) Run(args []string) int {
+	if err := a.flags.Parse(args); err != nil {
+		return 1
+	}
+
+	server, err := loadServerConfig(a.configPath, a.expandEnv)
+	if err != nil {
+		fmt.Fprintln(a.env.Stderr, "Error: "+err.Error())
+		return 1
+	}
+
+	if err := a.cmd.Run(context.Background(), a.env, server); err != nil {
+		fmt.Fprintln(a.env.Stderr, "Error: "+err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func (a *adapter) Help() string {
+	return a.flags.Parse([]string{"-h"}).Error()
+}
+
+func (a *adapter) Synopsis() string {
+	return a.cmd.Synopsis()
+}
+
+func loadServerConfig(path string, expandEnv bool) (*serverConfig, error) {
+	c, err := run.ParseFile(path, expandEnv)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c.Server == nil:
+		return nil, errors.New("server section must be configured")
+	case c.Server.DataDir == "":
+		return nil, errors.New("data_dir must be configured")
+	case c.Plugins == nil:
+		return nil, errors.New("plugins section must be configured")
+	}
+
+	td, err := spiffeid.TrustDomainFromString(c.Server.TrustDomain)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse trust_domain %q: %w", c.Server.TrustDomain, err)
+	}
+
+	return &serverConfig{
+		trustDomain: td,
+		dataDir:     c.Server.DataDir,
+		plugins:     *c.Plugins,
+	}, nil
+}
@@ -0,0 +1,196 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+type server struct {
+	configPath string
+	dataDir    string
+}
+
+func newServer(t *testing.T, trustDomain string) *server {
+	dir := t.TempDir()
+	s := &server{
+		configPath: filepath.Join(dir, "server.conf"),
+		dataDir:    filepath.Join(dir, "data"),
+	}
+	config := fmt.Sprintf(`
+server {
+	trust_domain = %q
+	data_dir = %q
+}
+
+plugins {
+	DataStore "sql" {
+		plugin_data {
+			database_type = "sqlite3"
+			connection_string = %q
+		}
+	}
+}
+`, trustDomain, s.dataDir, filepath.Join(dir, "datastore.sqlite3"))
+	require.NoError(t, os.WriteFile(s.configPath, []byte(config), 0600))
+	return s
+}
+
+func (s *server) createEntry(t *testing.T, spiffeID string) {
+	c, err := loadServerConfig(s.configPath, false)
+	require.NoError(t, err)
+	ds, err := c.openDataStore(common_cli.DefaultEnv)
+	require.NoError(t, err)
+	_, err = ds.CreateRegistrationEntry(ctx, &common.RegistrationEntry{
+		SpiffeId:  spiffeID,
+		ParentId:  "spiffe://example.org/spire/server",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+	})
+	require.NoError(t, err)
+}
+
+func (s *server) listEntries(t *testing.T) []string {
+	c, err := loadServerConfig(s.configPath, false)
+	require.NoError(t, err)
+	ds, err := c.openDataStore(common_cli.DefaultEnv)
+	require.NoError(t, err)
+	resp, err := ds.ListRegistrationEntries(ctx, &datastore.ListRegistrationEntriesRequest{})
+	require.NoError(t, err)
+
+	var ids []string
+	for _, entry := range resp.Entries {
+		ids = append(ids, entry.EntryId+" "+entry.SpiffeId)
+	}
+	return ids
+}
+
+func runCommand(cmd interface{ Run([]string) int }, env *common_cli.Env, args ...string) (int, string, string) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	env.Stdout, env.Stderr = stdout, stderr
+	code := cmd.Run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	source := newServer(t, "example.org")
+	source.createEntry(t, "spiffe://example.org/web")
+	require.NoError(t, os.MkdirAll(source.dataDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source.dataDir, "journal.pem"), []byte("journal"), 0600))
+
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+	env := new(common_cli.Env)
+	takenAt := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	backup := newBackupCommand(env, func() time.Time { return takenAt })
+	code, stdout, stderr := runCommand(backup, env, "-config", source.configPath, "-output", snapshotPath)
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, fmt.Sprintf("Wrote 0 bundles, 0 agents and 1 entries to %s\n", snapshotPath), stdout)
+
+	info, err := os.Stat(snapshotPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	target := newServer(t, "example.org")
+	restore := newRestoreCommand(env)
+	code, stdout, stderr = runCommand(restore, env, "-config", target.configPath, "-input", snapshotPath)
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "Restored 0 bundles, 0 agents and 1 entries taken at 2023-01-02T03:04:05Z\n"+
+		fmt.Sprintf("Restored the CA journal to %s\n", filepath.Join(target.dataDir, "journal.pem")), stdout)
+
+	// The entries keep their IDs
+	assert.Equal(t, source.listEntries(t), target.listEntries(t))
+	journal, err := os.ReadFile(filepath.Join(target.dataDir, "journal.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, "journal", string(journal))
+
+	// The CA journal is not overwritten
+	code, _, stderr = runCommand(restore, env, "-config", target.configPath, "-input", snapshotPath)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, fmt.Sprintf("Error: CA journal %s already exists\n", filepath.Join(target.dataDir, "journal.pem")), stderr)
+
+	// Nor is a datastore that is not empty
+	require.NoError(t, os.Remove(filepath.Join(target.dataDir, "journal.pem")))
+	code, _, stderr = runCommand(restore, env, "-config", target.configPath, "-input", snapshotPath)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "Error: unable to restore snapshot: datastore is not empty: it has 0 bundles, 0 agents and 1 entries\n", stderr)
+}
+
+func TestBackupWithoutJournal(t *testing.T) {
+	source := newServer(t, "example.org")
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+	env := new(common_cli.Env)
+	backup := newBackupCommand(env, time.Now)
+	code, stdout, stderr := runCommand(backup, env, "-config", source.configPath, "-output", snapshotPath)
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, fmt.Sprintf("No CA journal found at %s\nWrote 0 bundles, 0 agents and 0 entries to %s\n",
+		filepath.Join(source.dataDir, "journal.pem"), snapshotPath), stdout)
+
+	// Without a CA journal, there is none to restore
+	target := newServer(t, "example.org")
+	restore := newRestoreCommand(env)
+	code, stdout, stderr = runCommand(restore, env, "-config", target.configPath, "-input", snapshotPath)
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "Restored 0 bundles, 0 agents and 0 entries taken at ")
+	assert.NotContains(t, stdout, "CA journal")
+	assert.NoFileExists(t, filepath.Join(target.dataDir, "journal.pem"))
+}
+
+func TestBackupAndRestoreErrors(t *testing.T) {
+	source := newServer(t, "example.org")
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+	env := new(common_cli.Env)
+	code, _, stderr := runCommand(newBackupCommand(env, time.Now), env, "-config", source.configPath, "-output", snapshotPath)
+	require.Equal(t, 0, code, stderr)
+
+	for _, tt := range []struct {
+		name      string
+		restore   bool
+		args      []string
+		expectErr string
+	}{
+		{
+			name:      "backup without output",
+			args:      []string{"-config", source.configPath},
+			expectErr: "Error: an output path is required\n",
+		},
+		{
+			name:      "restore without input",
+			restore:   true,
+			args:      []string{"-config", newServer(t, "example.org").configPath},
+			expectErr: "Error: an input path is required\n",
+		},
+		{
+			name:      "restore into another trust domain",
+			restore:   true,
+			args:      []string{"-config", newServer(t, "other.org").configPath, "-input", snapshotPath},
+			expectErr: "Error: snapshot was taken from trust domain \"example.org\", not \"other.org\"\n",
+		},
+		{
+			name:      "missing config",
+			args:      []string{"-config", filepath.Join(t.TempDir(), "missing.conf"), "-output", snapshotPath},
+			expectErr: "Error: could not find config file ",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newBackupCommand(env, time.Now)
+			if tt.restore {
+				cmd = newRestoreCommand(env)
+			}
+			code, _, stderr := runCommand(cmd, env, tt.args...)
+			assert.Equal(t, 1, code)
+			assert.Contains(t, stderr, tt.expectErr)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mitchellh/cli"
+	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/pkg/common/diskutil"
+	"github.com/spiffe/spire/pkg/server/ca"
+	"github.com/spiffe/spire/pkg/server/datastore/backup"
+)
+
+// NewRestoreCommand creates a new "datastore restore" command
+func NewRestoreCommand() cli.Command {
+	return newRestoreCommand(common_cli.DefaultEnv)
+}
+
+func newRestoreCommand(env *common_cli.Env) cli.Command {
+	return adaptCommand(env, new(restoreCommand))
+}
+
+type restoreCommand struct {
+	input string
+}
+
+func (*restoreCommand) Name() string {
+	return "datastore restore"
+}
+
+func (*restoreCommand) Synopsis() string {
+	return "Restores a snapshot written by \"datastore backup\" into an empty datastore"
+}
+
+func (c *restoreCommand) AppendFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.input, "input", "", "Path to read the snapshot from")
+}
+
+// Run restores the snapshot into the datastore and the CA journal into the
+// data directory of the server. The server must not have run with them yet.
+func (c *restoreCommand) Run(ctx context.Context, env *common_cli.Env, server *serverConfig) error {
+	if c.input == "" {
+		return errors.New("an input path is required")
+	}
+
+	f, err := os.Open(c.input)
+	if err != nil {
+		return fmt.Errorf("unable to open snapshot: %w", err)
+	}
+	defer f.Close()
+	snapshot, err := backup.Read(f)
+	if err != nil {
+		return err
+	}
+
+	// The server only accepts the entries of its own trust domain
+	if snapshot.TrustDomain != server.trustDomain.String() {
+		return fmt.Errorf("snapshot was taken from trust domain %q, not %q", snapshot.TrustDomain, server.trustDomain)
+	}
+
+	// Check for a CA journal before restoring the datastore, so a restore
+	// that can't complete doesn't leave the datastore half restored
+	journalPath := ca.JournalPath(server.dataDir)
+	if len(snapshot.CAJournal) > 0 {
+		switch _, err := os.Stat(journalPath); {
+		case err == nil:
+			return fmt.Errorf("CA journal %s already exists", journalPath)
+		case !os.IsNotExist(err):
+			return fmt.Errorf("unable to check for CA journal: %w", err)
+		}
+	}
+
+	ds, err := server.openDataStore(env)
+	if err != nil {
+		return err
+	}
+	if err := backup.Restore(ctx, ds, snapshot); err != nil {
+		return fmt.Errorf("unable to restore snapshot: %w", err)
+	}
+	if err := env.Printf("Restored %d bundles, %d agents and %d entries taken at %s\n",
+		len(snapshot.Bundles), len(snapshot.Agents), len(snapshot.Entries), snapshot.TakenAt.Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	if len(snapshot.CAJournal) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(server.dataDir, 0755); err != nil {
+		return fmt.Errorf("unable to create data directory: %w", err)
+	}
+	if err := diskutil.AtomicWriteFile(journalPath, snapshot.CAJournal, 0644); err != nil {
+		return fmt.Errorf("unable to write CA journal: %w", err)
+	}
+	return env.Printf("Restored the CA journal to %s\n", journalPath)
+}
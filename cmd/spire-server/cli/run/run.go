@@ -9,9 +9,12 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,17 +25,27 @@ import (
 	"github.com/mitchellh/cli"
 	"github.com/sirupsen/logrus"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"github.com/spiffe/spire/pkg/common/catalog"
 	common_cli "github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/pkg/common/fips"
 	"github.com/spiffe/spire/pkg/common/health"
 	"github.com/spiffe/spire/pkg/common/idutil"
 	"github.com/spiffe/spire/pkg/common/log"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	"github.com/spiffe/spire/pkg/common/util"
 	"github.com/spiffe/spire/pkg/server"
+	"github.com/spiffe/spire/pkg/server/api"
+	"github.com/spiffe/spire/pkg/server/api/middleware"
 	bundleClient "github.com/spiffe/spire/pkg/server/bundle/client"
 	"github.com/spiffe/spire/pkg/server/ca"
+	"github.com/spiffe/spire/pkg/server/cache/dscache"
+	"github.com/spiffe/spire/pkg/server/cache/entrycache"
+	"github.com/spiffe/spire/pkg/server/cloudevents"
+	"github.com/spiffe/spire/pkg/server/endpoints/admin"
 	"github.com/spiffe/spire/pkg/server/endpoints/bundle"
+	"github.com/spiffe/spire/pkg/server/lastseen"
+	"github.com/spiffe/spire/pkg/server/nodeevents"
 	"github.com/spiffe/spire/pkg/server/plugin/keymanager"
 )
 
@@ -69,12 +82,15 @@ type serverConfig struct {
 	CAKeyType      string             `hcl:"ca_key_type"`
 	CASubject      *caSubjectConfig   `hcl:"ca_subject"`
 	CATTL          string             `hcl:"ca_ttl"`
+	ClockSkew      string             `hcl:"clock_skew_tolerance"`
 	DataDir        string             `hcl:"data_dir"`
 	DefaultSVIDTTL string             `hcl:"default_svid_ttl"`
 	Experimental   experimentalConfig `hcl:"experimental"`
+	FIPSMode       bool               `hcl:"fips_mode"`
 	Federation     *federationConfig  `hcl:"federation"`
 	JWTIssuer      string             `hcl:"jwt_issuer"`
 	JWTKeyType     string             `hcl:"jwt_key_type"`
+	JWTSVIDX5C     bool               `hcl:"jwt_svid_x5c"`
 	LogFile        string             `hcl:"log_file"`
 	LogLevel       string             `hcl:"log_level"`
 	LogFormat      string             `hcl:"log_format"`
@@ -101,11 +117,85 @@ type serverConfig struct {
 }
 
 type experimentalConfig struct {
-	CacheReloadInterval string `hcl:"cache_reload_interval"`
+	CacheReloadInterval string                   `hcl:"cache_reload_interval"`
+	DrainTimeout        string                   `hcl:"drain_timeout"`
+	NodeEventsWebhook   *nodeEventsWebhookConfig `hcl:"node_events_webhook"`
+	CloudEvents         *cloudEventsConfig       `hcl:"cloud_events"`
+	DownstreamPolicy    *downstreamPolicyConfig  `hcl:"downstream_policy"`
+	AdminAPI            *adminAPIConfig          `hcl:"admin_api"`
+	SPIFFEIDPolicy      *spiffeIDPolicyConfig    `hcl:"spiffe_id_policy"`
+	EntryOwnership      *entryOwnershipConfig    `hcl:"entry_ownership"`
+	DatastoreCache      *datastoreCacheConfig    `hcl:"datastore_cache"`
+	AgentLastSeen       *agentLastSeenConfig     `hcl:"agent_last_seen"`
+
+	EntryTemplates map[string]entryTemplateConfig `hcl:"entry_templates"`
 
 	UnusedKeys []string `hcl:",unusedKeys"`
 }
 
+type spiffeIDPolicyConfig struct {
+	Action          string   `hcl:"action"`
+	LowercasePath   bool     `hcl:"lowercase_path"`
+	NoTrailingSlash bool     `hcl:"no_trailing_slash"`
+	MaxSegments     int      `hcl:"max_segments"`
+	UnusedKeys      []string `hcl:",unusedKeys"`
+}
+
+type entryOwnershipConfig struct {
+	OverrideIDs []string `hcl:"override_ids"`
+	UnusedKeys  []string `hcl:",unusedKeys"`
+}
+
+type entryTemplateConfig struct {
+	NodeSelectors []string `hcl:"node_selectors"`
+	SPIFFEID      string   `hcl:"spiffe_id"`
+	Selectors     []string `hcl:"selectors"`
+	DNSNames      []string `hcl:"dns_names"`
+	TTL           string   `hcl:"ttl"`
+	FederatesWith []string `hcl:"federates_with"`
+	UnusedKeys    []string `hcl:",unusedKeys"`
+}
+
+type datastoreCacheConfig struct {
+	TTL                 string   `hcl:"ttl"`
+	RegistrationEntries bool     `hcl:"registration_entries"`
+	AttestedNodes       bool     `hcl:"attested_nodes"`
+	UnusedKeys          []string `hcl:",unusedKeys"`
+}
+
+type agentLastSeenConfig struct {
+	StaleAfter string   `hcl:"stale_after"`
+	EvictAfter string   `hcl:"evict_after"`
+	UnusedKeys []string `hcl:",unusedKeys"`
+}
+
+type adminAPIConfig struct {
+	Address            string   `hcl:"address"`
+	Port               int      `hcl:"port"`
+	ExpiringSoonWindow string   `hcl:"expiring_soon_window"`
+	ProfilingEnabled   bool     `hcl:"profiling_enabled"`
+	UnusedKeys         []string `hcl:",unusedKeys"`
+}
+
+type nodeEventsWebhookConfig struct {
+	URL        string   `hcl:"url"`
+	Timeout    string   `hcl:"timeout"`
+	UnusedKeys []string `hcl:",unusedKeys"`
+}
+
+type cloudEventsConfig struct {
+	URL        string   `hcl:"url"`
+	Source     string   `hcl:"source"`
+	Timeout    string   `hcl:"timeout"`
+	UnusedKeys []string `hcl:",unusedKeys"`
+}
+
+type downstreamPolicyConfig struct {
+	AllowedIDs        []string `hcl:"allowed_ids"`
+	RequiredSelectors []string `hcl:"required_selectors"`
+	UnusedKeys        []string `hcl:",unusedKeys"`
+}
+
 type caSubjectConfig struct {
 	Country      []string `hcl:"country"`
 	Organization []string `hcl:"organization"`
@@ -166,9 +256,11 @@ type httpsWebProfileConfig struct {
 }
 
 type rateLimitConfig struct {
-	Attestation *bool    `hcl:"attestation"`
-	Signing     *bool    `hcl:"signing"`
-	UnusedKeys  []string `hcl:",unusedKeys"`
+	Attestation               *bool    `hcl:"attestation"`
+	Signing                   *bool    `hcl:"signing"`
+	SigningQuotaPerAgent      int      `hcl:"signing_quota_per_agent"`
+	SigningQuotaPerDownstream int      `hcl:"signing_quota_per_downstream"`
+	UnusedKeys                []string `hcl:",unusedKeys"`
 }
 
 func NewRunCommand(logOptions []log.Option, allowUnknownConfig bool) cli.Command {
@@ -370,7 +462,7 @@ func NewServerConfig(c *Config, logOptions []log.Option, allowUnknownConfig bool
 	}
 	sc.Log = logger
 
-	ip := net.ParseIP(c.Server.BindAddress)
+	ip := util.ParseIP(c.Server.BindAddress)
 	if ip == nil {
 		return nil, fmt.Errorf("could not parse bind_address %q", c.Server.BindAddress)
 	}
@@ -414,11 +506,25 @@ func NewServerConfig(c *Config, logOptions []log.Option, allowUnknownConfig bool
 	}
 	sc.RateLimit.Signing = *c.Server.RateLimit.Signing
 
+	if c.Server.RateLimit.SigningQuotaPerAgent < 0 || c.Server.RateLimit.SigningQuotaPerDownstream < 0 {
+		return nil, errors.New("signing quotas cannot be negative")
+	}
+	sc.RateLimit.AgentSigningQuota = c.Server.RateLimit.SigningQuotaPerAgent
+	sc.RateLimit.DownstreamSigningQuota = c.Server.RateLimit.SigningQuotaPerDownstream
+
 	if c.Server.Federation != nil {
 		if c.Server.Federation.BundleEndpoint != nil {
+			// An empty address listens on all the addresses of the host
+			var ip net.IP
+			if address := c.Server.Federation.BundleEndpoint.Address; address != "" {
+				ip = util.ParseIP(address)
+				if ip == nil {
+					return nil, fmt.Errorf("could not parse federation.bundle_endpoint.address %q", address)
+				}
+			}
 			sc.Federation.BundleEndpoint = &bundle.EndpointConfig{
 				Address: &net.TCPAddr{
-					IP:   net.ParseIP(c.Server.Federation.BundleEndpoint.Address),
+					IP:   ip,
 					Port: c.Server.Federation.BundleEndpoint.Port,
 				},
 			}
@@ -491,6 +597,17 @@ func NewServerConfig(c *Config, logOptions []log.Option, allowUnknownConfig bool
 		sc.CATTL = ttl
 	}
 
+	if c.Server.ClockSkew != "" {
+		tolerance, err := time.ParseDuration(c.Server.ClockSkew)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse clock skew tolerance %q: %w", c.Server.ClockSkew, err)
+		}
+		if tolerance < 0 {
+			return nil, errors.New("clock skew tolerance cannot be negative")
+		}
+		sc.ClockSkewTolerance = tolerance
+	}
+
 	if !hasExpectedTTLs(sc.CATTL, sc.SVIDTTL) {
 		sc.Log.Warnf("The configured SVID TTL cannot be guaranteed in all cases - SVIDs with shorter TTLs may be issued if the signing key is expiring soon. Set a CA TTL of at least 6x or reduce SVID TTL below 6x to avoid issuing SVIDs with a smaller TTL than specified")
 	}
@@ -515,6 +632,7 @@ func NewServerConfig(c *Config, logOptions []log.Option, allowUnknownConfig bool
 	}
 
 	sc.JWTIssuer = c.Server.JWTIssuer
+	sc.JWTX5C = c.Server.JWTSVIDX5C
 
 	if subject := c.Server.CASubject; subject != nil {
 		sc.CASubject = pkix.Name{
@@ -535,6 +653,12 @@ func NewServerConfig(c *Config, logOptions []log.Option, allowUnknownConfig bool
 	sc.Telemetry = c.Telemetry
 	sc.HealthChecks = c.HealthChecks
 
+	fipsMode, err := parseFIPSMode(c.Server.FIPSMode, *c.Plugins, logger)
+	if err != nil {
+		return nil, err
+	}
+	sc.FIPSMode = fipsMode
+
 	if !allowUnknownConfig {
 		if err := checkForUnknownConfig(c, sc.Log); err != nil {
 			return nil, err
@@ -549,9 +673,334 @@ func NewServerConfig(c *Config, logOptions []log.Option, allowUnknownConfig bool
 		sc.CacheReloadInterval = interval
 	}
 
+	if c.Server.Experimental.DrainTimeout != "" {
+		timeout, err := time.ParseDuration(c.Server.Experimental.DrainTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse drain timeout: %w", err)
+		}
+		sc.DrainTimeout = timeout
+	}
+
+	if c.Server.Experimental.NodeEventsWebhook != nil {
+		webhookConfig, err := parseNodeEventsWebhookConfig(c.Server.Experimental.NodeEventsWebhook)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse node events webhook config: %w", err)
+		}
+		sc.NodeEventsWebhook = webhookConfig
+	}
+
+	if c.Server.Experimental.CloudEvents != nil {
+		cloudEventsConfig, err := parseCloudEventsConfig(c.Server.Experimental.CloudEvents)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse cloud events config: %w", err)
+		}
+		sc.CloudEvents = cloudEventsConfig
+	}
+
+	if c.Server.Experimental.DownstreamPolicy != nil {
+		downstreamPolicy, err := parseDownstreamPolicyConfig(c.Server.Experimental.DownstreamPolicy, sc.TrustDomain)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse downstream policy config: %w", err)
+		}
+		sc.DownstreamPolicy = downstreamPolicy
+	}
+
+	if c.Server.Experimental.SPIFFEIDPolicy != nil {
+		idPolicy, err := parseSPIFFEIDPolicyConfig(c.Server.Experimental.SPIFFEIDPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse SPIFFE ID policy config: %w", err)
+		}
+		sc.IDPolicy = idPolicy
+	}
+
+	if c.Server.Experimental.EntryOwnership != nil {
+		ownershipPolicy, err := parseEntryOwnershipConfig(c.Server.Experimental.EntryOwnership)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse entry ownership config: %w", err)
+		}
+		sc.OwnershipPolicy = ownershipPolicy
+	}
+
+	if c.Server.Experimental.AdminAPI != nil {
+		adminAPI, err := parseAdminAPIConfig(c.Server.Experimental.AdminAPI)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse admin API config: %w", err)
+		}
+		sc.AdminAPI = adminAPI
+	}
+
+	if c.Server.Experimental.DatastoreCache != nil {
+		datastoreCache, err := parseDatastoreCacheConfig(c.Server.Experimental.DatastoreCache)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse datastore cache config: %w", err)
+		}
+		sc.DatastoreCache = datastoreCache
+	}
+
+	if c.Server.Experimental.AgentLastSeen != nil {
+		agentLastSeen, err := parseAgentLastSeenConfig(c.Server.Experimental.AgentLastSeen)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse agent last seen config: %w", err)
+		}
+		sc.AgentLastSeen = agentLastSeen
+	}
+
+	// Templates are instantiated in the order of their names, for the
+	// entries of agents to be stable
+	var templateNames []string
+	for name := range c.Server.Experimental.EntryTemplates {
+		templateNames = append(templateNames, name)
+	}
+	sort.Strings(templateNames)
+	for _, name := range templateNames {
+		template, err := parseEntryTemplateConfig(name, c.Server.Experimental.EntryTemplates[name], sc.TrustDomain)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse entry template %q: %w", name, err)
+		}
+		sc.EntryTemplates = append(sc.EntryTemplates, template)
+	}
+
 	return sc, nil
 }
 
+func parseEntryTemplateConfig(name string, c entryTemplateConfig, td spiffeid.TrustDomain) (*entrycache.Template, error) {
+	config := entrycache.TemplateConfig{
+		Name:          name,
+		SPIFFEID:      c.SPIFFEID,
+		DNSNames:      c.DNSNames,
+		FederatesWith: c.FederatesWith,
+	}
+	var err error
+	if config.NodeSelectors, err = parseEntryTemplateSelectors(c.NodeSelectors); err != nil {
+		return nil, fmt.Errorf("invalid node selectors: %w", err)
+	}
+	if config.Selectors, err = parseEntryTemplateSelectors(c.Selectors); err != nil {
+		return nil, fmt.Errorf("invalid selectors: %w", err)
+	}
+	if c.TTL != "" {
+		ttl, err := time.ParseDuration(c.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl: %w", err)
+		}
+		config.TTL = int32(ttl / time.Second)
+	}
+	for _, trustDomain := range c.FederatesWith {
+		if _, err := spiffeid.TrustDomainFromString(trustDomain); err != nil {
+			return nil, fmt.Errorf("invalid federated trust domain %q: %w", trustDomain, err)
+		}
+	}
+	return entrycache.NewTemplate(td, config)
+}
+
+func parseEntryTemplateSelectors(rawSelectors []string) ([]*types.Selector, error) {
+	var selectors []*types.Selector
+	for _, rawSelector := range rawSelectors {
+		parts := strings.SplitN(rawSelector, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid selector %q: must be in the form type:value", rawSelector)
+		}
+		selectors = append(selectors, &types.Selector{
+			Type:  parts[0],
+			Value: parts[1],
+		})
+	}
+	return selectors, nil
+}
+
+func parseDatastoreCacheConfig(c *datastoreCacheConfig) (dscache.Config, error) {
+	config := dscache.Config{
+		RegistrationEntries: c.RegistrationEntries,
+		AttestedNodes:       c.AttestedNodes,
+	}
+	if c.TTL != "" {
+		ttl, err := time.ParseDuration(c.TTL)
+		if err != nil {
+			return dscache.Config{}, fmt.Errorf("invalid ttl: %w", err)
+		}
+		if ttl <= 0 {
+			return dscache.Config{}, errors.New("ttl must be positive")
+		}
+		config.TTL = ttl
+	}
+	return config, nil
+}
+
+func parseAgentLastSeenConfig(c *agentLastSeenConfig) (*lastseen.Config, error) {
+	// When the agents were last seen is only recorded every RecordInterval,
+	// so shorter thresholds would report agents that are syncing
+	minThreshold := 2 * lastseen.RecordInterval
+	config := &lastseen.Config{
+		StaleAfter: lastseen.DefaultStaleAfter,
+	}
+	if c.StaleAfter != "" {
+		staleAfter, err := time.ParseDuration(c.StaleAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stale_after: %w", err)
+		}
+		if staleAfter < minThreshold {
+			return nil, fmt.Errorf("stale_after must be at least %s", minThreshold)
+		}
+		config.StaleAfter = staleAfter
+	}
+	if c.EvictAfter != "" {
+		evictAfter, err := time.ParseDuration(c.EvictAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid evict_after: %w", err)
+		}
+		if evictAfter < config.StaleAfter {
+			return nil, errors.New("evict_after must not be shorter than stale_after")
+		}
+		config.EvictAfter = evictAfter
+	}
+	return config, nil
+}
+
+func parseSPIFFEIDPolicyConfig(c *spiffeIDPolicyConfig) (api.IDPolicy, error) {
+	policy := api.IDPolicy{
+		Action:          api.IDPolicyReject,
+		LowercasePath:   c.LowercasePath,
+		NoTrailingSlash: c.NoTrailingSlash,
+		MaxSegments:     c.MaxSegments,
+	}
+	switch api.IDPolicyAction(c.Action) {
+	case "", api.IDPolicyReject:
+	case api.IDPolicyNormalize:
+		policy.Action = api.IDPolicyNormalize
+	default:
+		return api.IDPolicy{}, fmt.Errorf("invalid action %q: must be %q or %q", c.Action, api.IDPolicyReject, api.IDPolicyNormalize)
+	}
+	if c.MaxSegments < 0 {
+		return api.IDPolicy{}, errors.New("max_segments cannot be negative")
+	}
+	return policy, nil
+}
+
+func parseEntryOwnershipConfig(c *entryOwnershipConfig) (api.OwnershipPolicy, error) {
+	policy := api.OwnershipPolicy{
+		Enforced: true,
+	}
+	for _, rawID := range c.OverrideIDs {
+		id, err := spiffeid.FromString(rawID)
+		if err != nil {
+			return api.OwnershipPolicy{}, fmt.Errorf("invalid override ID %q: %w", rawID, err)
+		}
+		policy.OverrideIDs = append(policy.OverrideIDs, id.String())
+	}
+	return policy, nil
+}
+
+func parseAdminAPIConfig(c *adminAPIConfig) (*admin.EndpointConfig, error) {
+	address := c.Address
+	if address == "" {
+		address = "0.0.0.0"
+	}
+	ip := util.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("could not parse address %q", c.Address)
+	}
+	if c.Port <= 0 {
+		return nil, errors.New("port must be set")
+	}
+
+	adminAPI := &admin.EndpointConfig{
+		Address: &net.TCPAddr{
+			IP:   ip,
+			Port: c.Port,
+		},
+		ProfilingEnabled: c.ProfilingEnabled,
+	}
+	if c.ExpiringSoonWindow != "" {
+		window, err := time.ParseDuration(c.ExpiringSoonWindow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiring soon window: %w", err)
+		}
+		if window <= 0 {
+			return nil, errors.New("expiring soon window must be positive")
+		}
+		adminAPI.ExpiringSoonWindow = window
+	}
+	return adminAPI, nil
+}
+
+func parseDownstreamPolicyConfig(c *downstreamPolicyConfig, td spiffeid.TrustDomain) (middleware.DownstreamPolicy, error) {
+	var policy middleware.DownstreamPolicy
+	for _, rawID := range c.AllowedIDs {
+		id, err := spiffeid.FromString(rawID)
+		if err != nil {
+			return middleware.DownstreamPolicy{}, fmt.Errorf("invalid allowed ID %q: %w", rawID, err)
+		}
+		if !id.MemberOf(td) {
+			return middleware.DownstreamPolicy{}, fmt.Errorf("invalid allowed ID %q: must be in the trust domain %q", rawID, td)
+		}
+		policy.AllowedIDs = append(policy.AllowedIDs, id)
+	}
+	for _, rawSelector := range c.RequiredSelectors {
+		parts := strings.SplitN(rawSelector, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return middleware.DownstreamPolicy{}, fmt.Errorf("invalid required selector %q: must be in the form type:value", rawSelector)
+		}
+		policy.RequiredSelectors = append(policy.RequiredSelectors, &types.Selector{
+			Type:  parts[0],
+			Value: parts[1],
+		})
+	}
+	return policy, nil
+}
+
+func parseNodeEventsWebhookConfig(c *nodeEventsWebhookConfig) (*nodeevents.WebhookConfig, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q: must be an absolute http or https URL", c.URL)
+	}
+
+	webhookConfig := &nodeevents.WebhookConfig{
+		URL: c.URL,
+	}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		if timeout <= 0 {
+			return nil, errors.New("timeout must be positive")
+		}
+		webhookConfig.Timeout = timeout
+	}
+	return webhookConfig, nil
+}
+
+func parseCloudEventsConfig(c *cloudEventsConfig) (*cloudevents.Config, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q: must be an absolute http or https URL", c.URL)
+	}
+	if _, err := url.Parse(c.Source); err != nil {
+		return nil, fmt.Errorf("invalid source: %w", err)
+	}
+
+	cloudEventsConfig := &cloudevents.Config{
+		URL:    c.URL,
+		Source: c.Source,
+	}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		if timeout <= 0 {
+			return nil, errors.New("timeout must be positive")
+		}
+		cloudEventsConfig.Timeout = timeout
+	}
+	return cloudEventsConfig, nil
+}
+
 func parseBundleEndpointProfile(config federatesWithConfig) (trustDomainConfig *bundleClient.TrustDomainConfig, err error) {
 	// First check the number of bundle endpoint profiles in the config
 	objectList, ok := config.BundleEndpointProfile.(*ast.ObjectList)
@@ -619,7 +1068,7 @@ func parseDeprecatedBundleEndpoint(config *deprecatedFederatesWithBundleEndpoint
 
 	return &bundleClient.TrustDomainConfig{
 		DeprecatedConfig: true,
-		EndpointURL:      fmt.Sprintf("https://%s:%d", config.Address, port),
+		EndpointURL:      "https://" + util.JoinHostPort(config.Address, strconv.Itoa(port)),
 		EndpointProfile:  endpointProfile,
 	}, nil
 }
@@ -794,6 +1243,27 @@ func defaultConfig() *Config {
 	}
 }
 
+// parseFIPSMode returns whether FIPS mode is on, i.e. it is enabled by the
+// config or the server was built for it. In FIPS mode, the key material
+// configured for the plugins is validated.
+func parseFIPSMode(enabled bool, plugins catalog.HCLPluginConfigMap, logger logrus.FieldLogger) (bool, error) {
+	if err := fips.CheckBuild(); err != nil {
+		return false, err
+	}
+	if !enabled && !fips.BuildEnabled() {
+		return false, nil
+	}
+
+	pluginConfigs, err := catalog.PluginConfigsFromHCL(plugins)
+	if err != nil {
+		return false, err
+	}
+	if err := fips.ValidatePluginConfigs(pluginConfigs, logger); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func keyTypeFromString(s string) (keymanager.KeyType, error) {
 	switch strings.ToLower(s) {
 	case "rsa-2048":
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/x509/pkix"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -15,10 +16,19 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"github.com/spiffe/spire/pkg/common/catalog"
+	"github.com/spiffe/spire/pkg/common/fips"
 	"github.com/spiffe/spire/pkg/common/log"
 	"github.com/spiffe/spire/pkg/server"
+	"github.com/spiffe/spire/pkg/server/api"
+	"github.com/spiffe/spire/pkg/server/api/middleware"
 	bundleClient "github.com/spiffe/spire/pkg/server/bundle/client"
+	"github.com/spiffe/spire/pkg/server/cache/dscache"
+	"github.com/spiffe/spire/pkg/server/cloudevents"
+	"github.com/spiffe/spire/pkg/server/endpoints/admin"
+	"github.com/spiffe/spire/pkg/server/lastseen"
+	"github.com/spiffe/spire/pkg/server/nodeevents"
 	"github.com/spiffe/spire/pkg/server/plugin/keymanager"
 	"github.com/spiffe/spire/test/spiretest"
 	"github.com/stretchr/testify/assert"
@@ -554,6 +564,16 @@ func TestNewServerConfig(t *testing.T) {
 				require.Equal(t, 1337, c.BindAddress.Port)
 			},
 		},
+		{
+			msg: "IPv6 bind_address should be correctly parsed, with or without brackets",
+			input: func(c *Config) {
+				c.Server.BindAddress = "[::]"
+				c.Server.BindPort = 1337
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, "[::]:1337", c.BindAddress.String())
+			},
+		},
 		{
 			msg:         "invalid bind_address should return an error",
 			expectError: true,
@@ -633,6 +653,23 @@ func TestNewServerConfig(t *testing.T) {
 				require.Equal(t, "ISSUER", c.JWTIssuer)
 			},
 		},
+		{
+			msg: "jwt_svid_x5c is disabled by default",
+			input: func(c *Config) {
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.False(t, c.JWTX5C)
+			},
+		},
+		{
+			msg: "jwt_svid_x5c is correctly configured",
+			input: func(c *Config) {
+				c.Server.JWTSVIDX5C = true
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.True(t, c.JWTX5C)
+			},
+		},
 		{
 			msg: "logger gets set correctly",
 			input: func(c *Config) {
@@ -696,6 +733,35 @@ func TestNewServerConfig(t *testing.T) {
 				require.Equal(t, 1337, c.Federation.BundleEndpoint.Address.Port)
 			},
 		},
+		{
+			msg: "bundle endpoint IPv6 address is parsed and configured correctly",
+			input: func(c *Config) {
+				c.Server.Federation = &federationConfig{
+					BundleEndpoint: &bundleEndpointConfig{
+						Address: "fd00::1",
+						Port:    1337,
+					},
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, "[fd00::1]:1337", c.Federation.BundleEndpoint.Address.String())
+			},
+		},
+		{
+			msg:         "invalid bundle endpoint address should return an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Federation = &federationConfig{
+					BundleEndpoint: &bundleEndpointConfig{
+						Address: "not-an-ip-address",
+						Port:    1337,
+					},
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
 		{
 			msg: "bundle federates with section is parsed and configured correctly (deprecated config)",
 			input: func(c *Config) {
@@ -801,6 +867,35 @@ func TestNewServerConfig(t *testing.T) {
 				require.Nil(t, c)
 			},
 		},
+		{
+			msg: "clock_skew_tolerance is correctly parsed",
+			input: func(c *Config) {
+				c.Server.ClockSkew = "2m"
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, 2*time.Minute, c.ClockSkewTolerance)
+			},
+		},
+		{
+			msg:         "invalid clock_skew_tolerance returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.ClockSkew = "b"
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg:         "negative clock_skew_tolerance returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.ClockSkew = "-1m"
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
 		{
 			msg: "ca_key_type and jwt_key_type are set as default",
 			input: func(c *Config) {
@@ -1031,6 +1126,36 @@ func TestNewServerConfig(t *testing.T) {
 				require.True(t, c.RateLimit.Signing)
 			},
 		},
+		{
+			msg: "signing quotas are off by default",
+			input: func(c *Config) {
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Zero(t, c.RateLimit.AgentSigningQuota)
+				require.Zero(t, c.RateLimit.DownstreamSigningQuota)
+			},
+		},
+		{
+			msg: "signing quotas can be set",
+			input: func(c *Config) {
+				c.Server.RateLimit.SigningQuotaPerAgent = 600
+				c.Server.RateLimit.SigningQuotaPerDownstream = 10
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, 600, c.RateLimit.AgentSigningQuota)
+				require.Equal(t, 10, c.RateLimit.DownstreamSigningQuota)
+			},
+		},
+		{
+			msg:         "signing quotas cannot be negative",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.RateLimit.SigningQuotaPerAgent = -1
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
 		{
 			msg: "warn_on_long_trust_domain",
 			input: func(c *Config) {
@@ -1078,6 +1203,459 @@ func TestNewServerConfig(t *testing.T) {
 				require.Nil(t, c)
 			},
 		},
+		{
+			msg: "drain_timeout is correctly parsed",
+			input: func(c *Config) {
+				c.Server.Experimental.DrainTimeout = "30s"
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, 30*time.Second, c.DrainTimeout)
+			},
+		},
+		{
+			msg:         "invalid drain_timeout returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.DrainTimeout = "b"
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg: "node_events_webhook is correctly parsed",
+			input: func(c *Config) {
+				c.Server.Experimental.NodeEventsWebhook = &nodeEventsWebhookConfig{
+					URL:     "https://inventory.example.org/events",
+					Timeout: "10s",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, &nodeevents.WebhookConfig{
+					URL:     "https://inventory.example.org/events",
+					Timeout: 10 * time.Second,
+				}, c.NodeEventsWebhook)
+			},
+		},
+		{
+			msg:         "node_events_webhook with a relative url returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.NodeEventsWebhook = &nodeEventsWebhookConfig{
+					URL: "/events",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg:         "node_events_webhook with an invalid timeout returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.NodeEventsWebhook = &nodeEventsWebhookConfig{
+					URL:     "https://inventory.example.org/events",
+					Timeout: "-1s",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg: "cloud_events is correctly parsed",
+			input: func(c *Config) {
+				c.Server.Experimental.CloudEvents = &cloudEventsConfig{
+					URL:     "https://broker.example.org/spire",
+					Source:  "spiffe://example.org/spire/server",
+					Timeout: "10s",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, &cloudevents.Config{
+					URL:     "https://broker.example.org/spire",
+					Source:  "spiffe://example.org/spire/server",
+					Timeout: 10 * time.Second,
+				}, c.CloudEvents)
+			},
+		},
+		{
+			msg:         "cloud_events with a relative url returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.CloudEvents = &cloudEventsConfig{
+					URL: "/spire",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg:         "cloud_events with an invalid timeout returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.CloudEvents = &cloudEventsConfig{
+					URL:     "https://broker.example.org/spire",
+					Timeout: "-1s",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg: "spiffe_id_policy is correctly parsed",
+			input: func(c *Config) {
+				c.Server.Experimental.SPIFFEIDPolicy = &spiffeIDPolicyConfig{
+					Action:          "normalize",
+					LowercasePath:   true,
+					NoTrailingSlash: true,
+					MaxSegments:     4,
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, api.IDPolicy{
+					Action:          api.IDPolicyNormalize,
+					LowercasePath:   true,
+					NoTrailingSlash: true,
+					MaxSegments:     4,
+				}, c.IDPolicy)
+			},
+		},
+		{
+			msg: "spiffe_id_policy rejects violations by default",
+			input: func(c *Config) {
+				c.Server.Experimental.SPIFFEIDPolicy = &spiffeIDPolicyConfig{
+					LowercasePath: true,
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, api.IDPolicy{
+					Action:        api.IDPolicyReject,
+					LowercasePath: true,
+				}, c.IDPolicy)
+			},
+		},
+		{
+			msg:         "spiffe_id_policy with an unknown action returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.SPIFFEIDPolicy = &spiffeIDPolicyConfig{
+					Action: "warn",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg: "entry_ownership is correctly parsed",
+			input: func(c *Config) {
+				c.Server.Experimental.EntryOwnership = &entryOwnershipConfig{
+					OverrideIDs: []string{"spiffe://example.org/admin"},
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, api.OwnershipPolicy{
+					Enforced:    true,
+					OverrideIDs: []string{"spiffe://example.org/admin"},
+				}, c.OwnershipPolicy)
+			},
+		},
+		{
+			msg: "entry_ownership is not enforced by default",
+			input: func(c *Config) {
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, api.OwnershipPolicy{}, c.OwnershipPolicy)
+			},
+		},
+		{
+			msg:         "entry_ownership with an invalid override ID returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.EntryOwnership = &entryOwnershipConfig{
+					OverrideIDs: []string{"not-a-spiffe-id"},
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg: "entry_templates are correctly parsed",
+			input: func(c *Config) {
+				c.Server.Experimental.EntryTemplates = map[string]entryTemplateConfig{
+					"node-exporter": {
+						NodeSelectors: []string{"k8s_psat:cluster:prod"},
+						SPIFFEID:      "spiffe://example.org/node-exporter/{{ .AgentPath }}",
+						Selectors:     []string{"k8s:sa:node-exporter"},
+					},
+					"fluentd": {
+						NodeSelectors: []string{"k8s_psat:cluster:prod"},
+						SPIFFEID:      "spiffe://example.org/fluentd/{{ .AgentPath }}",
+						Selectors:     []string{"k8s:sa:fluentd"},
+						TTL:           "1h",
+					},
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Len(t, c.EntryTemplates, 2)
+				require.Equal(t, "fluentd", c.EntryTemplates[0].Name())
+				require.Equal(t, "node-exporter", c.EntryTemplates[1].Name())
+			},
+		},
+		{
+			msg:         "entry_templates with an invalid selector returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.EntryTemplates = map[string]entryTemplateConfig{
+					"fluentd": {
+						NodeSelectors: []string{"k8s_psat"},
+						SPIFFEID:      "spiffe://example.org/fluentd/{{ .AgentPath }}",
+						Selectors:     []string{"k8s:sa:fluentd"},
+					},
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg: "admin_api is correctly parsed",
+			input: func(c *Config) {
+				c.Server.Experimental.AdminAPI = &adminAPIConfig{
+					Address:            "127.0.0.1",
+					Port:               8443,
+					ExpiringSoonWindow: "12h",
+					ProfilingEnabled:   true,
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, &admin.EndpointConfig{
+					Address: &net.TCPAddr{
+						IP:   net.ParseIP("127.0.0.1"),
+						Port: 8443,
+					},
+					ExpiringSoonWindow: 12 * time.Hour,
+					ProfilingEnabled:   true,
+				}, c.AdminAPI)
+			},
+		},
+		{
+			msg: "admin_api listens on all addresses by default",
+			input: func(c *Config) {
+				c.Server.Experimental.AdminAPI = &adminAPIConfig{
+					Port: 8443,
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, &admin.EndpointConfig{
+					Address: &net.TCPAddr{
+						IP:   net.ParseIP("0.0.0.0"),
+						Port: 8443,
+					},
+				}, c.AdminAPI)
+			},
+		},
+		{
+			msg:         "admin_api without a port returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.AdminAPI = &adminAPIConfig{
+					Address: "127.0.0.1",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg:         "admin_api with an invalid expiring soon window returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.AdminAPI = &adminAPIConfig{
+					Port:               8443,
+					ExpiringSoonWindow: "soon",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg: "datastore_cache is correctly parsed",
+			input: func(c *Config) {
+				c.Server.Experimental.DatastoreCache = &datastoreCacheConfig{
+					TTL:                 "5s",
+					RegistrationEntries: true,
+					AttestedNodes:       true,
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, dscache.Config{
+					TTL:                 5 * time.Second,
+					RegistrationEntries: true,
+					AttestedNodes:       true,
+				}, c.DatastoreCache)
+			},
+		},
+		{
+			msg:         "datastore_cache with an invalid ttl returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.DatastoreCache = &datastoreCacheConfig{
+					TTL: "-1s",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg: "agent_last_seen defaults are correctly parsed",
+			input: func(c *Config) {
+				c.Server.Experimental.AgentLastSeen = &agentLastSeenConfig{}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, &lastseen.Config{
+					StaleAfter: time.Hour,
+				}, c.AgentLastSeen)
+			},
+		},
+		{
+			msg: "agent_last_seen is correctly parsed",
+			input: func(c *Config) {
+				c.Server.Experimental.AgentLastSeen = &agentLastSeenConfig{
+					StaleAfter: "30m",
+					EvictAfter: "168h",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, &lastseen.Config{
+					StaleAfter: 30 * time.Minute,
+					EvictAfter: 7 * 24 * time.Hour,
+				}, c.AgentLastSeen)
+			},
+		},
+		{
+			msg:         "agent_last_seen with a stale_after below the record interval returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.AgentLastSeen = &agentLastSeenConfig{
+					StaleAfter: "1m",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg:         "agent_last_seen with an evict_after shorter than stale_after returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.AgentLastSeen = &agentLastSeenConfig{
+					StaleAfter: "2h",
+					EvictAfter: "1h",
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg: "downstream_policy is correctly parsed",
+			input: func(c *Config) {
+				c.Server.Experimental.DownstreamPolicy = &downstreamPolicyConfig{
+					AllowedIDs:        []string{"spiffe://example.org/downstream"},
+					RequiredSelectors: []string{"k8s:ns:spire", "k8s:sa:spire-server"},
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, middleware.DownstreamPolicy{
+					AllowedIDs: []spiffeid.ID{spiffeid.Must("example.org", "downstream")},
+					RequiredSelectors: []*types.Selector{
+						{Type: "k8s", Value: "ns:spire"},
+						{Type: "k8s", Value: "sa:spire-server"},
+					},
+				}, c.DownstreamPolicy)
+			},
+		},
+		{
+			msg: "downstream_policy is empty by default",
+			input: func(c *Config) {
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, middleware.DownstreamPolicy{}, c.DownstreamPolicy)
+			},
+		},
+		{
+			msg:         "downstream_policy with an allowed ID of another trust domain returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.DownstreamPolicy = &downstreamPolicyConfig{
+					AllowedIDs: []string{"spiffe://otherdomain.test/downstream"},
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg:         "downstream_policy with an invalid allowed ID returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.DownstreamPolicy = &downstreamPolicyConfig{
+					AllowedIDs: []string{"downstream"},
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg:         "downstream_policy with an invalid required selector returns an error",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.Experimental.DownstreamPolicy = &downstreamPolicyConfig{
+					RequiredSelectors: []string{"k8s"},
+				}
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
+		{
+			msg: "fips_mode is disabled by default",
+			input: func(c *Config) {
+				c.Plugins = fipsPlugins("SHA256WITHECDSA")
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Equal(t, fips.BuildEnabled(), c.FIPSMode)
+			},
+		},
+		{
+			msg: "fips_mode is enabled",
+			input: func(c *Config) {
+				c.Server.FIPSMode = true
+				c.Plugins = fipsPlugins("SHA256WITHECDSA")
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.True(t, c.FIPSMode)
+			},
+		},
+		{
+			msg:         "fips_mode with unapproved plugin config",
+			expectError: true,
+			input: func(c *Config) {
+				c.Server.FIPSMode = true
+				c.Plugins = fipsPlugins("SHA1WITHRSA")
+			},
+			test: func(t *testing.T, c *server.Config) {
+				require.Nil(t, c)
+			},
+		},
 		{
 			msg: "auditlog_enabled is enabled",
 			input: func(c *Config) {
@@ -1119,6 +1697,21 @@ func TestNewServerConfig(t *testing.T) {
 	}
 }
 
+// fipsPlugins returns a plugin config with an UpstreamAuthority whose
+// signing algorithm is validated in FIPS mode
+func fipsPlugins(signingAlgorithm string) *catalog.HCLPluginConfigMap {
+	plugins := catalog.HCLPluginConfigMap{}
+	config := `UpstreamAuthority "awspca" {
+		plugin_data {
+			signing_algorithm = "` + signingAlgorithm + `"
+		}
+	}`
+	if err := hcl.Decode(&plugins, config); err != nil {
+		panic(err)
+	}
+	return &plugins
+}
+
 // defaultValidConfig returns the bare minimum config required to
 // pass validation etc
 func defaultValidConfig() *Config {
@@ -87,4 +87,5 @@ require (
 	k8s.io/kube-aggregator v0.18.2
 	k8s.io/utils v0.0.0-20201110183641-67b214c5f920
 	sigs.k8s.io/controller-runtime v0.6.0
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -15,11 +15,16 @@ import (
 	admin_api "github.com/spiffe/spire/pkg/agent/api"
 	node_attestor "github.com/spiffe/spire/pkg/agent/attestor/node"
 	workload_attestor "github.com/spiffe/spire/pkg/agent/attestor/workload"
+	"github.com/spiffe/spire/pkg/agent/canary"
 	"github.com/spiffe/spire/pkg/agent/catalog"
 	"github.com/spiffe/spire/pkg/agent/endpoints"
 	"github.com/spiffe/spire/pkg/agent/manager"
+	"github.com/spiffe/spire/pkg/agent/quarantine"
+	"github.com/spiffe/spire/pkg/common/clockskew"
+	"github.com/spiffe/spire/pkg/common/fips"
 	"github.com/spiffe/spire/pkg/common/health"
 	"github.com/spiffe/spire/pkg/common/profiling"
+	"github.com/spiffe/spire/pkg/common/systemd"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	"github.com/spiffe/spire/pkg/common/uptime"
 	"github.com/spiffe/spire/pkg/common/util"
@@ -31,12 +36,21 @@ import (
 
 type Agent struct {
 	c *Config
+
+	// clockSkew tracks the skew of the clock of the server, measured on
+	// each sync
+	clockSkew *clockskew.Monitor
 }
 
 // Run the agent
 // This method initializes the agent, including its plugins,
 // and then blocks on the main event loop.
 func (a *Agent) Run(ctx context.Context) error {
+	if a.c.FIPSMode {
+		fips.Enable()
+		a.c.Log.WithField(telemetry.BoringCrypto, fips.BuildEnabled()).Info("FIPS mode enabled")
+	}
+
 	a.c.Log.Infof("Starting agent with data directory: %q", a.c.DataDir)
 	if err := os.MkdirAll(a.c.DataDir, 0755); err != nil {
 		return err
@@ -61,6 +75,11 @@ func (a *Agent) Run(ctx context.Context) error {
 	telemetry.EmitVersion(metrics)
 	uptime.ReportMetrics(ctx, metrics)
 
+	if a.c.ClockSkewTolerance == 0 {
+		a.c.ClockSkewTolerance = clockskew.DefaultTolerance
+	}
+	a.clockSkew = clockskew.NewMonitor(a.c.Log.WithField(telemetry.SubsystemName, telemetry.ClockSkew), metrics, a.c.ClockSkewTolerance)
+
 	cat, err := catalog.Load(ctx, catalog.Config{
 		Log:          a.c.Log.WithField(telemetry.SubsystemName, telemetry.Catalog),
 		Metrics:      metrics,
@@ -72,6 +91,10 @@ func (a *Agent) Run(ctx context.Context) error {
 	}
 	defer cat.Close()
 
+	if err := a.c.WorkloadAttestation.Validate(cat.GetWorkloadAttestors()); err != nil {
+		return fmt.Errorf("invalid workload attestation policy: %w", err)
+	}
+
 	healthChecker := health.NewChecker(a.c.HealthChecks, a.c.Log)
 
 	as, err := a.attest(ctx, cat, metrics)
@@ -84,7 +107,12 @@ func (a *Agent) Run(ctx context.Context) error {
 		return err
 	}
 
-	endpoints := a.newEndpoints(cat, metrics, manager)
+	var workloadQuarantine *quarantine.Quarantine
+	if a.c.WorkloadQuarantine != nil {
+		workloadQuarantine = a.newWorkloadQuarantine()
+	}
+
+	endpoints := a.newEndpoints(cat, metrics, manager, workloadQuarantine)
 
 	if err := healthChecker.AddCheck("agent", a); err != nil {
 		return fmt.Errorf("failed adding healthcheck: %w", err)
@@ -95,6 +123,7 @@ func (a *Agent) Run(ctx context.Context) error {
 		endpoints.ListenAndServe,
 		metrics.ListenAndServe,
 		util.SerialRun(a.waitForTestDial, healthChecker.ListenAndServe),
+		util.SerialRun(a.waitForTestDial, systemd.NewNotifier(a.c.Log.WithField(telemetry.SubsystemName, "systemd"), a).Run),
 	}
 
 	if a.c.AdminBindAddress != nil {
@@ -102,6 +131,15 @@ func (a *Agent) Run(ctx context.Context) error {
 		tasks = append(tasks, adminEndpoints.ListenAndServe)
 	}
 
+	if a.c.CanaryProbe != nil {
+		canaryProbe := a.newCanaryProbe(metrics)
+		tasks = append(tasks, util.SerialRun(a.waitForTestDial, canaryProbe.Run))
+	}
+
+	if workloadQuarantine != nil {
+		tasks = append(tasks, workloadQuarantine.Run)
+	}
+
 	err = util.RunTasks(ctx, tasks...)
 	if errors.Is(err, context.Canceled) {
 		err = nil
@@ -177,6 +215,7 @@ func (a *Agent) attest(ctx context.Context, cat catalog.Catalog, metrics telemet
 		SVIDCachePath:     a.agentSVIDPath(),
 		Log:               a.c.Log.WithField(telemetry.SubsystemName, telemetry.Attestor),
 		ServerAddress:     a.c.ServerAddress,
+		ProxyURL:          a.c.ProxyURL,
 	}
 	return node_attestor.New(&config).Attest(ctx)
 }
@@ -189,11 +228,19 @@ func (a *Agent) newManager(ctx context.Context, cat catalog.Catalog, metrics tel
 		Catalog:         cat,
 		TrustDomain:     a.c.TrustDomain,
 		ServerAddr:      a.c.ServerAddress,
+		ProxyURL:        a.c.ProxyURL,
 		Log:             a.c.Log.WithField(telemetry.SubsystemName, telemetry.Manager),
 		Metrics:         metrics,
 		BundleCachePath: a.bundleCachePath(),
 		SVIDCachePath:   a.agentSVIDPath(),
 		SyncInterval:    a.c.SyncInterval,
+
+		SyncKickInterval:    a.c.SyncKickInterval,
+		X509AuthoritiesOnly: a.c.X509AuthoritiesOnly,
+		CompressSync:        a.c.CompressSync,
+		DeltaSync:           a.c.DeltaSync,
+		ClockSkew:           a.clockSkew,
+		Ephemeral:           a.c.Ephemeral,
 	}
 
 	mgr := manager.New(config)
@@ -204,15 +251,19 @@ func (a *Agent) newManager(ctx context.Context, cat catalog.Catalog, metrics tel
 	return mgr, nil
 }
 
-func (a *Agent) newEndpoints(cat catalog.Catalog, metrics telemetry.Metrics, mgr manager.Manager) endpoints.Server {
+func (a *Agent) newEndpoints(cat catalog.Catalog, metrics telemetry.Metrics, mgr manager.Manager, q *quarantine.Quarantine) endpoints.Server {
 	return endpoints.New(endpoints.Config{
-		BindAddr: a.c.BindAddress,
+		BindAddr:       a.c.BindAddress,
+		BundleBindAddr: a.c.BundleBindAddress,
+		VsockPort:      a.c.WorkloadAPIVsockPort,
 		Attestor: workload_attestor.New(&workload_attestor.Config{
 			Catalog: cat,
 			Log:     a.c.Log.WithField(telemetry.SubsystemName, telemetry.WorkloadAttestor),
 			Metrics: metrics,
+			Policy:  a.c.WorkloadAttestation,
 		}),
 		Manager:                       mgr,
+		Quarantine:                    q,
 		Log:                           a.c.Log.WithField(telemetry.SubsystemName, telemetry.Endpoints),
 		Metrics:                       metrics,
 		DefaultSVIDName:               a.c.DefaultSVIDName,
@@ -220,25 +271,52 @@ func (a *Agent) newEndpoints(cat catalog.Catalog, metrics telemetry.Metrics, mgr
 		AllowUnauthenticatedVerifiers: a.c.AllowUnauthenticatedVerifiers,
 		AllowedForeignJWTClaims:       a.c.AllowedForeignJWTClaims,
 		TrustDomain:                   a.c.TrustDomain,
+		ClockSkewTolerance:            a.c.ClockSkewTolerance,
 	})
 }
 
 func (a *Agent) newAdminEndpoints(mgr manager.Manager) admin_api.Server {
 	config := &admin_api.Config{
-		BindAddr:    a.c.AdminBindAddress,
-		Manager:     mgr,
-		Log:         a.c.Log.WithField(telemetry.SubsystemName, telemetry.DebugAPI),
-		TrustDomain: a.c.TrustDomain,
-		Uptime:      uptime.Uptime,
+		BindAddr:          a.c.AdminBindAddress,
+		ProfilingBindAddr: a.c.AdminProfilingBindAddress,
+		Manager:           mgr,
+		Log:               a.c.Log.WithField(telemetry.SubsystemName, telemetry.DebugAPI),
+		TrustDomain:       a.c.TrustDomain,
+		Uptime:            uptime.Uptime,
 	}
 
 	return admin_api.New(config)
 }
+
+func (a *Agent) newCanaryProbe(metrics telemetry.Metrics) *canary.Probe {
+	config := *a.c.CanaryProbe
+	config.SocketPath = a.c.BindAddress.String()
+	config.Log = a.c.Log.WithField(telemetry.SubsystemName, telemetry.CanaryProbe)
+	config.Metrics = metrics
+	return canary.New(config)
+}
+
+func (a *Agent) newWorkloadQuarantine() *quarantine.Quarantine {
+	config := *a.c.WorkloadQuarantine
+	config.Log = a.c.Log.WithField(telemetry.SubsystemName, telemetry.WorkloadQuarantine)
+	return quarantine.New(config)
+}
+
+// bundleCachePath returns the path the bundle is cached at, or an empty path
+// for ephemeral agents, which cache nothing on disk
 func (a *Agent) bundleCachePath() string {
+	if a.c.Ephemeral {
+		return ""
+	}
 	return path.Join(a.c.DataDir, "bundle.der")
 }
 
+// agentSVIDPath returns the path the agent SVID is cached at, or an empty
+// path for ephemeral agents, which cache nothing on disk
 func (a *Agent) agentSVIDPath() string {
+	if a.c.Ephemeral {
+		return ""
+	}
 	return path.Join(a.c.DataDir, "agent_svid.der")
 }
 
@@ -253,6 +331,7 @@ func (a *Agent) waitForTestDial(ctx context.Context) error {
 // CheckHealth is used as a top-level health check for the agent.
 func (a *Agent) CheckHealth() health.State {
 	err := a.checkWorkloadAPI()
+	clockSkewWarning := a.checkClockSkew()
 
 	// Both liveness and readiness checks are done by
 	// agents ability to create new Workload API client
@@ -262,14 +341,30 @@ func (a *Agent) CheckHealth() health.State {
 		Ready: err == nil,
 		Live:  err == nil,
 		ReadyDetails: agentHealthDetails{
-			WorkloadAPIErr: errString(err),
+			WorkloadAPIErr:   errString(err),
+			ClockSkewWarning: clockSkewWarning,
 		},
 		LiveDetails: agentHealthDetails{
-			WorkloadAPIErr: errString(err),
+			WorkloadAPIErr:   errString(err),
+			ClockSkewWarning: clockSkewWarning,
 		},
 	}
 }
 
+// checkClockSkew returns a warning if the skew last measured with the server
+// exceeds the tolerance. It does not fail the health checks since the agent
+// keeps serving the workloads, which may tolerate the skew.
+func (a *Agent) checkClockSkew() string {
+	if a.clockSkew == nil {
+		return ""
+	}
+	last, _, exceeded := a.clockSkew.Status()
+	if !exceeded {
+		return ""
+	}
+	return fmt.Sprintf("clock skew with the server of %s (±%s) exceeds the tolerance of %s", last.Offset, last.Uncertainty, a.c.ClockSkewTolerance)
+}
+
 func (a *Agent) checkWorkloadAPI() error {
 	client := api_workload.NewX509Client(&api_workload.X509ClientConfig{
 		Addr:        a.c.BindAddress,
@@ -294,7 +389,8 @@ func (a *Agent) checkWorkloadAPI() error {
 }
 
 type agentHealthDetails struct {
-	WorkloadAPIErr string `json:"make_new_x509_err,omitempty"`
+	WorkloadAPIErr   string `json:"make_new_x509_err,omitempty"`
+	ClockSkewWarning string `json:"clock_skew_warning,omitempty"`
 }
 
 func errString(err error) string {
@@ -13,6 +13,10 @@ import (
 type Config struct {
 	BindAddr *net.UnixAddr
 
+	// ProfilingBindAddr, if set, is the address to serve the runtime
+	// profiles on
+	ProfilingBindAddr *net.UnixAddr
+
 	Manager manager.Manager
 
 	Log logrus.FieldLogger
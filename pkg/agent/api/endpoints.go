@@ -10,6 +10,7 @@ import (
 	"github.com/spiffe/spire/pkg/agent/api/debug/v1"
 	"github.com/spiffe/spire/pkg/common/peertracker"
 	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/common/util"
 
 	"google.golang.org/grpc"
 )
@@ -24,6 +25,13 @@ type Endpoints struct {
 }
 
 func (e *Endpoints) ListenAndServe(ctx context.Context) error {
+	if e.c.ProfilingBindAddr == nil {
+		return e.serveDebugAPI(ctx)
+	}
+	return util.RunTasks(ctx, e.serveDebugAPI, e.serveProfiling)
+}
+
+func (e *Endpoints) serveDebugAPI(ctx context.Context) error {
 	server := grpc.NewServer(
 		grpc.Creds(peertracker.NewCredentials()),
 	)
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spiffe/spire/pkg/common/profiling"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+)
+
+// serveProfiling serves the runtime profiles over HTTP on a socket next to
+// the admin socket. The socket permissions restrict them to the same callers
+// as the debug API.
+func (e *Endpoints) serveProfiling(ctx context.Context) error {
+	// Remove uds if already exists
+	os.Remove(e.c.ProfilingBindAddr.String())
+
+	l, err := net.ListenUnix(e.c.ProfilingBindAddr.Network(), e.c.ProfilingBindAddr)
+	if err != nil {
+		return fmt.Errorf("create profiling UDS listener: %w", err)
+	}
+	if err := os.Chmod(e.c.ProfilingBindAddr.String(), 0770); err != nil {
+		l.Close()
+		return fmt.Errorf("unable to change profiling UDS permissions: %w", err)
+	}
+
+	server := &http.Server{
+		Handler: profiling.Handler(),
+	}
+
+	e.c.Log.WithField(telemetry.Path, e.c.ProfilingBindAddr.String()).Info("Serving runtime profiles")
+	errChan := make(chan error, 1)
+	go func() { errChan <- server.Serve(l) }()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+		if err := <-errChan; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -17,6 +18,7 @@ import (
 	"github.com/spiffe/spire/pkg/agent/plugin/nodeattestor"
 	"github.com/spiffe/spire/pkg/common/bundleutil"
 	"github.com/spiffe/spire/pkg/common/cryptoutil"
+	"github.com/spiffe/spire/pkg/common/fips"
 	"github.com/spiffe/spire/pkg/common/idutil"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	telemetry_agent "github.com/spiffe/spire/pkg/common/telemetry/agent"
@@ -49,6 +51,7 @@ type Config struct {
 	SVIDCachePath     string
 	Log               logrus.FieldLogger
 	ServerAddress     string
+	ProxyURL          *url.URL
 }
 
 type attestor struct {
@@ -144,7 +147,13 @@ func IsSVIDExpired(svid []*x509.Certificate, timeNow func() time.Time) bool {
 }
 
 func (a *attestor) loadBundle() (*bundleutil.Bundle, error) {
-	bundle, err := manager.ReadBundle(a.c.BundleCachePath)
+	// The bundle is not cached on disk if there is no cache path, e.g. for
+	// ephemeral agents
+	var bundle []*x509.Certificate
+	err := manager.ErrNotCached
+	if a.c.BundleCachePath != "" {
+		bundle, err = manager.ReadBundle(a.c.BundleCachePath)
+	}
 	if errors.Is(err, manager.ErrNotCached) {
 		if a.c.InsecureBootstrap {
 			if len(a.c.TrustBundle) > 0 {
@@ -171,6 +180,11 @@ func (a *attestor) loadBundle() (*bundleutil.Bundle, error) {
 // Read agent SVID from data dir. If an error is encountered, it will be logged and `nil`
 // will be returned.
 func (a *attestor) readSVIDFromDisk() []*x509.Certificate {
+	if a.c.SVIDCachePath == "" {
+		a.c.Log.Debug("Agent SVID is not cached on disk. Will perform node attestation")
+		return nil
+	}
+
 	log := a.c.Log.WithField(telemetry.Path, a.c.SVIDCachePath)
 
 	svid, err := manager.ReadSVID(a.c.SVIDCachePath)
@@ -230,6 +244,7 @@ func (a *attestor) serverConn(ctx context.Context, bundle *bundleutil.Bundle) (*
 			Address:     a.c.ServerAddress,
 			TrustDomain: a.c.TrustDomain,
 			GetBundle:   bundle.RootCAs,
+			ProxyURL:    a.c.ProxyURL,
 		})
 	}
 
@@ -265,12 +280,16 @@ func (a *attestor) serverConn(ctx context.Context, bundle *bundleutil.Bundle) (*
 		},
 	}
 
-	return grpc.DialContext(ctx, a.c.ServerAddress,
+	opts := []grpc.DialOption{
 		// TODO: port to non-deprecated option
 		grpc.WithBalancerName(roundrobin.Name), //nolint:staticcheck // not ready to port
 		grpc.FailOnNonTempDialError(true),
-		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
-	)
+		grpc.WithTransportCredentials(credentials.NewTLS(fips.ConfigureTLS(tlsConfig))),
+	}
+	if a.c.ProxyURL != nil {
+		opts = append(opts, client.WithProxy(a.c.ProxyURL))
+	}
+	return grpc.DialContext(ctx, a.c.ServerAddress, opts...)
 }
 
 func findKeyForSVID(keys []keymanager.Key, svid []*x509.Certificate) (keymanager.Key, bool) {
@@ -29,52 +29,163 @@ func newAttestor(config *Config) *attestor {
 	return &attestor{c: config}
 }
 
+// AttestorSelectorType is the type of the selectors added for the workload
+// attestors whose selectors were kept, when Policy.AttestorSelectors is set
+const AttestorSelectorType = "workload_attestor"
+
 type Config struct {
 	Catalog catalog.Catalog
 	Log     logrus.FieldLogger
 	Metrics telemetry.Metrics
+	Policy  Policy
+}
+
+// Policy controls how the selectors of the workload attestor plugins are
+// combined. The zero value unions the selectors of all the plugins.
+type Policy struct {
+	// Required are the names of the plugins that must all attest the workload
+	// with at least one selector. Otherwise the workload gets no selectors.
+	Required []string
+
+	// Fallback are the names of the plugins invoked one after the other, in
+	// order, until one attests the workload with at least one selector. Only
+	// the selectors of that plugin are kept.
+	Fallback []string
+
+	// AttestorSelectors, if true, adds a selector of type
+	// AttestorSelectorType for each plugin whose selectors were kept, so that
+	// registration entries can require the workload to be attested by given
+	// plugins.
+	AttestorSelectors bool
+}
+
+// Validate returns an error if the policy is inconsistent or refers to
+// plugins that are not among the given workload attestors.
+func (p Policy) Validate(plugins []workloadattestor.WorkloadAttestor) error {
+	loaded := make(map[string]bool, len(plugins))
+	for _, plugin := range plugins {
+		loaded[plugin.Name()] = true
+	}
+
+	seen := make(map[string]bool)
+	check := func(field string, names []string) error {
+		for _, name := range names {
+			if seen[name] {
+				return fmt.Errorf("workload attestor %q is listed more than once in required and fallback", name)
+			}
+			seen[name] = true
+			if !loaded[name] {
+				return fmt.Errorf("%s workload attestor %q is not configured", field, name)
+			}
+		}
+		return nil
+	}
+	if err := check("required", p.Required); err != nil {
+		return err
+	}
+	return check("fallback", p.Fallback)
+}
+
+type attestorResult struct {
+	name      string
+	selectors []*common.Selector
+	err       error
 }
 
-// Attest invokes all workload attestor plugins against the provided PID. If an error
-// is encountered, it is logged and selectors from the failing plugin are discarded.
+// Attest invokes the workload attestor plugins against the provided PID,
+// according to the policy. The plugins that are neither required nor
+// fallback are invoked concurrently, alongside the required ones. If an error
+// is encountered, it is logged and selectors from the failing plugin are
+// discarded.
 func (wla *attestor) Attest(ctx context.Context, pid int) []*common.Selector {
 	counter := telemetry_workload.StartAttestationCall(wla.c.Metrics)
 	defer counter.Done(nil)
 
 	log := wla.c.Log.WithField(telemetry.PID, pid)
 
-	plugins := wla.c.Catalog.GetWorkloadAttestors()
-	sChan := make(chan []*common.Selector)
-	errChan := make(chan error)
+	selectors := wla.attest(ctx, log, pid)
 
-	for _, p := range plugins {
+	telemetry_workload.AddDiscoveredSelectorsSample(wla.c.Metrics, float32(len(selectors)))
+	// The agent health check currently exercises the Workload API. Since this
+	// can happen with some frequency, it has a tendency to fill up logs with
+	// hard-to-filter details if we're not careful (e.g. issue #1537). Only log
+	// if it is not the agent itself.
+	if pid != os.Getpid() {
+		log.WithField(telemetry.Selectors, selectors).Debug("PID attested to have selectors")
+	}
+	return selectors
+}
+
+func (wla *attestor) attest(ctx context.Context, log logrus.FieldLogger, pid int) []*common.Selector {
+	policy := wla.c.Policy
+	isFallback := make(map[string]bool, len(policy.Fallback))
+	for _, name := range policy.Fallback {
+		isFallback[name] = true
+	}
+
+	var concurrent []workloadattestor.WorkloadAttestor
+	fallback := make(map[string]workloadattestor.WorkloadAttestor, len(policy.Fallback))
+	for _, p := range wla.c.Catalog.GetWorkloadAttestors() {
+		if isFallback[p.Name()] {
+			fallback[p.Name()] = p
+		} else {
+			concurrent = append(concurrent, p)
+		}
+	}
+
+	resultChan := make(chan attestorResult)
+	for _, p := range concurrent {
 		go func(p workloadattestor.WorkloadAttestor) {
-			if selectors, err := wla.invokeAttestor(ctx, p, pid); err == nil {
-				sChan <- selectors
-			} else {
-				errChan <- err
-			}
+			selectors, err := wla.invokeAttestor(ctx, p, pid)
+			resultChan <- attestorResult{name: p.Name(), selectors: selectors, err: err}
 		}(p)
 	}
 
 	// Collect the results
 	selectors := []*common.Selector{}
-	for i := 0; i < len(plugins); i++ {
-		select {
-		case s := <-sChan:
+	attested := make(map[string]bool, len(concurrent))
+	for i := 0; i < len(concurrent); i++ {
+		result := <-resultChan
+		if result.err != nil {
+			log.WithError(result.err).Error("Failed to collect all selectors for PID")
+			continue
+		}
+		selectors = append(selectors, result.selectors...)
+		if len(result.selectors) > 0 {
+			attested[result.name] = true
+		}
+	}
+
+	for _, name := range policy.Required {
+		if !attested[name] {
+			log.WithField(telemetry.Attestor, name).Error("Required workload attestor did not attest the PID; discarding all selectors")
+			return []*common.Selector{}
+		}
+	}
+
+	for _, name := range policy.Fallback {
+		p, ok := fallback[name]
+		if !ok {
+			continue
+		}
+		s, err := wla.invokeAttestor(ctx, p, pid)
+		if err != nil {
+			log.WithError(err).Warn("Fallback workload attestor failed; trying the next one")
+			continue
+		}
+		if len(s) > 0 {
 			selectors = append(selectors, s...)
-		case err := <-errChan:
-			log.WithError(err).Error("Failed to collect all selectors for PID")
+			attested[name] = true
+			break
 		}
 	}
 
-	telemetry_workload.AddDiscoveredSelectorsSample(wla.c.Metrics, float32(len(selectors)))
-	// The agent health check currently exercises the Workload API. Since this
-	// can happen with some frequency, it has a tendency to fill up logs with
-	// hard-to-filter details if we're not careful (e.g. issue #1537). Only log
-	// if it is not the agent itself.
-	if pid != os.Getpid() {
-		log.WithField(telemetry.Selectors, selectors).Debug("PID attested to have selectors")
+	if policy.AttestorSelectors {
+		for _, p := range wla.c.Catalog.GetWorkloadAttestors() {
+			if attested[p.Name()] {
+				selectors = append(selectors, &common.Selector{Type: AttestorSelectorType, Value: p.Name()})
+			}
+		}
 	}
 	return selectors
 }
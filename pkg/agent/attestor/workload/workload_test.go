@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/spire/pkg/agent/plugin/workloadattestor"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	telemetry_workload "github.com/spiffe/spire/pkg/common/telemetry/agent/workloadapi"
 	"github.com/spiffe/spire/pkg/common/util"
@@ -35,6 +36,13 @@ var (
 		3: selectors2,
 		4: selectors2,
 	}
+	selectors3    = []*common.Selector{{Type: "qux", Value: "quux"}}
+	attestor3Pids = map[int32][]*common.Selector{
+		1: selectors3,
+		2: selectors3,
+		3: selectors3,
+		4: selectors3,
+	}
 )
 
 func TestWorkloadAttestor(t *testing.T) {
@@ -85,6 +93,107 @@ func (s *WorkloadAttestorTestSuite) TestAttestWorkload() {
 	spiretest.AssertProtoListEqual(s.T(), combined, selectors)
 }
 
+func (s *WorkloadAttestorTestSuite) TestAttestWorkloadWithRequiredAttestors() {
+	s.catalog.SetWorkloadAttestors(
+		fakeworkloadattestor.New(s.T(), "fake1", attestor1Pids),
+		fakeworkloadattestor.New(s.T(), "fake2", attestor2Pids),
+	)
+	s.attestor.c.Policy = Policy{Required: []string{"fake1"}}
+
+	// fake1 succeeds but with no selectors
+	s.Empty(s.attestor.Attest(ctx, 1))
+
+	// fake1 has selectors, but not fake2
+	spiretest.AssertProtoListEqual(s.T(), selectors1, s.attestor.Attest(ctx, 2))
+
+	// fake1 fails, so the selectors of fake2 are discarded
+	s.Empty(s.attestor.Attest(ctx, 3))
+
+	// both have selectors
+	s.attestor.c.Policy = Policy{Required: []string{"fake1", "fake2"}}
+	selectors := s.attestor.Attest(ctx, 4)
+	util.SortSelectors(selectors)
+	combined := append(selectors1, selectors2...)
+	util.SortSelectors(combined)
+	spiretest.AssertProtoListEqual(s.T(), combined, selectors)
+}
+
+func (s *WorkloadAttestorTestSuite) TestAttestWorkloadWithFallbackAttestors() {
+	s.catalog.SetWorkloadAttestors(
+		fakeworkloadattestor.New(s.T(), "fake1", attestor1Pids),
+		fakeworkloadattestor.New(s.T(), "fake2", attestor2Pids),
+		fakeworkloadattestor.New(s.T(), "fake3", attestor3Pids),
+	)
+	s.attestor.c.Policy = Policy{Fallback: []string{"fake1", "fake2"}}
+
+	// fake3 is not a fallback, so it always contributes; neither fallback
+	// has selectors
+	spiretest.AssertProtoListEqual(s.T(), selectors3, s.attestor.Attest(ctx, 1))
+
+	// fake1 has selectors, fake2 is skipped
+	selectors := s.attestor.Attest(ctx, 4)
+	util.SortSelectors(selectors)
+	combined := append(selectors1, selectors3...)
+	util.SortSelectors(combined)
+	spiretest.AssertProtoListEqual(s.T(), combined, selectors)
+
+	// fake1 fails, fake2 has selectors
+	selectors = s.attestor.Attest(ctx, 3)
+	util.SortSelectors(selectors)
+	combined = append(selectors2, selectors3...)
+	util.SortSelectors(combined)
+	spiretest.AssertProtoListEqual(s.T(), combined, selectors)
+}
+
+func (s *WorkloadAttestorTestSuite) TestAttestWorkloadWithAttestorSelectors() {
+	s.catalog.SetWorkloadAttestors(
+		fakeworkloadattestor.New(s.T(), "fake1", attestor1Pids),
+		fakeworkloadattestor.New(s.T(), "fake2", attestor2Pids),
+	)
+	s.attestor.c.Policy = Policy{AttestorSelectors: true}
+
+	// no attestor has selectors
+	s.Empty(s.attestor.Attest(ctx, 1))
+
+	// only fake2 has selectors
+	selectors := s.attestor.Attest(ctx, 3)
+	util.SortSelectors(selectors)
+	expected := []*common.Selector{
+		{Type: "bat", Value: "baz"},
+		{Type: AttestorSelectorType, Value: "fake2"},
+	}
+	util.SortSelectors(expected)
+	spiretest.AssertProtoListEqual(s.T(), expected, selectors)
+
+	// both have selectors
+	selectors = s.attestor.Attest(ctx, 4)
+	util.SortSelectors(selectors)
+	expected = []*common.Selector{
+		{Type: "bat", Value: "baz"},
+		{Type: "foo", Value: "bar"},
+		{Type: AttestorSelectorType, Value: "fake1"},
+		{Type: AttestorSelectorType, Value: "fake2"},
+	}
+	util.SortSelectors(expected)
+	spiretest.AssertProtoListEqual(s.T(), expected, selectors)
+}
+
+func (s *WorkloadAttestorTestSuite) TestValidatePolicy() {
+	plugins := []workloadattestor.WorkloadAttestor{
+		fakeworkloadattestor.New(s.T(), "fake1", attestor1Pids),
+		fakeworkloadattestor.New(s.T(), "fake2", attestor2Pids),
+	}
+
+	s.NoError(Policy{}.Validate(plugins))
+	s.NoError(Policy{Required: []string{"fake1"}, Fallback: []string{"fake2"}}.Validate(plugins))
+	s.EqualError(Policy{Required: []string{"fake3"}}.Validate(plugins),
+		`required workload attestor "fake3" is not configured`)
+	s.EqualError(Policy{Fallback: []string{"fake2", "fake3"}}.Validate(plugins),
+		`fallback workload attestor "fake3" is not configured`)
+	s.EqualError(Policy{Required: []string{"fake1"}, Fallback: []string{"fake1"}}.Validate(plugins),
+		`workload attestor "fake1" is listed more than once in required and fallback`)
+}
+
 func (s *WorkloadAttestorTestSuite) TestAttestWorkloadMetrics() {
 	// Add only one attestor
 	s.catalog.SetWorkloadAttestors(
@@ -0,0 +1,138 @@
+package canary
+
+import (
+	"context"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	telemetry_agent "github.com/spiffe/spire/pkg/common/telemetry/agent"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultInterval is how often the canary identity is probed if not
+	// overridden by the config
+	DefaultInterval = time.Minute
+
+	// DefaultTimeout is the timeout of each probe if not overridden by the
+	// config
+	DefaultTimeout = 10 * time.Second
+)
+
+// Config is the config of the probe
+type Config struct {
+	// SPIFFEID is the canary identity the probe expects to be issued
+	SPIFFEID spiffeid.ID
+
+	// SocketPath is the path of the Workload API socket of the agent
+	SocketPath string
+
+	// Interval is how often the canary identity is probed
+	Interval time.Duration
+
+	// Timeout is the timeout of each probe
+	Timeout time.Duration
+
+	Log     logrus.FieldLogger
+	Metrics telemetry.Metrics
+	Clock   clock.Clock
+
+	// test hooks
+	fetchX509SVIDs func(ctx context.Context) ([]*x509svid.SVID, error)
+}
+
+// Probe continuously fetches the canary identity from the Workload API of the
+// agent, the way a workload would. The canary identity is registered by the
+// operator for the agent process itself, so a successful probe proves that
+// entries are synced from the server, that SVIDs are minted for them and
+// that the Workload API serves them, giving an end-to-end indicator of the
+// health of the identity plane. The outcome and latency of each probe are
+// reported as metrics.
+type Probe struct {
+	c Config
+}
+
+// New creates a new probe
+func New(config Config) *Probe {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.Clock == nil {
+		config.Clock = clock.New()
+	}
+	if config.fetchX509SVIDs == nil {
+		addr := "unix://" + config.SocketPath
+		config.fetchX509SVIDs = func(ctx context.Context) ([]*x509svid.SVID, error) {
+			return workloadapi.FetchX509SVIDs(ctx, workloadapi.WithAddr(addr))
+		}
+	}
+	return &Probe{
+		c: config,
+	}
+}
+
+// Run probes the canary identity until the context is done
+func (p *Probe) Run(ctx context.Context) error {
+	p.c.Log.WithFields(logrus.Fields{
+		telemetry.SPIFFEID: p.c.SPIFFEID.String(),
+		"interval":         p.c.Interval,
+	}).Info("Starting canary identity probe")
+
+	ticker := p.c.Clock.Ticker(p.c.Interval)
+	defer ticker.Stop()
+
+	healthy := true
+	for {
+		err := p.probe(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			p.c.Log.WithError(err).WithField(telemetry.SPIFFEID, p.c.SPIFFEID.String()).Warn("Canary identity probe failed")
+			healthy = false
+		case !healthy:
+			p.c.Log.WithField(telemetry.SPIFFEID, p.c.SPIFFEID.String()).Info("Canary identity probe recovered")
+			healthy = true
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (p *Probe) probe(ctx context.Context) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, p.c.Timeout)
+	defer cancel()
+
+	call := telemetry_agent.StartCanaryProbeCall(p.c.Metrics)
+	defer call.Done(&err)
+
+	svids, err := p.c.fetchX509SVIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := p.c.Clock.Now()
+	for _, svid := range svids {
+		if svid.ID != p.c.SPIFFEID {
+			continue
+		}
+		if len(svid.Certificates) == 0 || now.After(svid.Certificates[0].NotAfter) {
+			return status.Errorf(codes.FailedPrecondition, "canary identity %q was served expired", p.c.SPIFFEID)
+		}
+		return nil
+	}
+	return status.Errorf(codes.NotFound, "canary identity %q was not served by the Workload API", p.c.SPIFFEID)
+}
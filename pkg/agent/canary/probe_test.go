@@ -0,0 +1,155 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	telemetry_agent "github.com/spiffe/spire/pkg/common/telemetry/agent"
+	"github.com/spiffe/spire/test/clock"
+	"github.com/spiffe/spire/test/fakes/fakemetrics"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/spiffe/spire/test/testca"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	td       = spiffeid.RequireTrustDomainFromString("example.org")
+	canaryID = spiffeid.Must("example.org", "canary")
+	otherID  = spiffeid.Must("example.org", "other")
+)
+
+func TestProbe(t *testing.T) {
+	ca := testca.New(t, td)
+	clk := clock.NewMock(t)
+	clk.Set(time.Now())
+
+	for _, tt := range []struct {
+		name       string
+		svids      []*x509svid.SVID
+		fetchErr   error
+		expectCode codes.Code
+		expectMsg  string
+	}{
+		{
+			name:       "canary identity served",
+			svids:      []*x509svid.SVID{ca.CreateX509SVID(otherID), ca.CreateX509SVID(canaryID)},
+			expectCode: codes.OK,
+		},
+		{
+			name:       "canary identity not served",
+			svids:      []*x509svid.SVID{ca.CreateX509SVID(otherID)},
+			expectCode: codes.NotFound,
+			expectMsg:  `canary identity "spiffe://example.org/canary" was not served by the Workload API`,
+		},
+		{
+			name: "canary identity served expired",
+			svids: []*x509svid.SVID{ca.CreateX509SVID(canaryID,
+				testca.WithLifetime(clk.Now().Add(-2*time.Hour), clk.Now().Add(-time.Hour)))},
+			expectCode: codes.FailedPrecondition,
+			expectMsg:  `canary identity "spiffe://example.org/canary" was served expired`,
+		},
+		{
+			name:       "no identity for the agent",
+			fetchErr:   status.Error(codes.PermissionDenied, "no identity issued"),
+			expectCode: codes.PermissionDenied,
+			expectMsg:  "no identity issued",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			log, _ := test.NewNullLogger()
+			metrics := fakemetrics.New()
+			probe := New(Config{
+				SPIFFEID: canaryID,
+				Log:      log,
+				Metrics:  metrics,
+				Clock:    clk,
+				fetchX509SVIDs: func(ctx context.Context) ([]*x509svid.SVID, error) {
+					return tt.svids, tt.fetchErr
+				},
+			})
+
+			err := probe.probe(context.Background())
+			spiretest.RequireGRPCStatus(t, err, tt.expectCode, tt.expectMsg)
+
+			expectedMetrics := fakemetrics.New()
+			telemetry_agent.StartCanaryProbeCall(expectedMetrics).Done(&err)
+			require.Equal(t, expectedMetrics.AllMetrics(), metrics.AllMetrics())
+		})
+	}
+}
+
+func TestRunLogsFailuresAndRecovery(t *testing.T) {
+	ca := testca.New(t, td)
+	log, logHook := test.NewNullLogger()
+	clk := clock.NewMock(t)
+	clk.Set(time.Now())
+
+	results := make(chan error, 1)
+	results <- errors.New("ohno")
+	probe := New(Config{
+		SPIFFEID: canaryID,
+		Interval: time.Minute,
+		Log:      log,
+		Metrics:  fakemetrics.New(),
+		Clock:    clk,
+		fetchX509SVIDs: func(ctx context.Context) ([]*x509svid.SVID, error) {
+			if err := <-results; err != nil {
+				return nil, err
+			}
+			return []*x509svid.SVID{ca.CreateX509SVID(canaryID)}, nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, probe.Run(ctx))
+	}()
+
+	clk.WaitForTicker(time.Minute, "probe did not wait for the next interval")
+	results <- nil
+	clk.Add(time.Minute)
+	require.Eventually(t, func() bool {
+		return len(logHook.AllEntries()) == 3
+	}, time.Minute, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	spiretest.AssertLogs(t, logHook.AllEntries(), []spiretest.LogEntry{
+		{
+			Level:   logrus.InfoLevel,
+			Message: "Starting canary identity probe",
+			Data: logrus.Fields{
+				"spiffe_id": canaryID.String(),
+				"interval":  "1m0s",
+			},
+		},
+		{
+			Level:   logrus.WarnLevel,
+			Message: "Canary identity probe failed",
+			Data: logrus.Fields{
+				"spiffe_id":     canaryID.String(),
+				logrus.ErrorKey: "ohno",
+			},
+		},
+		{
+			Level:   logrus.InfoLevel,
+			Message: "Canary identity probe recovered",
+			Data: logrus.Fields{
+				"spiffe_id": canaryID.String(),
+			},
+		},
+	})
+}
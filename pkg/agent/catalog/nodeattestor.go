@@ -4,6 +4,7 @@ import (
 	"github.com/spiffe/spire/pkg/agent/plugin/nodeattestor"
 	"github.com/spiffe/spire/pkg/agent/plugin/nodeattestor/aws"
 	"github.com/spiffe/spire/pkg/agent/plugin/nodeattestor/azure"
+	"github.com/spiffe/spire/pkg/agent/plugin/nodeattestor/confidentialvm"
 	"github.com/spiffe/spire/pkg/agent/plugin/nodeattestor/gcp"
 	"github.com/spiffe/spire/pkg/agent/plugin/nodeattestor/jointoken"
 	"github.com/spiffe/spire/pkg/agent/plugin/nodeattestor/k8s/psat"
@@ -40,6 +41,7 @@ func (repo *nodeAttestorRepository) BuiltIns() []catalog.BuiltIn {
 	return []catalog.BuiltIn{
 		aws.BuiltIn(),
 		azure.BuiltIn(),
+		confidentialvm.BuiltIn(),
 		gcp.BuiltIn(),
 		jointoken.BuiltIn(),
 		psat.BuiltIn(),
@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"net/url"
 	"sync"
 	"time"
 
@@ -18,15 +19,21 @@ import (
 	svidv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/svid/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"github.com/spiffe/spire/pkg/common/bundleutil"
+	"github.com/spiffe/spire/pkg/common/clockskew"
+	"github.com/spiffe/spire/pkg/common/syncdelta"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	"github.com/spiffe/spire/proto/spire/common"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
 var (
 	ErrUnableToGetStream = errors.New("unable to get a stream")
+
+	errDeltaMismatch = errors.New("entries rebuilt from the delta do not match the server token")
 )
 
 const rpcTimeout = 30 * time.Second
@@ -48,6 +55,10 @@ type Client interface {
 	NewX509SVIDs(ctx context.Context, csrs map[string][]byte) (map[string]*X509SVID, error)
 	NewJWTSVID(ctx context.Context, entryID string, audience []string) (*JWTSVID, error)
 
+	// DeleteAgent deletes the agent from the server. Agents can only delete
+	// themselves.
+	DeleteAgent(ctx context.Context, agentID spiffeid.ID) error
+
 	// Release releases any resources that were held by this Client, if any.
 	Release()
 }
@@ -63,6 +74,25 @@ type Config struct {
 
 	// RotMtx is used to prevent the creation of new connections during SVID rotations
 	RotMtx *sync.RWMutex
+
+	// ProxyURL is the optional URL of the proxy used to connect to Addr
+	ProxyURL *url.URL
+
+	// X509AuthoritiesOnly, if true, makes the client request only the X.509
+	// authorities of the bundles, reducing the size of the sync payloads.
+	X509AuthoritiesOnly bool
+
+	// CompressSync, if true, makes the client compress the entry and bundle
+	// sync payloads with gzip. The server must support it.
+	CompressSync bool
+
+	// DeltaSync, if true, makes the client ask the server only for the
+	// entries and bundles that changed since the last sync.
+	DeltaSync bool
+
+	// ClockSkew, if set, is given the skew of the clock of the server
+	// measured on each sync of the entries
+	ClockSkew *clockskew.Monitor
 }
 
 type client struct {
@@ -70,6 +100,14 @@ type client struct {
 	connections *nodeConn
 	m           sync.Mutex
 
+	// syncMtx protects the payloads last synced with delta encoding
+	syncMtx      sync.Mutex
+	entriesToken string
+	entries      map[string]*types.Entry
+	entryHashes  map[string]string
+	bundles      map[string]*types.Bundle
+	bundleHashes map[string]string
+
 	// Constructor used for testing purposes.
 	createNewEntryClient  func(grpc.ClientConnInterface) entryv1.EntryClient
 	createNewBundleClient func(grpc.ClientConnInterface) bundlev1.BundleClient
@@ -268,6 +306,30 @@ func (c *client) NewJWTSVID(ctx context.Context, entryID string, audience []stri
 	}, nil
 }
 
+func (c *client) DeleteAgent(ctx context.Context, agentID spiffeid.ID) error {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+
+	agentClient, connection, err := c.newAgentClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer connection.Release()
+
+	_, err = agentClient.DeleteAgent(ctx, &agentv1.DeleteAgentRequest{
+		Id: &types.SPIFFEID{
+			TrustDomain: agentID.TrustDomain().String(),
+			Path:        agentID.Path(),
+		},
+	})
+	if err != nil {
+		c.release(connection)
+		c.c.Log.WithError(err).Error("Failed to delete agent")
+		return fmt.Errorf("failed to delete agent: %w", err)
+	}
+	return nil
+}
+
 // Release the underlying connection.
 func (c *client) Release() {
 	c.release(nil)
@@ -286,6 +348,7 @@ func (c *client) dial(ctx context.Context) (*grpc.ClientConn, error) {
 	return DialServer(ctx, DialServerConfig{
 		Address:     c.c.Addr,
 		TrustDomain: c.c.TrustDomain,
+		ProxyURL:    c.c.ProxyURL,
 		GetBundle: func() []*x509.Certificate {
 			_, _, bundle := c.c.KeysAndBundle()
 			return bundle
@@ -311,14 +374,167 @@ func (c *client) fetchEntries(ctx context.Context) ([]*types.Entry, error) {
 	}
 	defer connection.Release()
 
-	resp, err := entryClient.GetAuthorizedEntries(ctx, &entryv1.GetAuthorizedEntriesRequest{})
+	c.syncMtx.Lock()
+	defer c.syncMtx.Unlock()
+
+	entries, err := c.getAuthorizedEntries(ctx, entryClient)
+	if errors.Is(err, errDeltaMismatch) {
+		c.c.Log.Warn("Entries rebuilt from the delta sent by the server do not match; fetching all the entries")
+		c.resetEntries()
+		entries, err = c.getAuthorizedEntries(ctx, entryClient)
+	}
 	if err != nil {
 		c.release(connection)
 		c.c.Log.WithError(err).Error("Failed to fetch authorized entries")
 		return nil, fmt.Errorf("failed to fetch authorized entries: %w", err)
 	}
 
-	return resp.Entries, err
+	return entries, nil
+}
+
+// getAuthorizedEntries fetches the authorized entries. With delta encoding,
+// the entries held are updated with the delta sent by the server and checked
+// against the token of the server.
+func (c *client) getAuthorizedEntries(ctx context.Context, entryClient entryv1.EntryClient) ([]*types.Entry, error) {
+	callOpts := c.syncCallOptions()
+	if !c.c.DeltaSync {
+		resp, err := c.callGetAuthorizedEntries(ctx, entryClient, callOpts)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Entries, nil
+	}
+
+	var trailer metadata.MD
+	ctx = metadata.AppendToOutgoingContext(ctx, syncdelta.EntriesTokenKey, c.entriesToken)
+	resp, err := c.callGetAuthorizedEntries(ctx, entryClient, append(callOpts, grpc.Trailer(&trailer)))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*types.Entry)
+	hashes := make(map[string]string)
+	mode := firstValue(trailer, syncdelta.EntriesModeKey)
+	switch mode {
+	case syncdelta.ModeDelta:
+		for id, entry := range c.entries {
+			entries[id] = entry
+			hashes[id] = c.entryHashes[id]
+		}
+		for _, id := range trailer.Get(syncdelta.RemovedEntriesKey) {
+			delete(entries, id)
+			delete(hashes, id)
+		}
+	case syncdelta.ModeFull:
+	default:
+		// The server does not support delta encoding
+		c.resetEntries()
+		return resp.Entries, nil
+	}
+	for _, entry := range resp.Entries {
+		hash, err := syncdelta.EntryHash(entry)
+		if err != nil {
+			return nil, err
+		}
+		entries[entry.Id] = entry
+		hashes[entry.Id] = hash
+	}
+
+	token := syncdelta.Token(hashes)
+	if token != firstValue(trailer, syncdelta.EntriesTokenKey) {
+		if mode == syncdelta.ModeDelta {
+			return nil, errDeltaMismatch
+		}
+		// The entries can't be hashed the way the server does, e.g. since it
+		// runs another version, so the next sync asks for all the entries
+		c.resetEntries()
+		return resp.Entries, nil
+	}
+	c.entriesToken = token
+	c.entries = entries
+	c.entryHashes = hashes
+
+	protoEntries := make([]*types.Entry, 0, len(entries))
+	for _, entry := range entries {
+		protoEntries = append(protoEntries, entry)
+	}
+	return protoEntries, nil
+}
+
+// callGetAuthorizedEntries calls GetAuthorizedEntries, measuring the skew of
+// the clock of the server along the way
+func (c *client) callGetAuthorizedEntries(ctx context.Context, entryClient entryv1.EntryClient, callOpts []grpc.CallOption) (*entryv1.GetAuthorizedEntriesResponse, error) {
+	var header metadata.MD
+	sent := time.Now()
+	resp, err := entryClient.GetAuthorizedEntries(ctx, &entryv1.GetAuthorizedEntriesRequest{}, append(callOpts, grpc.Header(&header))...)
+	if err != nil {
+		return nil, err
+	}
+	if c.c.ClockSkew != nil {
+		if serverTime, ok := clockskew.ServerTime(header); ok {
+			c.c.ClockSkew.Observe(clockskew.Measure(serverTime, sent, time.Now()))
+		}
+	}
+	return resp, nil
+}
+
+func (c *client) resetEntries() {
+	c.entriesToken = ""
+	c.entries = nil
+	c.entryHashes = nil
+}
+
+// getBundle fetches the bundle of the trust domain with the get function.
+// With delta encoding, the bundle held is returned if it is unchanged.
+func (c *client) getBundle(ctx context.Context, td string, get func(context.Context, ...grpc.CallOption) (*types.Bundle, error)) (*types.Bundle, error) {
+	callOpts := c.syncCallOptions()
+	if !c.c.DeltaSync {
+		return get(ctx, callOpts...)
+	}
+
+	c.syncMtx.Lock()
+	defer c.syncMtx.Unlock()
+
+	held := c.bundles[td]
+	if held != nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, syncdelta.BundleHashKey, c.bundleHashes[td])
+	}
+	var trailer metadata.MD
+	bundle, err := get(ctx, append(callOpts, grpc.Trailer(&trailer))...)
+	if err != nil {
+		return nil, err
+	}
+	if held != nil && firstValue(trailer, syncdelta.BundleUnchangedKey) == "true" {
+		return held, nil
+	}
+
+	hash, err := syncdelta.BundleHash(bundle)
+	if err != nil {
+		return nil, err
+	}
+	if c.bundles == nil {
+		c.bundles = make(map[string]*types.Bundle)
+		c.bundleHashes = make(map[string]string)
+	}
+	c.bundles[td] = bundle
+	c.bundleHashes[td] = hash
+	return bundle, nil
+}
+
+// syncCallOptions returns the call options of the entry and bundle sync
+// requests
+func (c *client) syncCallOptions() []grpc.CallOption {
+	if !c.c.CompressSync {
+		return nil
+	}
+	return []grpc.CallOption{grpc.UseCompressor(gzip.Name)}
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
 }
 
 func (c *client) fetchBundles(ctx context.Context, federatedBundles []string) ([]*types.Bundle, error) {
@@ -331,7 +547,11 @@ func (c *client) fetchBundles(ctx context.Context, federatedBundles []string) ([
 	var bundles []*types.Bundle
 
 	// Get bundle
-	bundle, err := bundleClient.GetBundle(ctx, &bundlev1.GetBundleRequest{})
+	bundle, err := c.getBundle(ctx, c.c.TrustDomain.String(), func(ctx context.Context, opts ...grpc.CallOption) (*types.Bundle, error) {
+		return bundleClient.GetBundle(ctx, &bundlev1.GetBundleRequest{
+			OutputMask: c.bundleMask(),
+		}, opts...)
+	})
 	if err != nil {
 		c.release(connection)
 		c.c.Log.WithError(err).Error("Failed to fetch bundle")
@@ -344,8 +564,11 @@ func (c *client) fetchBundles(ctx context.Context, federatedBundles []string) ([
 		if err != nil {
 			return nil, err
 		}
-		bundle, err := bundleClient.GetFederatedBundle(ctx, &bundlev1.GetFederatedBundleRequest{
-			TrustDomain: federatedTD.String(),
+		bundle, err := c.getBundle(ctx, federatedTD.String(), func(ctx context.Context, opts ...grpc.CallOption) (*types.Bundle, error) {
+			return bundleClient.GetFederatedBundle(ctx, &bundlev1.GetFederatedBundleRequest{
+				TrustDomain: federatedTD.String(),
+				OutputMask:  c.bundleMask(),
+			}, opts...)
 		})
 		switch status.Code(err) {
 		case codes.OK:
@@ -361,6 +584,17 @@ func (c *client) fetchBundles(ctx context.Context, federatedBundles []string) ([
 	return bundles, nil
 }
 
+// bundleMask returns the output mask of the bundle requests. Nil means the
+// whole bundle.
+func (c *client) bundleMask() *types.BundleMask {
+	if !c.c.X509AuthoritiesOnly {
+		return nil
+	}
+	return &types.BundleMask{
+		X509Authorities: true,
+	}
+}
+
 func (c *client) fetchSVIDs(ctx context.Context, params []*svidv1.NewX509SVIDParams) ([]*types.X509SVID, error) {
 	svidClient, connection, err := c.newSVIDClient(ctx)
 	if err != nil {
@@ -16,11 +16,16 @@ import (
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	svidv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/svid/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/syncdelta"
 	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/spiffe/spire/test/clock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 var (
@@ -187,6 +192,159 @@ func TestFetchUpdates(t *testing.T) {
 		assert.Equal(t, entry, update.Entries[entry.EntryId])
 	}
 	assertConnectionIsNotNil(t, client)
+
+	// The whole bundles are requested by default
+	assert.Equal(t, []*types.BundleMask{nil, nil}, tc.bundleClient.outputMasks)
+}
+
+func TestFetchUpdatesX509AuthoritiesOnly(t *testing.T) {
+	client, tc := createClient()
+	client.c.X509AuthoritiesOnly = true
+
+	tc.entryClient.entries = []*types.Entry{
+		{
+			Id:       "ENTRYID1",
+			ParentId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/host"},
+			SpiffeId: &types.SPIFFEID{
+				TrustDomain: "example.org",
+				Path:        "/id1",
+			},
+			Selectors: []*types.Selector{
+				{Type: "S", Value: "1"},
+			},
+			FederatesWith:  []string{"domain1.com"},
+			RevisionNumber: 1234,
+		},
+	}
+	tc.bundleClient.agentBundle = &types.Bundle{
+		TrustDomain:     "example.org",
+		X509Authorities: []*types.X509Certificate{{Asn1: []byte{10, 20, 30, 40}}},
+	}
+	tc.bundleClient.federatedBundles = map[string]*types.Bundle{
+		"domain1.com": {
+			TrustDomain:     "domain1.com",
+			X509Authorities: []*types.X509Certificate{{Asn1: []byte{10, 20, 30, 40}}},
+		},
+	}
+
+	update, err := client.FetchUpdates(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, testBundles, update.Bundles)
+
+	// Only the X.509 authorities are requested, for both the bundle of the
+	// trust domain and the federated bundle
+	x509Mask := &types.BundleMask{X509Authorities: true}
+	assert.Equal(t, []*types.BundleMask{x509Mask, x509Mask}, tc.bundleClient.outputMasks)
+}
+
+func TestFetchUpdatesDeltaSync(t *testing.T) {
+	client, tc := createClient()
+	client.c.DeltaSync = true
+	tc.entryClient.snapshots = syncdelta.NewSnapshots(clock.NewMock(t))
+
+	entry1 := &types.Entry{
+		Id:             "ENTRYID1",
+		ParentId:       &types.SPIFFEID{TrustDomain: "example.org", Path: "/host"},
+		SpiffeId:       &types.SPIFFEID{TrustDomain: "example.org", Path: "/id1"},
+		Selectors:      []*types.Selector{{Type: "S", Value: "1"}},
+		FederatesWith:  []string{"domain1.com"},
+		RevisionNumber: 1234,
+	}
+	entry2 := &types.Entry{
+		Id:        "ENTRYID2",
+		ParentId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/host"},
+		SpiffeId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/id2"},
+		Selectors: []*types.Selector{{Type: "S", Value: "2"}},
+	}
+	tc.entryClient.entries = []*types.Entry{entry1, entry2}
+	tc.bundleClient.agentBundle = &types.Bundle{
+		TrustDomain:     "example.org",
+		X509Authorities: []*types.X509Certificate{{Asn1: []byte{10, 20, 30, 40}}},
+	}
+	tc.bundleClient.federatedBundles = map[string]*types.Bundle{
+		"domain1.com": {
+			TrustDomain:     "domain1.com",
+			X509Authorities: []*types.X509Certificate{{Asn1: []byte{10, 20, 30, 40}}},
+		},
+	}
+
+	// The first sync gets all the entries and bundles
+	update, err := client.FetchUpdates(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, update.Entries, 2)
+	assert.Equal(t, testBundles, update.Bundles)
+	assert.Len(t, tc.entryClient.sentEntries, 2)
+	assert.Equal(t, 0, tc.bundleClient.unchanged)
+
+	// The next sync only gets the changed entry and the removed entry ID,
+	// and the bundles are unchanged
+	entry1Changed := proto.Clone(entry1).(*types.Entry)
+	entry1Changed.RevisionNumber = 1235
+	tc.entryClient.entries = []*types.Entry{entry1Changed}
+	update, err = client.FetchUpdates(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*types.Entry{entry1Changed}, tc.entryClient.sentEntries)
+	if assert.Len(t, update.Entries, 1) {
+		assert.Equal(t, int64(1235), update.Entries["ENTRYID1"].RevisionNumber)
+	}
+	assert.Equal(t, testBundles, update.Bundles)
+	assert.Equal(t, 2, tc.bundleClient.unchanged)
+
+	// Nothing is sent when nothing changed
+	update, err = client.FetchUpdates(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, tc.entryClient.sentEntries)
+	assert.Len(t, update.Entries, 1)
+
+	// A server not supporting delta encoding sends all the entries
+	tc.entryClient.snapshots = nil
+	update, err = client.FetchUpdates(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, update.Entries, 1)
+	assert.Empty(t, client.entriesToken)
+}
+
+func TestFetchUpdatesDeltaSyncMismatch(t *testing.T) {
+	client, tc := createClient()
+	client.c.DeltaSync = true
+	tc.entryClient.snapshots = syncdelta.NewSnapshots(clock.NewMock(t))
+	tc.bundleClient.agentBundle = &types.Bundle{
+		TrustDomain:     "example.org",
+		X509Authorities: []*types.X509Certificate{{Asn1: []byte{10, 20, 30, 40}}},
+	}
+
+	entry := &types.Entry{
+		Id:        "ENTRYID1",
+		ParentId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/host"},
+		SpiffeId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/id1"},
+		Selectors: []*types.Selector{{Type: "S", Value: "1"}},
+	}
+	tc.entryClient.entries = []*types.Entry{entry}
+	_, err := client.FetchUpdates(context.Background())
+	require.NoError(t, err)
+
+	// Corrupt the entries held so the delta rebuilds entries not matching
+	// the token of the server, which makes the client fetch all the entries
+	client.entryHashes["ENTRYID1"] = "corrupted"
+	update, err := client.FetchUpdates(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, update.Entries, 1)
+	assert.Equal(t, []*types.Entry{entry}, tc.entryClient.sentEntries)
+	assert.Equal(t, syncdelta.Token(map[string]string{"ENTRYID1": mustEntryHash(t, entry)}), client.entriesToken)
+}
+
+func TestSyncCallOptions(t *testing.T) {
+	client, _ := createClient()
+	assert.Empty(t, client.syncCallOptions())
+
+	client.c.CompressSync = true
+	assert.Equal(t, []grpc.CallOption{grpc.UseCompressor("gzip")}, client.syncCallOptions())
+}
+
+func mustEntryHash(t *testing.T, entry *types.Entry) string {
+	hash, err := syncdelta.EntryHash(entry)
+	require.NoError(t, err)
+	return hash
 }
 
 func TestRenewSVID(t *testing.T) {
@@ -256,6 +414,20 @@ func TestRenewSVID(t *testing.T) {
 	}
 }
 
+func TestDeleteAgent(t *testing.T) {
+	client, tc := createClient()
+	agentID := spiffeid.RequireFromString("spiffe://example.org/spire/agent/test/agent1")
+
+	err := client.DeleteAgent(context.Background(), agentID)
+	require.NoError(t, err)
+	require.Equal(t, &types.SPIFFEID{TrustDomain: "example.org", Path: "/spire/agent/test/agent1"}, tc.agentClient.deletedID)
+	assertConnectionIsNotNil(t, client)
+
+	tc.agentClient.err = errors.New("delete fails")
+	err = client.DeleteAgent(context.Background(), agentID)
+	require.EqualError(t, err, "failed to delete agent: delete fails")
+}
+
 func TestNewX509SVIDs(t *testing.T) {
 	client, tc := createClient()
 
@@ -762,17 +934,48 @@ type fakeEntryClient struct {
 	entryv1.EntryClient
 	entries []*types.Entry
 	err     error
+
+	// snapshots, if set, makes the client answer requests for deltas like
+	// the server does
+	snapshots *syncdelta.Snapshots
+	// sentEntries are the entries of the last response
+	sentEntries []*types.Entry
 }
 
 func (c *fakeEntryClient) GetAuthorizedEntries(ctx context.Context, in *entryv1.GetAuthorizedEntriesRequest, opts ...grpc.CallOption) (*entryv1.GetAuthorizedEntriesResponse, error) {
 	if c.err != nil {
 		return nil, c.err
 	}
+	entries := c.entries
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if tokens := md.Get(syncdelta.EntriesTokenKey); c.snapshots != nil && len(tokens) > 0 {
+		delta, err := c.snapshots.Delta("spiffe://example.org/agent", tokens[0], c.entries)
+		if err != nil {
+			return nil, err
+		}
+		trailer := metadata.Pairs(
+			syncdelta.EntriesModeKey, delta.Mode,
+			syncdelta.EntriesTokenKey, delta.Token,
+		)
+		trailer.Append(syncdelta.RemovedEntriesKey, delta.Removed...)
+		setTrailer(opts, trailer)
+		entries = delta.Entries
+	}
+	c.sentEntries = entries
 	return &entryv1.GetAuthorizedEntriesResponse{
-		Entries: c.entries,
+		Entries: entries,
 	}, nil
 }
 
+// setTrailer sets the trailer of the call, like the server does
+func setTrailer(opts []grpc.CallOption, trailer metadata.MD) {
+	for _, opt := range opts {
+		if opt, ok := opt.(grpc.TrailerCallOption); ok {
+			*opt.TrailerAddr = trailer
+		}
+	}
+}
+
 type fakeBundleClient struct {
 	bundlev1.BundleClient
 
@@ -781,10 +984,16 @@ type fakeBundleClient struct {
 	bundleErr          error
 	federatedBundleErr error
 
+	// outputMasks are the output masks of the requests received
+	outputMasks []*types.BundleMask
+	// unchanged counts the bundles answered as unchanged
+	unchanged int
+
 	simulateRelease func()
 }
 
 func (c *fakeBundleClient) GetBundle(ctx context.Context, in *bundlev1.GetBundleRequest, opts ...grpc.CallOption) (*types.Bundle, error) {
+	c.outputMasks = append(c.outputMasks, in.OutputMask)
 	if c.bundleErr != nil {
 		return nil, c.bundleErr
 	}
@@ -793,10 +1002,30 @@ func (c *fakeBundleClient) GetBundle(ctx context.Context, in *bundlev1.GetBundle
 		go c.simulateRelease()
 	}
 
-	return c.agentBundle, nil
+	return c.unchangedBundle(ctx, opts, c.agentBundle)
+}
+
+// unchangedBundle answers the agent holding the bundle like the server does
+func (c *fakeBundleClient) unchangedBundle(ctx context.Context, opts []grpc.CallOption, bundle *types.Bundle) (*types.Bundle, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	hashes := md.Get(syncdelta.BundleHashKey)
+	if len(hashes) == 0 {
+		return bundle, nil
+	}
+	hash, err := syncdelta.BundleHash(bundle)
+	if err != nil {
+		return nil, err
+	}
+	if hash != hashes[0] {
+		return bundle, nil
+	}
+	c.unchanged++
+	setTrailer(opts, metadata.Pairs(syncdelta.BundleUnchangedKey, "true"))
+	return &types.Bundle{TrustDomain: bundle.TrustDomain}, nil
 }
 
 func (c *fakeBundleClient) GetFederatedBundle(ctx context.Context, in *bundlev1.GetFederatedBundleRequest, opts ...grpc.CallOption) (*types.Bundle, error) {
+	c.outputMasks = append(c.outputMasks, in.OutputMask)
 	if c.federatedBundleErr != nil {
 		return nil, c.federatedBundleErr
 	}
@@ -805,7 +1034,7 @@ func (c *fakeBundleClient) GetFederatedBundle(ctx context.Context, in *bundlev1.
 		return nil, errors.New("no federated bundle found")
 	}
 
-	return b, nil
+	return c.unchangedBundle(ctx, opts, b)
 }
 
 type fakeSVIDClient struct {
@@ -864,8 +1093,9 @@ func (c *fakeSVIDClient) NewJWTSVID(ctx context.Context, in *svidv1.NewJWTSVIDRe
 
 type fakeAgentClient struct {
 	agentv1.AgentClient
-	err  error
-	svid *types.X509SVID
+	err       error
+	svid      *types.X509SVID
+	deletedID *types.SPIFFEID
 }
 
 func (c *fakeAgentClient) RenewAgent(ctx context.Context, in *agentv1.RenewAgentRequest, opts ...grpc.CallOption) (*agentv1.RenewAgentResponse, error) {
@@ -882,6 +1112,14 @@ func (c *fakeAgentClient) RenewAgent(ctx context.Context, in *agentv1.RenewAgent
 	}, nil
 }
 
+func (c *fakeAgentClient) DeleteAgent(ctx context.Context, in *agentv1.DeleteAgentRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.deletedID = in.Id
+	return &emptypb.Empty{}, nil
+}
+
 type testClient struct {
 	agentClient  *fakeAgentClient
 	bundleClient *fakeBundleClient
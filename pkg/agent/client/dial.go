@@ -7,12 +7,14 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
 	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/spire/pkg/common/fips"
 	"github.com/spiffe/spire/pkg/common/idutil"
 	"github.com/spiffe/spire/pkg/common/x509util"
 	"google.golang.org/grpc"
@@ -38,6 +40,10 @@ type DialServerConfig struct {
 	// certificate to present to the server during the TLS handshake.
 	GetAgentCertificate func() *tls.Certificate
 
+	// ProxyURL is the optional URL of the proxy used to connect to the
+	// server. See ValidateProxyURL for the supported proxies.
+	ProxyURL *url.URL
+
 	// dialContext is an optional constructor for the grpc client connection.
 	dialContext func(ctx context.Context, target string, opts ...grpc.DialOption) (*grpc.ClientConn, error)
 }
@@ -53,6 +59,7 @@ func DialServer(ctx context.Context, config DialServerConfig) (*grpc.ClientConn,
 	} else {
 		tlsConfig = tlsconfig.MTLSClientConfig(newX509SVIDSource(config.GetAgentCertificate), bundleSource, authorizer)
 	}
+	fips.ConfigureTLS(tlsConfig)
 
 	ctx, cancel := context.WithTimeout(ctx, _defaultDialTimeout)
 	defer cancel()
@@ -60,14 +67,18 @@ func DialServer(ctx context.Context, config DialServerConfig) (*grpc.ClientConn,
 	if config.dialContext == nil {
 		config.dialContext = grpc.DialContext
 	}
-	client, err := config.dialContext(ctx, config.Address,
+	opts := []grpc.DialOption{
 		// TODO: port to non-deprecated option
 		grpc.WithBalancerName(roundrobin.Name), //nolint:staticcheck // not ready to port
 		grpc.FailOnNonTempDialError(true),
 		grpc.WithBlock(),
 		grpc.WithReturnConnectionError(),
 		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
-	)
+	}
+	if config.ProxyURL != nil {
+		opts = append(opts, WithProxy(config.ProxyURL))
+	}
+	client, err := config.dialContext(ctx, config.Address, opts...)
 	switch {
 	case err == nil:
 	case errors.Is(err, context.Canceled):
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+	"google.golang.org/grpc"
+)
+
+// ValidateProxyURL validates the URL of a proxy the agent can connect to the
+// server through. Supported schemes are http and https, for HTTP CONNECT
+// proxies, and socks5 and socks5h, for SOCKS5 proxies. Credentials, if
+// required by the proxy, are set in the user info of the URL.
+func ValidateProxyURL(proxyURL *url.URL) error {
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	if proxyURL.Hostname() == "" {
+		return errors.New("proxy URL is missing the host")
+	}
+	if proxyURL.Path != "" && proxyURL.Path != "/" {
+		return errors.New("proxy URL cannot have a path")
+	}
+	return nil
+}
+
+// WithProxy returns a dial option that makes the connections to the server
+// through the proxy at the given URL. The target address is resolved by the
+// proxy, so the dial target should not be resolved by gRPC (i.e. it should
+// use the passthrough scheme).
+func WithProxy(proxyURL *url.URL) grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return dialProxy(ctx, proxyURL, addr)
+	})
+}
+
+func dialProxy(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	if err := ValidateProxyURL(proxyURL); err != nil {
+		return nil, err
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		return dialSOCKS5Proxy(ctx, proxyURL, addr)
+	default:
+		return dialHTTPProxy(ctx, proxyURL, addr)
+	}
+}
+
+func dialSOCKS5Proxy(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		auth = &proxy.Auth{
+			User:     proxyURL.User.Username(),
+			Password: password,
+		}
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", proxyAddress(proxyURL), auth, &net.Dialer{})
+	if err != nil {
+		return nil, err
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		// This is not possible unless the proxy package changes
+		return nil, errors.New("SOCKS5 dialer does not support contexts")
+	}
+
+	conn, err := contextDialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect through SOCKS5 proxy: %w", err)
+	}
+	return conn, nil
+}
+
+func dialHTTPProxy(ctx context.Context, proxyURL *url.URL, addr string) (_ net.Conn, err error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddress(proxyURL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial proxy: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
+	// Bound the proxy handshake by the dial deadline, if any. The deadline is
+	// cleared once the tunnel is established.
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName: proxyURL.Hostname(),
+			MinVersion: tls.VersionTLS12,
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, fmt.Errorf("failed TLS handshake with proxy: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := proxyURL.User.Username() + ":" + password
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("failed to send CONNECT request to proxy: %w", err)
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CONNECT response from proxy: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy refused to connect to %s: %s", addr, resp.Status)
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	// The reader may have buffered bytes past the CONNECT response, which
+	// belong to the tunneled connection.
+	return &bufferedConn{Conn: conn, r: r}, nil
+}
+
+func proxyAddress(proxyURL *url.URL) string {
+	if proxyURL.Port() != "" {
+		return proxyURL.Host
+	}
+
+	port := "80"
+	switch proxyURL.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -4,9 +4,14 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"path"
+	"strconv"
 	"strings"
 )
 
+// DefaultProcRoot is where the proc filesystem is mounted by default
+const DefaultProcRoot = "/proc"
+
 // Filesystem abstracts filesystem operations.
 type FileSystem interface {
 	// Open opens the named file for reading.
@@ -29,8 +34,14 @@ type Cgroup struct {
 //  - http://man7.org/linux/man-pages/man7/cgroups.7.html
 //  - https://www.kernel.org/doc/Documentation/cgroup-v2.txt
 func GetCgroups(pid int32, fs FileSystem) ([]Cgroup, error) {
-	path := fmt.Sprintf("/proc/%v/cgroup", pid)
-	file, err := fs.Open(path)
+	return GetCgroupsFromProcRoot(DefaultProcRoot, pid, fs)
+}
+
+// GetCgroupsFromProcRoot is like GetCgroups, reading the proc filesystem
+// mounted at procRoot instead, e.g. the proc filesystem of the host mounted
+// in the agent container.
+func GetCgroupsFromProcRoot(procRoot string, pid int32, fs FileSystem) ([]Cgroup, error) {
+	file, err := fs.Open(path.Join(procRoot, strconv.Itoa(int(pid)), "cgroup"))
 	if err != nil {
 		return nil, err
 	}
@@ -58,3 +69,22 @@ func GetCgroups(pid int32, fs FileSystem) ([]Cgroup, error) {
 
 	return cgroups, nil
 }
+
+// TrimNamespaceRoot trims the leading ".." segments off a cgroup path. The
+// paths of the cgroups outside the cgroup namespace of the reader, e.g. of an
+// agent running in a container with a private cgroup namespace, are relative
+// to the root of that namespace and start with ".." segments. It returns the
+// trimmed path and whether the cgroup is outside the namespace.
+//
+// For more information, see:
+//  - http://man7.org/linux/man-pages/man7/cgroup_namespaces.7.html
+func TrimNamespaceRoot(groupPath string) (string, bool) {
+	trimmed := groupPath
+	for strings.HasPrefix(trimmed, "/../") || trimmed == "/.." {
+		trimmed = strings.TrimPrefix(trimmed, "/..")
+	}
+	if trimmed == "" {
+		trimmed = "/"
+	}
+	return trimmed, trimmed != groupPath
+}
@@ -71,6 +71,36 @@ func TestCgroupsBadFormat(t *testing.T) {
 	require.Nil(t, cgroups)
 }
 
+func TestCgroupsFromProcRoot(t *testing.T) {
+	cgroups, err := GetCgroupsFromProcRoot("/host/proc", 123, FakeFileSystem{
+		Files: map[string]string{
+			"/proc/123/cgroup":      cgBadFormat,
+			"/host/proc/123/cgroup": cgSimple,
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, expectSimpleCgroup, cgroups)
+}
+
+func TestTrimNamespaceRoot(t *testing.T) {
+	for _, tt := range []struct {
+		groupPath     string
+		expectPath    string
+		expectTrimmed bool
+	}{
+		{groupPath: "/", expectPath: "/"},
+		{groupPath: "/kubepods/besteffort", expectPath: "/kubepods/besteffort"},
+		{groupPath: "/..foo/bar", expectPath: "/..foo/bar"},
+		{groupPath: "/..", expectPath: "/", expectTrimmed: true},
+		{groupPath: "/../..", expectPath: "/", expectTrimmed: true},
+		{groupPath: "/../../burstable/pod1234/abcd", expectPath: "/burstable/pod1234/abcd", expectTrimmed: true},
+	} {
+		path, trimmed := TrimNamespaceRoot(tt.groupPath)
+		require.Equal(t, tt.expectPath, path, tt.groupPath)
+		require.Equal(t, tt.expectTrimmed, trimmed, tt.groupPath)
+	}
+}
+
 type FakeFileSystem struct {
 	Files map[string]string
 }
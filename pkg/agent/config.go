@@ -3,10 +3,14 @@ package agent
 import (
 	"crypto/x509"
 	"net"
+	"net/url"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	workload_attestor "github.com/spiffe/spire/pkg/agent/attestor/workload"
+	"github.com/spiffe/spire/pkg/agent/canary"
+	"github.com/spiffe/spire/pkg/agent/quarantine"
 	"github.com/spiffe/spire/pkg/common/catalog"
 	"github.com/spiffe/spire/pkg/common/health"
 	"github.com/spiffe/spire/pkg/common/telemetry"
@@ -22,6 +26,16 @@ type Config struct {
 	// Directory to bind the admin api to
 	AdminBindAddress *net.UnixAddr
 
+	// Address to serve the runtime profiles on, next to the admin api
+	AdminProfilingBindAddress *net.UnixAddr
+
+	// Address to serve the trust bundles over HTTP on, if set
+	BundleBindAddress *net.UnixAddr
+
+	// WorkloadAPIVsockPort, if set, is the vsock port to serve the Workload
+	// API on, for the workloads running in VMs on the node
+	WorkloadAPIVsockPort uint32
+
 	// The Validation Context resource name to use for the default X.509 bundle with Envoy SDS
 	DefaultBundleName string
 
@@ -42,9 +56,41 @@ type Config struct {
 	// Address of SPIRE server
 	ServerAddress string
 
+	// ProxyURL is the optional URL of the proxy used to connect to the SPIRE
+	// server
+	ProxyURL *url.URL
+
 	// SyncInterval controls how often the agent sync synchronizer waits
 	SyncInterval time.Duration
 
+	// SyncKickInterval, if set, makes the agent sync ahead of schedule when
+	// a workload it has no identity for asks for its SVIDs, at most once per
+	// interval
+	SyncKickInterval time.Duration
+
+	// X509AuthoritiesOnly, if true, makes the agent sync only the X.509
+	// authorities of the bundles, leaving out the JWT authorities
+	X509AuthoritiesOnly bool
+
+	// CompressSync, if true, makes the agent compress the entries and
+	// bundles it syncs with the server
+	CompressSync bool
+
+	// DeltaSync, if true, makes the agent sync only the entries and bundles
+	// that changed since its last sync
+	DeltaSync bool
+
+	// Ephemeral, if true, optimizes the agent for short-lived nodes: it
+	// caches nothing on disk, attests on every start, syncs aggressively
+	// right after it starts and deletes itself from the server on shutdown
+	Ephemeral bool
+
+	// ClockSkewTolerance is how far the clocks of the agent and of the
+	// server may diverge. It is the leeway JWT-SVIDs are validated with, and
+	// the agent warns when the skew it measures with the server exceeds it.
+	// Defaults to one minute.
+	ClockSkewTolerance time.Duration
+
 	// Trust domain and associated CA bundle
 	TrustDomain spiffeid.TrustDomain
 	TrustBundle []*x509.Certificate
@@ -52,6 +98,10 @@ type Config struct {
 	// Join token to use for attestation, if needed
 	JoinToken string
 
+	// FIPSMode restricts the TLS settings used to talk to the server to the
+	// FIPS approved ones
+	FIPSMode bool
+
 	// If true enables profiling.
 	ProfilingEnabled bool
 
@@ -71,6 +121,19 @@ type Config struct {
 
 	// List of allowed claims response when calling ValidateJWTSVID using a foreign identity
 	AllowedForeignJWTClaims []string
+
+	// CanaryProbe, if set, configures the probe continuously fetching the
+	// canary identity from the Workload API of the agent
+	CanaryProbe *canary.Config
+
+	// WorkloadQuarantine, if set, enables quarantining workloads on the
+	// agent, which withholds their SVIDs regardless of the registration
+	// entries
+	WorkloadQuarantine *quarantine.Config
+
+	// WorkloadAttestation controls how the selectors of the workload
+	// attestors are combined. The zero value unions them all.
+	WorkloadAttestation workload_attestor.Policy
 }
 
 func New(c *Config) *Agent {
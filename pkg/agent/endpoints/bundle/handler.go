@@ -0,0 +1,183 @@
+package bundle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/agent/manager/cache"
+	"github.com/spiffe/spire/pkg/common/bundleutil"
+	"github.com/spiffe/spire/pkg/common/pemutil"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/proto/spire/common"
+)
+
+const (
+	// Path is the path the trust bundles are served on
+	Path = "/bundle"
+
+	// FormatSPIFFE is the SPIFFE bundle format, which holds both the X.509
+	// and JWT authorities. It is the default format.
+	FormatSPIFFE = "spiffe"
+
+	// FormatPEM is the PEM format, which only holds the X.509 authorities
+	FormatPEM = "pem"
+)
+
+type Manager interface {
+	FetchWorkloadUpdate([]*common.Selector) *cache.WorkloadUpdate
+}
+
+type Attestor interface {
+	Attest(ctx context.Context) ([]*common.Selector, error)
+}
+
+type Config struct {
+	Manager                       Manager
+	Attestor                      Attestor
+	AllowUnauthenticatedVerifiers bool
+	Log                           logrus.FieldLogger
+}
+
+// Handler serves the trust bundles available to the calling workload, like
+// the bundle streams of the Workload API, over HTTP. Responses carry an ETag
+// derived from their contents, so workloads that only need the bundles to
+// verify peers can poll cheaply with conditional requests instead of holding
+// a stream open.
+//
+// The bundle of a trust domain is served on GET /bundle?trust_domain=<name>,
+// defaulting to the trust domain of the agent, in the format given by the
+// "format" parameter, i.e. "spiffe" (default) or "pem".
+type Handler struct {
+	c Config
+}
+
+func New(c Config) *Handler {
+	return &Handler{
+		c: c,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := h.c.Log
+
+	if r.URL.Path != Path {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = FormatSPIFFE
+	case FormatSPIFFE, FormatPEM:
+	default:
+		http.Error(w, "unsupported format", http.StatusBadRequest)
+		return
+	}
+
+	var td spiffeid.TrustDomain
+	if name := r.URL.Query().Get("trust_domain"); name != "" {
+		var err error
+		td, err = spiffeid.TrustDomainFromString(name)
+		if err != nil {
+			http.Error(w, "invalid trust domain", http.StatusBadRequest)
+			return
+		}
+	}
+
+	selectors, err := h.c.Attestor.Attest(r.Context())
+	if err != nil {
+		log.WithError(err).Error("Workload attestation failed")
+		http.Error(w, "workload attestation failed", http.StatusInternalServerError)
+		return
+	}
+
+	update := h.c.Manager.FetchWorkloadUpdate(selectors)
+	if !h.c.AllowUnauthenticatedVerifiers && !update.HasIdentity() {
+		log.WithField(telemetry.Registered, false).Error("No identity issued")
+		http.Error(w, "no identity issued", http.StatusForbidden)
+		return
+	}
+	if update.Bundle == nil {
+		// This should be purely defensive since the cache should always supply
+		// a bundle.
+		log.Error("Bundle not available")
+		http.Error(w, "bundle not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	bundle := lookupBundle(update, td)
+	if bundle == nil {
+		http.Error(w, "bundle not found", http.StatusNotFound)
+		return
+	}
+
+	var body []byte
+	switch format {
+	case FormatSPIFFE:
+		body, err = bundleutil.Marshal(bundle)
+		if err != nil {
+			log.WithError(err).Error("Could not serialize bundle")
+			http.Error(w, "could not serialize bundle", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+	case FormatPEM:
+		body = pemutil.EncodeCertificates(bundle.RootCAs())
+		w.Header().Set("Content-Type", "application/x-pem-file")
+	}
+
+	etag := computeETag(body)
+	w.Header().Set("ETag", etag)
+	// Caches have to revalidate, since bundles rotate
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// lookupBundle returns the bundle of the trust domain from the update, or the
+// bundle of the trust domain of the agent if the trust domain is not set.
+// Federated bundles are only available to workloads with an identity, as with
+// the Workload API.
+func lookupBundle(update *cache.WorkloadUpdate, td spiffeid.TrustDomain) *bundleutil.Bundle {
+	if td.IsZero() || td.IDString() == update.Bundle.TrustDomainID() {
+		return update.Bundle
+	}
+	if !update.HasIdentity() {
+		return nil
+	}
+	return update.FederatedBundles[td]
+}
+
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// etagMatches returns true if the If-None-Match header value matches the
+// ETag, i.e. it is "*" or contains the ETag, weak or not.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,278 @@
+package bundle_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/agent/endpoints/bundle"
+	"github.com/spiffe/spire/pkg/agent/manager/cache"
+	"github.com/spiffe/spire/pkg/common/bundleutil"
+	"github.com/spiffe/spire/pkg/common/pemutil"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/spiffe/spire/test/testca"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	td  = spiffeid.RequireTrustDomainFromString("domain.test")
+	td2 = spiffeid.RequireTrustDomainFromString("domain2.test")
+)
+
+func TestServeHTTP(t *testing.T) {
+	ca := testca.New(t, td)
+	agentBundle := bundleutil.BundleFromRootCAs(td, ca.X509Authorities())
+	require.NoError(t, agentBundle.AppendJWTSigningKey("KID", ca.X509Authorities()[0].PublicKey))
+	federatedBundle := bundleutil.BundleFromRootCAs(td2, testca.New(t, td2).X509Authorities())
+
+	agentBundleJSON, err := bundleutil.Marshal(agentBundle)
+	require.NoError(t, err)
+	federatedBundleJSON, err := bundleutil.Marshal(federatedBundle)
+	require.NoError(t, err)
+	agentBundlePEM := pemutil.EncodeCertificates(agentBundle.RootCAs())
+
+	registered := &cache.WorkloadUpdate{
+		Identities: []cache.Identity{{Entry: &common.RegistrationEntry{SpiffeId: "spiffe://domain.test/workload"}}},
+		Bundle:     agentBundle,
+		FederatedBundles: map[spiffeid.TrustDomain]*bundleutil.Bundle{
+			td2: federatedBundle,
+		},
+	}
+	unregistered := &cache.WorkloadUpdate{
+		Bundle: agentBundle,
+		FederatedBundles: map[spiffeid.TrustDomain]*bundleutil.Bundle{
+			td2: federatedBundle,
+		},
+	}
+
+	for _, tt := range []struct {
+		name                          string
+		method                        string
+		target                        string
+		ifNoneMatch                   string
+		update                        *cache.WorkloadUpdate
+		attestErr                     error
+		allowUnauthenticatedVerifiers bool
+		expectCode                    int
+		expectContentType             string
+		expectBody                    []byte
+		expectETag                    []byte
+		expectLogs                    []spiretest.LogEntry
+	}{
+		{
+			name:              "agent bundle",
+			target:            "/bundle",
+			update:            registered,
+			expectCode:        http.StatusOK,
+			expectContentType: "application/json",
+			expectBody:        agentBundleJSON,
+			expectETag:        agentBundleJSON,
+		},
+		{
+			name:              "agent bundle in PEM format",
+			target:            "/bundle?format=pem",
+			update:            registered,
+			expectCode:        http.StatusOK,
+			expectContentType: "application/x-pem-file",
+			expectBody:        agentBundlePEM,
+			expectETag:        agentBundlePEM,
+		},
+		{
+			name:              "federated bundle",
+			target:            "/bundle?trust_domain=domain2.test",
+			update:            registered,
+			expectCode:        http.StatusOK,
+			expectContentType: "application/json",
+			expectBody:        federatedBundleJSON,
+			expectETag:        federatedBundleJSON,
+		},
+		{
+			name:              "not modified",
+			target:            "/bundle",
+			ifNoneMatch:       `"other", ` + etag(agentBundleJSON),
+			update:            registered,
+			expectCode:        http.StatusNotModified,
+			expectContentType: "application/json",
+			expectETag:        agentBundleJSON,
+		},
+		{
+			name:              "modified",
+			target:            "/bundle",
+			ifNoneMatch:       etag(federatedBundleJSON),
+			update:            registered,
+			expectCode:        http.StatusOK,
+			expectContentType: "application/json",
+			expectBody:        agentBundleJSON,
+			expectETag:        agentBundleJSON,
+		},
+		{
+			name:              "head",
+			method:            http.MethodHead,
+			target:            "/bundle",
+			update:            registered,
+			expectCode:        http.StatusOK,
+			expectContentType: "application/json",
+			expectETag:        agentBundleJSON,
+		},
+		{
+			name:       "unknown trust domain",
+			target:     "/bundle?trust_domain=domain3.test",
+			update:     registered,
+			expectCode: http.StatusNotFound,
+			expectBody: []byte("bundle not found\n"),
+		},
+		{
+			name:       "invalid trust domain",
+			target:     "/bundle?trust_domain=https://domain.test",
+			expectCode: http.StatusBadRequest,
+			expectBody: []byte("invalid trust domain\n"),
+		},
+		{
+			name:       "unsupported format",
+			target:     "/bundle?format=der",
+			expectCode: http.StatusBadRequest,
+			expectBody: []byte("unsupported format\n"),
+		},
+		{
+			name:       "unknown path",
+			target:     "/bundles",
+			expectCode: http.StatusNotFound,
+			expectBody: []byte("404 page not found\n"),
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodPost,
+			target:     "/bundle",
+			expectCode: http.StatusMethodNotAllowed,
+			expectBody: []byte("method not allowed\n"),
+		},
+		{
+			name:       "attestation failure",
+			target:     "/bundle",
+			attestErr:  errors.New("oh no"),
+			expectCode: http.StatusInternalServerError,
+			expectBody: []byte("workload attestation failed\n"),
+			expectLogs: []spiretest.LogEntry{
+				{
+					Level:   logrus.ErrorLevel,
+					Message: "Workload attestation failed",
+					Data:    logrus.Fields{logrus.ErrorKey: "oh no"},
+				},
+			},
+		},
+		{
+			name:       "no identity issued",
+			target:     "/bundle",
+			update:     unregistered,
+			expectCode: http.StatusForbidden,
+			expectBody: []byte("no identity issued\n"),
+			expectLogs: []spiretest.LogEntry{
+				{
+					Level:   logrus.ErrorLevel,
+					Message: "No identity issued",
+					Data:    logrus.Fields{"registered": "false"},
+				},
+			},
+		},
+		{
+			name:                          "unauthenticated verifier",
+			target:                        "/bundle",
+			update:                        unregistered,
+			allowUnauthenticatedVerifiers: true,
+			expectCode:                    http.StatusOK,
+			expectContentType:             "application/json",
+			expectBody:                    agentBundleJSON,
+			expectETag:                    agentBundleJSON,
+		},
+		{
+			name:                          "unauthenticated verifier can't get federated bundles",
+			target:                        "/bundle?trust_domain=domain2.test",
+			update:                        unregistered,
+			allowUnauthenticatedVerifiers: true,
+			expectCode:                    http.StatusNotFound,
+			expectBody:                    []byte("bundle not found\n"),
+		},
+		{
+			name:       "bundle not available",
+			target:     "/bundle",
+			update:     &cache.WorkloadUpdate{Identities: registered.Identities},
+			expectCode: http.StatusServiceUnavailable,
+			expectBody: []byte("bundle not available\n"),
+			expectLogs: []spiretest.LogEntry{
+				{
+					Level:   logrus.ErrorLevel,
+					Message: "Bundle not available",
+				},
+			},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			log, hook := test.NewNullLogger()
+			handler := bundle.New(bundle.Config{
+				Manager:                       fakeManager{update: tt.update},
+				Attestor:                      fakeAttestor{err: tt.attestErr},
+				AllowUnauthenticatedVerifiers: tt.allowUnauthenticatedVerifiers,
+				Log:                           log,
+			})
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "http://localhost"+tt.target, nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectCode, rec.Code)
+			assert.Equal(t, string(tt.expectBody), rec.Body.String())
+			if tt.expectETag != nil {
+				assert.Equal(t, tt.expectContentType, rec.Header().Get("Content-Type"))
+				assert.Equal(t, etag(tt.expectETag), rec.Header().Get("ETag"))
+				assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+			} else {
+				assert.Empty(t, rec.Header().Get("ETag"))
+			}
+			spiretest.AssertLogs(t, hook.AllEntries(), tt.expectLogs)
+		})
+	}
+}
+
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+type fakeManager struct {
+	update *cache.WorkloadUpdate
+}
+
+func (m fakeManager) FetchWorkloadUpdate([]*common.Selector) *cache.WorkloadUpdate {
+	if m.update == nil {
+		return &cache.WorkloadUpdate{}
+	}
+	return m.update
+}
+
+type fakeAttestor struct {
+	err error
+}
+
+func (a fakeAttestor) Attest(ctx context.Context) ([]*common.Selector, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	return []*common.Selector{{Type: "Type", Value: "Value"}}, nil
+}
@@ -2,6 +2,8 @@ package endpoints
 
 import (
 	"net"
+	"net/http"
+	"time"
 
 	discovery_v2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
 	secret_v3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
@@ -10,10 +12,12 @@ import (
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	healthv1 "github.com/spiffe/spire/pkg/agent/api/health/v1"
 	attestor "github.com/spiffe/spire/pkg/agent/attestor/workload"
+	"github.com/spiffe/spire/pkg/agent/endpoints/bundle"
 	"github.com/spiffe/spire/pkg/agent/endpoints/sdsv2"
 	"github.com/spiffe/spire/pkg/agent/endpoints/sdsv3"
 	"github.com/spiffe/spire/pkg/agent/endpoints/workload"
 	"github.com/spiffe/spire/pkg/agent/manager"
+	"github.com/spiffe/spire/pkg/agent/quarantine"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	"google.golang.org/grpc/health/grpc_health_v1"
 )
@@ -21,10 +25,22 @@ import (
 type Config struct {
 	BindAddr *net.UnixAddr
 
+	// BundleBindAddr, if set, is the address to serve the trust bundles over
+	// HTTP on
+	BundleBindAddr *net.UnixAddr
+
+	// VsockPort, if set, is the vsock port to serve the Workload API on, for
+	// the workloads running in VMs on the node
+	VsockPort uint32
+
 	Attestor attestor.Attestor
 
 	Manager manager.Manager
 
+	// Quarantine, if set, withholds the SVIDs from the workloads quarantined
+	// on the agent
+	Quarantine *quarantine.Quarantine
+
 	Log logrus.FieldLogger
 
 	Metrics telemetry.Metrics
@@ -41,10 +57,15 @@ type Config struct {
 
 	TrustDomain spiffeid.TrustDomain
 
+	// ClockSkewTolerance is the leeway JWT-SVIDs are validated with
+	ClockSkewTolerance time.Duration
+
 	// Hooks used by the unit tests to assert that the configuration provided
 	// to each handler is correct and return fake handlers.
 	newWorkloadAPIServer func(workload.Config) workload_pb.SpiffeWorkloadAPIServer
 	newSDSv2Server       func(sdsv2.Config) discovery_v2.SecretDiscoveryServiceServer
 	newSDSv3Server       func(sdsv3.Config) secret_v3.SecretDiscoveryServiceServer
 	newHealthServer      func(healthv1.Config) grpc_health_v1.HealthServer
+	newBundleHandler     func(bundle.Config) http.Handler
+	listenVsock          func(port uint32) (net.Listener, error)
 }
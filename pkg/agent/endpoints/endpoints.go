@@ -5,21 +5,29 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"time"
 
 	discovery_v2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
 	secret_v3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
 	"github.com/sirupsen/logrus"
 	workload_pb "github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
 	healthv1 "github.com/spiffe/spire/pkg/agent/api/health/v1"
+	"github.com/spiffe/spire/pkg/agent/endpoints/bundle"
 	"github.com/spiffe/spire/pkg/agent/endpoints/sdsv2"
 	"github.com/spiffe/spire/pkg/agent/endpoints/sdsv3"
 	"github.com/spiffe/spire/pkg/agent/endpoints/workload"
 	"github.com/spiffe/spire/pkg/common/api/middleware"
 	"github.com/spiffe/spire/pkg/common/peertracker"
+	"github.com/spiffe/spire/pkg/common/systemd"
 	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/common/util"
+	"github.com/spiffe/spire/pkg/common/vsock"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
 )
 
 type Server interface {
@@ -28,17 +36,27 @@ type Server interface {
 
 type Endpoints struct {
 	addr              *net.UnixAddr
+	bundleAddr        *net.UnixAddr
+	vsockPort         uint32
 	log               logrus.FieldLogger
 	metrics           telemetry.Metrics
 	workloadAPIServer workload_pb.SpiffeWorkloadAPIServer
 	sdsv2Server       discovery_v2.SecretDiscoveryServiceServer
 	sdsv3Server       secret_v3.SecretDiscoveryServiceServer
 	healthServer      grpc_health_v1.HealthServer
+	bundleHandler     http.Handler
+
+	vsockWorkloadAPIServer workload_pb.SpiffeWorkloadAPIServer
+	listenVsock            func(port uint32) (net.Listener, error)
 }
 
 func New(c Config) *Endpoints {
 	attestor := peerTrackerAttestor{Attestor: c.Attestor}
 
+	if c.Quarantine != nil {
+		c.Manager = newQuarantineManager(c.Manager, c.Quarantine, c.Log)
+	}
+
 	if c.newWorkloadAPIServer == nil {
 		c.newWorkloadAPIServer = func(c workload.Config) workload_pb.SpiffeWorkloadAPIServer {
 			return workload.New(c)
@@ -59,19 +77,37 @@ func New(c Config) *Endpoints {
 			return healthv1.New(c)
 		}
 	}
+	if c.newBundleHandler == nil {
+		c.newBundleHandler = func(c bundle.Config) http.Handler {
+			return bundle.New(c)
+		}
+	}
+	if c.listenVsock == nil {
+		c.listenVsock = vsock.Listen
+	}
 
 	allowedClaims := make(map[string]struct{}, len(c.AllowedForeignJWTClaims))
 	for _, claim := range c.AllowedForeignJWTClaims {
 		allowedClaims[claim] = struct{}{}
 	}
 
-	workloadAPIServer := c.newWorkloadAPIServer(workload.Config{
-		Manager:                       c.Manager,
-		Attestor:                      attestor,
-		AllowUnauthenticatedVerifiers: c.AllowUnauthenticatedVerifiers,
-		AllowedForeignJWTClaims:       allowedClaims,
-		TrustDomain:                   c.TrustDomain,
-	})
+	newWorkloadAPIServer := func(attestor workload.Attestor) workload_pb.SpiffeWorkloadAPIServer {
+		return c.newWorkloadAPIServer(workload.Config{
+			Manager:                       c.Manager,
+			Attestor:                      attestor,
+			AllowUnauthenticatedVerifiers: c.AllowUnauthenticatedVerifiers,
+			AllowedForeignJWTClaims:       allowedClaims,
+			TrustDomain:                   c.TrustDomain,
+			ClockSkewTolerance:            c.ClockSkewTolerance,
+		})
+	}
+
+	workloadAPIServer := newWorkloadAPIServer(attestor)
+
+	var vsockWorkloadAPIServer workload_pb.SpiffeWorkloadAPIServer
+	if c.VsockPort != 0 {
+		vsockWorkloadAPIServer = newWorkloadAPIServer(vsockAttestor{})
+	}
 
 	sdsv2Server := c.newSDSv2Server(sdsv2.Config{
 		Attestor:          attestor,
@@ -91,47 +127,86 @@ func New(c Config) *Endpoints {
 		SocketPath: c.BindAddr.String(),
 	})
 
+	bundleHandler := c.newBundleHandler(bundle.Config{
+		Manager:                       c.Manager,
+		Attestor:                      attestor,
+		AllowUnauthenticatedVerifiers: c.AllowUnauthenticatedVerifiers,
+		Log:                           c.Log.WithField(telemetry.SubsystemName, telemetry.BundleEndpoint),
+	})
+
 	return &Endpoints{
 		addr:              c.BindAddr,
+		bundleAddr:        c.BundleBindAddr,
 		log:               c.Log,
 		metrics:           c.Metrics,
 		workloadAPIServer: workloadAPIServer,
 		sdsv2Server:       sdsv2Server,
 		sdsv3Server:       sdsv3Server,
 		healthServer:      healthServer,
+		bundleHandler:     bundleHandler,
+
+		vsockPort:              c.VsockPort,
+		vsockWorkloadAPIServer: vsockWorkloadAPIServer,
+		listenVsock:            c.listenVsock,
 	}
 }
 
 func (e *Endpoints) ListenAndServe(ctx context.Context) error {
+	tasks := []func(context.Context) error{e.serveWorkloadAPI}
+	if e.bundleAddr != nil {
+		tasks = append(tasks, e.serveBundle)
+	}
+	if e.vsockPort != 0 {
+		tasks = append(tasks, e.serveVsockWorkloadAPI)
+	}
+	if len(tasks) == 1 {
+		return e.serveWorkloadAPI(ctx)
+	}
+	return util.RunTasks(ctx, tasks...)
+}
+
+// newGRPCServer returns a gRPC server with the middleware of the endpoints,
+// authenticating the callers with the given credentials
+func (e *Endpoints) newGRPCServer(creds credentials.TransportCredentials) *grpc.Server {
 	unaryInterceptor, streamInterceptor := middleware.Interceptors(
 		Middleware(e.log, e.metrics),
 	)
 
-	server := grpc.NewServer(
-		grpc.Creds(peertracker.NewCredentials()),
+	return grpc.NewServer(
+		grpc.Creds(creds),
 		grpc.UnaryInterceptor(unaryInterceptor),
 		grpc.StreamInterceptor(streamInterceptor),
 	)
+}
+
+func (e *Endpoints) serveWorkloadAPI(ctx context.Context) error {
+	server := e.newGRPCServer(peertracker.NewCredentials())
 
 	workload_pb.RegisterSpiffeWorkloadAPIServer(server, e.workloadAPIServer)
 	discovery_v2.RegisterSecretDiscoveryServiceServer(server, e.sdsv2Server)
 	secret_v3.RegisterSecretDiscoveryServiceServer(server, e.sdsv3Server)
 	grpc_health_v1.RegisterHealthServer(server, e.healthServer)
 
-	l, err := e.createUDSListener()
+	l, err := e.createUDSListener(e.addr)
 	if err != nil {
 		return err
 	}
 	defer l.Close()
 
 	e.log.Info("Starting Workload and SDS APIs")
+	return e.serveGRPC(ctx, server, l, "Stopping Workload and SDS APIs")
+}
+
+// serveGRPC serves the gRPC server on the listener until the context is done
+func (e *Endpoints) serveGRPC(ctx context.Context, server *grpc.Server, l net.Listener, stopMessage string) error {
 	errChan := make(chan error)
 	go func() { errChan <- server.Serve(l) }()
 
+	var err error
 	select {
 	case err = <-errChan:
 	case <-ctx.Done():
-		e.log.Info("Stopping Workload and SDS APIs")
+		e.log.Info(stopMessage)
 		server.Stop()
 		err = <-errChan
 		if errors.Is(err, grpc.ErrServerStopped) {
@@ -141,21 +216,74 @@ func (e *Endpoints) ListenAndServe(ctx context.Context) error {
 	return err
 }
 
-func (e *Endpoints) createUDSListener() (net.Listener, error) {
+// serveBundle serves the trust bundles over HTTP. Callers are attested like
+// the Workload API callers, through the peer tracker of the listener.
+func (e *Endpoints) serveBundle(ctx context.Context) error {
+	l, err := e.createUDSListener(e.bundleAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	server := &http.Server{
+		Handler: e.bundleHandler,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			// Expose the caller the way the gRPC peer tracker credentials
+			// do, for the attestor
+			if trackedConn, ok := conn.(*peertracker.Conn); ok {
+				return peer.NewContext(ctx, &peer.Peer{
+					Addr:     conn.RemoteAddr(),
+					AuthInfo: trackedConn.Info,
+				})
+			}
+			return ctx
+		},
+	}
+
+	e.log.WithField(telemetry.Path, e.bundleAddr.String()).Info("Starting bundle endpoint")
+	errChan := make(chan error, 1)
+	go func() { errChan <- server.Serve(l) }()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		e.log.Info("Stopping bundle endpoint")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+		if err := <-errChan; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+func (e *Endpoints) createUDSListener(addr *net.UnixAddr) (net.Listener, error) {
+	// A socket passed by systemd socket activation is managed by systemd
+	socketActivated := systemd.IsSocketActivated(addr)
+
 	// Remove uds if already exists
-	os.Remove(e.addr.String())
+	if !socketActivated {
+		os.Remove(addr.String())
+	}
 
 	unixListener := &peertracker.ListenerFactory{
-		Log: e.log,
+		Log:             e.log,
+		NewUnixListener: systemd.ListenUnix,
 	}
 
-	l, err := unixListener.ListenUnix(e.addr.Network(), e.addr)
+	l, err := unixListener.ListenUnix(addr.Network(), addr)
 	if err != nil {
 		return nil, fmt.Errorf("create UDS listener: %w", err)
 	}
 
-	if err := os.Chmod(e.addr.String(), os.ModePerm); err != nil {
-		return nil, fmt.Errorf("unable to change UDS permissions: %w", err)
+	if !socketActivated {
+		if err := os.Chmod(addr.String(), os.ModePerm); err != nil {
+			return nil, fmt.Errorf("unable to change UDS permissions: %w", err)
+		}
 	}
 	return l, nil
 }
@@ -3,7 +3,9 @@ package endpoints
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
@@ -19,11 +21,13 @@ import (
 	workload_pb "github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
 	healthv1 "github.com/spiffe/spire/pkg/agent/api/health/v1"
 	"github.com/spiffe/spire/pkg/agent/api/rpccontext"
+	"github.com/spiffe/spire/pkg/agent/endpoints/bundle"
 	"github.com/spiffe/spire/pkg/agent/endpoints/sdsv2"
 	"github.com/spiffe/spire/pkg/agent/endpoints/sdsv3"
 	"github.com/spiffe/spire/pkg/agent/endpoints/workload"
 	"github.com/spiffe/spire/pkg/agent/manager"
 	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/common/vsock"
 	"github.com/spiffe/spire/test/fakes/fakemetrics"
 	"github.com/spiffe/spire/test/spiretest"
 	"github.com/stretchr/testify/assert"
@@ -250,6 +254,188 @@ func TestEndpoints(t *testing.T) {
 	}
 }
 
+func TestBundleEndpoint(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := spiretest.TempDir(t)
+	udsPath := filepath.Join(dir, "agent.sock")
+	bundlePath := filepath.Join(dir, "bundle.sock")
+
+	log, hook := test.NewNullLogger()
+	endpoints := New(Config{
+		BindAddr:       &net.UnixAddr{Net: "unix", Name: udsPath},
+		BundleBindAddr: &net.UnixAddr{Net: "unix", Name: bundlePath},
+		Log:            log,
+		Metrics:        fakemetrics.New(),
+		Attestor:       FakeAttestor{},
+		Manager:        FakeManager{},
+
+		// Assert the provided config and return a fake bundle handler that
+		// reports the selectors of the caller
+		newBundleHandler: func(c bundle.Config) http.Handler {
+			attestor, ok := c.Attestor.(peerTrackerAttestor)
+			require.True(t, ok, "attestor was not a peerTrackerAttestor wrapper")
+			assert.Equal(t, FakeManager{}, c.Manager)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				selectors, err := attestor.Attest(r.Context())
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				for _, selector := range selectors {
+					fmt.Fprintf(w, "%s:%s\n", selector.Type, selector.Value)
+				}
+			})
+		},
+	})
+
+	ctx, cancel = context.WithCancel(ctx)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- endpoints.ListenAndServe(ctx)
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", bundlePath)
+			},
+		},
+	}
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		var err error
+		resp, err = client.Get("http://localhost/bundle")
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Type:Value\n", string(body))
+
+	cancel()
+	assert.NoError(t, <-errCh)
+	// The endpoints are served concurrently
+	spiretest.AssertLogsAnyOrder(t, hook.AllEntries(), []spiretest.LogEntry{
+		{Level: logrus.InfoLevel, Message: "Starting Workload and SDS APIs"},
+		{Level: logrus.InfoLevel, Message: "Starting bundle endpoint", Data: logrus.Fields{telemetry.Path: bundlePath}},
+		{Level: logrus.InfoLevel, Message: "Stopping Workload and SDS APIs"},
+		{Level: logrus.InfoLevel, Message: "Stopping bundle endpoint"},
+	})
+}
+
+func TestVsockWorkloadAPI(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	udsPath := filepath.Join(spiretest.TempDir(t), "agent.sock")
+
+	// The vsock connections are emulated over TCP, from the VM with CID 3
+	tcpListener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	log, hook := test.NewNullLogger()
+	endpoints := New(Config{
+		BindAddr:  &net.UnixAddr{Net: "unix", Name: udsPath},
+		VsockPort: 10000,
+		Log:       log,
+		Metrics:   fakemetrics.New(),
+		Attestor:  FakeAttestor{},
+		Manager:   FakeManager{},
+
+		// Return a fake Workload API server reporting the selectors of the
+		// caller for the vsock listener
+		newWorkloadAPIServer: func(c workload.Config) workload_pb.SpiffeWorkloadAPIServer {
+			assert.Equal(t, FakeManager{}, c.Manager)
+			if attestor, ok := c.Attestor.(vsockAttestor); ok {
+				return FakeVsockWorkloadAPIServer{Attestor: attestor}
+			}
+			attestor, ok := c.Attestor.(peerTrackerAttestor)
+			require.True(t, ok, "attestor was not a peerTrackerAttestor wrapper")
+			return FakeWorkloadAPIServer{Attestor: attestor}
+		},
+
+		listenVsock: func(port uint32) (net.Listener, error) {
+			assert.Equal(t, uint32(10000), port)
+			return fakeVsockListener{Listener: tcpListener, contextID: 3}, nil
+		},
+	})
+
+	ctx, cancel = context.WithCancel(ctx)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- endpoints.ListenAndServe(ctx)
+	}()
+
+	conn, err := grpc.DialContext(ctx, tcpListener.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := workload_pb.NewSpiffeWorkloadAPIClient(conn)
+	resp, err := client.FetchJWTSVID(metadata.AppendToOutgoingContext(ctx, "workload.spiffe.io", "true"), &workload_pb.JWTSVIDRequest{}, grpc.WaitForReady(true))
+	require.NoError(t, err)
+	require.Len(t, resp.Svids, 1)
+	assert.Equal(t, "vsock:cid:3", resp.Svids[0].SpiffeId)
+
+	cancel()
+	assert.NoError(t, <-errCh)
+	// The endpoints are served concurrently
+	spiretest.AssertLogsAnyOrder(t, hook.AllEntries(), []spiretest.LogEntry{
+		{Level: logrus.InfoLevel, Message: "Starting Workload and SDS APIs"},
+		{Level: logrus.InfoLevel, Message: "Starting Workload API over vsock", Data: logrus.Fields{telemetry.Address: tcpListener.Addr().String()}},
+		{Level: logrus.InfoLevel, Message: "Stopping Workload and SDS APIs"},
+		{Level: logrus.InfoLevel, Message: "Stopping Workload API over vsock"},
+	})
+}
+
+func TestVsockAttestor(t *testing.T) {
+	_, err := vsockAttestor{}.Attest(context.Background())
+	spiretest.RequireGRPCStatus(t, err, codes.Internal, "vsock caller missing from context")
+}
+
+type fakeVsockListener struct {
+	net.Listener
+	contextID uint32
+}
+
+func (l fakeVsockListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return fakeVsockConn{Conn: conn, remote: &vsock.Addr{ContextID: l.contextID, Port: 1024}}, nil
+}
+
+type fakeVsockConn struct {
+	net.Conn
+	remote *vsock.Addr
+}
+
+func (c fakeVsockConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type FakeVsockWorkloadAPIServer struct {
+	Attestor vsockAttestor
+	*workload_pb.UnimplementedSpiffeWorkloadAPIServer
+}
+
+func (s FakeVsockWorkloadAPIServer) FetchJWTSVID(ctx context.Context, in *workload_pb.JWTSVIDRequest) (*workload_pb.JWTSVIDResponse, error) {
+	selectors, err := s.Attestor.Attest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := new(workload_pb.JWTSVIDResponse)
+	for _, selector := range selectors {
+		resp.Svids = append(resp.Svids, &workload_pb.JWTSVID{SpiffeId: selector.Type + ":" + selector.Value})
+	}
+	return resp, nil
+}
+
 type FakeManager struct {
 	manager.Manager
 }
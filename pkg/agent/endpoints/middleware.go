@@ -9,6 +9,7 @@ import (
 	"github.com/spiffe/spire/pkg/common/api/middleware"
 	"github.com/spiffe/spire/pkg/common/peertracker"
 	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/common/vsock"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -24,6 +25,7 @@ func Middleware(log logrus.FieldLogger, metrics telemetry.Metrics) middleware.Mi
 		middleware.WithMetrics(metrics),
 		withPerServiceConnectionMetrics(metrics),
 		middleware.Preprocess(addWatcherPID),
+		middleware.Preprocess(addVsockCaller),
 		middleware.Preprocess(verifySecurityHeader),
 	)
 }
@@ -38,6 +40,14 @@ func addWatcherPID(ctx context.Context, fullMethod string, req interface{}) (con
 	return ctx, nil
 }
 
+func addVsockCaller(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+	caller, ok := vsock.CallerFromContext(ctx)
+	if ok {
+		ctx = rpccontext.WithLogger(ctx, rpccontext.Logger(ctx).WithField(telemetry.Address, caller.String()))
+	}
+	return ctx, nil
+}
+
 func verifySecurityHeader(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
 	if isWorkloadAPIMethod(fullMethod) && !hasSecurityHeader(ctx) {
 		return nil, status.Error(codes.InvalidArgument, "security header missing from request")
@@ -0,0 +1,133 @@
+package endpoints
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/pkg/agent/manager"
+	"github.com/spiffe/spire/pkg/agent/manager/cache"
+	"github.com/spiffe/spire/pkg/agent/quarantine"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/proto/spire/common"
+)
+
+// quarantineManager withholds the identities from the workloads quarantined
+// on the agent, regardless of the registration entries they match. Bundles
+// are still served.
+type quarantineManager struct {
+	manager.Manager
+	quarantine *quarantine.Quarantine
+	log        logrus.FieldLogger
+}
+
+func newQuarantineManager(m manager.Manager, q *quarantine.Quarantine, log logrus.FieldLogger) *quarantineManager {
+	return &quarantineManager{
+		Manager:    m,
+		quarantine: q,
+		log:        log,
+	}
+}
+
+func (m *quarantineManager) MatchingIdentities(selectors []*common.Selector) []cache.Identity {
+	if m.isQuarantined(selectors) {
+		return nil
+	}
+	return m.Manager.MatchingIdentities(selectors)
+}
+
+func (m *quarantineManager) FetchWorkloadUpdate(selectors []*common.Selector) *cache.WorkloadUpdate {
+	return m.filterUpdate(selectors, m.Manager.FetchWorkloadUpdate(selectors))
+}
+
+func (m *quarantineManager) SubscribeToCacheChanges(selectors cache.Selectors) cache.Subscriber {
+	sub := &quarantineSubscriber{
+		m:         m,
+		selectors: selectors,
+		// Grab the notification channel before subscribing so rule changes
+		// made in between are not missed
+		changed: m.quarantine.Changed(),
+		sub:     m.Manager.SubscribeToCacheChanges(selectors),
+		c:       make(chan *cache.WorkloadUpdate, 1),
+		done:    make(chan struct{}),
+	}
+	go sub.run()
+	return sub
+}
+
+func (m *quarantineManager) filterUpdate(selectors []*common.Selector, update *cache.WorkloadUpdate) *cache.WorkloadUpdate {
+	if update == nil || !update.HasIdentity() || !m.isQuarantined(selectors) {
+		return update
+	}
+	return &cache.WorkloadUpdate{
+		Bundle:           update.Bundle,
+		FederatedBundles: update.FederatedBundles,
+	}
+}
+
+func (m *quarantineManager) isQuarantined(selectors []*common.Selector) bool {
+	rule := m.quarantine.Match(selectors)
+	if rule == nil {
+		return false
+	}
+	m.log.WithFields(logrus.Fields{
+		telemetry.QuarantineRuleID: rule.ID,
+		telemetry.Selectors:        rule.Selectors,
+	}).Warn("Withholding SVIDs from quarantined workload")
+	return true
+}
+
+// quarantineSubscriber relays the updates of the underlying subscriber with
+// the identities of quarantined workloads filtered out. The last update is
+// relayed again every time the quarantine rules change, so the workloads
+// streaming updates are cut off, or served again, right away.
+type quarantineSubscriber struct {
+	m         *quarantineManager
+	selectors []*common.Selector
+	changed   <-chan struct{}
+	sub       cache.Subscriber
+
+	c        chan *cache.WorkloadUpdate
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+func (s *quarantineSubscriber) Updates() <-chan *cache.WorkloadUpdate {
+	return s.c
+}
+
+func (s *quarantineSubscriber) Finish() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+	s.sub.Finish()
+}
+
+func (s *quarantineSubscriber) run() {
+	defer close(s.c)
+
+	var last *cache.WorkloadUpdate
+	for {
+		select {
+		case update, ok := <-s.sub.Updates():
+			if !ok {
+				return
+			}
+			last = update
+		case <-s.changed:
+			s.changed = s.m.quarantine.Changed()
+			if last == nil {
+				continue
+			}
+		case <-s.done:
+			return
+		}
+
+		// Only the latest update matters, so replace the pending one, if
+		// any, as the cache subscribers do
+		select {
+		case <-s.c:
+		default:
+		}
+		s.c <- s.m.filterUpdate(s.selectors, last)
+	}
+}
@@ -0,0 +1,161 @@
+package endpoints
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/agent/manager"
+	"github.com/spiffe/spire/pkg/agent/manager/cache"
+	"github.com/spiffe/spire/pkg/agent/quarantine"
+	"github.com/spiffe/spire/pkg/common/bundleutil"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/spiffe/spire/test/clock"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	quarantinedSelectors = []*common.Selector{{Type: "k8s", Value: "container-image:evil"}, {Type: "k8s", Value: "ns:prod"}}
+	healthySelectors     = []*common.Selector{{Type: "k8s", Value: "container-image:good"}, {Type: "k8s", Value: "ns:prod"}}
+)
+
+func TestQuarantineManager(t *testing.T) {
+	m, q, hook := setupQuarantineManager(t)
+
+	assert.Len(t, m.MatchingIdentities(quarantinedSelectors), 1)
+	assert.True(t, m.FetchWorkloadUpdate(quarantinedSelectors).HasIdentity())
+
+	rule, err := q.Add([]*common.Selector{{Type: "k8s", Value: "container-image:evil"}}, time.Hour, "")
+	require.NoError(t, err)
+	hook.Reset()
+
+	assert.Empty(t, m.MatchingIdentities(quarantinedSelectors))
+	update := m.FetchWorkloadUpdate(quarantinedSelectors)
+	assert.False(t, update.HasIdentity())
+	assert.NotNil(t, update.Bundle, "bundles should still be served")
+
+	spiretest.AssertLogs(t, hook.AllEntries(), []spiretest.LogEntry{
+		{
+			Level:   logrus.WarnLevel,
+			Message: "Withholding SVIDs from quarantined workload",
+			Data: logrus.Fields{
+				telemetry.QuarantineRuleID: rule.ID,
+				telemetry.Selectors:        "[k8s:container-image:evil]",
+			},
+		},
+		{
+			Level:   logrus.WarnLevel,
+			Message: "Withholding SVIDs from quarantined workload",
+			Data: logrus.Fields{
+				telemetry.QuarantineRuleID: rule.ID,
+				telemetry.Selectors:        "[k8s:container-image:evil]",
+			},
+		},
+	})
+
+	// Other workloads are unaffected
+	assert.Len(t, m.MatchingIdentities(healthySelectors), 1)
+	assert.True(t, m.FetchWorkloadUpdate(healthySelectors).HasIdentity())
+
+	// Lifting the quarantine serves the identities again
+	require.True(t, q.Remove(rule.ID))
+	assert.Len(t, m.MatchingIdentities(quarantinedSelectors), 1)
+}
+
+func TestQuarantineSubscriber(t *testing.T) {
+	m, q, _ := setupQuarantineManager(t)
+	fake := m.Manager.(*fakeQuarantineManager)
+
+	sub := m.SubscribeToCacheChanges(quarantinedSelectors)
+	fake.sub.c <- fake.update()
+	assert.True(t, recvUpdate(t, sub).HasIdentity())
+
+	// Quarantining the workload re-emits the last update without identities
+	rule, err := q.Add([]*common.Selector{{Type: "k8s", Value: "container-image:evil"}}, time.Hour, "")
+	require.NoError(t, err)
+	assert.False(t, recvUpdate(t, sub).HasIdentity())
+
+	// Updates from the cache are filtered while quarantined
+	fake.sub.c <- fake.update()
+	update := recvUpdate(t, sub)
+	assert.False(t, update.HasIdentity())
+	assert.NotNil(t, update.Bundle)
+
+	// Lifting the quarantine re-emits the last update with identities
+	require.True(t, q.Remove(rule.ID))
+	assert.True(t, recvUpdate(t, sub).HasIdentity())
+
+	sub.Finish()
+	assert.True(t, fake.sub.finished)
+	select {
+	case _, ok := <-sub.Updates():
+		assert.False(t, ok, "updates channel should be closed")
+	case <-time.After(time.Minute):
+		require.FailNow(t, "timed out waiting for updates channel to close")
+	}
+}
+
+func setupQuarantineManager(t *testing.T) (*quarantineManager, *quarantine.Quarantine, *test.Hook) {
+	log, hook := test.NewNullLogger()
+	q := quarantine.New(quarantine.Config{
+		Log:   log,
+		Clock: clock.NewMock(t),
+	})
+	fake := &fakeQuarantineManager{
+		sub: &fakeSubscriber{c: make(chan *cache.WorkloadUpdate, 1)},
+	}
+	return newQuarantineManager(fake, q, log), q, hook
+}
+
+func recvUpdate(t *testing.T, sub cache.Subscriber) *cache.WorkloadUpdate {
+	select {
+	case update := <-sub.Updates():
+		require.NotNil(t, update)
+		return update
+	case <-time.After(time.Minute):
+		require.FailNow(t, "timed out waiting for update")
+		return nil
+	}
+}
+
+type fakeQuarantineManager struct {
+	manager.Manager
+	sub *fakeSubscriber
+}
+
+func (m *fakeQuarantineManager) update() *cache.WorkloadUpdate {
+	return &cache.WorkloadUpdate{
+		Identities: []cache.Identity{{Entry: &common.RegistrationEntry{SpiffeId: "spiffe://example.org/workload"}}},
+		Bundle:     bundleutil.New(spiffeid.RequireTrustDomainFromString("example.org")),
+	}
+}
+
+func (m *fakeQuarantineManager) MatchingIdentities([]*common.Selector) []cache.Identity {
+	return m.update().Identities
+}
+
+func (m *fakeQuarantineManager) FetchWorkloadUpdate([]*common.Selector) *cache.WorkloadUpdate {
+	return m.update()
+}
+
+func (m *fakeQuarantineManager) SubscribeToCacheChanges(cache.Selectors) cache.Subscriber {
+	return m.sub
+}
+
+type fakeSubscriber struct {
+	c        chan *cache.WorkloadUpdate
+	finished bool
+}
+
+func (s *fakeSubscriber) Updates() <-chan *cache.WorkloadUpdate {
+	return s.c
+}
+
+func (s *fakeSubscriber) Finish() {
+	s.finished = true
+}
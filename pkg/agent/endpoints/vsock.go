@@ -0,0 +1,49 @@
+package endpoints
+
+import (
+	"context"
+	"fmt"
+
+	workload_pb "github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/common/vsock"
+	"github.com/spiffe/spire/proto/spire/common"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// VsockSelectorType is the type of the selectors of the workloads calling the
+// Workload API over vsock. Their value is cid:<CID>, the context ID of the
+// VM of the workload.
+const VsockSelectorType = "vsock"
+
+// vsockAttestor attests the Workload API callers connecting over vsock. The
+// processes of a VM are not visible from the node, so the callers are
+// identified by their VM, through the context ID the hypervisor assigned it.
+type vsockAttestor struct{}
+
+func (vsockAttestor) Attest(ctx context.Context) ([]*common.Selector, error) {
+	caller, ok := vsock.CallerFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Internal, "vsock caller missing from context")
+	}
+	return []*common.Selector{
+		{Type: VsockSelectorType, Value: fmt.Sprintf("cid:%d", caller.ContextID)},
+	}, nil
+}
+
+// serveVsockWorkloadAPI serves the Workload API over vsock, for the workloads
+// running in VMs on the node
+func (e *Endpoints) serveVsockWorkloadAPI(ctx context.Context) error {
+	server := e.newGRPCServer(vsock.NewCredentials())
+	workload_pb.RegisterSpiffeWorkloadAPIServer(server, e.vsockWorkloadAPIServer)
+
+	l, err := e.listenVsock(e.vsockPort)
+	if err != nil {
+		return fmt.Errorf("create vsock listener: %w", err)
+	}
+	defer l.Close()
+
+	e.log.WithField(telemetry.Address, l.Addr().String()).Info("Starting Workload API over vsock")
+	return e.serveGRPC(ctx, server, l, "Stopping Workload API over vsock")
+}
@@ -23,11 +23,18 @@ import (
 	"github.com/spiffe/spire/proto/spire/common"
 	"github.com/zeebo/errs"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// SPIFFEIDFilterKey is the gRPC metadata key FetchX509SVID callers can set,
+// once per SPIFFE ID, to only be streamed the X509-SVIDs for those SPIFFE IDs.
+// Updates that don't change the streamed response are then not sent.
+const SPIFFEIDFilterKey = "spiffe-id"
+
 type Manager interface {
 	SubscribeToCacheChanges(cache.Selectors) cache.Subscriber
 	MatchingIdentities([]*common.Selector) []cache.Identity
@@ -46,6 +53,9 @@ type Config struct {
 	AllowUnauthenticatedVerifiers bool
 	AllowedForeignJWTClaims       map[string]struct{}
 	TrustDomain                   spiffeid.TrustDomain
+
+	// ClockSkewTolerance is the leeway JWT-SVIDs are validated with
+	ClockSkewTolerance time.Duration
 }
 
 type Handler struct {
@@ -174,7 +184,7 @@ func (h *Handler) ValidateJWTSVID(ctx context.Context, req *workload.ValidateJWT
 
 	keyStore := keyStoreFromBundles(h.getWorkloadBundles(selectors))
 
-	spiffeID, claims, err := jwtsvid.ValidateToken(ctx, req.Svid, keyStore, []string{req.Audience})
+	spiffeID, claims, err := jwtsvid.ValidateTokenWithLeeway(ctx, req.Svid, keyStore, []string{req.Audience}, h.c.ClockSkewTolerance)
 	if err != nil {
 		log.WithError(err).Warn("Failed to validate JWT")
 		return nil, status.Error(codes.InvalidArgument, err.Error())
@@ -217,6 +227,12 @@ func (h *Handler) FetchX509SVID(_ *workload.X509SVIDRequest, stream workload.Spi
 	// if it is not the agent itself.
 	quietLogging := rpccontext.CallerPID(ctx) == os.Getpid()
 
+	filter, err := spiffeIDFilter(ctx)
+	if err != nil {
+		log.WithError(err).Error("Invalid SPIFFE ID filter")
+		return err
+	}
+
 	selectors, err := h.c.Attestor.Attest(ctx)
 	if err != nil {
 		log.WithError(err).Error("Workload attestation failed")
@@ -226,18 +242,59 @@ func (h *Handler) FetchX509SVID(_ *workload.X509SVIDRequest, stream workload.Spi
 	subscriber := h.c.Manager.SubscribeToCacheChanges(selectors)
 	defer subscriber.Finish()
 
+	var previous *workload.X509SVIDResponse
 	for {
 		select {
 		case update := <-subscriber.Updates():
-			if err := sendX509SVIDResponse(update, stream, log, quietLogging); err != nil {
+			if filter != nil {
+				update = filterIdentities(update, filter)
+			}
+			resp, err := sendX509SVIDResponse(update, stream, log, quietLogging, previous)
+			if err != nil {
 				return err
 			}
+			if filter != nil {
+				previous = resp
+			}
 		case <-ctx.Done():
 			return nil
 		}
 	}
 }
 
+// spiffeIDFilter returns the SPIFFE IDs set by the caller with the
+// SPIFFEIDFilterKey metadata key, if any
+func spiffeIDFilter(ctx context.Context) (map[string]bool, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(SPIFFEIDFilterKey)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	filter := make(map[string]bool, len(values))
+	for _, value := range values {
+		id, err := spiffeid.FromString(value)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid %s metadata %q: %v", SPIFFEIDFilterKey, value, err)
+		}
+		filter[id.String()] = true
+	}
+	return filter, nil
+}
+
+// filterIdentities returns a copy of the update with only the identities
+// for the SPIFFE IDs of the filter
+func filterIdentities(update *cache.WorkloadUpdate, filter map[string]bool) *cache.WorkloadUpdate {
+	filtered := *update
+	filtered.Identities = nil
+	for _, identity := range update.Identities {
+		if filter[identity.Entry.SpiffeId] {
+			filtered.Identities = append(filtered.Identities, identity)
+		}
+	}
+	return &filtered
+}
+
 // FetchX509Bundles processes request for x509 bundles
 func (h *Handler) FetchX509Bundles(_ *workload.X509BundlesRequest, stream workload.SpiffeWorkloadAPI_FetchX509BundlesServer) error {
 	ctx := stream.Context()
@@ -305,12 +362,14 @@ func composeX509BundlesResponse(update *cache.WorkloadUpdate) (*workload.X509Bun
 	}, nil
 }
 
-func sendX509SVIDResponse(update *cache.WorkloadUpdate, stream workload.SpiffeWorkloadAPI_FetchX509SVIDServer, log logrus.FieldLogger, quietLogging bool) (err error) {
+// sendX509SVIDResponse sends the response for the update, unless it is equal
+// to the previous response, and returns the response
+func sendX509SVIDResponse(update *cache.WorkloadUpdate, stream workload.SpiffeWorkloadAPI_FetchX509SVIDServer, log logrus.FieldLogger, quietLogging bool, previous *workload.X509SVIDResponse) (*workload.X509SVIDResponse, error) {
 	if len(update.Identities) == 0 {
 		if !quietLogging {
 			log.WithField(telemetry.Registered, false).Error("No identity issued")
 		}
-		return status.Error(codes.PermissionDenied, "no identity issued")
+		return nil, status.Error(codes.PermissionDenied, "no identity issued")
 	}
 
 	log = log.WithField(telemetry.Registered, true)
@@ -318,12 +377,16 @@ func sendX509SVIDResponse(update *cache.WorkloadUpdate, stream workload.SpiffeWo
 	resp, err := composeX509SVIDResponse(update)
 	if err != nil {
 		log.WithError(err).Error("Could not serialize X.509 SVID response")
-		return status.Errorf(codes.Unavailable, "could not serialize response: %v", err)
+		return nil, status.Errorf(codes.Unavailable, "could not serialize response: %v", err)
+	}
+
+	if previous != nil && proto.Equal(resp, previous) {
+		return previous, nil
 	}
 
 	if err := stream.Send(resp); err != nil {
 		log.WithError(err).Error("Failed to send X.509 SVID response")
-		return err
+		return nil, err
 	}
 
 	log = log.WithField(telemetry.Count, len(resp.Svids))
@@ -341,7 +404,7 @@ func sendX509SVIDResponse(update *cache.WorkloadUpdate, stream workload.SpiffeWo
 		}
 	}
 
-	return nil
+	return resp, nil
 }
 
 func composeX509SVIDResponse(update *cache.WorkloadUpdate) (*workload.X509SVIDResponse, error) {
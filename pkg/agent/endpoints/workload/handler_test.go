@@ -33,6 +33,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
@@ -178,6 +179,85 @@ func TestFetchX509SVID(t *testing.T) {
 	}
 }
 
+func TestFetchX509SVIDWithSPIFFEIDFilter(t *testing.T) {
+	ca := testca.New(t, td)
+
+	x509SVID1 := ca.CreateX509SVID(td.NewID("/one"))
+	x509SVID2 := ca.CreateX509SVID(td.NewID("/two"))
+	rotatedX509SVID1 := ca.CreateX509SVID(td.NewID("/one"))
+	rotatedX509SVID2 := ca.CreateX509SVID(td.NewID("/two"))
+	bundle := utilBundleFromBundle(t, ca.Bundle())
+
+	expectResp := func(svid *x509svid.SVID) *workloadPB.X509SVIDResponse {
+		return &workloadPB.X509SVIDResponse{
+			Svids: []*workloadPB.X509SVID{
+				{
+					SpiffeId:    svid.ID.String(),
+					X509Svid:    x509util.DERFromCertificates(svid.Certificates),
+					X509SvidKey: pkcs8FromSigner(t, svid.PrivateKey),
+					Bundle:      x509util.DERFromCertificates(ca.Bundle().X509Authorities()),
+				},
+			},
+		}
+	}
+
+	params := testParams{
+		CA: ca,
+		Updates: []*cache.WorkloadUpdate{
+			{
+				Identities: []cache.Identity{identityFromX509SVID(x509SVID1), identityFromX509SVID(x509SVID2)},
+				Bundle:     bundle,
+			},
+			{
+				// Only the identity not requested is rotated, nothing is sent
+				Identities: []cache.Identity{identityFromX509SVID(x509SVID1), identityFromX509SVID(rotatedX509SVID2)},
+				Bundle:     bundle,
+			},
+			{
+				Identities: []cache.Identity{identityFromX509SVID(rotatedX509SVID1), identityFromX509SVID(rotatedX509SVID2)},
+				Bundle:     bundle,
+			},
+		},
+	}
+	runTest(t, params,
+		func(ctx context.Context, client workloadPB.SpiffeWorkloadAPIClient) {
+			ctx = metadata.AppendToOutgoingContext(ctx, workload.SPIFFEIDFilterKey, x509SVID1.ID.String())
+			stream, err := client.FetchX509SVID(ctx, &workloadPB.X509SVIDRequest{})
+			require.NoError(t, err)
+
+			resp, err := stream.Recv()
+			require.NoError(t, err)
+			spiretest.RequireProtoEqual(t, expectResp(x509SVID1), resp)
+
+			resp, err = stream.Recv()
+			require.NoError(t, err)
+			spiretest.RequireProtoEqual(t, expectResp(rotatedX509SVID1), resp)
+		})
+
+	runTest(t, testParams{
+		CA: ca,
+		ExpectLogs: []spiretest.LogEntry{
+			{
+				Level:   logrus.ErrorLevel,
+				Message: "Invalid SPIFFE ID filter",
+				Data: logrus.Fields{
+					"service":       "WorkloadAPI",
+					"method":        "FetchX509SVID",
+					logrus.ErrorKey: `rpc error: code = InvalidArgument desc = invalid spiffe-id metadata "one": spiffeid: invalid scheme`,
+				},
+			},
+		},
+	},
+		func(ctx context.Context, client workloadPB.SpiffeWorkloadAPIClient) {
+			ctx = metadata.AppendToOutgoingContext(ctx, workload.SPIFFEIDFilterKey, "one")
+			stream, err := client.FetchX509SVID(ctx, &workloadPB.X509SVIDRequest{})
+			require.NoError(t, err)
+
+			_, err = stream.Recv()
+			spiretest.RequireGRPCStatusContains(t, err, codes.InvalidArgument, "invalid spiffe-id metadata")
+		})
+}
+
 func TestFetchX509Bundles(t *testing.T) {
 	ca := testca.New(t, td)
 	x509SVID := ca.CreateX509SVID(td.NewID("/workload"))
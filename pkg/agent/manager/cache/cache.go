@@ -381,6 +381,21 @@ func (c *Cache) UpdateEntries(update *UpdateEntries, checkSVID func(*common.Regi
 	}
 }
 
+// RemoveEntries removes all the registration entries, and their SVIDs, from
+// the cache, keeping the bundles, and notifies the subscribers of the
+// identities removed. It is used once the agent is no longer authorized to
+// serve identities, e.g. after being banned.
+func (c *Cache) RemoveEntries() {
+	c.mu.RLock()
+	bundles := make(map[spiffeid.TrustDomain]*bundleutil.Bundle, len(c.bundles))
+	for id, bundle := range c.bundles {
+		bundles[id] = bundle
+	}
+	c.mu.RUnlock()
+
+	c.UpdateEntries(&UpdateEntries{Bundles: bundles}, nil)
+}
+
 func (c *Cache) UpdateSVIDs(update *UpdateSVIDs) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
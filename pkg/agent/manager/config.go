@@ -2,6 +2,7 @@ package manager
 
 import (
 	"crypto/x509"
+	"net/url"
 	"sync"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/spiffe/spire/pkg/agent/manager/cache"
 	"github.com/spiffe/spire/pkg/agent/plugin/keymanager"
 	"github.com/spiffe/spire/pkg/agent/svid"
+	"github.com/spiffe/spire/pkg/common/clockskew"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 )
 
@@ -26,11 +28,40 @@ type Config struct {
 	Log              logrus.FieldLogger
 	Metrics          telemetry.Metrics
 	ServerAddr       string
+	ProxyURL         *url.URL
 	SVIDCachePath    string
 	BundleCachePath  string
 	SyncInterval     time.Duration
 	RotationInterval time.Duration
 
+	// X509AuthoritiesOnly makes the manager sync only the X.509 authorities
+	// of the bundles
+	X509AuthoritiesOnly bool
+
+	// CompressSync makes the manager compress the sync payloads
+	CompressSync bool
+
+	// DeltaSync makes the manager sync only what changed since the last sync
+	DeltaSync bool
+
+	// ClockSkew, if set, is given the skew of the clock of the server
+	// measured when synchronizing
+	ClockSkew *clockskew.Monitor
+
+	// SyncKickInterval, if set, makes the manager synchronize ahead of
+	// schedule when a workload it has no identity for asks for its SVIDs,
+	// at most once per interval. Workloads registered right before they
+	// start, e.g. pods registered as they are scheduled, then get their
+	// SVIDs without waiting for the next synchronization.
+	SyncKickInterval time.Duration
+
+	// Ephemeral makes the manager synchronize every second for the first
+	// minute, so that the workloads of short-lived nodes get their SVIDs
+	// quickly, and delete the agent from the server when it stops, so that
+	// such nodes don't leave agent records behind. The SVID and bundle
+	// cache paths are expected to be empty.
+	Ephemeral bool
+
 	// Clk is the clock the manager will use to get time
 	Clk clock.Clock
 }
@@ -63,9 +94,15 @@ func newManager(c *Config) *manager {
 		SVIDKey:      c.SVIDKey,
 		BundleStream: cache.SubscribeToBundleChanges(),
 		ServerAddr:   c.ServerAddr,
+		ProxyURL:     c.ProxyURL,
 		TrustDomain:  c.TrustDomain,
 		Interval:     c.RotationInterval,
 		Clk:          c.Clk,
+
+		X509AuthoritiesOnly: c.X509AuthoritiesOnly,
+		CompressSync:        c.CompressSync,
+		DeltaSync:           c.DeltaSync,
+		ClockSkew:           c.ClockSkew,
 	}
 	svidRotator, client := svid.NewRotator(rotCfg)
 
@@ -78,6 +115,7 @@ func newManager(c *Config) *manager {
 		bundleCachePath: c.BundleCachePath,
 		client:          client,
 		clk:             c.Clk,
+		syncKicks:       make(chan struct{}, 1),
 	}
 
 	return m
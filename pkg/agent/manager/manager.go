@@ -11,6 +11,7 @@ import (
 	"github.com/andres-erbsen/clock"
 	observer "github.com/imkira/go-observer"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
 	"github.com/spiffe/spire/pkg/agent/client"
 	"github.com/spiffe/spire/pkg/agent/common/backoff"
 	"github.com/spiffe/spire/pkg/agent/manager/cache"
@@ -28,6 +29,17 @@ var (
 	ErrNotCached = errors.New("not cached")
 )
 
+const (
+	// ephemeralSyncInterval is how often ephemeral agents synchronize for
+	// the ephemeralSyncPeriod following the start of the manager
+	ephemeralSyncInterval = time.Second
+	ephemeralSyncPeriod   = time.Minute
+
+	// evictTimeout bounds the deletion of ephemeral agents on shutdown,
+	// which must fit in the grace period of the node
+	evictTimeout = 5 * time.Second
+)
+
 // Manager provides cache management functionalities for agents.
 type Manager interface {
 	// Initialize initializes the manager.
@@ -101,6 +113,18 @@ type manager struct {
 
 	// Saves last success sync
 	lastSync time.Time
+
+	// syncKicks requests a synchronization ahead of schedule
+	syncKicks chan struct{}
+	// syncedEntries holds the IDs of the entries of the last synchronization,
+	// to tell when entries have been deleted. It is only used by the
+	// synchronizer.
+	syncedEntries map[string]bool
+	// Saves last sync kick
+	lastSyncKick time.Time
+
+	// startedAt is when the manager was initialized
+	startedAt time.Time
 }
 
 func (m *manager) Initialize(ctx context.Context) error {
@@ -108,6 +132,7 @@ func (m *manager) Initialize(ctx context.Context) error {
 	m.storeBundle(m.cache.Bundle())
 
 	m.backoff = backoff.NewBackoff(m.clk, m.c.SyncInterval)
+	m.startedAt = m.clk.Now()
 
 	err := m.synchronize(ctx)
 	if nodeutil.ShouldAgentReattest(err) {
@@ -129,6 +154,9 @@ func (m *manager) Run(ctx context.Context) error {
 	switch {
 	case err == nil || errors.Is(err, context.Canceled):
 		m.c.Log.Info("Cache manager stopped")
+		if m.c.Ephemeral {
+			m.evict()
+		}
 		return nil
 	case nodeutil.ShouldAgentReattest(err):
 		m.c.Log.WithError(err).Warn("Agent needs to re-attest; removing SVID and shutting down")
@@ -141,6 +169,9 @@ func (m *manager) Run(ctx context.Context) error {
 }
 
 func (m *manager) SubscribeToCacheChanges(selectors cache.Selectors) cache.Subscriber {
+	if m.c.SyncKickInterval > 0 && len(m.cache.MatchingIdentities(selectors)) == 0 {
+		m.kickSync()
+	}
 	return m.cache.SubscribeToWorkloadUpdates(selectors)
 }
 
@@ -165,7 +196,11 @@ func (m *manager) SetRotationFinishedHook(f func()) {
 }
 
 func (m *manager) MatchingIdentities(selectors []*common.Selector) []cache.Identity {
-	return m.cache.MatchingIdentities(selectors)
+	identities := m.cache.MatchingIdentities(selectors)
+	if len(identities) == 0 {
+		m.kickSync()
+	}
+	return identities
 }
 
 func (m *manager) CountSVIDs() int {
@@ -174,7 +209,11 @@ func (m *manager) CountSVIDs() int {
 
 // FetchWorkloadUpdates gets the latest workload update for the selectors
 func (m *manager) FetchWorkloadUpdate(selectors []*common.Selector) *cache.WorkloadUpdate {
-	return m.cache.FetchWorkloadUpdate(selectors)
+	update := m.cache.FetchWorkloadUpdate(selectors)
+	if !update.HasIdentity() {
+		m.kickSync()
+	}
+	return update
 }
 
 func (m *manager) FetchJWTSVID(ctx context.Context, spiffeID spiffeid.ID, audience []string) (*client.JWTSVID, error) {
@@ -218,25 +257,81 @@ func (m *manager) getEntryID(spiffeID string) string {
 func (m *manager) runSynchronizer(ctx context.Context) error {
 	for {
 		select {
-		case <-m.clk.After(m.backoff.NextBackOff()):
+		case <-m.clk.After(m.nextSyncWait()):
+		case <-m.syncKicks:
+			m.c.Log.Debug("Synchronizing ahead of schedule")
 		case <-ctx.Done():
 			return nil
 		}
 
-		err := m.synchronize(ctx)
-		switch {
-		case err != nil && nodeutil.ShouldAgentReattest(err):
-			m.c.Log.WithError(err).Error("Synchronize failed")
+		if err := m.runSync(ctx); err != nil {
 			return err
-		case err != nil:
-			// Just log the error and wait for next synchronization
-			m.c.Log.WithError(err).Error("Synchronize failed")
-		default:
-			m.backoff.Reset()
 		}
 	}
 }
 
+// runSync synchronizes and handles the failures. It only returns an error
+// when the agent needs to reattest.
+func (m *manager) runSync(ctx context.Context) error {
+	err := m.synchronize(ctx)
+	switch {
+	case err != nil && nodeutil.ShouldAgentReattest(err):
+		m.c.Log.WithError(err).Error("Synchronize failed")
+		m.removeEntries()
+		return err
+	case err != nil && nodeutil.IsAgentBannedError(err):
+		m.c.Log.WithError(err).Error("Agent is banned; no longer serving identities")
+		m.removeEntries()
+	case err != nil:
+		// Just log the error and wait for next synchronization
+		m.c.Log.WithError(err).Error("Synchronize failed")
+	default:
+		m.backoff.Reset()
+	}
+	return nil
+}
+
+// removeEntries removes the entries from the cache once the agent is no
+// longer authorized to serve their identities, rather than serving the cached
+// SVIDs until they expire. The Workload API streams of the workloads that are
+// left without identity are closed.
+func (m *manager) removeEntries() {
+	m.cache.RemoveEntries()
+	m.syncedEntries = nil
+}
+
+// nextSyncWait returns how long to wait for the next synchronization.
+// Ephemeral agents synchronize aggressively right after they start, when the
+// entries of the workloads of the node are likely still being registered.
+func (m *manager) nextSyncWait() time.Duration {
+	if m.c.Ephemeral && m.clk.Now().Sub(m.startedAt) < ephemeralSyncPeriod {
+		return ephemeralSyncInterval
+	}
+	return m.backoff.NextBackOff()
+}
+
+// kickSync requests a synchronization ahead of schedule, if enabled and not
+// already kicked within the sync kick interval
+func (m *manager) kickSync() {
+	if m.c.SyncKickInterval <= 0 {
+		return
+	}
+
+	now := m.clk.Now()
+	m.mtx.Lock()
+	if !m.lastSyncKick.IsZero() && now.Sub(m.lastSyncKick) < m.c.SyncKickInterval {
+		m.mtx.Unlock()
+		return
+	}
+	m.lastSyncKick = now
+	m.mtx.Unlock()
+
+	select {
+	case m.syncKicks <- struct{}{}:
+	default:
+	}
+}
+
 func (m *manager) setLastSync() {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
@@ -285,6 +380,9 @@ func (m *manager) runBundleObserver(ctx context.Context) error {
 }
 
 func (m *manager) storeSVID(svidChain []*x509.Certificate) {
+	if m.svidCachePath == "" {
+		return
+	}
 	err := StoreSVID(m.svidCachePath, svidChain)
 	if err != nil {
 		m.c.Log.WithError(err).Warn("Could not store SVID")
@@ -292,6 +390,9 @@ func (m *manager) storeSVID(svidChain []*x509.Certificate) {
 }
 
 func (m *manager) storeBundle(bundle *bundleutil.Bundle) {
+	if m.bundleCachePath == "" {
+		return
+	}
 	var rootCAs []*x509.Certificate
 	if bundle != nil {
 		rootCAs = bundle.RootCAs()
@@ -302,7 +403,29 @@ func (m *manager) storeBundle(bundle *bundleutil.Bundle) {
 	}
 }
 
+// evict deletes the agent from the server. The agent can't synchronize
+// anymore afterwards, so it must only be called on shutdown.
+func (m *manager) evict() {
+	agentID, err := x509svid.IDFromCert(m.svid.State().SVID[0])
+	if err != nil {
+		m.c.Log.WithError(err).Error("Unable to evict agent: invalid agent SVID")
+		return
+	}
+	log := m.c.Log.WithField(telemetry.SPIFFEID, agentID.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), evictTimeout)
+	defer cancel()
+	if err := m.client.DeleteAgent(ctx, agentID); err != nil {
+		log.WithError(err).Error("Unable to evict agent")
+		return
+	}
+	log.Info("Agent evicted")
+}
+
 func (m *manager) deleteSVID() {
+	if m.svidCachePath == "" {
+		return
+	}
 	if err := DeleteSVID(m.svidCachePath); err != nil {
 		m.c.Log.WithError(err).Error("Failed to remove SVID")
 	}
@@ -23,6 +23,7 @@ import (
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	svidv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/svid/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/agent/common/backoff"
 	"github.com/spiffe/spire/pkg/agent/manager/cache"
 	"github.com/spiffe/spire/pkg/agent/plugin/keymanager"
 	"github.com/spiffe/spire/pkg/common/bundleutil"
@@ -44,6 +45,8 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 var (
@@ -265,6 +268,52 @@ func TestHappyPathWithoutSyncNorRotation(t *testing.T) {
 	})
 }
 
+func TestEphemeral(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	km := fakeagentkeymanager.New(t, dir)
+
+	clk := clock.NewMock(t)
+	api := newMockAPI(t, &mockAPIConfig{
+		km: km,
+		getAuthorizedEntries: func(*mockAPI, int32, *entryv1.GetAuthorizedEntriesRequest) (*entryv1.GetAuthorizedEntriesResponse, error) {
+			return makeGetAuthorizedEntriesResponse(t, "resp1", "resp2"), nil
+		},
+		batchNewX509SVIDEntries: func(*mockAPI, int32) []*common.RegistrationEntry {
+			return makeBatchNewX509SVIDEntries("resp1", "resp2")
+		},
+		svidTTL: 200,
+		clk:     clk,
+	})
+
+	baseSVID, baseSVIDKey := api.newSVID(joinTokenID, 1*time.Hour)
+
+	cat := fakeagentcatalog.New()
+	cat.SetKeyManager(km)
+
+	// Ephemeral agents have no cache paths
+	c := &Config{
+		ServerAddr:   api.addr,
+		SVID:         baseSVID,
+		SVIDKey:      baseSVIDKey,
+		Log:          testLogger,
+		TrustDomain:  trustDomain,
+		Bundle:       api.bundle,
+		Metrics:      &telemetry.Blackhole{},
+		Clk:          clk,
+		Catalog:      cat,
+		SyncInterval: time.Hour,
+		Ephemeral:    true,
+	}
+
+	m, closer := initializeAndRunNewManager(t, c)
+	require.Equal(t, 3, m.CountSVIDs())
+
+	// The agent deletes itself from the server when it stops
+	require.Empty(t, api.getDeletedAgents())
+	closer()
+	require.Equal(t, []string{joinTokenID.String()}, api.getDeletedAgents())
+}
+
 func TestSVIDRotation(t *testing.T) {
 	dir := spiretest.TempDir(t)
 	km := fakeagentkeymanager.New(t, dir)
@@ -550,17 +599,18 @@ func TestSynchronizationClearsStaleCacheEntries(t *testing.T) {
 	cat.SetKeyManager(km)
 
 	c := &Config{
-		ServerAddr:      api.addr,
-		SVID:            baseSVID,
-		SVIDKey:         baseSVIDKey,
-		Log:             testLogger,
-		TrustDomain:     trustDomain,
-		SVIDCachePath:   path.Join(dir, "svid.der"),
-		BundleCachePath: path.Join(dir, "bundle.der"),
-		Bundle:          api.bundle,
-		Metrics:         &telemetry.Blackhole{},
-		Clk:             clk,
-		Catalog:         cat,
+		ServerAddr:       api.addr,
+		SVID:             baseSVID,
+		SVIDKey:          baseSVIDKey,
+		Log:              testLogger,
+		TrustDomain:      trustDomain,
+		SVIDCachePath:    path.Join(dir, "svid.der"),
+		BundleCachePath:  path.Join(dir, "bundle.der"),
+		Bundle:           api.bundle,
+		Metrics:          &telemetry.Blackhole{},
+		Clk:              clk,
+		Catalog:          cat,
+		SyncKickInterval: time.Minute,
 	}
 
 	m := newManager(c)
@@ -574,6 +624,7 @@ func TestSynchronizationClearsStaleCacheEntries(t *testing.T) {
 	compareRegistrationEntries(t,
 		append(regEntriesMap["resp1"], regEntriesMap["resp2"]...),
 		regEntriesFromIdentities(m.cache.Identities()))
+	require.Len(t, m.syncKicks, 0, "first sync should not kick a sync")
 
 	// manually synchronize again
 	if err := m.synchronize(context.Background()); err != nil {
@@ -584,6 +635,67 @@ func TestSynchronizationClearsStaleCacheEntries(t *testing.T) {
 	compareRegistrationEntries(t,
 		regEntriesMap["resp1"],
 		regEntriesFromIdentities(m.cache.Identities()))
+
+	// and the deletion kicks a sync ahead of schedule
+	require.Len(t, m.syncKicks, 1, "deleted entries should kick a sync")
+}
+
+func TestBannedAgentRemovesEntries(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	km := fakeagentkeymanager.New(t, dir)
+
+	clk := clock.NewMock(t)
+	api := newMockAPI(t, &mockAPIConfig{
+		km: km,
+		getAuthorizedEntries: func(h *mockAPI, count int32, _ *entryv1.GetAuthorizedEntriesRequest) (*entryv1.GetAuthorizedEntriesResponse, error) {
+			if count == 1 {
+				return makeGetAuthorizedEntriesResponse(t, "resp1", "resp2"), nil
+			}
+			st, err := status.New(codes.PermissionDenied, "agent is banned").WithDetails(&types.PermissionDeniedDetails{
+				Reason: types.PermissionDeniedDetails_AGENT_BANNED,
+			})
+			require.NoError(t, err)
+			return nil, st.Err()
+		},
+		batchNewX509SVIDEntries: func(h *mockAPI, count int32) []*common.RegistrationEntry {
+			return makeBatchNewX509SVIDEntries("resp1", "resp2")
+		},
+		svidTTL: 200,
+		clk:     clk,
+	})
+
+	baseSVID, baseSVIDKey := api.newSVID(joinTokenID, 1*time.Hour)
+	cat := fakeagentcatalog.New()
+	cat.SetKeyManager(km)
+
+	c := &Config{
+		ServerAddr:      api.addr,
+		SVID:            baseSVID,
+		SVIDKey:         baseSVIDKey,
+		Log:             testLogger,
+		TrustDomain:     trustDomain,
+		SVIDCachePath:   path.Join(dir, "svid.der"),
+		BundleCachePath: path.Join(dir, "bundle.der"),
+		Bundle:          api.bundle,
+		Metrics:         &telemetry.Blackhole{},
+		Clk:             clk,
+		Catalog:         cat,
+	}
+
+	m := newManager(c)
+	require.NoError(t, m.Initialize(context.Background()))
+	require.NotEmpty(t, m.cache.Identities())
+
+	sub := m.SubscribeToCacheChanges(cache.Selectors{{Type: "unix", Value: "uid:1111"}})
+	defer sub.Finish()
+	require.NotEmpty(t, (<-sub.Updates()).Identities)
+
+	// Once banned, the agent stops serving identities right away, and keeps
+	// running so it can be deleted and attest again
+	require.NoError(t, m.runSync(context.Background()))
+	require.Empty(t, m.cache.Identities())
+	require.Empty(t, (<-sub.Updates()).Identities)
+	require.NotNil(t, m.GetBundle())
 }
 
 func TestSynchronizationUpdatesRegistrationEntries(t *testing.T) {
@@ -993,6 +1105,10 @@ type mockAPI struct {
 	getAuthorizedEntriesCount int32
 	batchNewX509SVIDCount     int32
 
+	// deletedAgents are the IDs of the agents deleted by the clients
+	deletedAgentsMtx sync.Mutex
+	deletedAgents    []string
+
 	clk clock.Clock
 
 	agentv1.UnimplementedAgentServer
@@ -1057,6 +1173,19 @@ func (h *mockAPI) RenewAgent(ctx context.Context, req *agentv1.RenewAgentRequest
 	}, nil
 }
 
+func (h *mockAPI) DeleteAgent(ctx context.Context, req *agentv1.DeleteAgentRequest) (*emptypb.Empty, error) {
+	h.deletedAgentsMtx.Lock()
+	defer h.deletedAgentsMtx.Unlock()
+	h.deletedAgents = append(h.deletedAgents, spiffeid.Must(req.Id.TrustDomain, req.Id.Path).String())
+	return &emptypb.Empty{}, nil
+}
+
+func (h *mockAPI) getDeletedAgents() []string {
+	h.deletedAgentsMtx.Lock()
+	defer h.deletedAgentsMtx.Unlock()
+	return h.deletedAgents
+}
+
 func (h *mockAPI) GetAuthorizedEntries(ctx context.Context, req *entryv1.GetAuthorizedEntriesRequest) (*entryv1.GetAuthorizedEntriesResponse, error) {
 	count := atomic.AddInt32(&h.getAuthorizedEntriesCount, 1)
 	if h.c.getAuthorizedEntries != nil {
@@ -1257,3 +1386,62 @@ func svidsEqual(as, bs []*x509.Certificate) bool {
 	}
 	return true
 }
+
+func TestSyncKick(t *testing.T) {
+	clk := clock.NewMock(t)
+	m := &manager{
+		c:         &Config{SyncKickInterval: time.Minute},
+		mtx:       new(sync.RWMutex),
+		clk:       clk,
+		syncKicks: make(chan struct{}, 1),
+	}
+
+	kicked := func() bool {
+		select {
+		case <-m.syncKicks:
+			return true
+		default:
+			return false
+		}
+	}
+
+	m.kickSync()
+	require.True(t, kicked(), "first kick should request a sync")
+
+	// Kicks are rate limited by the sync kick interval
+	clk.Add(30 * time.Second)
+	m.kickSync()
+	require.False(t, kicked(), "kick within the interval should be ignored")
+
+	clk.Add(30 * time.Second)
+	m.kickSync()
+	require.True(t, kicked(), "kick after the interval should request a sync")
+
+	// Kicks are disabled without an interval
+	m.c.SyncKickInterval = 0
+	clk.Add(time.Hour)
+	m.kickSync()
+	require.False(t, kicked(), "kick should be ignored when disabled")
+}
+
+func TestNextSyncWait(t *testing.T) {
+	clk := clock.NewMock(t)
+	m := &manager{
+		c:         &Config{SyncInterval: time.Hour},
+		clk:       clk,
+		backoff:   backoff.NewBackoff(clk, time.Hour),
+		startedAt: clk.Now(),
+	}
+
+	// Agents synchronize on the sync interval, with some jitter
+	require.Equal(t, time.Hour, m.nextSyncWait().Round(time.Hour))
+
+	// Ephemeral agents synchronize every second for the first minute
+	m.c.Ephemeral = true
+	m.backoff.Reset()
+	require.Equal(t, time.Second, m.nextSyncWait())
+	clk.Add(time.Minute - time.Second)
+	require.Equal(t, time.Second, m.nextSyncWait())
+	clk.Add(time.Second)
+	require.Equal(t, time.Hour, m.nextSyncWait().Round(time.Hour))
+}
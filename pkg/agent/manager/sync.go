@@ -34,6 +34,24 @@ func (m *manager) synchronize(ctx context.Context) (err error) {
 		return err
 	}
 
+	deleted := 0
+	for id := range m.syncedEntries {
+		if _, ok := update.RegistrationEntries[id]; !ok {
+			deleted++
+		}
+	}
+	m.syncedEntries = make(map[string]bool, len(update.RegistrationEntries))
+	for id := range update.RegistrationEntries {
+		m.syncedEntries[id] = true
+	}
+	if deleted > 0 {
+		// Entries tend to be deleted in bursts, e.g. along with the pods of a
+		// deployment, so synchronize again ahead of schedule to drop the
+		// rest of them sooner
+		m.c.Log.WithField(telemetry.Count, deleted).Debug("Entries deleted; synchronizing ahead of schedule")
+		m.kickSync()
+	}
+
 	// update the cache and build a list of CSRs that need to be processed
 	// in this interval.
 	//
@@ -41,7 +59,12 @@ func (m *manager) synchronize(ctx context.Context) (err error) {
 	var csrs []csrRequest
 	var expiring int
 	var outdated int
+	now := m.c.Clk.Now()
 	m.cache.UpdateEntries(update, func(existingEntry, newEntry *common.RegistrationEntry, svid *cache.X509SVID) bool {
+		if svid != nil && len(svid.Chain) > 0 {
+			telemetry_agent.AddCacheManagerSVIDTimeToExpirySample(m.c.Metrics, svid.Chain[0].NotAfter.Sub(now))
+		}
+
 		switch {
 		case svid == nil:
 			// no SVID
@@ -51,7 +74,7 @@ func (m *manager) synchronize(ctx context.Context) (err error) {
 				telemetry.RegistrationID: newEntry.EntryId,
 				telemetry.SPIFFEID:       newEntry.SpiffeId,
 			}).Warn("cached X509 SVID is empty")
-		case rotationutil.ShouldRotateX509(m.c.Clk.Now(), svid.Chain[0]):
+		case rotationutil.ShouldRotateX509(now, svid.Chain[0]):
 			expiring++
 		case existingEntry != nil && existingEntry.RevisionNumber != newEntry.RevisionNumber:
 			// Registration entry has been updated
@@ -0,0 +1,186 @@
+package confidentialvm
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/hashicorp/hcl"
+	nodeattestorv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/plugin/agent/nodeattestor/v1"
+	configv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/service/common/config/v1"
+	"github.com/spiffe/spire/pkg/common/catalog"
+	"github.com/spiffe/spire/pkg/common/plugin/confidentialvm"
+	"github.com/spiffe/spire/pkg/common/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func BuiltIn() catalog.BuiltIn {
+	return builtin(New())
+}
+
+func builtin(p *Plugin) catalog.BuiltIn {
+	return catalog.MakeBuiltIn(confidentialvm.PluginName,
+		nodeattestorv1.NodeAttestorPluginServer(p),
+		configv1.ConfigServiceServer(p),
+	)
+}
+
+type Config struct {
+	// TSMReportPath is the path to the report directory of configfs-tsm
+	TSMReportPath string `hcl:"tsm_report_path"`
+
+	// SEVSNPCertChainPath is the path to the VCEK certificate chain, for
+	// hosts that do not provide it with the attestation reports
+	SEVSNPCertChainPath string `hcl:"sev_snp_cert_chain_path"`
+}
+
+type configuration struct {
+	tsmReportPath   string
+	sevSNPCertChain [][]byte
+}
+
+type Plugin struct {
+	nodeattestorv1.UnsafeNodeAttestorServer
+	configv1.UnsafeConfigServer
+
+	m sync.Mutex
+	c *configuration
+
+	hooks struct {
+		openReport func(path string) (tsmReport, error)
+	}
+}
+
+func New() *Plugin {
+	p := &Plugin{}
+	p.hooks.openReport = openConfigfsReport
+	return p
+}
+
+func (p *Plugin) AidAttestation(stream nodeattestorv1.NodeAttestor_AidAttestationServer) error {
+	config, err := p.getConfig()
+	if err != nil {
+		return err
+	}
+
+	report, err := p.hooks.openReport(config.tsmReportPath)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to open attestation report: %v", err)
+	}
+	defer report.Close()
+
+	provider, err := report.Provider()
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to get attestation report provider: %v", err)
+	}
+	var vmType string
+	switch provider {
+	case "sev_guest":
+		vmType = confidentialvm.TypeSEVSNP
+	case "tdx_guest":
+		vmType = confidentialvm.TypeTDX
+	default:
+		return status.Errorf(codes.FailedPrecondition, "unsupported attestation report provider %q", provider)
+	}
+
+	payload, err := json.Marshal(confidentialvm.AttestationData{
+		Type: vmType,
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to marshal attestation data: %v", err)
+	}
+	if err := stream.Send(&nodeattestorv1.PayloadOrChallengeResponse{
+		Data: &nodeattestorv1.PayloadOrChallengeResponse_Payload{
+			Payload: payload,
+		},
+	}); err != nil {
+		return err
+	}
+
+	challengeReq, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	challenge := new(confidentialvm.Challenge)
+	if err := json.Unmarshal(challengeReq.Challenge, challenge); err != nil {
+		return status.Errorf(codes.Internal, "unable to unmarshal challenge: %v", err)
+	}
+	if len(challenge.Nonce) != confidentialvm.NonceSize {
+		return status.Errorf(codes.Internal, "invalid challenge nonce size %d; expected %d", len(challenge.Nonce), confidentialvm.NonceSize)
+	}
+
+	// The nonce goes in the report data, proving the report is fresh
+	evidence, auxblob, err := report.Generate(challenge.Nonce)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to generate attestation report: %v", err)
+	}
+
+	response := confidentialvm.Response{
+		Evidence: evidence,
+	}
+	if vmType == confidentialvm.TypeSEVSNP {
+		if len(auxblob) > 0 {
+			response.Certificates, err = parseSEVSNPCertTable(auxblob)
+			if err != nil {
+				return status.Errorf(codes.Internal, "unable to parse certificate table: %v", err)
+			}
+		}
+		if len(response.Certificates) == 0 {
+			response.Certificates = config.sevSNPCertChain
+		}
+		if len(response.Certificates) == 0 {
+			return status.Error(codes.FailedPrecondition, "the host does not provide the VCEK certificate chain; sev_snp_cert_chain_path must be configured")
+		}
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to marshal challenge response: %v", err)
+	}
+
+	return stream.Send(&nodeattestorv1.PayloadOrChallengeResponse{
+		Data: &nodeattestorv1.PayloadOrChallengeResponse_ChallengeResponse{
+			ChallengeResponse: responseBytes,
+		},
+	})
+}
+
+func (p *Plugin) Configure(ctx context.Context, req *configv1.ConfigureRequest) (*configv1.ConfigureResponse, error) {
+	hclConfig := new(Config)
+	if err := hcl.Decode(hclConfig, req.HclConfiguration); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "unable to decode configuration: %v", err)
+	}
+
+	config := &configuration{
+		tsmReportPath: hclConfig.TSMReportPath,
+	}
+	if config.tsmReportPath == "" {
+		config.tsmReportPath = DefaultTSMReportPath
+	}
+
+	if hclConfig.SEVSNPCertChainPath != "" {
+		certs, err := util.LoadCertificates(hclConfig.SEVSNPCertChainPath)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "unable to load SEV-SNP certificate chain: %v", err)
+		}
+		for _, cert := range certs {
+			config.sevSNPCertChain = append(config.sevSNPCertChain, cert.Raw)
+		}
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.c = config
+
+	return &configv1.ConfigureResponse{}, nil
+}
+
+func (p *Plugin) getConfig() (*configuration, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.c == nil {
+		return nil, status.Error(codes.FailedPrecondition, "not configured")
+	}
+	return p.c, nil
+}
@@ -0,0 +1,251 @@
+package confidentialvm
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spiffe/spire/pkg/agent/plugin/nodeattestor"
+	nodeattestortest "github.com/spiffe/spire/pkg/agent/plugin/nodeattestor/test"
+	"github.com/spiffe/spire/pkg/common/plugin/confidentialvm"
+	"github.com/spiffe/spire/test/fixture"
+	"github.com/spiffe/spire/test/plugintest"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/spiffe/spire/test/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+var (
+	streamBuilder = nodeattestortest.ServerStream(confidentialvm.PluginName)
+	nonce         = bytes.Repeat([]byte{0x42}, confidentialvm.NonceSize)
+)
+
+func TestAidAttestation(t *testing.T) {
+	caPath := fixture.Join("certs", "ca.pem")
+	ca, err := util.LoadCert(caPath)
+	require.NoError(t, err)
+
+	vcek, ask, ark := []byte("vcek"), []byte("ask"), []byte("ark")
+	certTable := makeCertTable(map[string][]byte{
+		sevSNPARKGUID:  ark,
+		sevSNPVCEKGUID: vcek,
+		sevSNPASKGUID:  ask,
+	})
+
+	for _, tt := range []struct {
+		name               string
+		config             string
+		provider           string
+		auxblob            []byte
+		expectType         string
+		expectCertificates [][]byte
+		expectCode         codes.Code
+		expectMessage      string
+	}{
+		{
+			name:               "SEV-SNP",
+			provider:           "sev_guest",
+			auxblob:            certTable,
+			expectType:         confidentialvm.TypeSEVSNP,
+			expectCertificates: [][]byte{vcek, ask, ark},
+		},
+		{
+			name:               "SEV-SNP with configured certificate chain",
+			config:             `sev_snp_cert_chain_path = "` + caPath + `"`,
+			provider:           "sev_guest",
+			expectType:         confidentialvm.TypeSEVSNP,
+			expectCertificates: [][]byte{ca.Raw},
+		},
+		{
+			name:          "SEV-SNP without certificate chain",
+			provider:      "sev_guest",
+			expectType:    confidentialvm.TypeSEVSNP,
+			expectCode:    codes.FailedPrecondition,
+			expectMessage: "nodeattestor(confidential_vm): the host does not provide the VCEK certificate chain; sev_snp_cert_chain_path must be configured",
+		},
+		{
+			name:          "SEV-SNP with malformed certificate table",
+			provider:      "sev_guest",
+			auxblob:       []byte("table"),
+			expectType:    confidentialvm.TypeSEVSNP,
+			expectCode:    codes.Internal,
+			expectMessage: "nodeattestor(confidential_vm): unable to parse certificate table: certificate table is not terminated",
+		},
+		{
+			name:       "TDX",
+			provider:   "tdx_guest",
+			expectType: confidentialvm.TypeTDX,
+		},
+		{
+			name:          "unsupported provider",
+			provider:      "sgx_guest",
+			expectCode:    codes.FailedPrecondition,
+			expectMessage: `nodeattestor(confidential_vm): unsupported attestation report provider "sgx_guest"`,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			report := &fakeReport{
+				provider: tt.provider,
+				auxblob:  tt.auxblob,
+			}
+			attestor := loadPlugin(t, report, tt.config)
+
+			stream := streamBuilder.Handle(func(payload []byte) ([]byte, error) {
+				attestationData := new(confidentialvm.AttestationData)
+				require.NoError(t, json.Unmarshal(payload, attestationData))
+				assert.Equal(t, tt.expectType, attestationData.Type)
+				return json.Marshal(confidentialvm.Challenge{Nonce: nonce})
+			}).Handle(func(challengeResponse []byte) ([]byte, error) {
+				response := new(confidentialvm.Response)
+				require.NoError(t, json.Unmarshal(challengeResponse, response))
+				assert.Equal(t, append([]byte("report:"), nonce...), response.Evidence)
+				assert.Equal(t, tt.expectCertificates, response.Certificates)
+				return nil, nil
+			}).Build()
+
+			err := attestor.Attest(context.Background(), stream)
+			assert.True(t, report.closed)
+			if tt.expectCode != codes.OK {
+				spiretest.RequireGRPCStatus(t, err, tt.expectCode, tt.expectMessage)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAidAttestationFailures(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		attestor := new(nodeattestor.V1)
+		plugintest.Load(t, BuiltIn(), attestor)
+		err := attestor.Attest(context.Background(), streamBuilder.Build())
+		spiretest.RequireGRPCStatus(t, err, codes.FailedPrecondition, "nodeattestor(confidential_vm): not configured")
+	})
+
+	t.Run("configfs-tsm unavailable", func(t *testing.T) {
+		attestor := new(nodeattestor.V1)
+		plugintest.Load(t, BuiltIn(), attestor, plugintest.Configure(`tsm_report_path = "/does/not/exist"`))
+		err := attestor.Attest(context.Background(), streamBuilder.Build())
+		spiretest.RequireGRPCStatusContains(t, err, codes.Internal, "nodeattestor(confidential_vm): unable to open attestation report")
+	})
+
+	t.Run("invalid nonce", func(t *testing.T) {
+		attestor := loadPlugin(t, &fakeReport{provider: "tdx_guest"}, "")
+		challenge, err := json.Marshal(confidentialvm.Challenge{Nonce: []byte("nonce")})
+		require.NoError(t, err)
+		err = attestor.Attest(context.Background(), streamBuilder.IgnoreThenChallenge(challenge).Build())
+		spiretest.RequireGRPCStatus(t, err, codes.Internal, "nodeattestor(confidential_vm): invalid challenge nonce size 5; expected 64")
+	})
+
+	t.Run("server failure", func(t *testing.T) {
+		attestor := loadPlugin(t, &fakeReport{provider: "tdx_guest"}, "")
+		err := attestor.Attest(context.Background(), streamBuilder.FailAndBuild(errors.New("ohno")))
+		spiretest.RequireGRPCStatusContains(t, err, codes.Unknown, "ohno")
+	})
+}
+
+func TestConfigfsReport(t *testing.T) {
+	path := spiretest.TempDir(t)
+	report, err := openConfigfsReport(path)
+	require.NoError(t, err)
+
+	// The kernel populates the attributes of the report entries
+	dir := report.(*configfsReport).dir
+	require.Equal(t, path, filepath.Dir(dir))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "provider"), []byte("tdx_guest\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "outblob"), []byte("quote"), 0600))
+
+	provider, err := report.Provider()
+	require.NoError(t, err)
+	assert.Equal(t, "tdx_guest", provider)
+
+	outblob, auxblob, err := report.Generate(nonce)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("quote"), outblob)
+	assert.Empty(t, auxblob)
+	inblob, err := os.ReadFile(filepath.Join(dir, "inblob"))
+	require.NoError(t, err)
+	assert.Equal(t, nonce, inblob)
+}
+
+func TestParseSEVSNPCertTable(t *testing.T) {
+	vlek, ask := []byte("vlek"), []byte("ask")
+
+	chain, err := parseSEVSNPCertTable(makeCertTable(map[string][]byte{
+		sevSNPVLEKGUID: vlek,
+		sevSNPASKGUID:  ask,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{vlek, ask}, chain)
+
+	// Tables without a VCEK or a VLEK are of no use
+	chain, err = parseSEVSNPCertTable(makeCertTable(map[string][]byte{
+		sevSNPASKGUID: ask,
+	}))
+	require.NoError(t, err)
+	assert.Empty(t, chain)
+
+	table := makeCertTable(map[string][]byte{
+		sevSNPVCEKGUID: []byte("vcek"),
+	})
+	_, err = parseSEVSNPCertTable(table[:len(table)-1])
+	require.EqualError(t, err, "certificate 63da758de6644564adc5f4b93be8accd is out of the bounds of the certificate table")
+}
+
+func loadPlugin(t *testing.T, report *fakeReport, config string) nodeattestor.NodeAttestor {
+	p := New()
+	p.hooks.openReport = func(path string) (tsmReport, error) {
+		assert.Equal(t, DefaultTSMReportPath, path)
+		return report, nil
+	}
+
+	attestor := new(nodeattestor.V1)
+	plugintest.Load(t, builtin(p), attestor, plugintest.Configure(config))
+	return attestor
+}
+
+// makeCertTable makes a SEV-SNP certificate table with the certificates
+// after the entries
+func makeCertTable(certs map[string][]byte) []byte {
+	entries := new(bytes.Buffer)
+	data := new(bytes.Buffer)
+	offset := (len(certs) + 1) * sevSNPCertTableEntrySize
+	for guid, cert := range certs {
+		guidBytes, _ := hex.DecodeString(guid)
+		entries.Write(guidBytes)
+		_ = binary.Write(entries, binary.LittleEndian, uint32(offset+data.Len()))
+		_ = binary.Write(entries, binary.LittleEndian, uint32(len(cert)))
+		data.Write(cert)
+	}
+	entries.Write(make([]byte, sevSNPCertTableEntrySize))
+	entries.Write(data.Bytes())
+	return entries.Bytes()
+}
+
+type fakeReport struct {
+	provider string
+	auxblob  []byte
+	closed   bool
+}
+
+func (r *fakeReport) Provider() (string, error) {
+	return r.provider, nil
+}
+
+func (r *fakeReport) Generate(reportData []byte) ([]byte, []byte, error) {
+	return append([]byte("report:"), reportData...), r.auxblob, nil
+}
+
+func (r *fakeReport) Close() error {
+	r.closed = true
+	return nil
+}
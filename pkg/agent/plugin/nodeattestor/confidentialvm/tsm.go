@@ -0,0 +1,123 @@
+package confidentialvm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultTSMReportPath is where configfs-tsm, the interface of Linux through
+// which both SEV-SNP guests and TDX trust domains request attestation
+// reports, is usually mounted
+const DefaultTSMReportPath = "/sys/kernel/config/tsm/report"
+
+// tsmReport is an attestation report requested through configfs-tsm
+type tsmReport interface {
+	// Provider returns the provider of the report, e.g. "sev_guest" or
+	// "tdx_guest"
+	Provider() (string, error)
+
+	// Generate generates the report with the given report data, returning
+	// the report, or quote, and the auxiliary data of the provider
+	Generate(reportData []byte) (outblob []byte, auxblob []byte, err error)
+
+	// Close releases the report
+	Close() error
+}
+
+// configfsReport is a report entry of configfs-tsm. Each report is generated
+// in its own entry, so that concurrent requests don't get mixed up.
+type configfsReport struct {
+	dir string
+}
+
+func openConfigfsReport(path string) (tsmReport, error) {
+	dir, err := os.MkdirTemp(path, "spire-agent-")
+	if err != nil {
+		return nil, err
+	}
+	return &configfsReport{dir: dir}, nil
+}
+
+func (r *configfsReport) Provider() (string, error) {
+	provider, err := os.ReadFile(filepath.Join(r.dir, "provider"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(provider)), nil
+}
+
+func (r *configfsReport) Generate(reportData []byte) ([]byte, []byte, error) {
+	if err := os.WriteFile(filepath.Join(r.dir, "inblob"), reportData, 0600); err != nil {
+		return nil, nil, err
+	}
+	outblob, err := os.ReadFile(filepath.Join(r.dir, "outblob"))
+	if err != nil {
+		return nil, nil, err
+	}
+	// Not every provider has auxiliary data
+	auxblob, err := os.ReadFile(filepath.Join(r.dir, "auxblob"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	return outblob, auxblob, nil
+}
+
+func (r *configfsReport) Close() error {
+	return os.Remove(r.dir)
+}
+
+// GUIDs of the certificates of the SEV-SNP certificate table, hex encoded
+const (
+	sevSNPVCEKGUID = "63da758de6644564adc5f4b93be8accd"
+	sevSNPVLEKGUID = "a8074bc2a25a483eaae639c045a0b8a1"
+	sevSNPASKGUID  = "4ab7b379bbac4fe4a02f05aef327c782"
+	sevSNPARKGUID  = "c0b406a4a803495297433fb6014cd0ae"
+)
+
+const sevSNPCertTableEntrySize = 24
+
+// parseSEVSNPCertTable parses the certificate table the host provides with
+// the extended attestation reports of SEV-SNP guests, returning the DER
+// encoded certificates ordered from the VCEK (or VLEK) up. The table is a
+// list of GUID, offset and length entries terminated by a zero entry, with
+// offsets relative to the start of the table.
+func parseSEVSNPCertTable(table []byte) ([][]byte, error) {
+	certs := make(map[string][]byte)
+	for entry := table; ; entry = entry[sevSNPCertTableEntrySize:] {
+		if len(entry) < sevSNPCertTableEntrySize {
+			return nil, errors.New("certificate table is not terminated")
+		}
+		guid := entry[:16]
+		if bytes.Equal(guid, make([]byte, 16)) {
+			break
+		}
+		offset := binary.LittleEndian.Uint32(entry[16:])
+		length := binary.LittleEndian.Uint32(entry[20:])
+		if uint64(offset)+uint64(length) > uint64(len(table)) {
+			return nil, fmt.Errorf("certificate %x is out of the bounds of the certificate table", guid)
+		}
+		certs[hex.EncodeToString(guid)] = table[offset : offset+length]
+	}
+
+	// Reports are signed either by the VCEK or by the VLEK
+	leaf, ok := certs[sevSNPVCEKGUID]
+	if !ok {
+		leaf, ok = certs[sevSNPVLEKGUID]
+	}
+	if !ok {
+		return nil, nil
+	}
+	chain := [][]byte{leaf}
+	for _, guid := range []string{sevSNPASKGUID, sevSNPARKGUID} {
+		if cert, ok := certs[guid]; ok {
+			chain = append(chain, cert)
+		}
+	}
+	return chain, nil
+}
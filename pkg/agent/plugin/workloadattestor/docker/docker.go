@@ -53,6 +53,7 @@ type Plugin struct {
 	mtx               sync.RWMutex
 	containerIDFinder cgroup.ContainerIDFinder
 	docker            Docker
+	procRoot          string
 }
 
 func New() *Plugin {
@@ -70,6 +71,8 @@ type dockerPluginConfig struct {
 	// ContainerIDCGroupMatchers is a list of patterns used to discover container IDs from cgroup entries.
 	// See the documentation for cgroup.NewContainerIDFinder in the cgroup subpackage for more information.
 	ContainerIDCGroupMatchers []string `hcl:"container_id_cgroup_matchers"`
+	// ProcRoot is where the proc filesystem used to resolve the container of the workload processes is mounted (default: "/proc").
+	ProcRoot string `hcl:"proc_root"`
 }
 
 func (p *Plugin) SetLogger(log hclog.Logger) {
@@ -80,7 +83,7 @@ func (p *Plugin) Attest(ctx context.Context, req *workloadattestorv1.AttestReque
 	p.mtx.RLock()
 	defer p.mtx.RUnlock()
 
-	cgroupList, err := cgroups.GetCgroups(req.Pid, p.fs)
+	cgroupList, err := cgroups.GetCgroupsFromProcRoot(p.procRoot, req.Pid, p.fs)
 	if err != nil {
 		return nil, err
 	}
@@ -156,10 +159,16 @@ func (p *Plugin) Configure(ctx context.Context, req *configv1.ConfigureRequest)
 		}
 	}
 
+	procRoot := config.ProcRoot
+	if procRoot == "" {
+		procRoot = cgroups.DefaultProcRoot
+	}
+
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 	p.docker = docker
 	p.containerIDFinder = containerIDFinder
+	p.procRoot = procRoot
 	return &configv1.ConfigureResponse{}, nil
 }
 
@@ -215,16 +224,28 @@ func getContainerIDFromCGroups(finder cgroup.ContainerIDFinder, cgroups []cgroup
 // requirement is that the docker prefix comes before the id.
 var dockerCGroupRE = regexp.MustCompile(`\bdocker\b.+\b([[:xdigit:]]{64})\b`)
 
+// namespacedCGroupRE matches cgroup paths relative to the cgroup namespace of
+// the agent, once the leading ".." segments have been trimmed off, that end
+// with a 64 hex-character container id, e.g. "/<id>" for a sibling container
+// of an agent running in a container with a private cgroup namespace.
+var namespacedCGroupRE = regexp.MustCompile(`/([[:xdigit:]]{64})$`)
+
 type defaultContainerIDFinder struct{}
 
 // FindContainerID returns the container ID in the given cgroup path. The cgroup
 // path must have the whole word "docker" at some point in the path followed
-// at some point by a 64 hex-character container ID. If the cgroup path does
-// not match the above description, the method returns false.
+// at some point by a 64 hex-character container ID, or be outside the cgroup
+// namespace of the agent and end with a 64 hex-character container ID. If the
+// cgroup path does not match the above description, the method returns false.
 func (f *defaultContainerIDFinder) FindContainerID(cgroupPath string) (string, bool) {
 	m := dockerCGroupRE.FindStringSubmatch(cgroupPath)
 	if m != nil {
 		return m[1], true
 	}
+	if trimmed, ok := cgroups.TrimNamespaceRoot(cgroupPath); ok {
+		if m := namespacedCGroupRE.FindStringSubmatch(trimmed); m != nil {
+			return m[1], true
+		}
+	}
 	return "", false
 }
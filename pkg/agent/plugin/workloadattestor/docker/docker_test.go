@@ -148,6 +148,15 @@ func TestContainerExtraction(t *testing.T) {
 			cgroups:   testCgroupEntries + "\n" + "4:devices:/system.slice/docker-41e4ab61d2860b0e1467de0da0a9c6068012761febec402dc04a5a94f32ea867.scope",
 			expectErr: "multiple container IDs found in cgroups",
 		},
+		{
+			desc:     "private cgroup namespace",
+			cgroups:  "0::/../6469646e742065787065637420616e796f6e6520746f20726561642074686973",
+			hasMatch: true,
+		},
+		{
+			desc:    "private cgroup namespace without container id",
+			cgroups: "0::/../../user.slice/user-1000.slice/session-2.scope",
+		},
 		{
 			desc:    "default finder does not match cgroup missing docker prefix",
 			cgroups: "4:devices:/system.slice/41e4ab61d2860b0e1467de0da0a9c6068012761febec402dc04a5a94f32ea867.scope",
@@ -205,6 +214,33 @@ func TestCgroupFileNotFound(t *testing.T) {
 	require.Nil(t, selectorValues)
 }
 
+func TestProcRoot(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDocker := mock_docker.NewMockDocker(mockCtrl)
+
+	fs := FakeFileSystem{
+		Files: map[string]string{
+			"/host/proc/123/cgroup": testCgroupEntries,
+		},
+	}
+	p := newTestPlugin(
+		t,
+		withConfig(t, `proc_root = "/host/proc"`), // this must be the first option
+		withMockDocker(mockDocker),
+		withFileSystem(fs),
+	)
+
+	mockDocker.EXPECT().ContainerInspect(gomock.Any(), testContainerID).Return(types.ContainerJSON{
+		Config: &container.Config{
+			Image: "image-id",
+		},
+	}, nil)
+	selectorValues, err := doAttest(t, p)
+	require.NoError(t, err)
+	require.Equal(t, []string{"image_id:image-id"}, selectorValues)
+}
+
 func TestDockerError(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -27,6 +27,7 @@ import (
 	"github.com/spiffe/spire/pkg/common/catalog"
 	"github.com/spiffe/spire/pkg/common/pemutil"
 	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/common/util"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
@@ -114,6 +115,10 @@ type HCLConfig struct {
 	// ReloadInterval controls how often TLS and token configuration is loaded
 	// from the disk.
 	ReloadInterval string `hcl:"reload_interval"`
+
+	// ProcRoot is where the proc filesystem used to resolve the container of
+	// the workload processes is mounted. It defaults to /proc.
+	ProcRoot string `hcl:"proc_root"`
 }
 
 // k8sConfig holds the configuration distilled from HCL
@@ -129,6 +134,7 @@ type k8sConfig struct {
 	KubeletCAPath           string
 	NodeName                string
 	ReloadInterval          time.Duration
+	ProcRoot                string
 
 	Client     *kubeletClient
 	LastReload time.Time
@@ -165,7 +171,7 @@ func (p *Plugin) Attest(ctx context.Context, req *workloadattestorv1.AttestReque
 		return nil, err
 	}
 
-	containerID, err := p.getContainerIDFromCGroups(req.Pid)
+	containerID, err := p.getContainerIDFromCGroups(config.ProcRoot, req.Pid)
 	if err != nil {
 		return nil, err
 	}
@@ -193,7 +199,7 @@ func (p *Plugin) Attest(ctx context.Context, req *workloadattestorv1.AttestReque
 			switch lookup {
 			case containerInPod:
 				return &workloadattestorv1.AttestResponse{
-					SelectorValues: getSelectorValuesFromPodInfo(&item, status),
+					SelectorValues: SelectorValuesFromPod(&item, status),
 				}, nil
 			case containerNotInPod:
 			}
@@ -274,6 +280,11 @@ func (p *Plugin) Configure(ctx context.Context, req *configv1.ConfigureRequest)
 	// Determine the node name
 	nodeName := p.getNodeName(config.NodeName, config.NodeNameEnv)
 
+	procRoot := config.ProcRoot
+	if procRoot == "" {
+		procRoot = cgroups.DefaultProcRoot
+	}
+
 	// Configure the kubelet client
 	c := &k8sConfig{
 		Secure:                  secure,
@@ -287,6 +298,7 @@ func (p *Plugin) Configure(ctx context.Context, req *configv1.ConfigureRequest)
 		KubeletCAPath:           config.KubeletCAPath,
 		NodeName:                nodeName,
 		ReloadInterval:          reloadInterval,
+		ProcRoot:                procRoot,
 	}
 	if err := p.reloadKubeletClient(c); err != nil {
 		return nil, err
@@ -316,8 +328,8 @@ func (p *Plugin) getConfig() (*k8sConfig, error) {
 	return p.config, nil
 }
 
-func (p *Plugin) getContainerIDFromCGroups(pid int32) (string, error) {
-	cgroups, err := cgroups.GetCgroups(pid, p.fs)
+func (p *Plugin) getContainerIDFromCGroups(procRoot string, pid int32) (string, error) {
+	cgroups, err := cgroups.GetCgroupsFromProcRoot(procRoot, pid, p.fs)
 	if err != nil {
 		return "", status.Errorf(codes.Internal, "unable to obtain cgroups: %v", err)
 	}
@@ -420,7 +432,7 @@ func (p *Plugin) reloadKubeletClient(config *k8sConfig) (err error) {
 		},
 		URL: url.URL{
 			Scheme: "https",
-			Host:   fmt.Sprintf("%s:%d", host, config.Port),
+			Host:   util.JoinHostPort(host, strconv.Itoa(config.Port)),
 		},
 		Token: token,
 	}
@@ -566,6 +578,12 @@ var containerIDRe = regexp.MustCompile(`` +
 	// non-punctuation end of string, i.e., the container ID
 	`([[:^punct:]]+)$`)
 
+// namespacedContainerIDRe is the regex used to parse out the container ID
+// from a cgroup path relative to the cgroup namespace of the agent, once the
+// leading ".." segments have been trimmed off. Only a full length container
+// ID, optionally prefixed by the container runtime, is accepted then.
+var namespacedContainerIDRe = regexp.MustCompile(`[[:punct:]]([[:xdigit:]]{64})$`)
+
 func getContainerIDFromCGroupPath(cgroupPath string) (string, bool) {
 	// We are only interested in kube pods entries, for example:
 	// - /kubepods/burstable/pod2c48913c-b29f-11e7-9350-020968147796/9bca8d63d5fa610783847915bcff0ecac1273e5b4bed3f6fa1b07350e0135961
@@ -582,6 +600,18 @@ func getContainerIDFromCGroupPath(cgroupPath string) (string, bool) {
 	if matches != nil {
 		return matches[1], true
 	}
+
+	// When the agent runs with a private cgroup namespace, e.g. in a
+	// container on a cgroup v2 host or under kind, the paths of the pod
+	// cgroups are relative to the cgroup of the agent container and may lack
+	// the kubepods and pod UID segments, for example:
+	// - /../../../burstable/pod2c48913c-b29f-11e7-9350-020968147796/9bca8d63d5fa610783847915bcff0ecac1273e5b4bed3f6fa1b07350e0135961
+	// - /../cri-containerd-9bca8d63d5fa610783847915bcff0ecac1273e5b4bed3f6fa1b07350e0135961
+	if trimmed, ok := cgroups.TrimNamespaceRoot(cgroupPath); ok {
+		if matches := namespacedContainerIDRe.FindStringSubmatch(trimmed); matches != nil {
+			return matches[1], true
+		}
+	}
 	return "", false
 }
 
@@ -643,7 +673,10 @@ func getPodImageIdentifiers(containerStatusArray []corev1.ContainerStatus) map[s
 	return podImages
 }
 
-func getSelectorValuesFromPodInfo(pod *corev1.Pod, status *corev1.ContainerStatus) []string {
+// SelectorValuesFromPod returns the values of the selectors produced for the
+// container of the pod with the given status. They are exported so the
+// k8s-workload-registrar can simulate the attestation of pods.
+func SelectorValuesFromPod(pod *corev1.Pod, status *corev1.ContainerStatus) []string {
 	podImageIdentifiers := getPodImageIdentifiers(pod.Status.ContainerStatuses)
 	podInitImageIdentifiers := getPodImageIdentifiers(pod.Status.InitContainerStatuses)
 	containerImageIdentifiers := getPodImageIdentifiers([]corev1.ContainerStatus{*status})
@@ -13,6 +13,7 @@ import (
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/spiffe/spire/pkg/agent/plugin/workloadattestor"
 	"github.com/spiffe/spire/test/plugintest"
+	"github.com/spiffe/spire/test/plugintest/conformance"
 	"github.com/spiffe/spire/test/spiretest"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
@@ -26,6 +27,10 @@ func TestPlugin(t *testing.T) {
 	spiretest.Run(t, new(Suite))
 }
 
+func TestConformance(t *testing.T) {
+	conformance.TestWorkloadAttestor(t, BuiltIn(), plugintest.Configure(""))
+}
+
 type Suite struct {
 	spiretest.Suite
 
@@ -0,0 +1,135 @@
+package quarantine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/zeebo/errs"
+)
+
+// AddRequest is the body of the requests adding a rule
+type AddRequest struct {
+	// Selectors are in the type:value format
+	Selectors []string `json:"selectors"`
+	// Duration is in the time.ParseDuration format (e.g. 1h)
+	Duration string `json:"duration"`
+	Reason   string `json:"reason"`
+}
+
+// RulesResponse is the body of the responses listing the rules
+type RulesResponse struct {
+	Rules []*Rule `json:"rules"`
+}
+
+func (q *Quarantine) listenAndServe(ctx context.Context) error {
+	// Remove the socket left behind by a previous run, if any
+	os.Remove(q.c.SocketPath)
+
+	listener, err := net.Listen("unix", q.c.SocketPath)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	// The API is meant for the node operators only
+	if err := os.Chmod(q.c.SocketPath, 0770); err != nil {
+		listener.Close()
+		return errs.Wrap(err)
+	}
+
+	server := &http.Server{
+		Handler: q.handler(),
+	}
+
+	q.c.Log.WithField(telemetry.Path, q.c.SocketPath).Info("Serving workload quarantine API")
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errCh:
+		return errs.Wrap(err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			return errs.Wrap(err)
+		}
+		if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return errs.Wrap(err)
+		}
+		return nil
+	}
+}
+
+func (q *Quarantine) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/quarantine", q.serveQuarantine)
+	return mux
+}
+
+func (q *Quarantine) serveQuarantine(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, &RulesResponse{Rules: q.Rules()})
+	case http.MethodPost:
+		q.serveAdd(w, req)
+	case http.MethodDelete:
+		id := req.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "400 missing rule id", http.StatusBadRequest)
+			return
+		}
+		if !q.Remove(id) {
+			http.Error(w, "404 rule not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (q *Quarantine) serveAdd(w http.ResponseWriter, req *http.Request) {
+	var addReq AddRequest
+	if err := json.NewDecoder(req.Body).Decode(&addReq); err != nil {
+		http.Error(w, fmt.Sprintf("400 invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	duration, err := time.ParseDuration(addReq.Duration)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("400 invalid duration %q", addReq.Duration), http.StatusBadRequest)
+		return
+	}
+
+	selectors := make([]*common.Selector, 0, len(addReq.Selectors))
+	for _, s := range addReq.Selectors {
+		selector, err := ParseSelector(s)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("400 %v", err), http.StatusBadRequest)
+			return
+		}
+		selectors = append(selectors, selector)
+	}
+
+	rule, err := q.Add(selectors, duration, addReq.Reason)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("400 %v", err), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
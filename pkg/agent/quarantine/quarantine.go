@@ -0,0 +1,276 @@
+package quarantine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/pkg/common/selector"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/proto/spire/common"
+)
+
+const (
+	// DefaultMaxDuration is the longest workloads can be quarantined for by
+	// a rule if not overridden by the config
+	DefaultMaxDuration = 24 * time.Hour
+
+	// pruneInterval is how often the expired rules are pruned
+	pruneInterval = 5 * time.Second
+)
+
+// Config is the config of the quarantine
+type Config struct {
+	// SocketPath is the path of the UDS the quarantine API is served on
+	SocketPath string
+
+	// MaxDuration is the longest workloads can be quarantined for by a rule
+	MaxDuration time.Duration
+
+	Log   logrus.FieldLogger
+	Clock clock.Clock
+}
+
+// Rule quarantines the workloads attested with all of its selectors until it
+// expires
+type Rule struct {
+	ID string `json:"id"`
+	// Selectors are in the type:value format
+	Selectors []string  `json:"selectors"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	set selector.Set
+}
+
+// Quarantine holds the rules, added by operators at runtime, that make the
+// agent withhold SVIDs from the matching workloads regardless of the
+// registration entries, to contain an incident on the node (e.g. a
+// compromised image). Rules are time-boxed and are not persisted, so they
+// are lifted when they expire or when the agent restarts.
+type Quarantine struct {
+	c Config
+
+	mu      sync.RWMutex
+	rules   map[string]*Rule
+	changed chan struct{}
+}
+
+// New creates a new quarantine
+func New(config Config) *Quarantine {
+	if config.MaxDuration <= 0 {
+		config.MaxDuration = DefaultMaxDuration
+	}
+	if config.Clock == nil {
+		config.Clock = clock.New()
+	}
+	return &Quarantine{
+		c:       config,
+		rules:   make(map[string]*Rule),
+		changed: make(chan struct{}),
+	}
+}
+
+// Add quarantines the workloads attested with all of the given selectors for
+// the given duration
+func (q *Quarantine) Add(selectors []*common.Selector, duration time.Duration, reason string) (*Rule, error) {
+	if len(selectors) == 0 {
+		return nil, errors.New("at least one selector is required")
+	}
+	for _, s := range selectors {
+		if s.Type == "" || s.Value == "" {
+			return nil, errors.New("invalid selector: type and value are required")
+		}
+		if err := selector.Validate(s); err != nil {
+			return nil, fmt.Errorf("invalid selector: %w", err)
+		}
+	}
+	if duration <= 0 {
+		return nil, errors.New("duration must be positive")
+	}
+	if duration > q.c.MaxDuration {
+		return nil, fmt.Errorf("duration cannot be longer than %s", q.c.MaxDuration)
+	}
+
+	id, err := newRuleID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := q.c.Clock.Now().UTC()
+	rule := &Rule{
+		ID:        id,
+		Selectors: formatSelectors(selectors),
+		Reason:    reason,
+		CreatedAt: now,
+		ExpiresAt: now.Add(duration),
+		set:       selector.NewSetFromRaw(selectors),
+	}
+
+	q.mu.Lock()
+	q.rules[id] = rule
+	q.notifyLocked()
+	q.mu.Unlock()
+
+	q.c.Log.WithFields(logrus.Fields{
+		telemetry.QuarantineRuleID: rule.ID,
+		telemetry.Selectors:        rule.Selectors,
+		telemetry.Reason:           rule.Reason,
+		telemetry.ExpiresAt:        rule.ExpiresAt.Format(time.RFC3339),
+	}).Warn("Quarantined workloads")
+	return rule, nil
+}
+
+// Remove lifts the rule with the given ID, returning false if there is no
+// such rule
+func (q *Quarantine) Remove(id string) bool {
+	q.mu.Lock()
+	rule, ok := q.rules[id]
+	if ok {
+		delete(q.rules, id)
+		q.notifyLocked()
+	}
+	q.mu.Unlock()
+
+	if ok {
+		q.c.Log.WithFields(logrus.Fields{
+			telemetry.QuarantineRuleID: rule.ID,
+			telemetry.Selectors:        rule.Selectors,
+		}).Info("Lifted workload quarantine")
+	}
+	return ok
+}
+
+// Rules returns the rules in effect, oldest first
+func (q *Quarantine) Rules() []*Rule {
+	now := q.c.Clock.Now()
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	rules := make([]*Rule, 0, len(q.rules))
+	for _, rule := range q.rules {
+		if now.Before(rule.ExpiresAt) {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+	})
+	return rules
+}
+
+// Match returns the rule in effect quarantining a workload attested with
+// the given selectors, if any
+func (q *Quarantine) Match(selectors []*common.Selector) *Rule {
+	now := q.c.Clock.Now()
+	set := selector.NewSetFromRaw(selectors)
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	for _, rule := range q.rules {
+		if now.Before(rule.ExpiresAt) && set.IncludesSet(rule.set) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Changed returns a channel that is closed the next time the rules change
+func (q *Quarantine) Changed() <-chan struct{} {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.changed
+}
+
+// Run serves the quarantine API, if configured, and prunes the expired rules
+// until the context is done
+func (q *Quarantine) Run(ctx context.Context) error {
+	if q.c.SocketPath == "" {
+		q.runPruner(ctx)
+		return nil
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- q.listenAndServe(ctx)
+	}()
+	q.runPruner(ctx)
+	return <-errCh
+}
+
+func (q *Quarantine) runPruner(ctx context.Context) {
+	ticker := q.c.Clock.Ticker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.prune()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *Quarantine) prune() {
+	now := q.c.Clock.Now()
+
+	var expired []*Rule
+	q.mu.Lock()
+	for id, rule := range q.rules {
+		if !now.Before(rule.ExpiresAt) {
+			expired = append(expired, rule)
+			delete(q.rules, id)
+		}
+	}
+	if len(expired) > 0 {
+		q.notifyLocked()
+	}
+	q.mu.Unlock()
+
+	for _, rule := range expired {
+		q.c.Log.WithFields(logrus.Fields{
+			telemetry.QuarantineRuleID: rule.ID,
+			telemetry.Selectors:        rule.Selectors,
+		}).Info("Workload quarantine expired")
+	}
+}
+
+func (q *Quarantine) notifyLocked() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// ParseSelector parses a selector in the type:value format
+func ParseSelector(s string) (*common.Selector, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("selector %q must be in the type:value format", s)
+	}
+	return &common.Selector{Type: parts[0], Value: parts[1]}, nil
+}
+
+func formatSelectors(selectors []*common.Selector) []string {
+	formatted := make([]string, 0, len(selectors))
+	for _, s := range selectors {
+		formatted = append(formatted, s.Type+":"+s.Value)
+	}
+	sort.Strings(formatted)
+	return formatted
+}
+
+func newRuleID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,199 @@
+package quarantine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/spiffe/spire/test/clock"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	imageSelector = &common.Selector{Type: "k8s", Value: "container-image:docker.io/evil@sha256:abc"}
+	nsSelector    = &common.Selector{Type: "k8s", Value: "ns:prod"}
+	uidSelector   = &common.Selector{Type: "unix", Value: "uid:1000"}
+)
+
+func TestAddAndMatch(t *testing.T) {
+	q, clk, hook := setupQuarantine(t)
+
+	rule, err := q.Add([]*common.Selector{nsSelector, imageSelector}, time.Hour, "compromised image")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k8s:container-image:docker.io/evil@sha256:abc", "k8s:ns:prod"}, rule.Selectors)
+	assert.Equal(t, clk.Now().Add(time.Hour).UTC(), rule.ExpiresAt)
+
+	spiretest.AssertLogs(t, hook.AllEntries(), []spiretest.LogEntry{
+		{
+			Level:   logrus.WarnLevel,
+			Message: "Quarantined workloads",
+			Data: logrus.Fields{
+				telemetry.QuarantineRuleID: rule.ID,
+				telemetry.Selectors:        "[k8s:container-image:docker.io/evil@sha256:abc k8s:ns:prod]",
+				telemetry.Reason:           "compromised image",
+				telemetry.ExpiresAt:        rule.ExpiresAt.Format(time.RFC3339),
+			},
+		},
+	})
+
+	// Workloads must be attested with all of the selectors of the rule
+	assert.Equal(t, rule, q.Match([]*common.Selector{uidSelector, nsSelector, imageSelector}))
+	assert.Nil(t, q.Match([]*common.Selector{imageSelector}))
+	assert.Nil(t, q.Match([]*common.Selector{nsSelector, uidSelector}))
+	assert.Equal(t, []*Rule{rule}, q.Rules())
+
+	// Rules stop matching once expired
+	clk.Add(time.Hour)
+	assert.Nil(t, q.Match([]*common.Selector{nsSelector, imageSelector}))
+	assert.Empty(t, q.Rules())
+}
+
+func TestAddValidation(t *testing.T) {
+	q, _, _ := setupQuarantine(t)
+
+	_, err := q.Add(nil, time.Hour, "")
+	assert.EqualError(t, err, "at least one selector is required")
+
+	_, err = q.Add([]*common.Selector{{Type: "k8s"}}, time.Hour, "")
+	assert.EqualError(t, err, "invalid selector: type and value are required")
+
+	_, err = q.Add([]*common.Selector{imageSelector}, 0, "")
+	assert.EqualError(t, err, "duration must be positive")
+
+	_, err = q.Add([]*common.Selector{imageSelector}, 2*time.Hour, "")
+	assert.EqualError(t, err, "duration cannot be longer than 1h0m0s")
+}
+
+func TestRemoveAndChanged(t *testing.T) {
+	q, _, _ := setupQuarantine(t)
+
+	changed := q.Changed()
+	rule, err := q.Add([]*common.Selector{imageSelector}, time.Hour, "")
+	require.NoError(t, err)
+	assertClosed(t, changed)
+
+	changed = q.Changed()
+	assert.False(t, q.Remove("unknown"))
+	assertOpen(t, changed)
+
+	assert.True(t, q.Remove(rule.ID))
+	assertClosed(t, changed)
+	assert.Nil(t, q.Match([]*common.Selector{imageSelector}))
+}
+
+func TestPrune(t *testing.T) {
+	q, clk, hook := setupQuarantine(t)
+
+	rule, err := q.Add([]*common.Selector{imageSelector}, time.Minute, "")
+	require.NoError(t, err)
+	hook.Reset()
+
+	changed := q.Changed()
+	q.prune()
+	assertOpen(t, changed)
+
+	clk.Add(time.Minute)
+	q.prune()
+	assertClosed(t, changed)
+	spiretest.AssertLogs(t, hook.AllEntries(), []spiretest.LogEntry{
+		{
+			Level:   logrus.InfoLevel,
+			Message: "Workload quarantine expired",
+			Data: logrus.Fields{
+				telemetry.QuarantineRuleID: rule.ID,
+				telemetry.Selectors:        "[k8s:container-image:docker.io/evil@sha256:abc]",
+			},
+		},
+	})
+}
+
+func TestAPI(t *testing.T) {
+	q, _, _ := setupQuarantine(t)
+	handler := q.handler()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	for _, tt := range []struct {
+		name      string
+		body      string
+		expectMsg string
+	}{
+		{name: "malformed body", body: "{", expectMsg: "400 invalid request: unexpected EOF"},
+		{name: "invalid duration", body: `{"selectors":["k8s:ns:prod"],"duration":"soon"}`, expectMsg: `400 invalid duration "soon"`},
+		{name: "invalid selector", body: `{"selectors":["k8s"],"duration":"1m"}`, expectMsg: `400 selector "k8s" must be in the type:value format`},
+		{name: "duration too long", body: `{"selectors":["k8s:ns:prod"],"duration":"2h"}`, expectMsg: "400 duration cannot be longer than 1h0m0s"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do(http.MethodPost, "/v1/quarantine", tt.body)
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+			assert.Equal(t, tt.expectMsg, strings.TrimSpace(resp.Body.String()))
+		})
+	}
+
+	resp := do(http.MethodPost, "/v1/quarantine", `{"selectors":["k8s:ns:prod"],"duration":"30m","reason":"incident"}`)
+	require.Equal(t, http.StatusCreated, resp.Code)
+	var added Rule
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&added))
+	assert.Equal(t, []string{"k8s:ns:prod"}, added.Selectors)
+	assert.Equal(t, "incident", added.Reason)
+
+	resp = do(http.MethodGet, "/v1/quarantine", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var rules RulesResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rules))
+	require.Len(t, rules.Rules, 1)
+	assert.Equal(t, added.ID, rules.Rules[0].ID)
+
+	resp = do(http.MethodDelete, "/v1/quarantine", "")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	resp = do(http.MethodDelete, "/v1/quarantine?id=unknown", "")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	resp = do(http.MethodDelete, "/v1/quarantine?id="+added.ID, "")
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Empty(t, q.Rules())
+
+	resp = do(http.MethodPut, "/v1/quarantine", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
+
+func setupQuarantine(t *testing.T) (*Quarantine, *clock.Mock, *test.Hook) {
+	log, hook := test.NewNullLogger()
+	clk := clock.NewMock(t)
+	q := New(Config{
+		MaxDuration: time.Hour,
+		Log:         log,
+		Clock:       clk,
+	})
+	return q, clk, hook
+}
+
+func assertClosed(t *testing.T, ch <-chan struct{}) {
+	select {
+	case <-ch:
+	default:
+		assert.Fail(t, "expected channel to be closed")
+	}
+}
+
+func assertOpen(t *testing.T, ch <-chan struct{}) {
+	select {
+	case <-ch:
+		assert.Fail(t, "expected channel to be open")
+	default:
+	}
+}
@@ -3,6 +3,7 @@ package svid
 import (
 	"crypto"
 	"crypto/x509"
+	"net/url"
 	"sync"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/spiffe/spire/pkg/agent/common/backoff"
 	"github.com/spiffe/spire/pkg/agent/manager/cache"
 	"github.com/spiffe/spire/pkg/agent/plugin/keymanager"
+	"github.com/spiffe/spire/pkg/common/clockskew"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 )
 
@@ -26,12 +28,27 @@ type RotatorConfig struct {
 	Metrics     telemetry.Metrics
 	TrustDomain spiffeid.TrustDomain
 	ServerAddr  string
+	ProxyURL    *url.URL
 	// Initial SVID and key
 	SVID    []*x509.Certificate
 	SVIDKey keymanager.Key
 
 	BundleStream *cache.BundleStream
 
+	// X509AuthoritiesOnly makes the client fetch only the X.509 authorities
+	// of the bundles
+	X509AuthoritiesOnly bool
+
+	// CompressSync makes the client compress the sync payloads
+	CompressSync bool
+
+	// DeltaSync makes the client sync only what changed since the last sync
+	DeltaSync bool
+
+	// ClockSkew, if set, is given the skew of the clock of the server
+	// measured by the client
+	ClockSkew *clockskew.Monitor
+
 	// How long to wait between expiry checks
 	Interval time.Duration
 
@@ -64,7 +81,13 @@ func newRotator(c *RotatorConfig) (*rotator, client.Client) {
 		TrustDomain: c.TrustDomain,
 		Log:         c.Log,
 		Addr:        c.ServerAddr,
+		ProxyURL:    c.ProxyURL,
 		RotMtx:      rotMtx,
+
+		X509AuthoritiesOnly: c.X509AuthoritiesOnly,
+		CompressSync:        c.CompressSync,
+		DeltaSync:           c.DeltaSync,
+		ClockSkew:           c.ClockSkew,
 		KeysAndBundle: func() ([]*x509.Certificate, crypto.Signer, []*x509.Certificate) {
 			s := state.Value().(State)
 
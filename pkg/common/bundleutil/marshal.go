@@ -3,6 +3,7 @@ package bundleutil
 import (
 	"crypto/x509"
 	"encoding/json"
+	"sort"
 	"time"
 
 	"gopkg.in/square/go-jose.v2"
@@ -86,9 +87,16 @@ func Marshal(bundle *Bundle, opts ...MarshalOption) ([]byte, error) {
 	}
 
 	if !c.noJWTSVIDKeys {
-		for keyID, jwtSigningKey := range bundle.JWTSigningKeys() {
+		// Sort the keys so the output of a bundle is stable
+		jwtSigningKeys := bundle.JWTSigningKeys()
+		keyIDs := make([]string, 0, len(jwtSigningKeys))
+		for keyID := range jwtSigningKeys {
+			keyIDs = append(keyIDs, keyID)
+		}
+		sort.Strings(keyIDs)
+		for _, keyID := range keyIDs {
 			jwks.Keys = append(jwks.Keys, jose.JSONWebKey{
-				Key:   jwtSigningKey,
+				Key:   jwtSigningKeys[keyID],
 				KeyID: keyID,
 				Use:   maybeUse(jwtSVIDUse),
 			})
@@ -0,0 +1,134 @@
+// Package clockskew measures the skew between the clocks of the agents and of
+// the server. The server sends its time in a response header of its APIs,
+// which the agents compare with the times they sent the request and received
+// the response. Agents not supporting it ignore the header.
+package clockskew
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	telemetry_agent "github.com/spiffe/spire/pkg/common/telemetry/agent"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// ServerTimeKey is the response header carrying the time of the server
+	// when it started handling the request
+	ServerTimeKey = "spire-server-time"
+
+	// DefaultTolerance is the default clock skew tolerance of the agents,
+	// which is the leeway JWT-SVIDs were always validated with
+	DefaultTolerance = time.Minute
+)
+
+// FormatTime formats the time of the server for the response header
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// ServerTime returns the time of the server carried by the response header,
+// if any
+func ServerTime(header metadata.MD) (time.Time, bool) {
+	values := header.Get(ServerTimeKey)
+	if len(values) == 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, values[0])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Measurement is the skew of the clock of the server relative to the local
+// clock
+type Measurement struct {
+	// Offset is the estimated difference between the clock of the server and
+	// the local clock. It is positive when the server is ahead.
+	Offset time.Duration
+
+	// Uncertainty bounds the error of the estimate: the actual offset is
+	// within Offset ± Uncertainty
+	Uncertainty time.Duration
+}
+
+// Measure estimates the skew of the clock of the server from the time it
+// reported and the local times the request was sent and the response
+// received. The server handled the request in between, so the offset is
+// estimated from the middle of the round trip.
+func Measure(serverTime, sent, received time.Time) Measurement {
+	halfRoundTrip := received.Sub(sent) / 2
+	return Measurement{
+		Offset:      serverTime.Sub(sent.Add(halfRoundTrip)),
+		Uncertainty: halfRoundTrip,
+	}
+}
+
+// Exceeds returns true if the skew exceeds the tolerance, whatever the
+// actual offset is within the uncertainty
+func (m Measurement) Exceeds(tolerance time.Duration) bool {
+	offset := m.Offset
+	if offset < 0 {
+		offset = -offset
+	}
+	return offset-m.Uncertainty > tolerance
+}
+
+// Monitor tracks the skew of the local clock relative to the clock of the
+// server, warning when it goes beyond the tolerance and when it comes back
+// within it. Skewed clocks make the SVIDs look expired or not valid yet.
+type Monitor struct {
+	log       logrus.FieldLogger
+	metrics   telemetry.Metrics
+	tolerance time.Duration
+
+	mtx      sync.Mutex
+	last     Measurement
+	measured bool
+	exceeded bool
+}
+
+// NewMonitor creates a new monitor for the given tolerance
+func NewMonitor(log logrus.FieldLogger, metrics telemetry.Metrics, tolerance time.Duration) *Monitor {
+	return &Monitor{
+		log:       log,
+		metrics:   metrics,
+		tolerance: tolerance,
+	}
+}
+
+// Observe records a measurement of the skew
+func (m *Monitor) Observe(measurement Measurement) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	telemetry_agent.SetClockSkewGauge(m.metrics, measurement.Offset)
+
+	exceeded := measurement.Exceeds(m.tolerance)
+	log := m.log.WithFields(logrus.Fields{
+		"offset":      measurement.Offset.String(),
+		"uncertainty": measurement.Uncertainty.String(),
+		"tolerance":   m.tolerance.String(),
+	})
+	switch {
+	case exceeded && !m.exceeded:
+		log.Warn("Clock skew with the server exceeds the tolerance; SVIDs may be rejected as expired or not yet valid")
+	case !exceeded && m.exceeded:
+		log.Info("Clock skew with the server is back within the tolerance")
+	}
+
+	m.last = measurement
+	m.measured = true
+	m.exceeded = exceeded
+}
+
+// Status returns the last measurement, whether there was any, and whether
+// it exceeded the tolerance
+func (m *Monitor) Status() (last Measurement, measured, exceeded bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.last, m.measured, m.exceeded
+}
@@ -0,0 +1,126 @@
+package clockskew
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/test/fakes/fakemetrics"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestServerTime(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC)
+
+	serverTime, ok := ServerTime(metadata.Pairs(ServerTimeKey, FormatTime(now)))
+	assert.True(t, ok)
+	assert.True(t, now.Equal(serverTime))
+
+	_, ok = ServerTime(metadata.MD{})
+	assert.False(t, ok)
+
+	_, ok = ServerTime(metadata.Pairs(ServerTimeKey, "yesterday"))
+	assert.False(t, ok)
+}
+
+func TestMeasure(t *testing.T) {
+	sent := time.Now()
+	received := sent.Add(2 * time.Second)
+
+	m := Measure(sent.Add(time.Minute), sent, received)
+	assert.Equal(t, Measurement{Offset: 59 * time.Second, Uncertainty: time.Second}, m)
+
+	m = Measure(sent.Add(-time.Minute), sent, received)
+	assert.Equal(t, Measurement{Offset: -61 * time.Second, Uncertainty: time.Second}, m)
+}
+
+func TestMeasurementExceeds(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		measurement Measurement
+		exceeds     bool
+	}{
+		{
+			name:        "within tolerance",
+			measurement: Measurement{Offset: 30 * time.Second},
+		},
+		{
+			name:        "server ahead",
+			measurement: Measurement{Offset: 2 * time.Minute},
+			exceeds:     true,
+		},
+		{
+			name:        "server behind",
+			measurement: Measurement{Offset: -2 * time.Minute},
+			exceeds:     true,
+		},
+		{
+			name:        "within tolerance given the uncertainty",
+			measurement: Measurement{Offset: -2 * time.Minute, Uncertainty: time.Minute},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.exceeds, tt.measurement.Exceeds(time.Minute))
+		})
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	log, hook := test.NewNullLogger()
+	metrics := fakemetrics.New()
+	monitor := NewMonitor(log, metrics, time.Minute)
+
+	_, measured, _ := monitor.Status()
+	assert.False(t, measured)
+
+	// Nothing is logged while the skew is within the tolerance
+	monitor.Observe(Measurement{Offset: time.Second})
+	assert.Empty(t, hook.AllEntries())
+
+	// Exceeding the tolerance is warned once
+	skewed := Measurement{Offset: -2 * time.Minute, Uncertainty: time.Millisecond}
+	monitor.Observe(skewed)
+	monitor.Observe(skewed)
+	last, measured, exceeded := monitor.Status()
+	assert.Equal(t, skewed, last)
+	assert.True(t, measured)
+	assert.True(t, exceeded)
+
+	// And so is recovering
+	monitor.Observe(Measurement{Offset: time.Second})
+	_, _, exceeded = monitor.Status()
+	assert.False(t, exceeded)
+
+	spiretest.AssertLogs(t, hook.AllEntries(), []spiretest.LogEntry{
+		{
+			Level:   logrus.WarnLevel,
+			Message: "Clock skew with the server exceeds the tolerance; SVIDs may be rejected as expired or not yet valid",
+			Data: logrus.Fields{
+				"offset":      "-2m0s",
+				"uncertainty": "1ms",
+				"tolerance":   "1m0s",
+			},
+		},
+		{
+			Level:   logrus.InfoLevel,
+			Message: "Clock skew with the server is back within the tolerance",
+			Data: logrus.Fields{
+				"offset":      "1s",
+				"uncertainty": "0s",
+				"tolerance":   "1m0s",
+			},
+		},
+	})
+
+	assert.Equal(t, []fakemetrics.MetricItem{
+		{Type: fakemetrics.SetGaugeType, Key: []string{telemetry.ClockSkew}, Val: 1},
+		{Type: fakemetrics.SetGaugeType, Key: []string{telemetry.ClockSkew}, Val: -120},
+		{Type: fakemetrics.SetGaugeType, Key: []string{telemetry.ClockSkew}, Val: -120},
+		{Type: fakemetrics.SetGaugeType, Key: []string{telemetry.ClockSkew}, Val: 1},
+	}, metrics.AllMetrics())
+}
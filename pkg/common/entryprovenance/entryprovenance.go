@@ -0,0 +1,68 @@
+// Package entryprovenance carries where registration entries come from, i.e.
+// the Kubernetes cluster, namespace and pod of the workloads the registrar
+// creates them for. It extends the entry API through gRPC metadata: the
+// registrar sends the provenance with the requests creating the entries, and
+// the server records it with the entries it creates, which can then be listed
+// by it.
+package entryprovenance
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// ClusterKey is the request header carrying the cluster of the entries
+	ClusterKey = "spire-provenance-cluster"
+
+	// NamespaceKey is the request header carrying the namespace of the
+	// entries
+	NamespaceKey = "spire-provenance-namespace"
+
+	// PodKey is the request header carrying the pod of the entries
+	PodKey = "spire-provenance-pod"
+)
+
+// Provenance describes where registration entries come from
+type Provenance struct {
+	Cluster   string
+	Namespace string
+	Pod       string
+}
+
+// AppendToOutgoingContext returns a context whose outgoing requests carry the
+// provenance. The fields that are not set are not sent.
+func AppendToOutgoingContext(ctx context.Context, provenance Provenance) context.Context {
+	var kv []string
+	for _, pair := range [][2]string{
+		{ClusterKey, provenance.Cluster},
+		{NamespaceKey, provenance.Namespace},
+		{PodKey, provenance.Pod},
+	} {
+		if pair[1] != "" {
+			kv = append(kv, pair[0], pair[1])
+		}
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// FromIncomingContext returns the provenance carried by the incoming request,
+// if any
+func FromIncomingContext(ctx context.Context) Provenance {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	return Provenance{
+		Cluster:   get(ClusterKey),
+		Namespace: get(NamespaceKey),
+		Pod:       get(PodKey),
+	}
+}
@@ -0,0 +1,34 @@
+package entryprovenance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAppendToOutgoingContext(t *testing.T) {
+	ctx := AppendToOutgoingContext(context.Background(), Provenance{
+		Cluster:   "east",
+		Namespace: "web",
+	})
+	md, ok := metadata.FromOutgoingContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, metadata.Pairs(ClusterKey, "east", NamespaceKey, "web"), md)
+
+	// Nothing is sent without provenance
+	_, ok = metadata.FromOutgoingContext(AppendToOutgoingContext(context.Background(), Provenance{}))
+	require.False(t, ok)
+}
+
+func TestFromIncomingContext(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		ClusterKey, "east",
+		NamespaceKey, "web",
+		PodKey, "web-0",
+	))
+	require.Equal(t, Provenance{Cluster: "east", Namespace: "web", Pod: "web-0"}, FromIncomingContext(ctx))
+
+	require.Equal(t, Provenance{}, FromIncomingContext(context.Background()))
+}
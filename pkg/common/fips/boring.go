@@ -0,0 +1,16 @@
+// +build fips
+
+package fips
+
+import (
+	"crypto/boring"
+
+	// Restricts crypto/tls to the FIPS approved settings
+	_ "crypto/tls/fipsonly"
+)
+
+const fipsBuild = true
+
+func boringEnabled() bool {
+	return boring.Enabled()
+}
@@ -0,0 +1,9 @@
+// +build !fips
+
+package fips
+
+const fipsBuild = false
+
+func boringEnabled() bool {
+	return false
+}
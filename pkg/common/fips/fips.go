@@ -0,0 +1,124 @@
+// Package fips implements the FIPS mode of SPIRE, which restricts the TLS
+// settings, signature algorithms and keys to the FIPS 140-2 approved ones.
+//
+// Binaries built with the fips build tag and the BoringCrypto Go toolchain
+// always run in FIPS mode, with the cryptography of the standard library
+// provided by the BoringCrypto module. Other binaries can turn on FIPS mode
+// by configuration to enforce the same algorithm policy, with the standard
+// library cryptography.
+package fips
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// minRSAKeySize is the minimum size, in bits, of approved RSA keys
+const minRSAKeySize = 2048
+
+var enabled uint32
+
+var (
+	// CipherSuites are the approved TLS 1.2 cipher suites
+	CipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	}
+
+	// CurvePreferences are the approved TLS key exchange curves
+	CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+	approvedSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+		x509.SHA256WithRSA:    true,
+		x509.SHA384WithRSA:    true,
+		x509.SHA512WithRSA:    true,
+		x509.SHA256WithRSAPSS: true,
+		x509.SHA384WithRSAPSS: true,
+		x509.SHA512WithRSAPSS: true,
+		x509.ECDSAWithSHA256:  true,
+		x509.ECDSAWithSHA384:  true,
+		x509.ECDSAWithSHA512:  true,
+	}
+)
+
+// Enable turns on FIPS mode for the process. It can't be turned off.
+func Enable() {
+	atomic.StoreUint32(&enabled, 1)
+}
+
+// Enabled returns whether FIPS mode is on, i.e. it has been enabled or the
+// binary was built with the fips build tag
+func Enabled() bool {
+	return BuildEnabled() || atomic.LoadUint32(&enabled) == 1
+}
+
+// BuildEnabled returns whether the binary was built with the fips build tag
+func BuildEnabled() bool {
+	return fipsBuild
+}
+
+// CheckBuild returns an error if the binary was built with the fips build tag
+// but doesn't use the BoringCrypto module, e.g. because it was built without
+// the BoringCrypto Go toolchain or with cgo disabled
+func CheckBuild() error {
+	if fipsBuild && !boringEnabled() {
+		return errors.New("built for FIPS mode but the BoringCrypto module is not in use; build with the BoringCrypto Go toolchain and cgo enabled")
+	}
+	return nil
+}
+
+// ConfigureTLS restricts the TLS config to the approved protocol version,
+// cipher suites and curves if FIPS mode is on, and returns it. TLS 1.3 is
+// disabled, as its cipher suites can't be restricted by configuration.
+func ConfigureTLS(c *tls.Config) *tls.Config {
+	if c == nil || !Enabled() {
+		return c
+	}
+	c.MinVersion = tls.VersionTLS12
+	c.MaxVersion = tls.VersionTLS12
+	c.CipherSuites = CipherSuites
+	c.CurvePreferences = CurvePreferences
+	return c
+}
+
+// ValidatePublicKey returns an error if the key is not approved, i.e. is not
+// an RSA key of at least 2048 bits or an ECDSA key on the P-256, P-384 or
+// P-521 curves
+func ValidatePublicKey(key crypto.PublicKey) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if size := key.N.BitLen(); size < minRSAKeySize {
+			return fmt.Errorf("RSA key size %d is not FIPS approved, must be at least %d", size, minRSAKeySize)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+			return nil
+		}
+		return fmt.Errorf("ECDSA curve %s is not FIPS approved", key.Curve.Params().Name)
+	default:
+		return fmt.Errorf("key type %T is not FIPS approved", key)
+	}
+}
+
+// ValidateCertificate returns an error if the key or the signature algorithm
+// of the certificate are not approved
+func ValidateCertificate(cert *x509.Certificate) error {
+	if err := ValidatePublicKey(cert.PublicKey); err != nil {
+		return fmt.Errorf("certificate %q: %w", cert.Subject, err)
+	}
+	if !approvedSignatureAlgorithms[cert.SignatureAlgorithm] {
+		return fmt.Errorf("certificate %q: signature algorithm %s is not FIPS approved", cert.Subject, cert.SignatureAlgorithm)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package fips
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/spire/pkg/common/catalog"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/spiffe/spire/test/testkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestConfigureTLS(t *testing.T) {
+	defer atomic.StoreUint32(&enabled, 0)
+
+	c := ConfigureTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	if !BuildEnabled() {
+		assert.Equal(t, &tls.Config{MinVersion: tls.VersionTLS12}, c)
+	}
+
+	Enable()
+	assert.True(t, Enabled())
+	c = ConfigureTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	assert.Equal(t, uint16(tls.VersionTLS12), c.MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS12), c.MaxVersion)
+	assert.Equal(t, CipherSuites, c.CipherSuites)
+	assert.Equal(t, CurvePreferences, c.CurvePreferences)
+	assert.Nil(t, ConfigureTLS(nil))
+}
+
+func TestValidatePublicKey(t *testing.T) {
+	ec224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err)
+	rsa1024, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	ed25519Key, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	assert.NoError(t, ValidatePublicKey(testkey.NewEC256(t).Public()))
+	assert.NoError(t, ValidatePublicKey(testkey.NewRSA2048(t).Public()))
+	assert.EqualError(t, ValidatePublicKey(ec224.Public()), "ECDSA curve P-224 is not FIPS approved")
+	assert.EqualError(t, ValidatePublicKey(rsa1024.Public()), "RSA key size 1024 is not FIPS approved, must be at least 2048")
+	assert.EqualError(t, ValidatePublicKey(ed25519Key), "key type ed25519.PublicKey is not FIPS approved")
+}
+
+func TestValidateCertificate(t *testing.T) {
+	assert.NoError(t, ValidateCertificate(createCertificate(t, testkey.NewEC256(t))))
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	assert.EqualError(t, ValidateCertificate(createCertificate(t, ed25519Key)), `certificate "CN=test": key type ed25519.PublicKey is not FIPS approved`)
+}
+
+func TestValidatePluginConfigs(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	approvedCert := writeCertificate(t, dir, "approved.pem", testkey.NewEC256(t))
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	unapprovedCert := writeCertificate(t, dir, "unapproved.pem", ed25519Key)
+
+	ecdsaSSHKey, err := ssh.NewPublicKey(testkey.NewEC256(t).Public())
+	require.NoError(t, err)
+	ed25519SSHKey, err := ssh.NewPublicKey(ed25519Key.Public())
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name      string
+		config    catalog.PluginConfig
+		expectErr string
+	}{
+		{
+			name:   "approved certificates",
+			config: catalog.PluginConfig{Type: "UpstreamAuthority", Name: "disk", Data: `cert_file_path = "` + approvedCert + `"`},
+		},
+		{
+			name:      "unapproved certificate",
+			config:    catalog.PluginConfig{Type: "NodeAttestor", Name: "x509pop", Data: `ca_bundle_path = "` + unapprovedCert + `"`},
+			expectErr: `plugin NodeAttestor "x509pop" is not FIPS compliant: ` + unapprovedCert + `: certificate "CN=test": key type ed25519.PublicKey is not FIPS approved`,
+		},
+		{
+			name:   "unapproved certificate in disabled plugin",
+			config: catalog.PluginConfig{Type: "NodeAttestor", Name: "x509pop", Data: `ca_bundle_path = "` + unapprovedCert + `"`, Disabled: true},
+		},
+		{
+			name:   "missing certificate file",
+			config: catalog.PluginConfig{Type: "NodeAttestor", Name: "tpm_devid", Data: `devid_ca_path = "` + filepath.Join(dir, "missing.pem") + `"`},
+		},
+		{
+			name:   "approved SSH key",
+			config: catalog.PluginConfig{Type: "NodeAttestor", Name: "sshpop", Data: `cert_authorities = ["` + authorizedKey(ecdsaSSHKey) + `"]`},
+		},
+		{
+			name:      "unapproved SSH key",
+			config:    catalog.PluginConfig{Type: "NodeAttestor", Name: "sshpop", Data: `cert_authorities = ["` + authorizedKey(ed25519SSHKey) + `"]`},
+			expectErr: `plugin NodeAttestor "sshpop" is not FIPS compliant: SSH key type ssh-ed25519 is not FIPS approved`,
+		},
+		{
+			name:      "unapproved AWS PCA signing algorithm",
+			config:    catalog.PluginConfig{Type: "UpstreamAuthority", Name: "awspca", Data: `signing_algorithm = "SHA1WITHRSA"`},
+			expectErr: `plugin UpstreamAuthority "awspca" is not FIPS compliant: signing algorithm SHA1WITHRSA is not FIPS approved`,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			log, _ := test.NewNullLogger()
+			err := ValidatePluginConfigs([]catalog.PluginConfig{tt.config}, log)
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("external plugin", func(t *testing.T) {
+		log, hook := test.NewNullLogger()
+		err := ValidatePluginConfigs([]catalog.PluginConfig{{Type: "KeyManager", Name: "custom", Path: "/path/to/plugin"}}, log)
+		assert.NoError(t, err)
+		spiretest.AssertLogs(t, hook.AllEntries(), []spiretest.LogEntry{
+			{
+				Level:   logrus.WarnLevel,
+				Message: "External plugin is not validated for FIPS mode",
+				Data: logrus.Fields{
+					telemetry.PluginType: "KeyManager",
+					telemetry.PluginName: "custom",
+				},
+			},
+		})
+	})
+}
+
+func createCertificate(t *testing.T, key crypto.Signer) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(certDER)
+	require.NoError(t, err)
+	return cert
+}
+
+func writeCertificate(t *testing.T, dir, name string, key crypto.Signer) string {
+	path := filepath.Join(dir, name)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: createCertificate(t, key).Raw})
+	require.NoError(t, os.WriteFile(path, certPEM, 0600))
+	return path
+}
+
+func authorizedKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
@@ -0,0 +1,176 @@
+package fips
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/hcl"
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/pkg/common/catalog"
+	"github.com/spiffe/spire/pkg/common/pemutil"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"golang.org/x/crypto/ssh"
+)
+
+// pluginChecks validate the key material configured for the built-in plugins,
+// keyed by plugin type and name. The settings of the server and agent plugins
+// of the same type and name are decoded together.
+var pluginChecks = map[string]func(data string) error{
+	"NodeAttestor/sshpop":      checkSSHPOPConfig,
+	"NodeAttestor/tpm_devid":   checkTPMDevIDConfig,
+	"NodeAttestor/x509pop":     checkX509POPConfig,
+	"UpstreamAuthority/awspca": checkAWSPCAConfig,
+	"UpstreamAuthority/disk":   checkDiskUpstreamAuthorityConfig,
+}
+
+// ValidatePluginConfigs returns an error if the key material configured for
+// the built-in plugins is not approved. External plugins are outside of the
+// control of SPIRE, so they are only reported with a warning.
+func ValidatePluginConfigs(configs []catalog.PluginConfig, log logrus.FieldLogger) error {
+	for _, config := range configs {
+		if config.Disabled {
+			continue
+		}
+		if config.IsExternal() {
+			log.WithFields(logrus.Fields{
+				telemetry.PluginType: config.Type,
+				telemetry.PluginName: config.Name,
+			}).Warn("External plugin is not validated for FIPS mode")
+			continue
+		}
+		check := pluginChecks[config.Type+"/"+config.Name]
+		if check == nil {
+			continue
+		}
+		if err := check(config.Data); err != nil {
+			return fmt.Errorf("plugin %s %q is not FIPS compliant: %w", config.Type, config.Name, err)
+		}
+	}
+	return nil
+}
+
+func checkSSHPOPConfig(data string) error {
+	config := struct {
+		HostCertPath        string   `hcl:"host_cert_path"`
+		CertAuthorities     []string `hcl:"cert_authorities"`
+		CertAuthoritiesPath string   `hcl:"cert_authorities_path"`
+	}{}
+	if err := hcl.Decode(&config, data); err != nil {
+		return err
+	}
+
+	var keys []ssh.PublicKey
+	for _, key := range config.CertAuthorities {
+		keys = append(keys, parseAuthorizedKeys([]byte(key))...)
+	}
+	for _, path := range []string{config.HostCertPath, config.CertAuthoritiesPath} {
+		if path == "" {
+			continue
+		}
+		// Files that can't be read are left for the plugin to report
+		if data, err := os.ReadFile(path); err == nil {
+			keys = append(keys, parseAuthorizedKeys(data)...)
+		}
+	}
+
+	for _, pubKey := range keys {
+		if cert, ok := pubKey.(*ssh.Certificate); ok {
+			pubKey = cert.Key
+		}
+		cryptoKey, ok := pubKey.(ssh.CryptoPublicKey)
+		if !ok {
+			return fmt.Errorf("SSH key type %s is not FIPS approved", pubKey.Type())
+		}
+		if err := ValidatePublicKey(cryptoKey.CryptoPublicKey()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkX509POPConfig(data string) error {
+	config := struct {
+		CABundlePath      string   `hcl:"ca_bundle_path"`
+		CABundlePaths     []string `hcl:"ca_bundle_paths"`
+		CertificatePath   string   `hcl:"certificate_path"`
+		IntermediatesPath string   `hcl:"intermediates_path"`
+	}{}
+	if err := hcl.Decode(&config, data); err != nil {
+		return err
+	}
+	paths := append([]string{config.CABundlePath, config.CertificatePath, config.IntermediatesPath}, config.CABundlePaths...)
+	return checkCertificateFiles(paths...)
+}
+
+func checkTPMDevIDConfig(data string) error {
+	config := struct {
+		DevIDBundlePath       string `hcl:"devid_ca_path"`
+		EndorsementBundlePath string `hcl:"endorsement_ca_path"`
+		DevIDCertPath         string `hcl:"devid_cert_path"`
+	}{}
+	if err := hcl.Decode(&config, data); err != nil {
+		return err
+	}
+	return checkCertificateFiles(config.DevIDBundlePath, config.EndorsementBundlePath, config.DevIDCertPath)
+}
+
+func checkDiskUpstreamAuthorityConfig(data string) error {
+	config := struct {
+		CertFilePath   string `hcl:"cert_file_path"`
+		BundleFilePath string `hcl:"bundle_file_path"`
+	}{}
+	if err := hcl.Decode(&config, data); err != nil {
+		return err
+	}
+	return checkCertificateFiles(config.CertFilePath, config.BundleFilePath)
+}
+
+func checkAWSPCAConfig(data string) error {
+	config := struct {
+		SigningAlgorithm string `hcl:"signing_algorithm"`
+	}{}
+	if err := hcl.Decode(&config, data); err != nil {
+		return err
+	}
+	switch config.SigningAlgorithm {
+	case "", "SHA256WITHECDSA", "SHA384WITHECDSA", "SHA512WITHECDSA", "SHA256WITHRSA", "SHA384WITHRSA", "SHA512WITHRSA":
+		return nil
+	default:
+		return fmt.Errorf("signing algorithm %s is not FIPS approved", config.SigningAlgorithm)
+	}
+}
+
+// checkCertificateFiles validates the certificates of the given PEM files.
+// Files that can't be loaded are left for the plugins to report.
+func checkCertificateFiles(paths ...string) error {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		certs, err := pemutil.LoadCertificates(path)
+		if err != nil {
+			continue
+		}
+		for _, cert := range certs {
+			if err := ValidateCertificate(cert); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseAuthorizedKeys parses the keys and certificates in the authorized_keys
+// format. Invalid ones are left for the plugin to report.
+func parseAuthorizedKeys(data []byte) []ssh.PublicKey {
+	var keys []ssh.PublicKey
+	for len(data) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			break
+		}
+		keys = append(keys, key)
+		data = rest
+	}
+	return keys
+}
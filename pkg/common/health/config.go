@@ -1,7 +1,7 @@
 package health
 
 import (
-	"fmt"
+	"github.com/spiffe/spire/pkg/common/util"
 )
 
 type Config struct {
@@ -30,7 +30,7 @@ func (c *Config) getAddress() string {
 		port = c.BindPort
 	}
 
-	return fmt.Sprintf("%s:%s", host, port)
+	return util.JoinHostPort(host, port)
 }
 
 // getReadyPath returns the configured value or a default
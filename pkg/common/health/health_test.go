@@ -20,3 +20,16 @@ func TestServerEnabled(t *testing.T) {
 
 	assert.NotNil(t, checker.server)
 }
+
+func TestServerAddress(t *testing.T) {
+	log, _ := logtest.NewNullLogger()
+
+	checker := NewChecker(Config{ListenerEnabled: true}, log).(*checker)
+	assert.Equal(t, "localhost:80", checker.server.Addr)
+
+	checker = NewChecker(Config{ListenerEnabled: true, BindAddress: "::", BindPort: "8080"}, log).(*checker)
+	assert.Equal(t, "[::]:8080", checker.server.Addr)
+
+	checker = NewChecker(Config{ListenerEnabled: true, BindAddress: "[::1]", BindPort: "8080"}, log).(*checker)
+	assert.Equal(t, "[::1]:8080", checker.server.Addr)
+}
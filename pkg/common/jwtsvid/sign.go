@@ -4,7 +4,10 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/andres-erbsen/clock"
@@ -26,6 +29,28 @@ type Signer struct {
 	c SignerConfig
 }
 
+// TokenOptions are the optional contents of a token
+type TokenOptions struct {
+	// Chain is included in the x5c header, if set. The first certificate of
+	// the chain must be the one of the signing key.
+	Chain []*x509.Certificate
+
+	// Claims are added to the claims set by the signer, which they can't
+	// override.
+	Claims map[string]interface{}
+}
+
+// reservedClaims are the claims set by the signer
+var reservedClaims = map[string]bool{
+	"sub": true,
+	"iss": true,
+	"exp": true,
+	"aud": true,
+	"iat": true,
+	"nbf": true,
+	"jti": true,
+}
+
 func NewSigner(config SignerConfig) *Signer {
 	if config.Clock == nil {
 		config.Clock = clock.New()
@@ -36,6 +61,12 @@ func NewSigner(config SignerConfig) *Signer {
 }
 
 func (s *Signer) SignToken(spiffeID string, audience []string, expires time.Time, signer crypto.Signer, kid string) (string, error) {
+	return s.SignTokenWithOptions(spiffeID, audience, expires, signer, kid, TokenOptions{})
+}
+
+// SignTokenWithOptions signs a token like SignToken, with the given optional
+// contents
+func (s *Signer) SignTokenWithOptions(spiffeID string, audience []string, expires time.Time, signer crypto.Signer, kid string, options TokenOptions) (string, error) {
 	if err := idutil.ValidateSpiffeID(spiffeID, idutil.AllowAnyTrustDomainWorkload()); err != nil {
 		return "", err
 	}
@@ -51,6 +82,11 @@ func (s *Signer) SignToken(spiffeID string, audience []string, expires time.Time
 	if len(kid) == 0 {
 		return "", errors.New("kid is required")
 	}
+	for claim := range options.Claims {
+		if reservedClaims[claim] {
+			return "", fmt.Errorf("claim %q is reserved", claim)
+		}
+	}
 
 	claims := jwt.Claims{
 		Subject:  spiffeID,
@@ -82,6 +118,15 @@ func (s *Signer) SignToken(spiffeID string, audience []string, expires time.Time
 		return "", errs.New("unable to determine signature algorithm for public key type %T", publicKey)
 	}
 
+	opts := new(jose.SignerOptions).WithType("JWT")
+	if len(options.Chain) > 0 {
+		x5c := make([]string, 0, len(options.Chain))
+		for _, cert := range options.Chain {
+			x5c = append(x5c, base64.StdEncoding.EncodeToString(cert.Raw))
+		}
+		opts = opts.WithHeader("x5c", x5c)
+	}
+
 	jwtSigner, err := jose.NewSigner(
 		jose.SigningKey{
 			Algorithm: alg,
@@ -90,13 +135,17 @@ func (s *Signer) SignToken(spiffeID string, audience []string, expires time.Time
 				KeyID: kid,
 			},
 		},
-		new(jose.SignerOptions).WithType("JWT"),
+		opts,
 	)
 	if err != nil {
 		return "", errs.Wrap(err)
 	}
 
-	signedToken, err := jwt.Signed(jwtSigner).Claims(claims).CompactSerialize()
+	builder := jwt.Signed(jwtSigner).Claims(claims)
+	if len(options.Claims) > 0 {
+		builder = builder.Claims(options.Claims)
+	}
+	signedToken, err := builder.CompactSerialize()
 	if err != nil {
 		return "", errs.Wrap(err)
 	}
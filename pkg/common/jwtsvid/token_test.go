@@ -3,6 +3,9 @@ package jwtsvid
 import (
 	"context"
 	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
 	"testing"
 	"time"
 
@@ -188,6 +191,58 @@ func (s *TokenSuite) TestSignAndValidateWithAudienceList() {
 	s.Require().NotEmpty(claims)
 }
 
+func (s *TokenSuite) TestSignAndValidateWithChain() {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, ec256Key.Public(), ec256Key)
+	s.Require().NoError(err)
+	cert, err := x509.ParseCertificate(certDER)
+	s.Require().NoError(err)
+
+	token, err := s.signer.SignTokenWithOptions(fakeSpiffeID, fakeAudience, time.Now().Add(time.Hour), ec256Key, "ec256Key", TokenOptions{
+		Chain: []*x509.Certificate{cert},
+	})
+	s.Require().NoError(err)
+
+	// The chain is verifiable by relying parties using X.509 roots
+	tok, err := jwt.ParseSigned(token)
+	s.Require().NoError(err)
+	s.Require().Len(tok.Headers, 1)
+	s.Require().Equal("ec256Key", tok.Headers[0].KeyID)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	chains, err := tok.Headers[0].Certificates(x509.VerifyOptions{Roots: roots})
+	s.Require().NoError(err)
+	s.Require().Equal(cert, chains[0][0])
+
+	// The token is still valid for JWKS based validation
+	spiffeID, _, err := ValidateToken(ctx, token, s.bundle, fakeAudience)
+	s.Require().NoError(err)
+	s.Require().Equal(fakeSpiffeID, spiffeID)
+}
+
+func (s *TokenSuite) TestSignAndValidateWithClaims() {
+	token, err := s.signer.SignTokenWithOptions(fakeSpiffeID, fakeAudience, time.Now().Add(time.Hour), ec256Key, "ec256Key", TokenOptions{
+		Claims: map[string]interface{}{"cost_center": "1234"},
+	})
+	s.Require().NoError(err)
+
+	spiffeID, claims, err := ValidateToken(ctx, token, s.bundle, fakeAudience)
+	s.Require().NoError(err)
+	s.Require().Equal(fakeSpiffeID, spiffeID)
+	s.Require().Equal("1234", claims["cost_center"])
+	s.Require().Equal(fakeSpiffeID, claims["sub"])
+}
+
+func (s *TokenSuite) TestSignWithReservedClaim() {
+	_, err := s.signer.SignTokenWithOptions(fakeSpiffeID, fakeAudience, time.Now().Add(time.Hour), ec256Key, "ec256Key", TokenOptions{
+		Claims: map[string]interface{}{"sub": "spiffe://example.org/impostor"},
+	})
+	s.Require().EqualError(err, `claim "sub" is reserved`)
+}
+
 func (s *TokenSuite) TestSignWithNoExpiration() {
 	_, err := s.signer.SignToken(fakeSpiffeID, fakeAudience, time.Time{}, ec256Key, "ec256Key")
 	s.Require().EqualError(err, "expiration is required")
@@ -39,7 +39,15 @@ func (t *keyStore) FindPublicKey(ctx context.Context, trustDomainID, keyID strin
 	return publicKey, nil
 }
 
+// ValidateToken validates the token with the default leeway of one minute
+// for clock skew
 func ValidateToken(ctx context.Context, token string, keyStore KeyStore, audience []string) (string, map[string]interface{}, error) {
+	return ValidateTokenWithLeeway(ctx, token, keyStore, audience, jwt.DefaultLeeway)
+}
+
+// ValidateTokenWithLeeway validates the token, accepting tokens that expired
+// or became valid within the leeway to make up for clock skew
+func ValidateTokenWithLeeway(ctx context.Context, token string, keyStore KeyStore, audience []string, leeway time.Duration) (string, map[string]interface{}, error) {
 	tok, err := jwt.ParseSigned(token)
 	if err != nil {
 		return "", nil, errs.New("unable to parse JWT token")
@@ -96,10 +104,10 @@ func ValidateToken(ctx context.Context, token string, keyStore KeyStore, audienc
 
 	// Now that the signature over the claims has been verified, validate the
 	// standard claims.
-	if err := claims.Validate(jwt.Expected{
+	if err := claims.ValidateWithLeeway(jwt.Expected{
 		Audience: audience,
 		Time:     time.Now(),
-	}); err != nil {
+	}, leeway); err != nil {
 		// Convert expected validation errors for pretty errors
 		switch {
 		case errors.Is(err, jwt.ErrExpired):
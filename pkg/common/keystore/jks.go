@@ -0,0 +1,158 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1" // nolint: gosec // required by the JKS key protection and digest
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	jksMagic   = 0xfeedfeed
+	jksVersion = 2
+
+	jksPrivateKeyTag  = 1
+	jksTrustedCertTag = 2
+
+	jksCertType = "X.509"
+
+	// jksDigestWhitener is mixed with the password into the digest that
+	// protects the integrity of the key store
+	jksDigestWhitener = "Mighty Aphrodite"
+)
+
+// oidJKSKeyProtector identifies the proprietary algorithm protecting the
+// private keys of JKS key stores
+var oidJKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// EncodeJKS encodes the X509-SVID private key and certificate chain as a JKS
+// key store, along with the trusted certificates of the bundles, protected
+// with the given password. The private key is protected with the same
+// password.
+func EncodeJKS(key crypto.PrivateKey, chain []*x509.Certificate, trusted []*x509.Certificate, password string) ([]byte, error) {
+	if err := checkFIPS("JKS"); err != nil {
+		return nil, err
+	}
+	if err := checkChain(chain); err != nil {
+		return nil, err
+	}
+	encodedPassword := utf16BE(password)
+
+	protectedKey, err := protectJKSKey(key, encodedPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	w := new(jksWriter)
+	w.writeUint32(jksMagic)
+	w.writeUint32(jksVersion)
+	w.writeUint32(uint32(1 + len(trusted)))
+
+	w.writeUint32(jksPrivateKeyTag)
+	w.writeUTF(KeyAlias)
+	w.writeUint64(timestamp)
+	w.writeBytes(protectedKey)
+	w.writeUint32(uint32(len(chain)))
+	for _, cert := range chain {
+		w.writeCert(cert)
+	}
+
+	for i, cert := range trusted {
+		w.writeUint32(jksTrustedCertTag)
+		w.writeUTF(TrustedAlias(i))
+		w.writeUint64(timestamp)
+		w.writeCert(cert)
+	}
+
+	digest := jksDigest(encodedPassword, w.buf.Bytes())
+	w.buf.Write(digest[:])
+	return w.buf.Bytes(), nil
+}
+
+// protectJKSKey protects the private key like the key protector of the Sun
+// provider does: the key is XORed with a key stream of chained SHA-1 digests
+// of the password, seeded with a random salt, and followed by a digest of the
+// password and the key to check its integrity.
+func protectJKSKey(key crypto.PrivateKey, encodedPassword []byte) ([]byte, error) {
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal private key: %w", err)
+	}
+
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("unable to generate salt: %w", err)
+	}
+
+	protected := make([]byte, 0, 2*sha1.Size+len(pkcs8Key))
+	protected = append(protected, salt...)
+	digest := salt
+	for i := 0; i < len(pkcs8Key); i += sha1.Size {
+		sum := sha1.Sum(concat(encodedPassword, digest)) // nolint: gosec // required by the JKS key protection
+		digest = sum[:]
+		for j := 0; j < sha1.Size && i+j < len(pkcs8Key); j++ {
+			protected = append(protected, pkcs8Key[i+j]^digest[j])
+		}
+	}
+	check := sha1.Sum(concat(encodedPassword, pkcs8Key)) // nolint: gosec // required by the JKS key protection
+	protected = append(protected, check[:]...)
+
+	data, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidJKSKeyProtector,
+			Parameters: asn1.NullRawValue,
+		},
+		EncryptedData: protected,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal JKS protected key: %w", err)
+	}
+	return data, nil
+}
+
+func jksDigest(encodedPassword, data []byte) [sha1.Size]byte {
+	return sha1.Sum(concat(encodedPassword, []byte(jksDigestWhitener), data)) // nolint: gosec // required by the JKS format
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// jksWriter writes the big-endian fields of JKS key stores
+type jksWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *jksWriter) writeUint32(v uint32) {
+	_ = binary.Write(&w.buf, binary.BigEndian, v)
+}
+
+func (w *jksWriter) writeUint64(v uint64) {
+	_ = binary.Write(&w.buf, binary.BigEndian, v)
+}
+
+// writeUTF writes s like Java's DataOutput.writeUTF, which for the ASCII
+// aliases and certificate type written here is the length followed by the
+// bytes of the string
+func (w *jksWriter) writeUTF(s string) {
+	_ = binary.Write(&w.buf, binary.BigEndian, uint16(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *jksWriter) writeBytes(b []byte) {
+	w.writeUint32(uint32(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *jksWriter) writeCert(cert *x509.Certificate) {
+	w.writeUTF(jksCertType)
+	w.writeBytes(cert.Raw)
+}
@@ -0,0 +1,199 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1" // nolint: gosec // required by the JKS format
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/spiffe/spire/test/testca"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeJKS(t *testing.T) {
+	ca := testca.New(t, td)
+	svid := ca.ChildCA().CreateX509SVID(id)
+	trusted := append(ca.X509Authorities(), testca.New(t, td).X509Authorities()...)
+
+	password, err := NewPassword()
+	require.NoError(t, err)
+
+	data, err := EncodeJKS(svid.PrivateKey, svid.Certificates, trusted, password)
+	require.NoError(t, err)
+
+	// The key store integrity is checked with the password
+	_, err = readJKS(data, "not-the-password")
+	require.EqualError(t, err, "digest mismatch")
+
+	entries, err := readJKS(data, password)
+	require.NoError(t, err)
+	require.Len(t, entries, 1+len(trusted))
+
+	assert.Equal(t, KeyAlias, entries[0].alias)
+	assert.Equal(t, svid.PrivateKey, entries[0].key)
+	assert.Equal(t, rawCerts(svid.Certificates), entries[0].certs)
+
+	for i, cert := range trusted {
+		assert.Equal(t, TrustedAlias(i), entries[1+i].alias)
+		assert.Nil(t, entries[1+i].key)
+		assert.Equal(t, [][]byte{cert.Raw}, entries[1+i].certs)
+	}
+}
+
+func TestEncodeJKSNoChain(t *testing.T) {
+	svid := testca.New(t, td).CreateX509SVID(id)
+
+	_, err := EncodeJKS(svid.PrivateKey, nil, nil, "password")
+	require.EqualError(t, err, "no certificates in the SVID chain")
+}
+
+type jksEntry struct {
+	alias string
+	key   crypto.PrivateKey
+	certs [][]byte
+}
+
+// readJKS reads a JKS key store like the Sun provider does, recovering the
+// private keys with the key store password.
+func readJKS(data []byte, password string) ([]jksEntry, error) {
+	encodedPassword := utf16BE(password)
+	if len(data) < sha1.Size {
+		return nil, errors.New("key store too short")
+	}
+	body := data[:len(data)-sha1.Size]
+	digest := jksDigest(encodedPassword, body)
+	if !bytes.Equal(digest[:], data[len(body):]) {
+		return nil, errors.New("digest mismatch")
+	}
+
+	r := &jksReader{r: bytes.NewReader(body)}
+	if magic := r.readUint32(); magic != jksMagic {
+		return nil, errors.New("bad magic")
+	}
+	if version := r.readUint32(); version != jksVersion {
+		return nil, errors.New("bad version")
+	}
+
+	var entries []jksEntry
+	count := r.readUint32()
+	for i := uint32(0); i < count; i++ {
+		var entry jksEntry
+		tag := r.readUint32()
+		entry.alias = r.readUTF()
+		r.readUint64()
+		switch tag {
+		case jksPrivateKeyTag:
+			key, err := recoverJKSKey(r.readBytes(), encodedPassword)
+			if err != nil {
+				return nil, err
+			}
+			entry.key = key
+			for n := r.readUint32(); n > 0; n-- {
+				entry.certs = append(entry.certs, r.readCert())
+			}
+		case jksTrustedCertTag:
+			entry.certs = append(entry.certs, r.readCert())
+		default:
+			return nil, errors.New("bad tag")
+		}
+		entries = append(entries, entry)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.r.Len() != 0 {
+		return nil, errors.New("trailing data")
+	}
+	return entries, nil
+}
+
+func recoverJKSKey(data, encodedPassword []byte) (crypto.PrivateKey, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidJKSKeyProtector) {
+		return nil, errors.New("bad key protection algorithm")
+	}
+
+	protected := info.EncryptedData
+	salt := protected[:sha1.Size]
+	encrypted := protected[sha1.Size : len(protected)-sha1.Size]
+	check := protected[len(protected)-sha1.Size:]
+
+	pkcs8Key := make([]byte, len(encrypted))
+	digest := salt
+	for i := range encrypted {
+		if i%sha1.Size == 0 {
+			sum := sha1.Sum(concat(encodedPassword, digest)) // nolint: gosec // required by the JKS key protection
+			digest = sum[:]
+		}
+		pkcs8Key[i] = encrypted[i] ^ digest[i%sha1.Size]
+	}
+
+	expected := sha1.Sum(concat(encodedPassword, pkcs8Key)) // nolint: gosec // required by the JKS key protection
+	if !bytes.Equal(expected[:], check) {
+		return nil, errors.New("key check mismatch")
+	}
+	return x509.ParsePKCS8PrivateKey(pkcs8Key)
+}
+
+type jksReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (r *jksReader) read(v interface{}) {
+	if r.err == nil {
+		r.err = binary.Read(r.r, binary.BigEndian, v)
+	}
+}
+
+func (r *jksReader) readUint32() (v uint32) {
+	r.read(&v)
+	return v
+}
+
+func (r *jksReader) readUint64() (v uint64) {
+	r.read(&v)
+	return v
+}
+
+func (r *jksReader) readN(n int) []byte {
+	b := make([]byte, n)
+	if r.err == nil {
+		_, r.err = io.ReadFull(r.r, b)
+	}
+	return b
+}
+
+func (r *jksReader) readUTF() string {
+	var n uint16
+	r.read(&n)
+	return string(r.readN(int(n)))
+}
+
+func (r *jksReader) readBytes() []byte {
+	return r.readN(int(r.readUint32()))
+}
+
+func (r *jksReader) readCert() []byte {
+	if certType := r.readUTF(); certType != jksCertType && r.err == nil {
+		r.err = errors.New("bad certificate type")
+	}
+	return r.readBytes()
+}
+
+func rawCerts(certs []*x509.Certificate) [][]byte {
+	var raw [][]byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw)
+	}
+	return raw
+}
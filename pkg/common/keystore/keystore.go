@@ -0,0 +1,76 @@
+// Package keystore encodes X509-SVIDs as PKCS#12 and JKS key stores, for the
+// Java and legacy applications that cannot consume PEM files.
+//
+// PKCS#12 key stores are protected with PBES2, AES-256 and SHA-256, which
+// OpenSSL 1.1.1 and Java 8u301, 11.0.12 or later can read. JKS key stores
+// are protected with the proprietary SHA-1 based algorithms of the format,
+// and are only meant for the applications that can't read PKCS#12. Neither
+// key store format is FIPS approved, so they are refused in FIPS mode. The
+// protection they offer is only as good as the secrecy of the password, so
+// they are meant to be written next to the password with the same file
+// permissions.
+package keystore
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+
+	"github.com/spiffe/spire/pkg/common/fips"
+)
+
+const (
+	// KeyAlias is the alias of the key entry holding the SVID
+	KeyAlias = "svid"
+
+	// passwordSize is the number of random bytes in generated passwords
+	passwordSize = 24
+)
+
+// fipsEnabled returns whether FIPS mode is on. Overridden in tests, since
+// FIPS mode can't be turned off once enabled.
+var fipsEnabled = fips.Enabled
+
+// NewPassword generates a random password for a key store
+func NewPassword() (string, error) {
+	b := make([]byte, passwordSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// TrustedAlias returns the alias of the i-th trusted certificate entry
+func TrustedAlias(i int) string {
+	return fmt.Sprintf("ca.%d", i)
+}
+
+// checkFIPS returns an error if FIPS mode is on, since the key derivations
+// of the key store formats are not FIPS approved
+func checkFIPS(format string) error {
+	if fipsEnabled() {
+		return fmt.Errorf("%s key stores are not available in FIPS mode", format)
+	}
+	return nil
+}
+
+func checkChain(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("no certificates in the SVID chain")
+	}
+	return nil
+}
+
+// utf16BE returns the big-endian UTF-16 encoding of s, which is how both
+// PKCS#12 (as a BMPString) and JKS turn passwords and names into bytes.
+func utf16BE(s string) []byte {
+	runes := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(runes))
+	for _, r := range runes {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return b
+}
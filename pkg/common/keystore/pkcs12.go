@@ -0,0 +1,409 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// pkcs12Iterations is the iteration count of the key derivations, the
+	// same as OpenSSL uses
+	pkcs12Iterations = 2048
+
+	// pkcs12SaltSize is the size of the salts of the key derivations
+	pkcs12SaltSize = 20
+
+	// pkcs12MACID is the purpose of the PKCS#12 key derivation of the MAC
+	// key (RFC 7292 appendix B.3)
+	pkcs12MACID = 3
+
+	// pkcs12BlockSize is the block size of SHA-256, which the PKCS#12 key
+	// derivation works with
+	pkcs12BlockSize = 64
+
+	tagBMPString = 30
+)
+
+var (
+	oidDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPBES2           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA256  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidShroudedKeyBag  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+	// oidJavaTrustedKeyUsage marks the certificates Java loads as trusted
+	// certificate entries, with the any extended key usage as value
+	oidJavaTrustedKeyUsage = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+)
+
+type pfxPDU struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	PRF        pkix.AlgorithmIdentifier
+}
+
+// EncodePKCS12 encodes the X509-SVID private key and certificate chain as a
+// PKCS#12 key store, along with the trusted certificates of the bundles,
+// protected with the given password. The private key is encrypted with
+// PBES2 (PBKDF2 with HMAC-SHA-256, and AES-256-CBC) and the key store
+// integrity is protected with an HMAC-SHA-256, as OpenSSL 3 does by default.
+func EncodePKCS12(key crypto.PrivateKey, chain []*x509.Certificate, trusted []*x509.Certificate, password string) ([]byte, error) {
+	if err := checkFIPS("PKCS#12"); err != nil {
+		return nil, err
+	}
+	if err := checkChain(chain); err != nil {
+		return nil, err
+	}
+	encodedPassword := bmpString(password)
+
+	keyID := sha256.Sum256(chain[0].Raw)
+	keyIDAttribute, err := newAttribute(oidLocalKeyID, keyID[:])
+	if err != nil {
+		return nil, err
+	}
+	nameAttribute, err := newFriendlyNameAttribute(KeyAlias)
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []safeBag
+	for i, cert := range chain {
+		attributes := []pkcs12Attribute{nameAttribute}
+		if i == 0 {
+			attributes = append(attributes, keyIDAttribute)
+		}
+		bag, err := newCertBag(cert, attributes)
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, bag)
+	}
+
+	trustedAttribute, err := newAttribute(oidJavaTrustedKeyUsage, oidAnyExtendedKeyUsage)
+	if err != nil {
+		return nil, err
+	}
+	for i, cert := range trusted {
+		trustedNameAttribute, err := newFriendlyNameAttribute(TrustedAlias(i))
+		if err != nil {
+			return nil, err
+		}
+		bag, err := newCertBag(cert, []pkcs12Attribute{trustedNameAttribute, trustedAttribute})
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, bag)
+	}
+
+	keyBag, err := newShroudedKeyBag(key, []byte(password), []pkcs12Attribute{nameAttribute, keyIDAttribute})
+	if err != nil {
+		return nil, err
+	}
+
+	// The certificates are public, so, like the key stores written by
+	// recent Java versions, they are not encrypted.
+	certsContent, err := newDataContentInfo(certBags)
+	if err != nil {
+		return nil, err
+	}
+	keyContent, err := newDataContentInfo([]safeBag{keyBag})
+	if err != nil {
+		return nil, err
+	}
+	authenticatedSafe, err := asn1.Marshal([]contentInfo{certsContent, keyContent})
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal PKCS#12 authenticated safe: %w", err)
+	}
+
+	mac, err := newMACData(authenticatedSafe, encodedPassword)
+	if err != nil {
+		return nil, err
+	}
+	authSafe, err := newContentInfo(oidDataContentType, authenticatedSafe)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := asn1.Marshal(pfxPDU{
+		Version:  3,
+		AuthSafe: authSafe,
+		MacData:  mac,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal PKCS#12 key store: %w", err)
+	}
+	return data, nil
+}
+
+func newCertBag(cert *x509.Certificate, attributes []pkcs12Attribute) (safeBag, error) {
+	value, err := asn1.Marshal(certBag{
+		ID:   oidX509Certificate,
+		Data: cert.Raw,
+	})
+	if err != nil {
+		return safeBag{}, fmt.Errorf("unable to marshal PKCS#12 certificate bag: %w", err)
+	}
+	return newSafeBag(oidCertBag, value, attributes), nil
+}
+
+// newShroudedKeyBag encrypts the private key with PBES2. Unlike the PKCS#12
+// key derivation, PBKDF2 takes the password as UTF-8 bytes.
+func newShroudedKeyBag(key crypto.PrivateKey, password []byte, attributes []pkcs12Attribute) (safeBag, error) {
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return safeBag{}, fmt.Errorf("unable to marshal private key: %w", err)
+	}
+
+	salt, err := newSalt()
+	if err != nil {
+		return safeBag{}, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return safeBag{}, fmt.Errorf("unable to generate IV: %w", err)
+	}
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: pkcs12Iterations,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return safeBag{}, fmt.Errorf("unable to marshal PBKDF2 parameters: %w", err)
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return safeBag{}, fmt.Errorf("unable to marshal AES parameters: %w", err)
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBKDF2,
+			Parameters: asn1.RawValue{FullBytes: kdfParams},
+		},
+		EncryptionScheme: pkix.AlgorithmIdentifier{
+			Algorithm:  oidAES256CBC,
+			Parameters: asn1.RawValue{FullBytes: ivParam},
+		},
+	})
+	if err != nil {
+		return safeBag{}, fmt.Errorf("unable to marshal PBES2 parameters: %w", err)
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key(password, salt, pkcs12Iterations, 32, sha256.New))
+	if err != nil {
+		return safeBag{}, fmt.Errorf("unable to create key cipher: %w", err)
+	}
+	encrypted := pad(pkcs8Key, block.BlockSize())
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	value, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		EncryptedData: encrypted,
+	})
+	if err != nil {
+		return safeBag{}, fmt.Errorf("unable to marshal PKCS#12 key bag: %w", err)
+	}
+	return newSafeBag(oidShroudedKeyBag, value, attributes), nil
+}
+
+func newSafeBag(id asn1.ObjectIdentifier, value []byte, attributes []pkcs12Attribute) safeBag {
+	return safeBag{
+		ID:         id,
+		Value:      asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value},
+		Attributes: attributes,
+	}
+}
+
+func newDataContentInfo(bags []safeBag) (contentInfo, error) {
+	safeContents, err := asn1.Marshal(bags)
+	if err != nil {
+		return contentInfo{}, fmt.Errorf("unable to marshal PKCS#12 safe contents: %w", err)
+	}
+	return newContentInfo(oidDataContentType, safeContents)
+}
+
+func newContentInfo(contentType asn1.ObjectIdentifier, data []byte) (contentInfo, error) {
+	content, err := asn1.Marshal(data)
+	if err != nil {
+		return contentInfo{}, fmt.Errorf("unable to marshal PKCS#12 content: %w", err)
+	}
+	return contentInfo{
+		ContentType: contentType,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+	}, nil
+}
+
+func newMACData(content, encodedPassword []byte) (macData, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return macData{}, err
+	}
+	mac := hmac.New(sha256.New, pkcs12KDF(sha256.New, pkcs12MACID, encodedPassword, salt, pkcs12Iterations, sha256.Size))
+	_, _ = mac.Write(content)
+	return macData{
+		Mac: digestInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			Digest:    mac.Sum(nil),
+		},
+		MacSalt:    salt,
+		Iterations: pkcs12Iterations,
+	}, nil
+}
+
+func newAttribute(id asn1.ObjectIdentifier, value interface{}) (pkcs12Attribute, error) {
+	b, err := asn1.Marshal(value)
+	if err != nil {
+		return pkcs12Attribute{}, fmt.Errorf("unable to marshal PKCS#12 attribute: %w", err)
+	}
+	return pkcs12Attribute{
+		ID:    id,
+		Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: b},
+	}, nil
+}
+
+func newFriendlyNameAttribute(name string) (pkcs12Attribute, error) {
+	// encoding/asn1 cannot marshal a string as a BMPString
+	return newAttribute(oidFriendlyName, asn1.RawValue{Tag: tagBMPString, Bytes: utf16BE(name)})
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, pkcs12SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("unable to generate salt: %w", err)
+	}
+	return salt, nil
+}
+
+// bmpString returns the password as a null-terminated BMPString, as the
+// PKCS#12 key derivation expects it
+func bmpString(password string) []byte {
+	return append(utf16BE(password), 0, 0)
+}
+
+// pad adds the PKCS#7 padding to data
+func pad(data []byte, blockSize int) []byte {
+	n := blockSize - len(data)%blockSize
+	padded := make([]byte, len(data), len(data)+n)
+	copy(padded, data)
+	return append(padded, bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+// pkcs12KDF derives size bytes of key material for the given purpose from the
+// password and salt, with the given hash, as described in RFC 7292 appendix
+// B.2. The hash must have a block size of pkcs12BlockSize.
+func pkcs12KDF(newHash func() hash.Hash, id byte, password, salt []byte, iterations, size int) []byte {
+	d := bytes.Repeat([]byte{id}, pkcs12BlockSize)
+	var i []byte
+	i = append(i, fillBlocks(salt)...)
+	i = append(i, fillBlocks(password)...)
+
+	var out []byte
+	for len(out) < size {
+		a := make([]byte, 0, len(d)+len(i))
+		a = append(a, d...)
+		a = append(a, i...)
+		for n := 0; n < iterations; n++ {
+			h := newHash()
+			_, _ = h.Write(a)
+			a = h.Sum(nil)
+		}
+		out = append(out, a...)
+
+		// Add B + 1 to each block of I, B being A repeated over a block
+		b := fillBlocks(a)[:pkcs12BlockSize]
+		for j := 0; j < len(i); j += pkcs12BlockSize {
+			block := i[j : j+pkcs12BlockSize]
+			carry := 1
+			for k := pkcs12BlockSize - 1; k >= 0; k-- {
+				carry += int(block[k]) + int(b[k])
+				block[k] = byte(carry)
+				carry >>= 8
+			}
+		}
+	}
+	return out[:size]
+}
+
+// fillBlocks repeats data to fill the smallest number of blocks that can
+// hold it
+func fillBlocks(data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	n := (len(data) + pkcs12BlockSize - 1) / pkcs12BlockSize * pkcs12BlockSize
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = data[i%len(data)]
+	}
+	return out
+}
@@ -0,0 +1,258 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/common/fips"
+	"github.com/spiffe/spire/test/testca"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	td = spiffeid.RequireTrustDomainFromString("example.org")
+	id = td.NewID("/workload")
+)
+
+func TestEncodePKCS12(t *testing.T) {
+	ca := testca.New(t, td)
+	svid := ca.ChildCA().CreateX509SVID(id)
+	trusted := append(ca.X509Authorities(), testca.New(t, td).X509Authorities()...)
+
+	password, err := NewPassword()
+	require.NoError(t, err)
+
+	data, err := EncodePKCS12(svid.PrivateKey, svid.Certificates, trusted, password)
+	require.NoError(t, err)
+
+	// The key store integrity is checked with the password
+	_, err = readPKCS12(data, "not-the-password")
+	require.EqualError(t, err, "MAC mismatch")
+
+	bags, err := readPKCS12(data, password)
+	require.NoError(t, err)
+	require.Len(t, bags, len(svid.Certificates)+len(trusted)+1)
+
+	// The SVID chain comes first, then the trusted certificates
+	for i, cert := range svid.Certificates {
+		assert.Equal(t, cert.Raw, bags[i].cert)
+		assert.Equal(t, KeyAlias, bags[i].name)
+		assert.False(t, bags[i].trusted)
+	}
+	for i, cert := range trusted {
+		bag := bags[len(svid.Certificates)+i]
+		assert.Equal(t, cert.Raw, bag.cert)
+		assert.Equal(t, TrustedAlias(i), bag.name)
+		assert.True(t, bag.trusted)
+		assert.Empty(t, bag.localKeyID)
+	}
+
+	// The key is last, and is linked to the leaf certificate
+	keyBag := bags[len(bags)-1]
+	assert.Equal(t, svid.PrivateKey, keyBag.key)
+	assert.Equal(t, KeyAlias, keyBag.name)
+	assert.NotEmpty(t, keyBag.localKeyID)
+	assert.Equal(t, bags[0].localKeyID, keyBag.localKeyID)
+}
+
+func TestEncodePKCS12NoChain(t *testing.T) {
+	svid := testca.New(t, td).CreateX509SVID(id)
+
+	_, err := EncodePKCS12(svid.PrivateKey, nil, nil, "password")
+	require.EqualError(t, err, "no certificates in the SVID chain")
+}
+
+func TestEncodeKeyStoresFIPS(t *testing.T) {
+	fipsEnabled = func() bool { return true }
+	defer func() { fipsEnabled = fips.Enabled }()
+
+	svid := testca.New(t, td).CreateX509SVID(id)
+
+	_, err := EncodePKCS12(svid.PrivateKey, svid.Certificates, nil, "password")
+	require.EqualError(t, err, "PKCS#12 key stores are not available in FIPS mode")
+	_, err = EncodeJKS(svid.PrivateKey, svid.Certificates, nil, "password")
+	require.EqualError(t, err, "JKS key stores are not available in FIPS mode")
+}
+
+func TestPKCS12KDF(t *testing.T) {
+	// Computed with the PKCS12KDF of OpenSSL 3
+	salt := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	key := pkcs12KDF(sha256.New, pkcs12MACID, bmpString("password"), salt, 2048, 32)
+	assert.Equal(t, "4f510e1b5428cb3a1b784ceee7b1a95670f60e825199c121bd1752ee9e1c83f2", hex.EncodeToString(key))
+}
+
+type pkcs12Bag struct {
+	name       string
+	localKeyID []byte
+	trusted    bool
+	cert       []byte
+	key        crypto.PrivateKey
+}
+
+// readPKCS12 reads a PKCS#12 key store protected like EncodePKCS12 protects
+// them, checking its MAC and decrypting the private keys with the password.
+func readPKCS12(data []byte, password string) ([]pkcs12Bag, error) {
+	var pfx pfxPDU
+	if err := unmarshal(data, &pfx); err != nil {
+		return nil, err
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
+		return nil, errors.New("bad content type")
+	}
+	var authenticatedSafe []byte
+	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &authenticatedSafe); err != nil {
+		return nil, err
+	}
+
+	if !pfx.MacData.Mac.Algorithm.Algorithm.Equal(oidSHA256) {
+		return nil, errors.New("bad MAC algorithm")
+	}
+	mac := hmac.New(sha256.New, pkcs12KDF(sha256.New, pkcs12MACID, bmpString(password), pfx.MacData.MacSalt, pfx.MacData.Iterations, sha256.Size))
+	_, _ = mac.Write(authenticatedSafe)
+	if !hmac.Equal(mac.Sum(nil), pfx.MacData.Mac.Digest) {
+		return nil, errors.New("MAC mismatch")
+	}
+
+	var contents []contentInfo
+	if err := unmarshal(authenticatedSafe, &contents); err != nil {
+		return nil, err
+	}
+	var bags []pkcs12Bag
+	for _, content := range contents {
+		if !content.ContentType.Equal(oidDataContentType) {
+			return nil, errors.New("bad content type")
+		}
+		var safeContents []byte
+		if err := unmarshal(content.Content.Bytes, &safeContents); err != nil {
+			return nil, err
+		}
+		var safeBags []safeBag
+		if err := unmarshal(safeContents, &safeBags); err != nil {
+			return nil, err
+		}
+		for _, raw := range safeBags {
+			bag, err := readPKCS12Bag(raw, password)
+			if err != nil {
+				return nil, err
+			}
+			bags = append(bags, bag)
+		}
+	}
+	return bags, nil
+}
+
+func readPKCS12Bag(raw safeBag, password string) (pkcs12Bag, error) {
+	var bag pkcs12Bag
+	for _, attribute := range raw.Attributes {
+		switch {
+		case attribute.ID.Equal(oidFriendlyName):
+			var name asn1.RawValue
+			if err := unmarshal(attribute.Value.Bytes, &name); err != nil {
+				return bag, err
+			}
+			if name.Tag != tagBMPString || len(name.Bytes)%2 != 0 {
+				return bag, errors.New("bad friendly name")
+			}
+			runes := make([]uint16, 0, len(name.Bytes)/2)
+			for i := 0; i < len(name.Bytes); i += 2 {
+				runes = append(runes, uint16(name.Bytes[i])<<8|uint16(name.Bytes[i+1]))
+			}
+			bag.name = string(utf16.Decode(runes))
+		case attribute.ID.Equal(oidLocalKeyID):
+			if err := unmarshal(attribute.Value.Bytes, &bag.localKeyID); err != nil {
+				return bag, err
+			}
+		case attribute.ID.Equal(oidJavaTrustedKeyUsage):
+			bag.trusted = true
+		}
+	}
+
+	switch {
+	case raw.ID.Equal(oidCertBag):
+		var cert certBag
+		if err := unmarshal(raw.Value.Bytes, &cert); err != nil {
+			return bag, err
+		}
+		if !cert.ID.Equal(oidX509Certificate) {
+			return bag, errors.New("bad certificate type")
+		}
+		bag.cert = cert.Data
+	case raw.ID.Equal(oidShroudedKeyBag):
+		key, err := decryptPKCS12Key(raw.Value.Bytes, password)
+		if err != nil {
+			return bag, err
+		}
+		bag.key = key
+	default:
+		return bag, errors.New("bad bag type")
+	}
+	return bag, nil
+}
+
+func decryptPKCS12Key(data []byte, password string) (crypto.PrivateKey, error) {
+	var info encryptedPrivateKeyInfo
+	if err := unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("bad key encryption algorithm")
+	}
+	var params pbes2Params
+	if err := unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) || !params.EncryptionScheme.Algorithm.Equal(oidAES256CBC) {
+		return nil, errors.New("bad PBES2 algorithms")
+	}
+	var kdfParams pbkdf2Params
+	if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, err
+	}
+	if !kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256) {
+		return nil, errors.New("bad PBKDF2 PRF")
+	}
+	var iv []byte
+	if err := unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(password), kdfParams.Salt, kdfParams.Iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("bad encrypted key")
+	}
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.EncryptedData)
+
+	n := int(decrypted[len(decrypted)-1])
+	if n == 0 || n > block.BlockSize() || !bytes.Equal(decrypted[len(decrypted)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, errors.New("bad padding")
+	}
+	return x509.ParsePKCS8PrivateKey(decrypted[:len(decrypted)-n])
+}
+
+func unmarshal(data []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(data, v)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("trailing data")
+	}
+	return nil
+}
@@ -17,20 +17,33 @@ func IsAgentBanned(node *common.AttestedNode) bool {
 
 // ShouldAgentReattest returns true if the Server returned an error worth rebooting the Agent
 func ShouldAgentReattest(err error) bool {
+	switch permissionDeniedReason(err) {
+	case types.PermissionDeniedDetails_AGENT_EXPIRED,
+		types.PermissionDeniedDetails_AGENT_NOT_ACTIVE,
+		types.PermissionDeniedDetails_AGENT_NOT_ATTESTED:
+		return true
+	}
+	return false
+}
+
+// IsAgentBannedError returns true if the Server returned an error because the
+// Agent is banned
+func IsAgentBannedError(err error) bool {
+	return permissionDeniedReason(err) == types.PermissionDeniedDetails_AGENT_BANNED
+}
+
+// permissionDeniedReason returns the reason in the details of a
+// PermissionDenied error returned by the Server, or UNKNOWN if there is none
+func permissionDeniedReason(err error) types.PermissionDeniedDetails_Reason {
 	errStatus := status.Convert(errors.Unwrap(err))
 	if errStatus.Code() != codes.PermissionDenied {
-		return false
+		return types.PermissionDeniedDetails_UNKNOWN
 	}
 
 	for _, errDetail := range errStatus.Details() {
 		if details, ok := errDetail.(*types.PermissionDeniedDetails); ok {
-			switch details.Reason {
-			case types.PermissionDeniedDetails_AGENT_EXPIRED,
-				types.PermissionDeniedDetails_AGENT_NOT_ACTIVE,
-				types.PermissionDeniedDetails_AGENT_NOT_ATTESTED:
-				return true
-			}
+			return details.Reason
 		}
 	}
-	return false
+	return types.PermissionDeniedDetails_UNKNOWN
 }
@@ -48,6 +48,21 @@ func TestShouldAgentReattest(t *testing.T) {
 	require.False(t, nodeutil.ShouldAgentReattest(getError(t, codes.PermissionDenied, nil)))
 }
 
+func TestIsAgentBannedError(t *testing.T) {
+	agentBanned := &types.PermissionDeniedDetails{
+		Reason: types.PermissionDeniedDetails_AGENT_BANNED,
+	}
+	agentExpired := &types.PermissionDeniedDetails{
+		Reason: types.PermissionDeniedDetails_AGENT_EXPIRED,
+	}
+
+	require.False(t, nodeutil.IsAgentBannedError(nil))
+	require.True(t, nodeutil.IsAgentBannedError(getError(t, codes.PermissionDenied, agentBanned)))
+	require.False(t, nodeutil.IsAgentBannedError(getError(t, codes.PermissionDenied, agentExpired)))
+	require.False(t, nodeutil.IsAgentBannedError(getError(t, codes.Unknown, agentBanned)))
+	require.False(t, nodeutil.IsAgentBannedError(getError(t, codes.PermissionDenied, nil)))
+}
+
 func getError(t *testing.T, code codes.Code, details proto.Message) error {
 	st := status.New(code, "some error")
 	if details != nil {
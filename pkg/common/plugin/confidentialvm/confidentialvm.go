@@ -0,0 +1,38 @@
+package confidentialvm
+
+const (
+	// PluginName for confidential VM attestation
+	PluginName = "confidential_vm"
+
+	// TypeSEVSNP is the type of AMD SEV-SNP guests
+	TypeSEVSNP = "sev_snp"
+
+	// TypeTDX is the type of Intel TDX guests
+	TypeTDX = "tdx"
+
+	// NonceSize is the size of the report data of both SEV-SNP attestation
+	// reports and TDX quotes, which carries the nonce of the challenge.
+	NonceSize = 64
+)
+
+type AttestationData struct {
+	// Type is the type of confidential VM the agent runs in, i.e. TypeSEVSNP
+	// or TypeTDX.
+	Type string `json:"type"`
+}
+
+type Challenge struct {
+	// Nonce is the nonce generated by the server, which the agent has the
+	// hardware include as report data in the attestation evidence.
+	Nonce []byte `json:"nonce"`
+}
+
+type Response struct {
+	// Evidence is the SEV-SNP attestation report or the TDX quote.
+	Evidence []byte `json:"evidence"`
+
+	// Certificates is the DER encoded certificate chain of the key that
+	// signed a SEV-SNP attestation report, VCEK first. TDX quotes embed
+	// their certificate chain.
+	Certificates [][]byte `json:"certificates,omitempty"`
+}
@@ -0,0 +1,19 @@
+package profiling
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// Handler returns a handler serving the runtime profiles under /debug/pprof/,
+// in the format expected by the pprof tool. It doesn't depend on the default
+// mux, so it can be served behind the authorization of the admin interfaces.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,203 @@
+// Package syncdelta implements the delta encoding of the entries and bundles
+// agents sync from the server. It extends the entry and bundle APIs through
+// gRPC metadata, so agents and servers not supporting it keep exchanging the
+// whole payloads.
+//
+// An agent asks for a delta of its authorized entries by sending the token
+// of the entries it holds, which is empty on the first sync. The server
+// answers with the changed entries and the IDs of the removed ones if it
+// still has a snapshot of the entries it last sent the agent for that token,
+// or else with all the entries. The token is derived from the content hashes
+// of the entries, so the agent can verify the entries it rebuilds.
+package syncdelta
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// EntriesTokenKey is the request header carrying the token of the
+	// entries the agent holds, and the response trailer carrying the token
+	// of the entries after the sync
+	EntriesTokenKey = "spire-sync-entries-token"
+
+	// EntriesModeKey is the response trailer telling whether the response
+	// holds all the entries (ModeFull) or only the changed ones (ModeDelta)
+	EntriesModeKey = "spire-sync-entries-mode"
+
+	// RemovedEntriesKey is the response trailer carrying the IDs of the
+	// entries removed since the token sent by the agent, in ModeDelta
+	RemovedEntriesKey = "spire-sync-removed-entries"
+
+	// BundleHashKey is the request header carrying the content hash of the
+	// bundle the agent holds
+	BundleHashKey = "spire-sync-bundle-hash"
+
+	// BundleUnchangedKey is the response trailer set when the bundle has the
+	// hash sent by the agent. The response then holds no authorities.
+	BundleUnchangedKey = "spire-sync-bundle-unchanged"
+
+	ModeFull  = "full"
+	ModeDelta = "delta"
+
+	// maxRemovedEntries bounds the size of the removed entries trailer.
+	// All the entries are sent when more were removed.
+	maxRemovedEntries = 512
+
+	// snapshotTTL is how long the snapshot of an agent not syncing is kept
+	snapshotTTL = time.Hour
+)
+
+// EntryHash returns the content hash of the entry
+func EntryHash(entry *types.Entry) (string, error) {
+	return hashMessage(entry)
+}
+
+// BundleHash returns the content hash of the bundle
+func BundleHash(bundle *types.Bundle) (string, error) {
+	return hashMessage(bundle)
+}
+
+func hashMessage(m proto.Message) (string, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Token returns the token of the entries with the given content hashes,
+// keyed by entry ID
+func Token(hashes map[string]string) string {
+	ids := make([]string, 0, len(hashes))
+	for id := range hashes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	h := sha256.New()
+	for _, id := range ids {
+		_, _ = h.Write([]byte(id))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(hashes[id]))
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Delta is what is sent to an agent syncing its entries
+type Delta struct {
+	// Mode is ModeFull if Entries are all the entries, or ModeDelta if they
+	// are only those added or changed since the token sent by the agent
+	Mode string
+
+	Entries []*types.Entry
+
+	// Removed are the IDs of the entries removed since the token, in
+	// ModeDelta
+	Removed []string
+
+	// Token is the token of all the entries
+	Token string
+}
+
+type snapshot struct {
+	token    string
+	hashes   map[string]string
+	lastUsed time.Time
+}
+
+// Snapshots holds the content hashes of the entries last sent to each agent,
+// so the next sync of the agent only sends what changed since.
+type Snapshots struct {
+	clk clock.Clock
+
+	mu        sync.Mutex
+	snapshots map[string]*snapshot
+	lastSweep time.Time
+}
+
+func NewSnapshots(clk clock.Clock) *Snapshots {
+	return &Snapshots{
+		clk:       clk,
+		snapshots: make(map[string]*snapshot),
+		lastSweep: clk.Now(),
+	}
+}
+
+// Delta returns what to send to the agent, which holds the entries with the
+// given token, so it ends up with the given entries. The entries become the
+// snapshot of the agent.
+func (s *Snapshots) Delta(agentID, token string, entries []*types.Entry) (*Delta, error) {
+	hashes := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		hash, err := EntryHash(entry)
+		if err != nil {
+			return nil, err
+		}
+		hashes[entry.Id] = hash
+	}
+	current := &snapshot{
+		token:    Token(hashes),
+		hashes:   hashes,
+		lastUsed: s.clk.Now(),
+	}
+
+	s.mu.Lock()
+	previous := s.snapshots[agentID]
+	s.snapshots[agentID] = current
+	s.sweep(current.lastUsed)
+	s.mu.Unlock()
+
+	full := &Delta{
+		Mode:    ModeFull,
+		Entries: entries,
+		Token:   current.token,
+	}
+	if token == "" || previous == nil || previous.token != token {
+		return full, nil
+	}
+
+	delta := &Delta{
+		Mode:  ModeDelta,
+		Token: current.token,
+	}
+	for _, entry := range entries {
+		if previous.hashes[entry.Id] != hashes[entry.Id] {
+			delta.Entries = append(delta.Entries, entry)
+		}
+	}
+	for id := range previous.hashes {
+		if _, ok := hashes[id]; !ok {
+			delta.Removed = append(delta.Removed, id)
+		}
+	}
+	if len(delta.Removed) > maxRemovedEntries {
+		return full, nil
+	}
+	sort.Strings(delta.Removed)
+	return delta, nil
+}
+
+// sweep drops the snapshots of the agents that stopped syncing, at most
+// once per snapshot TTL
+func (s *Snapshots) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < snapshotTTL {
+		return
+	}
+	s.lastSweep = now
+	for agentID, snapshot := range s.snapshots {
+		if now.Sub(snapshot.lastUsed) >= snapshotTTL {
+			delete(s.snapshots, agentID)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package syncdelta
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/test/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken(t *testing.T) {
+	assert.Equal(t,
+		Token(map[string]string{"A": "1", "B": "2"}),
+		Token(map[string]string{"B": "2", "A": "1"}))
+	assert.NotEqual(t,
+		Token(map[string]string{"A": "1", "B": "2"}),
+		Token(map[string]string{"A": "2", "B": "1"}))
+	assert.NotEqual(t,
+		Token(map[string]string{"A": "1"}),
+		Token(map[string]string{"A1": ""}))
+}
+
+func TestBundleHash(t *testing.T) {
+	bundle := &types.Bundle{
+		TrustDomain:     "example.org",
+		X509Authorities: []*types.X509Certificate{{Asn1: []byte{1}}},
+	}
+	hash1, err := BundleHash(bundle)
+	require.NoError(t, err)
+	hash2, err := BundleHash(&types.Bundle{
+		TrustDomain:     "example.org",
+		X509Authorities: []*types.X509Certificate{{Asn1: []byte{1}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, hash1, hash2)
+
+	bundle.RefreshHint = 10
+	hash3, err := BundleHash(bundle)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash1, hash3)
+}
+
+func TestSnapshotsDelta(t *testing.T) {
+	snapshots := NewSnapshots(clock.NewMock(t))
+
+	entryA := &types.Entry{Id: "A", RevisionNumber: 1}
+	entryB := &types.Entry{Id: "B", RevisionNumber: 1}
+	entryC := &types.Entry{Id: "C", RevisionNumber: 1}
+
+	// The first sync gets all the entries
+	delta, err := snapshots.Delta("agent", "", []*types.Entry{entryA, entryB})
+	require.NoError(t, err)
+	assert.Equal(t, ModeFull, delta.Mode)
+	assert.Equal(t, []*types.Entry{entryA, entryB}, delta.Entries)
+	assert.Empty(t, delta.Removed)
+	assert.Equal(t, Token(map[string]string{
+		"A": mustEntryHash(t, entryA),
+		"B": mustEntryHash(t, entryB),
+	}), delta.Token)
+
+	// The next sync only gets the added and changed entries, and the IDs of
+	// the removed ones
+	entryAChanged := &types.Entry{Id: "A", RevisionNumber: 2}
+	delta, err = snapshots.Delta("agent", delta.Token, []*types.Entry{entryAChanged, entryC})
+	require.NoError(t, err)
+	assert.Equal(t, ModeDelta, delta.Mode)
+	assert.Equal(t, []*types.Entry{entryAChanged, entryC}, delta.Entries)
+	assert.Equal(t, []string{"B"}, delta.Removed)
+	token := delta.Token
+
+	// Nothing is sent when nothing changed
+	delta, err = snapshots.Delta("agent", token, []*types.Entry{entryAChanged, entryC})
+	require.NoError(t, err)
+	assert.Equal(t, ModeDelta, delta.Mode)
+	assert.Empty(t, delta.Entries)
+	assert.Empty(t, delta.Removed)
+	assert.Equal(t, token, delta.Token)
+
+	// All the entries are sent when the token is unknown
+	delta, err = snapshots.Delta("agent", "unknown", []*types.Entry{entryAChanged, entryC})
+	require.NoError(t, err)
+	assert.Equal(t, ModeFull, delta.Mode)
+	assert.Equal(t, []*types.Entry{entryAChanged, entryC}, delta.Entries)
+
+	// ... and when the token is of another agent
+	delta, err = snapshots.Delta("other", token, []*types.Entry{entryAChanged, entryC})
+	require.NoError(t, err)
+	assert.Equal(t, ModeFull, delta.Mode)
+}
+
+func TestSnapshotsDeltaTooManyRemoved(t *testing.T) {
+	snapshots := NewSnapshots(clock.NewMock(t))
+
+	var entries []*types.Entry
+	for i := 0; i <= maxRemovedEntries; i++ {
+		entries = append(entries, &types.Entry{Id: fmt.Sprintf("%d", i)})
+	}
+	delta, err := snapshots.Delta("agent", "", entries)
+	require.NoError(t, err)
+
+	delta, err = snapshots.Delta("agent", delta.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, ModeFull, delta.Mode)
+	assert.Empty(t, delta.Entries)
+	assert.Empty(t, delta.Removed)
+}
+
+func TestSnapshotsSweep(t *testing.T) {
+	clk := clock.NewMock(t)
+	snapshots := NewSnapshots(clk)
+
+	entries := []*types.Entry{{Id: "A"}}
+	idle, err := snapshots.Delta("idle", "", entries)
+	require.NoError(t, err)
+
+	clk.Add(snapshotTTL / 2)
+	active, err := snapshots.Delta("active", "", entries)
+	require.NoError(t, err)
+
+	// The snapshot of the agent that stopped syncing is dropped
+	clk.Add(snapshotTTL / 2)
+	delta, err := snapshots.Delta("active", active.Token, entries)
+	require.NoError(t, err)
+	assert.Equal(t, ModeDelta, delta.Mode)
+
+	delta, err = snapshots.Delta("idle", idle.Token, entries)
+	require.NoError(t, err)
+	assert.Equal(t, ModeFull, delta.Mode)
+
+	// Snapshots in use are kept
+	clk.Add(time.Minute)
+	delta, err = snapshots.Delta("active", active.Token, entries)
+	require.NoError(t, err)
+	assert.Equal(t, ModeDelta, delta.Mode)
+}
+
+func mustEntryHash(t *testing.T, entry *types.Entry) string {
+	hash, err := EntryHash(entry)
+	require.NoError(t, err)
+	return hash
+}
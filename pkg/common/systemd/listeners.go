@@ -0,0 +1,109 @@
+package systemd
+
+import (
+	"net"
+	"path/filepath"
+	"sync"
+)
+
+var activation struct {
+	once      sync.Once
+	mu        sync.Mutex
+	listeners []net.Listener
+	err       error
+}
+
+// ListenTCP returns the listener bound to the address that was passed by
+// systemd socket activation, if any, or else announces on the address.
+func ListenTCP(network string, laddr *net.TCPAddr) (net.Listener, error) {
+	l, err := takeListener(laddr)
+	if err != nil || l != nil {
+		return l, err
+	}
+	return net.ListenTCP(network, laddr)
+}
+
+// ListenUnix returns the listener bound to the socket path that was passed
+// by systemd socket activation, if any, or else announces on the socket
+// path. Its signature matches net.ListenUnix so it can be used with the
+// peertracker listener factory.
+func ListenUnix(network string, laddr *net.UnixAddr) (*net.UnixListener, error) {
+	l, err := takeListener(laddr)
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := l.(*net.UnixListener); ok {
+		return l, nil
+	}
+	return net.ListenUnix(network, laddr)
+}
+
+// IsSocketActivated returns true if a listener bound to the address was
+// passed by systemd socket activation. Callers must then leave the socket
+// file, and its permissions, to systemd.
+func IsSocketActivated(addr net.Addr) bool {
+	loadListeners()
+
+	activation.mu.Lock()
+	defer activation.mu.Unlock()
+	for _, l := range activation.listeners {
+		if addrMatches(l.Addr(), addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadListeners() {
+	activation.once.Do(func() {
+		activation.listeners, activation.err = inheritedListeners()
+	})
+}
+
+// takeListener returns the listener bound to the address passed by systemd
+// socket activation, if any. Each listener is only returned once.
+func takeListener(addr net.Addr) (net.Listener, error) {
+	loadListeners()
+
+	activation.mu.Lock()
+	defer activation.mu.Unlock()
+	if activation.err != nil {
+		return nil, activation.err
+	}
+	for i, l := range activation.listeners {
+		if addrMatches(l.Addr(), addr) {
+			activation.listeners = append(activation.listeners[:i], activation.listeners[i+1:]...)
+			return l, nil
+		}
+	}
+	return nil, nil
+}
+
+func addrMatches(actual, wanted net.Addr) bool {
+	switch wanted := wanted.(type) {
+	case *net.UnixAddr:
+		actual, ok := actual.(*net.UnixAddr)
+		return ok && samePath(actual.Name, wanted.Name)
+	case *net.TCPAddr:
+		actual, ok := actual.(*net.TCPAddr)
+		if !ok || actual.Port != wanted.Port {
+			return false
+		}
+		return actual.IP.Equal(wanted.IP) || (isUnspecified(actual.IP) && isUnspecified(wanted.IP))
+	default:
+		return false
+	}
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return absA == absB
+}
+
+func isUnspecified(ip net.IP) bool {
+	return len(ip) == 0 || ip.IsUnspecified()
+}
@@ -0,0 +1,54 @@
+// +build linux
+
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+const (
+	listenPIDEnv     = "LISTEN_PID"
+	listenFDsEnv     = "LISTEN_FDS"
+	listenFDNamesEnv = "LISTEN_FDNAMES"
+
+	// listenFDsStart is the first file descriptor passed by systemd
+	listenFDsStart = 3
+)
+
+// inheritedListeners returns the listeners passed by systemd socket
+// activation. The environment variables are unset so they are not
+// inherited by child processes, e.g. plugins.
+func inheritedListeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv(listenPIDEnv)
+		os.Unsetenv(listenFDsEnv)
+		os.Unsetenv(listenFDNamesEnv)
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv(listenPIDEnv))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv(listenFDsEnv))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	listeners := make([]net.Listener, 0, count)
+	for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+		syscall.CloseOnExec(fd)
+
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation file descriptor %d is not a listening socket: %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,9 @@
+// +build !linux
+
+package systemd
+
+import "net"
+
+func inheritedListeners() ([]net.Listener, error) {
+	return nil, nil
+}
@@ -0,0 +1,84 @@
+package systemd
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddrMatches(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name   string
+		actual net.Addr
+		wanted net.Addr
+		match  bool
+	}{
+		{
+			name:   "same socket path",
+			actual: &net.UnixAddr{Net: "unix", Name: filepath.Join(dir, "api.sock")},
+			wanted: &net.UnixAddr{Net: "unix", Name: filepath.Join(dir, ".", "api.sock")},
+			match:  true,
+		},
+		{
+			name:   "different socket path",
+			actual: &net.UnixAddr{Net: "unix", Name: filepath.Join(dir, "api.sock")},
+			wanted: &net.UnixAddr{Net: "unix", Name: filepath.Join(dir, "other.sock")},
+		},
+		{
+			name:   "same TCP address",
+			actual: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8081},
+			wanted: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8081},
+			match:  true,
+		},
+		{
+			name:   "unspecified TCP addresses",
+			actual: &net.TCPAddr{IP: net.IPv6unspecified, Port: 8081},
+			wanted: &net.TCPAddr{IP: net.IPv4zero, Port: 8081},
+			match:  true,
+		},
+		{
+			name:   "different TCP port",
+			actual: &net.TCPAddr{IP: net.IPv4zero, Port: 8081},
+			wanted: &net.TCPAddr{IP: net.IPv4zero, Port: 8082},
+		},
+		{
+			name:   "different TCP IP",
+			actual: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8081},
+			wanted: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 8081},
+		},
+		{
+			name:   "different networks",
+			actual: &net.UnixAddr{Net: "unix", Name: "8081"},
+			wanted: &net.TCPAddr{Port: 8081},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.match, addrMatches(tt.actual, tt.wanted))
+		})
+	}
+}
+
+func TestListenUnixTakesActivatedListener(t *testing.T) {
+	addr := &net.UnixAddr{Net: "unix", Name: filepath.Join(t.TempDir(), "api.sock")}
+	activated, err := net.ListenUnix(addr.Network(), addr)
+	require.NoError(t, err)
+	defer activated.Close()
+
+	loadListeners()
+	activation.mu.Lock()
+	activation.listeners = append(activation.listeners, activated)
+	activation.mu.Unlock()
+
+	require.True(t, IsSocketActivated(addr))
+	l, err := ListenUnix(addr.Network(), addr)
+	require.NoError(t, err)
+	require.Same(t, activated, l)
+
+	// The listener is only handed out once
+	require.False(t, IsSocketActivated(addr))
+}
@@ -0,0 +1,138 @@
+// Package systemd integrates the server and agent with systemd: readiness,
+// watchdog and shutdown notifications (see sd_notify(3)) and socket
+// activation (see sd_listen_fds(3)).
+package systemd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/pkg/common/health"
+)
+
+const (
+	notifySocketEnv = "NOTIFY_SOCKET"
+	watchdogUSecEnv = "WATCHDOG_USEC"
+	watchdogPIDEnv  = "WATCHDOG_PID"
+
+	stateReady    = "READY=1"
+	stateStopping = "STOPPING=1"
+	stateWatchdog = "WATCHDOG=1"
+)
+
+// Notifier notifies systemd of the state of the service. It is a no-op
+// unless the service is run by systemd with Type=notify.
+type Notifier struct {
+	log       logrus.FieldLogger
+	checkable health.Checkable
+	clk       clock.Clock
+
+	socket   string
+	watchdog time.Duration
+}
+
+// NewNotifier returns a notifier that pings the systemd watchdog, if
+// enabled with WatchdogSec=, for as long as the checkable reports it is live.
+func NewNotifier(log logrus.FieldLogger, checkable health.Checkable) *Notifier {
+	n := &Notifier{
+		log:       log,
+		checkable: checkable,
+		clk:       clock.New(),
+		socket:    os.Getenv(notifySocketEnv),
+	}
+	if n.socket == "" {
+		return n
+	}
+
+	watchdog, err := watchdogInterval()
+	if err != nil {
+		log.WithError(err).Warn("Ignoring invalid systemd watchdog configuration")
+	}
+	n.watchdog = watchdog
+	return n
+}
+
+// Run notifies systemd that the service is ready and then pings the
+// watchdog, if enabled, until the context is canceled, at which point it
+// notifies systemd that the service is stopping. It is meant to run once the
+// service is serving its API.
+func (n *Notifier) Run(ctx context.Context) error {
+	if n.socket == "" {
+		return nil
+	}
+
+	n.notify(stateReady)
+	n.log.Info("Notified systemd that the service is ready")
+	defer n.notify(stateStopping)
+
+	if n.watchdog <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	// Ping the watchdog at half its interval, as recommended by
+	// sd_watchdog_enabled(3), so a late ping does not restart the service
+	n.log.WithField("interval", n.watchdog).Info("Pinging the systemd watchdog")
+	ticker := n.clk.Ticker(n.watchdog / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+
+		// A service that is not live is left for systemd to restart
+		if state := n.checkable.CheckHealth(); !state.Live {
+			n.log.Warn("Skipping systemd watchdog ping since the service is not live")
+			continue
+		}
+		n.notify(stateWatchdog)
+	}
+}
+
+func (n *Notifier) notify(state string) {
+	if err := notify(n.socket, state); err != nil {
+		n.log.WithError(err).WithField("state", state).Warn("Failed to notify systemd")
+	}
+}
+
+// notify sends the state to the notification socket. Abstract socket names
+// start with "@", which the net package handles.
+func notify(socket, state string) error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Net: "unixgram", Name: socket})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns the watchdog interval systemd expects pings
+// within, or zero if the watchdog is disabled or meant for another process.
+func watchdogInterval() (time.Duration, error) {
+	rawUSec := os.Getenv(watchdogUSecEnv)
+	if rawUSec == "" {
+		return 0, nil
+	}
+	if rawPID := os.Getenv(watchdogPIDEnv); rawPID != "" && rawPID != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	usec, err := strconv.ParseInt(rawUSec, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if usec <= 0 {
+		return 0, errors.New(watchdogUSecEnv + " must be positive")
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
@@ -0,0 +1,172 @@
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/spire/pkg/common/health"
+	"github.com/spiffe/spire/test/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifierNotManaged(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	n := &Notifier{log: log}
+
+	// Run returns right away when not run by systemd
+	require.NoError(t, n.Run(context.Background()))
+}
+
+func TestNotifierReadyAndStopping(t *testing.T) {
+	socket, states := listenNotifySocket(t)
+	log, _ := test.NewNullLogger()
+	n := &Notifier{log: log, socket: socket}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- n.Run(ctx) }()
+
+	requireState(t, states, stateReady)
+	cancel()
+	require.NoError(t, <-done)
+	requireState(t, states, stateStopping)
+}
+
+func TestNotifierWatchdog(t *testing.T) {
+	socket, states := listenNotifySocket(t)
+	log, _ := test.NewNullLogger()
+	clk := clock.NewMock(t)
+	checkable := new(fakeCheckable)
+	checkable.live.Store(true)
+	n := &Notifier{
+		log:       log,
+		checkable: checkable,
+		clk:       clk,
+		socket:    socket,
+		watchdog:  time.Minute,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- n.Run(ctx) }()
+
+	requireState(t, states, stateReady)
+	clk.WaitForTicker(time.Minute, "waiting for the watchdog ticker")
+
+	// The watchdog is pinged at half its interval while the service is live
+	clk.Add(30 * time.Second)
+	requireState(t, states, stateWatchdog)
+
+	// ... and not pinged once it is not
+	checkable.live.Store(false)
+	clk.Add(30 * time.Second)
+	select {
+	case state := <-states:
+		require.Fail(t, "unexpected notification", state)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	checkable.live.Store(true)
+	clk.Add(30 * time.Second)
+	requireState(t, states, stateWatchdog)
+
+	cancel()
+	require.NoError(t, <-done)
+	requireState(t, states, stateStopping)
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer restoreEnv(t, watchdogUSecEnv, watchdogPIDEnv)()
+
+	require.NoError(t, os.Unsetenv(watchdogUSecEnv))
+	interval, err := watchdogInterval()
+	require.NoError(t, err)
+	assert.Zero(t, interval)
+
+	require.NoError(t, os.Setenv(watchdogUSecEnv, "30000000"))
+	require.NoError(t, os.Setenv(watchdogPIDEnv, strconv.Itoa(os.Getpid())))
+	interval, err = watchdogInterval()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, interval)
+
+	// The watchdog is meant for another process
+	require.NoError(t, os.Setenv(watchdogPIDEnv, strconv.Itoa(os.Getpid()+1)))
+	interval, err = watchdogInterval()
+	require.NoError(t, err)
+	assert.Zero(t, interval)
+
+	require.NoError(t, os.Unsetenv(watchdogPIDEnv))
+	require.NoError(t, os.Setenv(watchdogUSecEnv, "soon"))
+	_, err = watchdogInterval()
+	require.Error(t, err)
+
+	require.NoError(t, os.Setenv(watchdogUSecEnv, "0"))
+	_, err = watchdogInterval()
+	require.EqualError(t, err, "WATCHDOG_USEC must be positive")
+}
+
+type fakeCheckable struct {
+	live atomic.Value
+}
+
+func (c *fakeCheckable) CheckHealth() health.State {
+	live := c.live.Load().(bool)
+	return health.State{Live: live, Ready: live}
+}
+
+func listenNotifySocket(t *testing.T) (string, <-chan string) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram", Name: socket})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	states := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			states <- string(buf[:n])
+		}
+	}()
+	return socket, states
+}
+
+func requireState(t *testing.T, states <-chan string, expected string) {
+	select {
+	case state := <-states:
+		require.Equal(t, expected, state)
+	case <-time.After(time.Minute):
+		require.Fail(t, "timed out waiting for notification", expected)
+	}
+}
+
+func restoreEnv(t *testing.T, keys ...string) func() {
+	values := make(map[string]*string)
+	for _, key := range keys {
+		if value, ok := os.LookupEnv(key); ok {
+			values[key] = &value
+		} else {
+			values[key] = nil
+		}
+	}
+	return func() {
+		for key, value := range values {
+			if value != nil {
+				assert.NoError(t, os.Setenv(key, *value))
+			} else {
+				assert.NoError(t, os.Unsetenv(key))
+			}
+		}
+	}
+}
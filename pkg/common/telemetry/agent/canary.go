@@ -0,0 +1,16 @@
+package agent
+
+import (
+	"github.com/spiffe/spire/pkg/common/telemetry"
+)
+
+// Call Counters (timing and success metrics)
+// Allows adding labels in-code
+
+// StartCanaryProbeCall return metric for the end-to-end fetch of the canary
+// identity through the Workload API
+func StartCanaryProbeCall(m telemetry.Metrics) *telemetry.CallCounter {
+	return telemetry.StartCall(m, telemetry.CanaryProbe, telemetry.FetchX509SVID)
+}
+
+// End Call Counters
@@ -1,6 +1,8 @@
 package agent
 
 import (
+	"time"
+
 	"github.com/spiffe/spire/pkg/common/telemetry"
 )
 
@@ -37,4 +39,21 @@ func AddCacheManagerOutdatedSVIDsSample(m telemetry.Metrics, count float32) {
 	m.AddSample([]string{telemetry.CacheManager, telemetry.OutdatedSVIDs}, count)
 }
 
+// AddCacheManagerSVIDTimeToExpirySample records the time left, in seconds,
+// before a cached X509-SVID expires, as found by the agent cache manager
+// when synchronizing
+func AddCacheManagerSVIDTimeToExpirySample(m telemetry.Metrics, timeToExpiry time.Duration) {
+	m.AddSample([]string{telemetry.CacheManager, telemetry.SVIDTimeToExpiry}, float32(timeToExpiry.Seconds()))
+}
+
 // End Add Samples
+
+// Set Gauges (metric on a value that can go up and down)
+
+// SetClockSkewGauge sets the estimated offset, in seconds, of the clock of
+// the server relative to the clock of the agent
+func SetClockSkewGauge(m telemetry.Metrics, offset time.Duration) {
+	m.SetGauge([]string{telemetry.ClockSkew}, float32(offset.Seconds()))
+}
+
+// End Set Gauges
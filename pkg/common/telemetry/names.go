@@ -136,6 +136,9 @@ const (
 	// Audience tags some audience for a token
 	Audience = "audience"
 
+	// BoringCrypto tags whether the binary was built with BoringCrypto
+	BoringCrypto = "boringcrypto"
+
 	// BySelectorMatch tags Match used when filtering by Selectors
 	BySelectorMatch = "by_selector_match"
 
@@ -203,6 +206,9 @@ const (
 	// non-error level.
 	Error = "error"
 
+	// Exceeded tags something that went over its limit
+	Exceeded = "exceeded"
+
 	// Expect tags an expected value, as opposed to the one received. Message should clarify
 	// what kind of value was expected, and a different field should show the received value
 	Expect = "expect"
@@ -260,6 +266,9 @@ const (
 	// Kid tags some key ID
 	Kid = "kid"
 
+	// LastSeen tags when an agent was last seen syncing with the server
+	LastSeen = "last_seen"
+
 	// Mode tags a bundle deletion mode
 	Mode = "mode"
 
@@ -302,6 +311,12 @@ const (
 	// Pruned flagging something has been pruned
 	Pruned = "pruned"
 
+	// QuarantineRuleID tags the ID of a workload quarantine rule
+	QuarantineRuleID = "quarantine_rule_id"
+
+	// Quota tags the name of some quota
+	Quota = "quota"
+
 	// ReadOnly tags something read-only
 	ReadOnly = "read_only"
 
@@ -321,6 +336,12 @@ const (
 	// RegistrationEntry tags a registration entry
 	RegistrationEntry = "registration_entry"
 
+	// RegistrationEntryOwner tags the owner of a registration entry
+	RegistrationEntryOwner = "registration_entry_owner"
+
+	// RegistrationEntryRevision tags a revision of a registration entry
+	RegistrationEntryRevision = "registration_entry_revision"
+
 	// RequestID tags a request identifier
 	RequestID = "request_id"
 
@@ -399,6 +420,9 @@ const (
 	// with other tags to add clarity
 	TTL = "ttl"
 
+	// Timeout tags some timeout
+	Timeout = "timeout"
+
 	// Type tags a type
 	Type = "type"
 
@@ -470,6 +494,10 @@ const (
 	// Catalog functionality related to plugin catalog
 	Catalog = "catalog"
 
+	// ClockSkew functionality related to the skew between the clocks of the
+	// agents and of the server
+	ClockSkew = "clock_skew"
+
 	// Datastore functionality related to datastore plugin
 	Datastore = "datastore"
 
@@ -483,12 +511,18 @@ const (
 	// Event tag some event that has occurred, for a notifier, watcher, listener, etc.
 	Event = "event"
 
+	// Evicted tags something as evicted
+	Evicted = "evicted"
+
 	// ExpiringSVIDs tags expiring SVID count/list
 	ExpiringSVIDs = "expiring_svids"
 
 	// OutdatedSVIDs tags SVID with outdated attributes count/list
 	OutdatedSVIDs = "outdated_svids"
 
+	// SVIDTimeToExpiry tags the time left before an SVID expires
+	SVIDTimeToExpiry = "svid_time_to_expiry"
+
 	// FederatedBundle functionality related to a federated bundle; should be used
 	// with other tags to add clarity
 	FederatedBundle = "federated_bundle"
@@ -533,6 +567,13 @@ const (
 	// to add clarity
 	ServerCA = "server_ca"
 
+	// SigningQuota functionality related to the quotas on signing SVIDs; should be
+	// used with other tags to add clarity
+	SigningQuota = "signing_quota"
+
+	// Stale tags something as stale
+	Stale = "stale"
+
 	// SpireAgent typically the entire spire agent service
 	SpireAgent = "spire_agent"
 
@@ -549,6 +590,24 @@ const (
 	// RegistrationManager functionality related to a registration manager
 	RegistrationManager = "registration_manager"
 
+	// NodeEventsWebhook functionality related to the attested node events webhook
+	NodeEventsWebhook = "node_events_webhook"
+
+	// CloudEvents functionality related to the identity lifecycle CloudEvents
+	CloudEvents = "cloud_events"
+
+	// CanaryProbe functionality related to the canary identity probe
+	CanaryProbe = "canary_probe"
+
+	// WorkloadQuarantine functionality related to the workload quarantine
+	WorkloadQuarantine = "workload_quarantine"
+
+	// AgentLastSeen functionality related to tracking when agents were last seen
+	AgentLastSeen = "agent_last_seen"
+
+	// BundleEndpoint functionality related to the agent HTTP bundle endpoint
+	BundleEndpoint = "bundle_endpoint"
+
 	// Telemetry tags a telemetry module
 	Telemetry = "telemetry"
 
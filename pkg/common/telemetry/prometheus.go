@@ -3,14 +3,15 @@ package telemetry
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
+	"strconv"
 	"sync"
 
 	prommetrics "github.com/armon/go-metrics/prometheus"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/pkg/common/util"
 )
 
 type prometheusRunner struct {
@@ -50,7 +51,7 @@ func newPrometheusRunner(c *MetricsConfig) (sinkRunner, error) {
 	}
 
 	runner.server = &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", runner.c.Host, runner.c.Port),
+		Addr:    util.JoinHostPort(runner.c.Host, strconv.Itoa(runner.c.Port)),
 		Handler: handler,
 	}
 
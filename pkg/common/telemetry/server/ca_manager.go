@@ -1,6 +1,8 @@
 package server
 
 import (
+	"time"
+
 	"github.com/spiffe/spire/pkg/common/telemetry"
 )
 
@@ -80,4 +82,34 @@ func IncrServerCASignX509Counter(m telemetry.Metrics) {
 	m.IncrCounter([]string{telemetry.ServerCA, telemetry.Sign, telemetry.X509SVID}, 1)
 }
 
+// IncrServerCASignedSVIDCounter indicate Server CA signed an SVID of the
+// given type (X509SVID, X509CASVID or JWTSVID), for an entry with the given
+// parent ID, if any.
+func IncrServerCASignedSVIDCounter(m telemetry.Metrics, svidType, parentID string) {
+	m.IncrCounterWithLabels([]string{telemetry.ServerCA, telemetry.Sign, telemetry.SVID}, 1,
+		signedSVIDLabels(svidType, parentID))
+}
+
 // End Counters
+
+// Add Samples (metric on count of some object, entries, event...)
+
+// AddServerCASignedSVIDTTLSample records the TTL, in seconds, of an SVID of
+// the given type signed by the Server CA for an entry with the given parent
+// ID, if any. The TTL can be shorter than requested if capped by the CA.
+func AddServerCASignedSVIDTTLSample(m telemetry.Metrics, svidType, parentID string, ttl time.Duration) {
+	m.AddSampleWithLabels([]string{telemetry.ServerCA, telemetry.Sign, telemetry.SVID, telemetry.TTL}, float32(ttl.Seconds()),
+		signedSVIDLabels(svidType, parentID))
+}
+
+// End Add Samples
+
+func signedSVIDLabels(svidType, parentID string) []telemetry.Label {
+	labels := []telemetry.Label{
+		{Name: telemetry.SVIDType, Value: svidType},
+	}
+	if parentID != "" {
+		labels = append(labels, telemetry.Label{Name: telemetry.ParentID, Value: parentID})
+	}
+	return labels
+}
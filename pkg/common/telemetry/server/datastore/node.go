@@ -37,6 +37,18 @@ func StartListNodeCall(m telemetry.Metrics) *telemetry.CallCounter {
 	return telemetry.StartCall(m, telemetry.Datastore, telemetry.Node, telemetry.List)
 }
 
+// StartListNodesLastSeenCall return metric
+// for server's datastore, on listing when nodes were last seen.
+func StartListNodesLastSeenCall(m telemetry.Metrics) *telemetry.CallCounter {
+	return telemetry.StartCall(m, telemetry.Datastore, telemetry.Node, telemetry.LastSeen, telemetry.List)
+}
+
+// StartSetNodeLastSeenCall return metric
+// for server's datastore, on recording when a node was last seen.
+func StartSetNodeLastSeenCall(m telemetry.Metrics) *telemetry.CallCounter {
+	return telemetry.StartCall(m, telemetry.Datastore, telemetry.Node, telemetry.LastSeen, telemetry.Set)
+}
+
 // StartGetNodeSelectorsCall return metric
 // for server's datastore, on getting selectors for a node.
 func StartGetNodeSelectorsCall(m telemetry.Metrics) *telemetry.CallCounter {
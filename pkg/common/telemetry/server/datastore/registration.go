@@ -31,12 +31,24 @@ func StartFetchRegistrationCall(m telemetry.Metrics) *telemetry.CallCounter {
 	return telemetry.StartCall(m, telemetry.Datastore, telemetry.RegistrationEntry, telemetry.Fetch)
 }
 
+// StartFetchRegistrationOwnerCall return metric
+// for server's datastore, on fetching the owner of a registration.
+func StartFetchRegistrationOwnerCall(m telemetry.Metrics) *telemetry.CallCounter {
+	return telemetry.StartCall(m, telemetry.Datastore, telemetry.RegistrationEntryOwner, telemetry.Fetch)
+}
+
 // StartListRegistrationCall return metric
 // for server's datastore, on listing registrations.
 func StartListRegistrationCall(m telemetry.Metrics) *telemetry.CallCounter {
 	return telemetry.StartCall(m, telemetry.Datastore, telemetry.RegistrationEntry, telemetry.List)
 }
 
+// StartListRegistrationRevisionsCall return metric
+// for server's datastore, on listing the revisions of a registration.
+func StartListRegistrationRevisionsCall(m telemetry.Metrics) *telemetry.CallCounter {
+	return telemetry.StartCall(m, telemetry.Datastore, telemetry.RegistrationEntryRevision, telemetry.List)
+}
+
 // StartPruneRegistrationCall return metric
 // for server's datastore, on pruning registrations.
 func StartPruneRegistrationCall(m telemetry.Metrics) *telemetry.CallCounter {
@@ -99,6 +99,12 @@ func (w metricsWrapper) FetchRegistrationEntry(ctx context.Context, entryID stri
 	return w.ds.FetchRegistrationEntry(ctx, entryID)
 }
 
+func (w metricsWrapper) FetchRegistrationEntryOwner(ctx context.Context, entryID string) (_ string, err error) {
+	callCounter := StartFetchRegistrationOwnerCall(w.m)
+	defer callCounter.Done(&err)
+	return w.ds.FetchRegistrationEntryOwner(ctx, entryID)
+}
+
 func (w metricsWrapper) GetNodeSelectors(ctx context.Context, spiffeID string, dataConsistency datastore.DataConsistency) (_ []*common.Selector, err error) {
 	callCounter := StartGetNodeSelectorsCall(w.m)
 	defer callCounter.Done(&err)
@@ -123,12 +129,24 @@ func (w metricsWrapper) ListNodeSelectors(ctx context.Context, req *datastore.Li
 	return w.ds.ListNodeSelectors(ctx, req)
 }
 
+func (w metricsWrapper) ListNodesLastSeen(ctx context.Context) (_ map[string]time.Time, err error) {
+	callCounter := StartListNodesLastSeenCall(w.m)
+	defer callCounter.Done(&err)
+	return w.ds.ListNodesLastSeen(ctx)
+}
+
 func (w metricsWrapper) ListRegistrationEntries(ctx context.Context, req *datastore.ListRegistrationEntriesRequest) (_ *datastore.ListRegistrationEntriesResponse, err error) {
 	callCounter := StartListRegistrationCall(w.m)
 	defer callCounter.Done(&err)
 	return w.ds.ListRegistrationEntries(ctx, req)
 }
 
+func (w metricsWrapper) ListRegistrationEntryRevisions(ctx context.Context, entryID string) (_ []*datastore.RegistrationEntryRevision, err error) {
+	callCounter := StartListRegistrationRevisionsCall(w.m)
+	defer callCounter.Done(&err)
+	return w.ds.ListRegistrationEntryRevisions(ctx, entryID)
+}
+
 func (w metricsWrapper) CountAttestedNodes(ctx context.Context) (_ int32, err error) {
 	callCounter := StartCountNodeCall(w.m)
 	defer callCounter.Done(&err)
@@ -171,6 +189,12 @@ func (w metricsWrapper) SetBundle(ctx context.Context, bundle *common.Bundle) (_
 	return w.ds.SetBundle(ctx, bundle)
 }
 
+func (w metricsWrapper) SetNodeLastSeen(ctx context.Context, spiffeID string, lastSeen time.Time) (err error) {
+	callCounter := StartSetNodeLastSeenCall(w.m)
+	defer callCounter.Done(&err)
+	return w.ds.SetNodeLastSeen(ctx, spiffeID, lastSeen)
+}
+
 func (w metricsWrapper) SetNodeSelectors(ctx context.Context, spiffeID string, selectors []*common.Selector) (err error) {
 	callCounter := StartSetNodeSelectorsCall(w.m)
 	defer callCounter.Done(&err)
@@ -99,6 +99,10 @@ func TestWithMetrics(t *testing.T) {
 			key:        "datastore.registration_entry.fetch",
 			methodName: "FetchRegistrationEntry",
 		},
+		{
+			key:        "datastore.registration_entry_owner.fetch",
+			methodName: "FetchRegistrationEntryOwner",
+		},
 		{
 			key:        "datastore.node.selectors.fetch",
 			methodName: "GetNodeSelectors",
@@ -115,10 +119,18 @@ func TestWithMetrics(t *testing.T) {
 			key:        "datastore.node.selectors.list",
 			methodName: "ListNodeSelectors",
 		},
+		{
+			key:        "datastore.node.last_seen.list",
+			methodName: "ListNodesLastSeen",
+		},
 		{
 			key:        "datastore.registration_entry.list",
 			methodName: "ListRegistrationEntries",
 		},
+		{
+			key:        "datastore.registration_entry_revision.list",
+			methodName: "ListRegistrationEntryRevisions",
+		},
 		{
 			key:        "datastore.bundle.prune",
 			methodName: "PruneBundle",
@@ -135,6 +147,10 @@ func TestWithMetrics(t *testing.T) {
 			key:        "datastore.bundle.set",
 			methodName: "SetBundle",
 		},
+		{
+			key:        "datastore.node.last_seen.set",
+			methodName: "SetNodeLastSeen",
+		},
 		{
 			key:        "datastore.node.selectors.set",
 			methodName: "SetNodeSelectors",
@@ -295,6 +311,10 @@ func (ds *fakeDataStore) FetchRegistrationEntry(context.Context, string) (*commo
 	return &common.RegistrationEntry{}, ds.err
 }
 
+func (ds *fakeDataStore) FetchRegistrationEntryOwner(context.Context, string) (string, error) {
+	return "", ds.err
+}
+
 func (ds *fakeDataStore) GetNodeSelectors(context.Context, string, datastore.DataConsistency) ([]*common.Selector, error) {
 	return []*common.Selector{}, ds.err
 }
@@ -311,10 +331,18 @@ func (ds *fakeDataStore) ListNodeSelectors(context.Context, *datastore.ListNodeS
 	return &datastore.ListNodeSelectorsResponse{}, ds.err
 }
 
+func (ds *fakeDataStore) ListNodesLastSeen(context.Context) (map[string]time.Time, error) {
+	return map[string]time.Time{}, ds.err
+}
+
 func (ds *fakeDataStore) ListRegistrationEntries(context.Context, *datastore.ListRegistrationEntriesRequest) (*datastore.ListRegistrationEntriesResponse, error) {
 	return &datastore.ListRegistrationEntriesResponse{}, ds.err
 }
 
+func (ds *fakeDataStore) ListRegistrationEntryRevisions(context.Context, string) ([]*datastore.RegistrationEntryRevision, error) {
+	return []*datastore.RegistrationEntryRevision{}, ds.err
+}
+
 func (ds *fakeDataStore) PruneBundle(context.Context, string, time.Time) (bool, error) {
 	return false, ds.err
 }
@@ -331,6 +359,10 @@ func (ds *fakeDataStore) SetBundle(context.Context, *common.Bundle) (*common.Bun
 	return &common.Bundle{}, ds.err
 }
 
+func (ds *fakeDataStore) SetNodeLastSeen(context.Context, string, time.Time) error {
+	return ds.err
+}
+
 func (ds *fakeDataStore) SetNodeSelectors(context.Context, string, []*common.Selector) error {
 	return ds.err
 }
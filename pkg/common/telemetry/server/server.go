@@ -7,3 +7,15 @@ import "github.com/spiffe/spire/pkg/common/telemetry"
 func SetEntryIgnoredGauge(m telemetry.Metrics, ignored int) {
 	m.SetGauge([]string{telemetry.Entry, telemetry.Ignored}, float32(ignored))
 }
+
+// SetNodeStaleGauge emits a gauge with the number of agents not seen syncing
+// with the server for longer than the stale threshold.
+func SetNodeStaleGauge(m telemetry.Metrics, stale int) {
+	m.SetGauge([]string{telemetry.Node, telemetry.Stale}, float32(stale))
+}
+
+// IncrNodeEvictedCounter indicates that an agent not seen for longer than
+// the eviction threshold was evicted.
+func IncrNodeEvictedCounter(m telemetry.Metrics) {
+	m.IncrCounter([]string{telemetry.Node, telemetry.Evicted}, 1)
+}
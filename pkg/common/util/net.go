@@ -0,0 +1,29 @@
+package util
+
+import (
+	"net"
+	"strings"
+)
+
+// TrimHostBrackets removes the brackets enclosing an IPv6 literal, e.g.
+// "[::1]", as found in URLs and host:port pairs. Other hosts are returned
+// as is.
+func TrimHostBrackets(host string) string {
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host[1 : len(host)-1]
+	}
+	return host
+}
+
+// ParseIP parses an IPv4 or IPv6 address, the latter optionally enclosed in
+// brackets. It returns nil if the address is not valid.
+func ParseIP(s string) net.IP {
+	return net.ParseIP(TrimHostBrackets(s))
+}
+
+// JoinHostPort combines host and port into a network address of the form
+// "host:port", enclosing IPv6 literals in brackets. Unlike net.JoinHostPort,
+// hosts already enclosed in brackets are not enclosed again.
+func JoinHostPort(host, port string) string {
+	return net.JoinHostPort(TrimHostBrackets(host), port)
+}
@@ -0,0 +1,25 @@
+package util
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIP(t *testing.T) {
+	assert.Equal(t, net.ParseIP("127.0.0.1"), ParseIP("127.0.0.1"))
+	assert.Equal(t, net.IPv6loopback, ParseIP("::1"))
+	assert.Equal(t, net.IPv6unspecified, ParseIP("[::]"))
+	assert.Nil(t, ParseIP("[127.0.0.1"))
+	assert.Nil(t, ParseIP("localhost"))
+	assert.Nil(t, ParseIP(""))
+}
+
+func TestJoinHostPort(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:80", JoinHostPort("127.0.0.1", "80"))
+	assert.Equal(t, "localhost:80", JoinHostPort("localhost", "80"))
+	assert.Equal(t, "[fd00::1]:8081", JoinHostPort("fd00::1", "8081"))
+	assert.Equal(t, "[fd00::1]:8081", JoinHostPort("[fd00::1]", "8081"))
+	assert.Equal(t, ":8081", JoinHostPort("", "8081"))
+}
@@ -0,0 +1,14 @@
+// +build !linux
+
+package vsock
+
+import (
+	"errors"
+	"net"
+)
+
+// Listen listens for vsock connections on the port, from the VMs running on
+// the host. The address of the listener is that of the host.
+func Listen(port uint32) (net.Listener, error) {
+	return nil, errors.New("vsock is only supported on Linux")
+}
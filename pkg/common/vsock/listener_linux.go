@@ -0,0 +1,122 @@
+// +build linux
+
+package vsock
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Listen listens for vsock connections on the port, from the VMs running on
+// the host. The address of the listener is that of the host.
+func Listen(port uint32) (net.Listener, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create vsock socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrVM{CID: unix.VMADDR_CID_ANY, Port: port}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("unable to bind vsock port %d: %w", port, err)
+	}
+	if err := unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("unable to listen on vsock port %d: %w", port, err)
+	}
+
+	// The file is non-blocking, so accepting connections goes through the
+	// runtime poller and is interrupted by Close
+	return &listener{
+		f:    os.NewFile(uintptr(fd), "vsock"),
+		addr: &Addr{ContextID: HostContextID, Port: port},
+	}, nil
+}
+
+type listener struct {
+	f    *os.File
+	addr *Addr
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	rawConn, err := l.f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var nfd int
+	var sa unix.Sockaddr
+	var acceptErr error
+	if err := rawConn.Read(func(fd uintptr) bool {
+		nfd, sa, acceptErr = unix.Accept4(int(fd), unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK)
+		return !errors.Is(acceptErr, unix.EAGAIN)
+	}); err != nil {
+		return nil, err
+	}
+	if acceptErr != nil {
+		return nil, os.NewSyscallError("accept4", acceptErr)
+	}
+
+	remote, ok := sa.(*unix.SockaddrVM)
+	if !ok {
+		unix.Close(nfd)
+		return nil, errInvalidConnection
+	}
+	return &conn{
+		f:      os.NewFile(uintptr(nfd), "vsock"),
+		local:  l.addr,
+		remote: &Addr{ContextID: remote.CID, Port: remote.Port},
+	}, nil
+}
+
+func (l *listener) Close() error {
+	return l.f.Close()
+}
+
+func (l *listener) Addr() net.Addr {
+	return l.addr
+}
+
+// conn is an accepted vsock connection. The standard library has no support
+// for vsock, so connections are backed by non-blocking files, which support
+// deadlines through the runtime poller.
+type conn struct {
+	f      *os.File
+	local  *Addr
+	remote *Addr
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	return c.f.Read(b)
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	return c.f.Write(b)
+}
+
+func (c *conn) Close() error {
+	return c.f.Close()
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	return c.f.SetDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	return c.f.SetReadDeadline(t)
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return c.f.SetWriteDeadline(t)
+}
@@ -0,0 +1,103 @@
+// Package vsock serves gRPC over virtio-vsock, the socket family through
+// which the VMs running on a host reach it without a network.
+package vsock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	network  = "vsock"
+	authType = "vsock"
+
+	// HostContextID is the context ID of the host, as seen from the VMs
+	HostContextID = 2
+)
+
+var errInvalidConnection = errors.New("invalid connection")
+
+// Addr is the address of a vsock endpoint: the context ID (CID) of the VM, or
+// of the host, and a port
+type Addr struct {
+	ContextID uint32
+	Port      uint32
+}
+
+func (a *Addr) Network() string {
+	return network
+}
+
+func (a *Addr) String() string {
+	return fmt.Sprintf("vm(%d):%d", a.ContextID, a.Port)
+}
+
+// AuthInfo is the gRPC authentication information of a vsock caller. The
+// context ID of the caller is assigned to its VM by the hypervisor and can't
+// be forged from within the VM.
+type AuthInfo struct {
+	Caller *Addr
+}
+
+// AuthType returns the authentication type and allows us to
+// conform to the gRPC AuthInfo interface
+func (AuthInfo) AuthType() string {
+	return authType
+}
+
+type grpcCredentials struct{}
+
+// NewCredentials returns the gRPC transport credentials of servers accepting
+// connections from a vsock listener, exposing the address of the callers
+func NewCredentials() credentials.TransportCredentials {
+	return &grpcCredentials{}
+}
+
+func (c *grpcCredentials) ClientHandshake(_ context.Context, _ string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn.Close()
+	return conn, AuthInfo{}, errInvalidConnection
+}
+
+func (c *grpcCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	addr, ok := conn.RemoteAddr().(*Addr)
+	if !ok {
+		conn.Close()
+		return conn, AuthInfo{}, errInvalidConnection
+	}
+	return conn, AuthInfo{Caller: addr}, nil
+}
+
+func (c *grpcCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{
+		SecurityProtocol: authType,
+		SecurityVersion:  "0.1",
+		ServerName:       "spire-agent",
+	}
+}
+
+func (c *grpcCredentials) Clone() credentials.TransportCredentials {
+	copy := *c
+	return &copy
+}
+
+func (c *grpcCredentials) OverrideServerName(_ string) error {
+	return nil
+}
+
+// CallerFromContext returns the address of the vsock caller of a gRPC call
+func CallerFromContext(ctx context.Context) (*Addr, bool) {
+	peer, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	ai, ok := peer.AuthInfo.(AuthInfo)
+	if !ok || ai.Caller == nil {
+		return nil, false
+	}
+	return ai.Caller, true
+}
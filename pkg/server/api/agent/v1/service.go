@@ -23,6 +23,7 @@ import (
 	"github.com/spiffe/spire/pkg/server/ca"
 	"github.com/spiffe/spire/pkg/server/catalog"
 	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/pkg/server/nodeevents"
 	"github.com/spiffe/spire/pkg/server/plugin/nodeattestor"
 	"github.com/spiffe/spire/proto/spire/common"
 	"google.golang.org/grpc"
@@ -39,6 +40,10 @@ type Config struct {
 	DataStore   datastore.DataStore
 	ServerCA    ca.ServerCA
 	TrustDomain spiffeid.TrustDomain
+
+	// NodeEvents, if set, is notified when agents attest, are banned or are
+	// deleted
+	NodeEvents nodeevents.Notifier
 }
 
 // Service implements the v1 agent service
@@ -50,6 +55,8 @@ type Service struct {
 	ds  datastore.DataStore
 	ca  ca.ServerCA
 	td  spiffeid.TrustDomain
+
+	nodeEvents nodeevents.Notifier
 }
 
 // New creates a new agent service
@@ -60,6 +67,8 @@ func New(config Config) *Service {
 		ds:  config.DataStore,
 		ca:  config.ServerCA,
 		td:  config.TrustDomain,
+
+		nodeEvents: config.NodeEvents,
 	}
 }
 
@@ -190,10 +199,23 @@ func (s *Service) DeleteAgent(ctx context.Context, req *agentv1.DeleteAgentReque
 
 	log = log.WithField(telemetry.SPIFFEID, id.String())
 
+	// Agents are allowed to delete themselves, e.g. ephemeral agents
+	// evicting themselves on shutdown, but no other agent
+	if rpccontext.CallerIsAgent(ctx) {
+		callerID, ok := rpccontext.CallerID(ctx)
+		if !ok {
+			return nil, api.MakeErr(log, codes.Internal, "caller ID missing from request context", nil)
+		}
+		if callerID != id {
+			return nil, api.MakeErr(log, codes.PermissionDenied, "agents can only delete themselves", nil)
+		}
+	}
+
 	_, err = s.ds.DeleteAttestedNode(ctx, id.String())
 	switch status.Code(err) {
 	case codes.OK:
 		log.Info("Agent deleted")
+		s.notifyNodeEvent(nodeevents.Event{Type: nodeevents.AgentDeleted, AgentID: id.String()})
 		return &emptypb.Empty{}, nil
 	case codes.NotFound:
 		return nil, api.MakeErr(log, codes.NotFound, "agent not found", err)
@@ -225,6 +247,7 @@ func (s *Service) BanAgent(ctx context.Context, req *agentv1.BanAgentRequest) (*
 	switch status.Code(err) {
 	case codes.OK:
 		log.Info("Agent banned")
+		s.notifyNodeEvent(nodeevents.Event{Type: nodeevents.AgentBanned, AgentID: id.String()})
 		return &emptypb.Empty{}, nil
 	case codes.NotFound:
 		return nil, api.MakeErr(log, codes.NotFound, "agent not found", err)
@@ -303,11 +326,28 @@ func (s *Service) AttestAgent(stream agentv1.Agent_AttestAgentServer) error {
 		return api.MakeErr(log, codes.Internal, "failed to resolve selectors", err)
 	}
 	// store augmented selectors
-	err = s.ds.SetNodeSelectors(ctx, agentID, append(attestResult.Selectors, resolvedSelectors...))
+	selectors := make([]*common.Selector, 0, len(attestResult.Selectors)+len(resolvedSelectors))
+	selectors = append(selectors, attestResult.Selectors...)
+	selectors = append(selectors, resolvedSelectors...)
+	err = s.ds.SetNodeSelectors(ctx, agentID, selectors)
 	if err != nil {
 		return api.MakeErr(log, codes.Internal, "failed to update selectors", err)
 	}
 
+	event := nodeevents.Event{
+		Type:            nodeevents.AgentAttested,
+		AgentID:         agentID,
+		AttestationType: params.Data.Type,
+		SerialNumber:    svid[0].SerialNumber.String(),
+		ExpiresAt:       svid[0].NotAfter.Unix(),
+	}
+	for _, selector := range selectors {
+		event.Selectors = append(event.Selectors, nodeevents.Selector{
+			Type:  selector.Type,
+			Value: selector.Value,
+		})
+	}
+
 	// create or update attested entry
 	if attestedNode == nil {
 		node := &common.AttestedNode{
@@ -328,7 +368,9 @@ func (s *Service) AttestAgent(stream agentv1.Agent_AttestAgentServer) error {
 		if _, err := s.ds.UpdateAttestedNode(ctx, node, nil); err != nil {
 			return api.MakeErr(log, codes.Internal, "failed to update attested agent", err)
 		}
+		event.Type = nodeevents.AgentReattested
 	}
+	s.notifyNodeEvent(event)
 
 	// build and send response
 	response := getAttestAgentResponse(agentSpiffeID, svid)
@@ -474,6 +516,15 @@ func (s *Service) updateAttestedNode(ctx context.Context, node *common.AttestedN
 	}
 }
 
+// notifyNodeEvent notifies the event, if node events are configured
+func (s *Service) notifyNodeEvent(event nodeevents.Event) {
+	if s.nodeEvents == nil {
+		return
+	}
+	event.Time = s.clk.Now().UTC()
+	s.nodeEvents.NotifyNodeEvent(event)
+}
+
 func (s *Service) signSvid(ctx context.Context, agentID spiffeid.ID, csr []byte, log logrus.FieldLogger) ([]*x509.Certificate, error) {
 	parsedCsr, err := x509.ParseCertificateRequest(csr)
 	if err != nil {
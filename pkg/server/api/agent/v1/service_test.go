@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sync"
 	"testing"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 	"github.com/spiffe/spire/pkg/server/api/agent/v1"
 	"github.com/spiffe/spire/pkg/server/api/rpccontext"
 	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/pkg/server/nodeevents"
 	"github.com/spiffe/spire/proto/spire/common"
 	"github.com/spiffe/spire/test/clock"
 	"github.com/spiffe/spire/test/fakes/fakedatastore"
@@ -677,6 +679,7 @@ func TestDeleteAgent(t *testing.T) {
 		err        string
 		expectLogs []spiretest.LogEntry
 		req        *agentv1.DeleteAgentRequest
+		callerID   string
 	}{
 		{
 			name: "success",
@@ -696,6 +699,46 @@ func TestDeleteAgent(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:     "agent deletes itself",
+			callerID: "spiffe://example.org/spire/agent/node1",
+			expectLogs: []spiretest.LogEntry{
+				{
+					Level:   logrus.InfoLevel,
+					Message: "Agent deleted",
+					Data: logrus.Fields{
+						telemetry.SPIFFEID: "spiffe://example.org/spire/agent/node1",
+					},
+				},
+			},
+			req: &agentv1.DeleteAgentRequest{
+				Id: &types.SPIFFEID{
+					TrustDomain: "example.org",
+					Path:        "/spire/agent/node1",
+				},
+			},
+		},
+		{
+			name:     "agent deletes another agent",
+			callerID: "spiffe://example.org/spire/agent/node2",
+			expectLogs: []spiretest.LogEntry{
+				{
+					Level:   logrus.ErrorLevel,
+					Message: "Agents can only delete themselves",
+					Data: logrus.Fields{
+						telemetry.SPIFFEID: "spiffe://example.org/spire/agent/node1",
+					},
+				},
+			},
+			code: codes.PermissionDenied,
+			err:  "agents can only delete themselves",
+			req: &agentv1.DeleteAgentRequest{
+				Id: &types.SPIFFEID{
+					TrustDomain: "example.org",
+					Path:        "/spire/agent/node1",
+				},
+			},
+		},
 		{
 			name: "malformed SPIFFE ID",
 			expectLogs: []spiretest.LogEntry{
@@ -803,6 +846,9 @@ func TestDeleteAgent(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			test := setupServiceTest(t)
 			defer test.Cleanup()
+			if tt.callerID != "" {
+				test.agentCallerID = spiffeid.RequireFromString(tt.callerID)
+			}
 
 			_, err := test.ds.CreateAttestedNode(ctx, node1)
 			require.NoError(t, err)
@@ -1814,8 +1860,12 @@ type serviceTest struct {
 	clk          clock.Clock
 	logHook      *test.Hook
 	rateLimiter  *fakeRateLimiter
+	nodeEvents   *fakeNodeEvents
 	withCallerID bool
 	pluginCloser func()
+
+	// agentCallerID, if set, makes the calls on behalf of the agent
+	agentCallerID spiffeid.ID
 }
 
 func (s *serviceTest) Cleanup() {
@@ -1830,6 +1880,7 @@ func setupServiceTest(t *testing.T) *serviceTest {
 	ds := fakedatastore.New(t)
 	cat := fakeservercatalog.New()
 	clk := clock.NewMock(t)
+	nodeEvents := &fakeNodeEvents{}
 
 	service := agent.New(agent.Config{
 		ServerCA:    ca,
@@ -1837,6 +1888,7 @@ func setupServiceTest(t *testing.T) *serviceTest {
 		TrustDomain: td,
 		Clock:       clk,
 		Catalog:     cat,
+		NodeEvents:  nodeEvents,
 	})
 
 	log, logHook := test.NewNullLogger()
@@ -1854,6 +1906,7 @@ func setupServiceTest(t *testing.T) *serviceTest {
 		clk:         clk,
 		logHook:     logHook,
 		rateLimiter: rateLimiter,
+		nodeEvents:  nodeEvents,
 	}
 
 	contextFn := func(ctx context.Context) context.Context {
@@ -1862,6 +1915,10 @@ func setupServiceTest(t *testing.T) *serviceTest {
 		if test.withCallerID {
 			ctx = rpccontext.WithCallerID(ctx, agentID)
 		}
+		if !test.agentCallerID.IsZero() {
+			ctx = rpccontext.WithCallerID(ctx, test.agentCallerID)
+			ctx = rpccontext.WithAgentCaller(ctx)
+		}
 		return ctx
 	}
 
@@ -1904,6 +1961,72 @@ func (s *serviceTest) setupResolver(t *testing.T) {
 	s.cat.SetNodeResolver(fakeNodeResolver)
 }
 
+func TestNodeEvents(t *testing.T) {
+	testCsr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, testkey.MustEC256())
+	require.NoError(t, err)
+
+	test := setupServiceTest(t)
+	defer test.Cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	test.setupAttestor(t)
+	test.setupResolver(t)
+	test.setupJoinTokens(ctx, t)
+	test.setupNodes(ctx, t)
+	test.rateLimiter.count = 1
+
+	for _, request := range []*agentv1.AttestAgentRequest{
+		getAttestAgentRequest("join_token", []byte("test_token"), testCsr),
+		getAttestAgentRequest("test_type", []byte("payload_attested_before"), testCsr),
+	} {
+		stream, err := test.client.AttestAgent(ctx)
+		require.NoError(t, err)
+		_, err = attest(t, stream, request)
+		require.NoError(t, err)
+		require.NoError(t, stream.CloseSend())
+	}
+
+	attestedBefore := &types.SPIFFEID{TrustDomain: td.String(), Path: "/spire/agent/test_type/id_attested_before"}
+	_, err = test.client.BanAgent(ctx, &agentv1.BanAgentRequest{Id: attestedBefore})
+	require.NoError(t, err)
+	_, err = test.client.DeleteAgent(ctx, &agentv1.DeleteAgentRequest{Id: attestedBefore})
+	require.NoError(t, err)
+
+	// Failed calls are not notified
+	_, err = test.client.DeleteAgent(ctx, &agentv1.DeleteAgentRequest{Id: attestedBefore})
+	require.Error(t, err)
+
+	events := test.nodeEvents.events
+	require.Len(t, events, 4)
+	for _, event := range events {
+		require.Equal(t, test.clk.Now().UTC(), event.Time)
+	}
+
+	require.Equal(t, nodeevents.AgentAttested, events[0].Type)
+	require.Equal(t, td.NewID("/spire/agent/join_token/test_token").String(), events[0].AgentID)
+	require.Equal(t, "join_token", events[0].AttestationType)
+	require.NotEmpty(t, events[0].SerialNumber)
+	require.NotZero(t, events[0].ExpiresAt)
+
+	require.Equal(t, nodeevents.AgentReattested, events[1].Type)
+	require.Equal(t, td.NewID("/spire/agent/test_type/id_attested_before").String(), events[1].AgentID)
+	require.Equal(t, "test_type", events[1].AttestationType)
+	require.NotEmpty(t, events[1].Selectors)
+
+	require.Equal(t, nodeevents.Event{
+		Type:    nodeevents.AgentBanned,
+		Time:    test.clk.Now().UTC(),
+		AgentID: td.NewID("/spire/agent/test_type/id_attested_before").String(),
+	}, events[2])
+	require.Equal(t, nodeevents.Event{
+		Type:    nodeevents.AgentDeleted,
+		Time:    test.clk.Now().UTC(),
+		AgentID: td.NewID("/spire/agent/test_type/id_attested_before").String(),
+	}, events[3])
+}
+
 func (s *serviceTest) setupNodes(ctx context.Context, t *testing.T) {
 	node := &common.AttestedNode{
 		AttestationDataType: "test_type",
@@ -2052,3 +2175,14 @@ func attest(t *testing.T, stream agentv1.Agent_AttestAgentClient, request *agent
 		return result, err
 	}
 }
+
+type fakeNodeEvents struct {
+	mu     sync.Mutex
+	events []nodeevents.Event
+}
+
+func (n *fakeNodeEvents) NotifyNodeEvent(event nodeevents.Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+}
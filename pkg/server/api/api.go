@@ -28,6 +28,13 @@ func (fn AuthorizedEntryFetcherFunc) FetchAuthorizedEntries(ctx context.Context,
 	return fn(ctx, id)
 }
 
+// AgentSeenRecorder records when the agents were last seen syncing with the
+// server
+type AgentSeenRecorder interface {
+	// AgentSeen records that the agent synced with the server
+	AgentSeen(ctx context.Context, agentID spiffeid.ID)
+}
+
 // AttestedNodeToProto converts an agent from the given *common.AttestedNode with
 // the provided selectors to *types.Agent
 func AttestedNodeToProto(node *common.AttestedNode, selectors []*types.Selector) (*types.Agent, error) {
@@ -9,6 +9,7 @@ import (
 	bundlev1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/bundle/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"github.com/spiffe/spire/pkg/common/idutil"
+	"github.com/spiffe/spire/pkg/common/syncdelta"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	"github.com/spiffe/spire/pkg/server/api"
 	"github.com/spiffe/spire/pkg/server/api/rpccontext"
@@ -17,6 +18,7 @@ import (
 	"github.com/spiffe/spire/proto/spire/common"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -96,7 +98,7 @@ func (s *Service) GetBundle(ctx context.Context, req *bundlev1.GetBundleRequest)
 
 	applyBundleMask(bundle, req.OutputMask)
 	rpccontext.AuditRPC(ctx)
-	return bundle, nil
+	return unchangedBundle(ctx, log, bundle), nil
 }
 
 // AppendBundle appends the given authorities to the given bundlev1.
@@ -270,7 +272,35 @@ func (s *Service) GetFederatedBundle(ctx context.Context, req *bundlev1.GetFeder
 	applyBundleMask(bundle, req.OutputMask)
 	rpccontext.AuditRPC(ctx)
 
-	return bundle, nil
+	return unchangedBundle(ctx, log, bundle), nil
+}
+
+// unchangedBundle returns a bundle without authorities, and sets the trailer
+// telling so, if the agent syncing with delta encoding already holds the
+// bundle. Otherwise the bundle is returned as is.
+func unchangedBundle(ctx context.Context, log logrus.FieldLogger, bundle *types.Bundle) *types.Bundle {
+	md, _ := metadata.FromIncomingContext(ctx)
+	hashes := md.Get(syncdelta.BundleHashKey)
+	if len(hashes) == 0 {
+		return bundle
+	}
+
+	hash, err := syncdelta.BundleHash(bundle)
+	if err != nil {
+		log.WithError(err).Warn("Failed to hash the bundle")
+		return bundle
+	}
+	if hash != hashes[0] {
+		return bundle
+	}
+
+	if err := grpc.SetTrailer(ctx, metadata.Pairs(syncdelta.BundleUnchangedKey, "true")); err != nil {
+		log.WithError(err).Warn("Failed to set the unchanged bundle trailer")
+		return bundle
+	}
+	return &types.Bundle{
+		TrustDomain: bundle.TrustDomain,
+	}
 }
 
 // BatchCreateFederatedBundle adds one or more bundles to the server.
@@ -5,18 +5,23 @@ import (
 	"errors"
 	"strings"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/sirupsen/logrus"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/entryprovenance"
 	"github.com/spiffe/spire/pkg/common/idutil"
+	"github.com/spiffe/spire/pkg/common/syncdelta"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	"github.com/spiffe/spire/pkg/server/api"
 	"github.com/spiffe/spire/pkg/server/api/rpccontext"
+	"github.com/spiffe/spire/pkg/server/cache/dscache"
 	"github.com/spiffe/spire/pkg/server/datastore"
 	"github.com/spiffe/spire/proto/spire/common"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -25,23 +30,47 @@ type Config struct {
 	TrustDomain  spiffeid.TrustDomain
 	EntryFetcher api.AuthorizedEntryFetcher
 	DataStore    datastore.DataStore
+
+	// IDPolicy is enforced on the SPIFFE IDs of the created and updated
+	// entries
+	IDPolicy api.IDPolicy
+
+	// OwnershipPolicy restricts the updates and deletions of the entries to
+	// the callers that created them
+	OwnershipPolicy api.OwnershipPolicy
+
+	// AgentSeen, if set, records when the agents sync their authorized
+	// entries
+	AgentSeen api.AgentSeenRecorder
 }
 
 // Service defines the v1 entry service.
 type Service struct {
 	entryv1.UnsafeEntryServer
 
-	td spiffeid.TrustDomain
-	ds datastore.DataStore
-	ef api.AuthorizedEntryFetcher
+	td              spiffeid.TrustDomain
+	ds              datastore.DataStore
+	ef              api.AuthorizedEntryFetcher
+	idPolicy        api.IDPolicy
+	ownershipPolicy api.OwnershipPolicy
+	agentSeen       api.AgentSeenRecorder
+
+	// syncSnapshots holds the entries last sent to the agents syncing with
+	// delta encoding
+	syncSnapshots *syncdelta.Snapshots
 }
 
 // New creates a new v1 entry service.
 func New(config Config) *Service {
 	return &Service{
-		td: config.TrustDomain,
-		ds: config.DataStore,
-		ef: config.EntryFetcher,
+		td:              config.TrustDomain,
+		ds:              config.DataStore,
+		ef:              config.EntryFetcher,
+		idPolicy:        config.IDPolicy,
+		ownershipPolicy: config.OwnershipPolicy,
+		agentSeen:       config.AgentSeen,
+
+		syncSnapshots: syncdelta.NewSnapshots(clock.New()),
 	}
 }
 
@@ -160,7 +189,7 @@ func (s *Service) GetEntry(ctx context.Context, req *entryv1.GetEntryRequest) (*
 	}
 	rpccontext.AddRPCAuditFields(ctx, logrus.Fields{telemetry.RegistrationID: req.Id})
 	log = log.WithField(telemetry.RegistrationID, req.Id)
-	registrationEntry, err := s.ds.FetchRegistrationEntry(ctx, req.Id)
+	registrationEntry, err := s.ds.FetchRegistrationEntry(dscache.WithCache(ctx), req.Id)
 	if err != nil {
 		return nil, api.MakeErr(log, codes.Internal, "failed to fetch entry", err)
 	}
@@ -181,6 +210,9 @@ func (s *Service) GetEntry(ctx context.Context, req *entryv1.GetEntryRequest) (*
 
 // BatchCreateEntry adds one or more entries to the server.
 func (s *Service) BatchCreateEntry(ctx context.Context, req *entryv1.BatchCreateEntryRequest) (*entryv1.BatchCreateEntryResponse, error) {
+	ctx = withChangedBy(ctx)
+	ctx = withProvenance(ctx)
+
 	var results []*entryv1.BatchCreateEntryResponse_Result
 	for _, eachEntry := range req.Entries {
 		r := s.createEntry(ctx, eachEntry, req.OutputMask)
@@ -205,6 +237,16 @@ func (s *Service) createEntry(ctx context.Context, e *types.Entry, outputMask *t
 		}
 	}
 
+	// Entry IDs are assigned by the datastore on creation
+	cEntry.EntryId = ""
+
+	cEntry.SpiffeId, err = s.idPolicy.Apply(cEntry.SpiffeId)
+	if err != nil {
+		return &entryv1.BatchCreateEntryResponse_Result{
+			Status: api.MakeStatus(log, codes.InvalidArgument, "entry SPIFFE ID rejected", err),
+		}
+	}
+
 	log = log.WithField(telemetry.SPIFFEID, cEntry.SpiffeId)
 
 	existingEntry, err := s.getExistingEntry(ctx, cEntry)
@@ -246,6 +288,8 @@ func (s *Service) createEntry(ctx context.Context, e *types.Entry, outputMask *t
 
 // BatchUpdateEntry updates one or more entries in the server.
 func (s *Service) BatchUpdateEntry(ctx context.Context, req *entryv1.BatchUpdateEntryRequest) (*entryv1.BatchUpdateEntryResponse, error) {
+	ctx = withChangedBy(ctx)
+
 	var results []*entryv1.BatchUpdateEntryResponse_Result
 
 	for _, eachEntry := range req.Entries {
@@ -263,6 +307,8 @@ func (s *Service) BatchUpdateEntry(ctx context.Context, req *entryv1.BatchUpdate
 
 // BatchDeleteEntry removes one or more entries from the server.
 func (s *Service) BatchDeleteEntry(ctx context.Context, req *entryv1.BatchDeleteEntryRequest) (*entryv1.BatchDeleteEntryResponse, error) {
+	ctx = withChangedBy(ctx)
+
 	var results []*entryv1.BatchDeleteEntryResponse_Result
 	for _, id := range req.Ids {
 		r := s.deleteEntry(ctx, id)
@@ -277,6 +323,34 @@ func (s *Service) BatchDeleteEntry(ctx context.Context, req *entryv1.BatchDelete
 	}, nil
 }
 
+// withChangedBy tags the context with the caller, which is recorded in the
+// revision history of the entries it changes, and as the owner of the entries
+// it creates
+func withChangedBy(ctx context.Context) context.Context {
+	if callerID, ok := rpccontext.CallerID(ctx); ok {
+		return datastore.WithChangedBy(ctx, callerID.String())
+	}
+	if rpccontext.CallerIsLocal(ctx) {
+		return datastore.WithChangedBy(ctx, datastore.ChangedByLocal)
+	}
+	return ctx
+}
+
+// withProvenance tags the context with the provenance sent by the caller,
+// e.g. the Kubernetes workload the registrar creates the entries for, which
+// is recorded with the entries created
+func withProvenance(ctx context.Context) context.Context {
+	provenance := entryprovenance.FromIncomingContext(ctx)
+	if provenance == (entryprovenance.Provenance{}) {
+		return ctx
+	}
+	return datastore.WithProvenance(ctx, datastore.Provenance{
+		Cluster:   provenance.Cluster,
+		Namespace: provenance.Namespace,
+		Pod:       provenance.Pod,
+	})
+}
+
 func (s *Service) deleteEntry(ctx context.Context, id string) *entryv1.BatchDeleteEntryResponse_Result {
 	log := rpccontext.Logger(ctx)
 
@@ -289,6 +363,13 @@ func (s *Service) deleteEntry(ctx context.Context, id string) *entryv1.BatchDele
 
 	log = log.WithField(telemetry.RegistrationID, id)
 
+	if st := s.checkEntryOwnership(ctx, log, id); st != nil {
+		return &entryv1.BatchDeleteEntryResponse_Result{
+			Id:     id,
+			Status: st,
+		}
+	}
+
 	_, err := s.ds.DeleteRegistrationEntry(ctx, id)
 	switch status.Code(err) {
 	case codes.OK:
@@ -309,6 +390,23 @@ func (s *Service) deleteEntry(ctx context.Context, id string) *entryv1.BatchDele
 	}
 }
 
+// checkEntryOwnership returns the status of the request if the ownership
+// policy doesn't allow the caller to change the entry, or nil otherwise
+func (s *Service) checkEntryOwnership(ctx context.Context, log logrus.FieldLogger, id string) *types.Status {
+	if !s.ownershipPolicy.Enforced {
+		return nil
+	}
+
+	owner, err := s.ds.FetchRegistrationEntryOwner(ctx, id)
+	if err != nil {
+		return api.MakeStatus(log, codes.Internal, "failed to fetch entry owner", err)
+	}
+	if err := s.ownershipPolicy.Check(datastore.ChangedBy(ctx), owner); err != nil {
+		return api.MakeStatus(log, codes.PermissionDenied, "caller is not allowed to change the entry", err)
+	}
+	return nil
+}
+
 // GetAuthorizedEntries returns the list of entries authorized for the caller ID in the context.
 func (s *Service) GetAuthorizedEntries(ctx context.Context, req *entryv1.GetAuthorizedEntriesRequest) (*entryv1.GetAuthorizedEntriesResponse, error) {
 	log := rpccontext.Logger(ctx)
@@ -322,14 +420,59 @@ func (s *Service) GetAuthorizedEntries(ctx context.Context, req *entryv1.GetAuth
 		entries[i] = entry
 	}
 
+	// Agents syncing with delta encoding send the token of the entries they
+	// hold, which is empty on their first sync
+	md, _ := metadata.FromIncomingContext(ctx)
+	if tokens := md.Get(syncdelta.EntriesTokenKey); len(tokens) > 0 {
+		entries = s.deltaEntries(ctx, log, tokens[0], entries)
+	}
+
 	resp := &entryv1.GetAuthorizedEntriesResponse{
 		Entries: entries,
 	}
+	s.recordAgentSeen(ctx)
 	rpccontext.AuditRPC(ctx)
 
 	return resp, nil
 }
 
+// recordAgentSeen records that the caller synced, if it is an agent
+func (s *Service) recordAgentSeen(ctx context.Context) {
+	if s.agentSeen == nil || !rpccontext.CallerIsAgent(ctx) {
+		return
+	}
+	if callerID, ok := rpccontext.CallerID(ctx); ok {
+		s.agentSeen.AgentSeen(ctx, callerID)
+	}
+}
+
+// deltaEntries returns the entries to send to the agent given the token of
+// the entries it holds, and sets the trailers telling the agent how to apply
+// them. All the entries are returned, without trailers, if that fails.
+func (s *Service) deltaEntries(ctx context.Context, log logrus.FieldLogger, token string, entries []*types.Entry) []*types.Entry {
+	callerID, ok := rpccontext.CallerID(ctx)
+	if !ok {
+		return entries
+	}
+
+	delta, err := s.syncSnapshots.Delta(callerID.String(), token, entries)
+	if err != nil {
+		log.WithError(err).Warn("Failed to compute the delta of the authorized entries")
+		return entries
+	}
+
+	trailer := metadata.Pairs(
+		syncdelta.EntriesModeKey, delta.Mode,
+		syncdelta.EntriesTokenKey, delta.Token,
+	)
+	trailer.Append(syncdelta.RemovedEntriesKey, delta.Removed...)
+	if err := grpc.SetTrailer(ctx, trailer); err != nil {
+		log.WithError(err).Warn("Failed to set the delta trailers of the authorized entries")
+		return entries
+	}
+	return delta.Entries
+}
+
 // fetchEntries fetches authorized entries using caller ID from context
 func (s *Service) fetchEntries(ctx context.Context, log logrus.FieldLogger) ([]*types.Entry, error) {
 	callerID, ok := rpccontext.CallerID(ctx)
@@ -422,6 +565,21 @@ func (s *Service) updateEntry(ctx context.Context, e *types.Entry, inputMask *ty
 		}
 	}
 
+	if inputMask == nil || inputMask.SpiffeId {
+		convEntry.SpiffeId, err = s.idPolicy.Apply(convEntry.SpiffeId)
+		if err != nil {
+			return &entryv1.BatchUpdateEntryResponse_Result{
+				Status: api.MakeStatus(log, codes.InvalidArgument, "entry SPIFFE ID rejected", err),
+			}
+		}
+	}
+
+	if st := s.checkEntryOwnership(ctx, log, e.Id); st != nil {
+		return &entryv1.BatchUpdateEntryResponse_Result{
+			Status: st,
+		}
+	}
+
 	var dsEntry *common.RegistrationEntry
 	if inputMask != nil {
 		mask := &common.RegistrationEntryMask{
@@ -13,6 +13,7 @@ import (
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/entryprovenance"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	"github.com/spiffe/spire/pkg/server/api"
 	"github.com/spiffe/spire/pkg/server/api/entry/v1"
@@ -26,6 +27,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 )
@@ -2192,6 +2194,27 @@ func TestGetAuthorizedEntries(t *testing.T) {
 	}
 }
 
+func TestGetAuthorizedEntriesRecordsAgentSeen(t *testing.T) {
+	agentSeen := &fakeAgentSeen{}
+	service := entry.New(entry.Config{
+		TrustDomain:  td,
+		DataStore:    fakedatastore.New(t),
+		EntryFetcher: &entryFetcher{},
+		AgentSeen:    agentSeen,
+	})
+	log, _ := test.NewNullLogger()
+	ctx := rpccontext.WithCallerID(rpccontext.WithLogger(context.Background(), log), agentID)
+
+	// Only the syncs of agents are recorded
+	_, err := service.GetAuthorizedEntries(ctx, &entryv1.GetAuthorizedEntriesRequest{})
+	require.NoError(t, err)
+	require.Empty(t, agentSeen.seen)
+
+	_, err = service.GetAuthorizedEntries(rpccontext.WithAgentCaller(ctx), &entryv1.GetAuthorizedEntriesRequest{})
+	require.NoError(t, err)
+	require.Equal(t, []spiffeid.ID{agentID}, agentSeen.seen)
+}
+
 func createFederatedBundles(t *testing.T, ds datastore.DataStore) {
 	_, err := ds.CreateBundle(ctx, &common.Bundle{
 		TrustDomainId: federatedTd.IDString(),
@@ -2283,6 +2306,247 @@ func setupServiceTest(t *testing.T, ds datastore.DataStore) *serviceTest {
 	return test
 }
 
+func TestIDPolicy(t *testing.T) {
+	ds := fakedatastore.New(t)
+	service := entry.New(entry.Config{
+		TrustDomain:  td,
+		DataStore:    ds,
+		EntryFetcher: &entryFetcher{},
+		IDPolicy: api.IDPolicy{
+			Action:          api.IDPolicyNormalize,
+			LowercasePath:   true,
+			NoTrailingSlash: true,
+			MaxSegments:     2,
+		},
+	})
+	log, _ := test.NewNullLogger()
+	ctx := rpccontext.WithLogger(context.Background(), log)
+
+	createResp, err := service.BatchCreateEntry(ctx, &entryv1.BatchCreateEntryRequest{
+		Entries: []*types.Entry{
+			{
+				ParentId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/parent"},
+				SpiffeId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/NS/Workload"},
+				Selectors: []*types.Selector{{Type: "unix", Value: "uid:1000"}},
+			},
+			{
+				ParentId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/parent"},
+				SpiffeId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/ns/team/workload"},
+				Selectors: []*types.Selector{{Type: "unix", Value: "uid:1000"}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, createResp.Results, 2)
+
+	// The first entry is created with its SPIFFE ID normalized
+	spiretest.AssertProtoEqual(t, api.OK(), createResp.Results[0].Status)
+	spiretest.AssertProtoEqual(t, &types.SPIFFEID{TrustDomain: "example.org", Path: "/ns/workload"}, createResp.Results[0].Entry.SpiffeId)
+
+	// The second entry has more segments than allowed
+	spiretest.AssertProtoEqual(t, &types.Status{
+		Code:    int32(codes.InvalidArgument),
+		Message: `entry SPIFFE ID rejected: "spiffe://example.org/ns/team/workload" violates the SPIFFE ID policy: path has 3 segments, more than the maximum of 2`,
+	}, createResp.Results[1].Status)
+
+	// Updates of the SPIFFE ID are normalized as well
+	updateResp, err := service.BatchUpdateEntry(ctx, &entryv1.BatchUpdateEntryRequest{
+		Entries: []*types.Entry{
+			{
+				Id:       createResp.Results[0].Entry.Id,
+				SpiffeId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/NS/Web"},
+			},
+		},
+		InputMask: &types.EntryMask{SpiffeId: true},
+	})
+	require.NoError(t, err)
+	require.Len(t, updateResp.Results, 1)
+	spiretest.AssertProtoEqual(t, api.OK(), updateResp.Results[0].Status)
+	spiretest.AssertProtoEqual(t, &types.SPIFFEID{TrustDomain: "example.org", Path: "/ns/web"}, updateResp.Results[0].Entry.SpiffeId)
+}
+
+func TestChangedBy(t *testing.T) {
+	ds := fakedatastore.New(t)
+	service := entry.New(entry.Config{
+		TrustDomain:  td,
+		DataStore:    ds,
+		EntryFetcher: &entryFetcher{},
+	})
+	log, _ := test.NewNullLogger()
+	ctx := rpccontext.WithLogger(context.Background(), log)
+	adminCtx := rpccontext.WithCallerID(ctx, spiffeid.RequireFromString("spiffe://example.org/admin"))
+	localCtx := rpccontext.WithLocalCaller(ctx)
+
+	createResp, err := service.BatchCreateEntry(adminCtx, &entryv1.BatchCreateEntryRequest{
+		Entries: []*types.Entry{
+			{
+				ParentId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/parent"},
+				SpiffeId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/workload"},
+				Selectors: []*types.Selector{{Type: "unix", Value: "uid:1000"}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, createResp.Results, 1)
+	spiretest.AssertProtoEqual(t, api.OK(), createResp.Results[0].Status)
+	entryID := createResp.Results[0].Entry.Id
+
+	updateResp, err := service.BatchUpdateEntry(localCtx, &entryv1.BatchUpdateEntryRequest{
+		Entries:   []*types.Entry{{Id: entryID, Ttl: 60}},
+		InputMask: &types.EntryMask{Ttl: true},
+	})
+	require.NoError(t, err)
+	spiretest.AssertProtoEqual(t, api.OK(), updateResp.Results[0].Status)
+
+	deleteResp, err := service.BatchDeleteEntry(adminCtx, &entryv1.BatchDeleteEntryRequest{
+		Ids: []string{entryID},
+	})
+	require.NoError(t, err)
+	spiretest.AssertProtoEqual(t, api.OK(), deleteResp.Results[0].Status)
+
+	revisions, err := ds.ListRegistrationEntryRevisions(ctx, entryID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+	assert.Equal(t, "spiffe://example.org/admin", revisions[0].ChangedBy)
+	assert.Equal(t, "local", revisions[1].ChangedBy)
+	assert.Equal(t, "spiffe://example.org/admin", revisions[2].ChangedBy)
+}
+
+func TestProvenance(t *testing.T) {
+	ds := fakedatastore.New(t)
+	service := entry.New(entry.Config{
+		TrustDomain:  td,
+		DataStore:    ds,
+		EntryFetcher: &entryFetcher{},
+	})
+	log, _ := test.NewNullLogger()
+	ctx := rpccontext.WithLogger(context.Background(), log)
+	registrarCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(
+		entryprovenance.ClusterKey, "east",
+		entryprovenance.NamespaceKey, "web",
+		entryprovenance.PodKey, "web-0",
+	))
+
+	createEntry := func(ctx context.Context, path string) string {
+		resp, err := service.BatchCreateEntry(ctx, &entryv1.BatchCreateEntryRequest{
+			Entries: []*types.Entry{
+				{
+					ParentId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/parent"},
+					SpiffeId:  &types.SPIFFEID{TrustDomain: "example.org", Path: path},
+					Selectors: []*types.Selector{{Type: "unix", Value: "uid:1000"}},
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, resp.Results, 1)
+		spiretest.AssertProtoEqual(t, api.OK(), resp.Results[0].Status)
+		return resp.Results[0].Entry.Id
+	}
+	stampedID := createEntry(registrarCtx, "/web")
+	createEntry(ctx, "/manual")
+
+	resp, err := ds.ListRegistrationEntries(ctx, &datastore.ListRegistrationEntriesRequest{
+		ByProvenance: &datastore.Provenance{Cluster: "east", Namespace: "web"},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Entries, 1)
+	assert.Equal(t, stampedID, resp.Entries[0].EntryId)
+}
+
+func TestOwnershipPolicy(t *testing.T) {
+	ds := fakedatastore.New(t)
+	service := entry.New(entry.Config{
+		TrustDomain:  td,
+		DataStore:    ds,
+		EntryFetcher: &entryFetcher{},
+		OwnershipPolicy: api.OwnershipPolicy{
+			Enforced:    true,
+			OverrideIDs: []string{"spiffe://example.org/admin"},
+		},
+	})
+	log, _ := test.NewNullLogger()
+	ctx := rpccontext.WithLogger(context.Background(), log)
+	ownerCtx := rpccontext.WithCallerID(ctx, spiffeid.RequireFromString("spiffe://example.org/owner"))
+	otherCtx := rpccontext.WithCallerID(ctx, spiffeid.RequireFromString("spiffe://example.org/other"))
+	adminCtx := rpccontext.WithCallerID(ctx, spiffeid.RequireFromString("spiffe://example.org/admin"))
+	localCtx := rpccontext.WithLocalCaller(ctx)
+
+	createEntry := func(path string) string {
+		resp, err := service.BatchCreateEntry(ownerCtx, &entryv1.BatchCreateEntryRequest{
+			Entries: []*types.Entry{
+				{
+					ParentId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/parent"},
+					SpiffeId:  &types.SPIFFEID{TrustDomain: "example.org", Path: path},
+					Selectors: []*types.Selector{{Type: "unix", Value: "uid:1000"}},
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, resp.Results, 1)
+		spiretest.AssertProtoEqual(t, api.OK(), resp.Results[0].Status)
+		return resp.Results[0].Entry.Id
+	}
+	updateEntry := func(ctx context.Context, id string) *types.Status {
+		resp, err := service.BatchUpdateEntry(ctx, &entryv1.BatchUpdateEntryRequest{
+			Entries:   []*types.Entry{{Id: id, Ttl: 60}},
+			InputMask: &types.EntryMask{Ttl: true},
+		})
+		require.NoError(t, err)
+		require.Len(t, resp.Results, 1)
+		return resp.Results[0].Status
+	}
+	deleteEntry := func(ctx context.Context, id string) *types.Status {
+		resp, err := service.BatchDeleteEntry(ctx, &entryv1.BatchDeleteEntryRequest{
+			Ids: []string{id},
+		})
+		require.NoError(t, err)
+		require.Len(t, resp.Results, 1)
+		return resp.Results[0].Status
+	}
+
+	denied := &types.Status{
+		Code:    int32(codes.PermissionDenied),
+		Message: `caller is not allowed to change the entry: entry is owned by "spiffe://example.org/owner"`,
+	}
+
+	// Other callers can't change the entry
+	entryID := createEntry("/workload1")
+	spiretest.AssertProtoEqual(t, denied, updateEntry(otherCtx, entryID))
+	spiretest.AssertProtoEqual(t, denied, deleteEntry(otherCtx, entryID))
+
+	// The owner, the override IDs and the local callers can
+	spiretest.AssertProtoEqual(t, api.OK(), updateEntry(ownerCtx, entryID))
+	spiretest.AssertProtoEqual(t, api.OK(), updateEntry(adminCtx, entryID))
+	spiretest.AssertProtoEqual(t, api.OK(), updateEntry(localCtx, entryID))
+	spiretest.AssertProtoEqual(t, api.OK(), deleteEntry(ownerCtx, entryID))
+	spiretest.AssertProtoEqual(t, api.OK(), deleteEntry(adminCtx, createEntry("/workload2")))
+	spiretest.AssertProtoEqual(t, api.OK(), deleteEntry(localCtx, createEntry("/workload3")))
+
+	// Entries without owner can be changed by anyone
+	unowned, err := ds.CreateRegistrationEntry(ctx, &common.RegistrationEntry{
+		ParentId:  "spiffe://example.org/parent",
+		SpiffeId:  "spiffe://example.org/workload4",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+	})
+	require.NoError(t, err)
+	spiretest.AssertProtoEqual(t, api.OK(), updateEntry(otherCtx, unowned.EntryId))
+	spiretest.AssertProtoEqual(t, api.OK(), deleteEntry(otherCtx, unowned.EntryId))
+
+	// Unknown entries are still reported as such
+	spiretest.AssertProtoEqual(t, &types.Status{
+		Code:    int32(codes.NotFound),
+		Message: "entry not found",
+	}, deleteEntry(otherCtx, "unknown"))
+
+	// Failures to fetch the owner fail the change
+	entryID = createEntry("/workload5")
+	ds.SetNextError(errors.New("oh no"))
+	spiretest.AssertProtoEqual(t, &types.Status{
+		Code:    int32(codes.Internal),
+		Message: "failed to fetch entry owner: oh no",
+	}, deleteEntry(otherCtx, entryID))
+}
+
 func TestBatchUpdateEntry(t *testing.T) {
 	parent := &types.SPIFFEID{TrustDomain: "example.org", Path: "/parent"}
 	entry1SpiffeID := &types.SPIFFEID{TrustDomain: "example.org", Path: "/workload"}
@@ -3367,6 +3631,14 @@ func (f *fakeDS) CreateRegistrationEntry(ctx context.Context, entry *common.Regi
 	return res, nil
 }
 
+type fakeAgentSeen struct {
+	seen []spiffeid.ID
+}
+
+func (f *fakeAgentSeen) AgentSeen(ctx context.Context, agentID spiffeid.ID) {
+	f.seen = append(f.seen, agentID)
+}
+
 type entryFetcher struct {
 	err     string
 	entries []*types.Entry
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// IDPolicyAction is what an IDPolicy does with SPIFFE IDs violating it
+type IDPolicyAction string
+
+const (
+	// IDPolicyReject rejects the SPIFFE IDs violating the policy
+	IDPolicyReject IDPolicyAction = "reject"
+
+	// IDPolicyNormalize normalizes the SPIFFE IDs violating the policy when
+	// possible, and rejects them otherwise
+	IDPolicyNormalize IDPolicyAction = "normalize"
+)
+
+// IDPolicy holds the conventions enforced on the SPIFFE IDs of the
+// registration entries, whatever the client creating or updating them. The
+// zero value enforces nothing.
+type IDPolicy struct {
+	// Action is what is done with the SPIFFE IDs violating the policy
+	Action IDPolicyAction
+
+	// LowercasePath requires the path to be lowercase
+	LowercasePath bool
+
+	// NoTrailingSlash requires the path not to end with a slash
+	NoTrailingSlash bool
+
+	// MaxSegments, if greater than zero, is the maximum number of segments
+	// of the path. SPIFFE IDs with more segments are always rejected.
+	MaxSegments int
+}
+
+// Apply returns the SPIFFE ID, normalized if the action of the policy is
+// IDPolicyNormalize, or an error if it violates the policy
+func (p IDPolicy) Apply(id string) (string, error) {
+	if !p.LowercasePath && !p.NoTrailingSlash && p.MaxSegments <= 0 {
+		return id, nil
+	}
+
+	u, err := url.Parse(id)
+	if err != nil {
+		return "", err
+	}
+	path := u.Path
+	normalize := p.Action == IDPolicyNormalize
+
+	if p.LowercasePath && path != strings.ToLower(path) {
+		if !normalize {
+			return "", fmt.Errorf("%q violates the SPIFFE ID policy: path must be lowercase", id)
+		}
+		path = strings.ToLower(path)
+	}
+
+	if p.NoTrailingSlash && len(path) > 1 && strings.HasSuffix(path, "/") {
+		if !normalize {
+			return "", fmt.Errorf("%q violates the SPIFFE ID policy: path cannot have a trailing slash", id)
+		}
+		path = strings.TrimRight(path, "/")
+	}
+
+	if p.MaxSegments > 0 {
+		if segments := pathSegments(path); segments > p.MaxSegments {
+			return "", fmt.Errorf("%q violates the SPIFFE ID policy: path has %d segments, more than the maximum of %d", id, segments, p.MaxSegments)
+		}
+	}
+
+	if path == u.Path {
+		return id, nil
+	}
+	u.Path = path
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+func pathSegments(path string) int {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return 0
+	}
+	return strings.Count(path, "/") + 1
+}
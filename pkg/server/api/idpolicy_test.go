@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/spiffe/spire/pkg/server/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIDPolicyApply(t *testing.T) {
+	strict := api.IDPolicy{
+		Action:          api.IDPolicyReject,
+		LowercasePath:   true,
+		NoTrailingSlash: true,
+		MaxSegments:     3,
+	}
+	normalizing := strict
+	normalizing.Action = api.IDPolicyNormalize
+
+	for _, tt := range []struct {
+		name      string
+		policy    api.IDPolicy
+		id        string
+		expectID  string
+		expectErr string
+	}{
+		{
+			name:     "empty policy",
+			id:       "spiffe://example.org/Workload/",
+			expectID: "spiffe://example.org/Workload/",
+		},
+		{
+			name:     "conforming ID",
+			policy:   strict,
+			id:       "spiffe://example.org/ns/prod/web",
+			expectID: "spiffe://example.org/ns/prod/web",
+		},
+		{
+			name:      "uppercase path rejected",
+			policy:    strict,
+			id:        "spiffe://example.org/ns/Prod",
+			expectErr: `"spiffe://example.org/ns/Prod" violates the SPIFFE ID policy: path must be lowercase`,
+		},
+		{
+			name:     "uppercase path normalized",
+			policy:   normalizing,
+			id:       "spiffe://example.org/ns/Prod",
+			expectID: "spiffe://example.org/ns/prod",
+		},
+		{
+			name:      "trailing slash rejected",
+			policy:    strict,
+			id:        "spiffe://example.org/ns/prod/",
+			expectErr: `"spiffe://example.org/ns/prod/" violates the SPIFFE ID policy: path cannot have a trailing slash`,
+		},
+		{
+			name:     "trailing slash normalized",
+			policy:   normalizing,
+			id:       "spiffe://example.org/NS/prod//",
+			expectID: "spiffe://example.org/ns/prod",
+		},
+		{
+			name:      "too many segments rejected",
+			policy:    strict,
+			id:        "spiffe://example.org/a/b/c/d",
+			expectErr: `"spiffe://example.org/a/b/c/d" violates the SPIFFE ID policy: path has 4 segments, more than the maximum of 3`,
+		},
+		{
+			name:      "too many segments rejected when normalizing",
+			policy:    normalizing,
+			id:        "spiffe://example.org/a/b/c/d/",
+			expectErr: `"spiffe://example.org/a/b/c/d/" violates the SPIFFE ID policy: path has 4 segments, more than the maximum of 3`,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tt.policy.Apply(tt.id)
+			if tt.expectErr != "" {
+				require.EqualError(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectID, id)
+		})
+	}
+}
@@ -3,18 +3,40 @@ package middleware
 import (
 	"context"
 
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"github.com/spiffe/spire/pkg/server/api/rpccontext"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// DownstreamPolicy further restricts which downstream workloads are
+// authorized to call the downstream APIs, on top of being registered as
+// downstream. The zero value authorizes every downstream workload.
+type DownstreamPolicy struct {
+	// AllowedIDs, if not empty, are the SPIFFE IDs of the only downstream
+	// workloads authorized.
+	AllowedIDs []spiffeid.ID
+
+	// RequiredSelectors, if not empty, are selectors the downstream entries
+	// of the workload must all have. Downstream entries without them are not
+	// considered.
+	RequiredSelectors []*types.Selector
+}
+
 func AuthorizeDownstream(entryFetcher EntryFetcher) Authorizer {
-	return downstreamAuthorizer{entryFetcher: entryFetcher}
+	return AuthorizeDownstreamWithPolicy(entryFetcher, DownstreamPolicy{})
+}
+
+// AuthorizeDownstreamWithPolicy returns an authorizer of downstream workloads
+// that are also allowed by the given policy.
+func AuthorizeDownstreamWithPolicy(entryFetcher EntryFetcher, policy DownstreamPolicy) Authorizer {
+	return downstreamAuthorizer{entryFetcher: entryFetcher, policy: policy}
 }
 
 type downstreamAuthorizer struct {
 	entryFetcher EntryFetcher
+	policy       DownstreamPolicy
 }
 
 func (a downstreamAuthorizer) Name() string {
@@ -37,5 +59,61 @@ func (a downstreamAuthorizer) AuthorizeCaller(ctx context.Context) (context.Cont
 		return nil, status.Error(codes.PermissionDenied, "caller is not a downstream workload")
 	}
 
+	if !a.isAllowedID(ctx) {
+		rpccontext.Logger(ctx).Warn("Downstream caller is not in the downstream allow-list")
+		return nil, status.Error(codes.PermissionDenied, "caller is not an allowed downstream workload")
+	}
+
+	downstreamEntries = a.filterBySelectors(downstreamEntries)
+	if len(downstreamEntries) == 0 {
+		rpccontext.Logger(ctx).Warn("Downstream caller entries do not have the selectors required by the downstream policy")
+		return nil, status.Error(codes.PermissionDenied, "caller is not an allowed downstream workload")
+	}
+
 	return rpccontext.WithCallerDownstreamEntries(ctx, downstreamEntries), nil
 }
+
+func (a downstreamAuthorizer) isAllowedID(ctx context.Context) bool {
+	if len(a.policy.AllowedIDs) == 0 {
+		return true
+	}
+
+	// The caller has an ID, since it has downstream entries
+	callerID, _ := rpccontext.CallerID(ctx)
+	for _, id := range a.policy.AllowedIDs {
+		if id == callerID {
+			return true
+		}
+	}
+	return false
+}
+
+func (a downstreamAuthorizer) filterBySelectors(entries []*types.Entry) []*types.Entry {
+	if len(a.policy.RequiredSelectors) == 0 {
+		return entries
+	}
+
+	filtered := make([]*types.Entry, 0, len(entries))
+	for _, entry := range entries {
+		if hasSelectors(entry, a.policy.RequiredSelectors) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+func hasSelectors(entry *types.Entry, selectors []*types.Selector) bool {
+	for _, required := range selectors {
+		found := false
+		for _, selector := range entry.Selectors {
+			if selector.Type == required.Type && selector.Value == required.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
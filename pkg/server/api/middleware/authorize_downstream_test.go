@@ -105,3 +105,106 @@ func TestDownstreamAuthorizer(t *testing.T) {
 		})
 	}
 }
+
+func TestDownstreamAuthorizerWithPolicy(t *testing.T) {
+	allowedID := spiffeid.Must("example.org", "allowed")
+	notAllowedID := spiffeid.Must("example.org", "not-allowed")
+	entries := map[spiffeid.ID][]*types.Entry{
+		allowedID: {
+			{Id: "1", Downstream: true, Selectors: []*types.Selector{{Type: "k8s", Value: "ns:spire"}, {Type: "k8s", Value: "sa:spire-server"}}},
+			{Id: "2", Downstream: true, Selectors: []*types.Selector{{Type: "k8s", Value: "ns:default"}}},
+			{Id: "3", Selectors: []*types.Selector{{Type: "k8s", Value: "ns:spire"}}},
+		},
+		notAllowedID: {
+			{Id: "4", Downstream: true, Selectors: []*types.Selector{{Type: "k8s", Value: "ns:spire"}}},
+		},
+	}
+	entryFetcher := middleware.EntryFetcherFunc(
+		func(ctx context.Context, id spiffeid.ID) ([]*types.Entry, error) {
+			return entries[id], nil
+		},
+	)
+
+	for _, tt := range []struct {
+		name          string
+		policy        middleware.DownstreamPolicy
+		id            spiffeid.ID
+		expectCode    codes.Code
+		expectMsg     string
+		expectEntries []*types.Entry
+		expectLogs    []spiretest.LogEntry
+	}{
+		{
+			name:          "empty policy",
+			id:            notAllowedID,
+			expectCode:    codes.OK,
+			expectEntries: entries[notAllowedID],
+		},
+		{
+			name:          "allowed ID",
+			policy:        middleware.DownstreamPolicy{AllowedIDs: []spiffeid.ID{allowedID}},
+			id:            allowedID,
+			expectCode:    codes.OK,
+			expectEntries: entries[allowedID][:2],
+		},
+		{
+			name:       "not allowed ID",
+			policy:     middleware.DownstreamPolicy{AllowedIDs: []spiffeid.ID{allowedID}},
+			id:         notAllowedID,
+			expectCode: codes.PermissionDenied,
+			expectMsg:  "caller is not an allowed downstream workload",
+			expectLogs: []spiretest.LogEntry{
+				{
+					Level:   logrus.WarnLevel,
+					Message: "Downstream caller is not in the downstream allow-list",
+				},
+			},
+		},
+		{
+			name: "required selectors",
+			policy: middleware.DownstreamPolicy{RequiredSelectors: []*types.Selector{
+				{Type: "k8s", Value: "ns:spire"},
+				{Type: "k8s", Value: "sa:spire-server"},
+			}},
+			id:            allowedID,
+			expectCode:    codes.OK,
+			expectEntries: entries[allowedID][:1],
+		},
+		{
+			name: "missing required selectors",
+			policy: middleware.DownstreamPolicy{RequiredSelectors: []*types.Selector{
+				{Type: "k8s", Value: "ns:spire"},
+				{Type: "k8s", Value: "sa:spire-server"},
+			}},
+			id:         notAllowedID,
+			expectCode: codes.PermissionDenied,
+			expectMsg:  "caller is not an allowed downstream workload",
+			expectLogs: []spiretest.LogEntry{
+				{
+					Level:   logrus.WarnLevel,
+					Message: "Downstream caller entries do not have the selectors required by the downstream policy",
+				},
+			},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			log, hook := test.NewNullLogger()
+			ctx := rpccontext.WithLogger(context.Background(), log)
+			ctx = rpccontext.WithCallerID(ctx, tt.id)
+
+			authorizer := middleware.AuthorizeDownstreamWithPolicy(entryFetcher, tt.policy)
+			ctx, err := authorizer.AuthorizeCaller(ctx)
+			spiretest.RequireGRPCStatus(t, err, tt.expectCode, tt.expectMsg)
+			spiretest.AssertLogs(t, hook.AllEntries(), tt.expectLogs)
+			if tt.expectCode == codes.OK {
+				entries, ok := rpccontext.CallerDownstreamEntries(ctx)
+				if assert.True(t, ok, "context should have downstream entries") {
+					assert.Equal(t, tt.expectEntries, entries, "downstream entries don't match")
+				}
+			} else {
+				assert.Nil(t, ctx)
+			}
+		})
+	}
+}
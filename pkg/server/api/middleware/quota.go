@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/server/api"
+	"github.com/spiffe/spire/pkg/server/api/rpccontext"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// PerCallerQuota returns a rate limiter that imposes a quota on the
+// signatures requested by each caller, identified by its SPIFFE ID, of at
+// most perMinute signatures per minute. It can be shared across methods to
+// enforce the quota for a group of methods. Unlike the other rate limiters,
+// calls over the quota are not delayed: they fail right away with a
+// RESOURCE_EXHAUSTED status carrying the delay after which to retry. The
+// quota name labels the metrics and errors.
+func PerCallerQuota(name string, perMinute int, metrics telemetry.Metrics) api.RateLimiter {
+	return &perCallerQuota{
+		name:      name,
+		perMinute: perMinute,
+		metrics:   metrics,
+		current:   make(map[string]*rate.Limiter),
+		lastGC:    clk.Now(),
+	}
+}
+
+// AllLimits returns a rate limiter that applies all the given rate limiters,
+// in order, failing on the first one that fails.
+func AllLimits(limiters ...api.RateLimiter) api.RateLimiter {
+	return allLimits(limiters)
+}
+
+type allLimits []api.RateLimiter
+
+func (limiters allLimits) RateLimit(ctx context.Context, count int) error {
+	for _, limiter := range limiters {
+		if err := limiter.RateLimit(ctx, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type perCallerQuota struct {
+	name      string
+	perMinute int
+	metrics   telemetry.Metrics
+
+	mtx sync.Mutex
+
+	// previous and current hold the limiters of the callers like they do
+	// for the per-ip limiter. A limiter unused since the last GC has been
+	// refilled, so it can be dropped.
+	previous map[string]*rate.Limiter
+	current  map[string]*rate.Limiter
+	lastGC   time.Time
+}
+
+func (q *perCallerQuota) RateLimit(ctx context.Context, count int) error {
+	callerID, ok := rpccontext.CallerID(ctx)
+	if !ok {
+		// Local callers have no quota
+		return nil
+	}
+
+	now := clk.Now()
+	reservation := q.getLimiter(callerID.String(), now).ReserveN(now, count)
+	if !reservation.OK() {
+		q.exceeded()
+		return status.Errorf(codes.ResourceExhausted, "%s signing quota exceeded: %d signatures requested at once, at most %d per minute", q.name, count, q.perMinute)
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		q.exceeded()
+		return quotaExceeded(q.name, q.perMinute, delay)
+	}
+	return nil
+}
+
+func (q *perCallerQuota) getLimiter(key string, now time.Time) *rate.Limiter {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if limiter, ok := q.current[key]; ok {
+		return limiter
+	}
+	if limiter, ok := q.previous[key]; ok {
+		q.current[key] = limiter
+		delete(q.previous, key)
+		return limiter
+	}
+
+	if now.Sub(q.lastGC) >= gcInterval {
+		q.previous = q.current
+		q.current = make(map[string]*rate.Limiter)
+		q.lastGC = now
+	}
+
+	limiter := rate.NewLimiter(rate.Limit(float64(q.perMinute)/time.Minute.Seconds()), q.perMinute)
+	q.current[key] = limiter
+	return limiter
+}
+
+func (q *perCallerQuota) exceeded() {
+	if q.metrics != nil {
+		q.metrics.IncrCounterWithLabels([]string{telemetry.SigningQuota, telemetry.Exceeded}, 1, []telemetry.Label{
+			{Name: telemetry.Quota, Value: q.name},
+		})
+	}
+}
+
+// quotaExceeded returns the RESOURCE_EXHAUSTED status of a call over the
+// quota, telling when to retry, like an HTTP 429 with Retry-After
+func quotaExceeded(name string, perMinute int, delay time.Duration) error {
+	st := status.Newf(codes.ResourceExhausted, "%s signing quota of %d signatures per minute exceeded; retry in %s", name, perMinute, delay.Round(time.Millisecond))
+	if withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
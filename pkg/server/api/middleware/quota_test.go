@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/server/api"
+	"github.com/spiffe/spire/pkg/server/api/rpccontext"
+	"github.com/spiffe/spire/test/fakes/fakemetrics"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestPerCallerQuota(t *testing.T) {
+	mockClk, restoreClk := setupClock(t)
+	defer restoreClk()
+
+	metrics := fakemetrics.New()
+	m := PerCallerQuota("agent", 60, metrics)
+
+	agentA := callerIDContext("spiffe://example.org/spire/agent/a")
+	agentB := callerIDContext("spiffe://example.org/spire/agent/b")
+
+	// Does not limit callers without a SPIFFE ID
+	require.NoError(t, m.RateLimit(context.Background(), 100))
+
+	// Fails right away when asking for more than the quota at once
+	err := m.RateLimit(agentA, 61)
+	spiretest.RequireGRPCStatus(t, err, codes.ResourceExhausted, "agent signing quota exceeded: 61 signatures requested at once, at most 60 per minute")
+
+	// Uses up the quota of agent A
+	require.NoError(t, m.RateLimit(agentA, 60))
+
+	// Agent A is over the quota and is told when to retry
+	err = m.RateLimit(agentA, 1)
+	spiretest.RequireGRPCStatus(t, err, codes.ResourceExhausted, "agent signing quota of 60 signatures per minute exceeded; retry in 1s")
+	details := status.Convert(err).Details()
+	require.Len(t, details, 1)
+	spiretest.AssertProtoEqual(t, &errdetails.RetryInfo{RetryDelay: durationpb.New(time.Second)}, details[0].(*errdetails.RetryInfo))
+
+	// Agent B has its own quota
+	require.NoError(t, m.RateLimit(agentB, 60))
+
+	// The rejected calls did not take from the quota, so agent A can sign
+	// again once the quota refills
+	mockClk.Add(time.Second)
+	require.NoError(t, m.RateLimit(agentA, 1))
+	err = m.RateLimit(agentA, 1)
+	spiretest.RequireGRPCStatus(t, err, codes.ResourceExhausted, "agent signing quota of 60 signatures per minute exceeded; retry in 1s")
+
+	exceeded := fakemetrics.MetricItem{
+		Type:   fakemetrics.IncrCounterWithLabelsType,
+		Key:    []string{telemetry.SigningQuota, telemetry.Exceeded},
+		Val:    1,
+		Labels: []telemetry.Label{{Name: telemetry.Quota, Value: "agent"}},
+	}
+	assert.Equal(t, []fakemetrics.MetricItem{exceeded, exceeded, exceeded}, metrics.AllMetrics())
+}
+
+func TestPerCallerQuotaGC(t *testing.T) {
+	mockClk, restoreClk := setupClock(t)
+	defer restoreClk()
+
+	m := PerCallerQuota("agent", 60, nil).(*perCallerQuota)
+
+	agentA := callerIDContext("spiffe://example.org/spire/agent/a")
+	agentB := callerIDContext("spiffe://example.org/spire/agent/b")
+	agentC := callerIDContext("spiffe://example.org/spire/agent/c")
+
+	// Agent A uses up its quota
+	require.NoError(t, m.RateLimit(agentA, 60))
+
+	// Past the GC time, creating a limiter moves the existing ones to the
+	// previous set, and using the limiter of agent A moves it back
+	mockClk.Add(gcInterval)
+	require.NoError(t, m.RateLimit(agentB, 1))
+	require.NoError(t, m.RateLimit(agentA, 60))
+	assert.Len(t, m.current, 2)
+	assert.Empty(t, m.previous)
+
+	// Past the next GC time, agents A and B are moved to the previous set
+	mockClk.Add(gcInterval)
+	require.NoError(t, m.RateLimit(agentC, 1))
+	assert.Len(t, m.current, 1)
+	assert.Len(t, m.previous, 2)
+
+	// Past the one after, agent A is dropped since it went unused
+	mockClk.Add(gcInterval)
+	require.NoError(t, m.RateLimit(agentB, 1))
+	require.NoError(t, m.RateLimit(callerIDContext("spiffe://example.org/spire/agent/d"), 1))
+	assert.Len(t, m.current, 1)
+	assert.Len(t, m.previous, 2)
+	assert.NotContains(t, m.previous, "spiffe://example.org/spire/agent/a")
+}
+
+func TestAllLimits(t *testing.T) {
+	var calls []string
+	limiter := func(name string, err error) api.RateLimiter {
+		return fakeRateLimiter(func(ctx context.Context, count int) error {
+			calls = append(calls, name)
+			return err
+		})
+	}
+
+	m := AllLimits(limiter("first", nil), limiter("second", nil))
+	require.NoError(t, m.RateLimit(context.Background(), 1))
+	assert.Equal(t, []string{"first", "second"}, calls)
+
+	calls = nil
+	m = AllLimits(limiter("first", errors.New("oh no")), limiter("second", nil))
+	require.EqualError(t, m.RateLimit(context.Background(), 1), "oh no")
+	assert.Equal(t, []string{"first"}, calls)
+}
+
+type fakeRateLimiter func(ctx context.Context, count int) error
+
+func (f fakeRateLimiter) RateLimit(ctx context.Context, count int) error {
+	return f(ctx, count)
+}
+
+func callerIDContext(id string) context.Context {
+	return rpccontext.WithCallerID(context.Background(), spiffeid.RequireFromString(id))
+}
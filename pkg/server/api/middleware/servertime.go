@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/spiffe/spire/pkg/common/clockskew"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// WithServerTime sends the time of the server in a response header of each
+// call, so that agents can measure the skew of their clock.
+func WithServerTime() Middleware {
+	return Preprocess(func(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+		// Failing to set the header only keeps the caller from measuring the
+		// skew, so the call goes on.
+		_ = grpc.SetHeader(ctx, metadata.Pairs(clockskew.ServerTimeKey, clockskew.FormatTime(clk.Now())))
+		return ctx, nil
+	})
+}
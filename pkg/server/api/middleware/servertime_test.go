@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spiffe/spire/pkg/common/clockskew"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestWithServerTime(t *testing.T) {
+	mockClk, restoreClk := setupClock(t)
+	defer restoreClk()
+	mockClk.Set(time.Unix(1600000000, 123456789))
+
+	stream := &fakeServerTransportStream{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+
+	m := WithServerTime()
+	outCtx, err := m.Preprocess(ctx, "/spire.api.server.entry.v1.Entry/GetAuthorizedEntries", nil)
+	require.NoError(t, err)
+	assert.Equal(t, ctx, outCtx)
+
+	serverTime, ok := clockskew.ServerTime(stream.header)
+	require.True(t, ok)
+	assert.True(t, mockClk.Now().Equal(serverTime))
+
+	// Calls go on when the header cannot be set
+	_, err = m.Preprocess(context.Background(), "/spire.api.server.entry.v1.Entry/GetAuthorizedEntries", nil)
+	require.NoError(t, err)
+}
+
+type fakeServerTransportStream struct {
+	header metadata.MD
+}
+
+func (s *fakeServerTransportStream) Method() string {
+	return ""
+}
+
+func (s *fakeServerTransportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *fakeServerTransportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *fakeServerTransportStream) SetTrailer(md metadata.MD) error {
+	return nil
+}
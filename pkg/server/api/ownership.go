@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/spiffe/spire/pkg/server/datastore"
+)
+
+// OwnershipPolicy restricts the changes to the registration entries to the
+// callers that created them, so that the clients sharing a server, e.g.
+// several automation systems, can't change each other's entries. The zero
+// value enforces nothing.
+type OwnershipPolicy struct {
+	// Enforced restricts the updates and deletions of the entries to their
+	// owners
+	Enforced bool
+
+	// OverrideIDs are the SPIFFE IDs of the callers allowed to change any
+	// entry
+	OverrideIDs []string
+}
+
+// Check returns an error if the caller is not allowed to change an entry
+// owned by the given owner. Both are identified like in the revision history
+// of the entries, i.e. by SPIFFE ID, or as datastore.ChangedByLocal for the
+// callers of the local APIs. Local callers are always allowed, and so are
+// all callers for the entries without owner, e.g. the ones created before
+// owners were recorded.
+func (p OwnershipPolicy) Check(caller, owner string) error {
+	if !p.Enforced || owner == "" || caller == owner || caller == datastore.ChangedByLocal {
+		return nil
+	}
+	for _, id := range p.OverrideIDs {
+		if caller == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("entry is owned by %q", owner)
+}
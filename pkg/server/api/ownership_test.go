@@ -0,0 +1,83 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/spiffe/spire/pkg/server/api"
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnershipPolicyCheck(t *testing.T) {
+	enforced := api.OwnershipPolicy{
+		Enforced:    true,
+		OverrideIDs: []string{"spiffe://example.org/admin"},
+	}
+
+	for _, tt := range []struct {
+		name      string
+		policy    api.OwnershipPolicy
+		caller    string
+		owner     string
+		expectErr string
+	}{
+		{
+			name:   "empty policy",
+			caller: "spiffe://example.org/other",
+			owner:  "spiffe://example.org/owner",
+		},
+		{
+			name:   "owner",
+			policy: enforced,
+			caller: "spiffe://example.org/owner",
+			owner:  "spiffe://example.org/owner",
+		},
+		{
+			name:      "other caller",
+			policy:    enforced,
+			caller:    "spiffe://example.org/other",
+			owner:     "spiffe://example.org/owner",
+			expectErr: `entry is owned by "spiffe://example.org/owner"`,
+		},
+		{
+			name:      "unknown caller",
+			policy:    enforced,
+			owner:     "spiffe://example.org/owner",
+			expectErr: `entry is owned by "spiffe://example.org/owner"`,
+		},
+		{
+			name:   "override ID",
+			policy: enforced,
+			caller: "spiffe://example.org/admin",
+			owner:  "spiffe://example.org/owner",
+		},
+		{
+			name:   "local caller",
+			policy: enforced,
+			caller: datastore.ChangedByLocal,
+			owner:  "spiffe://example.org/owner",
+		},
+		{
+			name:      "entry owned by local caller",
+			policy:    enforced,
+			caller:    "spiffe://example.org/other",
+			owner:     datastore.ChangedByLocal,
+			expectErr: `entry is owned by "local"`,
+		},
+		{
+			name:   "entry without owner",
+			policy: enforced,
+			caller: "spiffe://example.org/other",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.caller, tt.owner)
+			if tt.expectErr != "" {
+				require.EqualError(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -66,6 +66,13 @@ func MakeErr(log logrus.FieldLogger, code codes.Code, msg string, err error) err
 			errMsg = concatErr(msg, err)
 		}
 		log.Error(capitalize(msg))
+		if st := status.Convert(err); st != nil && len(st.Details()) > 0 {
+			// Keep the details of the inner status (e.g. when to retry)
+			p := st.Proto()
+			p.Code = int32(code)
+			p.Message = errMsg
+			return status.ErrorProto(p)
+		}
 		return status.Error(code, errMsg)
 	}
 }
@@ -3,6 +3,7 @@ package api_test
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
@@ -10,8 +11,10 @@ import (
 	"github.com/spiffe/spire/pkg/server/api"
 	"github.com/spiffe/spire/test/spiretest"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 func TestOK(t *testing.T) {
@@ -147,3 +150,16 @@ func TestMakeErr(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeErrKeepsDetails(t *testing.T) {
+	retryInfo := &errdetails.RetryInfo{RetryDelay: durationpb.New(time.Second)}
+	inner, err := status.New(codes.ResourceExhausted, "quota exceeded").WithDetails(retryInfo)
+	require.NoError(t, err)
+
+	log, _ := test.NewNullLogger()
+	st := status.Convert(api.MakeErr(log, codes.ResourceExhausted, "rejecting request", inner.Err()))
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Equal(t, "rejecting request: quota exceeded", st.Message())
+	require.Len(t, st.Details(), 1)
+	spiretest.RequireProtoEqual(t, retryInfo, st.Details()[0].(*errdetails.RetryInfo))
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/spiffe/spire/pkg/server/api"
 	"github.com/spiffe/spire/pkg/server/api/rpccontext"
 	"github.com/spiffe/spire/pkg/server/ca"
+	"github.com/spiffe/spire/pkg/server/cloudevents"
 	"github.com/spiffe/spire/pkg/server/datastore"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -33,6 +34,10 @@ type Config struct {
 	ServerCA     ca.ServerCA
 	TrustDomain  spiffeid.TrustDomain
 	DataStore    datastore.DataStore
+
+	// X509SVIDEvents, if set, is notified of the X509-SVIDs issued for
+	// registration entries
+	X509SVIDEvents cloudevents.X509SVIDNotifier
 }
 
 // New creates a new SVID service
@@ -42,6 +47,8 @@ func New(config Config) *Service {
 		ef: config.EntryFetcher,
 		td: config.TrustDomain,
 		ds: config.DataStore,
+
+		x509SVIDEvents: config.X509SVIDEvents,
 	}
 }
 
@@ -53,6 +60,8 @@ type Service struct {
 	ef api.AuthorizedEntryFetcher
 	td spiffeid.TrustDomain
 	ds datastore.DataStore
+
+	x509SVIDEvents cloudevents.X509SVIDNotifier
 }
 
 func (s *Service) MintX509SVID(ctx context.Context, req *svidv1.MintX509SVIDRequest) (*svidv1.MintX509SVIDResponse, error) {
@@ -119,7 +128,7 @@ func (s *Service) MintX509SVID(ctx context.Context, req *svidv1.MintX509SVIDRequ
 }
 
 func (s *Service) MintJWTSVID(ctx context.Context, req *svidv1.MintJWTSVIDRequest) (*svidv1.MintJWTSVIDResponse, error) {
-	jwtsvid, err := s.mintJWTSVID(ctx, req.Id, req.Audience, req.Ttl)
+	jwtsvid, err := s.mintJWTSVID(ctx, req.Id, req.Audience, req.Ttl, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -226,6 +235,8 @@ func (s *Service) newX509SVID(ctx context.Context, param *svidv1.NewX509SVIDPara
 		PublicKey: csr.PublicKey,
 		DNSList:   entry.DnsNames,
 		TTL:       time.Duration(entry.Ttl) * time.Second,
+		ParentID:  s.parentID(entry),
+		Entry:     entry,
 	})
 	if err != nil {
 		return &svidv1.BatchNewX509SVIDResponse_Result{
@@ -233,6 +244,10 @@ func (s *Service) newX509SVID(ctx context.Context, param *svidv1.NewX509SVIDPara
 		}
 	}
 
+	if s.x509SVIDEvents != nil {
+		s.x509SVIDEvents.NotifyX509SVIDIssued(param.EntryId, x509Svid[0])
+	}
+
 	return &svidv1.BatchNewX509SVIDResponse_Result{
 		Svid: &types.X509SVID{
 			Id:        entry.SpiffeId,
@@ -243,7 +258,8 @@ func (s *Service) newX509SVID(ctx context.Context, param *svidv1.NewX509SVIDPara
 	}
 }
 
-func (s *Service) mintJWTSVID(ctx context.Context, protoID *types.SPIFFEID, audience []string, ttl int32) (*types.JWTSVID, error) {
+// mintJWTSVID mints a JWT-SVID, for the given entry, if any
+func (s *Service) mintJWTSVID(ctx context.Context, protoID *types.SPIFFEID, audience []string, ttl int32, entry *types.Entry) (*types.JWTSVID, error) {
 	log := rpccontext.Logger(ctx)
 
 	id, err := api.TrustDomainWorkloadIDFromProto(s.td, protoID)
@@ -261,10 +277,17 @@ func (s *Service) mintJWTSVID(ctx context.Context, protoID *types.SPIFFEID, audi
 		return nil, api.MakeErr(log, codes.InvalidArgument, "at least one audience is required", nil)
 	}
 
+	var parentID spiffeid.ID
+	if entry != nil {
+		parentID = s.parentID(entry)
+	}
+
 	token, err := s.ca.SignJWTSVID(ctx, ca.JWTSVIDParams{
 		SpiffeID: id,
 		TTL:      time.Duration(ttl) * time.Second,
 		Audience: audience,
+		ParentID: parentID,
+		Entry:    entry,
 	})
 	if err != nil {
 		return nil, api.MakeErr(log, codes.Internal, "failed to sign JWT-SVID", err)
@@ -301,7 +324,7 @@ func (s *Service) NewJWTSVID(ctx context.Context, req *svidv1.NewJWTSVIDRequest)
 		return nil, api.MakeErr(log, codes.NotFound, "entry not found or not authorized", nil)
 	}
 
-	jwtsvid, err := s.mintJWTSVID(ctx, entry.SpiffeId, req.Audience, entry.Ttl)
+	jwtsvid, err := s.mintJWTSVID(ctx, entry.SpiffeId, req.Audience, entry.Ttl, entry)
 	if err != nil {
 		return nil, err
 	}
@@ -373,3 +396,14 @@ func parseAndCheckCSR(ctx context.Context, csrBytes []byte) (*x509.CertificateRe
 
 	return csr, nil
 }
+
+// parentID returns the parent ID of the entry, used to label the signing
+// metrics. Entries with a malformed parent ID, which is not expected, are
+// still signed for, without the label.
+func (s *Service) parentID(entry *types.Entry) spiffeid.ID {
+	parentID, err := api.TrustDomainMemberIDFromProto(s.td, entry.ParentId)
+	if err != nil {
+		return spiffeid.ID{}
+	}
+	return parentID
+}
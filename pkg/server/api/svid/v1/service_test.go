@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sync"
 	"testing"
 	"time"
 
@@ -1074,6 +1075,40 @@ func TestNewDownstreamX509CA(t *testing.T) {
 	}
 }
 
+func TestServiceBatchNewX509SVIDNotifiesEvents(t *testing.T) {
+	test := setupServiceTest(t)
+	defer test.Cleanup()
+	test.withCallerID = true
+
+	workloadEntry := &types.Entry{
+		Id:       "workload",
+		ParentId: api.ProtoFromID(agentID),
+		SpiffeId: &types.SPIFFEID{TrustDomain: "example.org", Path: "workload1"},
+	}
+	invalidEntry := &types.Entry{
+		Id:       "invalid",
+		ParentId: api.ProtoFromID(agentID),
+	}
+	test.ef.entries = []*types.Entry{workloadEntry, invalidEntry}
+	test.rateLimiter.count = 2
+
+	resp, err := test.client.BatchNewX509SVID(context.Background(), &svidv1.BatchNewX509SVIDRequest{
+		Params: []*svidv1.NewX509SVIDParams{
+			{EntryId: workloadEntry.Id, Csr: createCSR(t, &x509.CertificateRequest{})},
+			{EntryId: invalidEntry.Id, Csr: createCSR(t, &x509.CertificateRequest{})},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 2)
+	certChain, err := x509util.RawCertsToCertificates(resp.Results[0].Svid.CertChain)
+	require.NoError(t, err)
+
+	// Only the issued X509-SVID is notified
+	require.Equal(t, []issuedX509SVID{
+		{entryID: workloadEntry.Id, serialNumber: certChain[0].SerialNumber.String()},
+	}, test.x509SVIDEvents.issued)
+}
+
 type serviceTest struct {
 	client       svidv1.SVIDClient
 	ef           *entryFetcher // Stores entries explicitly fetched using FetchAuthorizedEntries
@@ -1084,6 +1119,8 @@ type serviceTest struct {
 	rateLimiter  *fakeRateLimiter
 	withCallerID bool
 	done         func()
+
+	x509SVIDEvents *fakeX509SVIDNotifier
 }
 
 func (c *serviceTest) Cleanup() {
@@ -1098,11 +1135,13 @@ func setupServiceTest(t *testing.T) *serviceTest {
 	ds := fakedatastore.New(t)
 
 	rateLimiter := &fakeRateLimiter{}
+	x509SVIDEvents := &fakeX509SVIDNotifier{}
 	service := svid.New(svid.Config{
-		EntryFetcher: ef,
-		ServerCA:     ca,
-		TrustDomain:  trustDomain,
-		DataStore:    ds,
+		EntryFetcher:   ef,
+		ServerCA:       ca,
+		TrustDomain:    trustDomain,
+		DataStore:      ds,
+		X509SVIDEvents: x509SVIDEvents,
 	})
 
 	log, logHook := test.NewNullLogger()
@@ -1117,6 +1156,8 @@ func setupServiceTest(t *testing.T) *serviceTest {
 		ds:          ds,
 		logHook:     logHook,
 		rateLimiter: rateLimiter,
+
+		x509SVIDEvents: x509SVIDEvents,
 	}
 
 	contextFn := func(ctx context.Context) context.Context {
@@ -1211,3 +1252,19 @@ func (f *fakeRateLimiter) RateLimit(ctx context.Context, count int) error {
 
 	return f.err
 }
+
+type issuedX509SVID struct {
+	entryID      string
+	serialNumber string
+}
+
+type fakeX509SVIDNotifier struct {
+	mu     sync.Mutex
+	issued []issuedX509SVID
+}
+
+func (n *fakeX509SVIDNotifier) NotifyX509SVIDIssued(entryID string, svid *x509.Certificate) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.issued = append(n.issued, issuedX509SVID{entryID: entryID, serialNumber: svid.SerialNumber.String()})
+}
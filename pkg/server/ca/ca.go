@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"fmt"
 	"sync"
 	"time"
@@ -13,12 +14,15 @@ import (
 	"github.com/andres-erbsen/clock"
 	"github.com/sirupsen/logrus"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"github.com/spiffe/spire/pkg/common/health"
+	"github.com/spiffe/spire/pkg/common/idutil"
 	"github.com/spiffe/spire/pkg/common/jwtsvid"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	telemetry_server "github.com/spiffe/spire/pkg/common/telemetry/server"
 	"github.com/spiffe/spire/pkg/common/x509util"
 	"github.com/spiffe/spire/pkg/server/api"
+	"github.com/spiffe/spire/pkg/server/plugin/credentialcomposer"
 	"github.com/zeebo/errs"
 )
 
@@ -32,6 +36,9 @@ const (
 	DefaultJWTSVIDTTL = time.Minute * 5
 )
 
+// idCE is the OID of the certificate extensions arc
+var idCE = asn1.ObjectIdentifier{2, 5, 29}
+
 // ServerCA is an interface for Server CAs
 type ServerCA interface {
 	SignX509SVID(ctx context.Context, params X509SVIDParams) ([]*x509.Certificate, error)
@@ -57,6 +64,14 @@ type X509SVIDParams struct {
 
 	// Subject of the SVID. Default subject is used if it is empty.
 	Subject pkix.Name
+
+	// ParentID is the parent ID of the registration entry the SVID is signed
+	// for, if any. It is only used to label the signing metrics.
+	ParentID spiffeid.ID
+
+	// Entry is the registration entry the SVID is signed for, if any. The
+	// credential composers are only invoked for SVIDs signed for entries.
+	Entry *types.Entry
 }
 
 // X509CASVIDParams are parameters relevant to X509 CA SVID creation
@@ -83,6 +98,14 @@ type JWTSVIDParams struct {
 
 	// Audience is used for audience claims
 	Audience []string
+
+	// ParentID is the parent ID of the registration entry the SVID is signed
+	// for, if any. It is only used to label the signing metrics.
+	ParentID spiffeid.ID
+
+	// Entry is the registration entry the SVID is signed for, if any. The
+	// credential composers are only invoked for SVIDs signed for entries.
+	Entry *types.Entry
 }
 
 type X509CA struct {
@@ -110,15 +133,21 @@ type JWTKey struct {
 }
 
 type Config struct {
-	Log           logrus.FieldLogger
-	Metrics       telemetry.Metrics
-	TrustDomain   spiffeid.TrustDomain
-	X509SVIDTTL   time.Duration
-	JWTSVIDTTL    time.Duration
-	JWTIssuer     string
-	Clock         clock.Clock
-	CASubject     pkix.Name
-	HealthChecker health.Checker
+	Log                 logrus.FieldLogger
+	Metrics             telemetry.Metrics
+	TrustDomain         spiffeid.TrustDomain
+	X509SVIDTTL         time.Duration
+	JWTSVIDTTL          time.Duration
+	JWTIssuer           string
+	JWTX5C              bool
+	CredentialComposers []credentialcomposer.CredentialComposer
+	Clock               clock.Clock
+	CASubject           pkix.Name
+	HealthChecker       health.Checker
+
+	// Backdate is how far back the SVIDs are valid from, to make up for
+	// clock skew. It is never less than 10 seconds.
+	Backdate time.Duration
 }
 
 type CA struct {
@@ -129,6 +158,16 @@ type CA struct {
 	jwtKey *JWTKey
 
 	jwtSigner *jwtsvid.Signer
+
+	x5cMu sync.Mutex
+	x5c   *jwtKeyCert
+}
+
+// jwtKeyCert is the certificate chain of a JWT key, issued by an X509 CA
+type jwtKeyCert struct {
+	kid    string
+	x509CA *X509CA
+	chain  []*x509.Certificate
 }
 
 func NewCA(config Config) *CA {
@@ -141,6 +180,9 @@ func NewCA(config Config) *CA {
 	if config.Clock == nil {
 		config.Clock = clock.New()
 	}
+	if config.Backdate < backdate {
+		config.Backdate = backdate
+	}
 
 	ca := &CA{
 		c: config,
@@ -219,6 +261,12 @@ func (ca *CA) SignX509SVID(ctx context.Context, params X509SVIDParams) ([]*x509.
 		template.DNSNames = params.DNSList
 	}
 
+	if params.Entry != nil {
+		if err := ca.composeX509SVID(ctx, params, template); err != nil {
+			return nil, err
+		}
+	}
+
 	cert, err := createCertificate(template, x509CA.Certificate, template.PublicKey, x509CA.Signer)
 	if err != nil {
 		return nil, errs.New("unable to create X509 SVID: %v", err)
@@ -234,6 +282,7 @@ func (ca *CA) SignX509SVID(ctx context.Context, params X509SVIDParams) ([]*x509.
 	}
 
 	telemetry_server.IncrServerCASignX509Counter(ca.c.Metrics)
+	ca.emitSignedSVIDMetrics(ctx, telemetry.X509SVID, params.ParentID, cert.NotAfter)
 
 	return makeSVIDCertChain(x509CA, cert), nil
 }
@@ -282,6 +331,7 @@ func (ca *CA) SignX509CASVID(ctx context.Context, params X509CASVIDParams) ([]*x
 	}).Debug("Signed X509 CA SVID")
 
 	telemetry_server.IncrServerCASignX509CACounter(ca.c.Metrics)
+	ca.emitSignedSVIDMetrics(ctx, telemetry.X509CASVID, spiffeid.ID{}, cert.NotAfter)
 
 	return makeSVIDCertChain(x509CA, cert), nil
 }
@@ -300,14 +350,41 @@ func (ca *CA) SignJWTSVID(ctx context.Context, params JWTSVIDParams) (string, er
 	if ttl <= 0 {
 		ttl = ca.c.JWTSVIDTTL
 	}
-	_, expiresAt := ca.capLifetime(ttl, jwtKey.NotAfter)
+	expirationCap := jwtKey.NotAfter
+
+	var chain []*x509.Certificate
+	if ca.c.JWTX5C {
+		var err error
+		chain, err = ca.jwtKeyChain(jwtKey)
+		if err != nil {
+			return "", err
+		}
+		// The token can't outlive the certificate of its key
+		if chain[0].NotAfter.Before(expirationCap) {
+			expirationCap = chain[0].NotAfter
+		}
+	}
+	_, expiresAt := ca.capLifetime(ttl, expirationCap)
+
+	var claims map[string]interface{}
+	if params.Entry != nil {
+		var err error
+		claims, err = ca.composeJWTSVID(ctx, params)
+		if err != nil {
+			return "", err
+		}
+	}
 
-	token, err := ca.jwtSigner.SignToken(params.SpiffeID.String(), params.Audience, expiresAt, jwtKey.Signer, jwtKey.Kid)
+	token, err := ca.jwtSigner.SignTokenWithOptions(params.SpiffeID.String(), params.Audience, expiresAt, jwtKey.Signer, jwtKey.Kid, jwtsvid.TokenOptions{
+		Chain:  chain,
+		Claims: claims,
+	})
 	if err != nil {
 		return "", errs.New("unable to sign JWT SVID: %v", err)
 	}
 
 	telemetry_server.IncrServerCASignJWTSVIDCounter(ca.c.Metrics)
+	ca.emitSignedSVIDMetrics(ctx, telemetry.JWTSVID, params.ParentID, expiresAt)
 	ca.c.Log.WithFields(logrus.Fields{
 		telemetry.Audience:   params.Audience,
 		telemetry.Expiration: expiresAt.Format(time.RFC3339),
@@ -317,9 +394,125 @@ func (ca *CA) SignJWTSVID(ctx context.Context, params JWTSVIDParams) (string, er
 	return token, nil
 }
 
+// composeX509SVID runs the credential composers over the attributes of the
+// X509-SVID template
+func (ca *CA) composeX509SVID(ctx context.Context, params X509SVIDParams, template *x509.Certificate) error {
+	attributes := credentialcomposer.X509SVIDAttributes{
+		Subject:         template.Subject,
+		DNSSANs:         template.DNSNames,
+		ExtraExtensions: template.ExtraExtensions,
+	}
+	for _, composer := range ca.c.CredentialComposers {
+		var err error
+		attributes, err = composer.ComposeWorkloadX509SVID(ctx, params.SpiffeID, params.PublicKey, params.Entry, attributes)
+		if err != nil {
+			return errs.New("credential composer %q failed to compose X509 SVID: %v", composer.Name(), err)
+		}
+	}
+
+	for _, extension := range attributes.ExtraExtensions {
+		if isCertificateExtension(extension.Id) {
+			return errs.New("credential composers can't set the certificate extension %s", extension.Id)
+		}
+	}
+	for _, dnsName := range attributes.DNSSANs {
+		if err := x509util.ValidateDNS(dnsName); err != nil {
+			return errs.New("credential composers set an invalid DNS SAN %q: %v", dnsName, err)
+		}
+	}
+
+	template.Subject = attributes.Subject
+	template.DNSNames = attributes.DNSSANs
+	template.ExtraExtensions = attributes.ExtraExtensions
+	return nil
+}
+
+// isCertificateExtension returns true if the OID is in the arc of the
+// certificate extensions (id-ce). These make the certificate an X509 SVID,
+// e.g. the URI SAN and the key usages, so they are reserved to the CA.
+func isCertificateExtension(id asn1.ObjectIdentifier) bool {
+	return len(id) > len(idCE) && id[:len(idCE)].Equal(idCE)
+}
+
+// composeJWTSVID runs the credential composers and returns the additional
+// claims of the JWT-SVID
+func (ca *CA) composeJWTSVID(ctx context.Context, params JWTSVIDParams) (map[string]interface{}, error) {
+	attributes := credentialcomposer.JWTSVIDAttributes{}
+	for _, composer := range ca.c.CredentialComposers {
+		var err error
+		attributes, err = composer.ComposeWorkloadJWTSVID(ctx, params.SpiffeID, params.Entry, attributes)
+		if err != nil {
+			return nil, errs.New("credential composer %q failed to compose JWT SVID: %v", composer.Name(), err)
+		}
+	}
+	return attributes.Claims, nil
+}
+
+// jwtKeyChain returns the certificate chain of the JWT key for the x5c header
+// of the JWT-SVIDs. The certificate of the key is issued by the current X509
+// CA the first time, and again when either the key or the X509 CA rotates.
+func (ca *CA) jwtKeyChain(jwtKey *JWTKey) ([]*x509.Certificate, error) {
+	x509CA := ca.X509CA()
+	if x509CA == nil {
+		return nil, errs.New("X509 CA is not available for the JWT key certificate")
+	}
+
+	ca.x5cMu.Lock()
+	defer ca.x5cMu.Unlock()
+	if ca.x5c != nil && ca.x5c.kid == jwtKey.Kid && ca.x5c.x509CA == x509CA {
+		return ca.x5c.chain, nil
+	}
+
+	notAfter := jwtKey.NotAfter
+	if x509CA.Certificate.NotAfter.Before(notAfter) {
+		notAfter = x509CA.Certificate.NotAfter
+	}
+	serialNumber, err := x509util.NewSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := CreateJWTKeyTemplate(idutil.ServerID(ca.c.TrustDomain), jwtKey.Signer.Public(), ca.c.TrustDomain, ca.c.Clock.Now().Add(-ca.c.Backdate), notAfter, serialNumber)
+	if err != nil {
+		return nil, err
+	}
+	template.AuthorityKeyId = x509CA.Certificate.SubjectKeyId
+
+	cert, err := createCertificate(template, x509CA.Certificate, template.PublicKey, x509CA.Signer)
+	if err != nil {
+		return nil, errs.New("unable to create JWT key certificate: %v", err)
+	}
+
+	ca.x5c = &jwtKeyCert{
+		kid:    jwtKey.Kid,
+		x509CA: x509CA,
+		chain:  makeSVIDCertChain(x509CA, cert),
+	}
+	ca.c.Log.WithFields(logrus.Fields{
+		telemetry.Kid:        jwtKey.Kid,
+		telemetry.Expiration: cert.NotAfter.Format(time.RFC3339),
+	}).Debug("Issued JWT key certificate")
+	return ca.x5c.chain, nil
+}
+
+// emitSignedSVIDMetrics emits the metrics of a signed SVID, labeled by SVID
+// type and parent ID, unless it was signed for a health check
+func (ca *CA) emitSignedSVIDMetrics(ctx context.Context, svidType string, parentID spiffeid.ID, notAfter time.Time) {
+	if health.IsCheck(ctx) {
+		return
+	}
+
+	var parent string
+	if !parentID.IsZero() {
+		parent = parentID.String()
+	}
+	telemetry_server.IncrServerCASignedSVIDCounter(ca.c.Metrics, svidType, parent)
+	telemetry_server.AddServerCASignedSVIDTTLSample(ca.c.Metrics, svidType, parent, notAfter.Sub(ca.c.Clock.Now()))
+}
+
 func (ca *CA) capLifetime(ttl time.Duration, expirationCap time.Time) (notBefore, notAfter time.Time) {
 	now := ca.c.Clock.Now()
-	notBefore = now.Add(-backdate)
+	notBefore = now.Add(-ca.c.Backdate)
 	notAfter = now.Add(ttl)
 	if notAfter.After(expirationCap) {
 		notAfter = expirationCap
@@ -2,24 +2,33 @@ package ca
 
 import (
 	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
 	"math/big"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/catalog"
 	"github.com/spiffe/spire/pkg/common/health"
 	"github.com/spiffe/spire/pkg/common/jwtsvid"
 	"github.com/spiffe/spire/pkg/common/pemutil"
 	"github.com/spiffe/spire/pkg/common/telemetry"
+	telemetry_server "github.com/spiffe/spire/pkg/common/telemetry/server"
 	"github.com/spiffe/spire/pkg/common/x509util"
+	"github.com/spiffe/spire/pkg/server/plugin/credentialcomposer"
 	"github.com/spiffe/spire/test/clock"
 	"github.com/spiffe/spire/test/fakes/fakehealthchecker"
+	"github.com/spiffe/spire/test/fakes/fakemetrics"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"gopkg.in/square/go-jose.v2/jwt"
 )
 
 var (
@@ -129,6 +138,27 @@ func (s *CATestSuite) TestSignX509SVIDUsesDefaultTTLIfTTLUnspecified() {
 	s.Require().Equal(s.clock.Now().Add(time.Minute), svid[0].NotAfter)
 }
 
+func (s *CATestSuite) TestSignX509SVIDBackdate() {
+	// The backdate is never less than the default
+	ca := NewCA(Config{
+		Log:           s.ca.c.Log,
+		Metrics:       telemetry.Blackhole{},
+		TrustDomain:   trustDomainExample,
+		Clock:         s.clock,
+		HealthChecker: fakehealthchecker.New(),
+		Backdate:      time.Second,
+	})
+	s.Require().Equal(backdate, ca.c.Backdate)
+
+	// A larger clock skew tolerance backdates the SVIDs further
+	s.ca.c.Backdate = 5 * time.Minute
+	svid, err := s.ca.SignX509SVID(ctx, s.createX509SVIDParams())
+	s.Require().NoError(err)
+	s.Require().Len(svid, 1)
+	s.Require().Equal(s.clock.Now().Add(-5*time.Minute), svid[0].NotBefore)
+	s.Require().Equal(s.clock.Now().Add(time.Minute), svid[0].NotAfter)
+}
+
 func (s *CATestSuite) TestSignX509SVIDUsesDefaultTTLAndNoCNDNS() {
 	svid, err := s.ca.SignX509SVID(ctx, s.createX509SVIDParams())
 	s.Require().NoError(err)
@@ -306,6 +336,176 @@ func (s *CATestSuite) TestSignJWTSVIDValidatesJSR() {
 	s.Require().EqualError(err, "unable to sign JWT SVID: audience is required")
 }
 
+func (s *CATestSuite) TestSignJWTSVIDWithoutX5C() {
+	token, err := s.ca.SignJWTSVID(ctx, s.createJWTSVIDParams(trustDomainExample, 0))
+	s.Require().NoError(err)
+	tok, err := jwt.ParseSigned(token)
+	s.Require().NoError(err)
+	s.Require().Len(tok.Headers, 1)
+	s.Equal("KID", tok.Headers[0].KeyID)
+	_, err = tok.Headers[0].Certificates(x509.VerifyOptions{})
+	s.Error(err, "x5c header is present")
+}
+
+func (s *CATestSuite) TestSignJWTSVIDWithX5C() {
+	s.ca.c.JWTX5C = true
+	s.setX509CA(false)
+
+	token, err := s.ca.SignJWTSVID(ctx, s.createJWTSVIDParams(trustDomainExample, 0))
+	s.Require().NoError(err)
+	tok, err := jwt.ParseSigned(token)
+	s.Require().NoError(err)
+	s.Require().Len(tok.Headers, 1)
+	s.Equal("KID", tok.Headers[0].KeyID)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.upstreamCert)
+	chains, err := tok.Headers[0].Certificates(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: s.clock.Now(),
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	s.Require().NoError(err)
+	s.Require().Len(chains, 1)
+	s.Require().Equal([]*x509.Certificate{s.caCert, s.upstreamCert}, chains[0][1:])
+
+	cert := chains[0][0]
+	s.Equal(testSigner.Public(), cert.PublicKey)
+	s.Equal(x509.KeyUsageDigitalSignature, cert.KeyUsage)
+	s.False(cert.IsCA, "CA bit is set")
+	if s.Len(cert.URIs, 1, "has no URIs") {
+		s.Equal("spiffe://example.org/spire/server", cert.URIs[0].String())
+	}
+	s.Equal(s.caCert.SubjectKeyId, cert.AuthorityKeyId)
+
+	// The token is signed by the key of the certificate
+	var claims jwt.Claims
+	s.Require().NoError(tok.Claims(cert.PublicKey, &claims))
+	s.Equal("spiffe://example.org/workload", claims.Subject)
+
+	// The certificate is reused until the JWT key or the X509 CA rotates
+	chain, err := s.ca.jwtKeyChain(s.ca.JWTKey())
+	s.Require().NoError(err)
+	s.Equal(cert.Raw, chain[0].Raw)
+
+	s.setX509CA(false)
+	chain, err = s.ca.jwtKeyChain(s.ca.JWTKey())
+	s.Require().NoError(err)
+	s.NotEqual(cert.SerialNumber, chain[0].SerialNumber)
+}
+
+func (s *CATestSuite) TestSignJWTSVIDWithX5CCapsTTLToCertificateExpiry() {
+	s.ca.c.JWTX5C = true
+	s.ca.SetJWTKey(&JWTKey{
+		Signer:   testSigner,
+		Kid:      "KID",
+		NotAfter: s.clock.Now().Add(time.Hour),
+	})
+
+	token, err := s.ca.SignJWTSVID(ctx, s.createJWTSVIDParams(trustDomainExample, time.Hour))
+	s.Require().NoError(err)
+	_, expiresAt, err := jwtsvid.GetTokenExpiry(token)
+	s.Require().NoError(err)
+	// The certificate of the JWT key can't outlive the X509 CA
+	s.Require().Equal(s.caCert.NotAfter, expiresAt)
+}
+
+func (s *CATestSuite) TestSignJWTSVIDWithX5CNoCASet() {
+	s.ca.c.JWTX5C = true
+	s.ca.SetX509CA(nil)
+	_, err := s.ca.SignJWTSVID(ctx, s.createJWTSVIDParams(trustDomainExample, 0))
+	s.Require().EqualError(err, "X509 CA is not available for the JWT key certificate")
+}
+
+func (s *CATestSuite) TestSignX509SVIDWithCredentialComposers() {
+	costCenter := pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}, Value: []byte{0x0c, 0x02, '4', '2'}}
+	s.ca.c.CredentialComposers = []credentialcomposer.CredentialComposer{
+		&fakeCredentialComposer{name: "first", extension: costCenter},
+		&fakeCredentialComposer{name: "second", dnsSAN: "composed.example.org"},
+	}
+
+	params := s.createX509SVIDParams()
+	params.DNSList = []string{"entry.example.org"}
+	params.Entry = &types.Entry{Id: "ENTRYID"}
+	svidChain, err := s.ca.SignX509SVID(ctx, params)
+	s.Require().NoError(err)
+	svid := svidChain[0]
+
+	s.Equal([]string{"entry.example.org", "composed.example.org"}, svid.DNSNames)
+	s.Equal("CN=entry.example.org,OU=ENTRYID,O=SPIRE,C=US", svid.Subject.String())
+	s.Contains(svid.Extensions, costCenter)
+	if s.Len(svid.URIs, 1, "has no URIs") {
+		s.Equal("spiffe://example.org/workload", svid.URIs[0].String())
+	}
+
+	// Composers are not invoked for SVIDs that are not signed for entries
+	params.Entry = nil
+	svidChain, err = s.ca.SignX509SVID(ctx, params)
+	s.Require().NoError(err)
+	s.Equal([]string{"entry.example.org"}, svidChain[0].DNSNames)
+	s.NotContains(svidChain[0].Extensions, costCenter)
+}
+
+func (s *CATestSuite) TestSignX509SVIDWithCredentialComposersValidatesAttributes() {
+	params := s.createX509SVIDParams()
+	params.Entry = &types.Entry{Id: "ENTRYID"}
+
+	s.ca.c.CredentialComposers = []credentialcomposer.CredentialComposer{
+		&fakeCredentialComposer{name: "fake", extension: pkix.Extension{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Value: []byte{0x30, 0x00}}},
+	}
+	_, err := s.ca.SignX509SVID(ctx, params)
+	s.Require().EqualError(err, "credential composers can't set the certificate extension 2.5.29.17")
+
+	s.ca.c.CredentialComposers = []credentialcomposer.CredentialComposer{
+		&fakeCredentialComposer{name: "fake", dnsSAN: "not a DNS name"},
+	}
+	_, err = s.ca.SignX509SVID(ctx, params)
+	s.Require().Error(err)
+	s.Contains(err.Error(), `credential composers set an invalid DNS SAN "not a DNS name"`)
+
+	s.ca.c.CredentialComposers = []credentialcomposer.CredentialComposer{
+		&fakeCredentialComposer{name: "fake", err: errors.New("oh no")},
+	}
+	_, err = s.ca.SignX509SVID(ctx, params)
+	s.Require().EqualError(err, `credential composer "fake" failed to compose X509 SVID: oh no`)
+}
+
+func (s *CATestSuite) TestSignJWTSVIDWithCredentialComposers() {
+	s.ca.c.CredentialComposers = []credentialcomposer.CredentialComposer{
+		&fakeCredentialComposer{name: "first", claim: "cost_center"},
+		&fakeCredentialComposer{name: "second", claim: "entry_id"},
+	}
+
+	params := s.createJWTSVIDParams(trustDomainExample, 0)
+	params.Entry = &types.Entry{Id: "ENTRYID"}
+	token, err := s.ca.SignJWTSVID(ctx, params)
+	s.Require().NoError(err)
+	claims := s.parseClaims(token)
+	s.Equal("ENTRYID", claims["cost_center"])
+	s.Equal("ENTRYID", claims["entry_id"])
+	s.Equal("spiffe://example.org/workload", claims["sub"])
+
+	// Composers are not invoked for SVIDs that are not signed for entries
+	params.Entry = nil
+	token, err = s.ca.SignJWTSVID(ctx, params)
+	s.Require().NoError(err)
+	s.NotContains(s.parseClaims(token), "cost_center")
+
+	// Composers can't override the registered claims
+	s.ca.c.CredentialComposers = []credentialcomposer.CredentialComposer{
+		&fakeCredentialComposer{name: "fake", claim: "sub"},
+	}
+	params.Entry = &types.Entry{Id: "ENTRYID"}
+	_, err = s.ca.SignJWTSVID(ctx, params)
+	s.Require().EqualError(err, `unable to sign JWT SVID: claim "sub" is reserved`)
+
+	s.ca.c.CredentialComposers = []credentialcomposer.CredentialComposer{
+		&fakeCredentialComposer{name: "fake", err: errors.New("oh no")},
+	}
+	_, err = s.ca.SignJWTSVID(ctx, params)
+	s.Require().EqualError(err, `credential composer "fake" failed to compose JWT SVID: oh no`)
+}
+
 func (s *CATestSuite) TestSignX509CASVIDNoCASet() {
 	s.ca.SetX509CA(nil)
 	_, err := s.ca.SignX509CASVID(ctx, s.createX509CASVIDParams(trustDomainExample))
@@ -350,6 +550,43 @@ func (s *CATestSuite) TestSignCAX509SVIDValidatesTrustDomain() {
 	s.Require().EqualError(err, `"spiffe://foo.com" is not a member of trust domain "example.org"`)
 }
 
+func (s *CATestSuite) TestSignMetrics() {
+	metrics := fakemetrics.New()
+	s.ca.c.Metrics = metrics
+	parentID := trustDomainExample.NewID("spire/agent/foo")
+
+	x509SVIDParams := s.createX509SVIDParams()
+	x509SVIDParams.ParentID = parentID
+	_, err := s.ca.SignX509SVID(ctx, x509SVIDParams)
+	s.Require().NoError(err)
+
+	jwtSVIDParams := s.createJWTSVIDParams(trustDomainExample, time.Hour)
+	jwtSVIDParams.ParentID = parentID
+	_, err = s.ca.SignJWTSVID(ctx, jwtSVIDParams)
+	s.Require().NoError(err)
+
+	_, err = s.ca.SignX509CASVID(ctx, s.createX509CASVIDParams(trustDomainExample))
+	s.Require().NoError(err)
+
+	// SVIDs signed for health checks are only counted by the unlabeled counters
+	s.healthChecker.RunChecks()
+
+	expected := fakemetrics.New()
+	telemetry_server.IncrServerCASignX509Counter(expected)
+	telemetry_server.IncrServerCASignedSVIDCounter(expected, telemetry.X509SVID, parentID.String())
+	telemetry_server.AddServerCASignedSVIDTTLSample(expected, telemetry.X509SVID, parentID.String(), time.Minute)
+	telemetry_server.IncrServerCASignJWTSVIDCounter(expected)
+	telemetry_server.IncrServerCASignedSVIDCounter(expected, telemetry.JWTSVID, parentID.String())
+	// The TTL is capped to the JWT key expiry
+	telemetry_server.AddServerCASignedSVIDTTLSample(expected, telemetry.JWTSVID, parentID.String(), 10*time.Minute)
+	telemetry_server.IncrServerCASignX509CACounter(expected)
+	telemetry_server.IncrServerCASignedSVIDCounter(expected, telemetry.X509CASVID, "")
+	telemetry_server.AddServerCASignedSVIDTTLSample(expected, telemetry.X509CASVID, "", time.Minute)
+	telemetry_server.IncrServerCASignX509Counter(expected)
+
+	s.Require().Equal(expected.AllMetrics(), metrics.AllMetrics())
+}
+
 func (s *CATestSuite) TestHealthChecks() {
 	// Successful health check
 	s.Equal(map[string]health.State{
@@ -423,6 +660,14 @@ func (s *CATestSuite) createJWTSVIDParams(trustDomain spiffeid.TrustDomain, ttl
 	}
 }
 
+func (s *CATestSuite) parseClaims(token string) map[string]interface{} {
+	tok, err := jwt.ParseSigned(token)
+	s.Require().NoError(err)
+	claims := make(map[string]interface{})
+	s.Require().NoError(tok.UnsafeClaimsWithoutVerification(&claims))
+	return claims
+}
+
 func (s *CATestSuite) createCACertificate(cn string, parent *x509.Certificate) *x509.Certificate {
 	keyID, err := x509util.GetSubjectKeyID(testSigner.Public())
 	s.Require().NoError(err)
@@ -446,3 +691,44 @@ func (s *CATestSuite) createCACertificate(cn string, parent *x509.Certificate) *
 	s.Require().NoError(err)
 	return cert
 }
+
+// fakeCredentialComposer adds the configured attributes, or fails
+type fakeCredentialComposer struct {
+	catalog.PluginInfo
+
+	name      string
+	extension pkix.Extension
+	dnsSAN    string
+	claim     string
+	err       error
+}
+
+func (c *fakeCredentialComposer) Name() string {
+	return c.name
+}
+
+func (c *fakeCredentialComposer) ComposeWorkloadX509SVID(ctx context.Context, id spiffeid.ID, publicKey crypto.PublicKey, entry *types.Entry, attributes credentialcomposer.X509SVIDAttributes) (credentialcomposer.X509SVIDAttributes, error) {
+	if c.err != nil {
+		return credentialcomposer.X509SVIDAttributes{}, c.err
+	}
+	attributes.Subject.OrganizationalUnit = []string{entry.Id}
+	if c.extension.Id != nil {
+		attributes.ExtraExtensions = append(attributes.ExtraExtensions, c.extension)
+	}
+	if c.dnsSAN != "" {
+		attributes.DNSSANs = append(attributes.DNSSANs, c.dnsSAN)
+	}
+	return attributes, nil
+}
+
+func (c *fakeCredentialComposer) ComposeWorkloadJWTSVID(ctx context.Context, id spiffeid.ID, entry *types.Entry, attributes credentialcomposer.JWTSVIDAttributes) (credentialcomposer.JWTSVIDAttributes, error) {
+	if c.err != nil {
+		return credentialcomposer.JWTSVIDAttributes{}, c.err
+	}
+	claims := make(map[string]interface{}, len(attributes.Claims)+1)
+	for k, v := range attributes.Claims {
+		claims[k] = v
+	}
+	claims[c.claim] = entry.Id
+	return credentialcomposer.JWTSVIDAttributes{Claims: claims}, nil
+}
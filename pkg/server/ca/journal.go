@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"os"
+	"path/filepath"
 	"sort"
 	"sync"
 	"time"
@@ -38,6 +39,12 @@ type Journal struct {
 	entries *JournalEntries
 }
 
+// JournalPath returns the path of the journal in the data directory of the
+// server
+func JournalPath(dataDir string) string {
+	return filepath.Join(dataDir, "journal.pem")
+}
+
 func LoadJournal(path string) (*Journal, error) {
 	j := &Journal{
 		path:    path,
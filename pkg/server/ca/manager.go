@@ -68,6 +68,10 @@ type ManagerConfig struct {
 	Metrics       telemetry.Metrics
 	Clock         clock.Clock
 	HealthChecker health.Checker
+
+	// Backdate is how far back the self-signed CA certificates are valid
+	// from, to make up for clock skew. It is never less than 10 seconds.
+	Backdate time.Duration
 }
 
 type Manager struct {
@@ -97,6 +101,9 @@ func NewManager(c ManagerConfig) *Manager {
 	if c.Clock == nil {
 		c.Clock = clock.New()
 	}
+	if c.Backdate < backdate {
+		c.Backdate = backdate
+	}
 
 	m := &Manager{
 		c:               c,
@@ -247,7 +254,7 @@ func (m *Manager) prepareX509CA(ctx context.Context, slot *x509CASlot) (err erro
 			return err
 		}
 	} else {
-		notBefore := now.Add(-backdate)
+		notBefore := now.Add(-m.c.Backdate)
 		notAfter := now.Add(m.c.CATTL)
 		var trustBundle []*x509.Certificate
 		x509CA, trustBundle, err = SelfSignX509CA(ctx, signer, m.c.TrustDomain, m.c.CASubject, notBefore, notAfter)
@@ -576,7 +583,7 @@ func (m *Manager) loadJournal(ctx context.Context) error {
 }
 
 func (m *Manager) journalPath() string {
-	return filepath.Join(m.c.Dir, "journal.pem")
+	return JournalPath(m.c.Dir)
 }
 
 func (m *Manager) tryLoadX509CASlotFromEntry(ctx context.Context, entry *X509CAEntry) (*x509CASlot, error) {
@@ -74,6 +74,35 @@ func CreateX509SVIDTemplate(spiffeID spiffeid.ID, publicKey crypto.PublicKey, tr
 	}, nil
 }
 
+// CreateJWTKeyTemplate creates the template of the certificate of a JWT key,
+// which relying parties validating JWT-SVIDs through the x5c header chain to
+// the X.509 authorities of the trust domain
+func CreateJWTKeyTemplate(spiffeID spiffeid.ID, publicKey crypto.PublicKey, trustDomain spiffeid.TrustDomain, notBefore, notAfter time.Time, serialNumber *big.Int) (*x509.Certificate, error) {
+	if err := verifySameTrustDomain(trustDomain, spiffeID); err != nil {
+		return nil, err
+	}
+
+	keyID, err := x509util.GetSubjectKeyID(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Country:      []string{"US"},
+			Organization: []string{"SPIRE"},
+		},
+		URIs:                  []*url.URL{spiffeID.URL()},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		SubjectKeyId:          keyID,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		PublicKey:             publicKey,
+	}, nil
+}
+
 func verifySameTrustDomain(td spiffeid.TrustDomain, id spiffeid.ID) error {
 	if !id.MemberOf(td) {
 		return fmt.Errorf("%q is not a member of trust domain %q", id, td)
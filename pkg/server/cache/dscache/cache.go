@@ -14,58 +14,155 @@ const (
 	datastoreCacheExpiry = time.Second
 )
 
+// Kind identifies a kind of cached records
+type Kind string
+
+const (
+	KindBundle            Kind = "bundle"
+	KindRegistrationEntry Kind = "registration_entry"
+	KindAttestedNode      Kind = "attested_node"
+)
+
+// Config configures which records are cached. Bundles are always cached.
+type Config struct {
+	// TTL is how long a record is served from the cache. Changes made through
+	// this cache invalidate the records right away, but changes made by other
+	// servers sharing the database are only observed once the TTL elapses.
+	// Defaults to one second.
+	TTL time.Duration
+
+	// RegistrationEntries enables caching registration entries fetched by ID
+	RegistrationEntries bool
+
+	// AttestedNodes enables caching attested nodes fetched by SPIFFE ID
+	AttestedNodes bool
+}
+
 type useCache struct{}
 
+// WithCache returns a context that allows the records fetched with it to be
+// served from the cache. Callers must not modify the returned records.
 func WithCache(ctx context.Context) context.Context {
 	return context.WithValue(ctx, useCache{}, struct{}{})
 }
 
-type bundleEntry struct {
-	mu     sync.Mutex
-	ts     time.Time
-	bundle *common.Bundle
+type cacheEntry struct {
+	mu    sync.Mutex
+	ts    time.Time
+	value interface{}
+}
+
+type recordCache struct {
+	enabled bool
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+func newRecordCache(enabled bool) *recordCache {
+	return &recordCache{
+		enabled: enabled,
+		entries: make(map[string]*cacheEntry),
+	}
 }
 
 type DatastoreCache struct {
 	datastore.DataStore
 	clock clock.Clock
+	ttl   time.Duration
 
-	bundlesMu sync.Mutex
-	bundles   map[string]*bundleEntry
+	bundles *recordCache
+	entries *recordCache
+	nodes   *recordCache
 }
 
 func New(ds datastore.DataStore, clock clock.Clock) *DatastoreCache {
+	return NewWithConfig(ds, clock, Config{})
+}
+
+func NewWithConfig(ds datastore.DataStore, clock clock.Clock, config Config) *DatastoreCache {
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = datastoreCacheExpiry
+	}
 	return &DatastoreCache{
 		DataStore: ds,
 		clock:     clock,
-		bundles:   make(map[string]*bundleEntry),
+		ttl:       ttl,
+		bundles:   newRecordCache(true),
+		entries:   newRecordCache(config.RegistrationEntries),
+		nodes:     newRecordCache(config.AttestedNodes),
 	}
 }
 
-func (ds *DatastoreCache) FetchBundle(ctx context.Context, trustDomain string) (*common.Bundle, error) {
-	ds.bundlesMu.Lock()
-	entry, ok := ds.bundles[trustDomain]
+// Invalidate drops records from the cache, e.g. when they are known to be
+// changed by another server. An empty key drops all the records of the kind.
+func (ds *DatastoreCache) Invalidate(kind Kind, key string) {
+	var c *recordCache
+	switch kind {
+	case KindBundle:
+		c = ds.bundles
+	case KindRegistrationEntry:
+		c = ds.entries
+	case KindAttestedNode:
+		c = ds.nodes
+	default:
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key == "" {
+		c.entries = make(map[string]*cacheEntry)
+	} else {
+		delete(c.entries, key)
+	}
+}
+
+// fetch returns the record cached under the key if it is fresh and the
+// context allows it, or else fetches it. Misses are not cached.
+func (ds *DatastoreCache) fetch(ctx context.Context, c *recordCache, key string, fetch func() (interface{}, error)) (interface{}, error) {
+	if !c.enabled {
+		return fetch()
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
 	if !ok {
-		entry = &bundleEntry{}
-		ds.bundles[trustDomain] = entry
+		entry = &cacheEntry{}
+		c.entries[key] = entry
 	}
-	ds.bundlesMu.Unlock()
+	c.mu.Unlock()
 
 	entry.mu.Lock()
 	defer entry.mu.Unlock()
-	if entry.ts.IsZero() || ds.clock.Now().Sub(entry.ts) >= datastoreCacheExpiry || ctx.Value(useCache{}) == nil {
-		bundle, err := ds.DataStore.FetchBundle(ctx, trustDomain)
+	if entry.ts.IsZero() || ds.clock.Now().Sub(entry.ts) >= ds.ttl || ctx.Value(useCache{}) == nil {
+		value, err := fetch()
 		if err != nil {
 			return nil, err
 		}
-		// Don't cache bundle "misses"
-		if bundle == nil {
+		if value == nil {
 			return nil, nil
 		}
-		entry.bundle = bundle
+		entry.value = value
 		entry.ts = ds.clock.Now()
 	}
-	return entry.bundle, nil
+	return entry.value, nil
+}
+
+func (ds *DatastoreCache) FetchBundle(ctx context.Context, trustDomain string) (*common.Bundle, error) {
+	value, err := ds.fetch(ctx, ds.bundles, trustDomain, func() (interface{}, error) {
+		bundle, err := ds.DataStore.FetchBundle(ctx, trustDomain)
+		// Don't cache bundle "misses"
+		if err != nil || bundle == nil {
+			return nil, err
+		}
+		return bundle, nil
+	})
+	if value == nil {
+		return nil, err
+	}
+	return value.(*common.Bundle), nil
 }
 
 func (ds *DatastoreCache) PruneBundle(ctx context.Context, trustDomainID string, expiresBefore time.Time) (changed bool, err error) {
@@ -92,6 +189,10 @@ func (ds *DatastoreCache) UpdateBundle(ctx context.Context, b *common.Bundle, ma
 func (ds *DatastoreCache) DeleteBundle(ctx context.Context, td string, mode datastore.DeleteMode) (err error) {
 	if err = ds.DataStore.DeleteBundle(ctx, td, mode); err == nil {
 		ds.invalidateBundleEntry(td)
+		// Entries federated with the trust domain are deleted or changed
+		if mode != datastore.Restrict && ds.entries.enabled {
+			ds.Invalidate(KindRegistrationEntry, "")
+		}
 	}
 	return
 }
@@ -104,7 +205,87 @@ func (ds *DatastoreCache) SetBundle(ctx context.Context, b *common.Bundle) (bund
 }
 
 func (ds *DatastoreCache) invalidateBundleEntry(trustDomainID string) {
-	ds.bundlesMu.Lock()
-	delete(ds.bundles, trustDomainID)
-	ds.bundlesMu.Unlock()
+	ds.Invalidate(KindBundle, trustDomainID)
+}
+
+func (ds *DatastoreCache) FetchRegistrationEntry(ctx context.Context, entryID string) (*common.RegistrationEntry, error) {
+	value, err := ds.fetch(ctx, ds.entries, entryID, func() (interface{}, error) {
+		entry, err := ds.DataStore.FetchRegistrationEntry(ctx, entryID)
+		if err != nil || entry == nil {
+			return nil, err
+		}
+		return entry, nil
+	})
+	if value == nil {
+		return nil, err
+	}
+	return value.(*common.RegistrationEntry), nil
+}
+
+func (ds *DatastoreCache) UpdateRegistrationEntry(ctx context.Context, e *common.RegistrationEntry, mask *common.RegistrationEntryMask) (entry *common.RegistrationEntry, err error) {
+	if entry, err = ds.DataStore.UpdateRegistrationEntry(ctx, e, mask); err == nil {
+		ds.invalidateEntry(e.EntryId)
+	}
+	return
+}
+
+func (ds *DatastoreCache) DeleteRegistrationEntry(ctx context.Context, entryID string) (entry *common.RegistrationEntry, err error) {
+	if entry, err = ds.DataStore.DeleteRegistrationEntry(ctx, entryID); err == nil {
+		ds.invalidateEntry(entryID)
+	}
+	return
+}
+
+func (ds *DatastoreCache) PruneRegistrationEntries(ctx context.Context, expiresBefore time.Time) (err error) {
+	if err = ds.DataStore.PruneRegistrationEntries(ctx, expiresBefore); err == nil {
+		ds.invalidateEntry("")
+	}
+	return
+}
+
+func (ds *DatastoreCache) invalidateEntry(entryID string) {
+	if ds.entries.enabled {
+		ds.Invalidate(KindRegistrationEntry, entryID)
+	}
+}
+
+func (ds *DatastoreCache) FetchAttestedNode(ctx context.Context, spiffeID string) (*common.AttestedNode, error) {
+	value, err := ds.fetch(ctx, ds.nodes, spiffeID, func() (interface{}, error) {
+		node, err := ds.DataStore.FetchAttestedNode(ctx, spiffeID)
+		if err != nil || node == nil {
+			return nil, err
+		}
+		return node, nil
+	})
+	if value == nil {
+		return nil, err
+	}
+	return value.(*common.AttestedNode), nil
+}
+
+func (ds *DatastoreCache) UpdateAttestedNode(ctx context.Context, n *common.AttestedNode, mask *common.AttestedNodeMask) (node *common.AttestedNode, err error) {
+	if node, err = ds.DataStore.UpdateAttestedNode(ctx, n, mask); err == nil {
+		ds.invalidateNode(n.SpiffeId)
+	}
+	return
+}
+
+func (ds *DatastoreCache) DeleteAttestedNode(ctx context.Context, spiffeID string) (node *common.AttestedNode, err error) {
+	if node, err = ds.DataStore.DeleteAttestedNode(ctx, spiffeID); err == nil {
+		ds.invalidateNode(spiffeID)
+	}
+	return
+}
+
+func (ds *DatastoreCache) SetNodeSelectors(ctx context.Context, spiffeID string, selectors []*common.Selector) (err error) {
+	if err = ds.DataStore.SetNodeSelectors(ctx, spiffeID, selectors); err == nil {
+		ds.invalidateNode(spiffeID)
+	}
+	return
+}
+
+func (ds *DatastoreCache) invalidateNode(spiffeID string) {
+	if ds.nodes.enabled {
+		ds.Invalidate(KindAttestedNode, spiffeID)
+	}
 }
@@ -192,6 +192,136 @@ func TestBundleInvalidations(t *testing.T) {
 	}
 }
 
+func TestFetchRegistrationEntryCache(t *testing.T) {
+	ds := fakedatastore.New(t)
+	clk := clock.NewMock(t)
+	cache := NewWithConfig(ds, clk, Config{TTL: time.Minute, RegistrationEntries: true})
+	ctxWithCache := WithCache(context.Background())
+
+	entry, err := ds.CreateRegistrationEntry(context.Background(), &common.RegistrationEntry{
+		SpiffeId:  "spiffe://domain.test/workload",
+		ParentId:  "spiffe://domain.test/agent",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+		Ttl:       1,
+	})
+	require.NoError(t, err)
+
+	fetched, err := cache.FetchRegistrationEntry(ctxWithCache, entry.EntryId)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), fetched.Ttl)
+
+	// Changes not made through the cache are observed once the TTL elapses
+	entry.Ttl = 2
+	_, err = ds.UpdateRegistrationEntry(context.Background(), entry, nil)
+	require.NoError(t, err)
+	fetched, err = cache.FetchRegistrationEntry(ctxWithCache, entry.EntryId)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), fetched.Ttl)
+
+	clk.Add(time.Minute)
+	fetched, err = cache.FetchRegistrationEntry(ctxWithCache, entry.EntryId)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), fetched.Ttl)
+
+	// Changes made through the cache invalidate the entry right away
+	entry.Ttl = 3
+	_, err = cache.UpdateRegistrationEntry(context.Background(), entry, nil)
+	require.NoError(t, err)
+	fetched, err = cache.FetchRegistrationEntry(ctxWithCache, entry.EntryId)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), fetched.Ttl)
+
+	_, err = cache.DeleteRegistrationEntry(context.Background(), entry.EntryId)
+	require.NoError(t, err)
+	fetched, err = cache.FetchRegistrationEntry(ctxWithCache, entry.EntryId)
+	require.NoError(t, err)
+	require.Nil(t, fetched)
+}
+
+func TestFetchRegistrationEntryNotCachedByDefault(t *testing.T) {
+	ds := fakedatastore.New(t)
+	cache := New(ds, clock.NewMock(t))
+	ctxWithCache := WithCache(context.Background())
+
+	entry, err := ds.CreateRegistrationEntry(context.Background(), &common.RegistrationEntry{
+		SpiffeId:  "spiffe://domain.test/workload",
+		ParentId:  "spiffe://domain.test/agent",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+		Ttl:       1,
+	})
+	require.NoError(t, err)
+
+	_, err = cache.FetchRegistrationEntry(ctxWithCache, entry.EntryId)
+	require.NoError(t, err)
+
+	entry.Ttl = 2
+	_, err = ds.UpdateRegistrationEntry(context.Background(), entry, nil)
+	require.NoError(t, err)
+	fetched, err := cache.FetchRegistrationEntry(ctxWithCache, entry.EntryId)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), fetched.Ttl)
+}
+
+func TestFetchAttestedNodeCache(t *testing.T) {
+	ds := fakedatastore.New(t)
+	cache := NewWithConfig(ds, clock.NewMock(t), Config{AttestedNodes: true})
+	ctxWithCache := WithCache(context.Background())
+	agentID := "spiffe://domain.test/spire/agent/test/1"
+
+	// Misses are not cached
+	node, err := cache.FetchAttestedNode(ctxWithCache, agentID)
+	require.NoError(t, err)
+	require.Nil(t, node)
+
+	_, err = ds.CreateAttestedNode(context.Background(), &common.AttestedNode{
+		SpiffeId:            agentID,
+		AttestationDataType: "test",
+		CertSerialNumber:    "1",
+		CertNotAfter:        time.Now().Add(time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+	node, err = cache.FetchAttestedNode(ctxWithCache, agentID)
+	require.NoError(t, err)
+	require.Equal(t, "1", node.CertSerialNumber)
+
+	// Banning the agent through the cache is observed right away
+	_, err = cache.UpdateAttestedNode(context.Background(), &common.AttestedNode{
+		SpiffeId: agentID,
+	}, &common.AttestedNodeMask{CertSerialNumber: true})
+	require.NoError(t, err)
+	node, err = cache.FetchAttestedNode(ctxWithCache, agentID)
+	require.NoError(t, err)
+	require.Empty(t, node.CertSerialNumber)
+
+	_, err = cache.DeleteAttestedNode(context.Background(), agentID)
+	require.NoError(t, err)
+	node, err = cache.FetchAttestedNode(ctxWithCache, agentID)
+	require.NoError(t, err)
+	require.Nil(t, node)
+}
+
+func TestInvalidate(t *testing.T) {
+	td := "spiffe://domain.test"
+	bundle1 := &common.Bundle{TrustDomainId: td, RefreshHint: 1}
+	bundle2 := &common.Bundle{TrustDomainId: td, RefreshHint: 2}
+	ds := fakedatastore.New(t)
+	cache := New(ds, clock.NewMock(t))
+	ctxWithCache := WithCache(context.Background())
+
+	_, err := ds.SetBundle(context.Background(), bundle1)
+	require.NoError(t, err)
+	_, err = cache.FetchBundle(ctxWithCache, td)
+	require.NoError(t, err)
+
+	_, err = ds.SetBundle(context.Background(), bundle2)
+	require.NoError(t, err)
+	cache.Invalidate(KindBundle, "")
+
+	bundle, err := cache.FetchBundle(ctxWithCache, td)
+	require.NoError(t, err)
+	spiretest.RequireProtoEqual(t, bundle2, bundle)
+}
+
 // getBundles returns two different bundles with the same trust domain.
 func getBundles(t *testing.T, td string) (*common.Bundle, *common.Bundle) {
 	roots, keys := getRoots(t, td), getKeys(t)
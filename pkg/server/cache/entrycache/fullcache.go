@@ -85,8 +85,9 @@ type Agent struct {
 }
 
 type FullEntryCache struct {
-	aliases map[spiffeID][]aliasEntry
-	entries map[spiffeID][]*types.Entry
+	aliases   map[spiffeID][]aliasEntry
+	entries   map[spiffeID][]*types.Entry
+	instances map[spiffeID][]*types.Entry
 }
 
 type selectorSet map[Selector]struct{}
@@ -106,8 +107,9 @@ type aliasEntry struct {
 }
 
 // Build queries the data source for all registration entries and Agent selectors and builds an in-memory
-// representation of the data that can be used for efficient lookups.
-func Build(ctx context.Context, entryIter EntryIterator, agentIter AgentIterator) (*FullEntryCache, error) {
+// representation of the data that can be used for efficient lookups. The
+// templates are instantiated for each of the agents they match.
+func Build(ctx context.Context, entryIter EntryIterator, agentIter AgentIterator, templates ...*Template) (*FullEntryCache, error) {
 	type aliasInfo struct {
 		aliasEntry
 		selectors selectorSet
@@ -141,9 +143,15 @@ func Build(ctx context.Context, entryIter EntryIterator, agentIter AgentIterator
 	defer freeStringSet(aliasSeen)
 
 	aliases := make(map[spiffeID][]aliasEntry)
+	instances := make(map[spiffeID][]*types.Entry)
 	for agentIter.Next(ctx) {
 		agent := agentIter.Agent()
 		agentID := spiffeIDFromID(agent.ID)
+		for _, template := range templates {
+			if entry, ok := template.Instantiate(agent); ok {
+				instances[agentID] = append(instances[agentID], entry)
+			}
+		}
 		agentSelectors := selectorSetFromProto(agent.Selectors)
 		// track which aliases we've evaluated so far to make sure we don't
 		// add one twice.
@@ -165,8 +173,9 @@ func Build(ctx context.Context, entryIter EntryIterator, agentIter AgentIterator
 	}
 
 	return &FullEntryCache{
-		aliases: aliases,
-		entries: entries,
+		aliases:   aliases,
+		entries:   entries,
+		instances: instances,
 	}, nil
 }
 
@@ -188,6 +197,11 @@ func (c *FullEntryCache) getAuthorizedEntries(id spiffeID, seen map[spiffeID]str
 		entries = append(entries, alias.entry)
 		entries = append(entries, c.getAuthorizedEntries(alias.id, seen)...)
 	}
+
+	for _, instance := range c.instances[id] {
+		entries = append(entries, instance)
+		entries = append(entries, c.getAuthorizedEntries(spiffeIDFromProto(instance.SpiffeId), seen)...)
+	}
 	return entries
 }
 
@@ -18,8 +18,8 @@ var (
 )
 
 // BuildFromDataStore builds a Cache using the provided datastore as the data source
-func BuildFromDataStore(ctx context.Context, ds datastore.DataStore) (*FullEntryCache, error) {
-	return Build(ctx, makeEntryIteratorDS(ds), makeAgentIteratorDS(ds))
+func BuildFromDataStore(ctx context.Context, ds datastore.DataStore, templates ...*Template) (*FullEntryCache, error) {
+	return Build(ctx, makeEntryIteratorDS(ds), makeAgentIteratorDS(ds), templates...)
 }
 
 type entryIteratorDS struct {
@@ -0,0 +1,213 @@
+package entrycache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/idutil"
+)
+
+// TemplateEntryIDPrefix prefixes the IDs of the entries instantiated from
+// templates, which are not in the datastore
+const TemplateEntryIDPrefix = "template-"
+
+// TemplateConfig is the configuration of an entry template
+type TemplateConfig struct {
+	// Name identifies the template. It is part of the IDs of the entries
+	// instantiated from the template.
+	Name string
+
+	// NodeSelectors are the selectors an agent must have for the template
+	// to be instantiated for it
+	NodeSelectors []*types.Selector
+
+	// SPIFFEID is the text/template the SPIFFE IDs of the instantiated
+	// entries are rendered with. See TemplateData.
+	SPIFFEID string
+
+	// Selectors are the workload selectors of the instantiated entries
+	Selectors []*types.Selector
+
+	// DNSNames are the text/templates the DNS names of the instantiated
+	// entries are rendered with
+	DNSNames []string
+
+	// TTL is the SVID TTL of the instantiated entries, in seconds
+	TTL int32
+
+	// FederatesWith are the trust domains the instantiated entries federate
+	// with
+	FederatesWith []string
+}
+
+// Template is a registration entry declared once and instantiated by the
+// cache for each of the agents that have its node selectors. The entries are
+// parented to the agents, and their SPIFFE IDs and DNS names are rendered for
+// each agent. Templates save registering daemon-like workloads, which run on
+// every node, once per node.
+type Template struct {
+	name          string
+	trustDomain   spiffeid.TrustDomain
+	nodeSelectors selectorSet
+	spiffeID      *template.Template
+	dnsNames      []*template.Template
+	selectors     []*types.Selector
+	ttl           int32
+	federatesWith []string
+}
+
+// TemplateData is what the templates of the SPIFFE ID and DNS names are
+// rendered with
+type TemplateData struct {
+	// AgentID is the SPIFFE ID of the agent
+	AgentID string
+
+	// AgentPath is the path of the SPIFFE ID of the agent, without the
+	// leading /spire/agent/
+	AgentPath string
+
+	agentSelectors []*types.Selector
+}
+
+// Selector returns the value of the selector of the agent with the given type
+// and key, separated by a colon, e.g. "k8s_psat:agent_node_name". Agents
+// without such a selector fail the rendering, so the template is not
+// instantiated for them.
+func (d TemplateData) Selector(typeAndKey string) (string, error) {
+	parts := strings.SplitN(typeAndKey, ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("selector %q must be of the form type:key", typeAndKey)
+	}
+	prefix := parts[1] + ":"
+	for _, selector := range d.agentSelectors {
+		if selector.Type == parts[0] && strings.HasPrefix(selector.Value, prefix) {
+			return strings.TrimPrefix(selector.Value, prefix), nil
+		}
+	}
+	return "", fmt.Errorf("agent has no %q selector", typeAndKey)
+}
+
+// NewTemplate parses the configuration of an entry template of the trust
+// domain
+func NewTemplate(td spiffeid.TrustDomain, c TemplateConfig) (*Template, error) {
+	switch {
+	case c.Name == "":
+		return nil, errors.New("name is required")
+	case len(c.NodeSelectors) == 0:
+		return nil, errors.New("node selectors are required")
+	case len(c.Selectors) == 0:
+		return nil, errors.New("selectors are required")
+	case c.TTL < 0:
+		return nil, errors.New("TTL cannot be negative")
+	}
+
+	spiffeID, err := parseTemplate(c.Name, c.SPIFFEID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SPIFFE ID template: %w", err)
+	}
+	var dnsNames []*template.Template
+	for _, dnsName := range c.DNSNames {
+		t, err := parseTemplate(c.Name, dnsName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DNS name template: %w", err)
+		}
+		dnsNames = append(dnsNames, t)
+	}
+
+	return &Template{
+		name:          c.Name,
+		trustDomain:   td,
+		nodeSelectors: selectorSetFromProto(c.NodeSelectors),
+		spiffeID:      spiffeID,
+		dnsNames:      dnsNames,
+		selectors:     c.Selectors,
+		ttl:           c.TTL,
+		federatesWith: c.FederatesWith,
+	}, nil
+}
+
+// Name returns the name of the template
+func (t *Template) Name() string {
+	return t.name
+}
+
+// Instantiate returns the entry of the template for the agent, or false if
+// the agent doesn't have the node selectors of the template, or if the
+// rendering fails for it
+func (t *Template) Instantiate(agent Agent) (*types.Entry, bool) {
+	if !isSubset(t.nodeSelectors, selectorSetFromProto(agent.Selectors)) {
+		return nil, false
+	}
+
+	data := TemplateData{
+		AgentID:        agent.ID.String(),
+		AgentPath:      strings.TrimPrefix(agent.ID.Path(), "/spire/agent/"),
+		agentSelectors: agent.Selectors,
+	}
+
+	rendered, err := render(t.spiffeID, data)
+	if err != nil {
+		return nil, false
+	}
+	spiffeID, err := idutil.IDProtoFromString(rendered)
+	if err != nil {
+		return nil, false
+	}
+	if spiffeID.TrustDomain != t.trustDomain.String() || idutil.IsReservedPath(spiffeID.Path) {
+		return nil, false
+	}
+	if err := idutil.CheckIDProtoNormalization(spiffeID); err != nil {
+		return nil, false
+	}
+
+	var dnsNames []string
+	for _, dnsName := range t.dnsNames {
+		rendered, err := render(dnsName, data)
+		if err != nil {
+			return nil, false
+		}
+		dnsNames = append(dnsNames, rendered)
+	}
+
+	return &types.Entry{
+		Id: t.entryID(agent.ID),
+		ParentId: &types.SPIFFEID{
+			TrustDomain: agent.ID.TrustDomain().String(),
+			Path:        agent.ID.Path(),
+		},
+		SpiffeId:      spiffeID,
+		Selectors:     t.selectors,
+		Ttl:           t.ttl,
+		FederatesWith: t.federatesWith,
+		DnsNames:      dnsNames,
+	}, true
+}
+
+// entryID returns a stable ID for the entry of the agent, so that agents see
+// the same entry across cache rebuilds
+func (t *Template) entryID(agentID spiffeid.ID) string {
+	sum := sha256.Sum256([]byte(agentID.String()))
+	return TemplateEntryIDPrefix + t.name + "-" + hex.EncodeToString(sum[:8])
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, errors.New("template is empty")
+	}
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+func render(t *template.Template, data TemplateData) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
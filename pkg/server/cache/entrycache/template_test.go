@@ -0,0 +1,187 @@
+package entrycache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateInstantiate(t *testing.T) {
+	template, err := NewTemplate(td, TemplateConfig{
+		Name:          "fluentd",
+		NodeSelectors: []*types.Selector{{Type: "k8s_psat", Value: "cluster:prod"}},
+		SPIFFEID:      `spiffe://domain.test/fluentd/{{ .Selector "k8s_psat:agent_node_name" }}`,
+		Selectors:     []*types.Selector{{Type: "k8s", Value: "sa:fluentd"}},
+		DNSNames:      []string{"fluentd.{{ .AgentPath }}"},
+		TTL:           3600,
+	})
+	require.NoError(t, err)
+
+	agent := Agent{
+		ID: spiffeid.RequireFromString("spiffe://domain.test/spire/agent/node1"),
+		Selectors: []*types.Selector{
+			{Type: "k8s_psat", Value: "cluster:prod"},
+			{Type: "k8s_psat", Value: "agent_node_name:node1"},
+		},
+	}
+	entry, ok := template.Instantiate(agent)
+	require.True(t, ok)
+	assert.Regexp(t, "^template-fluentd-[0-9a-f]{16}$", entry.Id)
+	assert.Equal(t, &types.Entry{
+		Id:        entry.Id,
+		ParentId:  &types.SPIFFEID{TrustDomain: "domain.test", Path: "/spire/agent/node1"},
+		SpiffeId:  &types.SPIFFEID{TrustDomain: "domain.test", Path: "/fluentd/node1"},
+		Selectors: []*types.Selector{{Type: "k8s", Value: "sa:fluentd"}},
+		DnsNames:  []string{"fluentd.node1"},
+		Ttl:       3600,
+	}, entry)
+
+	// The entry ID is stable for the agent, and unique to it
+	again, ok := template.Instantiate(agent)
+	require.True(t, ok)
+	assert.Equal(t, entry.Id, again.Id)
+	other, ok := template.Instantiate(Agent{
+		ID: spiffeid.RequireFromString("spiffe://domain.test/spire/agent/node2"),
+		Selectors: []*types.Selector{
+			{Type: "k8s_psat", Value: "cluster:prod"},
+			{Type: "k8s_psat", Value: "agent_node_name:node2"},
+		},
+	})
+	require.True(t, ok)
+	assert.NotEqual(t, entry.Id, other.Id)
+
+	// Agents without the node selectors are not matched
+	_, ok = template.Instantiate(Agent{
+		ID:        spiffeid.RequireFromString("spiffe://domain.test/spire/agent/node3"),
+		Selectors: []*types.Selector{{Type: "k8s_psat", Value: "agent_node_name:node3"}},
+	})
+	assert.False(t, ok)
+
+	// Agents without the selectors used by the template are not matched
+	_, ok = template.Instantiate(Agent{
+		ID:        spiffeid.RequireFromString("spiffe://domain.test/spire/agent/node4"),
+		Selectors: []*types.Selector{{Type: "k8s_psat", Value: "cluster:prod"}},
+	})
+	assert.False(t, ok)
+}
+
+func TestTemplateInstantiateInvalidSPIFFEID(t *testing.T) {
+	agent := Agent{
+		ID:        spiffeid.RequireFromString("spiffe://domain.test/spire/agent/x509pop/node1"),
+		Selectors: []*types.Selector{{Type: "x509pop", Value: "subject:cn:node 1"}},
+	}
+
+	for _, spiffeID := range []string{
+		// Outside of the trust domain
+		"spiffe://other.test/daemon/{{ .AgentPath }}",
+		// Reserved path
+		"spiffe://domain.test/spire/{{ .AgentPath }}",
+		// Not normalized
+		`spiffe://domain.test/daemon/{{ .Selector "x509pop:subject:cn" }}`,
+	} {
+		template, err := NewTemplate(td, TemplateConfig{
+			Name:          "daemon",
+			NodeSelectors: agent.Selectors,
+			SPIFFEID:      spiffeID,
+			Selectors:     []*types.Selector{{Type: "unix", Value: "uid:0"}},
+		})
+		require.NoError(t, err)
+		_, ok := template.Instantiate(agent)
+		assert.False(t, ok, spiffeID)
+	}
+}
+
+func TestNewTemplate(t *testing.T) {
+	config := TemplateConfig{
+		Name:          "daemon",
+		NodeSelectors: []*types.Selector{{Type: "a", Value: "1"}},
+		SPIFFEID:      "spiffe://domain.test/daemon/{{ .AgentPath }}",
+		Selectors:     []*types.Selector{{Type: "unix", Value: "uid:0"}},
+	}
+	_, err := NewTemplate(td, config)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name      string
+		modify    func(*TemplateConfig)
+		expectErr string
+	}{
+		{
+			name:      "no node selectors",
+			modify:    func(c *TemplateConfig) { c.NodeSelectors = nil },
+			expectErr: "node selectors are required",
+		},
+		{
+			name:      "no selectors",
+			modify:    func(c *TemplateConfig) { c.Selectors = nil },
+			expectErr: "selectors are required",
+		},
+		{
+			name:      "no SPIFFE ID",
+			modify:    func(c *TemplateConfig) { c.SPIFFEID = "" },
+			expectErr: "invalid SPIFFE ID template: template is empty",
+		},
+		{
+			name:      "malformed SPIFFE ID",
+			modify:    func(c *TemplateConfig) { c.SPIFFEID = "spiffe://domain.test/{{ .AgentPath" },
+			expectErr: "invalid SPIFFE ID template: template: daemon:1: unclosed action",
+		},
+		{
+			name:      "malformed DNS name",
+			modify:    func(c *TemplateConfig) { c.DNSNames = []string{"{{"} },
+			expectErr: "invalid DNS name template: template: daemon:1: unclosed action",
+		},
+		{
+			name:      "negative TTL",
+			modify:    func(c *TemplateConfig) { c.TTL = -1 },
+			expectErr: "TTL cannot be negative",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			config := config
+			tt.modify(&config)
+			_, err := NewTemplate(td, config)
+			require.EqualError(t, err, tt.expectErr)
+		})
+	}
+}
+
+func TestBuildWithTemplates(t *testing.T) {
+	agent1 := spiffeid.RequireFromString("spiffe://domain.test/spire/agent/node1")
+	agent2 := spiffeid.RequireFromString("spiffe://domain.test/spire/agent/node2")
+
+	template, err := NewTemplate(td, TemplateConfig{
+		Name:          "daemon",
+		NodeSelectors: []*types.Selector{{Type: "role", Value: "worker"}},
+		SPIFFEID:      "spiffe://domain.test/daemon/{{ .AgentPath }}",
+		Selectors:     []*types.Selector{{Type: "unix", Value: "uid:0"}},
+	})
+	require.NoError(t, err)
+
+	// Entries can be parented to the instantiated entries
+	child := &types.Entry{
+		Id:        "child",
+		ParentId:  &types.SPIFFEID{TrustDomain: "domain.test", Path: "/daemon/node1"},
+		SpiffeId:  &types.SPIFFEID{TrustDomain: "domain.test", Path: "/child"},
+		Selectors: []*types.Selector{{Type: "unix", Value: "uid:1"}},
+	}
+
+	cache, err := Build(context.Background(), makeEntryIterator([]*types.Entry{child}), makeAgentIterator([]Agent{
+		{ID: agent1, Selectors: []*types.Selector{{Type: "role", Value: "worker"}}},
+		{ID: agent2, Selectors: []*types.Selector{{Type: "role", Value: "control-plane"}}},
+	}), template)
+	require.NoError(t, err)
+
+	entries := cache.GetAuthorizedEntries(agent1)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "/daemon/node1", entries[0].SpiffeId.Path)
+	assert.Equal(t, "/spire/agent/node1", entries[0].ParentId.Path)
+	assert.Equal(t, child, entries[1])
+
+	assert.Empty(t, cache.GetAuthorizedEntries(agent2))
+}
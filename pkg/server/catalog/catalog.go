@@ -23,6 +23,7 @@ import (
 	ds_sql "github.com/spiffe/spire/pkg/server/datastore/sqlstore"
 	"github.com/spiffe/spire/pkg/server/hostservice/agentstore"
 	"github.com/spiffe/spire/pkg/server/hostservice/identityprovider"
+	"github.com/spiffe/spire/pkg/server/plugin/credentialcomposer"
 	"github.com/spiffe/spire/pkg/server/plugin/keymanager"
 	"github.com/spiffe/spire/pkg/server/plugin/nodeattestor"
 	"github.com/spiffe/spire/pkg/server/plugin/noderesolver"
@@ -34,15 +35,17 @@ import (
 )
 
 const (
-	dataStoreType         = "DataStore"
-	keyManagerType        = "KeyManager"
-	nodeAttestorType      = "NodeAttestor"
-	nodeResolverType      = "NodeResolver"
-	notifierType          = "Notifier"
-	upstreamAuthorityType = "UpstreamAuthority"
+	credentialComposerType = "CredentialComposer"
+	dataStoreType          = "DataStore"
+	keyManagerType         = "KeyManager"
+	nodeAttestorType       = "NodeAttestor"
+	nodeResolverType       = "NodeResolver"
+	notifierType           = "Notifier"
+	upstreamAuthorityType  = "UpstreamAuthority"
 )
 
 type Catalog interface {
+	GetCredentialComposers() []credentialcomposer.CredentialComposer
 	GetDataStore() datastore.DataStore
 	GetNodeAttestorNamed(name string) (nodeattestor.NodeAttestor, bool)
 	GetNodeResolverNamed(name string) (noderesolver.NodeResolver, bool)
@@ -63,11 +66,13 @@ type Config struct {
 	AgentStore       *agentstore.AgentStore
 	MetricsService   metricsv0.MetricsServiceServer
 	HealthChecker    health.Checker
+	DatastoreCache   dscache.Config
 }
 
 type datastoreRepository struct{ datastore.Repository }
 
 type Repository struct {
+	credentialComposerRepository
 	datastoreRepository
 	keyManagerRepository
 	nodeAttestorRepository
@@ -107,12 +112,25 @@ func Load(ctx context.Context, config Config) (_ *Repository, err error) {
 		config.Log.Warn(`The "noop" NodeResolver is not required, is deprecated, and will be removed from a future release`)
 	}
 
+	// Likewise strip out the CredentialComposer plugin configuration and
+	// load the built-in plugins directly, since the plugin SDK does not
+	// define the CredentialComposer service.
+	credentialComposerConfig := config.PluginConfig[credentialComposerType]
+	delete(config.PluginConfig, credentialComposerType)
+	credentialComposers, err := loadCredentialComposers(config.Log, config.TrustDomain, credentialComposerConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	pluginConfigs, err := catalog.PluginConfigsFromHCL(config.PluginConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	repo := new(Repository)
+	for _, credentialComposer := range credentialComposers {
+		repo.AddCredentialComposer(credentialComposer)
+	}
 	repo.Closer, err = catalog.Load(ctx, catalog.Config{
 		Log: config.Log,
 		CoreConfig: catalog.CoreConfig{
@@ -152,7 +170,7 @@ func Load(ctx context.Context, config Config) (_ *Repository, err error) {
 	})
 
 	dataStore = ds_telemetry.WithMetrics(dataStore, config.Metrics)
-	dataStore = dscache.New(dataStore, clock.New())
+	dataStore = dscache.NewWithConfig(dataStore, clock.New(), config.DatastoreCache)
 
 	repo.SetDataStore(dataStore)
 	repo.SetKeyManager(km_telemetry.WithMetrics(repo.GetKeyManager(), config.Metrics))
@@ -160,6 +178,12 @@ func Load(ctx context.Context, config Config) (_ *Repository, err error) {
 	return repo, nil
 }
 
+// LoadDataStore loads the DataStore from the plugin configuration alone, for
+// the tools that work on the datastore without running the server.
+func LoadDataStore(log logrus.FieldLogger, pluginConfig HCLPluginConfigMap) (datastore.DataStore, error) {
+	return loadSQLDataStore(log, pluginConfig[dataStoreType])
+}
+
 func loadSQLDataStore(log logrus.FieldLogger, datastoreConfig map[string]catalog.HCLPluginConfig) (datastore.DataStore, error) {
 	switch {
 	case len(datastoreConfig) == 0:
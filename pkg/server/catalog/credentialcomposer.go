@@ -0,0 +1,67 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/common/catalog"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/server/plugin/credentialcomposer"
+	"github.com/spiffe/spire/pkg/server/plugin/credentialcomposer/static"
+)
+
+type credentialComposerRepository struct {
+	credentialcomposer.Repository
+}
+
+// credentialComposerBuiltIns are the built-in CredentialComposer plugins, by
+// name
+var credentialComposerBuiltIns = map[string]func() credentialcomposer.BuiltIn{
+	static.PluginName: func() credentialcomposer.BuiltIn { return static.New() },
+}
+
+// loadCredentialComposers loads the CredentialComposer plugins. The plugin
+// SDK does not define a CredentialComposer service, so only the built-in
+// plugins are supported, and they are loaded directly rather than through
+// the plugin catalog. They are invoked in the order of their names.
+func loadCredentialComposers(log logrus.FieldLogger, trustDomain spiffeid.TrustDomain, configs map[string]catalog.HCLPluginConfig) ([]credentialcomposer.CredentialComposer, error) {
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var composers []credentialcomposer.CredentialComposer
+	for _, name := range names {
+		config, err := catalog.PluginConfigFromHCL(credentialComposerType, name, configs[name])
+		if err != nil {
+			return nil, err
+		}
+		pluginLog := log.WithFields(logrus.Fields{
+			telemetry.PluginName: name,
+			telemetry.PluginType: credentialComposerType,
+		})
+		if config.Disabled {
+			pluginLog.Debug("Not loading plugin; disabled")
+			continue
+		}
+		if config.IsExternal() {
+			return nil, fmt.Errorf("external %s plugins are not supported; only the built-in plugins are", credentialComposerType)
+		}
+
+		newBuiltIn, ok := credentialComposerBuiltIns[name]
+		if !ok {
+			return nil, fmt.Errorf("no built-in %s plugin named %q", credentialComposerType, name)
+		}
+		composer := newBuiltIn()
+		if err := composer.Configure(trustDomain, config.Data); err != nil {
+			pluginLog.WithError(err).Error("Failed to configure plugin")
+			return nil, fmt.Errorf("failed to configure plugin %q: %w", name, err)
+		}
+		pluginLog.Info("Plugin loaded")
+		composers = append(composers, composer)
+	}
+	return composers, nil
+}
@@ -3,6 +3,7 @@ package catalog
 import (
 	"github.com/spiffe/spire/pkg/common/catalog"
 	"github.com/spiffe/spire/pkg/server/plugin/notifier"
+	"github.com/spiffe/spire/pkg/server/plugin/notifier/bundlepublisher"
 	"github.com/spiffe/spire/pkg/server/plugin/notifier/gcsbundle"
 	"github.com/spiffe/spire/pkg/server/plugin/notifier/k8sbundle"
 )
@@ -31,6 +32,7 @@ func (repo *notifierRepository) LegacyVersion() (catalog.Version, bool) {
 
 func (repo *notifierRepository) BuiltIns() []catalog.BuiltIn {
 	return []catalog.BuiltIn{
+		bundlepublisher.BuiltIn(),
 		gcsbundle.BuiltIn(),
 		k8sbundle.BuiltIn(),
 	}
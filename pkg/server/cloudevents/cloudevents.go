@@ -0,0 +1,89 @@
+package cloudevents
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+const (
+	// SpecVersion is the version of the CloudEvents specification the events
+	// conform to
+	SpecVersion = "1.0"
+
+	// EntryCreated is the type of the event of a registration entry being
+	// created
+	EntryCreated = "io.spiffe.spire.entry.created"
+
+	// EntryUpdated is the type of the event of a registration entry being
+	// updated
+	EntryUpdated = "io.spiffe.spire.entry.updated"
+
+	// EntryDeleted is the type of the event of a registration entry being
+	// deleted
+	EntryDeleted = "io.spiffe.spire.entry.deleted"
+
+	// X509SVIDIssued is the type of the event of the first X509-SVID being
+	// issued for a registration entry created since the server started
+	X509SVIDIssued = "io.spiffe.spire.svid.issued"
+
+	// AgentAttested is the type of the event of an agent attesting for the
+	// first time, or after being deleted
+	AgentAttested = "io.spiffe.spire.agent.attested"
+)
+
+// Event is a CloudEvent, in the structured JSON format
+type Event struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// EntryData is the data of the registration entry events. It is the entry as
+// of the change.
+type EntryData struct {
+	ID             string   `json:"id"`
+	SPIFFEID       string   `json:"spiffe_id"`
+	ParentID       string   `json:"parent_id"`
+	Selectors      []string `json:"selectors"`
+	TTL            int32    `json:"ttl"`
+	FederatesWith  []string `json:"federates_with"`
+	Admin          bool     `json:"admin"`
+	Downstream     bool     `json:"downstream"`
+	ExpiresAt      int64    `json:"expires_at"`
+	DNSNames       []string `json:"dns_names"`
+	RevisionNumber int64    `json:"revision_number"`
+
+	// ChangedBy identifies who made the change, if known: the SPIFFE ID of
+	// the caller of the registration APIs, or "local" for the callers of the
+	// local APIs
+	ChangedBy string `json:"changed_by,omitempty"`
+}
+
+// X509SVIDData is the data of the X509SVIDIssued events
+type X509SVIDData struct {
+	EntryID      string `json:"entry_id"`
+	SPIFFEID     string `json:"spiffe_id"`
+	SerialNumber string `json:"serial_number"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// AgentData is the data of the agent events
+type AgentData struct {
+	AgentID         string   `json:"agent_id"`
+	AttestationType string   `json:"attestation_type"`
+	Selectors       []string `json:"selectors"`
+	SerialNumber    string   `json:"serial_number"`
+	ExpiresAt       int64    `json:"expires_at"`
+}
+
+// X509SVIDNotifier is notified of the X509-SVIDs issued for registration
+// entries. Notifications must not block, as they happen while the agent call
+// is being served.
+type X509SVIDNotifier interface {
+	NotifyX509SVIDIssued(entryID string, svid *x509.Certificate)
+}
@@ -0,0 +1,47 @@
+package cloudevents
+
+import (
+	"context"
+
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/proto/spire/common"
+)
+
+// WithEntryEvents wraps the datastore so that the changes of the
+// registration entries made with it are published. The entries deleted by
+// pruning are not published.
+func WithEntryEvents(ds datastore.DataStore, p *Publisher) datastore.DataStore {
+	return entryEventsWrapper{
+		DataStore: ds,
+		p:         p,
+	}
+}
+
+type entryEventsWrapper struct {
+	datastore.DataStore
+	p *Publisher
+}
+
+func (w entryEventsWrapper) CreateRegistrationEntry(ctx context.Context, e *common.RegistrationEntry) (*common.RegistrationEntry, error) {
+	entry, err := w.DataStore.CreateRegistrationEntry(ctx, e)
+	if err == nil {
+		w.p.notifyEntryEvent(EntryCreated, entry, datastore.ChangedBy(ctx))
+	}
+	return entry, err
+}
+
+func (w entryEventsWrapper) UpdateRegistrationEntry(ctx context.Context, e *common.RegistrationEntry, mask *common.RegistrationEntryMask) (*common.RegistrationEntry, error) {
+	entry, err := w.DataStore.UpdateRegistrationEntry(ctx, e, mask)
+	if err == nil {
+		w.p.notifyEntryEvent(EntryUpdated, entry, datastore.ChangedBy(ctx))
+	}
+	return entry, err
+}
+
+func (w entryEventsWrapper) DeleteRegistrationEntry(ctx context.Context, entryID string) (*common.RegistrationEntry, error) {
+	entry, err := w.DataStore.DeleteRegistrationEntry(ctx, entryID)
+	if err == nil && entry != nil {
+		w.p.notifyEntryEvent(EntryDeleted, entry, datastore.ChangedBy(ctx))
+	}
+	return entry, err
+}
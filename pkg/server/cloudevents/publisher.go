@@ -0,0 +1,266 @@
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/server/nodeevents"
+	"github.com/spiffe/spire/proto/spire/common"
+)
+
+const (
+	// DefaultTimeout is the timeout of the requests to the sink if not
+	// overridden by the config
+	DefaultTimeout = 5 * time.Second
+
+	// contentType is the content type of the events in the structured JSON
+	// format
+	contentType = "application/cloudevents+json"
+
+	// dataContentType is the content type of the data of the events
+	dataContentType = "application/json"
+
+	// queueSize is how many events can wait to be delivered before new
+	// events are dropped
+	queueSize = 1024
+
+	// deliveryAttempts is how many times the delivery of an event is
+	// attempted
+	deliveryAttempts = 3
+
+	// retryInterval is how long to wait before retrying the delivery of an
+	// event, multiplied by the number of attempts made
+	retryInterval = time.Second
+
+	// maxNewEntries is how many of the entries created since the server
+	// started can wait for their first X509-SVID. Entries created once the
+	// limit is reached produce no X509SVIDIssued event.
+	maxNewEntries = 10000
+)
+
+// Config is the config of the publisher
+type Config struct {
+	// URL is the sink the events are POSTed to, in the structured JSON
+	// format
+	URL string
+
+	// Source is the source of the events, e.g. the SPIFFE ID of the trust
+	// domain
+	Source string
+
+	// Timeout is the timeout of each request to the sink
+	Timeout time.Duration
+
+	Log   logrus.FieldLogger
+	Clock clock.Clock
+}
+
+// Publisher publishes the events of the lifecycle of the identities as
+// CloudEvents to an HTTP sink, e.g. a CloudEvents broker or a bridge to a
+// message bus, for downstream systems like a CMDB or a SIEM. Events are
+// delivered in order, from a bounded queue; events are dropped if the queue
+// is full or if they can't be delivered after a few attempts.
+type Publisher struct {
+	c      Config
+	client *http.Client
+	events chan *Event
+
+	// newEntries holds the IDs of the entries created since the server
+	// started that have not been issued an X509-SVID yet
+	newEntriesMu sync.Mutex
+	newEntries   map[string]struct{}
+}
+
+// NewPublisher creates a new publisher
+func NewPublisher(config Config) *Publisher {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.Clock == nil {
+		config.Clock = clock.New()
+	}
+
+	return &Publisher{
+		c:          config,
+		client:     &http.Client{Timeout: config.Timeout},
+		events:     make(chan *Event, queueSize),
+		newEntries: make(map[string]struct{}),
+	}
+}
+
+// NotifyNodeEvent publishes the attestation events of the agents
+func (p *Publisher) NotifyNodeEvent(event nodeevents.Event) {
+	if event.Type != nodeevents.AgentAttested {
+		return
+	}
+
+	data := AgentData{
+		AgentID:         event.AgentID,
+		AttestationType: event.AttestationType,
+		Selectors:       []string{},
+		SerialNumber:    event.SerialNumber,
+		ExpiresAt:       event.ExpiresAt,
+	}
+	for _, selector := range event.Selectors {
+		data.Selectors = append(data.Selectors, selector.Type+":"+selector.Value)
+	}
+	p.publish(AgentAttested, event.AgentID, event.Time, data)
+}
+
+// NotifyX509SVIDIssued publishes the issuance of the first X509-SVID of the
+// entries created since the server started
+func (p *Publisher) NotifyX509SVIDIssued(entryID string, svid *x509.Certificate) {
+	p.newEntriesMu.Lock()
+	_, ok := p.newEntries[entryID]
+	delete(p.newEntries, entryID)
+	p.newEntriesMu.Unlock()
+	if !ok {
+		return
+	}
+
+	spiffeID := ""
+	if len(svid.URIs) > 0 {
+		spiffeID = svid.URIs[0].String()
+	}
+	p.publish(X509SVIDIssued, entryID, time.Time{}, X509SVIDData{
+		EntryID:      entryID,
+		SPIFFEID:     spiffeID,
+		SerialNumber: svid.SerialNumber.String(),
+		ExpiresAt:    svid.NotAfter.Unix(),
+	})
+}
+
+// notifyEntryEvent publishes a change of a registration entry
+func (p *Publisher) notifyEntryEvent(eventType string, entry *common.RegistrationEntry, changedBy string) {
+	p.newEntriesMu.Lock()
+	switch {
+	case eventType == EntryDeleted:
+		delete(p.newEntries, entry.EntryId)
+	case eventType == EntryCreated && len(p.newEntries) < maxNewEntries:
+		p.newEntries[entry.EntryId] = struct{}{}
+	}
+	p.newEntriesMu.Unlock()
+
+	data := EntryData{
+		ID:             entry.EntryId,
+		SPIFFEID:       entry.SpiffeId,
+		ParentID:       entry.ParentId,
+		Selectors:      []string{},
+		TTL:            entry.Ttl,
+		FederatesWith:  append([]string{}, entry.FederatesWith...),
+		Admin:          entry.Admin,
+		Downstream:     entry.Downstream,
+		ExpiresAt:      entry.EntryExpiry,
+		DNSNames:       append([]string{}, entry.DnsNames...),
+		RevisionNumber: entry.RevisionNumber,
+		ChangedBy:      changedBy,
+	}
+	for _, selector := range entry.Selectors {
+		data.Selectors = append(data.Selectors, selector.Type+":"+selector.Value)
+	}
+	p.publish(eventType, entry.EntryId, time.Time{}, data)
+}
+
+// publish queues an event for delivery. A zero time means the event happened
+// now.
+func (p *Publisher) publish(eventType, subject string, t time.Time, data interface{}) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		p.c.Log.WithError(err).WithField(telemetry.Type, eventType).Error("Failed to generate event ID")
+		return
+	}
+	if t.IsZero() {
+		t = p.c.Clock.Now()
+	}
+
+	event := &Event{
+		SpecVersion:     SpecVersion,
+		ID:              id.String(),
+		Source:          p.c.Source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            t.UTC(),
+		DataContentType: dataContentType,
+		Data:            data,
+	}
+
+	select {
+	case p.events <- event:
+	default:
+		p.c.Log.WithFields(logrus.Fields{
+			telemetry.Type:    event.Type,
+			telemetry.Subject: event.Subject,
+		}).Warn("Dropping CloudEvent; the queue is full")
+	}
+}
+
+// Run delivers the queued events until the context is done
+func (p *Publisher) Run(ctx context.Context) error {
+	for {
+		select {
+		case event := <-p.events:
+			// Log an error on failure unless we're shutting down
+			if err := p.deliver(ctx, event); err != nil && ctx.Err() == nil {
+				p.c.Log.WithFields(logrus.Fields{
+					telemetry.Type:    event.Type,
+					telemetry.Subject: event.Subject,
+				}).WithError(err).Error("Failed to deliver CloudEvent to sink")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (p *Publisher) deliver(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := p.post(ctx, body)
+		if err == nil || attempt == deliveryAttempts {
+			return err
+		}
+
+		select {
+		case <-p.c.Clock.After(time.Duration(attempt) * retryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *Publisher) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
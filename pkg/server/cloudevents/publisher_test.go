@@ -0,0 +1,259 @@
+package cloudevents
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/pkg/server/nodeevents"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/spiffe/spire/test/clock"
+	"github.com/spiffe/spire/test/fakes/fakedatastore"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receivedEvent is an event as received by the sink
+type receivedEvent struct {
+	Event
+	Data json.RawMessage `json:"data"`
+}
+
+func TestPublisherDeliversEvents(t *testing.T) {
+	received := make(chan receivedEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, http.MethodPost, req.Method)
+		assert.Equal(t, "application/cloudevents+json", req.Header.Get("Content-Type"))
+		var event receivedEvent
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&event))
+		received <- event
+	}))
+	defer server.Close()
+
+	log, _ := test.NewNullLogger()
+	clk := clock.NewMock(t)
+	clk.Set(time.Unix(1600000000, 0))
+	publisher := NewPublisher(Config{
+		URL:    server.URL,
+		Source: "spiffe://example.org",
+		Log:    log,
+		Clock:  clk,
+	})
+	ds := WithEntryEvents(fakedatastore.New(t), publisher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		assert.NoError(t, publisher.Run(ctx))
+	}()
+
+	// Entry created
+	changeCtx := datastore.WithChangedBy(ctx, "spiffe://example.org/admin")
+	entry, err := ds.CreateRegistrationEntry(changeCtx, &common.RegistrationEntry{
+		ParentId:  "spiffe://example.org/parent",
+		SpiffeId:  "spiffe://example.org/workload",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+		Ttl:       60,
+	})
+	require.NoError(t, err)
+	event := receiveEvent(t, received)
+	assert.Equal(t, "1.0", event.SpecVersion)
+	assert.NotEmpty(t, event.ID)
+	assert.Equal(t, "spiffe://example.org", event.Source)
+	assert.Equal(t, EntryCreated, event.Type)
+	assert.Equal(t, entry.EntryId, event.Subject)
+	assert.Equal(t, time.Unix(1600000000, 0).UTC(), event.Time)
+	assert.Equal(t, "application/json", event.DataContentType)
+	assert.Equal(t, EntryData{
+		ID:            entry.EntryId,
+		SPIFFEID:      "spiffe://example.org/workload",
+		ParentID:      "spiffe://example.org/parent",
+		Selectors:     []string{"unix:uid:1000"},
+		TTL:           60,
+		FederatesWith: []string{},
+		DNSNames:      []string{},
+		ChangedBy:     "spiffe://example.org/admin",
+	}, entryData(t, event))
+
+	// The first X509-SVID of the new entry is published, the next ones are
+	// not
+	svid := &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		NotAfter:     time.Unix(1600003600, 0),
+		URIs:         []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/workload"}},
+	}
+	publisher.NotifyX509SVIDIssued(entry.EntryId, svid)
+	publisher.NotifyX509SVIDIssued(entry.EntryId, svid)
+	publisher.NotifyX509SVIDIssued("unknown", svid)
+	event = receiveEvent(t, received)
+	assert.Equal(t, X509SVIDIssued, event.Type)
+	assert.Equal(t, entry.EntryId, event.Subject)
+	var svidData X509SVIDData
+	require.NoError(t, json.Unmarshal(event.Data, &svidData))
+	assert.Equal(t, X509SVIDData{
+		EntryID:      entry.EntryId,
+		SPIFFEID:     "spiffe://example.org/workload",
+		SerialNumber: "1234",
+		ExpiresAt:    1600003600,
+	}, svidData)
+
+	// Entry updated
+	entry.Ttl = 120
+	_, err = ds.UpdateRegistrationEntry(ctx, entry, &common.RegistrationEntryMask{Ttl: true})
+	require.NoError(t, err)
+	event = receiveEvent(t, received)
+	assert.Equal(t, EntryUpdated, event.Type)
+	data := entryData(t, event)
+	assert.Equal(t, int32(120), data.TTL)
+	assert.Equal(t, int64(1), data.RevisionNumber)
+	assert.Empty(t, data.ChangedBy)
+
+	// Entry deleted
+	_, err = ds.DeleteRegistrationEntry(changeCtx, entry.EntryId)
+	require.NoError(t, err)
+	event = receiveEvent(t, received)
+	assert.Equal(t, EntryDeleted, event.Type)
+	assert.Equal(t, entry.EntryId, event.Subject)
+
+	// Failed changes are not published
+	_, err = ds.DeleteRegistrationEntry(changeCtx, entry.EntryId)
+	require.Error(t, err)
+
+	// Agent attested, while the other node events are not published
+	publisher.NotifyNodeEvent(nodeevents.Event{
+		Type:    nodeevents.AgentBanned,
+		AgentID: "spiffe://example.org/spire/agent/join_token/token",
+	})
+	publisher.NotifyNodeEvent(nodeevents.Event{
+		Type:            nodeevents.AgentAttested,
+		Time:            time.Unix(1600000060, 0),
+		AgentID:         "spiffe://example.org/spire/agent/join_token/token",
+		AttestationType: "join_token",
+		Selectors:       []nodeevents.Selector{{Type: "join_token", Value: "token"}},
+		SerialNumber:    "5678",
+		ExpiresAt:       1600003660,
+	})
+	event = receiveEvent(t, received)
+	assert.Equal(t, AgentAttested, event.Type)
+	assert.Equal(t, "spiffe://example.org/spire/agent/join_token/token", event.Subject)
+	assert.Equal(t, time.Unix(1600000060, 0).UTC(), event.Time)
+	var agentData AgentData
+	require.NoError(t, json.Unmarshal(event.Data, &agentData))
+	assert.Equal(t, AgentData{
+		AgentID:         "spiffe://example.org/spire/agent/join_token/token",
+		AttestationType: "join_token",
+		Selectors:       []string{"join_token:token"},
+		SerialNumber:    "5678",
+		ExpiresAt:       1600003660,
+	}, agentData)
+
+	select {
+	case event := <-received:
+		assert.Failf(t, "unexpected event", "type %q", event.Type)
+	default:
+	}
+}
+
+func TestPublisherRetriesDelivery(t *testing.T) {
+	received := make(chan receivedEvent, deliveryAttempts)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var event receivedEvent
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&event))
+		received <- event
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	log, logHook := test.NewNullLogger()
+	clk := clock.NewMock(t)
+	publisher := NewPublisher(Config{URL: server.URL, Log: log, Clock: clk})
+	publisher.NotifyNodeEvent(nodeevents.Event{Type: nodeevents.AgentAttested, AgentID: "spiffe://example.org/spire/agent/a"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, publisher.Run(ctx))
+	}()
+
+	var id string
+	for attempt := 1; attempt <= deliveryAttempts; attempt++ {
+		event := receiveEvent(t, received)
+		// Retries are the same event
+		if id == "" {
+			id = event.ID
+		}
+		require.Equal(t, id, event.ID)
+		if attempt < deliveryAttempts {
+			clk.WaitForAfter(time.Minute, "delivery was not retried")
+			clk.Add(time.Duration(attempt) * retryInterval)
+		}
+	}
+
+	// The event is dropped once the last attempt fails
+	require.Eventually(t, func() bool {
+		return len(logHook.AllEntries()) > 0
+	}, time.Minute, 10*time.Millisecond)
+	cancel()
+	<-done
+	spiretest.AssertLogs(t, logHook.AllEntries(), []spiretest.LogEntry{
+		{
+			Level:   logrus.ErrorLevel,
+			Message: "Failed to deliver CloudEvent to sink",
+			Data: logrus.Fields{
+				"type":          AgentAttested,
+				"subject":       "spiffe://example.org/spire/agent/a",
+				logrus.ErrorKey: "unexpected status code 503",
+			},
+		},
+	})
+}
+
+func TestPublisherDropsEventsWhenQueueIsFull(t *testing.T) {
+	log, logHook := test.NewNullLogger()
+	publisher := NewPublisher(Config{URL: "http://localhost", Log: log})
+	attested := nodeevents.Event{Type: nodeevents.AgentAttested, AgentID: "spiffe://example.org/spire/agent/a"}
+	for i := 0; i < queueSize; i++ {
+		publisher.NotifyNodeEvent(attested)
+	}
+	require.Empty(t, logHook.AllEntries())
+
+	publisher.NotifyNodeEvent(attested)
+	spiretest.AssertLogs(t, logHook.AllEntries(), []spiretest.LogEntry{
+		{
+			Level:   logrus.WarnLevel,
+			Message: "Dropping CloudEvent; the queue is full",
+			Data: logrus.Fields{
+				"type":    AgentAttested,
+				"subject": "spiffe://example.org/spire/agent/a",
+			},
+		},
+	})
+}
+
+func entryData(t *testing.T, event receivedEvent) EntryData {
+	var data EntryData
+	require.NoError(t, json.Unmarshal(event.Data, &data))
+	return data
+}
+
+func receiveEvent(t *testing.T, received <-chan receivedEvent) receivedEvent {
+	select {
+	case event := <-received:
+		return event
+	case <-time.After(time.Minute):
+		require.FailNow(t, "timed out waiting for the event")
+		return receivedEvent{}
+	}
+}
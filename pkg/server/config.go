@@ -10,9 +10,17 @@ import (
 	common "github.com/spiffe/spire/pkg/common/catalog"
 	"github.com/spiffe/spire/pkg/common/health"
 	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/server/api"
+	"github.com/spiffe/spire/pkg/server/api/middleware"
 	bundle_client "github.com/spiffe/spire/pkg/server/bundle/client"
+	"github.com/spiffe/spire/pkg/server/cache/dscache"
+	"github.com/spiffe/spire/pkg/server/cache/entrycache"
+	"github.com/spiffe/spire/pkg/server/cloudevents"
 	"github.com/spiffe/spire/pkg/server/endpoints"
+	"github.com/spiffe/spire/pkg/server/endpoints/admin"
 	"github.com/spiffe/spire/pkg/server/endpoints/bundle"
+	"github.com/spiffe/spire/pkg/server/lastseen"
+	"github.com/spiffe/spire/pkg/server/nodeevents"
 	"github.com/spiffe/spire/pkg/server/plugin/keymanager"
 )
 
@@ -39,6 +47,10 @@ type Config struct {
 
 	Experimental ExperimentalConfig
 
+	// FIPSMode restricts the TLS settings of the server endpoints to the
+	// FIPS approved ones
+	FIPSMode bool
+
 	// If true enables profiling.
 	ProfilingEnabled bool
 
@@ -58,10 +70,20 @@ type Config struct {
 	// self-signed CA certificates, otherwise it is up to the upstream CA.
 	CATTL time.Duration
 
+	// ClockSkewTolerance is how far the clocks of the server and of the
+	// agents and workloads may diverge. The SVIDs and self-signed CA
+	// certificates are backdated by it, so they are valid right away for
+	// nodes whose clock is behind.
+	ClockSkewTolerance time.Duration
+
 	// JWTIssuer is used as the issuer claim in JWT-SVIDs minted by the server.
 	// If unset, the JWT-SVID will not have an issuer claim.
 	JWTIssuer string
 
+	// JWTX5C includes the x5c header, i.e. the certificate chain of the JWT
+	// signing key issued by the server CA, in JWT-SVIDs minted by the server.
+	JWTX5C bool
+
 	// CASubject is the subject used in the CA certificate
 	CASubject pkix.Name
 
@@ -84,8 +106,49 @@ type Config struct {
 	// RateLimit holds rate limiting configurations.
 	RateLimit endpoints.RateLimitConfig
 
+	// DownstreamPolicy restricts which downstream workloads can call the
+	// downstream APIs
+	DownstreamPolicy middleware.DownstreamPolicy
+
+	// IDPolicy is enforced on the SPIFFE IDs of the created and updated
+	// entries
+	IDPolicy api.IDPolicy
+
+	// OwnershipPolicy restricts the updates and deletions of the entries to
+	// the callers that created them
+	OwnershipPolicy api.OwnershipPolicy
+
+	// EntryTemplates are instantiated as registration entries for each of
+	// the agents they match
+	EntryTemplates []*entrycache.Template
+
 	// CacheReloadInterval controls how often the in-memory entry cache reloads
 	CacheReloadInterval time.Duration
+
+	// DrainTimeout, if set, makes the server drain its API endpoints on
+	// shutdown, so the in-flight RPCs finish and the agents reconnect to
+	// other servers, waiting up to the timeout
+	DrainTimeout time.Duration
+
+	// NodeEventsWebhook, if set, configures the webhook notified when agents
+	// attest, are banned or are deleted
+	NodeEventsWebhook *nodeevents.WebhookConfig
+
+	// CloudEvents, if set, configures the publisher of the identity
+	// lifecycle events, published as CloudEvents to an HTTP sink
+	CloudEvents *cloudevents.Config
+
+	// AdminAPI, if set, configures the HTTP JSON API summarizing the state
+	// of the server for dashboards
+	AdminAPI *admin.EndpointConfig
+
+	// AgentLastSeen, if set, configures the tracking of when the agents were
+	// last seen syncing with the server, and the eviction of the agents
+	// silent for too long
+	AgentLastSeen *lastseen.Config
+
+	// DatastoreCache configures the in-process cache of datastore reads
+	DatastoreCache dscache.Config
 }
 
 type ExperimentalConfig struct {
@@ -0,0 +1,232 @@
+// Package backup takes portable snapshots of the datastore and restores them,
+// independently of the SQL backend the datastore uses.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/proto/spire/common"
+)
+
+const (
+	// attempts is how many times taking a snapshot is tried before giving
+	// up, when the datastore changes while it is read
+	attempts = 3
+
+	pageSize = 1000
+)
+
+var errChanged = errors.New("datastore changed while being read")
+
+// Snapshot is a snapshot of the datastore
+type Snapshot struct {
+	// TrustDomain is the trust domain of the server the snapshot was taken
+	// from
+	TrustDomain string
+	TakenAt     time.Time
+
+	Bundles []*common.Bundle
+	// Agents are the attested nodes of the agents, with their selectors
+	Agents  []*common.AttestedNode
+	Entries []*Entry
+
+	// CAJournal is the CA journal of the server, if any. It holds the X509
+	// CAs and JWT keys, but not their private keys, which are held by the
+	// KeyManager.
+	CAJournal []byte
+}
+
+// Entry is a registration entry
+type Entry struct {
+	Entry *common.RegistrationEntry
+	// Owner is who created the entry, if known
+	Owner string
+}
+
+// Take takes a snapshot of the datastore. The datastore is read one record
+// type after the other, so the snapshot is taken again if records were
+// created or deleted in the meantime, or if it has entries federating with
+// bundles it doesn't have.
+func Take(ctx context.Context, ds datastore.DataStore) (*Snapshot, error) {
+	for attempt := 1; ; attempt++ {
+		snapshot, err := take(ctx, ds)
+		switch {
+		case err == nil:
+			return snapshot, nil
+		case errors.Is(err, errChanged) && attempt < attempts:
+			continue
+		case errors.Is(err, errChanged):
+			return nil, fmt.Errorf("%w; stop the servers using the datastore to take a consistent snapshot", err)
+		default:
+			return nil, err
+		}
+	}
+}
+
+func take(ctx context.Context, ds datastore.DataStore) (*Snapshot, error) {
+	before, err := countRecords(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := new(Snapshot)
+	if snapshot.Bundles, err = listBundles(ctx, ds); err != nil {
+		return nil, err
+	}
+	if snapshot.Agents, err = listAgents(ctx, ds); err != nil {
+		return nil, err
+	}
+	if snapshot.Entries, err = listEntries(ctx, ds); err != nil {
+		return nil, err
+	}
+
+	after, err := countRecords(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+	if before != after {
+		return nil, errChanged
+	}
+
+	bundles := make(map[string]bool, len(snapshot.Bundles))
+	for _, bundle := range snapshot.Bundles {
+		bundles[bundle.TrustDomainId] = true
+	}
+	for _, entry := range snapshot.Entries {
+		for _, td := range entry.Entry.FederatesWith {
+			if !bundles[td] {
+				return nil, errChanged
+			}
+		}
+	}
+
+	return snapshot, nil
+}
+
+// Restore restores the snapshot into the datastore, which must be empty. The
+// entries keep their IDs and owners, but their revision history starts over,
+// and the agents count as seen when restored, so the time the servers were
+// down doesn't make them stale. The CA journal is not restored, since it is
+// not held by the datastore.
+func Restore(ctx context.Context, ds datastore.DataStore, snapshot *Snapshot) error {
+	counts, err := countRecords(ctx, ds)
+	if err != nil {
+		return err
+	}
+	if counts != (recordCounts{}) {
+		return fmt.Errorf("datastore is not empty: it has %d bundles, %d agents and %d entries", counts.bundles, counts.agents, counts.entries)
+	}
+
+	// Bundles first, since entries federate with them
+	for _, bundle := range snapshot.Bundles {
+		if _, err := ds.CreateBundle(ctx, bundle); err != nil {
+			return fmt.Errorf("unable to restore bundle %q: %w", bundle.TrustDomainId, err)
+		}
+	}
+
+	for _, node := range snapshot.Agents {
+		if _, err := ds.CreateAttestedNode(ctx, node); err != nil {
+			return fmt.Errorf("unable to restore agent %q: %w", node.SpiffeId, err)
+		}
+		if len(node.Selectors) > 0 {
+			if err := ds.SetNodeSelectors(ctx, node.SpiffeId, node.Selectors); err != nil {
+				return fmt.Errorf("unable to restore selectors of agent %q: %w", node.SpiffeId, err)
+			}
+		}
+	}
+
+	for _, entry := range snapshot.Entries {
+		if _, err := ds.CreateRegistrationEntry(datastore.WithChangedBy(ctx, entry.Owner), entry.Entry); err != nil {
+			return fmt.Errorf("unable to restore entry %q: %w", entry.Entry.EntryId, err)
+		}
+	}
+
+	return nil
+}
+
+type recordCounts struct {
+	bundles int32
+	agents  int32
+	entries int32
+}
+
+func countRecords(ctx context.Context, ds datastore.DataStore) (counts recordCounts, err error) {
+	if counts.bundles, err = ds.CountBundles(ctx); err != nil {
+		return recordCounts{}, fmt.Errorf("unable to count bundles: %w", err)
+	}
+	if counts.agents, err = ds.CountAttestedNodes(ctx); err != nil {
+		return recordCounts{}, fmt.Errorf("unable to count agents: %w", err)
+	}
+	if counts.entries, err = ds.CountRegistrationEntries(ctx); err != nil {
+		return recordCounts{}, fmt.Errorf("unable to count entries: %w", err)
+	}
+	return counts, nil
+}
+
+func listBundles(ctx context.Context, ds datastore.DataStore) ([]*common.Bundle, error) {
+	req := &datastore.ListBundlesRequest{
+		Pagination: &datastore.Pagination{PageSize: pageSize},
+	}
+
+	var bundles []*common.Bundle
+	for {
+		resp, err := ds.ListBundles(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list bundles: %w", err)
+		}
+		bundles = append(bundles, resp.Bundles...)
+		if len(resp.Bundles) == 0 || resp.Pagination == nil || resp.Pagination.Token == "" {
+			return bundles, nil
+		}
+		req.Pagination.Token = resp.Pagination.Token
+	}
+}
+
+func listAgents(ctx context.Context, ds datastore.DataStore) ([]*common.AttestedNode, error) {
+	req := &datastore.ListAttestedNodesRequest{
+		FetchSelectors: true,
+		Pagination:     &datastore.Pagination{PageSize: pageSize},
+	}
+
+	var agents []*common.AttestedNode
+	for {
+		resp, err := ds.ListAttestedNodes(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list agents: %w", err)
+		}
+		agents = append(agents, resp.Nodes...)
+		if len(resp.Nodes) == 0 || resp.Pagination == nil || resp.Pagination.Token == "" {
+			return agents, nil
+		}
+		req.Pagination.Token = resp.Pagination.Token
+	}
+}
+
+func listEntries(ctx context.Context, ds datastore.DataStore) ([]*Entry, error) {
+	req := &datastore.ListRegistrationEntriesRequest{
+		Pagination: &datastore.Pagination{PageSize: pageSize},
+	}
+
+	var entries []*Entry
+	for {
+		resp, err := ds.ListRegistrationEntries(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list entries: %w", err)
+		}
+		for _, entry := range resp.Entries {
+			owner, err := ds.FetchRegistrationEntryOwner(ctx, entry.EntryId)
+			if err != nil {
+				return nil, fmt.Errorf("unable to fetch owner of entry %q: %w", entry.EntryId, err)
+			}
+			entries = append(entries, &Entry{Entry: entry, Owner: owner})
+		}
+		if len(resp.Entries) == 0 || resp.Pagination == nil || resp.Pagination.Token == "" {
+			return entries, nil
+		}
+		req.Pagination.Token = resp.Pagination.Token
+	}
+}
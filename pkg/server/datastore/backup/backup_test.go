@@ -0,0 +1,151 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/common/bundleutil"
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/spiffe/spire/test/fakes/fakedatastore"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/spiffe/spire/test/testca"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+func TestBackupAndRestore(t *testing.T) {
+	ds := fakedatastore.New(t)
+	populate(t, ds)
+
+	snapshot, err := Take(ctx, ds)
+	require.NoError(t, err)
+	require.Len(t, snapshot.Bundles, 2)
+	require.Len(t, snapshot.Agents, 2)
+	require.Len(t, snapshot.Entries, 2)
+
+	snapshot.TrustDomain = "example.org"
+	snapshot.TakenAt = time.Unix(1700000000, 0).UTC()
+	snapshot.CAJournal = []byte("journal")
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, snapshot))
+	read, err := Read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "example.org", read.TrustDomain)
+	assert.Equal(t, snapshot.TakenAt, read.TakenAt)
+	assert.Equal(t, []byte("journal"), read.CAJournal)
+	assertSameRecords(t, snapshot, read)
+
+	restored := fakedatastore.New(t)
+	require.NoError(t, Restore(ctx, restored, read))
+	again, err := Take(ctx, restored)
+	require.NoError(t, err)
+	assertSameRecords(t, snapshot, again)
+
+	// Restoring again fails since the datastore is not empty
+	err = Restore(ctx, restored, read)
+	require.EqualError(t, err, "datastore is not empty: it has 2 bundles, 2 agents and 2 entries")
+}
+
+func TestTakeFailure(t *testing.T) {
+	ds := fakedatastore.New(t)
+	ds.SetNextError(errors.New("oops"))
+
+	_, err := Take(ctx, ds)
+	require.EqualError(t, err, "unable to count bundles: oops")
+}
+
+func TestRead(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		data      string
+		expectErr string
+	}{
+		{
+			name:      "not JSON",
+			data:      "not JSON",
+			expectErr: "unable to decode snapshot: invalid character 'o' in literal null (expecting 'u')",
+		},
+		{
+			name:      "unsupported version",
+			data:      `{"version": 2}`,
+			expectErr: "unsupported snapshot version 2",
+		},
+		{
+			name:      "unknown entry field",
+			data:      `{"version": 1, "entries": [{"entry": {"spiffeId": "spiffe://example.org/foo", "newField": true}}]}`,
+			expectErr: "unable to decode entry 0: ",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tt.data))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectErr)
+		})
+	}
+}
+
+func populate(t *testing.T, ds datastore.DataStore) {
+	for _, td := range []string{"example.org", "federated.test"} {
+		ca := testca.New(t, spiffeid.RequireTrustDomainFromString(td))
+		_, err := ds.CreateBundle(ctx, bundleutil.BundleProtoFromRootCA("spiffe://"+td, ca.X509Authorities()[0]))
+		require.NoError(t, err)
+	}
+
+	for _, node := range []*common.AttestedNode{
+		{
+			SpiffeId:            "spiffe://example.org/spire/agent/test/attested",
+			AttestationDataType: "test",
+			CertSerialNumber:    "1",
+			CertNotAfter:        time.Now().Add(time.Hour).Unix(),
+			Selectors:           []*common.Selector{{Type: "test", Value: "cluster:prod"}},
+		},
+		// Banned agents are backed up too, so they stay banned
+		{
+			SpiffeId:            "spiffe://example.org/spire/agent/test/banned",
+			AttestationDataType: "test",
+		},
+	} {
+		_, err := ds.CreateAttestedNode(ctx, node)
+		require.NoError(t, err)
+		if len(node.Selectors) > 0 {
+			require.NoError(t, ds.SetNodeSelectors(ctx, node.SpiffeId, node.Selectors))
+		}
+	}
+
+	_, err := ds.CreateRegistrationEntry(datastore.WithChangedBy(ctx, "spiffe://example.org/operator"), &common.RegistrationEntry{
+		SpiffeId:      "spiffe://example.org/web",
+		ParentId:      "spiffe://example.org/spire/agent/test/attested",
+		Selectors:     []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+		FederatesWith: []string{"spiffe://federated.test"},
+		DnsNames:      []string{"web.example.org"},
+		Ttl:           60,
+	})
+	require.NoError(t, err)
+	_, err = ds.CreateRegistrationEntry(ctx, &common.RegistrationEntry{
+		SpiffeId:  "spiffe://example.org/db",
+		ParentId:  "spiffe://example.org/spire/agent/test/attested",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1001"}},
+		Admin:     true,
+	})
+	require.NoError(t, err)
+}
+
+func assertSameRecords(t *testing.T, expected, actual *Snapshot) {
+	spiretest.AssertProtoListEqual(t, expected.Bundles, actual.Bundles)
+	spiretest.AssertProtoListEqual(t, expected.Agents, actual.Agents)
+	require.Len(t, actual.Entries, len(expected.Entries))
+	for i, entry := range expected.Entries {
+		spiretest.AssertProtoEqual(t, entry.Entry, actual.Entries[i].Entry)
+		assert.Equal(t, entry.Owner, actual.Entries[i].Owner)
+	}
+}
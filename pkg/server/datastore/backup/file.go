@@ -0,0 +1,109 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spiffe/spire/proto/spire/common"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// formatVersion is the version of the snapshot file format
+const formatVersion = 1
+
+// snapshotFile is the JSON encoding of a snapshot. The records are encoded
+// with the canonical JSON mapping of their protocol buffers, so snapshots
+// can be inspected and don't depend on the SQL schema.
+type snapshotFile struct {
+	Version     int               `json:"version"`
+	TrustDomain string            `json:"trust_domain"`
+	TakenAt     time.Time         `json:"taken_at"`
+	Bundles     []json.RawMessage `json:"bundles"`
+	Agents      []json.RawMessage `json:"agents"`
+	Entries     []entryRecord     `json:"entries"`
+	CAJournal   []byte            `json:"ca_journal,omitempty"`
+}
+
+type entryRecord struct {
+	Entry json.RawMessage `json:"entry"`
+	Owner string          `json:"owner,omitempty"`
+}
+
+// Write writes the snapshot to w
+func Write(w io.Writer, snapshot *Snapshot) error {
+	file := snapshotFile{
+		Version:     formatVersion,
+		TrustDomain: snapshot.TrustDomain,
+		TakenAt:     snapshot.TakenAt.UTC(),
+		Bundles:     make([]json.RawMessage, 0, len(snapshot.Bundles)),
+		Agents:      make([]json.RawMessage, 0, len(snapshot.Agents)),
+		Entries:     make([]entryRecord, 0, len(snapshot.Entries)),
+		CAJournal:   snapshot.CAJournal,
+	}
+	for _, bundle := range snapshot.Bundles {
+		data, err := protojson.Marshal(bundle)
+		if err != nil {
+			return fmt.Errorf("unable to encode bundle %q: %w", bundle.TrustDomainId, err)
+		}
+		file.Bundles = append(file.Bundles, data)
+	}
+	for _, node := range snapshot.Agents {
+		data, err := protojson.Marshal(node)
+		if err != nil {
+			return fmt.Errorf("unable to encode agent %q: %w", node.SpiffeId, err)
+		}
+		file.Agents = append(file.Agents, data)
+	}
+	for _, entry := range snapshot.Entries {
+		data, err := protojson.Marshal(entry.Entry)
+		if err != nil {
+			return fmt.Errorf("unable to encode entry %q: %w", entry.Entry.EntryId, err)
+		}
+		file.Entries = append(file.Entries, entryRecord{Entry: data, Owner: entry.Owner})
+	}
+
+	return json.NewEncoder(w).Encode(file)
+}
+
+// Read reads a snapshot written by Write from r
+func Read(r io.Reader) (*Snapshot, error) {
+	var file snapshotFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("unable to decode snapshot: %w", err)
+	}
+	if file.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", file.Version)
+	}
+
+	snapshot := &Snapshot{
+		TrustDomain: file.TrustDomain,
+		TakenAt:     file.TakenAt,
+		CAJournal:   file.CAJournal,
+	}
+	// Unknown fields are rejected rather than dropped, so restoring a
+	// snapshot written by a newer server fails instead of losing data
+	for i, data := range file.Bundles {
+		bundle := new(common.Bundle)
+		if err := protojson.Unmarshal(data, bundle); err != nil {
+			return nil, fmt.Errorf("unable to decode bundle %d: %w", i, err)
+		}
+		snapshot.Bundles = append(snapshot.Bundles, bundle)
+	}
+	for i, data := range file.Agents {
+		node := new(common.AttestedNode)
+		if err := protojson.Unmarshal(data, node); err != nil {
+			return nil, fmt.Errorf("unable to decode agent %d: %w", i, err)
+		}
+		snapshot.Agents = append(snapshot.Agents, node)
+	}
+	for i, record := range file.Entries {
+		entry := new(common.RegistrationEntry)
+		if err := protojson.Unmarshal(record.Entry, entry); err != nil {
+			return nil, fmt.Errorf("unable to decode entry %d: %w", i, err)
+		}
+		snapshot.Entries = append(snapshot.Entries, &Entry{Entry: entry, Owner: record.Owner})
+	}
+	return snapshot, nil
+}
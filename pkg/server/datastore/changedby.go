@@ -0,0 +1,23 @@
+package datastore
+
+import "context"
+
+// ChangedByLocal identifies the changes made by the callers of the local
+// APIs, e.g. the operators using the CLI
+const ChangedByLocal = "local"
+
+type changedByKey struct{}
+
+// WithChangedBy returns a context that identifies who makes the changes done
+// with it, e.g. the SPIFFE ID of the caller of an API. It is recorded in the
+// revision history of the registration entries, and as the owner of the
+// registration entries created with it.
+func WithChangedBy(ctx context.Context, changedBy string) context.Context {
+	return context.WithValue(ctx, changedByKey{}, changedBy)
+}
+
+// ChangedBy returns who makes the changes done with the context, if known.
+func ChangedBy(ctx context.Context) string {
+	changedBy, _ := ctx.Value(changedByKey{}).(string)
+	return changedBy
+}
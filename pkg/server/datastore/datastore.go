@@ -25,7 +25,9 @@ type DataStore interface {
 	CreateRegistrationEntry(context.Context, *common.RegistrationEntry) (*common.RegistrationEntry, error)
 	DeleteRegistrationEntry(ctx context.Context, entryID string) (*common.RegistrationEntry, error)
 	FetchRegistrationEntry(ctx context.Context, entryID string) (*common.RegistrationEntry, error)
+	FetchRegistrationEntryOwner(ctx context.Context, entryID string) (string, error)
 	ListRegistrationEntries(context.Context, *ListRegistrationEntriesRequest) (*ListRegistrationEntriesResponse, error)
+	ListRegistrationEntryRevisions(ctx context.Context, entryID string) ([]*RegistrationEntryRevision, error)
 	PruneRegistrationEntries(ctx context.Context, expiresBefore time.Time) error
 	UpdateRegistrationEntry(context.Context, *common.RegistrationEntry, *common.RegistrationEntryMask) (*common.RegistrationEntry, error)
 
@@ -35,6 +37,8 @@ type DataStore interface {
 	DeleteAttestedNode(ctx context.Context, spiffeID string) (*common.AttestedNode, error)
 	FetchAttestedNode(ctx context.Context, spiffeID string) (*common.AttestedNode, error)
 	ListAttestedNodes(context.Context, *ListAttestedNodesRequest) (*ListAttestedNodesResponse, error)
+	ListNodesLastSeen(context.Context) (map[string]time.Time, error)
+	SetNodeLastSeen(ctx context.Context, spiffeID string, lastSeen time.Time) error
 	UpdateAttestedNode(context.Context, *common.AttestedNode, *common.AttestedNodeMask) (*common.AttestedNode, error)
 
 	// Node selectors
@@ -156,9 +160,34 @@ type ListRegistrationEntriesRequest struct {
 	BySpiffeID      string
 	Pagination      *Pagination
 	ByFederatesWith *ByFederatesWith
+	// ByProvenance lists the entries created with the provenance, i.e. by the
+	// registrar for the workloads of a cluster, namespace or pod
+	ByProvenance *Provenance
 }
 
 type ListRegistrationEntriesResponse struct {
 	Entries    []*common.RegistrationEntry
 	Pagination *Pagination
 }
+
+// RegistrationEntryAction is the change to a registration entry that
+// produced a revision
+type RegistrationEntryAction string
+
+const (
+	RegistrationEntryCreated RegistrationEntryAction = "create"
+	RegistrationEntryUpdated RegistrationEntryAction = "update"
+	RegistrationEntryDeleted RegistrationEntryAction = "delete"
+)
+
+// RegistrationEntryRevision is a revision of a registration entry, recorded
+// when the entry was changed
+type RegistrationEntryRevision struct {
+	// Revision is the revision number of the entry after the change
+	Revision  int64
+	Action    RegistrationEntryAction
+	ChangedBy string
+	ChangedAt time.Time
+	// Entry is the entry as of the revision
+	Entry *common.RegistrationEntry
+}
@@ -0,0 +1,33 @@
+package datastore
+
+import "context"
+
+// Provenance describes where a registration entry comes from, i.e. the
+// Kubernetes cluster, namespace and pod of the workload the registrar created
+// it for. As a filter, the fields that are not set match any value.
+type Provenance struct {
+	Cluster   string
+	Namespace string
+	Pod       string
+}
+
+// IsZero returns whether none of the fields is set
+func (p Provenance) IsZero() bool {
+	return p == Provenance{}
+}
+
+type provenanceKey struct{}
+
+// WithProvenance returns a context that describes where the registration
+// entries created with it come from. It is recorded with the registration
+// entries, which can then be listed by it.
+func WithProvenance(ctx context.Context, provenance Provenance) context.Context {
+	return context.WithValue(ctx, provenanceKey{}, provenance)
+}
+
+// ProvenanceFromContext returns where the registration entries created with
+// the context come from, if known.
+func ProvenanceFromContext(ctx context.Context) Provenance {
+	provenance, _ := ctx.Value(provenanceKey{}).(Provenance)
+	return provenance
+}
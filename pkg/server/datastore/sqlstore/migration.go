@@ -19,7 +19,7 @@ import (
 
 const (
 	// the latest schema version of the database in the code
-	latestSchemaVersion = 17
+	latestSchemaVersion = 21
 )
 
 var (
@@ -191,6 +191,7 @@ func initDB(db *gorm.DB, dbType string, log logrus.FieldLogger) (err error) {
 		&Migration{},
 		&DNSName{},
 		&FederatedTrustDomain{},
+		&RegisteredEntryRevision{},
 	}
 
 	if err := tableOptionsForDialect(tx, dbType).AutoMigrate(tables...).Error; err != nil {
@@ -252,6 +253,10 @@ func migrateVersion(tx *gorm.DB, currVersion int, log logrus.FieldLogger) (versi
 		migrateToV15,
 		migrateToV16,
 		migrateToV17,
+		migrateToV18,
+		migrateToV19,
+		migrateToV20,
+		migrateToV21,
 	}
 
 	if currVersion >= len(migrations) {
@@ -504,6 +509,34 @@ func migrateToV17(tx *gorm.DB) error {
 	return nil
 }
 
+func migrateToV18(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&RegisteredEntryRevision{}).Error; err != nil {
+		return sqlError.Wrap(err)
+	}
+	return nil
+}
+
+func migrateToV19(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&RegisteredEntry{}).Error; err != nil {
+		return sqlError.Wrap(err)
+	}
+	return nil
+}
+
+func migrateToV20(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&AttestedNode{}).Error; err != nil {
+		return sqlError.Wrap(err)
+	}
+	return nil
+}
+
+func migrateToV21(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&RegisteredEntry{}).Error; err != nil {
+		return sqlError.Wrap(err)
+	}
+	return nil
+}
+
 func addFederatedRegistrationEntriesRegisteredEntryIDIndex(tx *gorm.DB) error {
 	// GORM creates the federated_registration_entries implicitly with a primary
 	// key tuple (bundle_id, registered_entry_id). Unfortunately, MySQL5 does
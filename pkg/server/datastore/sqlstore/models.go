@@ -33,6 +33,10 @@ type AttestedNode struct {
 	NewSerialNumber string
 	NewExpiresAt    *time.Time
 
+	// LastSeen is when the node was last seen syncing with the server, if
+	// recorded
+	LastSeen *time.Time
+
 	Selectors []*NodeSelector
 }
 
@@ -92,6 +96,16 @@ type RegisteredEntry struct {
 
 	// StoreSvid determines if the issued SVID is exportable to a store
 	StoreSvid bool
+
+	// Owner identifies who created the entry, if known
+	Owner string
+
+	// ProvenanceCluster, ProvenanceNamespace and ProvenancePod describe where
+	// the entry comes from, if known, e.g. the workload the registrar created
+	// it for
+	ProvenanceCluster   string `gorm:"index:idx_registered_entries_provenance"`
+	ProvenanceNamespace string `gorm:"index:idx_registered_entries_provenance"`
+	ProvenancePod       string
 }
 
 // JoinToken holds a join token
@@ -154,6 +168,33 @@ func (FederatedTrustDomain) TableName() string {
 	return "federated_trust_domains"
 }
 
+// RegisteredEntryRevision holds a revision of a registration entry, recorded
+// when the entry is created, updated or deleted
+type RegisteredEntryRevision struct {
+	Model
+
+	EntryID string `gorm:"index"`
+
+	// RevisionNumber is the revision number of the entry after the change
+	RevisionNumber int64
+
+	// Action is the change that produced the revision (create, update or
+	// delete)
+	Action string
+
+	// ChangedBy identifies who made the change, if known
+	ChangedBy string
+
+	// Data is the entry as of the revision, as a marshaled
+	// common.RegistrationEntry
+	Data []byte `gorm:"size:16777215"` // make MySQL to use MEDIUMBLOB (max 16MB) - doesn't affect PostgreSQL/SQLite
+}
+
+// TableName gets table name of RegisteredEntryRevision
+func (RegisteredEntryRevision) TableName() string {
+	return "registered_entry_revisions"
+}
+
 // Migration holds database schema version number, and
 // the SPIRE Code version number
 type Migration struct {
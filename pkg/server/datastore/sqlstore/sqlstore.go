@@ -41,6 +41,10 @@ const (
 	PostgreSQL = "postgres"
 	// SQLite database type
 	SQLite = "sqlite3"
+
+	// maxRegistrationEntryRevisions is how many revisions of each
+	// registration entry are kept in the revision history
+	maxRegistrationEntryRevisions = 10
 )
 
 // Configuration for the sql datastore implementation.
@@ -268,6 +272,27 @@ func (ds *Plugin) DeleteAttestedNode(ctx context.Context, spiffeID string) (atte
 	return attestedNode, nil
 }
 
+// SetNodeLastSeen records when the attested node was last seen syncing with
+// the server. It is a no-op if the node does not exist.
+func (ds *Plugin) SetNodeLastSeen(ctx context.Context, spiffeID string, lastSeen time.Time) (err error) {
+	return ds.withWriteTx(ctx, func(tx *gorm.DB) (err error) {
+		return setNodeLastSeen(tx, spiffeID, lastSeen)
+	})
+}
+
+// ListNodesLastSeen lists when the attested nodes were last seen syncing with
+// the server, by SPIFFE ID. A node last updated, e.g. attested or renewed,
+// after it was last seen is reported as seen when it was last updated.
+func (ds *Plugin) ListNodesLastSeen(ctx context.Context) (lastSeen map[string]time.Time, err error) {
+	if err = ds.withReadTx(ctx, func(tx *gorm.DB) (err error) {
+		lastSeen, err = listNodesLastSeen(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return lastSeen, nil
+}
+
 // SetNodeSelectors sets node (agent) selectors by SPIFFE ID, deleting old selectors first
 func (ds *Plugin) SetNodeSelectors(ctx context.Context, spiffeID string, selectors []*common.Selector) (err error) {
 	return ds.withWriteTx(ctx, func(tx *gorm.DB) (err error) {
@@ -303,8 +328,11 @@ func (ds *Plugin) CreateRegistrationEntry(ctx context.Context,
 	}
 
 	if err = ds.withWriteTx(ctx, func(tx *gorm.DB) (err error) {
-		registrationEntry, err = createRegistrationEntry(tx, entry)
-		return err
+		registrationEntry, err = createRegistrationEntry(tx, entry, datastore.ChangedBy(ctx), datastore.ProvenanceFromContext(ctx))
+		if err != nil {
+			return err
+		}
+		return recordRegistrationEntryRevision(tx, datastore.RegistrationEntryCreated, datastore.ChangedBy(ctx), registrationEntry)
 	}); err != nil {
 		return nil, err
 	}
@@ -317,6 +345,20 @@ func (ds *Plugin) FetchRegistrationEntry(ctx context.Context,
 	return fetchRegistrationEntry(ctx, ds.db, entryID)
 }
 
+// FetchRegistrationEntryOwner fetches who created an existing registration
+// entry. It returns an empty string if the owner is unknown, e.g. for the
+// entries created before owners were recorded, or if the entry does not
+// exist.
+func (ds *Plugin) FetchRegistrationEntryOwner(ctx context.Context, entryID string) (owner string, err error) {
+	if err = ds.withReadTx(ctx, func(tx *gorm.DB) (err error) {
+		owner, err = fetchRegistrationEntryOwner(tx, entryID)
+		return err
+	}); err != nil {
+		return "", err
+	}
+	return owner, nil
+}
+
 // CounCountRegistrationEntries counts all registrations (pagination available)
 func (ds *Plugin) CountRegistrationEntries(ctx context.Context) (count int32, err error) {
 	if err = ds.withReadTx(ctx, func(tx *gorm.DB) (err error) {
@@ -338,11 +380,26 @@ func (ds *Plugin) ListRegistrationEntries(ctx context.Context,
 	return listRegistrationEntries(ctx, ds.db, ds.log, req)
 }
 
+// ListRegistrationEntryRevisions lists the recorded revisions of a
+// registration entry, oldest first
+func (ds *Plugin) ListRegistrationEntryRevisions(ctx context.Context, entryID string) (revisions []*datastore.RegistrationEntryRevision, err error) {
+	if err = ds.withReadTx(ctx, func(tx *gorm.DB) (err error) {
+		revisions, err = listRegistrationEntryRevisions(tx, entryID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
 // UpdateRegistrationEntry updates an existing registration entry
 func (ds *Plugin) UpdateRegistrationEntry(ctx context.Context, e *common.RegistrationEntry, mask *common.RegistrationEntryMask) (entry *common.RegistrationEntry, err error) {
 	if err = ds.withReadModifyWriteTx(ctx, func(tx *gorm.DB) (err error) {
 		entry, err = updateRegistrationEntry(tx, e, mask)
-		return err
+		if err != nil {
+			return err
+		}
+		return recordRegistrationEntryRevision(tx, datastore.RegistrationEntryUpdated, datastore.ChangedBy(ctx), entry)
 	}); err != nil {
 		return nil, err
 	}
@@ -354,7 +411,10 @@ func (ds *Plugin) DeleteRegistrationEntry(ctx context.Context,
 	entryID string) (registrationEntry *common.RegistrationEntry, err error) {
 	if err = ds.withWriteTx(ctx, func(tx *gorm.DB) (err error) {
 		registrationEntry, err = deleteRegistrationEntry(tx, entryID)
-		return err
+		if err != nil {
+			return err
+		}
+		return recordRegistrationEntryRevision(tx, datastore.RegistrationEntryDeleted, datastore.ChangedBy(ctx), registrationEntry)
 	}); err != nil {
 		return nil, err
 	}
@@ -365,7 +425,7 @@ func (ds *Plugin) DeleteRegistrationEntry(ctx context.Context,
 // before the date in the message
 func (ds *Plugin) PruneRegistrationEntries(ctx context.Context, expiresBefore time.Time) (err error) {
 	return ds.withWriteTx(ctx, func(tx *gorm.DB) (err error) {
-		err = pruneRegistrationEntries(tx, expiresBefore)
+		err = pruneRegistrationEntries(tx, expiresBefore, datastore.ChangedBy(ctx))
 		return err
 	})
 }
@@ -1518,6 +1578,32 @@ func deleteAttestedNode(tx *gorm.DB, spiffeID string) (*common.AttestedNode, err
 	return modelToAttestedNode(model), nil
 }
 
+func setNodeLastSeen(tx *gorm.DB, spiffeID string, lastSeen time.Time) error {
+	// UpdateColumn leaves updated_at as is, so that it keeps telling when the
+	// node was last attested or renewed
+	if err := tx.Model(&AttestedNode{}).Where("spiffe_id = ?", spiffeID).UpdateColumn("last_seen", lastSeen).Error; err != nil {
+		return sqlError.Wrap(err)
+	}
+	return nil
+}
+
+func listNodesLastSeen(tx *gorm.DB) (map[string]time.Time, error) {
+	var models []AttestedNode
+	if err := tx.Select("spiffe_id, updated_at, last_seen").Find(&models).Error; err != nil {
+		return nil, sqlError.Wrap(err)
+	}
+
+	lastSeen := make(map[string]time.Time, len(models))
+	for _, model := range models {
+		seen := model.UpdatedAt
+		if model.LastSeen != nil && model.LastSeen.After(seen) {
+			seen = *model.LastSeen
+		}
+		lastSeen[model.SpiffeID] = seen
+	}
+	return lastSeen, nil
+}
+
 func setNodeSelectors(tx *gorm.DB, spiffeID string, selectors []*common.Selector) error {
 	// Previously the deletion of the previous set of node selectors was
 	// implemented via query like DELETE FROM node_resolver_map_entries WHERE
@@ -1649,10 +1735,15 @@ func buildListNodeSelectorsQuery(req *datastore.ListNodeSelectorsRequest) (query
 	return sb.String(), args
 }
 
-func createRegistrationEntry(tx *gorm.DB, entry *common.RegistrationEntry) (*common.RegistrationEntry, error) {
-	entryID, err := newRegistrationEntryID()
-	if err != nil {
-		return nil, err
+func createRegistrationEntry(tx *gorm.DB, entry *common.RegistrationEntry, owner string, provenance datastore.Provenance) (*common.RegistrationEntry, error) {
+	// The entry keeps its ID if it has one, e.g. when restored from a backup
+	entryID := entry.EntryId
+	if entryID == "" {
+		var err error
+		entryID, err = newRegistrationEntryID()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	newRegisteredEntry := RegisteredEntry{
@@ -1663,6 +1754,11 @@ func createRegistrationEntry(tx *gorm.DB, entry *common.RegistrationEntry) (*com
 		Admin:      entry.Admin,
 		Downstream: entry.Downstream,
 		Expiry:     entry.EntryExpiry,
+		Owner:      owner,
+
+		ProvenanceCluster:   provenance.Cluster,
+		ProvenanceNamespace: provenance.Namespace,
+		ProvenancePod:       provenance.Pod,
 	}
 
 	if err := tx.Create(&newRegisteredEntry).Error; err != nil {
@@ -1989,6 +2085,9 @@ func listRegistrationEntries(ctx context.Context, db *sqlDB, log logrus.FieldLog
 	if req.BySelectors != nil && len(req.BySelectors.Selectors) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "cannot list by empty selector set")
 	}
+	if req.ByProvenance != nil && req.ByProvenance.IsZero() {
+		return nil, status.Error(codes.InvalidArgument, "cannot list by empty provenance")
+	}
 
 	// Exact/subset selector matching requires filtering out all registration
 	// entries returned by the query whose selectors are not fully represented
@@ -2699,6 +2798,30 @@ func appendListRegistrationEntriesFilterQuery(filterExp string, builder *strings
 		root.children = append(root.children, filterNode)
 	}
 
+	if req.ByProvenance != nil {
+		subquery := new(strings.Builder)
+		subquery.WriteString("SELECT id AS e_id FROM registered_entries WHERE ")
+		conditions := 0
+		addCondition := func(column, value string) {
+			if value == "" {
+				return
+			}
+			if conditions > 0 {
+				subquery.WriteString(" AND ")
+			}
+			subquery.WriteString(column + " = ?")
+			args = append(args, value)
+			conditions++
+		}
+		addCondition("provenance_cluster", req.ByProvenance.Cluster)
+		addCondition("provenance_namespace", req.ByProvenance.Namespace)
+		addCondition("provenance_pod", req.ByProvenance.Pod)
+		root.children = append(root.children, idFilterNode{
+			idColumn: "id",
+			query:    []string{subquery.String()},
+		})
+	}
+
 	filtered := false
 	filter := func() {
 		if !filtered {
@@ -3087,21 +3210,94 @@ func deleteRegistrationEntrySupport(tx *gorm.DB, entry RegisteredEntry) error {
 	return nil
 }
 
-func pruneRegistrationEntries(tx *gorm.DB, expiresBefore time.Time) error {
+func pruneRegistrationEntries(tx *gorm.DB, expiresBefore time.Time, changedBy string) error {
 	var registrationEntries []RegisteredEntry
 	if err := tx.Where("expiry != 0").Where("expiry < ?", expiresBefore.Unix()).Find(&registrationEntries).Error; err != nil {
 		return err
 	}
 
 	for _, entry := range registrationEntries {
+		registrationEntry, err := modelToEntry(tx, entry)
+		if err != nil {
+			return err
+		}
 		if err := deleteRegistrationEntrySupport(tx, entry); err != nil {
 			return err
 		}
+		if err := recordRegistrationEntryRevision(tx, datastore.RegistrationEntryDeleted, changedBy, registrationEntry); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+func recordRegistrationEntryRevision(tx *gorm.DB, action datastore.RegistrationEntryAction, changedBy string, entry *common.RegistrationEntry) error {
+	data, err := proto.Marshal(entry)
+	if err != nil {
+		return sqlError.Wrap(err)
+	}
+
+	revision := RegisteredEntryRevision{
+		EntryID:        entry.EntryId,
+		RevisionNumber: entry.RevisionNumber,
+		Action:         string(action),
+		ChangedBy:      changedBy,
+		Data:           data,
+	}
+	if err := tx.Create(&revision).Error; err != nil {
+		return sqlError.Wrap(err)
+	}
+
+	// Prune the oldest revisions of the entry past the bound
+	var revisionIDs []uint
+	if err := tx.Model(&RegisteredEntryRevision{}).Where("entry_id = ?", entry.EntryId).Order("id DESC").Pluck("id", &revisionIDs).Error; err != nil {
+		return sqlError.Wrap(err)
+	}
+	if len(revisionIDs) > maxRegistrationEntryRevisions {
+		if err := tx.Where("id IN (?)", revisionIDs[maxRegistrationEntryRevisions:]).Delete(&RegisteredEntryRevision{}).Error; err != nil {
+			return sqlError.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func fetchRegistrationEntryOwner(tx *gorm.DB, entryID string) (string, error) {
+	var model RegisteredEntry
+	err := tx.Select("owner").Find(&model, "entry_id = ?", entryID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", sqlError.Wrap(err)
+	}
+	return model.Owner, nil
+}
+
+func listRegistrationEntryRevisions(tx *gorm.DB, entryID string) ([]*datastore.RegistrationEntryRevision, error) {
+	var models []RegisteredEntryRevision
+	if err := tx.Where("entry_id = ?", entryID).Order("id ASC").Find(&models).Error; err != nil {
+		return nil, sqlError.Wrap(err)
+	}
+
+	revisions := make([]*datastore.RegistrationEntryRevision, 0, len(models))
+	for _, model := range models {
+		entry := new(common.RegistrationEntry)
+		if err := proto.Unmarshal(model.Data, entry); err != nil {
+			return nil, sqlError.Wrap(err)
+		}
+		revisions = append(revisions, &datastore.RegistrationEntryRevision{
+			Revision:  model.RevisionNumber,
+			Action:    datastore.RegistrationEntryAction(model.Action),
+			ChangedBy: model.ChangedBy,
+			ChangedAt: model.CreatedAt,
+			Entry:     entry,
+		})
+	}
+
+	return revisions, nil
+}
+
 func createJoinToken(tx *gorm.DB, token *datastore.JoinToken) error {
 	t := JoinToken{
 		Token:  token.Token,
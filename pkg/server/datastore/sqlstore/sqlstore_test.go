@@ -1091,6 +1091,46 @@ func (s *PluginSuite) TestDeleteAttestedNode() {
 	s.Nil(attestedNode)
 }
 
+func (s *PluginSuite) TestNodeLastSeen() {
+	for _, id := range []string{"spiffe://example.org/seen", "spiffe://example.org/not-seen", "spiffe://example.org/renewed"} {
+		_, err := s.ds.CreateAttestedNode(ctx, &common.AttestedNode{
+			SpiffeId:            id,
+			AttestationDataType: "aws-tag",
+			CertSerialNumber:    "badcafe",
+			CertNotAfter:        time.Now().Add(time.Hour).Unix(),
+		})
+		s.Require().NoError(err)
+	}
+	now := time.Now()
+
+	// Recording when unknown nodes are seen is a no-op
+	s.Require().NoError(s.ds.SetNodeLastSeen(ctx, "spiffe://example.org/unknown", now))
+
+	seen := now.Add(time.Hour)
+	s.Require().NoError(s.ds.SetNodeLastSeen(ctx, "spiffe://example.org/seen", seen))
+	// Nodes updated after they were last seen are reported as seen when
+	// they were last updated
+	s.Require().NoError(s.ds.SetNodeLastSeen(ctx, "spiffe://example.org/renewed", now.Add(-time.Hour)))
+
+	lastSeen, err := s.ds.ListNodesLastSeen(ctx)
+	s.Require().NoError(err)
+	s.Require().Len(lastSeen, 3)
+	s.Require().WithinDuration(seen, lastSeen["spiffe://example.org/seen"], time.Second)
+	s.Require().WithinDuration(now, lastSeen["spiffe://example.org/not-seen"], time.Minute)
+	s.Require().WithinDuration(now, lastSeen["spiffe://example.org/renewed"], time.Minute)
+
+	// Recording when nodes are seen does not change the nodes
+	node, err := s.ds.FetchAttestedNode(ctx, "spiffe://example.org/seen")
+	s.Require().NoError(err)
+	s.Require().Equal("badcafe", node.CertSerialNumber)
+
+	_, err = s.ds.DeleteAttestedNode(ctx, "spiffe://example.org/seen")
+	s.Require().NoError(err)
+	lastSeen, err = s.ds.ListNodesLastSeen(ctx)
+	s.Require().NoError(err)
+	s.Require().Len(lastSeen, 2)
+}
+
 func (s *PluginSuite) TestNodeSelectors() {
 	foo1 := []*common.Selector{
 		{Type: "FOO1", Value: "1"},
@@ -1279,6 +1319,30 @@ func (s *PluginSuite) TestCreateRegistrationEntry() {
 	}
 }
 
+func (s *PluginSuite) TestCreateRegistrationEntryWithID() {
+	entry, err := s.ds.CreateRegistrationEntry(ctx, &common.RegistrationEntry{
+		EntryId:   "restored-entry",
+		SpiffeId:  "spiffe://example.org/foo",
+		ParentId:  "spiffe://example.org/bar",
+		Selectors: []*common.Selector{{Type: "Type1", Value: "Value1"}},
+	})
+	s.Require().NoError(err)
+	s.Equal("restored-entry", entry.EntryId)
+
+	fetched, err := s.ds.FetchRegistrationEntry(ctx, "restored-entry")
+	s.Require().NoError(err)
+	s.RequireProtoEqual(entry, fetched)
+
+	// IDs are unique
+	_, err = s.ds.CreateRegistrationEntry(ctx, &common.RegistrationEntry{
+		EntryId:   "restored-entry",
+		SpiffeId:  "spiffe://example.org/baz",
+		ParentId:  "spiffe://example.org/bar",
+		Selectors: []*common.Selector{{Type: "Type1", Value: "Value1"}},
+	})
+	s.Require().Error(err)
+}
+
 func (s *PluginSuite) TestCreateInvalidRegistrationEntry() {
 	var invalidRegistrationEntries []*common.RegistrationEntry
 	s.getTestDataFromJSONFile(filepath.Join("testdata", "invalid_registration_entries.json"), &invalidRegistrationEntries)
@@ -2373,6 +2437,157 @@ func (s *PluginSuite) TestDeleteRegistrationEntry() {
 	s.Require().Nil(deletedEntry)
 }
 
+func (s *PluginSuite) TestRegistrationEntryRevisions() {
+	// No revisions for unknown entries
+	revisions, err := s.ds.ListRegistrationEntryRevisions(ctx, "badid")
+	s.Require().NoError(err)
+	s.Require().Empty(revisions)
+
+	changeCtx := datastore.WithChangedBy(ctx, "spiffe://example.org/admin")
+	created, err := s.ds.CreateRegistrationEntry(changeCtx, &common.RegistrationEntry{
+		Selectors: []*common.Selector{{Type: "Type1", Value: "Value1"}},
+		SpiffeId:  "spiffe://example.org/foo",
+		ParentId:  "spiffe://example.org/bar",
+		Ttl:       1,
+	})
+	s.Require().NoError(err)
+
+	updateEntry := proto.Clone(created).(*common.RegistrationEntry)
+	updateEntry.Ttl = 2
+	updated, err := s.ds.UpdateRegistrationEntry(ctx, updateEntry, &common.RegistrationEntryMask{Ttl: true})
+	s.Require().NoError(err)
+
+	deleted, err := s.ds.DeleteRegistrationEntry(changeCtx, created.EntryId)
+	s.Require().NoError(err)
+
+	revisions, err = s.ds.ListRegistrationEntryRevisions(ctx, created.EntryId)
+	s.Require().NoError(err)
+	s.Require().Len(revisions, 3)
+
+	s.Require().Equal(int64(0), revisions[0].Revision)
+	s.Require().Equal(datastore.RegistrationEntryCreated, revisions[0].Action)
+	s.Require().Equal("spiffe://example.org/admin", revisions[0].ChangedBy)
+	s.Require().False(revisions[0].ChangedAt.IsZero())
+	s.AssertProtoEqual(created, revisions[0].Entry)
+
+	s.Require().Equal(int64(1), revisions[1].Revision)
+	s.Require().Equal(datastore.RegistrationEntryUpdated, revisions[1].Action)
+	s.Require().Empty(revisions[1].ChangedBy)
+	s.AssertProtoEqual(updated, revisions[1].Entry)
+
+	s.Require().Equal(int64(1), revisions[2].Revision)
+	s.Require().Equal(datastore.RegistrationEntryDeleted, revisions[2].Action)
+	s.Require().Equal("spiffe://example.org/admin", revisions[2].ChangedBy)
+	s.AssertProtoEqual(deleted, revisions[2].Entry)
+}
+
+func (s *PluginSuite) TestFetchRegistrationEntryOwner() {
+	// No owner for unknown entries
+	owner, err := s.ds.FetchRegistrationEntryOwner(ctx, "badid")
+	s.Require().NoError(err)
+	s.Require().Empty(owner)
+
+	// No owner for the entries created without knowing who created them
+	unowned := s.createRegistrationEntry(&common.RegistrationEntry{
+		Selectors: []*common.Selector{{Type: "Type1", Value: "Value1"}},
+		SpiffeId:  "spiffe://example.org/foo",
+		ParentId:  "spiffe://example.org/bar",
+	})
+	owner, err = s.ds.FetchRegistrationEntryOwner(ctx, unowned.EntryId)
+	s.Require().NoError(err)
+	s.Require().Empty(owner)
+
+	entry, err := s.ds.CreateRegistrationEntry(datastore.WithChangedBy(ctx, "spiffe://example.org/creator"), &common.RegistrationEntry{
+		Selectors: []*common.Selector{{Type: "Type1", Value: "Value1"}},
+		SpiffeId:  "spiffe://example.org/baz",
+		ParentId:  "spiffe://example.org/bar",
+	})
+	s.Require().NoError(err)
+	owner, err = s.ds.FetchRegistrationEntryOwner(ctx, entry.EntryId)
+	s.Require().NoError(err)
+	s.Require().Equal("spiffe://example.org/creator", owner)
+
+	// The owner is kept across updates by other callers
+	entry.Ttl = 2
+	_, err = s.ds.UpdateRegistrationEntry(datastore.WithChangedBy(ctx, "spiffe://example.org/other"), entry, &common.RegistrationEntryMask{Ttl: true})
+	s.Require().NoError(err)
+	owner, err = s.ds.FetchRegistrationEntryOwner(ctx, entry.EntryId)
+	s.Require().NoError(err)
+	s.Require().Equal("spiffe://example.org/creator", owner)
+}
+
+func (s *PluginSuite) TestListRegistrationEntriesByProvenance() {
+	createEntry := func(spiffeID string, provenance datastore.Provenance) *common.RegistrationEntry {
+		entry, err := s.ds.CreateRegistrationEntry(datastore.WithProvenance(ctx, provenance), &common.RegistrationEntry{
+			Selectors: []*common.Selector{{Type: "Type1", Value: "Value1"}},
+			SpiffeId:  spiffeID,
+			ParentId:  "spiffe://example.org/node",
+		})
+		s.Require().NoError(err)
+		return entry
+	}
+
+	web := createEntry("spiffe://example.org/web", datastore.Provenance{Cluster: "east", Namespace: "web", Pod: "web-0"})
+	api := createEntry("spiffe://example.org/api", datastore.Provenance{Cluster: "east", Namespace: "api", Pod: "api-0"})
+	west := createEntry("spiffe://example.org/west", datastore.Provenance{Cluster: "west", Namespace: "web", Pod: "web-0"})
+	// Entries created without provenance, e.g. by operators, match no filter
+	s.createRegistrationEntry(&common.RegistrationEntry{
+		Selectors: []*common.Selector{{Type: "Type1", Value: "Value1"}},
+		SpiffeId:  "spiffe://example.org/manual",
+		ParentId:  "spiffe://example.org/node",
+	})
+
+	for _, tt := range []struct {
+		name       string
+		provenance datastore.Provenance
+		expected   []*common.RegistrationEntry
+	}{
+		{name: "by cluster", provenance: datastore.Provenance{Cluster: "east"}, expected: []*common.RegistrationEntry{web, api}},
+		{name: "by namespace", provenance: datastore.Provenance{Namespace: "web"}, expected: []*common.RegistrationEntry{web, west}},
+		{name: "by cluster and namespace", provenance: datastore.Provenance{Cluster: "west", Namespace: "web"}, expected: []*common.RegistrationEntry{west}},
+		{name: "by pod", provenance: datastore.Provenance{Cluster: "east", Namespace: "api", Pod: "api-0"}, expected: []*common.RegistrationEntry{api}},
+		{name: "no match", provenance: datastore.Provenance{Cluster: "north"}},
+	} {
+		tt := tt
+		s.T().Run(tt.name, func(t *testing.T) {
+			resp, err := s.ds.ListRegistrationEntries(ctx, &datastore.ListRegistrationEntriesRequest{
+				ByProvenance: &tt.provenance,
+			})
+			require.NoError(t, err)
+			util.SortRegistrationEntries(tt.expected)
+			util.SortRegistrationEntries(resp.Entries)
+			spiretest.RequireProtoListEqual(t, tt.expected, resp.Entries)
+		})
+	}
+
+	_, err := s.ds.ListRegistrationEntries(ctx, &datastore.ListRegistrationEntriesRequest{
+		ByProvenance: &datastore.Provenance{},
+	})
+	s.RequireGRPCStatus(err, codes.InvalidArgument, "cannot list by empty provenance")
+}
+
+func (s *PluginSuite) TestRegistrationEntryRevisionsAreBounded() {
+	entry := s.createRegistrationEntry(&common.RegistrationEntry{
+		Selectors: []*common.Selector{{Type: "Type1", Value: "Value1"}},
+		SpiffeId:  "spiffe://example.org/foo",
+		ParentId:  "spiffe://example.org/bar",
+	})
+
+	for i := 1; i <= maxRegistrationEntryRevisions+5; i++ {
+		entry.Ttl = int32(i)
+		_, err := s.ds.UpdateRegistrationEntry(ctx, entry, &common.RegistrationEntryMask{Ttl: true})
+		s.Require().NoError(err)
+	}
+
+	// Only the most recent revisions are kept
+	revisions, err := s.ds.ListRegistrationEntryRevisions(ctx, entry.EntryId)
+	s.Require().NoError(err)
+	s.Require().Len(revisions, maxRegistrationEntryRevisions)
+	s.Require().Equal(int64(6), revisions[0].Revision)
+	s.Require().Equal(int64(maxRegistrationEntryRevisions+5), revisions[len(revisions)-1].Revision)
+	s.Require().Equal(int32(maxRegistrationEntryRevisions+5), revisions[len(revisions)-1].Entry.Ttl)
+}
+
 func (s *PluginSuite) TestListParentIDEntries() {
 	allEntries := make([]*common.RegistrationEntry, 0)
 	s.getTestDataFromJSONFile(filepath.Join("testdata", "entries.json"), &allEntries)
@@ -3286,6 +3501,18 @@ func (s *PluginSuite) TestMigration() {
 			s.Require().True(s.ds.db.Dialect().HasColumn("federated_trust_domains", "endpoint_spiffe_id"))
 			s.Require().True(s.ds.db.Dialect().HasColumn("federated_trust_domains", "implicit"))
 			s.Require().True(s.ds.db.Dialect().HasIndex("federated_trust_domains", "uix_federated_trust_domains_trust_domain"))
+		case 17:
+			s.Require().True(s.ds.db.Dialect().HasTable("registered_entry_revisions"))
+			s.Require().True(s.ds.db.Dialect().HasIndex("registered_entry_revisions", "idx_registered_entry_revisions_entry_id"))
+		case 18:
+			s.Require().True(s.ds.db.Dialect().HasColumn("registered_entries", "owner"))
+		case 19:
+			s.Require().True(s.ds.db.Dialect().HasColumn("attested_node_entries", "last_seen"))
+		case 20:
+			s.Require().True(s.ds.db.Dialect().HasColumn("registered_entries", "provenance_cluster"))
+			s.Require().True(s.ds.db.Dialect().HasColumn("registered_entries", "provenance_namespace"))
+			s.Require().True(s.ds.db.Dialect().HasColumn("registered_entries", "provenance_pod"))
+			s.Require().True(s.ds.db.Dialect().HasIndex("registered_entries", "idx_registered_entries_provenance"))
 		default:
 			s.T().Fatalf("no migration test added for version %d", i)
 		}
@@ -0,0 +1,23 @@
+package admin
+
+import (
+	"net"
+	"time"
+)
+
+// DefaultExpiringSoonWindow is how far ahead the admin API looks for
+// expiring agents, entries and authorities if not overridden by the config
+const DefaultExpiringSoonWindow = 24 * time.Hour
+
+type EndpointConfig struct {
+	// Address is the address on which to serve the admin API.
+	Address *net.TCPAddr
+
+	// ExpiringSoonWindow is how far ahead the admin API looks for expiring
+	// agents, entries and authorities by default.
+	ExpiringSoonWindow time.Duration
+
+	// ProfilingEnabled serves the runtime profiles of the server to the
+	// admin workloads.
+	ProfilingEnabled bool
+}
@@ -0,0 +1,316 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/server/api"
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/proto/spire/common"
+	"google.golang.org/protobuf/proto"
+)
+
+// EntryHistory is the revision history of a registration entry, oldest
+// revision first
+type EntryHistory struct {
+	ID        string          `json:"id"`
+	Revisions []EntryRevision `json:"revisions"`
+}
+
+// EntryRevision is a revision of a registration entry
+type EntryRevision struct {
+	Revision int64 `json:"revision"`
+	// Action is the change that produced the revision (create, update or
+	// delete)
+	Action    string     `json:"action"`
+	ChangedBy string     `json:"changed_by,omitempty"`
+	ChangedAt time.Time  `json:"changed_at"`
+	Entry     EntryState `json:"entry"`
+	// Changes are the fields that changed from the previous revision. They
+	// are unknown for the oldest revision in the history.
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// EntryState is the state of a registration entry as of a revision
+type EntryState struct {
+	SPIFFEID      string   `json:"spiffe_id"`
+	ParentID      string   `json:"parent_id"`
+	Selectors     []string `json:"selectors"`
+	TTL           int32    `json:"ttl"`
+	FederatesWith []string `json:"federates_with"`
+	Admin         bool     `json:"admin"`
+	Downstream    bool     `json:"downstream"`
+	ExpiresAt     int64    `json:"expires_at"`
+	DNSNames      []string `json:"dns_names"`
+}
+
+// FieldChange is a field of a registration entry that changed between two
+// revisions
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// RollbackResult is the registration entry after a rollback
+type RollbackResult struct {
+	ID string `json:"id"`
+	// RolledBackTo is the revision the entry was rolled back to
+	RolledBackTo int64 `json:"rolled_back_to"`
+	// Revision is the new revision of the entry produced by the rollback
+	Revision int64      `json:"revision"`
+	Entry    EntryState `json:"entry"`
+}
+
+func (s *Server) serveEntryHistory(w http.ResponseWriter, req *http.Request) {
+	callerID, ok := s.authorizeRequest(w, req, http.MethodGet)
+	if !ok {
+		return
+	}
+
+	entryID := req.URL.Query().Get("id")
+	if entryID == "" {
+		http.Error(w, "400 missing entry id", http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := s.c.DataStore.ListRegistrationEntryRevisions(req.Context(), entryID)
+	if err != nil {
+		s.serveInternalError(w, req, callerID, err, "unable to retrieve entry history")
+		return
+	}
+	if len(revisions) == 0 {
+		http.Error(w, "404 no history for entry", http.StatusNotFound)
+		return
+	}
+
+	s.writeJSON(w, makeEntryHistory(entryID, revisions))
+}
+
+func (s *Server) serveEntryRollback(w http.ResponseWriter, req *http.Request) {
+	callerID, ok := s.authorizeRequest(w, req, http.MethodPost)
+	if !ok {
+		return
+	}
+
+	entryID := req.URL.Query().Get("id")
+	if entryID == "" {
+		http.Error(w, "400 missing entry id", http.StatusBadRequest)
+		return
+	}
+	revisionParam := req.URL.Query().Get("revision")
+	revision, err := strconv.ParseInt(revisionParam, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("400 invalid revision %q", revisionParam), http.StatusBadRequest)
+		return
+	}
+
+	ctx := req.Context()
+	revisions, err := s.c.DataStore.ListRegistrationEntryRevisions(ctx, entryID)
+	if err != nil {
+		s.serveInternalError(w, req, callerID, err, "unable to retrieve entry history")
+		return
+	}
+
+	var target *datastore.RegistrationEntryRevision
+	for _, r := range revisions {
+		// Deletions share the revision number of the last update and
+		// can't be rolled back to
+		if r.Revision == revision && r.Action != datastore.RegistrationEntryDeleted {
+			target = r
+		}
+	}
+	if target == nil {
+		http.Error(w, "404 revision not found", http.StatusNotFound)
+		return
+	}
+
+	// Only existing entries can be rolled back; deleted entries would be
+	// recreated with a different ID
+	current, err := s.c.DataStore.FetchRegistrationEntry(ctx, entryID)
+	if err != nil {
+		s.serveInternalError(w, req, callerID, err, "unable to fetch entry")
+		return
+	}
+	if current == nil {
+		http.Error(w, "404 entry not found", http.StatusNotFound)
+		return
+	}
+
+	if s.c.OwnershipPolicy.Enforced {
+		owner, err := s.c.DataStore.FetchRegistrationEntryOwner(ctx, entryID)
+		if err != nil {
+			s.serveInternalError(w, req, callerID, err, "unable to fetch entry owner")
+			return
+		}
+		if err := s.c.OwnershipPolicy.Check(callerID.String(), owner); err != nil {
+			http.Error(w, "403 "+err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	entry, code, err := s.validateRollback(ctx, current, target.Entry)
+	switch {
+	case code == http.StatusInternalServerError:
+		s.serveInternalError(w, req, callerID, err, "unable to validate entry")
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("%d %v", code, err), code)
+		return
+	}
+
+	// Rollbacks granting or revoking the admin or downstream flags must be
+	// confirmed, since they change what the workloads of the entry can do
+	if entry.Admin != current.Admin || entry.Downstream != current.Downstream {
+		if req.URL.Query().Get("allow_privilege_change") != "true" {
+			http.Error(w, "409 rollback changes the admin or downstream flags of the entry; set allow_privilege_change=true to confirm", http.StatusConflict)
+			return
+		}
+		s.c.Log.WithFields(logrus.Fields{
+			telemetry.CallerID:       callerID.String(),
+			telemetry.RegistrationID: entryID,
+			telemetry.Admin:          entry.Admin,
+			telemetry.Downstream:     entry.Downstream,
+		}).Warn("Rollback changes the admin or downstream flags of the registration entry")
+	}
+
+	updated, err := s.c.DataStore.UpdateRegistrationEntry(datastore.WithChangedBy(ctx, callerID.String()), entry, nil)
+	if err != nil {
+		s.serveInternalError(w, req, callerID, err, "unable to roll back entry")
+		return
+	}
+
+	s.c.Log.WithFields(logrus.Fields{
+		telemetry.CallerID:       callerID.String(),
+		telemetry.RegistrationID: entryID,
+		telemetry.RevisionNumber: revision,
+	}).Info("Rolled back registration entry")
+
+	s.writeJSON(w, &RollbackResult{
+		ID:           entryID,
+		RolledBackTo: revision,
+		Revision:     updated.RevisionNumber,
+		Entry:        makeEntryState(updated),
+	})
+}
+
+// validateRollback validates the entry as of a revision the same way the
+// registration APIs validate updates, since the ID policy or the trust domain
+// may have changed since. It returns the entry to update the current one
+// with, or the status code and error to reject the rollback with.
+func (s *Server) validateRollback(ctx context.Context, current, revision *common.RegistrationEntry) (*common.RegistrationEntry, int, error) {
+	revision = proto.Clone(revision).(*common.RegistrationEntry)
+	revision.EntryId = current.EntryId
+
+	tEntry, err := api.RegistrationEntryToProto(revision)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid entry as of revision: %w", err)
+	}
+	entry, err := api.ProtoToRegistrationEntry(s.c.TrustDomain, tEntry)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid entry as of revision: %w", err)
+	}
+	entry.EntryId = current.EntryId
+
+	entry.SpiffeId, err = s.c.IDPolicy.Apply(entry.SpiffeId)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("entry SPIFFE ID rejected: %w", err)
+	}
+
+	resp, err := s.c.DataStore.ListRegistrationEntries(ctx, &datastore.ListRegistrationEntriesRequest{
+		BySpiffeID: entry.SpiffeId,
+		ByParentID: entry.ParentId,
+		BySelectors: &datastore.BySelectors{
+			Match:     datastore.Exact,
+			Selectors: entry.Selectors,
+		},
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	for _, similar := range resp.Entries {
+		if similar.EntryId != current.EntryId {
+			return nil, http.StatusConflict, errors.New("similar entry already exists")
+		}
+	}
+
+	return entry, http.StatusOK, nil
+}
+
+func makeEntryHistory(entryID string, revisions []*datastore.RegistrationEntryRevision) *EntryHistory {
+	history := &EntryHistory{
+		ID:        entryID,
+		Revisions: make([]EntryRevision, 0, len(revisions)),
+	}
+
+	var previous *EntryState
+	for _, revision := range revisions {
+		state := makeEntryState(revision.Entry)
+		entryRevision := EntryRevision{
+			Revision:  revision.Revision,
+			Action:    string(revision.Action),
+			ChangedBy: revision.ChangedBy,
+			ChangedAt: revision.ChangedAt.UTC(),
+			Entry:     state,
+		}
+		if previous != nil {
+			entryRevision.Changes = diffEntryStates(*previous, state)
+		}
+		history.Revisions = append(history.Revisions, entryRevision)
+		previous = &state
+	}
+	return history
+}
+
+func makeEntryState(entry *common.RegistrationEntry) EntryState {
+	selectors := make([]string, 0, len(entry.Selectors))
+	for _, selector := range entry.Selectors {
+		selectors = append(selectors, selector.Type+":"+selector.Value)
+	}
+	sort.Strings(selectors)
+
+	federatesWith := append([]string{}, entry.FederatesWith...)
+	sort.Strings(federatesWith)
+
+	return EntryState{
+		SPIFFEID:      entry.SpiffeId,
+		ParentID:      entry.ParentId,
+		Selectors:     selectors,
+		TTL:           entry.Ttl,
+		FederatesWith: federatesWith,
+		Admin:         entry.Admin,
+		Downstream:    entry.Downstream,
+		ExpiresAt:     entry.EntryExpiry,
+		// The order of the DNS names matters, since the first one is
+		// the common name of the X509-SVIDs
+		DNSNames: append([]string{}, entry.DnsNames...),
+	}
+}
+
+func diffEntryStates(from, to EntryState) []FieldChange {
+	var changes []FieldChange
+	diff := func(field string, from, to interface{}) {
+		if !reflect.DeepEqual(from, to) {
+			changes = append(changes, FieldChange{Field: field, From: from, To: to})
+		}
+	}
+
+	diff("spiffe_id", from.SPIFFEID, to.SPIFFEID)
+	diff("parent_id", from.ParentID, to.ParentID)
+	diff("selectors", from.Selectors, to.Selectors)
+	diff("ttl", from.TTL, to.TTL)
+	diff("federates_with", from.FederatesWith, to.FederatesWith)
+	diff("admin", from.Admin, to.Admin)
+	diff("downstream", from.Downstream, to.Downstream)
+	diff("expires_at", from.ExpiresAt, to.ExpiresAt)
+	diff("dns_names", from.DNSNames, to.DNSNames)
+	return changes
+}
@@ -0,0 +1,313 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/spiffe/spire/pkg/server/api"
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryHistoryAndRollback(t *testing.T) {
+	test := setupTest(t)
+	ctx := datastore.WithChangedBy(context.Background(), "spiffe://example.org/operator")
+
+	entry, err := test.ds.CreateRegistrationEntry(ctx, &common.RegistrationEntry{
+		ParentId:  "spiffe://example.org/parent",
+		SpiffeId:  "spiffe://example.org/workload",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+		Ttl:       60,
+	})
+	require.NoError(t, err)
+
+	// A bad automated update
+	_, err = test.ds.UpdateRegistrationEntry(context.Background(), &common.RegistrationEntry{
+		EntryId:   entry.EntryId,
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:0"}},
+		Ttl:       3600,
+	}, &common.RegistrationEntryMask{Selectors: true, Ttl: true})
+	require.NoError(t, err)
+
+	history := getEntryHistory(t, test, entry.EntryId)
+	require.Len(t, history.Revisions, 2)
+	assert.Equal(t, int64(0), history.Revisions[0].Revision)
+	assert.Equal(t, "create", history.Revisions[0].Action)
+	assert.Equal(t, "spiffe://example.org/operator", history.Revisions[0].ChangedBy)
+	assert.Equal(t, EntryState{
+		SPIFFEID:      "spiffe://example.org/workload",
+		ParentID:      "spiffe://example.org/parent",
+		Selectors:     []string{"unix:uid:1000"},
+		TTL:           60,
+		FederatesWith: []string{},
+		DNSNames:      []string{},
+	}, history.Revisions[0].Entry)
+	assert.Empty(t, history.Revisions[0].Changes)
+	assert.Equal(t, int64(1), history.Revisions[1].Revision)
+	assert.Equal(t, "update", history.Revisions[1].Action)
+	assert.Empty(t, history.Revisions[1].ChangedBy)
+	assert.Equal(t, []FieldChange{
+		{Field: "selectors", From: []interface{}{"unix:uid:1000"}, To: []interface{}{"unix:uid:0"}},
+		{Field: "ttl", From: float64(60), To: float64(3600)},
+	}, history.Revisions[1].Changes)
+
+	// Roll back to the revision before the bad update
+	resp := test.post(t, "/v1/entries/rollback?id="+entry.EntryId+"&revision=0", test.svid(adminID))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var result RollbackResult
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	assert.Equal(t, RollbackResult{
+		ID:           entry.EntryId,
+		RolledBackTo: 0,
+		Revision:     2,
+		Entry:        history.Revisions[0].Entry,
+	}, result)
+
+	fetched, err := test.ds.FetchRegistrationEntry(context.Background(), entry.EntryId)
+	require.NoError(t, err)
+	assert.Equal(t, history.Revisions[0].Entry, makeEntryState(fetched))
+
+	// The rollback is recorded in the history as well
+	history = getEntryHistory(t, test, entry.EntryId)
+	require.Len(t, history.Revisions, 3)
+	assert.Equal(t, int64(2), history.Revisions[2].Revision)
+	assert.Equal(t, "update", history.Revisions[2].Action)
+	assert.Equal(t, adminID.String(), history.Revisions[2].ChangedBy)
+	assert.Equal(t, []FieldChange{
+		{Field: "selectors", From: []interface{}{"unix:uid:0"}, To: []interface{}{"unix:uid:1000"}},
+		{Field: "ttl", From: float64(3600), To: float64(60)},
+	}, history.Revisions[2].Changes)
+}
+
+func TestEntryRollbackOwnershipPolicy(t *testing.T) {
+	test := setupTest(t)
+	test.server.c.OwnershipPolicy = api.OwnershipPolicy{Enforced: true}
+
+	owned, err := test.ds.CreateRegistrationEntry(datastore.WithChangedBy(context.Background(), "spiffe://example.org/operator"), &common.RegistrationEntry{
+		ParentId:  "spiffe://example.org/parent",
+		SpiffeId:  "spiffe://example.org/owned",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+	})
+	require.NoError(t, err)
+	mine, err := test.ds.CreateRegistrationEntry(datastore.WithChangedBy(context.Background(), adminID.String()), &common.RegistrationEntry{
+		ParentId:  "spiffe://example.org/parent",
+		SpiffeId:  "spiffe://example.org/mine",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+	})
+	require.NoError(t, err)
+
+	// Entries created by other callers can't be rolled back
+	resp := test.post(t, "/v1/entries/rollback?id="+owned.EntryId+"&revision=0", test.svid(adminID))
+	require.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, "403 entry is owned by \"spiffe://example.org/operator\"\n", resp.Body.String())
+
+	resp = test.post(t, "/v1/entries/rollback?id="+mine.EntryId+"&revision=0", test.svid(adminID))
+	require.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestEntryRollbackValidation(t *testing.T) {
+	// createAndUpdate creates an entry and updates it, so it can be rolled
+	// back to the created revision
+	createAndUpdate := func(t *testing.T, test *serverTest, entry *common.RegistrationEntry) string {
+		created, err := test.ds.CreateRegistrationEntry(context.Background(), entry)
+		require.NoError(t, err)
+		_, err = test.ds.UpdateRegistrationEntry(context.Background(), &common.RegistrationEntry{
+			EntryId:    created.EntryId,
+			SpiffeId:   "spiffe://example.org/updated",
+			Selectors:  []*common.Selector{{Type: "unix", Value: "uid:2000"}},
+			Admin:      false,
+			Downstream: false,
+		}, &common.RegistrationEntryMask{SpiffeId: true, Selectors: true, Admin: true, Downstream: true})
+		require.NoError(t, err)
+		return created.EntryId
+	}
+
+	for _, tt := range []struct {
+		name       string
+		entry      *common.RegistrationEntry
+		similar    *common.RegistrationEntry
+		idPolicy   api.IDPolicy
+		query      string
+		expectCode int
+		expectBody string
+		expectID   string
+	}{
+		{
+			name: "valid revision",
+			entry: &common.RegistrationEntry{
+				ParentId:  "spiffe://example.org/parent",
+				SpiffeId:  "spiffe://example.org/workload",
+				Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+			},
+			expectCode: http.StatusOK,
+			expectID:   "spiffe://example.org/workload",
+		},
+		{
+			name: "revision in another trust domain",
+			entry: &common.RegistrationEntry{
+				ParentId:  "spiffe://domain.test/parent",
+				SpiffeId:  "spiffe://domain.test/workload",
+				Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+			},
+			expectCode: http.StatusBadRequest,
+			expectBody: "400 invalid entry as of revision: invalid parent ID: \"spiffe://domain.test/parent\" is not a member of trust domain \"example.org\"\n",
+		},
+		{
+			name: "revision rejected by the ID policy",
+			entry: &common.RegistrationEntry{
+				ParentId:  "spiffe://example.org/parent",
+				SpiffeId:  "spiffe://example.org/Workload",
+				Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+			},
+			idPolicy:   api.IDPolicy{Action: api.IDPolicyReject, LowercasePath: true},
+			expectCode: http.StatusBadRequest,
+			expectBody: "400 entry SPIFFE ID rejected: \"spiffe://example.org/Workload\" violates the SPIFFE ID policy: path must be lowercase\n",
+		},
+		{
+			name: "revision normalized by the ID policy",
+			entry: &common.RegistrationEntry{
+				ParentId:  "spiffe://example.org/parent",
+				SpiffeId:  "spiffe://example.org/Workload",
+				Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+			},
+			idPolicy:   api.IDPolicy{Action: api.IDPolicyNormalize, LowercasePath: true},
+			expectCode: http.StatusOK,
+			expectID:   "spiffe://example.org/workload",
+		},
+		{
+			name: "revision similar to another entry",
+			entry: &common.RegistrationEntry{
+				ParentId:  "spiffe://example.org/parent",
+				SpiffeId:  "spiffe://example.org/workload",
+				Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+			},
+			similar: &common.RegistrationEntry{
+				ParentId:  "spiffe://example.org/parent",
+				SpiffeId:  "spiffe://example.org/workload",
+				Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+			},
+			expectCode: http.StatusConflict,
+			expectBody: "409 similar entry already exists\n",
+		},
+		{
+			name: "revision granting admin",
+			entry: &common.RegistrationEntry{
+				ParentId:  "spiffe://example.org/parent",
+				SpiffeId:  "spiffe://example.org/workload",
+				Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+				Admin:     true,
+			},
+			expectCode: http.StatusConflict,
+			expectBody: "409 rollback changes the admin or downstream flags of the entry; set allow_privilege_change=true to confirm\n",
+		},
+		{
+			name: "revision granting downstream",
+			entry: &common.RegistrationEntry{
+				ParentId:   "spiffe://example.org/parent",
+				SpiffeId:   "spiffe://example.org/workload",
+				Selectors:  []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+				Downstream: true,
+			},
+			expectCode: http.StatusConflict,
+			expectBody: "409 rollback changes the admin or downstream flags of the entry; set allow_privilege_change=true to confirm\n",
+		},
+		{
+			name: "revision granting admin confirmed",
+			entry: &common.RegistrationEntry{
+				ParentId:  "spiffe://example.org/parent",
+				SpiffeId:  "spiffe://example.org/workload",
+				Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+				Admin:     true,
+			},
+			query:      "&allow_privilege_change=true",
+			expectCode: http.StatusOK,
+			expectID:   "spiffe://example.org/workload",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			test := setupTest(t)
+			test.server.c.IDPolicy = tt.idPolicy
+
+			entryID := createAndUpdate(t, test, tt.entry)
+			if tt.similar != nil {
+				_, err := test.ds.CreateRegistrationEntry(context.Background(), tt.similar)
+				require.NoError(t, err)
+			}
+
+			resp := test.post(t, "/v1/entries/rollback?id="+entryID+"&revision=0"+tt.query, test.svid(adminID))
+			require.Equal(t, tt.expectCode, resp.Code)
+			fetched, err := test.ds.FetchRegistrationEntry(context.Background(), entryID)
+			require.NoError(t, err)
+			if tt.expectCode != http.StatusOK {
+				assert.Equal(t, tt.expectBody, resp.Body.String())
+				// The entry is left as is
+				assert.Equal(t, "spiffe://example.org/updated", fetched.SpiffeId)
+				return
+			}
+			assert.Equal(t, tt.expectID, fetched.SpiffeId)
+			assert.Equal(t, tt.entry.Admin, fetched.Admin)
+			assert.Equal(t, tt.entry.Downstream, fetched.Downstream)
+		})
+	}
+}
+
+func TestEntryHistoryAndRollbackErrors(t *testing.T) {
+	test := setupTest(t)
+
+	entry, err := test.ds.CreateRegistrationEntry(context.Background(), &common.RegistrationEntry{
+		ParentId:  "spiffe://example.org/parent",
+		SpiffeId:  "spiffe://example.org/workload",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+	})
+	require.NoError(t, err)
+	deleted, err := test.ds.CreateRegistrationEntry(context.Background(), &common.RegistrationEntry{
+		ParentId:  "spiffe://example.org/parent",
+		SpiffeId:  "spiffe://example.org/deleted",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+	})
+	require.NoError(t, err)
+	_, err = test.ds.DeleteRegistrationEntry(context.Background(), deleted.EntryId)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name       string
+		method     string
+		path       string
+		nonAdmin   bool
+		expectCode int
+	}{
+		{name: "history of deleted entry", method: http.MethodGet, path: "/v1/entries/history?id=" + deleted.EntryId, expectCode: http.StatusOK},
+		{name: "history without id", method: http.MethodGet, path: "/v1/entries/history", expectCode: http.StatusBadRequest},
+		{name: "history of unknown entry", method: http.MethodGet, path: "/v1/entries/history?id=unknown", expectCode: http.StatusNotFound},
+		{name: "history by non admin", method: http.MethodGet, path: "/v1/entries/history?id=" + entry.EntryId, nonAdmin: true, expectCode: http.StatusForbidden},
+		{name: "rollback with GET", method: http.MethodGet, path: "/v1/entries/rollback?id=" + entry.EntryId + "&revision=0", expectCode: http.StatusMethodNotAllowed},
+		{name: "rollback without id", method: http.MethodPost, path: "/v1/entries/rollback?revision=0", expectCode: http.StatusBadRequest},
+		{name: "rollback with invalid revision", method: http.MethodPost, path: "/v1/entries/rollback?id=" + entry.EntryId + "&revision=latest", expectCode: http.StatusBadRequest},
+		{name: "rollback to unknown revision", method: http.MethodPost, path: "/v1/entries/rollback?id=" + entry.EntryId + "&revision=7", expectCode: http.StatusNotFound},
+		{name: "rollback of deleted entry", method: http.MethodPost, path: "/v1/entries/rollback?id=" + deleted.EntryId + "&revision=0", expectCode: http.StatusNotFound},
+		{name: "rollback by non admin", method: http.MethodPost, path: "/v1/entries/rollback?id=" + entry.EntryId + "&revision=0", nonAdmin: true, expectCode: http.StatusForbidden},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			caller := test.svid(adminID)
+			if tt.nonAdmin {
+				caller = test.svid(nonAdminID)
+			}
+			resp := test.do(t, tt.method, tt.path, caller)
+			require.Equal(t, tt.expectCode, resp.Code)
+		})
+	}
+}
+
+func getEntryHistory(t *testing.T, test *serverTest, entryID string) *EntryHistory {
+	resp := test.get(t, "/v1/entries/history?id="+entryID, test.svid(adminID))
+	require.Equal(t, http.StatusOK, resp.Code)
+	history := new(EntryHistory)
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), history))
+	return history
+}
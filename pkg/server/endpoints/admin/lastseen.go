@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spiffe/spire/pkg/server/lastseen"
+)
+
+// AgentLastSeenReport reports when the agents were last seen syncing with the
+// server. Agents not seen for longer than the stale threshold are reported as
+// stale; they are usually gone without having been deleted.
+type AgentLastSeenReport struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// StaleAfter is the stale threshold, e.g. "1h0m0s"
+	StaleAfter string `json:"stale_after"`
+	AgentCount int    `json:"agent_count"`
+	StaleCount int    `json:"stale_count"`
+	// Agents are sorted by when they were last seen, least recently first
+	Agents []AgentLastSeen `json:"agents"`
+}
+
+// AgentLastSeen describes when an agent was last seen syncing with the server
+type AgentLastSeen struct {
+	ID              string    `json:"id"`
+	AttestationType string    `json:"attestation_type"`
+	LastSeen        time.Time `json:"last_seen"`
+	Stale           bool      `json:"stale"`
+}
+
+func (s *Server) serveAgentLastSeen(w http.ResponseWriter, req *http.Request) {
+	callerID, ok := s.authorizeRequest(w, req, http.MethodGet)
+	if !ok {
+		return
+	}
+
+	staleAfter := s.c.AgentStaleAfter
+	if value := req.URL.Query().Get("stale_after"); value != "" {
+		var err error
+		staleAfter, err = time.ParseDuration(value)
+		if err != nil || staleAfter <= 0 {
+			http.Error(w, fmt.Sprintf("400 invalid stale_after duration %q", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := s.agentLastSeenReport(req.Context(), staleAfter)
+	if err != nil {
+		s.serveInternalError(w, req, callerID, err, "unable to retrieve agents")
+		return
+	}
+
+	s.writeJSON(w, report)
+}
+
+// agentLastSeenReport reports when the agents that are not banned were last
+// seen. Banned agents are not expected to sync, so they would only add noise.
+func (s *Server) agentLastSeenReport(ctx context.Context, staleAfter time.Duration) (*AgentLastSeenReport, error) {
+	agents, err := lastseen.ListAgents(ctx, s.c.DataStore)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.c.Clock.Now()
+	report := &AgentLastSeenReport{
+		GeneratedAt: now.UTC(),
+		StaleAfter:  staleAfter.String(),
+		AgentCount:  len(agents),
+		Agents:      make([]AgentLastSeen, 0, len(agents)),
+	}
+	for _, agent := range agents {
+		stale := now.Sub(agent.LastSeen) >= staleAfter
+		if stale {
+			report.StaleCount++
+		}
+		report.Agents = append(report.Agents, AgentLastSeen{
+			ID:              agent.ID,
+			AttestationType: agent.AttestationType,
+			LastSeen:        agent.LastSeen.UTC(),
+			Stale:           stale,
+		})
+	}
+	return report, nil
+}
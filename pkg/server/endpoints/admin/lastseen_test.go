@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentLastSeen(t *testing.T) {
+	test := setupTest(t)
+	test.server.c.AgentStaleAfter = time.Hour
+	ctx := context.Background()
+
+	for _, node := range []*common.AttestedNode{
+		{SpiffeId: "spiffe://example.org/spire/agent/test/fresh", AttestationDataType: "test", CertSerialNumber: "1"},
+		{SpiffeId: "spiffe://example.org/spire/agent/test/stale", AttestationDataType: "test", CertSerialNumber: "2"},
+		// Banned agents are left out
+		{SpiffeId: "spiffe://example.org/spire/agent/test/banned", AttestationDataType: "test"},
+	} {
+		_, err := test.ds.CreateAttestedNode(ctx, node)
+		require.NoError(t, err)
+	}
+
+	// The agents are seen after they were created, i.e. after the time of
+	// the datastore
+	seen := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	require.NoError(t, test.ds.SetNodeLastSeen(ctx, "spiffe://example.org/spire/agent/test/fresh", seen.Add(90*time.Minute)))
+	require.NoError(t, test.ds.SetNodeLastSeen(ctx, "spiffe://example.org/spire/agent/test/stale", seen))
+	test.clk.Set(seen.Add(2 * time.Hour))
+
+	getReport := func(query string) AgentLastSeenReport {
+		resp := test.get(t, "/v1/agents/last-seen"+query, test.svid(adminID))
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var report AgentLastSeenReport
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+		return report
+	}
+
+	assert.Equal(t, AgentLastSeenReport{
+		GeneratedAt: seen.Add(2 * time.Hour),
+		StaleAfter:  "1h0m0s",
+		AgentCount:  2,
+		StaleCount:  1,
+		Agents: []AgentLastSeen{
+			{ID: "spiffe://example.org/spire/agent/test/stale", AttestationType: "test", LastSeen: seen, Stale: true},
+			{ID: "spiffe://example.org/spire/agent/test/fresh", AttestationType: "test", LastSeen: seen.Add(90 * time.Minute)},
+		},
+	}, getReport(""))
+
+	report := getReport("?stale_after=3h")
+	assert.Equal(t, "3h0m0s", report.StaleAfter)
+	assert.Zero(t, report.StaleCount)
+}
+
+func TestAgentLastSeenErrors(t *testing.T) {
+	test := setupTest(t)
+
+	// Not served unless the server tracks when the agents were last seen
+	resp := test.get(t, "/v1/agents/last-seen", test.svid(adminID))
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	test.server.c.AgentStaleAfter = time.Hour
+	for _, tt := range []struct {
+		name       string
+		method     string
+		path       string
+		nonAdmin   bool
+		expectCode int
+	}{
+		{name: "with POST", method: http.MethodPost, path: "/v1/agents/last-seen", expectCode: http.StatusMethodNotAllowed},
+		{name: "by non admin", method: http.MethodGet, path: "/v1/agents/last-seen", nonAdmin: true, expectCode: http.StatusForbidden},
+		{name: "with invalid stale_after", method: http.MethodGet, path: "/v1/agents/last-seen?stale_after=soon", expectCode: http.StatusBadRequest},
+		{name: "with negative stale_after", method: http.MethodGet, path: "/v1/agents/last-seen?stale_after=-1h", expectCode: http.StatusBadRequest},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			caller := test.svid(adminID)
+			if tt.nonAdmin {
+				caller = test.svid(nonAdminID)
+			}
+			resp := test.do(t, tt.method, tt.path, caller)
+			require.Equal(t, tt.expectCode, resp.Code)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/common/idutil"
+	"github.com/spiffe/spire/pkg/common/nodeutil"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/server/datastore"
+)
+
+// SPIFFEIDLookup reports which registration entries and agents could produce
+// a SPIFFE ID, and which selectors map to it
+type SPIFFEIDLookup struct {
+	SPIFFEID string `json:"spiffe_id"`
+	// Entries are the registration entries identified by the SPIFFE ID,
+	// whether or not they are delivered to an agent
+	Entries []LookupEntry `json:"entries"`
+	// Agents are the attested agents the entries are delivered to, i.e. the
+	// agents able to obtain SVIDs for the SPIFFE ID
+	Agents []LookupAgent `json:"agents"`
+	// Agent is set if the SPIFFE ID is the ID of an attested agent
+	Agent *LookupAttestedAgent `json:"agent,omitempty"`
+}
+
+// LookupEntry is a registration entry identified by a looked up SPIFFE ID
+type LookupEntry struct {
+	ID        string   `json:"id"`
+	ParentID  string   `json:"parent_id"`
+	Selectors []string `json:"selectors"`
+	// NodeAlias is set if the entry is parented to the server, i.e. the
+	// SPIFFE ID is a node alias of the agents with all the selectors
+	NodeAlias  bool `json:"node_alias"`
+	Admin      bool `json:"admin"`
+	Downstream bool `json:"downstream"`
+}
+
+// LookupAgent is an agent an entry identified by a looked up SPIFFE ID is
+// delivered to
+type LookupAgent struct {
+	ID              string `json:"id"`
+	AttestationType string `json:"attestation_type"`
+	// Entries are the IDs of the entries delivered to the agent
+	Entries []string `json:"entries"`
+}
+
+// LookupAttestedAgent is the attested agent identified by a looked up SPIFFE
+// ID
+type LookupAttestedAgent struct {
+	AttestationType string    `json:"attestation_type"`
+	SerialNumber    string    `json:"serial_number"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	Banned          bool      `json:"banned"`
+	Selectors       []string  `json:"selectors"`
+}
+
+func (s *Server) serveSPIFFEIDLookup(w http.ResponseWriter, req *http.Request) {
+	callerID, ok := s.authorizeRequest(w, req, http.MethodGet)
+	if !ok {
+		return
+	}
+
+	id, err := spiffeid.FromString(req.URL.Query().Get("spiffe_id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("400 invalid spiffe id %q", req.URL.Query().Get("spiffe_id")), http.StatusBadRequest)
+		return
+	}
+
+	lookup, err := s.lookupSPIFFEID(req.Context(), id)
+	if err != nil {
+		s.serveInternalError(w, req, callerID, err, "unable to look up SPIFFE ID")
+		return
+	}
+
+	s.writeJSON(w, lookup)
+}
+
+// lookupSPIFFEID resolves the entries and agents that could produce the
+// SPIFFE ID, the same way the server resolves the entries authorized for an
+// agent
+func (s *Server) lookupSPIFFEID(ctx context.Context, id spiffeid.ID) (*SPIFFEIDLookup, error) {
+	lookup := &SPIFFEIDLookup{
+		SPIFFEID: id.String(),
+		Entries:  []LookupEntry{},
+		Agents:   []LookupAgent{},
+	}
+
+	req := &datastore.ListRegistrationEntriesRequest{
+		BySpiffeID: id.String(),
+		Pagination: &datastore.Pagination{PageSize: pageSize},
+	}
+	for {
+		resp, err := s.c.DataStore.ListRegistrationEntries(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range resp.Entries {
+			lookup.Entries = append(lookup.Entries, LookupEntry{
+				ID:         entry.EntryId,
+				ParentID:   entry.ParentId,
+				Selectors:  selectorStrings(entry.Selectors),
+				NodeAlias:  entry.ParentId == idutil.ServerID(s.c.TrustDomain).String(),
+				Admin:      entry.Admin,
+				Downstream: entry.Downstream,
+			})
+		}
+		if len(resp.Entries) == 0 || resp.Pagination == nil || resp.Pagination.Token == "" {
+			break
+		}
+		req.Pagination.Token = resp.Pagination.Token
+	}
+	sort.Slice(lookup.Entries, func(i, j int) bool {
+		return lookup.Entries[i].ID < lookup.Entries[j].ID
+	})
+
+	if len(lookup.Entries) > 0 {
+		if err := s.lookupAgents(ctx, lookup); err != nil {
+			return nil, err
+		}
+	}
+
+	node, err := s.c.DataStore.FetchAttestedNode(ctx, id.String())
+	if err != nil {
+		return nil, err
+	}
+	if node != nil {
+		selectors, err := s.c.DataStore.GetNodeSelectors(ctx, id.String(), datastore.RequireCurrent)
+		if err != nil {
+			return nil, err
+		}
+		lookup.Agent = &LookupAttestedAgent{
+			AttestationType: node.AttestationDataType,
+			SerialNumber:    node.CertSerialNumber,
+			ExpiresAt:       time.Unix(node.CertNotAfter, 0).UTC(),
+			Banned:          nodeutil.IsAgentBanned(node),
+			Selectors:       selectorStrings(selectors),
+		}
+	}
+	return lookup, nil
+}
+
+// lookupAgents adds the agents the entries of the lookup are delivered to.
+// Banned agents and agents with expired SVIDs are left out.
+func (s *Server) lookupAgents(ctx context.Context, lookup *SPIFFEIDLookup) error {
+	notBanned := false
+	nodes, err := s.listAttestedNodes(ctx, &datastore.ListAttestedNodesRequest{
+		ByBanned: &notBanned,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := s.c.Clock.Now().Unix()
+	for _, node := range nodes {
+		if node.CertNotAfter <= now {
+			continue
+		}
+		agentID, err := spiffeid.FromString(node.SpiffeId)
+		if err != nil {
+			s.c.Log.WithError(err).WithField(telemetry.AgentID, node.SpiffeId).Warn("Malformed agent ID")
+			continue
+		}
+
+		entries, err := s.c.EntryFetcher.FetchEntries(ctx, agentID)
+		if err != nil {
+			return fmt.Errorf("unable to fetch entries of agent %q: %w", agentID, err)
+		}
+
+		var entryIDs []string
+		for _, entry := range entries {
+			if protoIDString(entry.SpiffeId) == lookup.SPIFFEID {
+				entryIDs = append(entryIDs, entry.Id)
+			}
+		}
+		if len(entryIDs) == 0 {
+			continue
+		}
+		sort.Strings(entryIDs)
+		lookup.Agents = append(lookup.Agents, LookupAgent{
+			ID:              node.SpiffeId,
+			AttestationType: node.AttestationDataType,
+			Entries:         entryIDs,
+		})
+	}
+
+	sort.Slice(lookup.Agents, func(i, j int) bool {
+		return lookup.Agents[i].ID < lookup.Agents[j].ID
+	})
+	return nil
+}
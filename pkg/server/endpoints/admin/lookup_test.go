@@ -0,0 +1,182 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSPIFFEIDLookup(t *testing.T) {
+	test := setupTest(t)
+	ctx := context.Background()
+	now := test.clk.Now()
+
+	gpuAgent := spiffeid.Must("example.org", "spire", "agent", "k8s_psat", "gpu")
+	cpuAgent := spiffeid.Must("example.org", "spire", "agent", "k8s_psat", "cpu")
+	expiredAgent := spiffeid.Must("example.org", "spire", "agent", "k8s_psat", "expired")
+	for _, node := range []struct {
+		id       spiffeid.ID
+		serial   string
+		notAfter int64
+	}{
+		{id: gpuAgent, serial: "1", notAfter: now.Add(time.Hour).Unix()},
+		{id: cpuAgent, serial: "2", notAfter: now.Add(time.Hour).Unix()},
+		// Expired agents are left out
+		{id: expiredAgent, serial: "3", notAfter: now.Add(-time.Hour).Unix()},
+	} {
+		_, err := test.ds.CreateAttestedNode(ctx, &common.AttestedNode{
+			SpiffeId:            node.id.String(),
+			AttestationDataType: "k8s_psat",
+			CertSerialNumber:    node.serial,
+			CertNotAfter:        node.notAfter,
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, test.ds.SetNodeSelectors(ctx, gpuAgent.String(), []*common.Selector{
+		{Type: "k8s_psat", Value: "cluster:prod"},
+		{Type: "k8s_psat", Value: "agent_node_label:pool:gpu"},
+	}))
+
+	createEntry := func(spiffeID, parentID string, selectors ...*common.Selector) *common.RegistrationEntry {
+		entry, err := test.ds.CreateRegistrationEntry(ctx, &common.RegistrationEntry{
+			SpiffeId:  spiffeID,
+			ParentId:  parentID,
+			Selectors: selectors,
+		})
+		require.NoError(t, err)
+		return entry
+	}
+	alias := createEntry("spiffe://example.org/gpu-nodes", "spiffe://example.org/spire/server",
+		&common.Selector{Type: "k8s_psat", Value: "agent_node_label:pool:gpu"})
+	gpuWeb := createEntry("spiffe://example.org/web", "spiffe://example.org/gpu-nodes",
+		&common.Selector{Type: "k8s", Value: "ns:web"})
+	cpuWeb := createEntry("spiffe://example.org/web", cpuAgent.String(),
+		&common.Selector{Type: "k8s", Value: "ns:web"}, &common.Selector{Type: "k8s", Value: "sa:web"})
+	createEntry("spiffe://example.org/db", cpuAgent.String(),
+		&common.Selector{Type: "k8s", Value: "ns:db"})
+
+	toType := func(entry *common.RegistrationEntry) *types.Entry {
+		spiffeID := spiffeid.RequireFromString(entry.SpiffeId)
+		return &types.Entry{
+			Id:       entry.EntryId,
+			SpiffeId: &types.SPIFFEID{TrustDomain: spiffeID.TrustDomain().String(), Path: spiffeID.Path()},
+		}
+	}
+	test.agentEntries = map[spiffeid.ID][]*types.Entry{
+		gpuAgent:     {toType(alias), toType(gpuWeb)},
+		cpuAgent:     {toType(cpuWeb)},
+		expiredAgent: {toType(cpuWeb)},
+	}
+
+	webEntries := []LookupEntry{
+		{ID: gpuWeb.EntryId, ParentID: "spiffe://example.org/gpu-nodes", Selectors: []string{"k8s:ns:web"}},
+		{ID: cpuWeb.EntryId, ParentID: cpuAgent.String(), Selectors: []string{"k8s:ns:web", "k8s:sa:web"}},
+	}
+	// Entries are sorted by ID
+	if webEntries[0].ID > webEntries[1].ID {
+		webEntries[0], webEntries[1] = webEntries[1], webEntries[0]
+	}
+
+	for _, tt := range []struct {
+		name     string
+		spiffeID string
+		expect   SPIFFEIDLookup
+	}{
+		{
+			name:     "workload",
+			spiffeID: "spiffe://example.org/web",
+			expect: SPIFFEIDLookup{
+				SPIFFEID: "spiffe://example.org/web",
+				Entries:  webEntries,
+				Agents: []LookupAgent{
+					{ID: cpuAgent.String(), AttestationType: "k8s_psat", Entries: []string{cpuWeb.EntryId}},
+					{ID: gpuAgent.String(), AttestationType: "k8s_psat", Entries: []string{gpuWeb.EntryId}},
+				},
+			},
+		},
+		{
+			name:     "node alias",
+			spiffeID: "spiffe://example.org/gpu-nodes",
+			expect: SPIFFEIDLookup{
+				SPIFFEID: "spiffe://example.org/gpu-nodes",
+				Entries: []LookupEntry{
+					{ID: alias.EntryId, ParentID: "spiffe://example.org/spire/server", Selectors: []string{"k8s_psat:agent_node_label:pool:gpu"}, NodeAlias: true},
+				},
+				Agents: []LookupAgent{
+					{ID: gpuAgent.String(), AttestationType: "k8s_psat", Entries: []string{alias.EntryId}},
+				},
+			},
+		},
+		{
+			name:     "agent",
+			spiffeID: gpuAgent.String(),
+			expect: SPIFFEIDLookup{
+				SPIFFEID: gpuAgent.String(),
+				Entries:  []LookupEntry{},
+				Agents:   []LookupAgent{},
+				Agent: &LookupAttestedAgent{
+					AttestationType: "k8s_psat",
+					SerialNumber:    "1",
+					ExpiresAt:       now.Add(time.Hour).UTC().Truncate(time.Second),
+					Selectors:       []string{"k8s_psat:agent_node_label:pool:gpu", "k8s_psat:cluster:prod"},
+				},
+			},
+		},
+		{
+			name:     "unknown",
+			spiffeID: "spiffe://example.org/unknown",
+			expect: SPIFFEIDLookup{
+				SPIFFEID: "spiffe://example.org/unknown",
+				Entries:  []LookupEntry{},
+				Agents:   []LookupAgent{},
+			},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"spiffe_id": {tt.spiffeID}}
+			resp := test.get(t, "/v1/spiffeids/lookup?"+query.Encode(), test.svid(adminID))
+			require.Equal(t, http.StatusOK, resp.Code)
+
+			var lookup SPIFFEIDLookup
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &lookup))
+			assert.Equal(t, tt.expect, lookup)
+		})
+	}
+}
+
+func TestSPIFFEIDLookupErrors(t *testing.T) {
+	test := setupTest(t)
+
+	for _, tt := range []struct {
+		name       string
+		method     string
+		path       string
+		nonAdmin   bool
+		expectCode int
+	}{
+		{name: "with POST", method: http.MethodPost, path: "/v1/spiffeids/lookup?spiffe_id=spiffe://example.org/web", expectCode: http.StatusMethodNotAllowed},
+		{name: "by non admin", method: http.MethodGet, path: "/v1/spiffeids/lookup?spiffe_id=spiffe://example.org/web", nonAdmin: true, expectCode: http.StatusForbidden},
+		{name: "without spiffe id", method: http.MethodGet, path: "/v1/spiffeids/lookup", expectCode: http.StatusBadRequest},
+		{name: "with invalid spiffe id", method: http.MethodGet, path: "/v1/spiffeids/lookup?spiffe_id=example.org/web", expectCode: http.StatusBadRequest},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			caller := test.svid(adminID)
+			if tt.nonAdmin {
+				caller = test.svid(nonAdminID)
+			}
+			resp := test.do(t, tt.method, tt.path, caller)
+			require.Equal(t, tt.expectCode, resp.Code)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/idutil"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/proto/spire/common"
+)
+
+// EntryPreview reports which of the currently attested agents, and which of
+// the workloads known to the server, a registration entry would match if it
+// was created
+type EntryPreview struct {
+	ParentID  string   `json:"parent_id"`
+	Selectors []string `json:"selectors"`
+	// NodeAlias is set if the entry is parented to the server, i.e. it is a
+	// node alias matching the agents with all of its selectors
+	NodeAlias bool `json:"node_alias"`
+	// Agents are the agents the entry would be delivered to
+	Agents []PreviewAgent `json:"agents"`
+	// Entries are the registration entries of those agents whose workloads
+	// would also match the entry, since their selectors include all of its
+	// selectors. Workloads without an entry are unknown to the server.
+	Entries []PreviewEntry `json:"entries"`
+}
+
+// PreviewAgent is an agent a previewed entry would be delivered to
+type PreviewAgent struct {
+	ID              string `json:"id"`
+	AttestationType string `json:"attestation_type"`
+	// Via are the IDs of the registration entries of the agent identified by
+	// the parent ID of the previewed entry, e.g. node aliases. It is empty
+	// if the parent ID is the agent ID or the entry is a node alias.
+	Via []string `json:"via,omitempty"`
+}
+
+// PreviewEntry is a registration entry whose workloads would match a
+// previewed entry
+type PreviewEntry struct {
+	ID        string   `json:"id"`
+	SPIFFEID  string   `json:"spiffe_id"`
+	ParentID  string   `json:"parent_id"`
+	Selectors []string `json:"selectors"`
+}
+
+func (s *Server) serveEntryPreview(w http.ResponseWriter, req *http.Request) {
+	callerID, ok := s.authorizeRequest(w, req, http.MethodGet)
+	if !ok {
+		return
+	}
+
+	query := req.URL.Query()
+	parentID, err := spiffeid.FromString(query.Get("parent_id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("400 invalid parent id %q", query.Get("parent_id")), http.StatusBadRequest)
+		return
+	}
+	if len(query["selector"]) == 0 {
+		http.Error(w, "400 missing selectors", http.StatusBadRequest)
+		return
+	}
+	var selectors []*common.Selector
+	for _, selector := range query["selector"] {
+		parts := strings.SplitN(selector, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			http.Error(w, fmt.Sprintf("400 invalid selector %q, expected type:value", selector), http.StatusBadRequest)
+			return
+		}
+		selectors = append(selectors, &common.Selector{Type: parts[0], Value: parts[1]})
+	}
+
+	preview, err := s.previewEntry(req.Context(), parentID, selectors)
+	if err != nil {
+		s.serveInternalError(w, req, callerID, err, "unable to preview entry")
+		return
+	}
+
+	s.writeJSON(w, preview)
+}
+
+// previewEntry resolves the agents an entry with the given parent ID and
+// selectors would be delivered to, the same way the server resolves the
+// entries authorized for an agent
+func (s *Server) previewEntry(ctx context.Context, parentID spiffeid.ID, selectors []*common.Selector) (*EntryPreview, error) {
+	notBanned := false
+	nodes, err := s.listAttestedNodes(ctx, &datastore.ListAttestedNodesRequest{
+		ByBanned:       &notBanned,
+		FetchSelectors: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &EntryPreview{
+		ParentID:  parentID.String(),
+		Selectors: selectorStrings(selectors),
+		NodeAlias: parentID == idutil.ServerID(s.c.TrustDomain),
+		Agents:    []PreviewAgent{},
+		Entries:   []PreviewEntry{},
+	}
+	seenEntries := make(map[string]bool)
+	now := s.c.Clock.Now().Unix()
+	for _, node := range nodes {
+		// Agents with expired SVIDs are no longer attested
+		if node.CertNotAfter <= now {
+			continue
+		}
+		agentID, err := spiffeid.FromString(node.SpiffeId)
+		if err != nil {
+			s.c.Log.WithError(err).WithField(telemetry.AgentID, node.SpiffeId).Warn("Malformed agent ID")
+			continue
+		}
+
+		if preview.NodeAlias {
+			if isSelectorSubset(selectors, node.Selectors) {
+				preview.Agents = append(preview.Agents, PreviewAgent{
+					ID:              node.SpiffeId,
+					AttestationType: node.AttestationDataType,
+				})
+			}
+			continue
+		}
+
+		entries, err := s.c.EntryFetcher.FetchEntries(ctx, agentID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch entries of agent %q: %w", agentID, err)
+		}
+
+		var via []string
+		for _, entry := range entries {
+			if protoIDString(entry.SpiffeId) == parentID.String() {
+				via = append(via, entry.Id)
+			}
+		}
+		if agentID != parentID && len(via) == 0 {
+			continue
+		}
+		sort.Strings(via)
+		preview.Agents = append(preview.Agents, PreviewAgent{
+			ID:              node.SpiffeId,
+			AttestationType: node.AttestationDataType,
+			Via:             via,
+		})
+
+		for _, entry := range entries {
+			if seenEntries[entry.Id] || isNodeAlias(s.c.TrustDomain, entry) {
+				continue
+			}
+			entrySelectors := selectorsFromTypes(entry.Selectors)
+			if !isSelectorSubset(selectors, entrySelectors) {
+				continue
+			}
+			seenEntries[entry.Id] = true
+			preview.Entries = append(preview.Entries, PreviewEntry{
+				ID:        entry.Id,
+				SPIFFEID:  protoIDString(entry.SpiffeId),
+				ParentID:  protoIDString(entry.ParentId),
+				Selectors: selectorStrings(entrySelectors),
+			})
+		}
+	}
+
+	sort.Slice(preview.Agents, func(i, j int) bool {
+		return preview.Agents[i].ID < preview.Agents[j].ID
+	})
+	sort.Slice(preview.Entries, func(i, j int) bool {
+		return preview.Entries[i].ID < preview.Entries[j].ID
+	})
+	return preview, nil
+}
+
+// isNodeAlias returns true if the entry is parented to the server
+func isNodeAlias(td spiffeid.TrustDomain, entry *types.Entry) bool {
+	return protoIDString(entry.ParentId) == idutil.ServerID(td).String()
+}
+
+func protoIDString(id *types.SPIFFEID) string {
+	if id == nil {
+		return ""
+	}
+	spiffeID, err := idutil.IDFromProto(id)
+	if err != nil {
+		return ""
+	}
+	return spiffeID.String()
+}
+
+// isSelectorSubset returns true if all the selectors of sub are in whole
+func isSelectorSubset(sub, whole []*common.Selector) bool {
+	set := make(map[string]bool, len(whole))
+	for _, selector := range whole {
+		set[selector.Type+":"+selector.Value] = true
+	}
+	for _, selector := range sub {
+		if !set[selector.Type+":"+selector.Value] {
+			return false
+		}
+	}
+	return true
+}
+
+func selectorsFromTypes(in []*types.Selector) []*common.Selector {
+	out := make([]*common.Selector, 0, len(in))
+	for _, selector := range in {
+		out = append(out, &common.Selector{Type: selector.Type, Value: selector.Value})
+	}
+	return out
+}
+
+func selectorStrings(selectors []*common.Selector) []string {
+	strs := make([]string, 0, len(selectors))
+	for _, selector := range selectors {
+		strs = append(strs, selector.Type+":"+selector.Value)
+	}
+	sort.Strings(strs)
+	return strs
+}
@@ -0,0 +1,200 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryPreview(t *testing.T) {
+	test := setupTest(t)
+	ctx := context.Background()
+	now := test.clk.Now()
+
+	gpuAgent := spiffeid.Must("example.org", "spire", "agent", "k8s_psat", "gpu")
+	cpuAgent := spiffeid.Must("example.org", "spire", "agent", "k8s_psat", "cpu")
+	for _, node := range []struct {
+		id        string
+		serial    string
+		notAfter  int64
+		selectors []*common.Selector
+	}{
+		{id: gpuAgent.String(), serial: "1", notAfter: now.Add(time.Hour).Unix(), selectors: []*common.Selector{
+			{Type: "k8s_psat", Value: "cluster:prod"},
+			{Type: "k8s_psat", Value: "agent_node_label:pool:gpu"},
+		}},
+		{id: cpuAgent.String(), serial: "2", notAfter: now.Add(time.Hour).Unix(), selectors: []*common.Selector{
+			{Type: "k8s_psat", Value: "cluster:prod"},
+			{Type: "k8s_psat", Value: "agent_node_label:pool:cpu"},
+		}},
+		// Expired and banned agents are left out
+		{id: "spiffe://example.org/spire/agent/k8s_psat/expired", serial: "3", notAfter: now.Add(-time.Hour).Unix(), selectors: []*common.Selector{
+			{Type: "k8s_psat", Value: "cluster:prod"},
+			{Type: "k8s_psat", Value: "agent_node_label:pool:gpu"},
+		}},
+		{id: "spiffe://example.org/spire/agent/k8s_psat/banned", notAfter: now.Add(time.Hour).Unix(), selectors: []*common.Selector{
+			{Type: "k8s_psat", Value: "cluster:prod"},
+			{Type: "k8s_psat", Value: "agent_node_label:pool:gpu"},
+		}},
+	} {
+		_, err := test.ds.CreateAttestedNode(ctx, &common.AttestedNode{
+			SpiffeId:            node.id,
+			AttestationDataType: "k8s_psat",
+			CertSerialNumber:    node.serial,
+			CertNotAfter:        node.notAfter,
+		})
+		require.NoError(t, err)
+		require.NoError(t, test.ds.SetNodeSelectors(ctx, node.id, node.selectors))
+	}
+
+	test.agentEntries = map[spiffeid.ID][]*types.Entry{
+		gpuAgent: {
+			{
+				Id:       "alias",
+				SpiffeId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/gpu-nodes"},
+				ParentId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/spire/server"},
+				Selectors: []*types.Selector{
+					{Type: "k8s_psat", Value: "agent_node_label:pool:gpu"},
+				},
+			},
+			{
+				Id:       "trainer",
+				SpiffeId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/trainer"},
+				ParentId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/gpu-nodes"},
+				Selectors: []*types.Selector{
+					{Type: "k8s", Value: "ns:ml"},
+					{Type: "k8s", Value: "sa:trainer"},
+				},
+			},
+			{
+				Id:       "web",
+				SpiffeId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/web"},
+				ParentId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/gpu-nodes"},
+				Selectors: []*types.Selector{
+					{Type: "k8s", Value: "ns:web"},
+				},
+			},
+		},
+		cpuAgent: {
+			{
+				Id:       "cpu-web",
+				SpiffeId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/web"},
+				ParentId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/spire/agent/k8s_psat/cpu"},
+				Selectors: []*types.Selector{
+					{Type: "k8s", Value: "ns:ml"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range []struct {
+		name      string
+		parentID  string
+		selectors []string
+		expect    EntryPreview
+	}{
+		{
+			name:      "parented to node alias",
+			parentID:  "spiffe://example.org/gpu-nodes",
+			selectors: []string{"k8s:ns:ml"},
+			expect: EntryPreview{
+				ParentID:  "spiffe://example.org/gpu-nodes",
+				Selectors: []string{"k8s:ns:ml"},
+				Agents: []PreviewAgent{
+					{ID: gpuAgent.String(), AttestationType: "k8s_psat", Via: []string{"alias"}},
+				},
+				Entries: []PreviewEntry{
+					{ID: "trainer", SPIFFEID: "spiffe://example.org/trainer", ParentID: "spiffe://example.org/gpu-nodes", Selectors: []string{"k8s:ns:ml", "k8s:sa:trainer"}},
+				},
+			},
+		},
+		{
+			name:      "parented to agent",
+			parentID:  cpuAgent.String(),
+			selectors: []string{"k8s:ns:ml"},
+			expect: EntryPreview{
+				ParentID:  cpuAgent.String(),
+				Selectors: []string{"k8s:ns:ml"},
+				Agents: []PreviewAgent{
+					{ID: cpuAgent.String(), AttestationType: "k8s_psat"},
+				},
+				Entries: []PreviewEntry{
+					{ID: "cpu-web", SPIFFEID: "spiffe://example.org/web", ParentID: cpuAgent.String(), Selectors: []string{"k8s:ns:ml"}},
+				},
+			},
+		},
+		{
+			name:      "node alias",
+			parentID:  "spiffe://example.org/spire/server",
+			selectors: []string{"k8s_psat:cluster:prod", "k8s_psat:agent_node_label:pool:gpu"},
+			expect: EntryPreview{
+				ParentID:  "spiffe://example.org/spire/server",
+				Selectors: []string{"k8s_psat:agent_node_label:pool:gpu", "k8s_psat:cluster:prod"},
+				NodeAlias: true,
+				Agents: []PreviewAgent{
+					{ID: gpuAgent.String(), AttestationType: "k8s_psat"},
+				},
+				Entries: []PreviewEntry{},
+			},
+		},
+		{
+			name:      "no match",
+			parentID:  "spiffe://example.org/unknown",
+			selectors: []string{"k8s:ns:ml"},
+			expect: EntryPreview{
+				ParentID:  "spiffe://example.org/unknown",
+				Selectors: []string{"k8s:ns:ml"},
+				Agents:    []PreviewAgent{},
+				Entries:   []PreviewEntry{},
+			},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"parent_id": {tt.parentID}, "selector": tt.selectors}
+			resp := test.get(t, "/v1/entries/preview?"+query.Encode(), test.svid(adminID))
+			require.Equal(t, http.StatusOK, resp.Code)
+
+			var preview EntryPreview
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &preview))
+			assert.Equal(t, tt.expect, preview)
+		})
+	}
+}
+
+func TestEntryPreviewErrors(t *testing.T) {
+	test := setupTest(t)
+
+	for _, tt := range []struct {
+		name       string
+		method     string
+		path       string
+		nonAdmin   bool
+		expectCode int
+	}{
+		{name: "with POST", method: http.MethodPost, path: "/v1/entries/preview?parent_id=spiffe://example.org/node&selector=k8s:ns:web", expectCode: http.StatusMethodNotAllowed},
+		{name: "by non admin", method: http.MethodGet, path: "/v1/entries/preview?parent_id=spiffe://example.org/node&selector=k8s:ns:web", nonAdmin: true, expectCode: http.StatusForbidden},
+		{name: "without parent id", method: http.MethodGet, path: "/v1/entries/preview?selector=k8s:ns:web", expectCode: http.StatusBadRequest},
+		{name: "without selectors", method: http.MethodGet, path: "/v1/entries/preview?parent_id=spiffe://example.org/node", expectCode: http.StatusBadRequest},
+		{name: "with invalid selector", method: http.MethodGet, path: "/v1/entries/preview?parent_id=spiffe://example.org/node&selector=k8s", expectCode: http.StatusBadRequest},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			caller := test.svid(adminID)
+			if tt.nonAdmin {
+				caller = test.svid(nonAdminID)
+			}
+			resp := test.do(t, tt.method, tt.path, caller)
+			require.Equal(t, tt.expectCode, resp.Code)
+		})
+	}
+}
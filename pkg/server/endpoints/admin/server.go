@@ -0,0 +1,292 @@
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/spire/pkg/common/fips"
+	"github.com/spiffe/spire/pkg/common/profiling"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/pkg/server/api"
+	"github.com/spiffe/spire/pkg/server/api/middleware"
+	"github.com/spiffe/spire/pkg/server/ca"
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/zeebo/errs"
+)
+
+// CAState provides the X.509 CA and JWT key currently used by the server
+type CAState interface {
+	X509CA() *ca.X509CA
+	JWTKey() *ca.JWTKey
+}
+
+// CertificatesGetter returns the certificates served by the admin API and the
+// roots used to verify the client certificates
+type CertificatesGetter func(ctx context.Context) ([]tls.Certificate, *x509.CertPool, error)
+
+type ServerConfig struct {
+	Log                logrus.FieldLogger
+	Address            string
+	TrustDomain        spiffeid.TrustDomain
+	DataStore          datastore.DataStore
+	CA                 CAState
+	EntryFetcher       middleware.EntryFetcher
+	GetCertificates    CertificatesGetter
+	ExpiringSoonWindow time.Duration
+	Clock              clock.Clock
+
+	// ProfilingEnabled serves the runtime profiles under /debug/pprof/
+	ProfilingEnabled bool
+
+	// OwnershipPolicy restricts the rollbacks of the entries to the callers
+	// that created them
+	OwnershipPolicy api.OwnershipPolicy
+
+	// IDPolicy is enforced on the SPIFFE IDs of the entries rolled back
+	IDPolicy api.IDPolicy
+
+	// AgentStaleAfter, if set, serves the report of when the agents were
+	// last seen, in which the agents not seen for longer are stale. It is
+	// only set when the server tracks when the agents were last seen.
+	AgentStaleAfter time.Duration
+
+	// test hooks
+	listen func(network, address string) (net.Listener, error)
+}
+
+// Server serves an HTTP JSON API summarizing the state of the server for
+// dashboards. It also serves the revision history of the registration
+// entries, which entries can be rolled back with, previews which agents and
+// workloads an entry would match before it is created, and looks up which
+// entries and agents could produce a SPIFFE ID. If tracked, it reports when
+// the agents were last seen. Callers authenticate with an X509-SVID of the
+// trust domain and must be admin workloads.
+type Server struct {
+	c ServerConfig
+}
+
+func NewServer(config ServerConfig) *Server {
+	if config.ExpiringSoonWindow <= 0 {
+		config.ExpiringSoonWindow = DefaultExpiringSoonWindow
+	}
+	if config.Clock == nil {
+		config.Clock = clock.New()
+	}
+	if config.listen == nil {
+		config.listen = net.Listen
+	}
+	return &Server{
+		c: config,
+	}
+}
+
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := s.c.listen("tcp", s.c.Address)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	server := &http.Server{
+		Handler: s.handler(),
+		TLSConfig: &tls.Config{ //nolint: gosec // False positive, getTLSConfig is setting MinVersion
+			GetConfigForClient: s.getTLSConfig(ctx),
+		},
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- errs.Wrap(server.ServeTLS(listener, "", ""))
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		server.Close()
+		return nil
+	}
+}
+
+func (s *Server) getTLSConfig(ctx context.Context) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		certs, roots, err := s.c.GetCertificates(ctx)
+		if err != nil {
+			s.c.Log.WithError(err).WithField(telemetry.Address, hello.Conn.RemoteAddr().String()).Error("Could not generate TLS config for admin API client")
+			return nil, err
+		}
+
+		return fips.ConfigureTLS(&tls.Config{
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			Certificates: certs,
+			ClientCAs:    roots,
+			MinVersion:   tls.VersionTLS12,
+		}), nil
+	}
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/summary", s.serveSection(func(ctx context.Context, expiringBefore time.Time) (interface{}, error) {
+		return s.summary(ctx, expiringBefore)
+	}))
+	mux.HandleFunc("/v1/entries", s.serveEntries)
+	mux.HandleFunc("/v1/agents", s.serveSection(func(ctx context.Context, expiringBefore time.Time) (interface{}, error) {
+		return s.agents(ctx, expiringBefore)
+	}))
+	mux.HandleFunc("/v1/bundles", s.serveSection(func(ctx context.Context, expiringBefore time.Time) (interface{}, error) {
+		return s.bundles(ctx, expiringBefore)
+	}))
+	mux.HandleFunc("/v1/ca", s.serveSection(func(ctx context.Context, expiringBefore time.Time) (interface{}, error) {
+		return s.caState(), nil
+	}))
+	mux.HandleFunc("/v1/agents/svid-report", s.serveSVIDReport)
+	mux.HandleFunc("/v1/entries/history", s.serveEntryHistory)
+	mux.HandleFunc("/v1/entries/rollback", s.serveEntryRollback)
+	mux.HandleFunc("/v1/entries/preview", s.serveEntryPreview)
+	mux.HandleFunc("/v1/spiffeids/lookup", s.serveSPIFFEIDLookup)
+	if s.c.AgentStaleAfter > 0 {
+		mux.HandleFunc("/v1/agents/last-seen", s.serveAgentLastSeen)
+	}
+	if s.c.ProfilingEnabled {
+		mux.Handle("/debug/pprof/", s.serveProfiling(profiling.Handler()))
+	}
+	return mux
+}
+
+// serveProfiling authorizes the requests for the runtime profiles. The
+// methods are left to the pprof handler, since the pprof tool looks up
+// symbols with POST requests.
+func (s *Server) serveProfiling(handler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		callerID, err := s.authorize(req)
+		if err != nil {
+			s.c.Log.WithError(err).WithField(telemetry.Address, req.RemoteAddr).Warn("Rejected admin API request")
+			http.Error(w, "403 forbidden", http.StatusForbidden)
+			return
+		}
+
+		s.c.Log.WithFields(logrus.Fields{
+			telemetry.CallerID: callerID.String(),
+			"path":             req.URL.Path,
+		}).Info("Serving runtime profile")
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func (s *Server) serveSection(fn func(ctx context.Context, expiringBefore time.Time) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		callerID, ok := s.authorizeRequest(w, req, http.MethodGet)
+		if !ok {
+			return
+		}
+
+		window := s.c.ExpiringSoonWindow
+		if within := req.URL.Query().Get("within"); within != "" {
+			var err error
+			window, err = time.ParseDuration(within)
+			if err != nil || window < 0 {
+				http.Error(w, fmt.Sprintf("400 invalid within duration %q", within), http.StatusBadRequest)
+				return
+			}
+		}
+
+		resp, err := fn(req.Context(), s.c.Clock.Now().Add(window))
+		if err != nil {
+			s.serveInternalError(w, req, callerID, err, "unable to retrieve server state")
+			return
+		}
+
+		s.writeJSON(w, resp)
+	}
+}
+
+// serveEntries serves the summary of the registration entries. The cluster,
+// namespace and pod parameters restrict it to the entries the registrar
+// created for the workloads of a cluster, namespace or pod, which are then
+// listed.
+func (s *Server) serveEntries(w http.ResponseWriter, req *http.Request) {
+	var byProvenance *datastore.Provenance
+	query := req.URL.Query()
+	provenance := datastore.Provenance{
+		Cluster:   query.Get("cluster"),
+		Namespace: query.Get("namespace"),
+		Pod:       query.Get("pod"),
+	}
+	if !provenance.IsZero() {
+		byProvenance = &provenance
+	}
+
+	s.serveSection(func(ctx context.Context, expiringBefore time.Time) (interface{}, error) {
+		return s.entries(ctx, expiringBefore, byProvenance)
+	})(w, req)
+}
+
+// authorizeRequest checks the method of the request and authorizes the
+// caller, writing the error response if either check fails
+func (s *Server) authorizeRequest(w http.ResponseWriter, req *http.Request, method string) (spiffeid.ID, bool) {
+	if req.Method != method {
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return spiffeid.ID{}, false
+	}
+
+	callerID, err := s.authorize(req)
+	if err != nil {
+		s.c.Log.WithError(err).WithField(telemetry.Address, req.RemoteAddr).Warn("Rejected admin API request")
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return spiffeid.ID{}, false
+	}
+	return callerID, true
+}
+
+func (s *Server) serveInternalError(w http.ResponseWriter, req *http.Request, callerID spiffeid.ID, err error, msg string) {
+	s.c.Log.WithError(err).WithFields(logrus.Fields{
+		telemetry.CallerID: callerID.String(),
+		"path":             req.URL.Path,
+	}).Error("Unable to serve admin API request")
+	http.Error(w, "500 "+msg, http.StatusInternalServerError)
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.c.Log.WithError(err).Debug("Unable to write admin API response")
+	}
+}
+
+// authorize returns the SPIFFE ID of the caller if it is an admin workload of
+// the trust domain
+func (s *Server) authorize(req *http.Request) (spiffeid.ID, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return spiffeid.ID{}, errors.New("no verified client certificate")
+	}
+
+	callerID, err := x509svid.IDFromCert(req.TLS.VerifiedChains[0][0])
+	if err != nil {
+		return spiffeid.ID{}, fmt.Errorf("client certificate is not an X509-SVID: %w", err)
+	}
+	if !callerID.MemberOf(s.c.TrustDomain) {
+		return spiffeid.ID{}, fmt.Errorf("caller %q is not a member of the trust domain", callerID)
+	}
+
+	entries, err := s.c.EntryFetcher.FetchEntries(req.Context(), callerID)
+	if err != nil {
+		return spiffeid.ID{}, fmt.Errorf("unable to fetch caller entries: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Admin {
+			return callerID, nil
+		}
+	}
+	return spiffeid.ID{}, fmt.Errorf("caller %q is not an admin workload", callerID)
+}
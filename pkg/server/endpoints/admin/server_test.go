@@ -0,0 +1,351 @@
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/server/api/middleware"
+	"github.com/spiffe/spire/pkg/server/ca"
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/spiffe/spire/test/clock"
+	"github.com/spiffe/spire/test/fakes/fakedatastore"
+	"github.com/spiffe/spire/test/testca"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	td         = spiffeid.RequireTrustDomainFromString("example.org")
+	adminID    = spiffeid.Must("example.org", "admin")
+	nonAdminID = spiffeid.Must("example.org", "workload")
+	foreignID  = spiffeid.Must("domain.test", "admin")
+)
+
+type fakeCAState struct {
+	x509CA *ca.X509CA
+	jwtKey *ca.JWTKey
+}
+
+func (s fakeCAState) X509CA() *ca.X509CA { return s.x509CA }
+func (s fakeCAState) JWTKey() *ca.JWTKey { return s.jwtKey }
+
+func TestAuthorization(t *testing.T) {
+	test := setupTest(t)
+
+	for _, tt := range []struct {
+		name       string
+		caller     *x509.Certificate
+		expectCode int
+	}{
+		{name: "admin", caller: test.svid(adminID), expectCode: http.StatusOK},
+		{name: "no client certificate", expectCode: http.StatusForbidden},
+		{name: "not an admin", caller: test.svid(nonAdminID), expectCode: http.StatusForbidden},
+		{name: "foreign trust domain", caller: test.foreignCA.CreateX509SVID(foreignID).Certificates[0], expectCode: http.StatusForbidden},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			resp := test.get(t, "/v1/ca", tt.caller)
+			require.Equal(t, tt.expectCode, resp.Code)
+		})
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	test := setupTest(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/summary", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{test.svid(adminID)}}}
+	resp := httptest.NewRecorder()
+	test.server.handler().ServeHTTP(resp, req)
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+
+	resp = test.get(t, "/v1/summary?within=soon", test.svid(adminID))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = test.get(t, "/v1/unknown", test.svid(adminID))
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestSummary(t *testing.T) {
+	test := setupTest(t)
+	ctx := context.Background()
+	now := test.clk.Now()
+
+	_, err := test.ds.CreateRegistrationEntry(ctx, &common.RegistrationEntry{
+		SpiffeId:  "spiffe://example.org/admin",
+		ParentId:  "spiffe://example.org/node",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:0"}},
+		Admin:     true,
+	})
+	require.NoError(t, err)
+	expiringEntry, err := test.ds.CreateRegistrationEntry(ctx, &common.RegistrationEntry{
+		SpiffeId:    "spiffe://example.org/downstream",
+		ParentId:    "spiffe://example.org/node",
+		Selectors:   []*common.Selector{{Type: "unix", Value: "uid:1"}},
+		Downstream:  true,
+		EntryExpiry: now.Add(time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+	_, err = test.ds.CreateRegistrationEntry(ctx, &common.RegistrationEntry{
+		SpiffeId:    "spiffe://example.org/workload",
+		ParentId:    "spiffe://example.org/node",
+		Selectors:   []*common.Selector{{Type: "unix", Value: "uid:2"}},
+		EntryExpiry: now.Add(48 * time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+
+	_, err = test.ds.CreateAttestedNode(ctx, &common.AttestedNode{
+		SpiffeId:            "spiffe://example.org/spire/agent/expiring",
+		AttestationDataType: "join_token",
+		CertSerialNumber:    "1",
+		CertNotAfter:        now.Add(time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+	_, err = test.ds.CreateAttestedNode(ctx, &common.AttestedNode{
+		SpiffeId:            "spiffe://example.org/spire/agent/healthy",
+		AttestationDataType: "join_token",
+		CertSerialNumber:    "2",
+		CertNotAfter:        now.Add(48 * time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+	_, err = test.ds.CreateAttestedNode(ctx, &common.AttestedNode{
+		SpiffeId:            "spiffe://example.org/spire/agent/banned",
+		AttestationDataType: "join_token",
+		CertNotAfter:        now.Add(time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+
+	rootCA, _ := testca.CreateCACertificate(t, nil, nil,
+		testca.WithSubject(pkix.Name{CommonName: "root"}),
+		testca.WithLifetime(now.Add(-time.Hour), now.Add(2*time.Hour)))
+	_, err = test.ds.CreateBundle(ctx, &common.Bundle{
+		TrustDomainId: "spiffe://domain.test",
+		RootCas:       []*common.Certificate{{DerBytes: rootCA.Raw}},
+		JwtSigningKeys: []*common.PublicKey{
+			{Kid: "expiring", PkixBytes: []byte{1}, NotAfter: now.Add(3 * time.Hour).Unix()},
+			{Kid: "no-expiry", PkixBytes: []byte{2}},
+		},
+	})
+	require.NoError(t, err)
+
+	caCert, _ := testca.CreateCACertificate(t, nil, nil,
+		testca.WithSubject(pkix.Name{CommonName: "server ca"}),
+		testca.WithLifetime(now.Add(-time.Hour), now.Add(72*time.Hour)))
+	test.caState.x509CA = &ca.X509CA{Certificate: caCert}
+	test.caState.jwtKey = &ca.JWTKey{Kid: "kid", NotAfter: now.Add(72 * time.Hour)}
+
+	resp := test.get(t, "/v1/summary", test.svid(adminID))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+
+	var summary Summary
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&summary))
+
+	assert.True(t, now.Add(DefaultExpiringSoonWindow).Equal(summary.ExpiringBefore))
+	assert.Equal(t, &EntriesSummary{
+		Count:           3,
+		AdminCount:      1,
+		DownstreamCount: 1,
+		ExpiringSoon: []ExpiringEntry{
+			{
+				ID:        expiringEntry.EntryId,
+				SPIFFEID:  "spiffe://example.org/downstream",
+				ParentID:  "spiffe://example.org/node",
+				ExpiresAt: time.Unix(now.Add(time.Hour).Unix(), 0).UTC(),
+			},
+		},
+	}, summary.Entries)
+	assert.Equal(t, &AgentsSummary{
+		Count:       3,
+		BannedCount: 1,
+		ExpiringSoon: []ExpiringAgent{
+			{
+				ID:              "spiffe://example.org/spire/agent/expiring",
+				AttestationType: "join_token",
+				SerialNumber:    "1",
+				ExpiresAt:       time.Unix(now.Add(time.Hour).Unix(), 0).UTC(),
+			},
+		},
+	}, summary.Agents)
+
+	bundleExpiresAt := rootCA.NotAfter.UTC()
+	assert.Equal(t, &BundlesSummary{
+		Count: 1,
+		Bundles: []BundleState{
+			{
+				TrustDomain:     "spiffe://domain.test",
+				X509Authorities: 1,
+				JWTAuthorities:  2,
+				ExpiresAt:       &bundleExpiresAt,
+			},
+		},
+		ExpiringSoon: []ExpiringAuthority{
+			{TrustDomain: "spiffe://domain.test", Type: "x509", ID: "CN=root", ExpiresAt: bundleExpiresAt},
+			{TrustDomain: "spiffe://domain.test", Type: "jwt", ID: "expiring", ExpiresAt: time.Unix(now.Add(3*time.Hour).Unix(), 0).UTC()},
+		},
+	}, summary.Bundles)
+	assert.Equal(t, &CASummary{
+		X509CA: &X509CAState{
+			Subject:   "CN=server ca",
+			NotBefore: caCert.NotBefore.UTC(),
+			NotAfter:  caCert.NotAfter.UTC(),
+		},
+		JWTKey: &JWTKeyState{
+			KeyID:    "kid",
+			NotAfter: now.Add(72 * time.Hour).UTC(),
+		},
+	}, summary.CA)
+
+	// A shorter window leaves the entries, agents and authorities above out
+	resp = test.get(t, "/v1/summary?within=30m", test.svid(adminID))
+	require.Equal(t, http.StatusOK, resp.Code)
+	summary = Summary{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&summary))
+	assert.Empty(t, summary.Entries.ExpiringSoon)
+	assert.Empty(t, summary.Agents.ExpiringSoon)
+	assert.Empty(t, summary.Bundles.ExpiringSoon)
+}
+
+func TestEntriesByProvenance(t *testing.T) {
+	test := setupTest(t)
+	ctx := context.Background()
+
+	createEntry := func(ctx context.Context, spiffeID string) *common.RegistrationEntry {
+		entry, err := test.ds.CreateRegistrationEntry(ctx, &common.RegistrationEntry{
+			SpiffeId:  spiffeID,
+			ParentId:  "spiffe://example.org/node",
+			Selectors: []*common.Selector{{Type: "k8s", Value: "ns:web"}},
+		})
+		require.NoError(t, err)
+		return entry
+	}
+	web := createEntry(datastore.WithProvenance(ctx, datastore.Provenance{Cluster: "east", Namespace: "web", Pod: "web-0"}), "spiffe://example.org/web")
+	createEntry(datastore.WithProvenance(ctx, datastore.Provenance{Cluster: "east", Namespace: "api", Pod: "api-0"}), "spiffe://example.org/api")
+	createEntry(ctx, "spiffe://example.org/manual")
+
+	resp := test.get(t, "/v1/entries?cluster=east&namespace=web", test.svid(adminID))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var summary EntriesSummary
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&summary))
+	assert.Equal(t, EntriesSummary{
+		Count:        1,
+		ExpiringSoon: []ExpiringEntry{},
+		Entries: []ListedEntry{
+			{ID: web.EntryId, SPIFFEID: "spiffe://example.org/web", ParentID: "spiffe://example.org/node"},
+		},
+	}, summary)
+
+	// Without filter, all the entries are summarized but not listed
+	resp = test.get(t, "/v1/entries", test.svid(adminID))
+	require.Equal(t, http.StatusOK, resp.Code)
+	summary = EntriesSummary{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&summary))
+	assert.Equal(t, 3, summary.Count)
+	assert.Nil(t, summary.Entries)
+}
+
+func TestProfiling(t *testing.T) {
+	test := setupTest(t)
+
+	// Profiles are not served unless enabled
+	resp := test.get(t, "/debug/pprof/goroutine", test.svid(adminID))
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	test.server.c.ProfilingEnabled = true
+	resp = test.get(t, "/debug/pprof/goroutine?debug=1", test.svid(adminID))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "goroutine profile:")
+
+	resp = test.get(t, "/debug/pprof/goroutine", test.svid(nonAdminID))
+	require.Equal(t, http.StatusForbidden, resp.Code)
+
+	resp = test.get(t, "/debug/pprof/heap", nil)
+	require.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestCAStateUnset(t *testing.T) {
+	test := setupTest(t)
+
+	resp := test.get(t, "/v1/ca", test.svid(adminID))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{}`, resp.Body.String())
+}
+
+type serverTest struct {
+	server    *Server
+	ds        *fakedatastore.DataStore
+	clk       *clock.Mock
+	caState   *fakeCAState
+	ca        *testca.CA
+	foreignCA *testca.CA
+
+	// agentEntries are the entries returned by the entry fetcher for agents
+	agentEntries map[spiffeid.ID][]*types.Entry
+}
+
+func setupTest(t *testing.T) *serverTest {
+	log, _ := test.NewNullLogger()
+	test := &serverTest{
+		ds:        fakedatastore.New(t),
+		clk:       clock.NewMock(t),
+		caState:   &fakeCAState{},
+		ca:        testca.New(t, td),
+		foreignCA: testca.New(t, spiffeid.RequireTrustDomainFromString("domain.test")),
+	}
+	test.clk.Set(time.Unix(1600000000, 0))
+	test.server = NewServer(ServerConfig{
+		Log:         log,
+		TrustDomain: td,
+		DataStore:   test.ds,
+		CA:          test.caState,
+		EntryFetcher: middleware.EntryFetcherFunc(func(ctx context.Context, id spiffeid.ID) ([]*types.Entry, error) {
+			switch id {
+			case adminID, foreignID:
+				return []*types.Entry{{Id: "1", Admin: true}}, nil
+			case nonAdminID:
+				return []*types.Entry{{Id: "2"}}, nil
+			default:
+				if entries, ok := test.agentEntries[id]; ok {
+					return entries, nil
+				}
+				return nil, errors.New("ohno")
+			}
+		}),
+		Clock: test.clk,
+	})
+	return test
+}
+
+func (test *serverTest) svid(id spiffeid.ID) *x509.Certificate {
+	return test.ca.CreateX509SVID(id).Certificates[0]
+}
+
+func (test *serverTest) get(t *testing.T, path string, caller *x509.Certificate) *httptest.ResponseRecorder {
+	return test.do(t, http.MethodGet, path, caller)
+}
+
+func (test *serverTest) post(t *testing.T, path string, caller *x509.Certificate) *httptest.ResponseRecorder {
+	return test.do(t, http.MethodPost, path, caller)
+}
+
+func (test *serverTest) do(t *testing.T, method, path string, caller *x509.Certificate) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if caller != nil {
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{caller}}}
+	}
+	resp := httptest.NewRecorder()
+	test.server.handler().ServeHTTP(resp, req)
+	return resp
+}
@@ -0,0 +1,340 @@
+package admin
+
+import (
+	"context"
+	"crypto/x509"
+	"sort"
+	"time"
+
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/proto/spire/common"
+)
+
+// pageSize is the size of the pages of entries and agents read from the
+// datastore
+const pageSize = 1000
+
+// Summary aggregates the state of the server
+type Summary struct {
+	ExpiringBefore time.Time       `json:"expiring_before"`
+	Entries        *EntriesSummary `json:"entries"`
+	Agents         *AgentsSummary  `json:"agents"`
+	Bundles        *BundlesSummary `json:"bundles"`
+	CA             *CASummary      `json:"ca"`
+}
+
+// EntriesSummary summarizes the registration entries
+type EntriesSummary struct {
+	Count           int             `json:"count"`
+	AdminCount      int             `json:"admin_count"`
+	DownstreamCount int             `json:"downstream_count"`
+	ExpiringSoon    []ExpiringEntry `json:"expiring_soon"`
+	// Entries lists the entries when they are filtered by provenance
+	Entries []ListedEntry `json:"entries,omitempty"`
+}
+
+// ListedEntry is a registration entry listed by provenance
+type ListedEntry struct {
+	ID       string `json:"id"`
+	SPIFFEID string `json:"spiffe_id"`
+	ParentID string `json:"parent_id"`
+}
+
+// ExpiringEntry is a registration entry that expires before the requested time
+type ExpiringEntry struct {
+	ID        string    `json:"id"`
+	SPIFFEID  string    `json:"spiffe_id"`
+	ParentID  string    `json:"parent_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AgentsSummary summarizes the attested agents
+type AgentsSummary struct {
+	Count        int             `json:"count"`
+	BannedCount  int             `json:"banned_count"`
+	ExpiringSoon []ExpiringAgent `json:"expiring_soon"`
+}
+
+// ExpiringAgent is an agent whose SVID expires before the requested time,
+// which usually means the agent is not renewing it
+type ExpiringAgent struct {
+	ID              string    `json:"id"`
+	AttestationType string    `json:"attestation_type"`
+	SerialNumber    string    `json:"serial_number"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+// BundlesSummary summarizes the bundles of the trust domain and of the
+// federated trust domains
+type BundlesSummary struct {
+	Count        int                 `json:"count"`
+	Bundles      []BundleState       `json:"bundles"`
+	ExpiringSoon []ExpiringAuthority `json:"expiring_soon"`
+}
+
+// BundleState summarizes the bundle of a trust domain
+type BundleState struct {
+	TrustDomain     string `json:"trust_domain"`
+	X509Authorities int    `json:"x509_authorities"`
+	JWTAuthorities  int    `json:"jwt_authorities"`
+	// ExpiresAt is when the first of the authorities of the bundle expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ExpiringAuthority is an authority of a bundle that expires before the
+// requested time
+type ExpiringAuthority struct {
+	TrustDomain string `json:"trust_domain"`
+	// Type is either "x509" or "jwt"
+	Type string `json:"type"`
+	// ID is the subject of X.509 authorities and the key ID of JWT authorities
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CASummary describes the X.509 CA and JWT key currently used by the server
+type CASummary struct {
+	X509CA *X509CAState `json:"x509_ca,omitempty"`
+	JWTKey *JWTKeyState `json:"jwt_key,omitempty"`
+}
+
+// X509CAState describes the X.509 CA currently used by the server
+type X509CAState struct {
+	Subject   string    `json:"subject"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	// UpstreamAuthority is whether the CA is signed by an upstream authority
+	UpstreamAuthority bool `json:"upstream_authority"`
+}
+
+// JWTKeyState describes the JWT key currently used by the server
+type JWTKeyState struct {
+	KeyID    string    `json:"key_id"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+func (s *Server) summary(ctx context.Context, expiringBefore time.Time) (*Summary, error) {
+	entries, err := s.entries(ctx, expiringBefore, nil)
+	if err != nil {
+		return nil, err
+	}
+	agents, err := s.agents(ctx, expiringBefore)
+	if err != nil {
+		return nil, err
+	}
+	bundles, err := s.bundles(ctx, expiringBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Summary{
+		ExpiringBefore: expiringBefore.UTC(),
+		Entries:        entries,
+		Agents:         agents,
+		Bundles:        bundles,
+		CA:             s.caState(),
+	}, nil
+}
+
+// entries summarizes the registration entries, or only those created with
+// the provenance, which are then listed, if set
+func (s *Server) entries(ctx context.Context, expiringBefore time.Time, byProvenance *datastore.Provenance) (*EntriesSummary, error) {
+	summary := &EntriesSummary{
+		ExpiringSoon: []ExpiringEntry{},
+	}
+	if byProvenance != nil {
+		summary.Entries = []ListedEntry{}
+	}
+
+	req := &datastore.ListRegistrationEntriesRequest{
+		Pagination:   &datastore.Pagination{PageSize: pageSize},
+		ByProvenance: byProvenance,
+	}
+	for {
+		resp, err := s.c.DataStore.ListRegistrationEntries(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range resp.Entries {
+			if byProvenance != nil {
+				summary.Entries = append(summary.Entries, ListedEntry{
+					ID:       entry.EntryId,
+					SPIFFEID: entry.SpiffeId,
+					ParentID: entry.ParentId,
+				})
+			}
+			summary.Count++
+			if entry.Admin {
+				summary.AdminCount++
+			}
+			if entry.Downstream {
+				summary.DownstreamCount++
+			}
+			if entry.EntryExpiry != 0 && time.Unix(entry.EntryExpiry, 0).Before(expiringBefore) {
+				summary.ExpiringSoon = append(summary.ExpiringSoon, ExpiringEntry{
+					ID:        entry.EntryId,
+					SPIFFEID:  entry.SpiffeId,
+					ParentID:  entry.ParentId,
+					ExpiresAt: time.Unix(entry.EntryExpiry, 0).UTC(),
+				})
+			}
+		}
+
+		if len(resp.Entries) == 0 || resp.Pagination == nil || resp.Pagination.Token == "" {
+			break
+		}
+		req.Pagination.Token = resp.Pagination.Token
+	}
+
+	sort.Slice(summary.ExpiringSoon, func(i, j int) bool {
+		return summary.ExpiringSoon[i].ExpiresAt.Before(summary.ExpiringSoon[j].ExpiresAt)
+	})
+	return summary, nil
+}
+
+func (s *Server) agents(ctx context.Context, expiringBefore time.Time) (*AgentsSummary, error) {
+	count, err := s.c.DataStore.CountAttestedNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	banned := true
+	bannedNodes, err := s.listAttestedNodes(ctx, &datastore.ListAttestedNodesRequest{
+		ByBanned: &banned,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notBanned := false
+	expiringNodes, err := s.listAttestedNodes(ctx, &datastore.ListAttestedNodesRequest{
+		ByBanned:        &notBanned,
+		ByExpiresBefore: expiringBefore,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &AgentsSummary{
+		Count:        int(count),
+		BannedCount:  len(bannedNodes),
+		ExpiringSoon: []ExpiringAgent{},
+	}
+	for _, node := range expiringNodes {
+		summary.ExpiringSoon = append(summary.ExpiringSoon, ExpiringAgent{
+			ID:              node.SpiffeId,
+			AttestationType: node.AttestationDataType,
+			SerialNumber:    node.CertSerialNumber,
+			ExpiresAt:       time.Unix(node.CertNotAfter, 0).UTC(),
+		})
+	}
+	sort.Slice(summary.ExpiringSoon, func(i, j int) bool {
+		return summary.ExpiringSoon[i].ExpiresAt.Before(summary.ExpiringSoon[j].ExpiresAt)
+	})
+	return summary, nil
+}
+
+func (s *Server) listAttestedNodes(ctx context.Context, req *datastore.ListAttestedNodesRequest) ([]*common.AttestedNode, error) {
+	req.Pagination = &datastore.Pagination{PageSize: pageSize}
+
+	var nodes []*common.AttestedNode
+	for {
+		resp, err := s.c.DataStore.ListAttestedNodes(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, resp.Nodes...)
+
+		if len(resp.Nodes) == 0 || resp.Pagination == nil || resp.Pagination.Token == "" {
+			return nodes, nil
+		}
+		req.Pagination.Token = resp.Pagination.Token
+	}
+}
+
+func (s *Server) bundles(ctx context.Context, expiringBefore time.Time) (*BundlesSummary, error) {
+	resp, err := s.c.DataStore.ListBundles(ctx, &datastore.ListBundlesRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &BundlesSummary{
+		Count:        len(resp.Bundles),
+		Bundles:      []BundleState{},
+		ExpiringSoon: []ExpiringAuthority{},
+	}
+	for _, bundle := range resp.Bundles {
+		state := BundleState{
+			TrustDomain:    bundle.TrustDomainId,
+			JWTAuthorities: len(bundle.JwtSigningKeys),
+		}
+		observeExpiry := func(authorityType, id string, expiresAt time.Time) {
+			if state.ExpiresAt == nil || expiresAt.Before(*state.ExpiresAt) {
+				state.ExpiresAt = &expiresAt
+			}
+			if expiresAt.Before(expiringBefore) {
+				summary.ExpiringSoon = append(summary.ExpiringSoon, ExpiringAuthority{
+					TrustDomain: bundle.TrustDomainId,
+					Type:        authorityType,
+					ID:          id,
+					ExpiresAt:   expiresAt,
+				})
+			}
+		}
+
+		for _, rootCA := range bundle.RootCas {
+			certs, err := x509.ParseCertificates(rootCA.DerBytes)
+			if err != nil {
+				// Bundles are validated when stored; an unparsable
+				// authority is counted but can't be inspected
+				s.c.Log.WithError(err).WithField("trust_domain", bundle.TrustDomainId).Warn("Unable to parse X.509 authority of bundle")
+				state.X509Authorities++
+				continue
+			}
+			for _, cert := range certs {
+				state.X509Authorities++
+				observeExpiry("x509", cert.Subject.String(), cert.NotAfter.UTC())
+			}
+		}
+		for _, key := range bundle.JwtSigningKeys {
+			// Keys without expiration never expire
+			if key.NotAfter != 0 {
+				observeExpiry("jwt", key.Kid, time.Unix(key.NotAfter, 0).UTC())
+			}
+		}
+
+		summary.Bundles = append(summary.Bundles, state)
+	}
+
+	sort.Slice(summary.Bundles, func(i, j int) bool {
+		return summary.Bundles[i].TrustDomain < summary.Bundles[j].TrustDomain
+	})
+	sort.Slice(summary.ExpiringSoon, func(i, j int) bool {
+		return summary.ExpiringSoon[i].ExpiresAt.Before(summary.ExpiringSoon[j].ExpiresAt)
+	})
+	return summary, nil
+}
+
+func (s *Server) caState() *CASummary {
+	summary := &CASummary{}
+	if s.c.CA == nil {
+		return summary
+	}
+
+	if x509CA := s.c.CA.X509CA(); x509CA != nil {
+		summary.X509CA = &X509CAState{
+			Subject:           x509CA.Certificate.Subject.String(),
+			NotBefore:         x509CA.Certificate.NotBefore.UTC(),
+			NotAfter:          x509CA.Certificate.NotAfter.UTC(),
+			UpstreamAuthority: len(x509CA.UpstreamChain) > 0,
+		}
+	}
+	if jwtKey := s.c.CA.JWTKey(); jwtKey != nil {
+		summary.JWTKey = &JWTKeyState{
+			KeyID:    jwtKey.Kid,
+			NotAfter: jwtKey.NotAfter.UTC(),
+		}
+	}
+	return summary
+}
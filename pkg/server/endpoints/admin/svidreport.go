@@ -0,0 +1,184 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spiffe/spire/pkg/server/datastore"
+)
+
+// DefaultSVIDReportBuckets are the upper bounds of the time-to-expiry buckets
+// of the agent SVID report. Agents renew their SVID when half of its lifetime
+// has elapsed, so with the default agent TTL of one hour, agents in any
+// bucket but the first are usually rotating fine.
+var DefaultSVIDReportBuckets = []time.Duration{
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// SVIDReport reports the expiration of the SVIDs of the agents, bucketed by
+// time to expiry. Agents that fail to rotate their SVID drift towards the
+// first buckets.
+type SVIDReport struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	AgentCount  int                `json:"agent_count"`
+	Buckets     []SVIDReportBucket `json:"buckets"`
+}
+
+// SVIDReportBucket holds the agents whose SVID expires within a time range,
+// relative to when the report was generated
+type SVIDReportBucket struct {
+	// Name describes the time range, e.g. "expired", "< 1h" or "1h - 6h"
+	Name string `json:"name"`
+	// ExpiresBefore is the upper bound of the time range. It is unset for
+	// the last bucket.
+	ExpiresBefore *time.Time  `json:"expires_before,omitempty"`
+	Agents        []AgentSVID `json:"agents"`
+}
+
+// AgentSVID describes the SVID of an agent
+type AgentSVID struct {
+	ID              string    `json:"id"`
+	AttestationType string    `json:"attestation_type"`
+	SerialNumber    string    `json:"serial_number"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+// NewSVIDReport buckets the agent SVIDs by time to expiry. The bounds are the
+// upper bounds of the buckets besides the "expired" bucket, in increasing
+// order; SVIDs expiring after the last bound go in a last bucket. The agents
+// of each bucket are sorted by expiration time.
+func NewSVIDReport(now time.Time, bounds []time.Duration, agents []AgentSVID) *SVIDReport {
+	report := &SVIDReport{
+		GeneratedAt: now.UTC(),
+		AgentCount:  len(agents),
+		Buckets:     make([]SVIDReportBucket, 0, len(bounds)+2),
+	}
+
+	expired := now.UTC()
+	report.Buckets = append(report.Buckets, SVIDReportBucket{
+		Name:          "expired",
+		ExpiresBefore: &expired,
+		Agents:        []AgentSVID{},
+	})
+	for i, bound := range bounds {
+		name := "< " + formatBound(bound)
+		if i > 0 {
+			name = formatBound(bounds[i-1]) + " - " + formatBound(bound)
+		}
+		expiresBefore := now.Add(bound).UTC()
+		report.Buckets = append(report.Buckets, SVIDReportBucket{
+			Name:          name,
+			ExpiresBefore: &expiresBefore,
+			Agents:        []AgentSVID{},
+		})
+	}
+	last := ">= 0s"
+	if len(bounds) > 0 {
+		last = ">= " + formatBound(bounds[len(bounds)-1])
+	}
+	report.Buckets = append(report.Buckets, SVIDReportBucket{
+		Name:   last,
+		Agents: []AgentSVID{},
+	})
+
+	sorted := make([]AgentSVID, len(agents))
+	copy(sorted, agents)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ExpiresAt.Before(sorted[j].ExpiresAt)
+	})
+	for _, agent := range sorted {
+		i := sort.Search(len(report.Buckets)-1, func(i int) bool {
+			return agent.ExpiresAt.Before(*report.Buckets[i].ExpiresBefore)
+		})
+		report.Buckets[i].Agents = append(report.Buckets[i].Agents, agent)
+	}
+	return report
+}
+
+// ParseSVIDReportBuckets parses a comma separated list of durations, e.g.
+// "1h,6h,24h", into the bounds of the report buckets
+func ParseSVIDReportBuckets(s string) ([]time.Duration, error) {
+	var bounds []time.Duration
+	for _, field := range strings.Split(s, ",") {
+		bound, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket %q: %w", field, err)
+		}
+		if bound <= 0 {
+			return nil, fmt.Errorf("invalid bucket %q: must be positive", field)
+		}
+		if len(bounds) > 0 && bound <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("invalid bucket %q: buckets must be in increasing order", field)
+		}
+		bounds = append(bounds, bound)
+	}
+	return bounds, nil
+}
+
+// formatBound formats the bucket bounds without the zero minutes and seconds
+// time.Duration.String adds, e.g. "6h" rather than "6h0m0s"
+func formatBound(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+func (s *Server) serveSVIDReport(w http.ResponseWriter, req *http.Request) {
+	callerID, ok := s.authorizeRequest(w, req, http.MethodGet)
+	if !ok {
+		return
+	}
+
+	bounds := DefaultSVIDReportBuckets
+	if buckets := req.URL.Query().Get("buckets"); buckets != "" {
+		var err error
+		bounds, err = ParseSVIDReportBuckets(buckets)
+		if err != nil {
+			http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := s.svidReport(req.Context(), bounds)
+	if err != nil {
+		s.serveInternalError(w, req, callerID, err, "unable to retrieve agents")
+		return
+	}
+
+	s.writeJSON(w, report)
+}
+
+// svidReport reports the SVID expiration of the agents that are not banned.
+// Banned agents cannot renew their SVID, so they would only add noise.
+func (s *Server) svidReport(ctx context.Context, bounds []time.Duration) (*SVIDReport, error) {
+	notBanned := false
+	nodes, err := s.listAttestedNodes(ctx, &datastore.ListAttestedNodesRequest{
+		ByBanned: &notBanned,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	agents := make([]AgentSVID, 0, len(nodes))
+	for _, node := range nodes {
+		agents = append(agents, AgentSVID{
+			ID:              node.SpiffeId,
+			AttestationType: node.AttestationDataType,
+			SerialNumber:    node.CertSerialNumber,
+			ExpiresAt:       time.Unix(node.CertNotAfter, 0).UTC(),
+		})
+	}
+	return NewSVIDReport(s.c.Clock.Now(), bounds, agents), nil
+}
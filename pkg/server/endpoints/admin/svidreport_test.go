@@ -0,0 +1,116 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSVIDReport(t *testing.T) {
+	now := time.Unix(1600000000, 0).UTC()
+	agent := func(id string, expiresIn time.Duration) AgentSVID {
+		return AgentSVID{ID: id, ExpiresAt: now.Add(expiresIn)}
+	}
+	at := func(d time.Duration) *time.Time {
+		ts := now.Add(d)
+		return &ts
+	}
+
+	report := NewSVIDReport(now, []time.Duration{time.Hour, 90 * time.Minute}, []AgentSVID{
+		agent("later", 48*time.Hour),
+		agent("expired", -time.Second),
+		agent("boundary", time.Hour),
+		agent("soon", 10*time.Minute),
+		agent("sooner", time.Minute),
+		agent("now", 0),
+	})
+
+	assert.Equal(t, &SVIDReport{
+		GeneratedAt: now,
+		AgentCount:  6,
+		Buckets: []SVIDReportBucket{
+			{
+				Name:          "expired",
+				ExpiresBefore: at(0),
+				Agents:        []AgentSVID{agent("expired", -time.Second)},
+			},
+			{
+				Name:          "< 1h",
+				ExpiresBefore: at(time.Hour),
+				Agents:        []AgentSVID{agent("now", 0), agent("sooner", time.Minute), agent("soon", 10*time.Minute)},
+			},
+			{
+				Name:          "1h - 90m",
+				ExpiresBefore: at(90 * time.Minute),
+				Agents:        []AgentSVID{agent("boundary", time.Hour)},
+			},
+			{
+				Name:   ">= 90m",
+				Agents: []AgentSVID{agent("later", 48*time.Hour)},
+			},
+		},
+	}, report)
+}
+
+func TestParseSVIDReportBuckets(t *testing.T) {
+	bounds, err := ParseSVIDReportBuckets("1h, 6h,24h")
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour}, bounds)
+
+	_, err = ParseSVIDReportBuckets("1h,soon")
+	assert.EqualError(t, err, `invalid bucket "soon": time: invalid duration "soon"`)
+	_, err = ParseSVIDReportBuckets("0s")
+	assert.EqualError(t, err, `invalid bucket "0s": must be positive`)
+	_, err = ParseSVIDReportBuckets("6h,1h")
+	assert.EqualError(t, err, `invalid bucket "1h": buckets must be in increasing order`)
+}
+
+func TestServeSVIDReport(t *testing.T) {
+	test := setupTest(t)
+	ctx := context.Background()
+	now := test.clk.Now()
+
+	for _, node := range []*common.AttestedNode{
+		{SpiffeId: "spiffe://example.org/spire/agent/stuck", AttestationDataType: "join_token", CertSerialNumber: "1", CertNotAfter: now.Add(-time.Hour).Unix()},
+		{SpiffeId: "spiffe://example.org/spire/agent/healthy", AttestationDataType: "join_token", CertSerialNumber: "2", CertNotAfter: now.Add(30 * time.Minute).Unix()},
+		{SpiffeId: "spiffe://example.org/spire/agent/banned", AttestationDataType: "join_token", CertNotAfter: now.Add(-time.Hour).Unix()},
+	} {
+		_, err := test.ds.CreateAttestedNode(ctx, node)
+		require.NoError(t, err)
+	}
+
+	resp := test.get(t, "/v1/agents/svid-report?buckets=1h", test.svid(adminID))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var report SVIDReport
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+
+	// The banned agent is left out
+	assert.Equal(t, 2, report.AgentCount)
+	require.Len(t, report.Buckets, 3)
+	assert.Equal(t, []AgentSVID{
+		{ID: "spiffe://example.org/spire/agent/stuck", AttestationType: "join_token", SerialNumber: "1", ExpiresAt: now.Add(-time.Hour).UTC()},
+	}, report.Buckets[0].Agents)
+	assert.Equal(t, []AgentSVID{
+		{ID: "spiffe://example.org/spire/agent/healthy", AttestationType: "join_token", SerialNumber: "2", ExpiresAt: now.Add(30 * time.Minute).UTC()},
+	}, report.Buckets[1].Agents)
+	assert.Empty(t, report.Buckets[2].Agents)
+
+	// The default buckets are used unless requested otherwise
+	resp = test.get(t, "/v1/agents/svid-report", test.svid(adminID))
+	require.Equal(t, http.StatusOK, resp.Code)
+	report = SVIDReport{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Len(t, report.Buckets, len(DefaultSVIDReportBuckets)+2)
+
+	resp = test.get(t, "/v1/agents/svid-report?buckets=6h,1h", test.svid(adminID))
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = test.get(t, "/v1/agents/svid-report", test.svid(nonAdminID))
+	require.Equal(t, http.StatusForbidden, resp.Code)
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/spiffe/spire/pkg/common/bundleutil"
+	"github.com/spiffe/spire/pkg/common/fips"
 	"github.com/zeebo/errs"
 )
 
@@ -60,6 +61,7 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 	// Set up the TLS config, setting TLS 1.2 as the minimum.
 	tlsConfig := s.c.ServerAuth.GetTLSConfig()
 	tlsConfig.MinVersion = tls.VersionTLS12
+	fips.ConfigureTLS(tlsConfig)
 
 	server := &http.Server{
 		Handler:   http.HandlerFunc(s.serveHTTP),
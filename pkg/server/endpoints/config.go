@@ -18,12 +18,18 @@ import (
 	debugv1 "github.com/spiffe/spire/pkg/server/api/debug/v1"
 	entryv1 "github.com/spiffe/spire/pkg/server/api/entry/v1"
 	healthv1 "github.com/spiffe/spire/pkg/server/api/health/v1"
+	"github.com/spiffe/spire/pkg/server/api/middleware"
 	svidv1 "github.com/spiffe/spire/pkg/server/api/svid/v1"
 	"github.com/spiffe/spire/pkg/server/ca"
 	"github.com/spiffe/spire/pkg/server/cache/dscache"
+	"github.com/spiffe/spire/pkg/server/cache/entrycache"
 	"github.com/spiffe/spire/pkg/server/catalog"
+	"github.com/spiffe/spire/pkg/server/cloudevents"
+	"github.com/spiffe/spire/pkg/server/endpoints/admin"
 	"github.com/spiffe/spire/pkg/server/endpoints/bundle"
 	"github.com/spiffe/spire/pkg/server/endpoints/registration"
+	"github.com/spiffe/spire/pkg/server/lastseen"
+	"github.com/spiffe/spire/pkg/server/nodeevents"
 	"github.com/spiffe/spire/pkg/server/svid"
 	"golang.org/x/net/context"
 )
@@ -51,6 +57,12 @@ type Config struct {
 	// Bundle endpoint configuration
 	BundleEndpoint bundle.EndpointConfig
 
+	// Admin API configuration
+	AdminAPI admin.EndpointConfig
+
+	// CAState provides the current CA to the admin API
+	CAState admin.CAState
+
 	// CA Manager
 	Manager *ca.Manager
 
@@ -60,6 +72,22 @@ type Config struct {
 	// RateLimit holds rate limiting configurations.
 	RateLimit RateLimitConfig
 
+	// DownstreamPolicy restricts which downstream workloads can call the
+	// downstream APIs
+	DownstreamPolicy middleware.DownstreamPolicy
+
+	// IDPolicy is enforced on the SPIFFE IDs of the created and updated
+	// entries
+	IDPolicy api.IDPolicy
+
+	// OwnershipPolicy restricts the updates and deletions of the entries to
+	// the callers that created them
+	OwnershipPolicy api.OwnershipPolicy
+
+	// EntryTemplates are instantiated as registration entries for each of
+	// the agents they match
+	EntryTemplates []*entrycache.Template
+
 	Uptime func() time.Duration
 
 	Clock clock.Clock
@@ -68,15 +96,33 @@ type Config struct {
 	CacheReloadInterval time.Duration
 
 	AuditLogEnabled bool
+
+	// DrainTimeout, if set, makes the server drain the API endpoints on
+	// shutdown, waiting up to the timeout for the in-flight RPCs to finish
+	DrainTimeout time.Duration
+
+	// NodeEvents, if set, is notified when agents attest, are banned or are
+	// deleted
+	NodeEvents nodeevents.Notifier
+
+	// X509SVIDEvents, if set, is notified of the X509-SVIDs issued for
+	// registration entries
+	X509SVIDEvents cloudevents.X509SVIDNotifier
+
+	// AgentLastSeen, if set, records when the agents sync their authorized
+	// entries. The admin API then reports when the agents were last seen.
+	AgentLastSeen *lastseen.Tracker
 }
 
 func (c *Config) makeOldAPIServers() OldAPIServers {
 	registrationHandler := &registration.Handler{
-		Log:         c.Log.WithField(telemetry.SubsystemName, telemetry.RegistrationAPI),
-		Metrics:     c.Metrics,
-		Catalog:     c.Catalog,
-		TrustDomain: c.TrustDomain,
-		ServerCA:    c.ServerCA,
+		Log:             c.Log.WithField(telemetry.SubsystemName, telemetry.RegistrationAPI),
+		Metrics:         c.Metrics,
+		Catalog:         c.Catalog,
+		TrustDomain:     c.TrustDomain,
+		ServerCA:        c.ServerCA,
+		IDPolicy:        c.IDPolicy,
+		OwnershipPolicy: c.OwnershipPolicy,
 	}
 
 	return OldAPIServers{
@@ -118,10 +164,43 @@ func (c *Config) maybeMakeBundleEndpointServer() Server {
 	})
 }
 
+func (c *Config) maybeMakeAdminServer(getCertificates admin.CertificatesGetter) Server {
+	if c.AdminAPI.Address == nil {
+		return nil
+	}
+	c.Log.WithField("addr", c.AdminAPI.Address).Info("Serving admin API")
+
+	ds := c.Catalog.GetDataStore()
+	var agentStaleAfter time.Duration
+	if c.AgentLastSeen != nil {
+		agentStaleAfter = c.AgentLastSeen.StaleAfter()
+	}
+	return admin.NewServer(admin.ServerConfig{
+		Log:                c.Log.WithField(telemetry.SubsystemName, "admin_api"),
+		Address:            c.AdminAPI.Address.String(),
+		TrustDomain:        c.TrustDomain,
+		DataStore:          ds,
+		CA:                 c.CAState,
+		EntryFetcher:       EntryFetcher(ds),
+		GetCertificates:    getCertificates,
+		ExpiringSoonWindow: c.AdminAPI.ExpiringSoonWindow,
+		Clock:              c.Clock,
+		ProfilingEnabled:   c.AdminAPI.ProfilingEnabled,
+		OwnershipPolicy:    c.OwnershipPolicy,
+		IDPolicy:           c.IDPolicy,
+		AgentStaleAfter:    agentStaleAfter,
+	})
+}
+
 func (c *Config) makeAPIServers(entryFetcher api.AuthorizedEntryFetcher) APIServers {
 	ds := c.Catalog.GetDataStore()
 	upstreamPublisher := UpstreamPublisher(c.Manager)
 
+	var agentSeen api.AgentSeenRecorder
+	if c.AgentLastSeen != nil {
+		agentSeen = c.AgentLastSeen
+	}
+
 	return APIServers{
 		AgentServer: agentv1.New(agentv1.Config{
 			DataStore:   ds,
@@ -129,6 +208,7 @@ func (c *Config) makeAPIServers(entryFetcher api.AuthorizedEntryFetcher) APIServ
 			TrustDomain: c.TrustDomain,
 			Catalog:     c.Catalog,
 			Clock:       c.Clock,
+			NodeEvents:  c.NodeEvents,
 		}),
 		BundleServer: bundlev1.New(bundlev1.Config{
 			TrustDomain:       c.TrustDomain,
@@ -143,9 +223,12 @@ func (c *Config) makeAPIServers(entryFetcher api.AuthorizedEntryFetcher) APIServ
 			Uptime:       c.Uptime,
 		}),
 		EntryServer: entryv1.New(entryv1.Config{
-			TrustDomain:  c.TrustDomain,
-			DataStore:    ds,
-			EntryFetcher: entryFetcher,
+			TrustDomain:     c.TrustDomain,
+			DataStore:       ds,
+			EntryFetcher:    entryFetcher,
+			IDPolicy:        c.IDPolicy,
+			OwnershipPolicy: c.OwnershipPolicy,
+			AgentSeen:       agentSeen,
 		}),
 		HealthServer: healthv1.New(healthv1.Config{
 			TrustDomain: c.TrustDomain,
@@ -156,6 +239,8 @@ func (c *Config) makeAPIServers(entryFetcher api.AuthorizedEntryFetcher) APIServ
 			EntryFetcher: entryFetcher,
 			ServerCA:     c.ServerCA,
 			DataStore:    ds,
+
+			X509SVIDEvents: c.X509SVIDEvents,
 		}),
 	}
 }
@@ -14,6 +14,9 @@ import (
 	"golang.org/x/net/http2"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+
+	// Registers the gzip compressor agents may sync entries and bundles with
+	_ "google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
 
@@ -26,7 +29,9 @@ import (
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	svidv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/svid/v1"
 	"github.com/spiffe/spire/pkg/common/auth"
+	"github.com/spiffe/spire/pkg/common/fips"
 	"github.com/spiffe/spire/pkg/common/peertracker"
+	"github.com/spiffe/spire/pkg/common/systemd"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	"github.com/spiffe/spire/pkg/common/util"
 	"github.com/spiffe/spire/pkg/server/api/middleware"
@@ -66,11 +71,15 @@ type Endpoints struct {
 	DataStore                    datastore.DataStore
 	APIServers                   APIServers
 	BundleEndpointServer         Server
+	AdminServer                  Server
 	Log                          logrus.FieldLogger
 	Metrics                      telemetry.Metrics
 	RateLimit                    RateLimitConfig
+	DownstreamPolicy             middleware.DownstreamPolicy
 	EntryFetcherCacheRebuildTask func(context.Context) error
 	AuditLogEnabled              bool
+	DrainTimeout                 time.Duration
+	Clock                        clock.Clock
 }
 
 type OldAPIServers struct {
@@ -93,6 +102,14 @@ type RateLimitConfig struct {
 
 	// Signing, if true, rate limits JWT and X509 signing requests
 	Signing bool
+
+	// AgentSigningQuota is the number of SVIDs each agent can have signed
+	// per minute. Zero disables the quota.
+	AgentSigningQuota int
+
+	// DownstreamSigningQuota is the number of CA certificates each
+	// downstream server can have signed per minute. Zero disables the quota.
+	DownstreamSigningQuota int
 }
 
 // New creates new endpoints struct
@@ -106,7 +123,7 @@ func New(ctx context.Context, c Config) (*Endpoints, error) {
 	buildCacheFn := func(ctx context.Context) (_ entrycache.Cache, err error) {
 		call := telemetry.StartCall(c.Metrics, telemetry.Entry, telemetry.Cache, telemetry.Reload)
 		defer call.Done(&err)
-		return entrycache.BuildFromDataStore(ctx, c.Catalog.GetDataStore())
+		return entrycache.BuildFromDataStore(ctx, c.Catalog.GetDataStore(), c.EntryTemplates...)
 	}
 
 	if c.CacheReloadInterval == 0 {
@@ -118,7 +135,7 @@ func New(ctx context.Context, c Config) (*Endpoints, error) {
 		return nil, err
 	}
 
-	return &Endpoints{
+	e := &Endpoints{
 		OldAPIServers:                oldAPIServers,
 		TCPAddr:                      c.TCPAddr,
 		UDSAddr:                      c.UDSAddr,
@@ -130,9 +147,15 @@ func New(ctx context.Context, c Config) (*Endpoints, error) {
 		Log:                          c.Log,
 		Metrics:                      c.Metrics,
 		RateLimit:                    c.RateLimit,
+		DownstreamPolicy:             c.DownstreamPolicy,
 		EntryFetcherCacheRebuildTask: ef.RunRebuildCacheTask,
 		AuditLogEnabled:              c.AuditLogEnabled,
-	}, nil
+		DrainTimeout:                 c.DrainTimeout,
+		Clock:                        c.Clock,
+	}
+	// The admin API is served with the same credentials as the server APIs
+	e.AdminServer = c.maybeMakeAdminServer(e.getCerts)
+	return e, nil
 }
 
 // ListenAndServe starts all endpoint servers and blocks until the context
@@ -179,6 +202,10 @@ func (e *Endpoints) ListenAndServe(ctx context.Context) error {
 		tasks = append(tasks, e.BundleEndpointServer.ListenAndServe)
 	}
 
+	if e.AdminServer != nil {
+		tasks = append(tasks, e.AdminServer.ListenAndServe)
+	}
+
 	err := util.RunTasks(ctx, tasks...)
 	if errors.Is(err, context.Canceled) {
 		err = nil
@@ -218,7 +245,7 @@ func (e *Endpoints) createUDSServer(unaryInterceptor grpc.UnaryServerInterceptor
 
 // runTCPServer will start the server and block until it exits or we are dying.
 func (e *Endpoints) runTCPServer(ctx context.Context, server *grpc.Server) error {
-	l, err := net.Listen(e.TCPAddr.Network(), e.TCPAddr.String())
+	l, err := systemd.ListenTCP(e.TCPAddr.Network(), e.TCPAddr)
 	if err != nil {
 		return err
 	}
@@ -235,7 +262,7 @@ func (e *Endpoints) runTCPServer(ctx context.Context, server *grpc.Server) error
 		return err
 	case <-ctx.Done():
 		e.Log.Info("Stopping TCP server")
-		server.Stop()
+		e.stopServer(server)
 		<-errChan
 		e.Log.Info("TCP server has stopped")
 		return nil
@@ -244,16 +271,21 @@ func (e *Endpoints) runTCPServer(ctx context.Context, server *grpc.Server) error
 
 // runUDSServer  will start the server and block until it exits or we are dying.
 func (e *Endpoints) runUDSServer(ctx context.Context, server *grpc.Server) error {
-	os.Remove(e.UDSAddr.String())
+	// A socket passed by systemd socket activation is managed by systemd
+	socketActivated := systemd.IsSocketActivated(e.UDSAddr)
+	if !socketActivated {
+		os.Remove(e.UDSAddr.String())
+	}
 	var l net.Listener
 	var err error
 	if e.AuditLogEnabled {
 		unixListener := &peertracker.ListenerFactory{
-			Log: e.Log,
+			Log:             e.Log,
+			NewUnixListener: systemd.ListenUnix,
 		}
 		l, err = unixListener.ListenUnix(e.UDSAddr.Network(), e.UDSAddr)
 	} else {
-		l, err = net.ListenUnix(e.UDSAddr.Network(), e.UDSAddr)
+		l, err = systemd.ListenUnix(e.UDSAddr.Network(), e.UDSAddr)
 	}
 
 	if err != nil {
@@ -263,8 +295,10 @@ func (e *Endpoints) runUDSServer(ctx context.Context, server *grpc.Server) error
 
 	// Restrict access to the UDS to processes running as the same user or
 	// group as the server.
-	if err := os.Chmod(e.UDSAddr.String(), 0770); err != nil {
-		return err
+	if !socketActivated {
+		if err := os.Chmod(e.UDSAddr.String(), 0770); err != nil {
+			return err
+		}
 	}
 
 	// Skip use of tomb here so we don't pollute a clean shutdown with errors
@@ -278,13 +312,45 @@ func (e *Endpoints) runUDSServer(ctx context.Context, server *grpc.Server) error
 		return err
 	case <-ctx.Done():
 		e.Log.Info("Stopping UDS server")
-		server.Stop()
+		e.stopServer(server)
 		<-errChan
 		e.Log.Info("UDS server has stopped")
 		return nil
 	}
 }
 
+// stopServer stops the server. If a drain timeout is configured, the server
+// is drained first: it stops accepting connections and RPCs, tells the
+// clients to reconnect elsewhere with a GOAWAY, and waits for the in-flight
+// RPCs to finish, up to the timeout, before closing the connections left.
+func (e *Endpoints) stopServer(server *grpc.Server) {
+	if e.DrainTimeout <= 0 {
+		server.Stop()
+		return
+	}
+
+	clk := e.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+	timer := clk.Timer(e.DrainTimeout)
+	defer timer.Stop()
+
+	drained := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-timer.C:
+		e.Log.WithField(telemetry.Timeout, e.DrainTimeout).Warn("In-flight RPCs did not finish before the drain timeout; closing the connections left")
+		server.Stop()
+		<-drained
+	}
+}
+
 // getTLSConfig returns a TLS Config hook for the gRPC server
 func (e *Endpoints) getTLSConfig(ctx context.Context) func(*tls.ClientHelloInfo) (*tls.Config, error) {
 	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
@@ -294,7 +360,7 @@ func (e *Endpoints) getTLSConfig(ctx context.Context) func(*tls.ClientHelloInfo)
 			return nil, err
 		}
 
-		return &tls.Config{
+		return fips.ConfigureTLS(&tls.Config{
 			// Not all server APIs required a client certificate. Though if one
 			// is presented, verify it.
 			ClientAuth: tls.VerifyClientCertIfGiven,
@@ -305,7 +371,7 @@ func (e *Endpoints) getTLSConfig(ctx context.Context) func(*tls.ClientHelloInfo)
 			MinVersion: tls.VersionTLS12,
 
 			NextProtos: []string{http2.NextProtoTLS},
-		}, nil
+		}), nil
 	}
 }
 
@@ -354,7 +420,7 @@ func (e *Endpoints) makeInterceptors() (grpc.UnaryServerInterceptor, grpc.Stream
 
 	oldUnary, oldStream := wrapWithDeprecationLogging(log, auth.UnaryAuthorizeCall, auth.StreamAuthorizeCall)
 
-	newUnary, newStream := middleware.Interceptors(Middleware(log, e.Metrics, e.DataStore, clock.New(), e.RateLimit, e.AuditLogEnabled))
+	newUnary, newStream := middleware.Interceptors(Middleware(log, e.Metrics, e.DataStore, clock.New(), e.RateLimit, e.DownstreamPolicy, e.AuditLogEnabled))
 
 	return unaryInterceptorMux(oldUnary, newUnary), streamInterceptorMux(oldStream, newStream)
 }
@@ -24,6 +24,7 @@ import (
 	"github.com/spiffe/spire/pkg/server/ca"
 	"github.com/spiffe/spire/pkg/server/cache/entrycache"
 	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/pkg/server/endpoints/admin"
 	"github.com/spiffe/spire/pkg/server/endpoints/bundle"
 	"github.com/spiffe/spire/pkg/server/svid"
 	"github.com/spiffe/spire/proto/spire/api/registration"
@@ -97,6 +98,7 @@ func TestNew(t *testing.T) {
 		Catalog:        cat,
 		ServerCA:       serverCA,
 		BundleEndpoint: bundle.EndpointConfig{Address: tcpAddr},
+		AdminAPI:       admin.EndpointConfig{Address: tcpAddr},
 		Manager:        manager,
 		Log:            log,
 		Metrics:        metrics,
@@ -116,6 +118,7 @@ func TestNew(t *testing.T) {
 	assert.NotNil(t, endpoints.APIServers.HealthServer)
 	assert.NotNil(t, endpoints.APIServers.SVIDServer)
 	assert.NotNil(t, endpoints.BundleEndpointServer)
+	assert.NotNil(t, endpoints.AdminServer)
 	assert.Equal(t, cat.GetDataStore(), endpoints.DataStore)
 	assert.Equal(t, log, endpoints.Log)
 	assert.Equal(t, metrics, endpoints.Metrics)
@@ -315,6 +318,119 @@ func TestListenAndServe(t *testing.T) {
 	}
 }
 
+func TestStopServerDrains(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	clk := clock.NewMock(t)
+	e := &Endpoints{
+		Log:          log,
+		DrainTimeout: time.Minute,
+		Clock:        clk,
+	}
+
+	healthServer := newBlockingHealthServer()
+	conn := serveBlockingHealth(t, healthServer)
+
+	// Start an RPC that is in-flight when the server stops
+	checkErr := make(chan error, 1)
+	go func() {
+		_, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		checkErr <- err
+	}()
+	<-healthServer.started
+
+	stopped := make(chan struct{})
+	go func() {
+		e.stopServer(healthServer.server)
+		close(stopped)
+	}()
+	clk.WaitForTimer(time.Minute, "drain timer not created")
+
+	// The server waits for the in-flight RPC to finish
+	select {
+	case <-stopped:
+		require.Fail(t, "server stopped before the in-flight RPC finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(healthServer.release)
+	require.NoError(t, <-checkErr)
+	<-stopped
+}
+
+func TestStopServerDrainTimeout(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	clk := clock.NewMock(t)
+	e := &Endpoints{
+		Log:          log,
+		DrainTimeout: time.Minute,
+		Clock:        clk,
+	}
+
+	healthServer := newBlockingHealthServer()
+	defer close(healthServer.release)
+	conn := serveBlockingHealth(t, healthServer)
+
+	checkErr := make(chan error, 1)
+	go func() {
+		_, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		checkErr <- err
+	}()
+	<-healthServer.started
+
+	stopped := make(chan struct{})
+	go func() {
+		e.stopServer(healthServer.server)
+		close(stopped)
+	}()
+	clk.WaitForTimer(time.Minute, "drain timer not created")
+
+	// The connections left are closed once the drain times out
+	clk.Add(time.Minute)
+	<-stopped
+	require.Error(t, <-checkErr)
+}
+
+type blockingHealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+
+	server  *grpc.Server
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingHealthServer() *blockingHealthServer {
+	s := &blockingHealthServer{
+		server:  grpc.NewServer(),
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	grpc_health_v1.RegisterHealthServer(s.server, s)
+	return s
+}
+
+func (s *blockingHealthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	close(s.started)
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &grpc_health_v1.HealthCheckResponse{}, nil
+}
+
+// serveBlockingHealth serves the health server and returns a connection to it
+func serveBlockingHealth(t *testing.T, s *blockingHealthServer) *grpc.ClientConn {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go func() { _ = s.server.Serve(listener) }()
+	t.Cleanup(s.server.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
 func prepareDataStore(t *testing.T, ds datastore.DataStore, ca *testca.CA, agentSVID *x509svid.SVID) {
 	// Prepare the bundle
 	_, err := ds.CreateBundle(context.Background(), makeBundle(ca))
@@ -409,7 +525,7 @@ func testAgentAPI(ctx context.Context, t *testing.T, udsConn, noauthConn, agentC
 			"CountAgents":     false,
 			"ListAgents":      false,
 			"GetAgent":        false,
-			"DeleteAgent":     false,
+			"DeleteAgent":     true,
 			"BanAgent":        false,
 			"AttestAgent":     true,
 			"RenewAgent":      true,
@@ -14,6 +14,7 @@ import (
 	"github.com/spiffe/spire/pkg/server/api/middleware"
 	"github.com/spiffe/spire/pkg/server/api/rpccontext"
 	"github.com/spiffe/spire/pkg/server/ca"
+	"github.com/spiffe/spire/pkg/server/cache/dscache"
 	"github.com/spiffe/spire/pkg/server/datastore"
 	"github.com/spiffe/spire/proto/spire/common"
 	"github.com/spiffe/spire/test/clock"
@@ -23,12 +24,13 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-func Middleware(log logrus.FieldLogger, metrics telemetry.Metrics, ds datastore.DataStore, clk clock.Clock, rlConf RateLimitConfig, auditLogEnabled bool) middleware.Middleware {
+func Middleware(log logrus.FieldLogger, metrics telemetry.Metrics, ds datastore.DataStore, clk clock.Clock, rlConf RateLimitConfig, downstreamPolicy middleware.DownstreamPolicy, auditLogEnabled bool) middleware.Middleware {
 	chain := []middleware.Middleware{
 		middleware.WithLogger(log),
 		middleware.WithMetrics(metrics),
-		middleware.WithAuthorization(Authorization(log, ds, clk)),
-		middleware.WithRateLimits(RateLimits(rlConf)),
+		middleware.WithServerTime(),
+		middleware.WithAuthorization(Authorization(log, ds, clk, downstreamPolicy)),
+		middleware.WithRateLimits(RateLimits(rlConf, metrics)),
 	}
 
 	if auditLogEnabled {
@@ -41,14 +43,14 @@ func Middleware(log logrus.FieldLogger, metrics telemetry.Metrics, ds datastore.
 	)
 }
 
-func Authorization(log logrus.FieldLogger, ds datastore.DataStore, clk clock.Clock) map[string]middleware.Authorizer {
+func Authorization(log logrus.FieldLogger, ds datastore.DataStore, clk clock.Clock, downstreamPolicy middleware.DownstreamPolicy) map[string]middleware.Authorizer {
 	agentAuthorizer := AgentAuthorizer(log, ds, clk)
 	entryFetcher := EntryFetcher(ds)
 
 	any := middleware.AuthorizeAny()
 	local := middleware.AuthorizeLocal()
 	agent := middleware.AuthorizeAgent(agentAuthorizer)
-	downstream := middleware.AuthorizeDownstream(entryFetcher)
+	downstream := middleware.AuthorizeDownstreamWithPolicy(entryFetcher, downstreamPolicy)
 	admin := middleware.AuthorizeAdmin(entryFetcher)
 
 	localOrAdmin := middleware.AuthorizeAnyOf(local, admin)
@@ -81,7 +83,7 @@ func Authorization(log logrus.FieldLogger, ds datastore.DataStore, clk clock.Clo
 		"/spire.api.server.agent.v1.Agent/CountAgents":                  localOrAdmin,
 		"/spire.api.server.agent.v1.Agent/ListAgents":                   localOrAdmin,
 		"/spire.api.server.agent.v1.Agent/GetAgent":                     localOrAdmin,
-		"/spire.api.server.agent.v1.Agent/DeleteAgent":                  localOrAdmin,
+		"/spire.api.server.agent.v1.Agent/DeleteAgent":                  localOrAdminOrAgent,
 		"/spire.api.server.agent.v1.Agent/BanAgent":                     localOrAdmin,
 		"/spire.api.server.agent.v1.Agent/AttestAgent":                  any,
 		"/spire.api.server.agent.v1.Agent/RenewAgent":                   agent,
@@ -127,7 +129,7 @@ func AgentAuthorizer(log logrus.FieldLogger, ds datastore.DataStore, clk clock.C
 			return permissionDenied(types.PermissionDeniedDetails_AGENT_EXPIRED, "agent %q SVID is expired", id)
 		}
 
-		attestedNode, err := ds.FetchAttestedNode(ctx, id)
+		attestedNode, err := ds.FetchAttestedNode(dscache.WithCache(ctx), id)
 		switch {
 		case err != nil:
 			log.WithError(err).Error("Unable to look up agent information")
@@ -168,7 +170,7 @@ func AgentAuthorizer(log logrus.FieldLogger, ds datastore.DataStore, clk clock.C
 	})
 }
 
-func RateLimits(config RateLimitConfig) map[string]api.RateLimiter {
+func RateLimits(config RateLimitConfig, metrics telemetry.Metrics) map[string]api.RateLimiter {
 	noLimit := middleware.NoLimit()
 	attestLimit := middleware.DisabledLimit()
 	if config.Attestation {
@@ -185,14 +187,32 @@ func RateLimits(config RateLimitConfig) map[string]api.RateLimiter {
 		jsrLimit = middleware.PerIPLimit(limits.SignLimitPerIP)
 	}
 
+	// The signing quotas are shared by the X509-SVID and JWT-SVID signing
+	// methods, so they bound all of the signatures of a given caller.
+	// Downstream servers are nested within the trust domain, so they are
+	// told apart by their own SPIFFE ID.
+	agentSigningLimit := csrLimit
+	agentJWTSigningLimit := jsrLimit
+	if config.AgentSigningQuota > 0 {
+		agentQuota := middleware.PerCallerQuota("agent", config.AgentSigningQuota, metrics)
+		agentSigningLimit = middleware.AllLimits(agentQuota, csrLimit)
+		agentJWTSigningLimit = middleware.AllLimits(agentQuota, jsrLimit)
+	}
+
+	downstreamSigningLimit := csrLimit
+	if config.DownstreamSigningQuota > 0 {
+		downstreamQuota := middleware.PerCallerQuota("downstream", config.DownstreamSigningQuota, metrics)
+		downstreamSigningLimit = middleware.AllLimits(downstreamQuota, csrLimit)
+	}
+
 	pushJWTKeyLimit := middleware.PerIPLimit(limits.PushJWTKeyLimitPerIP)
 
 	return map[string]api.RateLimiter{
 		"/spire.api.server.svid.v1.SVID/MintX509SVID":                   noLimit,
 		"/spire.api.server.svid.v1.SVID/MintJWTSVID":                    noLimit,
-		"/spire.api.server.svid.v1.SVID/BatchNewX509SVID":               csrLimit,
-		"/spire.api.server.svid.v1.SVID/NewJWTSVID":                     jsrLimit,
-		"/spire.api.server.svid.v1.SVID/NewDownstreamX509CA":            csrLimit,
+		"/spire.api.server.svid.v1.SVID/BatchNewX509SVID":               agentSigningLimit,
+		"/spire.api.server.svid.v1.SVID/NewJWTSVID":                     agentJWTSigningLimit,
+		"/spire.api.server.svid.v1.SVID/NewDownstreamX509CA":            downstreamSigningLimit,
 		"/spire.api.server.bundle.v1.Bundle/GetBundle":                  noLimit,
 		"/spire.api.server.bundle.v1.Bundle/AppendBundle":               noLimit,
 		"/spire.api.server.bundle.v1.Bundle/PublishJWTAuthority":        pushJWTKeyLimit,
@@ -45,6 +45,14 @@ type Handler struct {
 	Catalog     catalog.Catalog
 	TrustDomain spiffeid.TrustDomain
 	ServerCA    ca.ServerCA
+
+	// IDPolicy is enforced on the SPIFFE IDs of the created and updated
+	// entries
+	IDPolicy api.IDPolicy
+
+	// OwnershipPolicy restricts the updates and deletions of the entries to
+	// the callers that created them
+	OwnershipPolicy api.OwnershipPolicy
 }
 
 // CreateEntry creates an entry in the Registration table,
@@ -109,6 +117,11 @@ func (h *Handler) DeleteEntry(ctx context.Context, request *registration.Registr
 	log := h.Log.WithField(telemetry.Method, telemetry.DeleteRegistrationEntry)
 
 	ds := h.getDataStore()
+	if err := h.checkEntryOwnership(ctx, ds, request.Id); err != nil {
+		log.WithError(err).Error("Error deleting registration entry")
+		return &common.RegistrationEntry{}, err
+	}
+
 	registrationEntry, err := ds.DeleteRegistrationEntry(ctx, request.Id)
 	if err != nil {
 		log.WithError(err).Error("Error deleting registration entry")
@@ -175,6 +188,11 @@ func (h *Handler) UpdateEntry(ctx context.Context, request *registration.UpdateE
 	}
 
 	ds := h.getDataStore()
+	if err := h.checkEntryOwnership(ctx, ds, request.Entry.EntryId); err != nil {
+		log.WithError(err).Error("Failed to update registration entry")
+		return nil, err
+	}
+
 	entry, err := ds.UpdateRegistrationEntry(ctx, request.Entry, nil)
 	if err != nil {
 		log.WithError(err).Error("Failed to update registration entry")
@@ -775,6 +793,8 @@ func (h *Handler) createRegistrationEntry(ctx context.Context, requestedEntry *c
 	if err != nil {
 		return nil, false, status.Error(codes.InvalidArgument, err.Error())
 	}
+	// Entry IDs are assigned by the datastore on creation
+	requestedEntry.EntryId = ""
 
 	ds := h.getDataStore()
 
@@ -828,6 +848,11 @@ func (h *Handler) prepareRegistrationEntry(entry *common.RegistrationEntry, forU
 		return nil, fmt.Errorf("spiffe ID is malformed: %w", err)
 	}
 
+	entry.SpiffeId, err = h.IDPolicy.Apply(entry.SpiffeId)
+	if err != nil {
+		return nil, err
+	}
+
 	// Validate Selectors
 	for _, s := range entry.Selectors {
 		if err := selector.Validate(s); err != nil {
@@ -838,6 +863,23 @@ func (h *Handler) prepareRegistrationEntry(entry *common.RegistrationEntry, forU
 	return entry, nil
 }
 
+// checkEntryOwnership returns an error if the ownership policy doesn't allow
+// the caller to change the entry
+func (h *Handler) checkEntryOwnership(ctx context.Context, ds datastore.DataStore, entryID string) error {
+	if !h.OwnershipPolicy.Enforced {
+		return nil
+	}
+
+	owner, err := ds.FetchRegistrationEntryOwner(ctx, entryID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to fetch registration entry owner: %v", err)
+	}
+	if err := h.OwnershipPolicy.Check(datastore.ChangedBy(ctx), owner); err != nil {
+		return status.Errorf(codes.PermissionDenied, "caller is not allowed to change the registration entry: %v", err)
+	}
+	return nil
+}
+
 func (h *Handler) AuthorizeCall(ctx context.Context, fullMethod string) (_ context.Context, err error) {
 	// For the time being, authorization is not per-method. In other words, all or nothing.
 	counter := telemetry_registrationapi.StartAuthorizeCall(h.Metrics, fullMethod)
@@ -851,6 +893,9 @@ func (h *Handler) AuthorizeCall(ctx context.Context, fullMethod string) (_ conte
 	}
 	if callerID != "" {
 		ctx = withCallerID(ctx, callerID)
+		ctx = datastore.WithChangedBy(ctx, callerID)
+	} else {
+		ctx = datastore.WithChangedBy(ctx, datastore.ChangedByLocal)
 	}
 	return ctx, nil
 }
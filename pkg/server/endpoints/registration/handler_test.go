@@ -19,6 +19,7 @@ import (
 	"github.com/spiffe/spire/pkg/common/bundleutil"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	"github.com/spiffe/spire/pkg/common/util"
+	"github.com/spiffe/spire/pkg/server/api"
 	"github.com/spiffe/spire/pkg/server/datastore"
 	"github.com/spiffe/spire/proto/spire/api/registration"
 	"github.com/spiffe/spire/proto/spire/common"
@@ -1347,9 +1348,10 @@ func (s *HandlerSuite) TestAuthorizeCall() {
 	})
 
 	testCases := []struct {
-		Peer     *peer.Peer
-		CallerID string
-		Err      string
+		Peer      *peer.Peer
+		CallerID  string
+		ChangedBy string
+		Err       string
 	}{
 		{
 			Err: "no peer information for caller",
@@ -1362,6 +1364,7 @@ func (s *HandlerSuite) TestAuthorizeCall() {
 			Peer: &peer.Peer{
 				AuthInfo: auth.UntrackedUDSAuthInfo{},
 			},
+			ChangedBy: "local",
 		},
 		{
 			Peer: &peer.Peer{
@@ -1392,8 +1395,9 @@ func (s *HandlerSuite) TestAuthorizeCall() {
 			Err:  `SPIFFE ID "spiffe://example.org/not-admin" is not authorized`,
 		},
 		{
-			Peer:     makeTLSPeer("spiffe://example.org/admin"),
-			CallerID: "spiffe://example.org/admin",
+			Peer:      makeTLSPeer("spiffe://example.org/admin"),
+			CallerID:  "spiffe://example.org/admin",
+			ChangedBy: "spiffe://example.org/admin",
 		},
 	}
 
@@ -1411,9 +1415,83 @@ func (s *HandlerSuite) TestAuthorizeCall() {
 		}
 		s.Require().NoError(err)
 		s.Require().Equal(testCase.CallerID, getCallerID(ctx), "Caller SPIFFE ID on context")
+		s.Require().Equal(testCase.ChangedBy, datastore.ChangedBy(ctx), "Changed by on context")
 	}
 }
 
+func TestPrepareRegistrationEntryIDPolicy(t *testing.T) {
+	handler := &Handler{
+		TrustDomain: trustDomain,
+		IDPolicy: api.IDPolicy{
+			Action:        api.IDPolicyReject,
+			LowercasePath: true,
+		},
+	}
+
+	entry, err := handler.prepareRegistrationEntry(&common.RegistrationEntry{
+		ParentId:  "spiffe://example.org/parent",
+		SpiffeId:  "spiffe://example.org/workload",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+	}, false)
+	require.NoError(t, err)
+	require.Equal(t, "spiffe://example.org/workload", entry.SpiffeId)
+
+	_, err = handler.prepareRegistrationEntry(&common.RegistrationEntry{
+		ParentId:  "spiffe://example.org/parent",
+		SpiffeId:  "spiffe://example.org/Workload",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+	}, false)
+	require.EqualError(t, err, `"spiffe://example.org/Workload" violates the SPIFFE ID policy: path must be lowercase`)
+
+	handler.IDPolicy.Action = api.IDPolicyNormalize
+	entry, err = handler.prepareRegistrationEntry(&common.RegistrationEntry{
+		ParentId:  "spiffe://example.org/parent",
+		SpiffeId:  "spiffe://example.org/Workload",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+	}, false)
+	require.NoError(t, err)
+	require.Equal(t, "spiffe://example.org/workload", entry.SpiffeId)
+}
+
+func TestEntryOwnershipPolicy(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	ds := fakedatastore.New(t)
+	catalog := fakeservercatalog.New()
+	catalog.SetDataStore(ds)
+	handler := &Handler{
+		Log:         log,
+		Metrics:     telemetry.Blackhole{},
+		TrustDomain: trustDomain,
+		Catalog:     catalog,
+		OwnershipPolicy: api.OwnershipPolicy{
+			Enforced: true,
+		},
+	}
+
+	ownerCtx := datastore.WithChangedBy(context.Background(), "spiffe://example.org/owner")
+	otherCtx := datastore.WithChangedBy(context.Background(), "spiffe://example.org/other")
+
+	entry, err := ds.CreateRegistrationEntry(ownerCtx, &common.RegistrationEntry{
+		ParentId:  "spiffe://example.org/parent",
+		SpiffeId:  "spiffe://example.org/workload",
+		Selectors: []*common.Selector{{Type: "unix", Value: "uid:1000"}},
+	})
+	require.NoError(t, err)
+
+	update := proto.Clone(entry).(*common.RegistrationEntry)
+	update.Ttl = 60
+	_, err = handler.UpdateEntry(otherCtx, &registration.UpdateEntryRequest{Entry: update})
+	spiretest.RequireGRPCStatus(t, err, codes.PermissionDenied, `caller is not allowed to change the registration entry: entry is owned by "spiffe://example.org/owner"`)
+	_, err = handler.DeleteEntry(otherCtx, &registration.RegistrationEntryID{Id: entry.EntryId})
+	spiretest.RequireGRPCStatus(t, err, codes.PermissionDenied, `caller is not allowed to change the registration entry: entry is owned by "spiffe://example.org/owner"`)
+
+	updated, err := handler.UpdateEntry(ownerCtx, &registration.UpdateEntryRequest{Entry: update})
+	require.NoError(t, err)
+	require.Equal(t, int32(60), updated.Ttl)
+	_, err = handler.DeleteEntry(ownerCtx, &registration.RegistrationEntryID{Id: entry.EntryId})
+	require.NoError(t, err)
+}
+
 func TestDNSValidation(t *testing.T) {
 	tests := []struct {
 		name string
@@ -0,0 +1,253 @@
+package lastseen
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	server_telemetry "github.com/spiffe/spire/pkg/common/telemetry/server"
+	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/pkg/server/nodeevents"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultStaleAfter is how long an agent can go without syncing with the
+	// server before it is reported as stale, if not overridden by the config
+	DefaultStaleAfter = time.Hour
+
+	// RecordInterval is how often at most the time an agent is seen is
+	// recorded in the datastore. Agents sync every few seconds, so the time
+	// they were last seen is only accurate to this interval.
+	RecordInterval = time.Minute
+
+	// checkInterval is how often the stale agents are counted and the agents
+	// silent for too long are evicted
+	checkInterval = time.Minute
+
+	pageSize = 1000
+)
+
+// Config is the config of the tracker
+type Config struct {
+	// StaleAfter is how long an agent can go without syncing with the
+	// server before it is reported as stale
+	StaleAfter time.Duration
+
+	// EvictAfter, if set, is how long an agent can go without syncing with
+	// the server before it is evicted, i.e. its attested node is deleted and
+	// it has to attest again. Banned agents are never evicted, since it
+	// would lift the ban.
+	EvictAfter time.Duration
+
+	DataStore datastore.DataStore
+	Log       logrus.FieldLogger
+	Metrics   telemetry.Metrics
+	Clock     clock.Clock
+
+	// NodeEvents, if set, is notified when agents are evicted
+	NodeEvents nodeevents.Notifier
+}
+
+// Agent is an attested agent and when it was last seen syncing with the
+// server
+type Agent struct {
+	ID              string
+	AttestationType string
+	LastSeen        time.Time
+}
+
+// Tracker records when the agents were last seen syncing with the server,
+// reports how many agents are stale and evicts the agents silent for too
+// long, if configured to.
+type Tracker struct {
+	c Config
+
+	mu sync.Mutex
+	// recorded holds when the agents were last recorded as seen by this
+	// server, to throttle the datastore writes
+	recorded map[string]time.Time
+}
+
+// New creates a new tracker
+func New(config Config) *Tracker {
+	if config.StaleAfter <= 0 {
+		config.StaleAfter = DefaultStaleAfter
+	}
+	if config.Clock == nil {
+		config.Clock = clock.New()
+	}
+	return &Tracker{
+		c:        config,
+		recorded: make(map[string]time.Time),
+	}
+}
+
+// StaleAfter returns how long an agent can go without syncing with the
+// server before it is reported as stale
+func (t *Tracker) StaleAfter() time.Duration {
+	return t.c.StaleAfter
+}
+
+// AgentSeen records that the agent synced with the server. The time is
+// written to the datastore at most once per RecordInterval for each agent.
+func (t *Tracker) AgentSeen(ctx context.Context, agentID spiffeid.ID) {
+	id := agentID.String()
+	now := t.c.Clock.Now()
+
+	t.mu.Lock()
+	if recorded, ok := t.recorded[id]; ok && now.Sub(recorded) < RecordInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.recorded[id] = now
+	t.mu.Unlock()
+
+	if err := t.c.DataStore.SetNodeLastSeen(ctx, id, now); err != nil {
+		t.c.Log.WithError(err).WithField(telemetry.AgentID, id).Warn("Failed to record when agent was last seen")
+		// Try again on the next sync
+		t.mu.Lock()
+		delete(t.recorded, id)
+		t.mu.Unlock()
+	}
+}
+
+// Run counts the stale agents and evicts the agents silent for too long
+// every minute until the context is done
+func (t *Tracker) Run(ctx context.Context) error {
+	ticker := t.c.Clock.Ticker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Log an error on failure unless we're shutting down
+			if err := t.check(ctx); err != nil && ctx.Err() == nil {
+				t.c.Log.WithError(err).Error("Failed to check for stale agents")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (t *Tracker) check(ctx context.Context) error {
+	now := t.c.Clock.Now()
+	t.pruneRecorded(now)
+
+	agents, err := ListAgents(ctx, t.c.DataStore)
+	if err != nil {
+		return err
+	}
+
+	stale := 0
+	for _, agent := range agents {
+		silentFor := now.Sub(agent.LastSeen)
+		if t.c.EvictAfter > 0 && silentFor >= t.c.EvictAfter && t.evict(ctx, agent, now) {
+			continue
+		}
+		if silentFor >= t.c.StaleAfter {
+			stale++
+		}
+	}
+	server_telemetry.SetNodeStaleGauge(t.c.Metrics, stale)
+	return nil
+}
+
+// evict deletes the attested node of the agent, returning whether the agent
+// is gone
+func (t *Tracker) evict(ctx context.Context, agent Agent, now time.Time) bool {
+	log := t.c.Log.WithFields(logrus.Fields{
+		telemetry.AgentID:  agent.ID,
+		telemetry.LastSeen: agent.LastSeen.UTC().Format(time.RFC3339),
+	})
+
+	_, err := t.c.DataStore.DeleteAttestedNode(ctx, agent.ID)
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.NotFound:
+		// Already deleted, e.g. evicted by another server
+		return true
+	default:
+		log.WithError(err).Error("Failed to evict agent")
+		return false
+	}
+
+	log.Warn("Evicted agent not seen for longer than the eviction threshold")
+	server_telemetry.IncrNodeEvictedCounter(t.c.Metrics)
+	if t.c.NodeEvents != nil {
+		t.c.NodeEvents.NotifyNodeEvent(nodeevents.Event{
+			Type:    nodeevents.AgentDeleted,
+			Time:    now.UTC(),
+			AgentID: agent.ID,
+		})
+	}
+	return true
+}
+
+// pruneRecorded forgets the agents not recorded within the last
+// RecordInterval, so the agents that are gone don't accumulate
+func (t *Tracker) pruneRecorded(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, recorded := range t.recorded {
+		if now.Sub(recorded) >= RecordInterval {
+			delete(t.recorded, id)
+		}
+	}
+}
+
+// ListAgents lists the attested agents that are not banned and when they
+// were last seen syncing with the server, least recently seen first
+func ListAgents(ctx context.Context, ds datastore.DataStore) ([]Agent, error) {
+	notBanned := false
+	req := &datastore.ListAttestedNodesRequest{
+		ByBanned:   &notBanned,
+		Pagination: &datastore.Pagination{PageSize: pageSize},
+	}
+
+	var agents []Agent
+	for {
+		resp, err := ds.ListAttestedNodes(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range resp.Nodes {
+			agents = append(agents, Agent{
+				ID:              node.SpiffeId,
+				AttestationType: node.AttestationDataType,
+			})
+		}
+		if len(resp.Nodes) == 0 || resp.Pagination == nil || resp.Pagination.Token == "" {
+			break
+		}
+		req.Pagination.Token = resp.Pagination.Token
+	}
+
+	lastSeen, err := ds.ListNodesLastSeen(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := agents[:0]
+	for _, agent := range agents {
+		seen, ok := lastSeen[agent.ID]
+		if !ok {
+			// Deleted since listed
+			continue
+		}
+		agent.LastSeen = seen
+		known = append(known, agent)
+	}
+
+	sort.SliceStable(known, func(i, j int) bool {
+		return known[i].LastSeen.Before(known[j].LastSeen)
+	})
+	return known, nil
+}
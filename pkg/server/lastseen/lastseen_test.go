@@ -0,0 +1,176 @@
+package lastseen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/server/nodeevents"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/spiffe/spire/test/clock"
+	"github.com/spiffe/spire/test/fakes/fakedatastore"
+	"github.com/spiffe/spire/test/fakes/fakemetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ctx = context.Background()
+
+	seenID   = spiffeid.Must("example.org", "spire", "agent", "test", "seen")
+	silentID = spiffeid.Must("example.org", "spire", "agent", "test", "silent")
+	bannedID = spiffeid.Must("example.org", "spire", "agent", "test", "banned")
+)
+
+type fakeNodeEvents struct {
+	events []nodeevents.Event
+}
+
+func (n *fakeNodeEvents) NotifyNodeEvent(event nodeevents.Event) {
+	n.events = append(n.events, event)
+}
+
+func setupTracker(t *testing.T, evictAfter time.Duration) (*Tracker, *fakedatastore.DataStore, *clock.Mock, *fakemetrics.FakeMetrics, *fakeNodeEvents) {
+	ds := fakedatastore.New(t)
+	for _, node := range []*common.AttestedNode{
+		{SpiffeId: seenID.String(), AttestationDataType: "test", CertSerialNumber: "1"},
+		{SpiffeId: silentID.String(), AttestationDataType: "test", CertSerialNumber: "2"},
+		// Banned agents have no serial number
+		{SpiffeId: bannedID.String(), AttestationDataType: "test"},
+	} {
+		_, err := ds.CreateAttestedNode(ctx, node)
+		require.NoError(t, err)
+	}
+
+	log, _ := test.NewNullLogger()
+	clk := clock.NewMock(t)
+	metrics := fakemetrics.New()
+	nodeEvents := &fakeNodeEvents{}
+	tracker := New(Config{
+		EvictAfter: evictAfter,
+		DataStore:  ds,
+		Log:        log,
+		Metrics:    metrics,
+		Clock:      clk,
+		NodeEvents: nodeEvents,
+	})
+	return tracker, ds, clk, metrics, nodeEvents
+}
+
+func TestAgentSeen(t *testing.T) {
+	tracker, ds, clk, _, _ := setupTracker(t, 0)
+	requireLastSeen := func(expected time.Time) {
+		lastSeen, err := ds.ListNodesLastSeen(ctx)
+		require.NoError(t, err)
+		require.WithinDuration(t, expected, lastSeen[seenID.String()], time.Second)
+	}
+
+	clk.Add(time.Hour)
+	seen := clk.Now()
+	tracker.AgentSeen(ctx, seenID)
+	requireLastSeen(seen)
+
+	// Recording is throttled
+	clk.Add(RecordInterval / 2)
+	tracker.AgentSeen(ctx, seenID)
+	requireLastSeen(seen)
+
+	clk.Add(RecordInterval / 2)
+	tracker.AgentSeen(ctx, seenID)
+	requireLastSeen(clk.Now())
+}
+
+func TestAgentSeenFailure(t *testing.T) {
+	tracker, ds, clk, _, _ := setupTracker(t, 0)
+	log, hook := test.NewNullLogger()
+	tracker.c.Log = log
+
+	clk.Add(time.Hour)
+	ds.SetNextError(errors.New("oops"))
+	tracker.AgentSeen(ctx, seenID)
+	require.Len(t, hook.AllEntries(), 1)
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.Equal(t, "Failed to record when agent was last seen", hook.LastEntry().Message)
+
+	// The failed attempt does not throttle the next one
+	tracker.AgentSeen(ctx, seenID)
+	lastSeen, err := ds.ListNodesLastSeen(ctx)
+	require.NoError(t, err)
+	require.WithinDuration(t, clk.Now(), lastSeen[seenID.String()], time.Second)
+}
+
+func TestListAgents(t *testing.T) {
+	tracker, ds, clk, _, _ := setupTracker(t, 0)
+	clk.Add(time.Hour)
+	tracker.AgentSeen(ctx, seenID)
+
+	// Banned agents are left out and the least recently seen agents come
+	// first
+	agents, err := ListAgents(ctx, ds)
+	require.NoError(t, err)
+	require.Len(t, agents, 2)
+	assert.Equal(t, silentID.String(), agents[0].ID)
+	assert.Equal(t, "test", agents[0].AttestationType)
+	assert.Equal(t, seenID.String(), agents[1].ID)
+	assert.WithinDuration(t, clk.Now(), agents[1].LastSeen, time.Second)
+}
+
+func TestCheckCountsStaleAgents(t *testing.T) {
+	tracker, ds, clk, metrics, nodeEvents := setupTracker(t, 0)
+
+	clk.Add(2 * time.Hour)
+	tracker.AgentSeen(ctx, seenID)
+	require.NoError(t, tracker.check(ctx))
+
+	// Only the silent agent is stale; the banned agent is not counted
+	expected := fakemetrics.New()
+	expected.SetGauge([]string{"node", "stale"}, 1)
+	assert.Equal(t, expected.AllMetrics(), metrics.AllMetrics())
+
+	// Nothing is evicted without an eviction threshold
+	agents, err := ListAgents(ctx, ds)
+	require.NoError(t, err)
+	assert.Len(t, agents, 2)
+	assert.Empty(t, nodeEvents.events)
+}
+
+func TestCheckEvictsSilentAgents(t *testing.T) {
+	tracker, ds, clk, metrics, nodeEvents := setupTracker(t, 3*time.Hour)
+
+	clk.Add(2 * time.Hour)
+	tracker.AgentSeen(ctx, seenID)
+	clk.Add(90 * time.Minute)
+	require.NoError(t, tracker.check(ctx))
+
+	// The silent agent is evicted; the agent seen within the eviction
+	// threshold is only stale, and banned agents are never evicted
+	node, err := ds.FetchAttestedNode(ctx, silentID.String())
+	require.NoError(t, err)
+	assert.Nil(t, node)
+	for _, id := range []spiffeid.ID{seenID, bannedID} {
+		node, err := ds.FetchAttestedNode(ctx, id.String())
+		require.NoError(t, err)
+		assert.NotNil(t, node)
+	}
+
+	expected := fakemetrics.New()
+	expected.IncrCounter([]string{"node", "evicted"}, 1)
+	expected.SetGauge([]string{"node", "stale"}, 1)
+	assert.Equal(t, expected.AllMetrics(), metrics.AllMetrics())
+
+	assert.Equal(t, []nodeevents.Event{
+		{Type: nodeevents.AgentDeleted, Time: clk.Now().UTC(), AgentID: silentID.String()},
+	}, nodeEvents.events)
+}
+
+func TestCheckFailure(t *testing.T) {
+	tracker, ds, _, metrics, _ := setupTracker(t, 0)
+
+	ds.SetNextError(errors.New("oops"))
+	require.EqualError(t, tracker.check(ctx), "oops")
+	assert.Empty(t, metrics.AllMetrics())
+}
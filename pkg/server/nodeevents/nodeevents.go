@@ -0,0 +1,72 @@
+package nodeevents
+
+import (
+	"time"
+)
+
+const (
+	// AgentAttested is the type of the event of an agent attesting for the
+	// first time, or after being deleted
+	AgentAttested = "agent_attested"
+
+	// AgentReattested is the type of the event of an agent attesting again
+	// while it is still known to the server, e.g. after losing its SVID
+	AgentReattested = "agent_reattested"
+
+	// AgentBanned is the type of the event of an agent being banned
+	AgentBanned = "agent_banned"
+
+	// AgentDeleted is the type of the event of an agent being deleted, i.e.
+	// evicted from the server
+	AgentDeleted = "agent_deleted"
+)
+
+// Event is an event in the lifecycle of an attested node (agent)
+type Event struct {
+	// Type is the type of the event, e.g. AgentAttested
+	Type string `json:"type"`
+
+	// Time is when the event happened
+	Time time.Time `json:"time"`
+
+	// AgentID is the SPIFFE ID of the agent
+	AgentID string `json:"agent_id"`
+
+	// AttestationType is the node attestor used by the agent. It is only set
+	// for attestation events.
+	AttestationType string `json:"attestation_type,omitempty"`
+
+	// Selectors are the node selectors of the agent, including the ones from
+	// node resolvers. They are only set for attestation events.
+	Selectors []Selector `json:"selectors,omitempty"`
+
+	// SerialNumber is the serial number of the SVID issued to the agent. It
+	// is only set for attestation events.
+	SerialNumber string `json:"serial_number,omitempty"`
+
+	// ExpiresAt is when the SVID issued to the agent expires, in seconds
+	// since the Unix epoch. It is only set for attestation events.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+// Selector is a node selector
+type Selector struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Notifier is notified of attested node events. Notifications must not
+// block, as they happen while the agent or admin call is being served.
+type Notifier interface {
+	NotifyNodeEvent(event Event)
+}
+
+// Notifiers is a Notifier notifying each of the notifiers in order
+type Notifiers []Notifier
+
+// NotifyNodeEvent notifies each of the notifiers of the event
+func (ns Notifiers) NotifyNodeEvent(event Event) {
+	for _, n := range ns {
+		n.NotifyNodeEvent(event)
+	}
+}
@@ -0,0 +1,142 @@
+package nodeevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+)
+
+const (
+	// DefaultWebhookTimeout is the timeout of the webhook requests if not
+	// overridden by the config
+	DefaultWebhookTimeout = 5 * time.Second
+
+	// webhookQueueSize is how many events can wait to be delivered before
+	// new events are dropped
+	webhookQueueSize = 1024
+
+	// webhookAttempts is how many times the delivery of an event is attempted
+	webhookAttempts = 3
+
+	// webhookRetryInterval is how long to wait before retrying the delivery
+	// of an event, multiplied by the number of attempts made
+	webhookRetryInterval = time.Second
+)
+
+// WebhookConfig is the config of the webhook
+type WebhookConfig struct {
+	// URL is where the events are POSTed to, as JSON
+	URL string
+
+	// Timeout is the timeout of each request to the webhook
+	Timeout time.Duration
+
+	Log   logrus.FieldLogger
+	Clock clock.Clock
+}
+
+// Webhook delivers attested node events to an operator webhook, e.g. of an
+// inventory system or of a bridge to a message bus. Events are delivered in
+// order, from a bounded queue; events are dropped if the queue is full or if
+// they can't be delivered after a few attempts.
+type Webhook struct {
+	c      WebhookConfig
+	client *http.Client
+	events chan Event
+}
+
+// NewWebhook creates a new webhook
+func NewWebhook(config WebhookConfig) *Webhook {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultWebhookTimeout
+	}
+	if config.Clock == nil {
+		config.Clock = clock.New()
+	}
+
+	return &Webhook{
+		c:      config,
+		client: &http.Client{Timeout: config.Timeout},
+		events: make(chan Event, webhookQueueSize),
+	}
+}
+
+// NotifyNodeEvent queues the event for delivery
+func (w *Webhook) NotifyNodeEvent(event Event) {
+	select {
+	case w.events <- event:
+	default:
+		w.c.Log.WithFields(logrus.Fields{
+			telemetry.Type:    event.Type,
+			telemetry.AgentID: event.AgentID,
+		}).Warn("Dropping node event; the webhook queue is full")
+	}
+}
+
+// Run delivers the queued events until the context is done
+func (w *Webhook) Run(ctx context.Context) error {
+	for {
+		select {
+		case event := <-w.events:
+			// Log an error on failure unless we're shutting down
+			if err := w.deliver(ctx, event); err != nil && ctx.Err() == nil {
+				w.c.Log.WithFields(logrus.Fields{
+					telemetry.Type:    event.Type,
+					telemetry.AgentID: event.AgentID,
+				}).WithError(err).Error("Failed to deliver node event to webhook")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (w *Webhook) deliver(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := w.post(ctx, body)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+
+		select {
+		case <-w.c.Clock.After(time.Duration(attempt) * webhookRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (w *Webhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
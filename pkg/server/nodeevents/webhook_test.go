@@ -0,0 +1,141 @@
+package nodeevents
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/spire/test/clock"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	attestedEvent = Event{
+		Type:            AgentAttested,
+		Time:            time.Unix(1600000000, 0).UTC(),
+		AgentID:         "spiffe://example.org/spire/agent/join_token/token",
+		AttestationType: "join_token",
+		Selectors:       []Selector{{Type: "join_token", Value: "token"}},
+		SerialNumber:    "1234",
+		ExpiresAt:       1600003600,
+	}
+	bannedEvent = Event{
+		Type:    AgentBanned,
+		Time:    time.Unix(1600000060, 0).UTC(),
+		AgentID: "spiffe://example.org/spire/agent/join_token/token",
+	}
+)
+
+func TestWebhookDeliversEvents(t *testing.T) {
+	received := make(chan Event, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, http.MethodPost, req.Method)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		var event Event
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&event))
+		received <- event
+	}))
+	defer server.Close()
+
+	log, _ := test.NewNullLogger()
+	webhook := NewWebhook(WebhookConfig{URL: server.URL, Log: log})
+	webhook.NotifyNodeEvent(attestedEvent)
+	webhook.NotifyNodeEvent(bannedEvent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		assert.NoError(t, webhook.Run(ctx))
+	}()
+
+	require.Equal(t, attestedEvent, receiveEvent(t, received))
+	require.Equal(t, bannedEvent, receiveEvent(t, received))
+}
+
+func TestWebhookRetriesDelivery(t *testing.T) {
+	received := make(chan Event, webhookAttempts)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var event Event
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&event))
+		received <- event
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	log, logHook := test.NewNullLogger()
+	clk := clock.NewMock(t)
+	webhook := NewWebhook(WebhookConfig{URL: server.URL, Log: log, Clock: clk})
+	webhook.NotifyNodeEvent(attestedEvent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, webhook.Run(ctx))
+	}()
+
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		require.Equal(t, attestedEvent, receiveEvent(t, received))
+		if attempt < webhookAttempts {
+			clk.WaitForAfter(time.Minute, "delivery was not retried")
+			clk.Add(time.Duration(attempt) * webhookRetryInterval)
+		}
+	}
+
+	// The event is dropped once the last attempt fails
+	require.Eventually(t, func() bool {
+		return len(logHook.AllEntries()) > 0
+	}, time.Minute, 10*time.Millisecond)
+	cancel()
+	<-done
+	spiretest.AssertLogs(t, logHook.AllEntries(), []spiretest.LogEntry{
+		{
+			Level:   logrus.ErrorLevel,
+			Message: "Failed to deliver node event to webhook",
+			Data: logrus.Fields{
+				"type":          AgentAttested,
+				"agent_id":      attestedEvent.AgentID,
+				logrus.ErrorKey: "unexpected status code 503",
+			},
+		},
+	})
+}
+
+func TestWebhookDropsEventsWhenQueueIsFull(t *testing.T) {
+	log, logHook := test.NewNullLogger()
+	webhook := NewWebhook(WebhookConfig{URL: "http://localhost", Log: log})
+	for i := 0; i < webhookQueueSize; i++ {
+		webhook.NotifyNodeEvent(attestedEvent)
+	}
+	require.Empty(t, logHook.AllEntries())
+
+	webhook.NotifyNodeEvent(bannedEvent)
+	spiretest.AssertLogs(t, logHook.AllEntries(), []spiretest.LogEntry{
+		{
+			Level:   logrus.WarnLevel,
+			Message: "Dropping node event; the webhook queue is full",
+			Data: logrus.Fields{
+				"type":     AgentBanned,
+				"agent_id": bannedEvent.AgentID,
+			},
+		},
+	})
+}
+
+func receiveEvent(t *testing.T, received <-chan Event) Event {
+	select {
+	case event := <-received:
+		return event
+	case <-time.After(time.Minute):
+		require.FailNow(t, "timed out waiting for the event")
+		return Event{}
+	}
+}
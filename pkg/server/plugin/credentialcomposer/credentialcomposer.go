@@ -0,0 +1,56 @@
+package credentialcomposer
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509/pkix"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/catalog"
+)
+
+// CredentialComposer is the client interface for the service type
+// CredentialComposer interface. Credential composers are invoked by the
+// server CA, in order, when it signs SVIDs for registration entries, and can
+// shape their contents, e.g. to embed organization-specific certificate
+// extensions or JWT claims derived from the entry.
+type CredentialComposer interface {
+	catalog.PluginInfo
+
+	// ComposeWorkloadX509SVID returns the attributes of the X509-SVID with
+	// the given SPIFFE ID and public key, signed for the given entry. The
+	// attributes are the ones composed so far.
+	ComposeWorkloadX509SVID(ctx context.Context, id spiffeid.ID, publicKey crypto.PublicKey, entry *types.Entry, attributes X509SVIDAttributes) (X509SVIDAttributes, error)
+
+	// ComposeWorkloadJWTSVID returns the attributes of the JWT-SVID with the
+	// given SPIFFE ID, signed for the given entry. The attributes are the
+	// ones composed so far.
+	ComposeWorkloadJWTSVID(ctx context.Context, id spiffeid.ID, entry *types.Entry, attributes JWTSVIDAttributes) (JWTSVIDAttributes, error)
+}
+
+// X509SVIDAttributes are the attributes of an X509-SVID that can be composed.
+// The SPIFFE ID, validity, key usages and the other extensions that make the
+// certificate an X509-SVID are set by the server CA.
+type X509SVIDAttributes struct {
+	Subject         pkix.Name
+	DNSSANs         []string
+	ExtraExtensions []pkix.Extension
+}
+
+// BuiltIn is a credential composer built into the server. Credential
+// composers can only be built in: they are loaded and configured by the
+// server catalog from their plugin data, rather than as plugins, since the
+// plugin SDK does not define a CredentialComposer service.
+type BuiltIn interface {
+	CredentialComposer
+
+	// Configure configures the credential composer with its HCL plugin data
+	Configure(trustDomain spiffeid.TrustDomain, hclConfig string) error
+}
+
+// JWTSVIDAttributes are the attributes of a JWT-SVID that can be composed.
+// The registered claims (e.g. "sub", "aud", "exp") are set by the server CA.
+type JWTSVIDAttributes struct {
+	Claims map[string]interface{}
+}
@@ -0,0 +1,240 @@
+package static
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/server/plugin/credentialcomposer"
+)
+
+const (
+	PluginName = "static"
+	pluginType = "CredentialComposer"
+)
+
+// idCE is the arc of the certificate extensions, which are reserved to the
+// server CA
+var idCE = asn1.ObjectIdentifier{2, 5, 29}
+
+// Config is the configuration of the plugin: the rules adding attributes to
+// the SVIDs of the entries they match
+type Config struct {
+	Rules []RuleConfig `hcl:"rule"`
+}
+
+// RuleConfig configures a rule. A rule matches the entries whose SPIFFE ID
+// starts with the prefix and which have all the selectors, or all the entries
+// if neither is set.
+type RuleConfig struct {
+	SPIFFEIDPrefix string   `hcl:"spiffe_id_prefix"`
+	Selectors      []string `hcl:"selectors"`
+
+	// X509Extensions are the non-critical extensions added to the X509-SVIDs,
+	// by OID, whose values are encoded as UTF8String
+	X509Extensions map[string]string `hcl:"x509_extensions"`
+
+	// JWTClaims are the claims added to the JWT-SVIDs
+	JWTClaims map[string]string `hcl:"jwt_claims"`
+}
+
+type rule struct {
+	spiffeIDPrefix string
+	selectors      []*types.Selector
+	extensions     []pkix.Extension
+	claims         map[string]interface{}
+}
+
+func (r *rule) matches(id spiffeid.ID, entry *types.Entry) bool {
+	if !strings.HasPrefix(id.String(), r.spiffeIDPrefix) {
+		return false
+	}
+	for _, selector := range r.selectors {
+		if !hasSelector(entry, selector) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasSelector(entry *types.Entry, selector *types.Selector) bool {
+	for _, s := range entry.GetSelectors() {
+		if s.Type == selector.Type && s.Value == selector.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// Plugin is a credential composer adding static certificate extensions and
+// JWT claims, e.g. a cost center, to the SVIDs of the entries matching its
+// rules
+type Plugin struct {
+	mtx        sync.RWMutex
+	configured bool
+	rules      []*rule
+}
+
+var _ credentialcomposer.BuiltIn = (*Plugin)(nil)
+
+func New() *Plugin {
+	return &Plugin{}
+}
+
+func (p *Plugin) Name() string {
+	return PluginName
+}
+
+func (p *Plugin) Type() string {
+	return pluginType
+}
+
+func (p *Plugin) Configure(trustDomain spiffeid.TrustDomain, hclConfig string) error {
+	config := new(Config)
+	if err := hcl.Decode(config, hclConfig); err != nil {
+		return fmt.Errorf("unable to decode configuration: %w", err)
+	}
+
+	var rules []*rule
+	for i, ruleConfig := range config.Rules {
+		r, err := buildRule(trustDomain, ruleConfig)
+		if err != nil {
+			return fmt.Errorf("invalid rule %d: %w", i, err)
+		}
+		rules = append(rules, r)
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.configured = true
+	p.rules = rules
+	return nil
+}
+
+func buildRule(trustDomain spiffeid.TrustDomain, config RuleConfig) (*rule, error) {
+	r := &rule{
+		spiffeIDPrefix: config.SPIFFEIDPrefix,
+		claims:         make(map[string]interface{}),
+	}
+	if r.spiffeIDPrefix != "" && !strings.HasPrefix(r.spiffeIDPrefix, trustDomain.IDString()) {
+		return nil, fmt.Errorf("SPIFFE ID prefix %q is not in trust domain %q", r.spiffeIDPrefix, trustDomain)
+	}
+
+	for _, selector := range config.Selectors {
+		parts := strings.SplitN(selector, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("selector %q is not of the form type:value", selector)
+		}
+		r.selectors = append(r.selectors, &types.Selector{Type: parts[0], Value: parts[1]})
+	}
+
+	// Sort the extensions so the certificates are the same for every
+	// signing
+	oids := make([]string, 0, len(config.X509Extensions))
+	for oid := range config.X509Extensions {
+		oids = append(oids, oid)
+	}
+	sort.Strings(oids)
+	for _, oid := range oids {
+		id, err := parseOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		if len(id) > len(idCE) && id[:len(idCE)].Equal(idCE) {
+			return nil, fmt.Errorf("certificate extension %s is reserved to the server CA", oid)
+		}
+		value, err := asn1.MarshalWithParams(config.X509Extensions[oid], "utf8")
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode the value of extension %s: %w", oid, err)
+		}
+		r.extensions = append(r.extensions, pkix.Extension{Id: id, Value: value})
+	}
+
+	for claim, value := range config.JWTClaims {
+		r.claims[claim] = value
+	}
+	return r, nil
+}
+
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("malformed OID %q", s)
+	}
+	oid := make(asn1.ObjectIdentifier, 0, len(parts))
+	for _, part := range parts {
+		arc, err := strconv.Atoi(part)
+		if err != nil || arc < 0 {
+			return nil, fmt.Errorf("malformed OID %q", s)
+		}
+		oid = append(oid, arc)
+	}
+	return oid, nil
+}
+
+func (p *Plugin) ComposeWorkloadX509SVID(ctx context.Context, id spiffeid.ID, publicKey crypto.PublicKey, entry *types.Entry, attributes credentialcomposer.X509SVIDAttributes) (credentialcomposer.X509SVIDAttributes, error) {
+	rules, err := p.getRules()
+	if err != nil {
+		return attributes, err
+	}
+
+	for _, r := range rules {
+		if !r.matches(id, entry) {
+			continue
+		}
+		for _, extension := range r.extensions {
+			attributes.ExtraExtensions = setExtension(attributes.ExtraExtensions, extension)
+		}
+	}
+	return attributes, nil
+}
+
+// setExtension sets the extension, replacing the one of the same OID, if any
+func setExtension(extensions []pkix.Extension, extension pkix.Extension) []pkix.Extension {
+	for i := range extensions {
+		if extensions[i].Id.Equal(extension.Id) {
+			extensions[i] = extension
+			return extensions
+		}
+	}
+	return append(extensions, extension)
+}
+
+func (p *Plugin) ComposeWorkloadJWTSVID(ctx context.Context, id spiffeid.ID, entry *types.Entry, attributes credentialcomposer.JWTSVIDAttributes) (credentialcomposer.JWTSVIDAttributes, error) {
+	rules, err := p.getRules()
+	if err != nil {
+		return attributes, err
+	}
+
+	for _, r := range rules {
+		if !r.matches(id, entry) {
+			continue
+		}
+		for claim, value := range r.claims {
+			if attributes.Claims == nil {
+				attributes.Claims = make(map[string]interface{})
+			}
+			attributes.Claims[claim] = value
+		}
+	}
+	return attributes, nil
+}
+
+func (p *Plugin) getRules() ([]*rule, error) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	if !p.configured {
+		return nil, errors.New("not configured")
+	}
+	return p.rules, nil
+}
@@ -0,0 +1,157 @@
+package static
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/server/plugin/credentialcomposer"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	td         = spiffeid.RequireTrustDomainFromString("example.org")
+	payments   = td.NewID("/payments/api")
+	billing    = td.NewID("/billing")
+	costCenter = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 1}
+	team       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 2}
+
+	paymentsEntry = &types.Entry{
+		Selectors: []*types.Selector{
+			{Type: "k8s", Value: "ns:payments"},
+			{Type: "k8s", Value: "sa:api"},
+		},
+	}
+)
+
+const config = `
+rule {
+	spiffe_id_prefix = "spiffe://example.org/payments/"
+	selectors = ["k8s:ns:payments"]
+	x509_extensions = {
+		"1.3.6.1.4.1.55555.1" = "cc-42"
+	}
+	jwt_claims = {
+		cost_center = "cc-42"
+	}
+}
+
+rule {
+	x509_extensions = {
+		"1.3.6.1.4.1.55555.2" = "platform"
+	}
+}
+`
+
+func TestComposeWorkloadX509SVID(t *testing.T) {
+	p := New()
+	require.NoError(t, p.Configure(td, config))
+
+	existing := pkix.Extension{Id: team, Value: []byte("existing")}
+	attributes, err := p.ComposeWorkloadX509SVID(context.Background(), payments, nil, paymentsEntry, credentialcomposer.X509SVIDAttributes{
+		Subject:         pkix.Name{CommonName: "api"},
+		ExtraExtensions: []pkix.Extension{existing},
+	})
+	require.NoError(t, err)
+	require.Equal(t, pkix.Name{CommonName: "api"}, attributes.Subject)
+	require.Equal(t, []pkix.Extension{
+		{Id: team, Value: utf8String(t, "platform")},
+		{Id: costCenter, Value: utf8String(t, "cc-42")},
+	}, attributes.ExtraExtensions)
+
+	// Only the rule without matchers applies to other entries
+	attributes, err = p.ComposeWorkloadX509SVID(context.Background(), billing, nil, paymentsEntry, credentialcomposer.X509SVIDAttributes{})
+	require.NoError(t, err)
+	require.Equal(t, []pkix.Extension{
+		{Id: team, Value: utf8String(t, "platform")},
+	}, attributes.ExtraExtensions)
+
+	// All the selectors of a rule must match
+	attributes, err = p.ComposeWorkloadX509SVID(context.Background(), payments, nil, &types.Entry{}, credentialcomposer.X509SVIDAttributes{})
+	require.NoError(t, err)
+	require.Equal(t, []pkix.Extension{
+		{Id: team, Value: utf8String(t, "platform")},
+	}, attributes.ExtraExtensions)
+}
+
+func TestComposeWorkloadJWTSVID(t *testing.T) {
+	p := New()
+	require.NoError(t, p.Configure(td, config))
+
+	attributes, err := p.ComposeWorkloadJWTSVID(context.Background(), payments, paymentsEntry, credentialcomposer.JWTSVIDAttributes{
+		Claims: map[string]interface{}{"composed": true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"composed":    true,
+		"cost_center": "cc-42",
+	}, attributes.Claims)
+
+	attributes, err = p.ComposeWorkloadJWTSVID(context.Background(), billing, paymentsEntry, credentialcomposer.JWTSVIDAttributes{})
+	require.NoError(t, err)
+	require.Nil(t, attributes.Claims)
+}
+
+func TestNotConfigured(t *testing.T) {
+	p := New()
+	_, err := p.ComposeWorkloadX509SVID(context.Background(), payments, nil, paymentsEntry, credentialcomposer.X509SVIDAttributes{})
+	require.EqualError(t, err, "not configured")
+	_, err = p.ComposeWorkloadJWTSVID(context.Background(), payments, paymentsEntry, credentialcomposer.JWTSVIDAttributes{})
+	require.EqualError(t, err, "not configured")
+
+	// A configuration without rules composes nothing
+	require.NoError(t, p.Configure(td, ""))
+	attributes, err := p.ComposeWorkloadJWTSVID(context.Background(), payments, paymentsEntry, credentialcomposer.JWTSVIDAttributes{})
+	require.NoError(t, err)
+	require.Nil(t, attributes.Claims)
+}
+
+func TestConfigure(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		config    string
+		expectErr string
+	}{
+		{
+			name:      "malformed",
+			config:    "rule {",
+			expectErr: "unable to decode configuration",
+		},
+		{
+			name:      "prefix of another trust domain",
+			config:    `rule { spiffe_id_prefix = "spiffe://other.org/" }`,
+			expectErr: `invalid rule 0: SPIFFE ID prefix "spiffe://other.org/" is not in trust domain "example.org"`,
+		},
+		{
+			name:      "malformed selector",
+			config:    `rule { selectors = ["k8s"] }`,
+			expectErr: `invalid rule 0: selector "k8s" is not of the form type:value`,
+		},
+		{
+			name:      "malformed OID",
+			config:    `rule { x509_extensions = { "1.3.six" = "value" } }`,
+			expectErr: `invalid rule 0: malformed OID "1.3.six"`,
+		},
+		{
+			name:      "certificate extension",
+			config:    `rule { x509_extensions = { "2.5.29.17" = "value" } }`,
+			expectErr: "invalid rule 0: certificate extension 2.5.29.17 is reserved to the server CA",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := New().Configure(td, tt.config)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.expectErr)
+		})
+	}
+}
+
+func utf8String(t *testing.T, s string) []byte {
+	b, err := asn1.MarshalWithParams(s, "utf8")
+	require.NoError(t, err)
+	return b
+}
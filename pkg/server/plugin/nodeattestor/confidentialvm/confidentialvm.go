@@ -0,0 +1,374 @@
+package confidentialvm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/hcl"
+	nodeattestorv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/plugin/server/nodeattestor/v1"
+	configv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/service/common/config/v1"
+	"github.com/spiffe/spire/pkg/common/catalog"
+	"github.com/spiffe/spire/pkg/common/idutil"
+	"github.com/spiffe/spire/pkg/common/plugin/confidentialvm"
+	"github.com/spiffe/spire/pkg/common/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func BuiltIn() catalog.BuiltIn {
+	return builtin(New())
+}
+
+func builtin(p *Plugin) catalog.BuiltIn {
+	return catalog.MakeBuiltIn(confidentialvm.PluginName,
+		nodeattestorv1.NodeAttestorPluginServer(p),
+		configv1.ConfigServiceServer(p),
+	)
+}
+
+type Config struct {
+	// SEVSNPRootsPath is the path to the AMD root keys (ARK) SEV-SNP
+	// attestation reports chain up to
+	SEVSNPRootsPath string `hcl:"sev_snp_roots_path"`
+
+	// TDXRootsPath is the path to the Intel SGX root CA TDX quotes chain up
+	// to
+	TDXRootsPath string `hcl:"tdx_roots_path"`
+
+	// SEVSNPCRLPath is the path to the CRL of the AMD root key, which
+	// revokes AMD SEV keys (ASK)
+	SEVSNPCRLPath string `hcl:"sev_snp_crl_path"`
+
+	// SEVSNPMinTCB is the minimum TCB of SEV-SNP platforms
+	SEVSNPMinTCB *SEVSNPTCB `hcl:"sev_snp_min_tcb"`
+
+	// TDXTCBInfoPath, TDXQEIdentityPath and TDXTCBSigningChainPath are the
+	// paths to the TDX TCB info, the TD QE identity and the chain of the
+	// certificate signing them, as served by the Intel Provisioning
+	// Certification Service
+	TDXTCBInfoPath         string `hcl:"tdx_tcb_info_path"`
+	TDXQEIdentityPath      string `hcl:"tdx_qe_identity_path"`
+	TDXTCBSigningChainPath string `hcl:"tdx_tcb_signing_chain_path"`
+
+	// TDXAllowedTCBStatuses are the TCB statuses of TDX platforms, TDX
+	// modules and Quoting Enclaves allowed besides UpToDate
+	TDXAllowedTCBStatuses []string `hcl:"tdx_allowed_tcb_statuses"`
+
+	// InsecureSkipTCBChecks allows the configuration of roots without the
+	// collateral needed to check the revocation and TCB status of the
+	// platforms. Only the TCB the evidence is certified for is checked.
+	InsecureSkipTCBChecks bool `hcl:"insecure_skip_tcb_checks"`
+
+	// AllowDebug allows the attestation of guests the host can debug, i.e.
+	// whose memory is not confidential
+	AllowDebug bool `hcl:"allow_debug"`
+}
+
+type configuration struct {
+	trustDomain string
+	roots       map[string][]*x509.Certificate
+	sevSNP      sevSNPConfig
+	tdx         tdxConfig
+	allowDebug  bool
+}
+
+// evidence is what the attestation evidence tells about a confidential VM
+type evidence struct {
+	// id identifies the VM
+	id []byte
+	// measurement is the launch measurement of the VM
+	measurement []byte
+	// policyDigest is the digest of the policy of the VM: the HOST_DATA of
+	// SEV-SNP guests and the MRCONFIGID of TDX trust domains
+	policyDigest []byte
+	// reportData is the data the VM asked to include in the evidence
+	reportData []byte
+	// debug tells whether the host can debug the VM
+	debug bool
+}
+
+type Plugin struct {
+	nodeattestorv1.UnsafeNodeAttestorServer
+	configv1.UnsafeConfigServer
+
+	clock clock.Clock
+	log   hclog.Logger
+
+	m      sync.Mutex
+	config *configuration
+}
+
+func New() *Plugin {
+	return &Plugin{
+		clock: clock.New(),
+	}
+}
+
+func (p *Plugin) Attest(stream nodeattestorv1.NodeAttestor_AttestServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	config, err := p.getConfig()
+	if err != nil {
+		return err
+	}
+
+	payload := req.GetPayload()
+	if payload == nil {
+		return status.Error(codes.InvalidArgument, "missing attestation payload")
+	}
+
+	attestationData := new(confidentialvm.AttestationData)
+	if err := json.Unmarshal(payload, attestationData); err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to unmarshal data: %v", err)
+	}
+
+	roots, ok := config.roots[attestationData.Type]
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "unsupported confidential VM type %q", attestationData.Type)
+	}
+
+	// the nonce is included in the evidence, proving it is fresh
+	nonce := make([]byte, confidentialvm.NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return status.Errorf(codes.Internal, "unable to generate challenge: %v", err)
+	}
+
+	challengeBytes, err := json.Marshal(confidentialvm.Challenge{
+		Nonce: nonce,
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to marshal challenge: %v", err)
+	}
+
+	if err := stream.Send(&nodeattestorv1.AttestResponse{
+		Response: &nodeattestorv1.AttestResponse_Challenge{
+			Challenge: challengeBytes,
+		},
+	}); err != nil {
+		return err
+	}
+
+	responseReq, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	response := new(confidentialvm.Response)
+	if err := json.Unmarshal(responseReq.GetChallengeResponse(), response); err != nil {
+		return status.Errorf(codes.InvalidArgument, "unable to unmarshal challenge response: %v", err)
+	}
+
+	ev, err := verifyEvidence(attestationData.Type, response, roots, config, p.clock.Now())
+	if err != nil {
+		return status.Errorf(codes.PermissionDenied, "%s evidence verification failed: %v", attestationData.Type, err)
+	}
+	if !bytes.Equal(ev.reportData, nonce) {
+		return status.Error(codes.PermissionDenied, "evidence does not include the challenge nonce")
+	}
+	if ev.debug && !config.allowDebug {
+		return status.Error(codes.PermissionDenied, "debuggable confidential VMs are not allowed")
+	}
+
+	return stream.Send(&nodeattestorv1.AttestResponse{
+		Response: &nodeattestorv1.AttestResponse_AgentAttributes{
+			AgentAttributes: &nodeattestorv1.AgentAttributes{
+				SpiffeId:       idutil.AgentID(config.trustDomain, fmt.Sprintf("%s/%s/%s", confidentialvm.PluginName, attestationData.Type, hex.EncodeToString(ev.id))),
+				SelectorValues: buildSelectorValues(attestationData.Type, ev),
+			},
+		},
+	})
+}
+
+func (p *Plugin) Configure(ctx context.Context, req *configv1.ConfigureRequest) (*configv1.ConfigureResponse, error) {
+	hclConfig := new(Config)
+	if err := hcl.Decode(hclConfig, req.HclConfiguration); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "unable to decode configuration: %v", err)
+	}
+
+	if req.CoreConfiguration == nil {
+		return nil, status.Error(codes.InvalidArgument, "core configuration is required")
+	}
+
+	if req.CoreConfiguration.TrustDomain == "" {
+		return nil, status.Error(codes.InvalidArgument, "trust_domain is required")
+	}
+
+	if hclConfig.SEVSNPRootsPath == "" && hclConfig.TDXRootsPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "sev_snp_roots_path or tdx_roots_path must be configured")
+	}
+
+	roots := make(map[string][]*x509.Certificate)
+	for _, vm := range []struct {
+		vmType string
+		path   string
+	}{
+		{vmType: confidentialvm.TypeSEVSNP, path: hclConfig.SEVSNPRootsPath},
+		{vmType: confidentialvm.TypeTDX, path: hclConfig.TDXRootsPath},
+	} {
+		if vm.path == "" {
+			continue
+		}
+		certs, err := util.LoadCertificates(vm.path)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "unable to load %s roots %q: %v", vm.vmType, vm.path, err)
+		}
+		if len(certs) == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "no %s roots found in %q", vm.vmType, vm.path)
+		}
+		roots[vm.vmType] = certs
+	}
+
+	sevSNP := sevSNPConfig{
+		crlPath: hclConfig.SEVSNPCRLPath,
+		minTCB:  hclConfig.SEVSNPMinTCB,
+	}
+	if hclConfig.SEVSNPRootsPath != "" && sevSNP.crlPath == "" {
+		if !hclConfig.InsecureSkipTCBChecks {
+			return nil, status.Error(codes.InvalidArgument, "sev_snp_crl_path is required to attest SEV-SNP guests unless insecure_skip_tcb_checks is set")
+		}
+		p.log.Warn("The revocation of SEV-SNP platforms is not checked since insecure_skip_tcb_checks is set")
+	}
+
+	tdx, err := buildTDXConfig(hclConfig)
+	if err != nil {
+		return nil, err
+	}
+	if hclConfig.TDXRootsPath != "" && !tdx.enabled() {
+		if !hclConfig.InsecureSkipTCBChecks {
+			return nil, status.Error(codes.InvalidArgument, "tdx_tcb_info_path, tdx_qe_identity_path and tdx_tcb_signing_chain_path are required to attest TDX guests unless insecure_skip_tcb_checks is set")
+		}
+		p.log.Warn("The TCB status of TDX platforms and the identity of their Quoting Enclave are not checked since insecure_skip_tcb_checks is set")
+	}
+
+	p.setConfiguration(&configuration{
+		trustDomain: req.CoreConfiguration.TrustDomain,
+		roots:       roots,
+		sevSNP:      sevSNP,
+		tdx:         tdx,
+		allowDebug:  hclConfig.AllowDebug,
+	})
+
+	return &configv1.ConfigureResponse{}, nil
+}
+
+// SetLogger sets this plugin's logger
+func (p *Plugin) SetLogger(log hclog.Logger) {
+	p.log = log
+}
+
+func buildTDXConfig(hclConfig *Config) (tdxConfig, error) {
+	paths := []string{hclConfig.TDXTCBInfoPath, hclConfig.TDXQEIdentityPath, hclConfig.TDXTCBSigningChainPath}
+	var configured int
+	for _, path := range paths {
+		if path != "" {
+			configured++
+		}
+	}
+	switch configured {
+	case 0:
+		return tdxConfig{}, nil
+	case len(paths):
+	default:
+		return tdxConfig{}, status.Error(codes.InvalidArgument, "tdx_tcb_info_path, tdx_qe_identity_path and tdx_tcb_signing_chain_path must be configured together")
+	}
+
+	signingChain, err := util.LoadCertificates(hclConfig.TDXTCBSigningChainPath)
+	if err != nil {
+		return tdxConfig{}, status.Errorf(codes.InvalidArgument, "unable to load TDX TCB signing chain %q: %v", hclConfig.TDXTCBSigningChainPath, err)
+	}
+	if len(signingChain) == 0 {
+		return tdxConfig{}, status.Errorf(codes.InvalidArgument, "no certificates found in %q", hclConfig.TDXTCBSigningChainPath)
+	}
+
+	allowedStatuses := make(map[string]bool)
+	for _, tcbStatus := range hclConfig.TDXAllowedTCBStatuses {
+		allowedStatuses[tcbStatus] = true
+	}
+	return tdxConfig{
+		tcbInfoPath:     hclConfig.TDXTCBInfoPath,
+		qeIdentityPath:  hclConfig.TDXQEIdentityPath,
+		signingChain:    signingChain,
+		allowedStatuses: allowedStatuses,
+	}, nil
+}
+
+func (p *Plugin) getConfig() (*configuration, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.config == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "not configured")
+	}
+	return p.config, nil
+}
+
+func (p *Plugin) setConfiguration(config *configuration) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.config = config
+}
+
+func verifyEvidence(vmType string, response *confidentialvm.Response, roots []*x509.Certificate, config *configuration, now time.Time) (*evidence, error) {
+	switch vmType {
+	case confidentialvm.TypeSEVSNP:
+		chain := make([]*x509.Certificate, 0, len(response.Certificates))
+		for i, certBytes := range response.Certificates {
+			cert, err := x509.ParseCertificate(certBytes)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse certificate %d: %w", i, err)
+			}
+			chain = append(chain, cert)
+		}
+		return verifySEVSNPReport(response.Evidence, chain, roots, config.sevSNP, now)
+	case confidentialvm.TypeTDX:
+		return verifyTDXQuote(response.Evidence, roots, config.tdx, now)
+	default:
+		return nil, fmt.Errorf("unsupported confidential VM type %q", vmType)
+	}
+}
+
+// verifyCertChain verifies that the leaf certificate chains up to one of the
+// roots through the intermediates, which are ordered from the leaf up. The
+// chains of AMD and Intel are checked signature by signature rather than
+// with x509.Certificate.Verify, which does not cope with the extensions and
+// names of all their certificates.
+func verifyCertChain(leaf *x509.Certificate, intermediates, roots []*x509.Certificate, now time.Time) error {
+	chain := append([]*x509.Certificate{leaf}, intermediates...)
+	for i, cert := range chain {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return fmt.Errorf("certificate %q is not valid at this time", cert.Subject)
+		}
+		for _, root := range roots {
+			if bytes.Equal(cert.Raw, root.Raw) || cert.CheckSignatureFrom(root) == nil {
+				return nil
+			}
+		}
+		if i+1 < len(chain) {
+			if err := cert.CheckSignatureFrom(chain[i+1]); err != nil {
+				return fmt.Errorf("certificate %q is not signed by %q: %w", cert.Subject, chain[i+1].Subject, err)
+			}
+		}
+	}
+	return errors.New("certificate chain does not chain up to a trusted root")
+}
+
+func buildSelectorValues(vmType string, ev *evidence) []string {
+	return []string{
+		"type:" + vmType,
+		"measurement:" + hex.EncodeToString(ev.measurement),
+		"policy_digest:" + hex.EncodeToString(ev.policyDigest),
+		fmt.Sprintf("debug:%t", ev.debug),
+	}
+}
@@ -0,0 +1,893 @@
+package confidentialvm
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/common/catalog"
+	"github.com/spiffe/spire/pkg/common/pemutil"
+	"github.com/spiffe/spire/pkg/common/plugin/confidentialvm"
+	"github.com/spiffe/spire/pkg/server/plugin/nodeattestor"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/spiffe/spire/test/plugintest"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+var (
+	measurement  = bytes.Repeat([]byte{0x11}, 48)
+	hostData     = bytes.Repeat([]byte{0x22}, 32)
+	mrConfigID   = bytes.Repeat([]byte{0x33}, 48)
+	snpReportID  = bytes.Repeat([]byte{0x44}, 32)
+	snpDebugMode = uint64(snpPolicyDebug)
+	snpChipID    = bytes.Repeat([]byte{0x55}, 64)
+	// snpTCB is bootloader 3, TEE 0, SNP 8 and microcode 115
+	snpTCB = []byte{3, 0, 0, 0, 0, 0, 8, 115}
+
+	pckPPID         = bytes.Repeat([]byte{0x66}, 16)
+	pckFMSPC        = []byte{0x00, 0x90, 0x6e, 0xd5, 0x00, 0x00}
+	tdxModuleSigner = bytes.Repeat([]byte{0x77}, 48)
+	tdxQESigner     = bytes.Repeat([]byte{0x88}, 32)
+	tdxQEProdID     = uint16(2)
+	tdxQESVN        = uint16(4)
+	tdxQEAttributes = []byte{0x11, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	// tdxTCBSVN is the SVN of every TCB component of the test platforms
+	tdxTCBSVN = 2
+	tdxPCESVN = 11
+)
+
+type testPKI struct {
+	rootsPath string
+	root      *x509.Certificate
+	rootKey   *ecdsa.PrivateKey
+	chain     []*x509.Certificate
+	key       *ecdsa.PrivateKey
+}
+
+func TestAttestSEVSNP(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	pki := newTestPKI(t, dir, "ark", elliptic.P384(), vcekCertExtensions(t))
+	untrustedPKI := newTestPKI(t, dir, "untrusted", elliptic.P384(), vcekCertExtensions(t))
+	crlPath := writeCRL(t, dir, "ark", pki, time.Now().Add(time.Hour))
+	config := `
+		sev_snp_roots_path = "` + pki.rootsPath + `"
+		sev_snp_crl_path = "` + crlPath + `"
+	`
+
+	attestor := loadPlugin(t, config)
+
+	respond := func(pki *testPKI, policy uint64, tamper func([]byte)) func(context.Context, []byte) ([]byte, error) {
+		return func(ctx context.Context, challenge []byte) ([]byte, error) {
+			report := makeSEVSNPReport(t, pki.key, challengeNonce(t, challenge), policy, nil)
+			if tamper != nil {
+				tamper(report)
+			}
+			return makeResponse(t, report, pki.chain), nil
+		}
+	}
+	respondWith := func(modify func([]byte)) func(context.Context, []byte) ([]byte, error) {
+		return func(ctx context.Context, challenge []byte) ([]byte, error) {
+			return makeResponse(t, makeSEVSNPReport(t, pki.key, challengeNonce(t, challenge), 0, modify), pki.chain), nil
+		}
+	}
+
+	result, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respond(pki, 0, nil))
+	require.NoError(t, err)
+	require.Equal(t, "spiffe://example.org/spire/agent/confidential_vm/sev_snp/"+hex.EncodeToString(snpReportID), result.AgentID)
+	spiretest.AssertProtoListEqual(t, []*common.Selector{
+		{Type: "confidential_vm", Value: "type:sev_snp"},
+		{Type: "confidential_vm", Value: "measurement:" + hex.EncodeToString(measurement)},
+		{Type: "confidential_vm", Value: "policy_digest:" + hex.EncodeToString(hostData)},
+		{Type: "confidential_vm", Value: "debug:false"},
+	}, result.Selectors)
+
+	t.Run("untrusted VCEK", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respond(untrustedPKI, 0, nil))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "sev_snp evidence verification failed: unable to verify VCEK certificate")
+	})
+
+	t.Run("tampered report", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respond(pki, 0, func(report []byte) {
+			report[snpMeasurementOffset] ^= 0xff
+		}))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "report signature verification failed")
+	})
+
+	t.Run("replayed report", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), func(ctx context.Context, challenge []byte) ([]byte, error) {
+			return makeResponse(t, makeSEVSNPReport(t, pki.key, make([]byte, confidentialvm.NonceSize), 0, nil), pki.chain), nil
+		})
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "evidence does not include the challenge nonce")
+	})
+
+	t.Run("invalid report size", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), func(ctx context.Context, challenge []byte) ([]byte, error) {
+			return makeResponse(t, []byte("report"), pki.chain), nil
+		})
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "invalid report size 6; expected 1184")
+	})
+
+	t.Run("debug not allowed", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respond(pki, snpDebugMode, nil))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "debuggable confidential VMs are not allowed")
+	})
+
+	t.Run("debug allowed", func(t *testing.T) {
+		attestor := loadPlugin(t, config+`allow_debug = true`)
+		result, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respond(pki, snpDebugMode, nil))
+		require.NoError(t, err)
+		spiretest.AssertProtoListEqual(t, []*common.Selector{
+			{Type: "confidential_vm", Value: "type:sev_snp"},
+			{Type: "confidential_vm", Value: "measurement:" + hex.EncodeToString(measurement)},
+			{Type: "confidential_vm", Value: "policy_digest:" + hex.EncodeToString(hostData)},
+			{Type: "confidential_vm", Value: "debug:true"},
+		}, result.Selectors)
+	})
+
+	t.Run("TCB does not match VCEK", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respondWith(func(report []byte) {
+			report[snpReportedTCBOffset+snpTCBSNPOffset] = 7
+		}))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "reported SNP SPL 7 does not match the VCEK SNP SPL 8")
+	})
+
+	t.Run("chip does not match VCEK", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respondWith(func(report []byte) {
+			report[snpChipIDOffset] ^= 0xff
+		}))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "report chip ID does not match the VCEK hardware ID")
+	})
+
+	t.Run("TCB lower than minimum", func(t *testing.T) {
+		attestor := loadPlugin(t, config+`
+			sev_snp_min_tcb {
+				bootloader = 3
+				tee = 0
+				snp = 9
+				microcode = 115
+			}
+		`)
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respond(pki, 0, nil))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "reported SNP SPL 8 is lower than the minimum of 9")
+	})
+
+	t.Run("revoked ASK", func(t *testing.T) {
+		attestor := loadPlugin(t, `
+			sev_snp_roots_path = "`+pki.rootsPath+`"
+			sev_snp_crl_path = "`+writeCRL(t, dir, "revoked", pki, time.Now().Add(time.Hour), pki.chain[1])+`"
+		`)
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respond(pki, 0, nil))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, `certificate "CN=ark-intermediate" is revoked`)
+	})
+
+	t.Run("expired CRL", func(t *testing.T) {
+		attestor := loadPlugin(t, `
+			sev_snp_roots_path = "`+pki.rootsPath+`"
+			sev_snp_crl_path = "`+writeCRL(t, dir, "expired", pki, time.Now().Add(-time.Minute))+`"
+		`)
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respond(pki, 0, nil))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "AMD CRL has expired")
+	})
+
+	t.Run("untrusted CRL", func(t *testing.T) {
+		attestor := loadPlugin(t, `
+			sev_snp_roots_path = "`+pki.rootsPath+`"
+			sev_snp_crl_path = "`+writeCRL(t, dir, "untrusted", untrustedPKI, time.Now().Add(time.Hour))+`"
+		`)
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respond(pki, 0, nil))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "AMD CRL is not signed by a trusted root")
+	})
+
+	t.Run("insecure without CRL", func(t *testing.T) {
+		attestor := loadPlugin(t, `
+			sev_snp_roots_path = "`+pki.rootsPath+`"
+			insecure_skip_tcb_checks = true
+		`)
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respond(pki, 0, nil))
+		require.NoError(t, err)
+
+		// The TCB the VCEK is certified for is still checked
+		_, err = attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), respondWith(func(report []byte) {
+			report[snpReportedTCBOffset+snpTCBMicrocodeOffset] = 116
+		}))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "reported microcode SPL 116 does not match the VCEK microcode SPL 115")
+	})
+
+	t.Run("TDX not configured", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), expectNoChallenge)
+		spiretest.RequireGRPCStatusContains(t, err, codes.InvalidArgument, `unsupported confidential VM type "tdx"`)
+	})
+}
+
+func TestAttestTDX(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	pki := newTestPKI(t, dir, "intel", elliptic.P256(), pckCertExtensions(t))
+	untrustedPKI := newTestPKI(t, dir, "untrusted", elliptic.P256(), pckCertExtensions(t))
+	collateral := writeTDXCollateral(t, dir, "intel", pki, nil, nil)
+
+	attestor := loadPlugin(t, `tdx_roots_path = "`+pki.rootsPath+`"`+collateral)
+
+	respond := func(pki *testPKI, tdAttributes uint64, tamper func([]byte)) func(context.Context, []byte) ([]byte, error) {
+		return func(ctx context.Context, challenge []byte) ([]byte, error) {
+			quote := makeTDXQuote(t, pki, challengeNonce(t, challenge), tdAttributes, nil)
+			if tamper != nil {
+				tamper(quote)
+			}
+			return makeResponse(t, quote, nil), nil
+		}
+	}
+	respondWith := func(modify func(tdReport, qeReport []byte)) func(context.Context, []byte) ([]byte, error) {
+		return func(ctx context.Context, challenge []byte) ([]byte, error) {
+			return makeResponse(t, makeTDXQuote(t, pki, challengeNonce(t, challenge), 0, modify), nil), nil
+		}
+	}
+
+	// The agent ID of a trust domain is derived from its measurement and
+	// configuration and from the platform it runs on, so it is stable
+	// across attestations
+	id := sha256.Sum256(bytes.Join([][]byte{measurement, mrConfigID, pckPPID, pckFMSPC}, nil))
+	result, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respond(pki, 0, nil))
+	require.NoError(t, err)
+	require.Equal(t, "spiffe://example.org/spire/agent/confidential_vm/tdx/"+hex.EncodeToString(id[:]), result.AgentID)
+	spiretest.AssertProtoListEqual(t, []*common.Selector{
+		{Type: "confidential_vm", Value: "type:tdx"},
+		{Type: "confidential_vm", Value: "measurement:" + hex.EncodeToString(measurement)},
+		{Type: "confidential_vm", Value: "policy_digest:" + hex.EncodeToString(mrConfigID)},
+		{Type: "confidential_vm", Value: "debug:false"},
+	}, result.Selectors)
+
+	other, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respond(pki, 0, nil))
+	require.NoError(t, err)
+	require.Equal(t, result.AgentID, other.AgentID)
+
+	t.Run("different configuration", func(t *testing.T) {
+		other, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respondWith(func(tdReport, qeReport []byte) {
+			tdReport[tdxMRConfigIDOffset] ^= 0xff
+		}))
+		require.NoError(t, err)
+		require.NotEqual(t, result.AgentID, other.AgentID)
+	})
+
+	t.Run("untrusted PCK", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respond(untrustedPKI, 0, nil))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "tdx evidence verification failed: unable to verify PCK certificate")
+	})
+
+	t.Run("tampered quote", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respond(pki, 0, func(quote []byte) {
+			quote[tdxHeaderSize+tdxMRTDOffset] ^= 0xff
+		}))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "quote signature verification failed")
+	})
+
+	t.Run("tampered QE report", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respond(pki, 0, func(quote []byte) {
+			// The QE report follows the signature data size, the quote
+			// signature, the attestation key and the certification data
+			// type and size
+			quote[tdxHeaderSize+tdxTDReportSize+4+tdxSignatureSize+tdxPublicKeySize+6] ^= 0xff
+		}))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "QE report signature verification failed")
+	})
+
+	t.Run("truncated quote", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), func(ctx context.Context, challenge []byte) ([]byte, error) {
+			quote := makeTDXQuote(t, pki, challengeNonce(t, challenge), 0, nil)
+			return makeResponse(t, quote[:len(quote)-10], nil), nil
+		})
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "invalid signature data: size")
+	})
+
+	t.Run("debug not allowed", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respond(pki, tdxTDAttributesDebug, nil))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "debuggable confidential VMs are not allowed")
+	})
+
+	t.Run("out of date TCB", func(t *testing.T) {
+		outOfDate := respondWith(func(tdReport, qeReport []byte) {
+			tdReport[tdxTEETCBSVNOffset] = byte(tdxTCBSVN - 1)
+		})
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), outOfDate)
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, `TCB status "OutOfDate" is not allowed`)
+
+		attestor := loadPlugin(t, `
+			tdx_roots_path = "`+pki.rootsPath+`"
+			tdx_allowed_tcb_statuses = ["OutOfDate"]
+		`+collateral)
+		_, err = attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), outOfDate)
+		require.NoError(t, err)
+	})
+
+	t.Run("unrecognized TCB", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respondWith(func(tdReport, qeReport []byte) {
+			tdReport[tdxTEETCBSVNOffset] = 0
+		}))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "TCB is not recognized")
+	})
+
+	t.Run("TDX module not signed by Intel", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respondWith(func(tdReport, qeReport []byte) {
+			tdReport[tdxMRSignerSEAMOffset] ^= 0xff
+		}))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "TDX module is not signed by Intel")
+	})
+
+	t.Run("QE not signed by Intel", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respondWith(func(tdReport, qeReport []byte) {
+			qeReport[tdxQEMRSignerOffset] ^= 0xff
+		}))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "QE is not signed by Intel")
+	})
+
+	t.Run("QE attributes do not match", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respondWith(func(tdReport, qeReport []byte) {
+			qeReport[tdxQEAttributesOffset] |= 0x02
+		}))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "QE attributes do not match")
+	})
+
+	t.Run("out of date QE", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respondWith(func(tdReport, qeReport []byte) {
+			binary.LittleEndian.PutUint16(qeReport[tdxQEISVSVNOffset:], tdxQESVN-1)
+		}))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, `QE TCB status "OutOfDate" is not allowed`)
+	})
+
+	for _, tt := range []struct {
+		name             string
+		modifyTCBInfo    func(map[string]interface{})
+		modifyQEIdentity func(map[string]interface{})
+		expectMessage    string
+	}{
+		{
+			name: "stale TCB info",
+			modifyTCBInfo: func(tcbInfo map[string]interface{}) {
+				tcbInfo["nextUpdate"] = time.Now().Add(-time.Minute)
+			},
+			expectMessage: "TCB info is out of date",
+		},
+		{
+			name: "stale QE identity",
+			modifyQEIdentity: func(qeIdentity map[string]interface{}) {
+				qeIdentity["nextUpdate"] = time.Now().Add(-time.Minute)
+			},
+			expectMessage: "QE identity is out of date",
+		},
+		{
+			name: "TCB info of another platform",
+			modifyTCBInfo: func(tcbInfo map[string]interface{}) {
+				tcbInfo["fmspc"] = "00606a000000"
+			},
+			expectMessage: "TCB info is for FMSPC 00606a000000, not 00906ed50000",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			attestor := loadPlugin(t, `tdx_roots_path = "`+pki.rootsPath+`"`+writeTDXCollateral(t, dir, "modified", pki, tt.modifyTCBInfo, tt.modifyQEIdentity))
+			_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respond(pki, 0, nil))
+			spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, tt.expectMessage)
+		})
+	}
+
+	t.Run("TCB info not signed by Intel", func(t *testing.T) {
+		attestor := loadPlugin(t, `tdx_roots_path = "`+pki.rootsPath+`"`+writeTDXCollateral(t, dir, "untrusted", untrustedPKI, nil, nil))
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respond(pki, 0, nil))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "unable to verify TCB signing certificate")
+	})
+
+	t.Run("tampered TCB info", func(t *testing.T) {
+		writeTDXCollateral(t, dir, "tampered", pki, nil, nil)
+		tcbInfoPath := filepath.Join(dir, "tampered-tcb-info.json")
+		tcbInfo, err := os.ReadFile(tcbInfoPath)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(tcbInfoPath, bytes.Replace(tcbInfo, []byte(`"OutOfDate"`), []byte(`"UpToDate"`), 1), 0600))
+
+		attestor := loadPlugin(t, `tdx_roots_path = "`+pki.rootsPath+`"`+tdxCollateralConfig(dir, "tampered"))
+		_, err = attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respond(pki, 0, nil))
+		spiretest.RequireGRPCStatusContains(t, err, codes.PermissionDenied, "TCB info signature verification failed")
+	})
+
+	t.Run("insecure without collateral", func(t *testing.T) {
+		attestor := loadPlugin(t, `
+			tdx_roots_path = "`+pki.rootsPath+`"
+			insecure_skip_tcb_checks = true
+		`)
+		result, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeTDX), respondWith(func(tdReport, qeReport []byte) {
+			qeReport[tdxQEMRSignerOffset] ^= 0xff
+		}))
+		require.NoError(t, err)
+		require.Equal(t, "spiffe://example.org/spire/agent/confidential_vm/tdx/"+hex.EncodeToString(id[:]), result.AgentID)
+	})
+}
+
+func TestAttestFailures(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	pki := newTestPKI(t, dir, "ark", elliptic.P384(), nil)
+
+	t.Run("not configured", func(t *testing.T) {
+		attestor := new(nodeattestor.V1)
+		plugintest.Load(t, BuiltIn(), attestor)
+		_, err := attestor.Attest(context.Background(), []byte("payload"), expectNoChallenge)
+		spiretest.RequireGRPCStatus(t, err, codes.FailedPrecondition, "nodeattestor(confidential_vm): not configured")
+	})
+
+	attestor := loadPlugin(t, `
+		sev_snp_roots_path = "`+pki.rootsPath+`"
+		insecure_skip_tcb_checks = true
+	`)
+
+	t.Run("malformed payload", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), []byte("payload"), expectNoChallenge)
+		spiretest.RequireGRPCStatusContains(t, err, codes.InvalidArgument, "nodeattestor(confidential_vm): failed to unmarshal data")
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, "sgx"), expectNoChallenge)
+		spiretest.RequireGRPCStatus(t, err, codes.InvalidArgument, `nodeattestor(confidential_vm): unsupported confidential VM type "sgx"`)
+	})
+
+	t.Run("malformed challenge response", func(t *testing.T) {
+		_, err := attestor.Attest(context.Background(), makePayload(t, confidentialvm.TypeSEVSNP), func(ctx context.Context, challenge []byte) ([]byte, error) {
+			return []byte("response"), nil
+		})
+		spiretest.RequireGRPCStatusContains(t, err, codes.InvalidArgument, "nodeattestor(confidential_vm): unable to unmarshal challenge response")
+	})
+}
+
+func TestConfigure(t *testing.T) {
+	dir := spiretest.TempDir(t)
+	pki := newTestPKI(t, dir, "ark", elliptic.P384(), nil)
+	crlPath := writeCRL(t, dir, "ark", pki, time.Now().Add(time.Hour))
+	collateral := writeTDXCollateral(t, dir, "intel", pki, nil, nil)
+
+	for _, tt := range []struct {
+		name          string
+		config        string
+		expectCode    codes.Code
+		expectMessage string
+	}{
+		{
+			name: "SEV-SNP and TDX",
+			config: `
+				sev_snp_roots_path = "` + pki.rootsPath + `"
+				sev_snp_crl_path = "` + crlPath + `"
+				tdx_roots_path = "` + pki.rootsPath + `"
+			` + collateral,
+		},
+		{
+			name: "SEV-SNP and TDX without collateral",
+			config: `
+				sev_snp_roots_path = "` + pki.rootsPath + `"
+				tdx_roots_path = "` + pki.rootsPath + `"
+				insecure_skip_tcb_checks = true
+			`,
+		},
+		{
+			name:          "SEV-SNP without CRL",
+			config:        `sev_snp_roots_path = "` + pki.rootsPath + `"`,
+			expectCode:    codes.InvalidArgument,
+			expectMessage: "sev_snp_crl_path is required to attest SEV-SNP guests unless insecure_skip_tcb_checks is set",
+		},
+		{
+			name:          "TDX without collateral",
+			config:        `tdx_roots_path = "` + pki.rootsPath + `"`,
+			expectCode:    codes.InvalidArgument,
+			expectMessage: "tdx_tcb_info_path, tdx_qe_identity_path and tdx_tcb_signing_chain_path are required to attest TDX guests unless insecure_skip_tcb_checks is set",
+		},
+		{
+			name: "partial TDX collateral",
+			config: `
+				tdx_roots_path = "` + pki.rootsPath + `"
+				tdx_tcb_info_path = "` + filepath.Join(dir, "intel-tcb-info.json") + `"
+			`,
+			expectCode:    codes.InvalidArgument,
+			expectMessage: "tdx_tcb_info_path, tdx_qe_identity_path and tdx_tcb_signing_chain_path must be configured together",
+		},
+		{
+			name: "missing TDX TCB signing chain",
+			config: `
+				tdx_roots_path = "` + pki.rootsPath + `"
+				tdx_tcb_info_path = "` + filepath.Join(dir, "intel-tcb-info.json") + `"
+				tdx_qe_identity_path = "` + filepath.Join(dir, "intel-qe-identity.json") + `"
+				tdx_tcb_signing_chain_path = "` + filepath.Join(dir, "missing.pem") + `"
+			`,
+			expectCode:    codes.InvalidArgument,
+			expectMessage: "unable to load TDX TCB signing chain",
+		},
+		{
+			name:          "malformed",
+			config:        "{",
+			expectCode:    codes.InvalidArgument,
+			expectMessage: "unable to decode configuration",
+		},
+		{
+			name:          "no roots",
+			expectCode:    codes.InvalidArgument,
+			expectMessage: "sev_snp_roots_path or tdx_roots_path must be configured",
+		},
+		{
+			name:          "missing roots",
+			config:        `tdx_roots_path = "` + filepath.Join(dir, "missing.pem") + `"`,
+			expectCode:    codes.InvalidArgument,
+			expectMessage: "unable to load tdx roots",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			plugintest.Load(t, BuiltIn(), nil,
+				plugintest.CaptureConfigureError(&err),
+				plugintest.CoreConfig(catalog.CoreConfig{
+					TrustDomain: spiffeid.RequireTrustDomainFromString("example.org"),
+				}),
+				plugintest.Configure(tt.config),
+			)
+			if tt.expectCode == codes.OK {
+				require.NoError(t, err)
+				return
+			}
+			spiretest.RequireGRPCStatusContains(t, err, tt.expectCode, tt.expectMessage)
+		})
+	}
+}
+
+func loadPlugin(t *testing.T, config string) nodeattestor.NodeAttestor {
+	v1 := new(nodeattestor.V1)
+	plugintest.Load(t, BuiltIn(), v1,
+		plugintest.CoreConfig(catalog.CoreConfig{
+			TrustDomain: spiffeid.RequireTrustDomainFromString("example.org"),
+		}),
+		plugintest.Configure(config),
+	)
+	return v1
+}
+
+func expectNoChallenge(context.Context, []byte) ([]byte, error) {
+	return nil, errors.New("challenge is not expected")
+}
+
+// newTestPKI creates a root and an intermediate CA, like the ARK and the ASK
+// of AMD or the root and platform CAs of Intel, and a leaf key certified by
+// them with the given extensions, like a VCEK or a PCK. The root is written
+// to the directory.
+func newTestPKI(t *testing.T, dir, name string, curve elliptic.Curve, leafExtensions []pkix.Extension) *testPKI {
+	rootKey := generateKey(t, elliptic.P384())
+	root := createCertificate(t, name+"-root", true, rootKey, nil, nil, nil)
+	intermediateKey := generateKey(t, elliptic.P384())
+	intermediate := createCertificate(t, name+"-intermediate", true, intermediateKey, root, rootKey, nil)
+	leafKey := generateKey(t, curve)
+	leaf := createCertificate(t, name+"-leaf", false, leafKey, intermediate, intermediateKey, leafExtensions)
+
+	rootsPath := filepath.Join(dir, name+".pem")
+	require.NoError(t, os.WriteFile(rootsPath, pemutil.EncodeCertificate(root), 0600))
+	return &testPKI{
+		rootsPath: rootsPath,
+		root:      root,
+		rootKey:   rootKey,
+		chain:     []*x509.Certificate{leaf, intermediate},
+		key:       leafKey,
+	}
+}
+
+// vcekCertExtensions returns the extensions of a VCEK certified for snpTCB
+// and snpChipID
+func vcekCertExtensions(t *testing.T) []pkix.Extension {
+	var exts []pkix.Extension
+	for _, component := range snpTCBComponents {
+		exts = append(exts, pkix.Extension{Id: component.oid, Value: marshalASN1(t, int(snpTCB[component.offset]))})
+	}
+	return append(exts, pkix.Extension{Id: oidVCEKHardwareID, Value: snpChipID})
+}
+
+// pckCertExtensions returns the SGX extensions of a PCK of a platform at
+// tdxTCBSVN
+func pckCertExtensions(t *testing.T) []pkix.Extension {
+	var tcb []sgxExtension
+	for i := 1; i <= tdxTCBComponents; i++ {
+		tcb = append(tcb, sgxExtension{
+			ID:    append(append(asn1.ObjectIdentifier{}, oidSGXTCB...), i),
+			Value: asn1.RawValue{FullBytes: marshalASN1(t, tdxTCBSVN)},
+		})
+	}
+	tcb = append(tcb, sgxExtension{ID: oidSGXPCESVN, Value: asn1.RawValue{FullBytes: marshalASN1(t, tdxPCESVN)}})
+
+	sgx := []sgxExtension{
+		{ID: oidSGXPPID, Value: asn1.RawValue{FullBytes: marshalASN1(t, pckPPID)}},
+		{ID: oidSGXTCB, Value: asn1.RawValue{FullBytes: marshalASN1(t, tcb)}},
+		{ID: oidSGXFMSPC, Value: asn1.RawValue{FullBytes: marshalASN1(t, pckFMSPC)}},
+	}
+	return []pkix.Extension{{Id: oidSGXExtensions, Value: marshalASN1(t, sgx)}}
+}
+
+func marshalASN1(t *testing.T, v interface{}) []byte {
+	b, err := asn1.Marshal(v)
+	require.NoError(t, err)
+	return b
+}
+
+// writeCRL writes a CRL of the root of the PKI revoking the given
+// certificates to the directory
+func writeCRL(t *testing.T, dir, name string, pki *testPKI, nextUpdate time.Time, revoked ...*x509.Certificate) string {
+	var revokedCerts []pkix.RevokedCertificate
+	for _, cert := range revoked {
+		revokedCerts = append(revokedCerts, pkix.RevokedCertificate{
+			SerialNumber:   cert.SerialNumber,
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	crl, err := pki.root.CreateCRL(rand.Reader, pki.rootKey, revokedCerts, time.Now().Add(-time.Hour), nextUpdate)
+	require.NoError(t, err)
+
+	crlPath := filepath.Join(dir, name+".crl")
+	require.NoError(t, os.WriteFile(crlPath, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl}), 0600))
+	return crlPath
+}
+
+// writeTDXCollateral writes the TCB info, the QE identity and the chain of
+// the TCB signing certificate, issued by the root of the PKI, of the test
+// platforms to the directory, and returns their configuration. The current
+// TCB of the test platforms is UpToDate and the previous one OutOfDate.
+func writeTDXCollateral(t *testing.T, dir, name string, pki *testPKI, modifyTCBInfo, modifyQEIdentity func(map[string]interface{})) string {
+	signingKey := generateKey(t, elliptic.P256())
+	signingCert := createCertificate(t, name+"-tcb-signing", false, signingKey, pki.root, pki.rootKey, nil)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+"-tcb-signing.pem"), pemutil.EncodeCertificate(signingCert), 0600))
+
+	tcbInfo := map[string]interface{}{
+		"id":         tdxTCBInfoID,
+		"version":    3,
+		"nextUpdate": time.Now().Add(time.Hour),
+		"fmspc":      hex.EncodeToString(pckFMSPC),
+		"tdxModule": map[string]interface{}{
+			"mrsigner":       hex.EncodeToString(tdxModuleSigner),
+			"attributes":     "0000000000000000",
+			"attributesMask": "ffffffffffffffff",
+		},
+		"tcbLevels": []interface{}{
+			tdxTCBLevel(tdxTCBSVN, tdxPCESVN, "UpToDate"),
+			tdxTCBLevel(tdxTCBSVN-1, tdxPCESVN, "OutOfDate"),
+		},
+	}
+	if modifyTCBInfo != nil {
+		modifyTCBInfo(tcbInfo)
+	}
+	writeSignedCollateral(t, filepath.Join(dir, name+"-tcb-info.json"), "tcbInfo", signingKey, tcbInfo)
+
+	qeIdentity := map[string]interface{}{
+		"id":             tdxQEIdentityID,
+		"version":        2,
+		"nextUpdate":     time.Now().Add(time.Hour),
+		"miscselect":     "00000000",
+		"miscselectMask": "ffffffff",
+		"attributes":     hex.EncodeToString(tdxQEAttributes),
+		"attributesMask": "fbffffffffffffff0000000000000000",
+		"mrsigner":       hex.EncodeToString(tdxQESigner),
+		"isvprodid":      tdxQEProdID,
+		"tcbLevels": []interface{}{
+			map[string]interface{}{"tcb": map[string]interface{}{"isvsvn": tdxQESVN}, "tcbStatus": "UpToDate"},
+			map[string]interface{}{"tcb": map[string]interface{}{"isvsvn": tdxQESVN - 1}, "tcbStatus": "OutOfDate"},
+		},
+	}
+	if modifyQEIdentity != nil {
+		modifyQEIdentity(qeIdentity)
+	}
+	writeSignedCollateral(t, filepath.Join(dir, name+"-qe-identity.json"), "enclaveIdentity", signingKey, qeIdentity)
+
+	return tdxCollateralConfig(dir, name)
+}
+
+func tdxCollateralConfig(dir, name string) string {
+	return `
+		tdx_tcb_info_path = "` + filepath.Join(dir, name+"-tcb-info.json") + `"
+		tdx_qe_identity_path = "` + filepath.Join(dir, name+"-qe-identity.json") + `"
+		tdx_tcb_signing_chain_path = "` + filepath.Join(dir, name+"-tcb-signing.pem") + `"
+	`
+}
+
+// tdxTCBLevel returns a TCB level of the TCB info. The second TDX TCB
+// component is the version of the TDX module, which is 0 on the test
+// platforms.
+func tdxTCBLevel(svn, pceSVN int, tcbStatus string) map[string]interface{} {
+	var sgxComponents, tdxComponents []interface{}
+	for i := 0; i < tdxTCBComponents; i++ {
+		sgxComponents = append(sgxComponents, map[string]interface{}{"svn": svn})
+		if i == 1 {
+			tdxComponents = append(tdxComponents, map[string]interface{}{"svn": 0})
+			continue
+		}
+		tdxComponents = append(tdxComponents, map[string]interface{}{"svn": svn})
+	}
+	return map[string]interface{}{
+		"tcb": map[string]interface{}{
+			"sgxtcbcomponents": sgxComponents,
+			"pcesvn":           pceSVN,
+			"tdxtcbcomponents": tdxComponents,
+		},
+		"tcbStatus": tcbStatus,
+	}
+}
+
+func writeSignedCollateral(t *testing.T, path, field string, signingKey *ecdsa.PrivateKey, collateral map[string]interface{}) {
+	signed, err := json.Marshal(collateral)
+	require.NoError(t, err)
+	doc, err := json.Marshal(map[string]interface{}{
+		field:       json.RawMessage(signed),
+		"signature": hex.EncodeToString(signP256(t, signingKey, signed)),
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, doc, 0600))
+}
+
+func generateKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+func createCertificate(t *testing.T, name string, isCA bool, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey crypto.Signer, extensions []pkix.Extension) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		ExtraExtensions:       extensions,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(certDER)
+	require.NoError(t, err)
+	return cert
+}
+
+func makePayload(t *testing.T, vmType string) []byte {
+	payload, err := json.Marshal(confidentialvm.AttestationData{Type: vmType})
+	require.NoError(t, err)
+	return payload
+}
+
+func challengeNonce(t *testing.T, challenge []byte) []byte {
+	c := new(confidentialvm.Challenge)
+	require.NoError(t, json.Unmarshal(challenge, c))
+	require.Len(t, c.Nonce, confidentialvm.NonceSize)
+	return c.Nonce
+}
+
+func makeResponse(t *testing.T, evidence []byte, chain []*x509.Certificate) []byte {
+	response := confidentialvm.Response{Evidence: evidence}
+	for _, cert := range chain {
+		response.Certificates = append(response.Certificates, cert.Raw)
+	}
+	b, err := json.Marshal(response)
+	require.NoError(t, err)
+	return b
+}
+
+// makeSEVSNPReport makes a report of a guest of a platform at snpTCB, which
+// can be modified before it is signed
+func makeSEVSNPReport(t *testing.T, vcekKey *ecdsa.PrivateKey, reportData []byte, policy uint64, modify func([]byte)) []byte {
+	report := make([]byte, snpReportSize)
+	binary.LittleEndian.PutUint32(report[0:], 2)
+	binary.LittleEndian.PutUint64(report[snpPolicyOffset:], policy)
+	binary.LittleEndian.PutUint32(report[snpSigAlgoOffset:], snpSigAlgoECDSAP384SHA384)
+	copy(report[snpReportDataOffset:], reportData)
+	copy(report[snpMeasurementOffset:], measurement)
+	copy(report[snpHostDataOffset:], hostData)
+	copy(report[snpReportIDOffset:], snpReportID)
+	copy(report[snpReportedTCBOffset:], snpTCB)
+	copy(report[snpChipIDOffset:], snpChipID)
+	if modify != nil {
+		modify(report)
+	}
+
+	digest := sha512.Sum384(report[:snpSignatureOffset])
+	r, s, err := ecdsa.Sign(rand.Reader, vcekKey, digest[:])
+	require.NoError(t, err)
+	putLittleEndianInt(report[snpSignatureOffset:snpSignatureOffset+snpSignatureComponentSize], r)
+	putLittleEndianInt(report[snpSignatureOffset+snpSignatureComponentSize:snpSignatureOffset+2*snpSignatureComponentSize], s)
+	return report
+}
+
+func putLittleEndianInt(b []byte, x *big.Int) {
+	be := x.FillBytes(make([]byte, len(b)))
+	for i := range be {
+		b[len(b)-1-i] = be[i]
+	}
+}
+
+// makeTDXQuote makes a quote of a trust domain of a platform at tdxTCBSVN,
+// whose TD and QE reports can be modified before they are signed
+func makeTDXQuote(t *testing.T, pki *testPKI, reportData []byte, tdAttributes uint64, modify func(tdReport, qeReport []byte)) []byte {
+	signed := make([]byte, tdxHeaderSize+tdxTDReportSize)
+	binary.LittleEndian.PutUint16(signed[0:], tdxQuoteVersion)
+	binary.LittleEndian.PutUint16(signed[2:], tdxAttestationKeyType)
+	binary.LittleEndian.PutUint32(signed[4:], tdxTEEType)
+	tdReport := signed[tdxHeaderSize:]
+	for i := 0; i < tdxTCBComponents; i++ {
+		// The second component is the version of the TDX module
+		if i != 1 {
+			tdReport[tdxTEETCBSVNOffset+i] = byte(tdxTCBSVN)
+		}
+	}
+	copy(tdReport[tdxMRSignerSEAMOffset:], tdxModuleSigner)
+	binary.LittleEndian.PutUint64(tdReport[tdxTDAttributesOffset:], tdAttributes)
+	copy(tdReport[tdxMRTDOffset:], measurement)
+	copy(tdReport[tdxMRConfigIDOffset:], mrConfigID)
+	copy(tdReport[tdxReportDataOffset:], reportData)
+
+	// The QE report binds the attestation key and is signed by the PCK
+	attestationKey := generateKey(t, elliptic.P256())
+	attestationPublicKey := append(attestationKey.X.FillBytes(make([]byte, 32)), attestationKey.Y.FillBytes(make([]byte, 32))...)
+	authData := []byte("auth data")
+	qeReport := make([]byte, tdxQEReportSize)
+	qeReportData := sha256.Sum256(append(append([]byte{}, attestationPublicKey...), authData...))
+	copy(qeReport[tdxQEReportDataOffset:], qeReportData[:])
+	copy(qeReport[tdxQEAttributesOffset:], tdxQEAttributes)
+	copy(qeReport[tdxQEMRSignerOffset:], tdxQESigner)
+	binary.LittleEndian.PutUint16(qeReport[tdxQEISVProdIDOffset:], tdxQEProdID)
+	binary.LittleEndian.PutUint16(qeReport[tdxQEISVSVNOffset:], tdxQESVN)
+	if modify != nil {
+		modify(tdReport, qeReport)
+	}
+
+	pckChain := new(bytes.Buffer)
+	for _, cert := range pki.chain {
+		pckChain.Write(pemutil.EncodeCertificate(cert))
+	}
+
+	certData := new(bytes.Buffer)
+	certData.Write(qeReport)
+	certData.Write(signP256(t, pki.key, qeReport))
+	writeLittleEndian(t, certData, uint16(len(authData)))
+	certData.Write(authData)
+	writeLittleEndian(t, certData, uint16(tdxCertDataPCKChain))
+	writeLittleEndian(t, certData, uint32(pckChain.Len()))
+	certData.Write(pckChain.Bytes())
+
+	sigData := new(bytes.Buffer)
+	sigData.Write(signP256(t, attestationKey, signed))
+	sigData.Write(attestationPublicKey)
+	writeLittleEndian(t, sigData, uint16(tdxCertDataQEReport))
+	writeLittleEndian(t, sigData, uint32(certData.Len()))
+	sigData.Write(certData.Bytes())
+
+	quote := bytes.NewBuffer(signed)
+	writeLittleEndian(t, quote, uint32(sigData.Len()))
+	quote.Write(sigData.Bytes())
+	return quote.Bytes()
+}
+
+func signP256(t *testing.T, key *ecdsa.PrivateKey, data []byte) []byte {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+}
+
+func writeLittleEndian(t *testing.T, buf *bytes.Buffer, v interface{}) {
+	require.NoError(t, binary.Write(buf, binary.LittleEndian, v))
+}
@@ -0,0 +1,260 @@
+package confidentialvm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// Layout of the SEV-SNP attestation report, as defined by the SEV Secure
+// Nested Paging Firmware ABI Specification.
+const (
+	snpReportSize        = 0x4a0
+	snpPolicyOffset      = 0x08
+	snpSigAlgoOffset     = 0x34
+	snpReportDataOffset  = 0x50
+	snpMeasurementOffset = 0x90
+	snpHostDataOffset    = 0xc0
+	snpReportIDOffset    = 0x140
+	snpReportedTCBOffset = 0x180
+	snpChipIDOffset      = 0x1a0
+	snpSignatureOffset   = 0x2a0
+
+	snpReportDataSize  = 64
+	snpMeasurementSize = 48
+	snpHostDataSize    = 32
+	snpReportIDSize    = 32
+	snpChipIDSize      = 64
+
+	// Offsets of the security patch levels (SPL) of the firmware components
+	// within a TCB version
+	snpTCBBootloaderOffset = 0
+	snpTCBTEEOffset        = 1
+	snpTCBSNPOffset        = 6
+	snpTCBMicrocodeOffset  = 7
+
+	// The R and S components of the signature are little endian and zero
+	// extended to 72 bytes
+	snpSignatureComponentSize = 72
+
+	// snpSigAlgoECDSAP384SHA384 is the only signature algorithm defined
+	snpSigAlgoECDSAP384SHA384 = 1
+
+	// snpPolicyDebug is the bit of the guest policy allowing the hypervisor
+	// to debug the guest, i.e. to read its memory
+	snpPolicyDebug = 1 << 19
+)
+
+var (
+	// Extensions of the VCEK certificates holding the security patch levels
+	// of the TCB the VCEK was derived for, and the ID of the chip
+	oidVCEKBootloaderSPL = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 1}
+	oidVCEKTEESPL        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 2}
+	oidVCEKSNPSPL        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 3}
+	oidVCEKMicrocodeSPL  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 8}
+	oidVCEKHardwareID    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 4}
+)
+
+// SEVSNPTCB is the minimum security patch level of each firmware component
+// of the TCB of SEV-SNP platforms
+type SEVSNPTCB struct {
+	Bootloader int `hcl:"bootloader"`
+	TEE        int `hcl:"tee"`
+	SNP        int `hcl:"snp"`
+	Microcode  int `hcl:"microcode"`
+}
+
+type snpTCBComponent struct {
+	name   string
+	offset int
+	oid    asn1.ObjectIdentifier
+	min    func(*SEVSNPTCB) int
+}
+
+var snpTCBComponents = []snpTCBComponent{
+	{name: "bootloader", offset: snpTCBBootloaderOffset, oid: oidVCEKBootloaderSPL, min: func(t *SEVSNPTCB) int { return t.Bootloader }},
+	{name: "TEE", offset: snpTCBTEEOffset, oid: oidVCEKTEESPL, min: func(t *SEVSNPTCB) int { return t.TEE }},
+	{name: "SNP", offset: snpTCBSNPOffset, oid: oidVCEKSNPSPL, min: func(t *SEVSNPTCB) int { return t.SNP }},
+	{name: "microcode", offset: snpTCBMicrocodeOffset, oid: oidVCEKMicrocodeSPL, min: func(t *SEVSNPTCB) int { return t.Microcode }},
+}
+
+// sevSNPConfig configures the checks of the TCB and revocation status of
+// SEV-SNP platforms
+type sevSNPConfig struct {
+	// crlPath is the path to the CRL of the AMD root key, revoking the AMD
+	// SEV keys (ASK). It is read on each attestation, so it can be
+	// refreshed without reconfiguring the plugin.
+	crlPath string
+	// minTCB, if set, is the minimum TCB of the platforms
+	minTCB *SEVSNPTCB
+}
+
+// verifySEVSNPReport verifies that the attestation report is signed by a
+// VCEK (or VLEK) chaining up to one of the AMD roots and issued for the TCB
+// and chip of the report, and extracts the evidence of the guest from it.
+func verifySEVSNPReport(report []byte, chain []*x509.Certificate, roots []*x509.Certificate, config sevSNPConfig, now time.Time) (*evidence, error) {
+	if len(report) != snpReportSize {
+		return nil, fmt.Errorf("invalid report size %d; expected %d", len(report), snpReportSize)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("missing VCEK certificate")
+	}
+	if err := verifyCertChain(chain[0], chain[1:], roots, now); err != nil {
+		return nil, fmt.Errorf("unable to verify VCEK certificate: %w", err)
+	}
+	if config.crlPath != "" {
+		if err := checkSEVSNPRevocation(config.crlPath, chain, roots, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if sigAlgo := binary.LittleEndian.Uint32(report[snpSigAlgoOffset:]); sigAlgo != snpSigAlgoECDSAP384SHA384 {
+		return nil, fmt.Errorf("unsupported signature algorithm %d", sigAlgo)
+	}
+	publicKey, ok := chain[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok || publicKey.Curve != elliptic.P384() {
+		return nil, errors.New("VCEK is not an ECDSA P-384 key")
+	}
+	signature := report[snpSignatureOffset:]
+	r := littleEndianInt(signature[:snpSignatureComponentSize])
+	s := littleEndianInt(signature[snpSignatureComponentSize : 2*snpSignatureComponentSize])
+	digest := sha512.Sum384(report[:snpSignatureOffset])
+	if !ecdsa.Verify(publicKey, digest[:], r, s) {
+		return nil, errors.New("report signature verification failed")
+	}
+
+	// The VCEK is derived from the TCB of the platform, and certified for
+	// that TCB and chip only
+	if err := checkSEVSNPTCB(report, chain[0], config.minTCB); err != nil {
+		return nil, err
+	}
+
+	policy := binary.LittleEndian.Uint64(report[snpPolicyOffset:])
+	return &evidence{
+		id:           report[snpReportIDOffset : snpReportIDOffset+snpReportIDSize],
+		measurement:  report[snpMeasurementOffset : snpMeasurementOffset+snpMeasurementSize],
+		policyDigest: report[snpHostDataOffset : snpHostDataOffset+snpHostDataSize],
+		reportData:   report[snpReportDataOffset : snpReportDataOffset+snpReportDataSize],
+		debug:        policy&snpPolicyDebug != 0,
+	}, nil
+}
+
+// checkSEVSNPTCB checks that the reported TCB of the report is the TCB the
+// VCEK was issued for, that it is at least the minimum TCB, if any, and that
+// the report comes from the chip the VCEK was issued for. VLEKs are not
+// issued for a chip, so the chip is only checked with VCEKs.
+func checkSEVSNPTCB(report []byte, vcek *x509.Certificate, minTCB *SEVSNPTCB) error {
+	reportedTCB := report[snpReportedTCBOffset : snpReportedTCBOffset+8]
+	for _, component := range snpTCBComponents {
+		reported := int(reportedTCB[component.offset])
+		certified, err := vcekSPL(vcek, component.oid)
+		if err != nil {
+			return fmt.Errorf("invalid VCEK %s SPL: %w", component.name, err)
+		}
+		if reported != certified {
+			return fmt.Errorf("reported %s SPL %d does not match the VCEK %s SPL %d", component.name, reported, component.name, certified)
+		}
+		if minTCB != nil && reported < component.min(minTCB) {
+			return fmt.Errorf("reported %s SPL %d is lower than the minimum of %d", component.name, reported, component.min(minTCB))
+		}
+	}
+
+	hwID, ok := findExtension(vcek, oidVCEKHardwareID)
+	if !ok {
+		return nil
+	}
+	// The hardware ID is the raw chip ID, although some certificates wrap
+	// it in an octet string
+	if len(hwID) != snpChipIDSize {
+		var octets []byte
+		if _, err := asn1.Unmarshal(hwID, &octets); err == nil {
+			hwID = octets
+		}
+	}
+	if !bytes.Equal(hwID, report[snpChipIDOffset:snpChipIDOffset+snpChipIDSize]) {
+		return errors.New("report chip ID does not match the VCEK hardware ID")
+	}
+	return nil
+}
+
+func vcekSPL(vcek *x509.Certificate, oid asn1.ObjectIdentifier) (int, error) {
+	value, ok := findExtension(vcek, oid)
+	if !ok {
+		return 0, errors.New("missing extension")
+	}
+	var spl int
+	if rest, err := asn1.Unmarshal(value, &spl); err != nil || len(rest) != 0 || spl < 0 || spl > 0xff {
+		return 0, fmt.Errorf("malformed extension %x", value)
+	}
+	return spl, nil
+}
+
+func findExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) ([]byte, bool) {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return ext.Value, true
+		}
+	}
+	return nil, false
+}
+
+// checkSEVSNPRevocation checks that the certificates of the chain issued by
+// the AMD root key signing the CRL, i.e. the ASK, are not revoked, and that
+// the CRL is current.
+func checkSEVSNPRevocation(crlPath string, chain, roots []*x509.Certificate, now time.Time) error {
+	data, err := os.ReadFile(crlPath)
+	if err != nil {
+		return fmt.Errorf("unable to read AMD CRL: %w", err)
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	crl, err := x509.ParseCRL(data)
+	if err != nil {
+		return fmt.Errorf("unable to parse AMD CRL: %w", err)
+	}
+	if crl.HasExpired(now) {
+		return errors.New("AMD CRL has expired")
+	}
+
+	var issuer *x509.Certificate
+	for _, root := range roots {
+		if root.CheckCRLSignature(crl) == nil {
+			issuer = root
+			break
+		}
+	}
+	if issuer == nil {
+		return errors.New("AMD CRL is not signed by a trusted root")
+	}
+
+	for _, cert := range chain {
+		if cert.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+		for _, revoked := range crl.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("certificate %q is revoked", cert.Subject)
+			}
+		}
+	}
+	return nil
+}
+
+func littleEndianInt(b []byte) *big.Int {
+	be := make([]byte, len(b))
+	for i := range b {
+		be[len(b)-1-i] = b[i]
+	}
+	return new(big.Int).SetBytes(be)
+}
@@ -0,0 +1,228 @@
+package confidentialvm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/spiffe/spire/pkg/common/pemutil"
+)
+
+// Layout of the version 4 TDX quotes, as defined by the Intel TDX DCAP Quote
+// Generation Library and Quote Verification Library specification.
+const (
+	tdxHeaderSize    = 48
+	tdxTDReportSize  = 584
+	tdxQEReportSize  = 384
+	tdxSignatureSize = 64
+	tdxPublicKeySize = 64
+
+	tdxQuoteVersion       = 4
+	tdxAttestationKeyType = 2 // ECDSA P-256
+	tdxTEEType            = 0x81
+
+	// Offsets within the TD report
+	tdxTEETCBSVNOffset      = 0
+	tdxMRSignerSEAMOffset   = 64
+	tdxSEAMAttributesOffset = 112
+	tdxTDAttributesOffset   = 120
+	tdxMRTDOffset           = 136
+	tdxMRConfigIDOffset     = 184
+	tdxReportDataOffset     = 520
+	tdxSEAMAttributesSize   = 8
+	tdxMeasurementSize      = 48
+	tdxReportDataSize       = 64
+
+	// Offsets within the QE report
+	tdxQEMiscSelectOffset = 16
+	tdxQEAttributesOffset = 48
+	tdxQEMRSignerOffset   = 128
+	tdxQEISVProdIDOffset  = 256
+	tdxQEISVSVNOffset     = 258
+	tdxQEReportDataOffset = 320
+	tdxQEMiscSelectSize   = 4
+	tdxQEAttributesSize   = 16
+	tdxQEMRSignerSize     = 32
+
+	// tdxTDAttributesDebug is the attribute of debuggable trust domains,
+	// whose memory the host can read
+	tdxTDAttributesDebug = 1
+
+	// Types of certification data
+	tdxCertDataPCKChain = 5
+	tdxCertDataQEReport = 6
+
+	// Sizes of the type and size fields of variable length data
+	tdxCertDataTypeSize = 2
+	tdxCertDataSizeSize = 4
+	tdxAuthDataSizeSize = 2
+	tdxSigDataSizeSize  = 4
+)
+
+// verifyTDXQuote verifies that the quote is signed by an attestation key
+// certified by a Quoting Enclave whose PCK certificate chains up to one of
+// the Intel roots, checks the TCB of the platform and the identity of the
+// Quoting Enclave if the collateral is configured, and extracts the evidence
+// of the trust domain from it.
+func verifyTDXQuote(quote []byte, roots []*x509.Certificate, config tdxConfig, now time.Time) (*evidence, error) {
+	signedSize := tdxHeaderSize + tdxTDReportSize
+	if len(quote) < signedSize+tdxSigDataSizeSize {
+		return nil, fmt.Errorf("quote is too short: %d bytes", len(quote))
+	}
+	if version := binary.LittleEndian.Uint16(quote[0:]); version != tdxQuoteVersion {
+		return nil, fmt.Errorf("unsupported quote version %d", version)
+	}
+	if keyType := binary.LittleEndian.Uint16(quote[2:]); keyType != tdxAttestationKeyType {
+		return nil, fmt.Errorf("unsupported attestation key type %d", keyType)
+	}
+	if teeType := binary.LittleEndian.Uint32(quote[4:]); teeType != tdxTEEType {
+		return nil, fmt.Errorf("unsupported TEE type %#x", teeType)
+	}
+
+	sigData, err := readSizedData(quote[signedSize:], tdxSigDataSizeSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature data: %w", err)
+	}
+	if len(sigData) < tdxSignatureSize+tdxPublicKeySize {
+		return nil, errors.New("invalid signature data: too short")
+	}
+	quoteSignature := sigData[:tdxSignatureSize]
+	attestationKey := sigData[tdxSignatureSize : tdxSignatureSize+tdxPublicKeySize]
+
+	certDataType, certData, err := readCertData(sigData[tdxSignatureSize+tdxPublicKeySize:])
+	if err != nil {
+		return nil, err
+	}
+	if certDataType != tdxCertDataQEReport {
+		return nil, fmt.Errorf("unsupported certification data type %d", certDataType)
+	}
+	if len(certData) < tdxQEReportSize+tdxSignatureSize {
+		return nil, errors.New("invalid QE report certification data: too short")
+	}
+	qeReport := certData[:tdxQEReportSize]
+	qeReportSignature := certData[tdxQEReportSize : tdxQEReportSize+tdxSignatureSize]
+	authData, err := readSizedData(certData[tdxQEReportSize+tdxSignatureSize:], tdxAuthDataSizeSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid QE authentication data: %w", err)
+	}
+	pckDataType, pckData, err := readCertData(certData[tdxQEReportSize+tdxSignatureSize+tdxAuthDataSizeSize+len(authData):])
+	if err != nil {
+		return nil, err
+	}
+	if pckDataType != tdxCertDataPCKChain {
+		return nil, fmt.Errorf("unsupported QE certification data type %d", pckDataType)
+	}
+
+	// The PCK certificate chain proves the QE report was signed by genuine
+	// Intel hardware
+	chain, err := pemutil.ParseCertificates(pckData)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse PCK certificate chain: %w", err)
+	}
+	if err := verifyCertChain(chain[0], chain[1:], roots, now); err != nil {
+		return nil, fmt.Errorf("unable to verify PCK certificate: %w", err)
+	}
+	pckKey, ok := chain[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok || pckKey.Curve != elliptic.P256() {
+		return nil, errors.New("PCK is not an ECDSA P-256 key")
+	}
+	if !verifyP256Signature(pckKey, qeReport, qeReportSignature) {
+		return nil, errors.New("QE report signature verification failed")
+	}
+	pck, err := parsePCKExtensions(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid PCK certificate: %w", err)
+	}
+
+	// The QE report binds the attestation key, which signs the quote
+	hash := sha256.New()
+	_, _ = hash.Write(attestationKey)
+	_, _ = hash.Write(authData)
+	if !bytes.Equal(hash.Sum(nil), qeReport[tdxQEReportDataOffset:tdxQEReportDataOffset+sha256.Size]) {
+		return nil, errors.New("attestation key is not bound to the QE report")
+	}
+	x := new(big.Int).SetBytes(attestationKey[:tdxPublicKeySize/2])
+	y := new(big.Int).SetBytes(attestationKey[tdxPublicKeySize/2:])
+	if !elliptic.P256().IsOnCurve(x, y) {
+		return nil, errors.New("invalid attestation key")
+	}
+	if !verifyP256Signature(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, quote[:signedSize], quoteSignature) {
+		return nil, errors.New("quote signature verification failed")
+	}
+
+	tdReport := quote[tdxHeaderSize:signedSize]
+	if config.enabled() {
+		if err := checkTDXCollateral(config, roots, pck, tdReport, qeReport, now); err != nil {
+			return nil, err
+		}
+	}
+
+	// TDX quotes do not identify the trust domain, so its ID is derived
+	// from its measurement and configuration, and from the platform it
+	// runs on
+	mrtd := tdReport[tdxMRTDOffset : tdxMRTDOffset+tdxMeasurementSize]
+	mrConfigID := tdReport[tdxMRConfigIDOffset : tdxMRConfigIDOffset+tdxMeasurementSize]
+	id := sha256.New()
+	_, _ = id.Write(mrtd)
+	_, _ = id.Write(mrConfigID)
+	_, _ = id.Write(pck.ppid)
+	_, _ = id.Write(pck.fmspc)
+
+	tdAttributes := binary.LittleEndian.Uint64(tdReport[tdxTDAttributesOffset:])
+	return &evidence{
+		id:           id.Sum(nil),
+		measurement:  mrtd,
+		policyDigest: mrConfigID,
+		reportData:   tdReport[tdxReportDataOffset : tdxReportDataOffset+tdxReportDataSize],
+		debug:        tdAttributes&tdxTDAttributesDebug != 0,
+	}, nil
+}
+
+// verifyP256Signature verifies a raw ECDSA P-256 signature, i.e. the big
+// endian R and S components, of the SHA-256 digest of the data
+func verifyP256Signature(publicKey *ecdsa.PublicKey, data, signature []byte) bool {
+	digest := sha256.Sum256(data)
+	r := new(big.Int).SetBytes(signature[:tdxSignatureSize/2])
+	s := new(big.Int).SetBytes(signature[tdxSignatureSize/2:])
+	return ecdsa.Verify(publicKey, digest[:], r, s)
+}
+
+// readCertData reads certification data, which is made of its type and of
+// data prefixed by its size
+func readCertData(b []byte) (uint16, []byte, error) {
+	if len(b) < tdxCertDataTypeSize {
+		return 0, nil, errors.New("invalid certification data: too short")
+	}
+	certDataType := binary.LittleEndian.Uint16(b)
+	data, err := readSizedData(b[tdxCertDataTypeSize:], tdxCertDataSizeSize)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid certification data: %w", err)
+	}
+	return certDataType, data, nil
+}
+
+// readSizedData reads data prefixed by its little endian size, which is
+// sizeSize bytes long
+func readSizedData(b []byte, sizeSize int) ([]byte, error) {
+	if len(b) < sizeSize {
+		return nil, errors.New("too short")
+	}
+	var size uint64
+	switch sizeSize {
+	case 2:
+		size = uint64(binary.LittleEndian.Uint16(b))
+	case 4:
+		size = uint64(binary.LittleEndian.Uint32(b))
+	}
+	if uint64(len(b)-sizeSize) < size {
+		return nil, fmt.Errorf("size %d exceeds the remaining %d bytes", size, len(b)-sizeSize)
+	}
+	return b[sizeSize : sizeSize+int(size)], nil
+}
@@ -0,0 +1,399 @@
+package confidentialvm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// tdxTCBStatusUpToDate is the status of TCB levels without known
+	// vulnerabilities, the only one allowed by default
+	tdxTCBStatusUpToDate = "UpToDate"
+
+	tdxTCBInfoID    = "TDX"
+	tdxQEIdentityID = "TD_QE"
+
+	tdxTCBComponents = 16
+)
+
+var (
+	// Extensions of the PCK certificates, as defined by the Intel SGX PCK
+	// Certificate and Certificate Revocation List Profile Specification
+	oidSGXExtensions = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 13, 1}
+	oidSGXPPID       = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 13, 1, 1}
+	oidSGXTCB        = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 13, 1, 2}
+	oidSGXPCESVN     = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 13, 1, 2, 17}
+	oidSGXFMSPC      = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 13, 1, 4}
+)
+
+// tdxConfig configures the checks of the TCB of TDX platforms and of the
+// identity of their Quoting Enclave against the collateral of Intel
+type tdxConfig struct {
+	// tcbInfoPath and qeIdentityPath are the paths to the TDX TCB info and
+	// the TD QE identity, as served by the Intel Provisioning Certification
+	// Service. They are read on each attestation, so they can be refreshed
+	// without reconfiguring the plugin.
+	tcbInfoPath    string
+	qeIdentityPath string
+	// signingChain is the chain of the TCB signing certificate, which signs
+	// the TCB info and the QE identity
+	signingChain []*x509.Certificate
+	// allowedStatuses are the TCB statuses allowed besides UpToDate
+	allowedStatuses map[string]bool
+}
+
+func (c tdxConfig) enabled() bool {
+	return c.tcbInfoPath != ""
+}
+
+func (c tdxConfig) statusAllowed(status string) bool {
+	return status == tdxTCBStatusUpToDate || c.allowedStatuses[status]
+}
+
+// pckExtensions are the SGX extensions of a PCK certificate
+type pckExtensions struct {
+	ppid   []byte
+	fmspc  []byte
+	cpuSVN [tdxTCBComponents]int
+	pceSVN int
+}
+
+type sgxExtension struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+func parsePCKExtensions(pck *x509.Certificate) (*pckExtensions, error) {
+	value, ok := findExtension(pck, oidSGXExtensions)
+	if !ok {
+		return nil, errors.New("missing SGX extensions")
+	}
+	var exts []sgxExtension
+	if _, err := asn1.Unmarshal(value, &exts); err != nil {
+		return nil, fmt.Errorf("malformed SGX extensions: %w", err)
+	}
+
+	result := new(pckExtensions)
+	var hasTCB bool
+	for _, ext := range exts {
+		var err error
+		switch {
+		case ext.ID.Equal(oidSGXPPID):
+			_, err = asn1.Unmarshal(ext.Value.FullBytes, &result.ppid)
+		case ext.ID.Equal(oidSGXFMSPC):
+			_, err = asn1.Unmarshal(ext.Value.FullBytes, &result.fmspc)
+		case ext.ID.Equal(oidSGXTCB):
+			hasTCB = true
+			err = parsePCKTCB(ext.Value.FullBytes, result)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed SGX extension %s: %w", ext.ID, err)
+		}
+	}
+	switch {
+	case len(result.ppid) == 0:
+		return nil, errors.New("missing PPID SGX extension")
+	case len(result.fmspc) == 0:
+		return nil, errors.New("missing FMSPC SGX extension")
+	case !hasTCB:
+		return nil, errors.New("missing TCB SGX extension")
+	}
+	return result, nil
+}
+
+func parsePCKTCB(value []byte, result *pckExtensions) error {
+	var exts []sgxExtension
+	if _, err := asn1.Unmarshal(value, &exts); err != nil {
+		return err
+	}
+	for _, ext := range exts {
+		// The CPU SVN components are 1.2.840.113741.1.13.1.2.1 to .16
+		isComponent := len(ext.ID) == len(oidSGXTCB)+1 && ext.ID[:len(oidSGXTCB)].Equal(oidSGXTCB)
+		switch {
+		case ext.ID.Equal(oidSGXPCESVN):
+			if _, err := asn1.Unmarshal(ext.Value.FullBytes, &result.pceSVN); err != nil {
+				return err
+			}
+		case isComponent && ext.ID[len(oidSGXTCB)] >= 1 && ext.ID[len(oidSGXTCB)] <= tdxTCBComponents:
+			if _, err := asn1.Unmarshal(ext.Value.FullBytes, &result.cpuSVN[ext.ID[len(oidSGXTCB)]-1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hexBytes are bytes encoded as a hex string in JSON
+type hexBytes []byte
+
+func (b *hexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// signedCollateral is a collateral document of Intel: the raw JSON of the
+// collateral, as signed, under the given field, and its signature
+type signedCollateral struct {
+	TCBInfo         json.RawMessage `json:"tcbInfo"`
+	EnclaveIdentity json.RawMessage `json:"enclaveIdentity"`
+	Signature       hexBytes        `json:"signature"`
+}
+
+type tdxTCBInfo struct {
+	ID         string              `json:"id"`
+	NextUpdate time.Time           `json:"nextUpdate"`
+	FMSPC      hexBytes            `json:"fmspc"`
+	TDXModule  tdxModuleIdentity   `json:"tdxModule"`
+	Modules    []tdxModuleIdentity `json:"tdxModuleIdentities"`
+	TCBLevels  []tdxTCBLevel       `json:"tcbLevels"`
+}
+
+type tdxModuleIdentity struct {
+	ID             string           `json:"id"`
+	MRSigner       hexBytes         `json:"mrsigner"`
+	Attributes     hexBytes         `json:"attributes"`
+	AttributesMask hexBytes         `json:"attributesMask"`
+	TCBLevels      []tdxISVTCBLevel `json:"tcbLevels"`
+}
+
+type tdxTCBLevel struct {
+	TCB struct {
+		SGXComponents []tdxTCBComponent `json:"sgxtcbcomponents"`
+		PCESVN        int               `json:"pcesvn"`
+		TDXComponents []tdxTCBComponent `json:"tdxtcbcomponents"`
+	} `json:"tcb"`
+	TCBStatus string `json:"tcbStatus"`
+}
+
+type tdxTCBComponent struct {
+	SVN int `json:"svn"`
+}
+
+type tdxQEIdentity struct {
+	ID             string           `json:"id"`
+	NextUpdate     time.Time        `json:"nextUpdate"`
+	MiscSelect     hexBytes         `json:"miscselect"`
+	MiscSelectMask hexBytes         `json:"miscselectMask"`
+	Attributes     hexBytes         `json:"attributes"`
+	AttributesMask hexBytes         `json:"attributesMask"`
+	MRSigner       hexBytes         `json:"mrsigner"`
+	ISVProdID      uint16           `json:"isvprodid"`
+	TCBLevels      []tdxISVTCBLevel `json:"tcbLevels"`
+}
+
+type tdxISVTCBLevel struct {
+	TCB struct {
+		ISVSVN int `json:"isvsvn"`
+	} `json:"tcb"`
+	TCBStatus string `json:"tcbStatus"`
+}
+
+// checkTDXCollateral checks the TCB of the platform, of the TDX module and
+// of the Quoting Enclave against the TCB info and QE identity of Intel.
+func checkTDXCollateral(config tdxConfig, roots []*x509.Certificate, pck *pckExtensions, tdReport, qeReport []byte, now time.Time) error {
+	if len(config.signingChain) == 0 {
+		return errors.New("missing TCB signing certificate")
+	}
+	if err := verifyCertChain(config.signingChain[0], config.signingChain[1:], roots, now); err != nil {
+		return fmt.Errorf("unable to verify TCB signing certificate: %w", err)
+	}
+	signingKey, ok := config.signingChain[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok || signingKey.Curve != elliptic.P256() {
+		return errors.New("TCB signing key is not an ECDSA P-256 key")
+	}
+
+	tcbInfo := new(tdxTCBInfo)
+	if err := loadCollateral(config.tcbInfoPath, "TCB info", signingKey, tcbInfo); err != nil {
+		return err
+	}
+	if err := checkTDXTCBInfo(config, tcbInfo, pck, tdReport, now); err != nil {
+		return err
+	}
+
+	qeIdentity := new(tdxQEIdentity)
+	if err := loadCollateral(config.qeIdentityPath, "QE identity", signingKey, qeIdentity); err != nil {
+		return err
+	}
+	return checkTDXQEIdentity(config, qeIdentity, qeReport, now)
+}
+
+// loadCollateral reads a collateral document and verifies its signature
+func loadCollateral(path, name string, signingKey *ecdsa.PublicKey, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", name, err)
+	}
+	doc := new(signedCollateral)
+	if err := json.Unmarshal(data, doc); err != nil {
+		return fmt.Errorf("unable to parse %s: %w", name, err)
+	}
+	signed := doc.TCBInfo
+	if signed == nil {
+		signed = doc.EnclaveIdentity
+	}
+	if signed == nil || len(doc.Signature) != tdxSignatureSize {
+		return fmt.Errorf("malformed %s", name)
+	}
+	if !verifyP256Signature(signingKey, signed, doc.Signature) {
+		return fmt.Errorf("%s signature verification failed", name)
+	}
+	if err := json.Unmarshal(signed, v); err != nil {
+		return fmt.Errorf("unable to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+func checkTDXTCBInfo(config tdxConfig, tcbInfo *tdxTCBInfo, pck *pckExtensions, tdReport []byte, now time.Time) error {
+	if tcbInfo.ID != tdxTCBInfoID {
+		return fmt.Errorf("TCB info is not for TDX: %q", tcbInfo.ID)
+	}
+	if now.After(tcbInfo.NextUpdate) {
+		return errors.New("TCB info is out of date")
+	}
+	if !bytes.Equal(tcbInfo.FMSPC, pck.fmspc) {
+		return fmt.Errorf("TCB info is for FMSPC %x, not %x", []byte(tcbInfo.FMSPC), pck.fmspc)
+	}
+
+	// The TDX module must be signed by Intel. Modules of versions other
+	// than 0 have their own identity and TCB levels.
+	teeTCBSVN := tdReport[tdxTEETCBSVNOffset : tdxTEETCBSVNOffset+tdxTCBComponents]
+	module := &tcbInfo.TDXModule
+	if version := teeTCBSVN[1]; version > 0 {
+		id := fmt.Sprintf("TDX_%02X", version)
+		module = nil
+		for i := range tcbInfo.Modules {
+			if tcbInfo.Modules[i].ID == id {
+				module = &tcbInfo.Modules[i]
+				break
+			}
+		}
+		if module == nil {
+			return fmt.Errorf("unknown TDX module %s", id)
+		}
+	}
+	if !bytes.Equal(module.MRSigner, tdReport[tdxMRSignerSEAMOffset:tdxMRSignerSEAMOffset+tdxMeasurementSize]) {
+		return errors.New("TDX module is not signed by Intel")
+	}
+	if !maskedEqual(tdReport[tdxSEAMAttributesOffset:tdxSEAMAttributesOffset+tdxSEAMAttributesSize], module.Attributes, module.AttributesMask) {
+		return errors.New("TDX module attributes do not match")
+	}
+	if teeTCBSVN[1] > 0 {
+		status, ok := isvTCBStatus(module.TCBLevels, int(teeTCBSVN[0]))
+		if !ok {
+			return errors.New("TDX module TCB is not recognized")
+		}
+		if !config.statusAllowed(status) {
+			return fmt.Errorf("TDX module TCB status %q is not allowed", status)
+		}
+	}
+
+	// The TCB status of the platform is the one of the first, i.e.
+	// highest, level the platform is at
+	for _, level := range tcbInfo.TCBLevels {
+		if !tdxTCBLevelMatches(level, pck, teeTCBSVN) {
+			continue
+		}
+		if !config.statusAllowed(level.TCBStatus) {
+			return fmt.Errorf("TCB status %q is not allowed", level.TCBStatus)
+		}
+		return nil
+	}
+	return errors.New("TCB is not recognized")
+}
+
+func tdxTCBLevelMatches(level tdxTCBLevel, pck *pckExtensions, teeTCBSVN []byte) bool {
+	if len(level.TCB.SGXComponents) != tdxTCBComponents || len(level.TCB.TDXComponents) != tdxTCBComponents {
+		return false
+	}
+	for i := 0; i < tdxTCBComponents; i++ {
+		if pck.cpuSVN[i] < level.TCB.SGXComponents[i].SVN {
+			return false
+		}
+	}
+	if pck.pceSVN < level.TCB.PCESVN {
+		return false
+	}
+	for i := 0; i < tdxTCBComponents; i++ {
+		// The module version is not an SVN when the module has its own
+		// identity
+		if i == 1 && teeTCBSVN[1] > 0 {
+			continue
+		}
+		if int(teeTCBSVN[i]) < level.TCB.TDXComponents[i].SVN {
+			return false
+		}
+	}
+	return true
+}
+
+func checkTDXQEIdentity(config tdxConfig, qeIdentity *tdxQEIdentity, qeReport []byte, now time.Time) error {
+	if qeIdentity.ID != tdxQEIdentityID {
+		return fmt.Errorf("QE identity is not for the TD QE: %q", qeIdentity.ID)
+	}
+	if now.After(qeIdentity.NextUpdate) {
+		return errors.New("QE identity is out of date")
+	}
+	if !bytes.Equal(qeIdentity.MRSigner, qeReport[tdxQEMRSignerOffset:tdxQEMRSignerOffset+tdxQEMRSignerSize]) {
+		return errors.New("QE is not signed by Intel")
+	}
+	if prodID := binary.LittleEndian.Uint16(qeReport[tdxQEISVProdIDOffset:]); prodID != qeIdentity.ISVProdID {
+		return fmt.Errorf("QE product ID %d does not match %d", prodID, qeIdentity.ISVProdID)
+	}
+	if !maskedEqual(qeReport[tdxQEMiscSelectOffset:tdxQEMiscSelectOffset+tdxQEMiscSelectSize], qeIdentity.MiscSelect, qeIdentity.MiscSelectMask) {
+		return errors.New("QE MISCSELECT does not match")
+	}
+	if !maskedEqual(qeReport[tdxQEAttributesOffset:tdxQEAttributesOffset+tdxQEAttributesSize], qeIdentity.Attributes, qeIdentity.AttributesMask) {
+		return errors.New("QE attributes do not match")
+	}
+
+	status, ok := isvTCBStatus(qeIdentity.TCBLevels, int(binary.LittleEndian.Uint16(qeReport[tdxQEISVSVNOffset:])))
+	if !ok {
+		return errors.New("QE TCB is not recognized")
+	}
+	if !config.statusAllowed(status) {
+		return fmt.Errorf("QE TCB status %q is not allowed", status)
+	}
+	return nil
+}
+
+// isvTCBStatus returns the status of the first, i.e. highest, TCB level the
+// SVN is at
+func isvTCBStatus(levels []tdxISVTCBLevel, svn int) (string, bool) {
+	for _, level := range levels {
+		if svn >= level.TCB.ISVSVN {
+			return level.TCBStatus, true
+		}
+	}
+	return "", false
+}
+
+// maskedEqual tells whether the value is the expected one under the mask
+func maskedEqual(value, expected, mask []byte) bool {
+	if len(expected) != len(value) || len(mask) != len(value) {
+		return false
+	}
+	for i := range value {
+		if value[i]&mask[i] != expected[i]&mask[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,288 @@
+package bundlepublisher
+
+import (
+	"context"
+	"crypto/md5" //nolint: gosec // MD5 is only used for the upload integrity check required by object stores
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/hcl"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire-plugin-sdk/pluginsdk"
+	identityproviderv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/hostservice/server/identityprovider/v1"
+	notifierv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/plugin/server/notifier/v1"
+	plugintypes "github.com/spiffe/spire-plugin-sdk/proto/spire/plugin/types"
+	configv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/service/common/config/v1"
+	"github.com/spiffe/spire/pkg/common/bundleutil"
+	"github.com/spiffe/spire/pkg/common/catalog"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	pluginName = "bundle_publisher"
+
+	storageS3  = "s3"
+	storageGCS = "gcs"
+
+	// latestObjectName is the name of the object holding the latest bundle,
+	// which partners poll
+	latestObjectName = "bundle.json"
+
+	// versionsDirName is the name of the directory holding every published
+	// bundle, named after its SHA-256 digest
+	versionsDirName = "versions"
+
+	contentType = "application/json"
+
+	// The latest bundle must be revalidated by the partners and the caches
+	// in front of the bucket, while versions never change
+	latestCacheControl  = "no-cache"
+	versionCacheControl = "public, max-age=31536000, immutable"
+
+	// sha256MetadataKey is the key of the object metadata holding the
+	// SHA-256 digest of the bundle, hex encoded
+	sha256MetadataKey = "sha256"
+)
+
+func BuiltIn() catalog.BuiltIn {
+	return builtIn(New())
+}
+
+func builtIn(p *Plugin) catalog.BuiltIn {
+	return catalog.MakeBuiltIn(pluginName,
+		notifierv1.NotifierPluginServer(p),
+		configv1.ConfigServiceServer(p),
+	)
+}
+
+// object is an object uploaded to the bucket
+type object struct {
+	Key          string
+	Data         []byte
+	ContentType  string
+	CacheControl string
+	// MD5 is the digest the object store verifies the upload against
+	MD5      []byte
+	Metadata map[string]string
+}
+
+type objectStore interface {
+	PutObject(ctx context.Context, obj object) error
+	Close() error
+}
+
+type pluginConfig struct {
+	Storage      string `hcl:"storage"`
+	Bucket       string `hcl:"bucket"`
+	ObjectPrefix string `hcl:"object_prefix"`
+
+	// S3 settings
+	Region          string `hcl:"region"`
+	Endpoint        string `hcl:"endpoint"`
+	AccessKeyID     string `hcl:"access_key_id"`
+	SecretAccessKey string `hcl:"secret_access_key"`
+
+	// GCS settings
+	ServiceAccountFile string `hcl:"service_account_file"`
+}
+
+// Plugin publishes the trust bundle in the SPIFFE bundle format to an S3 or
+// GCS bucket, e.g. one served as a static site, so that partners can poll a
+// stable HTTPS location for it without reaching the server.
+type Plugin struct {
+	notifierv1.UnsafeNotifierServer
+	configv1.UnsafeConfigServer
+
+	mu               sync.RWMutex
+	log              hclog.Logger
+	config           *pluginConfig
+	identityProvider identityproviderv1.IdentityProviderServiceClient
+
+	hooks struct {
+		newObjectStore func(ctx context.Context, config *pluginConfig) (objectStore, error)
+	}
+}
+
+func New() *Plugin {
+	p := &Plugin{}
+	p.hooks.newObjectStore = newObjectStore
+	return p
+}
+
+func (p *Plugin) SetLogger(log hclog.Logger) {
+	p.log = log
+}
+
+func (p *Plugin) BrokerHostServices(broker pluginsdk.ServiceBroker) error {
+	if !broker.BrokerClient(&p.identityProvider) {
+		return status.Errorf(codes.FailedPrecondition, "IdentityProvider host service is required")
+	}
+	return nil
+}
+
+func (p *Plugin) Notify(ctx context.Context, req *notifierv1.NotifyRequest) (*notifierv1.NotifyResponse, error) {
+	config, err := p.getConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := req.Event.(*notifierv1.NotifyRequest_BundleUpdated); ok {
+		if err := p.publishBundle(ctx, config); err != nil {
+			return nil, err
+		}
+	}
+	return &notifierv1.NotifyResponse{}, nil
+}
+
+func (p *Plugin) NotifyAndAdvise(ctx context.Context, req *notifierv1.NotifyAndAdviseRequest) (*notifierv1.NotifyAndAdviseResponse, error) {
+	config, err := p.getConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := req.Event.(*notifierv1.NotifyAndAdviseRequest_BundleLoaded); ok {
+		if err := p.publishBundle(ctx, config); err != nil {
+			return nil, err
+		}
+	}
+	return &notifierv1.NotifyAndAdviseResponse{}, nil
+}
+
+func (p *Plugin) Configure(ctx context.Context, req *configv1.ConfigureRequest) (*configv1.ConfigureResponse, error) {
+	config := new(pluginConfig)
+	if err := hcl.Decode(config, req.HclConfiguration); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "unable to decode configuration: %v", err)
+	}
+
+	switch config.Storage {
+	case storageS3:
+		if config.Region == "" {
+			return nil, status.Error(codes.InvalidArgument, "region must be set for s3 storage")
+		}
+		if (config.AccessKeyID == "") != (config.SecretAccessKey == "") {
+			return nil, status.Error(codes.InvalidArgument, "access_key_id and secret_access_key must be set together")
+		}
+	case storageGCS:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "storage must be %q or %q", storageS3, storageGCS)
+	}
+	if config.Bucket == "" {
+		return nil, status.Error(codes.InvalidArgument, "bucket must be set")
+	}
+
+	p.setConfig(config)
+	return &configv1.ConfigureResponse{}, nil
+}
+
+func (p *Plugin) getConfig() (*pluginConfig, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.config == nil {
+		return nil, status.Error(codes.FailedPrecondition, "not configured")
+	}
+	return p.config, nil
+}
+
+func (p *Plugin) setConfig(config *pluginConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.config = config
+}
+
+// publishBundle uploads the current bundle of the server as a new version,
+// then as the latest bundle. The bundle presented in the notification is
+// ignored in favor of the one of the identity provider, like for the other
+// bundle notifiers.
+func (p *Plugin) publishBundle(ctx context.Context, c *pluginConfig) error {
+	resp, err := p.identityProvider.FetchX509Identity(ctx, &identityproviderv1.FetchX509IdentityRequest{})
+	if err != nil {
+		st := status.Convert(err)
+		return status.Errorf(st.Code(), "unable to fetch bundle from SPIRE server: %v", st.Message())
+	}
+
+	data, err := marshalBundle(resp.Bundle)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to marshal bundle: %v", err)
+	}
+	sha256Sum := sha256.Sum256(data)
+	md5Sum := md5.Sum(data) //nolint: gosec // see import
+	digest := hex.EncodeToString(sha256Sum[:])
+
+	store, err := p.hooks.newObjectStore(ctx, c)
+	if err != nil {
+		return status.Errorf(codes.Unknown, "unable to instantiate object store client: %v", err)
+	}
+	defer store.Close()
+
+	// The version is uploaded first, so that the latest bundle always has a
+	// version partners can pin
+	for _, obj := range []object{
+		{
+			Key:          path.Join(c.ObjectPrefix, versionsDirName, digest+".json"),
+			CacheControl: versionCacheControl,
+		},
+		{
+			Key:          path.Join(c.ObjectPrefix, latestObjectName),
+			CacheControl: latestCacheControl,
+		},
+	} {
+		obj.Data = data
+		obj.ContentType = contentType
+		obj.MD5 = md5Sum[:]
+		obj.Metadata = map[string]string{sha256MetadataKey: digest}
+		if err := store.PutObject(ctx, obj); err != nil {
+			return status.Errorf(codes.Unknown, "unable to upload bundle object %s/%s: %v", c.Bucket, obj.Key, err)
+		}
+	}
+
+	p.log.Debug("Bundle published", telemetry.Path, path.Join(c.ObjectPrefix, latestObjectName), sha256MetadataKey, digest)
+	return nil
+}
+
+// marshalBundle renders the bundle in the SPIFFE bundle format
+func marshalBundle(pb *plugintypes.Bundle) ([]byte, error) {
+	td, err := spiffeid.TrustDomainFromString(pb.TrustDomain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trust domain: %w", err)
+	}
+
+	bundle := bundleutil.New(td)
+	for _, x509Authority := range pb.X509Authorities {
+		rootCA, err := x509.ParseCertificate(x509Authority.Asn1)
+		if err != nil {
+			return nil, fmt.Errorf("invalid X.509 authority: %w", err)
+		}
+		bundle.AppendRootCA(rootCA)
+	}
+	for _, jwtAuthority := range pb.JwtAuthorities {
+		publicKey, err := x509.ParsePKIXPublicKey(jwtAuthority.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT authority %q: %w", jwtAuthority.KeyId, err)
+		}
+		if err := bundle.AppendJWTSigningKey(jwtAuthority.KeyId, publicKey); err != nil {
+			return nil, fmt.Errorf("invalid JWT authority %q: %w", jwtAuthority.KeyId, err)
+		}
+	}
+	bundle.SetRefreshHint(time.Duration(pb.RefreshHint) * time.Second)
+
+	return bundleutil.Marshal(bundle)
+}
+
+func newObjectStore(ctx context.Context, c *pluginConfig) (objectStore, error) {
+	switch c.Storage {
+	case storageS3:
+		return newS3ObjectStore(c)
+	case storageGCS:
+		return newGCSObjectStore(ctx, c)
+	default:
+		return nil, fmt.Errorf("unsupported storage %q", c.Storage)
+	}
+}
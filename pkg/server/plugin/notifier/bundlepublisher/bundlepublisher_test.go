@@ -0,0 +1,283 @@
+package bundlepublisher
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	identityproviderv1 "github.com/spiffe/spire-plugin-sdk/proto/spire/hostservice/server/identityprovider/v1"
+	plugintypes "github.com/spiffe/spire-plugin-sdk/proto/spire/plugin/types"
+	"github.com/spiffe/spire/pkg/common/bundleutil"
+	"github.com/spiffe/spire/pkg/server/plugin/notifier"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/spiffe/spire/test/fakes/fakeidentityprovider"
+	"github.com/spiffe/spire/test/plugintest"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/spiffe/spire/test/testca"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+var td = spiffeid.RequireTrustDomainFromString("example.org")
+
+func TestRequiresIdentityProvider(t *testing.T) {
+	var err error
+	plugintest.Load(t, BuiltIn(), nil, plugintest.CaptureLoadError(&err))
+	spiretest.RequireGRPCStatusContains(t, err, codes.FailedPrecondition, "IdentityProvider host service is required")
+}
+
+func TestConfigure(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config string
+		code   codes.Code
+		desc   string
+	}{
+		{
+			name:   "malformed",
+			config: "MALFORMED",
+			code:   codes.InvalidArgument,
+			desc:   "unable to decode configuration",
+		},
+		{
+			name:   "missing storage",
+			config: `bucket = "the-bucket"`,
+			code:   codes.InvalidArgument,
+			desc:   `storage must be "s3" or "gcs"`,
+		},
+		{
+			name: "missing bucket",
+			config: `
+				storage = "gcs"
+			`,
+			code: codes.InvalidArgument,
+			desc: "bucket must be set",
+		},
+		{
+			name: "s3 without region",
+			config: `
+				storage = "s3"
+				bucket = "the-bucket"
+			`,
+			code: codes.InvalidArgument,
+			desc: "region must be set for s3 storage",
+		},
+		{
+			name: "s3 with partial static credentials",
+			config: `
+				storage = "s3"
+				bucket = "the-bucket"
+				region = "us-east-1"
+				access_key_id = "ACCESSKEYID"
+			`,
+			code: codes.InvalidArgument,
+			desc: "access_key_id and secret_access_key must be set together",
+		},
+		{
+			name: "s3",
+			config: `
+				storage = "s3"
+				bucket = "the-bucket"
+				region = "us-east-1"
+			`,
+			code: codes.OK,
+		},
+		{
+			name: "gcs",
+			config: `
+				storage = "gcs"
+				bucket = "the-bucket"
+				service_account_file = "the-service-account-file"
+			`,
+			code: codes.OK,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			plugintest.Load(t, BuiltIn(), nil,
+				plugintest.Configure(tt.config),
+				plugintest.CaptureConfigureError(&err),
+				plugintest.HostServices(identityproviderv1.IdentityProviderServiceServer(fakeidentityprovider.New())))
+			if tt.code != codes.OK {
+				spiretest.RequireGRPCStatusContains(t, err, tt.code, tt.desc)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNotifyBundleUpdated(t *testing.T) {
+	testPublishBundle(t, func(n notifier.Notifier) error {
+		return n.NotifyBundleUpdated(context.Background(), &common.Bundle{TrustDomainId: "spiffe://example.org"})
+	})
+}
+
+func TestNotifyAndAdviseBundleLoaded(t *testing.T) {
+	testPublishBundle(t, func(n notifier.Notifier) error {
+		return n.NotifyAndAdviseBundleLoaded(context.Background(), &common.Bundle{TrustDomainId: "spiffe://example.org"})
+	})
+}
+
+func testPublishBundle(t *testing.T, notify func(notifier.Notifier) error) {
+	ca := testca.New(t, td)
+	bundle := &plugintypes.Bundle{
+		TrustDomain: td.String(),
+		RefreshHint: 300,
+	}
+	for _, x509Authority := range ca.X509Authorities() {
+		bundle.X509Authorities = append(bundle.X509Authorities, &plugintypes.X509Certificate{Asn1: x509Authority.Raw})
+	}
+	for keyID, publicKey := range ca.JWTAuthorities() {
+		pkixBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+		require.NoError(t, err)
+		bundle.JwtAuthorities = append(bundle.JwtAuthorities, &plugintypes.JWTKey{KeyId: keyID, PublicKey: pkixBytes})
+	}
+
+	for _, tt := range []struct {
+		name          string
+		bundle        *plugintypes.Bundle
+		skipConfigure bool
+		newStoreErr   error
+		putObjectErr  error
+		code          codes.Code
+		desc          string
+	}{
+		{
+			name:          "not configured",
+			skipConfigure: true,
+			code:          codes.FailedPrecondition,
+			desc:          "notifier(bundle_publisher): not configured",
+		},
+		{
+			name: "failed to fetch bundle from identity provider",
+			code: codes.Unknown,
+			desc: "notifier(bundle_publisher): unable to fetch bundle from SPIRE server: no bundle",
+		},
+		{
+			name: "failed to marshal bundle",
+			bundle: &plugintypes.Bundle{
+				TrustDomain:     td.String(),
+				X509Authorities: []*plugintypes.X509Certificate{{Asn1: []byte("malformed")}},
+			},
+			code: codes.Internal,
+			desc: "notifier(bundle_publisher): unable to marshal bundle: invalid X.509 authority",
+		},
+		{
+			name:        "failed to create object store client",
+			bundle:      bundle,
+			newStoreErr: errors.New("ohno"),
+			code:        codes.Unknown,
+			desc:        "notifier(bundle_publisher): unable to instantiate object store client: ohno",
+		},
+		{
+			name:         "failed to upload object",
+			bundle:       bundle,
+			putObjectErr: errors.New("ohno"),
+			code:         codes.Unknown,
+			desc:         "notifier(bundle_publisher): unable to upload bundle object the-bucket/spiffe/example.org/versions/",
+		},
+		{
+			name:   "success",
+			bundle: bundle,
+			code:   codes.OK,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeObjectStore{putObjectErr: tt.putObjectErr}
+			raw := New()
+			raw.hooks.newObjectStore = func(ctx context.Context, c *pluginConfig) (objectStore, error) {
+				assert.Equal(t, "gcs", c.Storage)
+				assert.Equal(t, "the-bucket", c.Bucket)
+				if tt.newStoreErr != nil {
+					return nil, tt.newStoreErr
+				}
+				return store, nil
+			}
+
+			idp := fakeidentityprovider.New()
+			if tt.bundle != nil {
+				idp.AppendBundle(tt.bundle)
+			}
+
+			options := []plugintest.Option{
+				plugintest.HostServices(identityproviderv1.IdentityProviderServiceServer(idp)),
+			}
+			if !tt.skipConfigure {
+				options = append(options, plugintest.Configure(`
+					storage = "gcs"
+					bucket = "the-bucket"
+					object_prefix = "spiffe/example.org"
+				`))
+			}
+
+			plugin := new(notifier.V1)
+			plugintest.Load(t, builtIn(raw), plugin, options...)
+
+			err := notify(plugin)
+			if tt.code != codes.OK {
+				spiretest.RequireGRPCStatusContains(t, err, tt.code, tt.desc)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, store.closed)
+
+			// The version is uploaded before the latest bundle, with the
+			// same content
+			require.Len(t, store.objects, 2)
+			version, latest := store.objects[0], store.objects[1]
+			sum := sha256.Sum256(latest.Data)
+			digest := hex.EncodeToString(sum[:])
+			assert.Equal(t, "spiffe/example.org/versions/"+digest+".json", version.Key)
+			assert.Equal(t, "public, max-age=31536000, immutable", version.CacheControl)
+			assert.Equal(t, "spiffe/example.org/bundle.json", latest.Key)
+			assert.Equal(t, "no-cache", latest.CacheControl)
+			for _, obj := range store.objects {
+				assert.Equal(t, latest.Data, obj.Data)
+				assert.Equal(t, "application/json", obj.ContentType)
+				assert.Equal(t, map[string]string{"sha256": digest}, obj.Metadata)
+				assert.Len(t, obj.MD5, 16)
+			}
+
+			// The bundle is in the SPIFFE bundle format
+			published, err := bundleutil.Unmarshal(td, latest.Data)
+			require.NoError(t, err)
+			assert.Equal(t, ca.X509Authorities(), published.RootCAs())
+			assert.Equal(t, ca.JWTAuthorities(), published.JWTSigningKeys())
+			assert.Equal(t, 300*time.Second, published.RefreshHint())
+		})
+	}
+}
+
+type fakeObjectStore struct {
+	mu           sync.Mutex
+	objects      []object
+	putObjectErr error
+	closed       bool
+}
+
+func (s *fakeObjectStore) PutObject(ctx context.Context, obj object) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.putObjectErr != nil {
+		return s.putObjectErr
+	}
+	s.objects = append(s.objects, obj)
+	return nil
+}
+
+func (s *fakeObjectStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
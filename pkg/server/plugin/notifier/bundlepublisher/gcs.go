@@ -0,0 +1,52 @@
+package bundlepublisher
+
+import (
+	"context"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+type gcsObjectStore struct {
+	client *storage.Client
+	bucket string
+}
+
+// newGCSObjectStore returns a client of the GCS bucket. Credentials are read
+// from the service account file if set, or are the Application Default
+// Credentials.
+func newGCSObjectStore(ctx context.Context, c *pluginConfig) (objectStore, error) {
+	var opts []option.ClientOption
+	if c.ServiceAccountFile != "" {
+		opts = append(opts, option.WithCredentialsFile(c.ServiceAccountFile))
+	}
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsObjectStore{
+		client: client,
+		bucket: c.Bucket,
+	}, nil
+}
+
+func (s *gcsObjectStore) PutObject(ctx context.Context, obj object) error {
+	// If for whatever reason we don't make it to w.Close(), canceling the
+	// context will cleanly release resources held by the writer.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := s.client.Bucket(s.bucket).Object(obj.Key).NewWriter(ctx)
+	w.ContentType = obj.ContentType
+	w.CacheControl = obj.CacheControl
+	w.MD5 = obj.MD5
+	w.Metadata = obj.Metadata
+	if _, err := w.Write(obj.Data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (s *gcsObjectStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,55 @@
+package bundlepublisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type s3ObjectStore struct {
+	client *s3.S3
+	bucket string
+}
+
+// newS3ObjectStore returns a client of the S3 bucket. Credentials default to
+// the credential chain of the AWS SDK, e.g. the instance profile of the
+// server. The endpoint, if set, is that of an S3 compatible store.
+func newS3ObjectStore(c *pluginConfig) (objectStore, error) {
+	config := aws.NewConfig().WithRegion(c.Region)
+	if c.AccessKeyID != "" {
+		config.WithCredentials(credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, ""))
+	}
+	if c.Endpoint != "" {
+		config.WithEndpoint(c.Endpoint).WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+	return &s3ObjectStore{
+		client: s3.New(sess),
+		bucket: c.Bucket,
+	}, nil
+}
+
+func (s *s3ObjectStore) PutObject(ctx context.Context, obj object) error {
+	_, err := s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(obj.Key),
+		Body:         bytes.NewReader(obj.Data),
+		ContentType:  aws.String(obj.ContentType),
+		CacheControl: aws.String(obj.CacheControl),
+		ContentMD5:   aws.String(base64.StdEncoding.EncodeToString(obj.MD5)),
+		Metadata:     aws.StringMap(obj.Metadata),
+	})
+	return err
+}
+
+func (s *s3ObjectStore) Close() error {
+	return nil
+}
@@ -59,6 +59,22 @@ type pluginConfig struct {
 	WebhookLabel       string `hcl:"webhook_label"`
 	APIServiceLabel    string `hcl:"api_service_label"`
 	KubeConfigFilePath string `hcl:"kube_config_file_path"`
+
+	// ValidatingWebhooks, MutatingWebhooks and APIServices are the names of
+	// the objects to rotate the CA Bundle in, besides the labeled ones
+	ValidatingWebhooks []string `hcl:"validating_webhooks"`
+	MutatingWebhooks   []string `hcl:"mutating_webhooks"`
+	APIServices        []string `hcl:"api_services"`
+}
+
+// watchesWebhooks returns true if the CA bundle is rotated in webhooks
+func (c *pluginConfig) watchesWebhooks() bool {
+	return c.WebhookLabel != "" || len(c.ValidatingWebhooks) > 0 || len(c.MutatingWebhooks) > 0
+}
+
+// watchesAPIServices returns true if the CA bundle is rotated in API services
+func (c *pluginConfig) watchesAPIServices() bool {
+	return c.APIServiceLabel != "" || len(c.APIServices) > 0
 }
 
 type Plugin struct {
@@ -161,7 +177,7 @@ func (p *Plugin) setConfig(config *pluginConfig) error {
 
 	// Start watcher to set CA Bundle in objects created after server has started
 	var cancelWatcher func()
-	if config.WebhookLabel != "" || config.APIServiceLabel != "" {
+	if config.watchesWebhooks() || config.watchesAPIServices() {
 		ctx, cancel := context.WithCancel(context.Background())
 		watcher, err := newBundleWatcher(ctx, p, config)
 		if err != nil {
@@ -185,7 +201,7 @@ func (p *Plugin) setConfig(config *pluginConfig) error {
 		p.cancelWatcher()
 		p.cancelWatcher = nil
 	}
-	if config.WebhookLabel != "" || config.APIServiceLabel != "" {
+	if config.watchesWebhooks() || config.watchesAPIServices() {
 		p.cancelWatcher = cancelWatcher
 	}
 
@@ -279,13 +295,13 @@ func newKubeClient(c *pluginConfig) ([]kubeClient, error) {
 	}
 
 	clients := []kubeClient{configMapClient{Clientset: clientset}}
-	if c.WebhookLabel != "" {
-		clients = append(clients,
-			mutatingWebhookClient{Clientset: clientset},
-			validatingWebhookClient{Clientset: clientset},
-		)
+	if c.WebhookLabel != "" || len(c.MutatingWebhooks) > 0 {
+		clients = append(clients, mutatingWebhookClient{Clientset: clientset})
 	}
-	if c.APIServiceLabel != "" {
+	if c.WebhookLabel != "" || len(c.ValidatingWebhooks) > 0 {
+		clients = append(clients, validatingWebhookClient{Clientset: clientset})
+	}
+	if c.watchesAPIServices() {
 		clients = append(clients,
 			apiServiceClient{Clientset: aggregatorClientset},
 		)
@@ -390,9 +406,11 @@ func (c apiServiceClient) Get(ctx context.Context, namespace, name string) (runt
 }
 
 func (c apiServiceClient) GetList(ctx context.Context, config *pluginConfig) (runtime.Object, error) {
-	return c.ApiregistrationV1().APIServices().List(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=true", config.APIServiceLabel),
-	})
+	list, err := c.ApiregistrationV1().APIServices().List(ctx, listOptions(config.APIServiceLabel, config.APIServices))
+	if err != nil {
+		return nil, err
+	}
+	return selectList(list, config.APIServiceLabel, config.APIServices)
 }
 
 func (c apiServiceClient) CreatePatch(ctx context.Context, config *pluginConfig, obj runtime.Object, resp *identityproviderv1.FetchX509IdentityResponse) (runtime.Object, error) {
@@ -426,9 +444,11 @@ func (c apiServiceClient) Patch(ctx context.Context, namespace, name string, pat
 }
 
 func (c apiServiceClient) Watch(ctx context.Context, config *pluginConfig) (watch.Interface, error) {
-	return c.ApiregistrationV1().APIServices().Watch(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=true", config.APIServiceLabel),
-	})
+	watcher, err := c.ApiregistrationV1().APIServices().Watch(ctx, listOptions(config.APIServiceLabel, config.APIServices))
+	if err != nil {
+		return nil, err
+	}
+	return selectWatch(watcher, config.APIServiceLabel, config.APIServices), nil
 }
 
 // mutatingWebhookClient encapsulates the Kubenetes API for updating the CA Bundle in a mutating webhook
@@ -441,9 +461,11 @@ func (c mutatingWebhookClient) Get(ctx context.Context, namespace, mutatingWebho
 }
 
 func (c mutatingWebhookClient) GetList(ctx context.Context, config *pluginConfig) (runtime.Object, error) {
-	return c.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=true", config.WebhookLabel),
-	})
+	list, err := c.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, listOptions(config.WebhookLabel, config.MutatingWebhooks))
+	if err != nil {
+		return nil, err
+	}
+	return selectList(list, config.WebhookLabel, config.MutatingWebhooks)
 }
 
 func (c mutatingWebhookClient) CreatePatch(ctx context.Context, config *pluginConfig, obj runtime.Object, resp *identityproviderv1.FetchX509IdentityResponse) (runtime.Object, error) {
@@ -488,9 +510,11 @@ func (c mutatingWebhookClient) Patch(ctx context.Context, namespace, name string
 }
 
 func (c mutatingWebhookClient) Watch(ctx context.Context, config *pluginConfig) (watch.Interface, error) {
-	return c.AdmissionregistrationV1().MutatingWebhookConfigurations().Watch(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=true", config.WebhookLabel),
-	})
+	watcher, err := c.AdmissionregistrationV1().MutatingWebhookConfigurations().Watch(ctx, listOptions(config.WebhookLabel, config.MutatingWebhooks))
+	if err != nil {
+		return nil, err
+	}
+	return selectWatch(watcher, config.WebhookLabel, config.MutatingWebhooks), nil
 }
 
 // validatingWebhookClient encapsulates the Kubenetes API for updating the CA Bundle in a validating webhook
@@ -503,9 +527,11 @@ func (c validatingWebhookClient) Get(ctx context.Context, namespace, validatingW
 }
 
 func (c validatingWebhookClient) GetList(ctx context.Context, config *pluginConfig) (runtime.Object, error) {
-	return c.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=true", config.WebhookLabel),
-	})
+	list, err := c.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(ctx, listOptions(config.WebhookLabel, config.ValidatingWebhooks))
+	if err != nil {
+		return nil, err
+	}
+	return selectList(list, config.WebhookLabel, config.ValidatingWebhooks)
 }
 
 func (c validatingWebhookClient) CreatePatch(ctx context.Context, config *pluginConfig, obj runtime.Object, resp *identityproviderv1.FetchX509IdentityResponse) (runtime.Object, error) {
@@ -550,8 +576,71 @@ func (c validatingWebhookClient) Patch(ctx context.Context, namespace, name stri
 }
 
 func (c validatingWebhookClient) Watch(ctx context.Context, config *pluginConfig) (watch.Interface, error) {
-	return c.AdmissionregistrationV1().ValidatingWebhookConfigurations().Watch(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=true", config.WebhookLabel),
+	watcher, err := c.AdmissionregistrationV1().ValidatingWebhookConfigurations().Watch(ctx, listOptions(config.WebhookLabel, config.ValidatingWebhooks))
+	if err != nil {
+		return nil, err
+	}
+	return selectWatch(watcher, config.WebhookLabel, config.ValidatingWebhooks), nil
+}
+
+// listOptions returns the options to list or watch the objects with the
+// label set to true or with one of the names. Objects can't be selected by
+// several names server side, so all the objects are listed when names are
+// given, and filtered with selected.
+func listOptions(label string, names []string) metav1.ListOptions {
+	if len(names) > 0 || label == "" {
+		return metav1.ListOptions{}
+	}
+	return metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=true", label),
+	}
+}
+
+// selected returns true if the object has the label set to true or has one
+// of the names
+func selected(obj metav1.Object, label string, names []string) bool {
+	if label != "" && obj.GetLabels()[label] == "true" {
+		return true
+	}
+	for _, name := range names {
+		if obj.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selectList drops the items of the list that are not selected
+func selectList(list runtime.Object, label string, names []string) (runtime.Object, error) {
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	var selectedItems []runtime.Object
+	for _, item := range items {
+		itemMeta, err := meta.Accessor(item)
+		if err != nil {
+			return nil, err
+		}
+		if selected(itemMeta, label, names) {
+			selectedItems = append(selectedItems, item)
+		}
+	}
+	if err := meta.SetList(list, selectedItems); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// selectWatch drops the events of the objects that are not selected
+func selectWatch(watcher watch.Interface, label string, names []string) watch.Interface {
+	return watch.Filter(watcher, func(event watch.Event) (watch.Event, bool) {
+		objectMeta, err := meta.Accessor(event.Object)
+		if err != nil {
+			// Let the errors through to the watcher
+			return event, true
+		}
+		return event, selected(objectMeta, label, names)
 	})
 }
 
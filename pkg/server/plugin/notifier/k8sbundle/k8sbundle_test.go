@@ -22,6 +22,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	admissionv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -330,6 +331,80 @@ func TestConfigureWithMalformedConfiguration(t *testing.T) {
 	spiretest.RequireGRPCStatusContains(t, err, codes.InvalidArgument, "unable to decode configuration")
 }
 
+func TestListOptions(t *testing.T) {
+	require.Equal(t, metav1.ListOptions{LabelSelector: "LABEL=true"}, listOptions("LABEL", nil))
+	require.Equal(t, metav1.ListOptions{}, listOptions("LABEL", []string{"NAME"}))
+	require.Equal(t, metav1.ListOptions{}, listOptions("", []string{"NAME"}))
+}
+
+func TestSelectList(t *testing.T) {
+	list := &admissionv1.ValidatingWebhookConfigurationList{
+		Items: []admissionv1.ValidatingWebhookConfiguration{
+			newValidatingWebhook("labeled", map[string]string{"LABEL": "true"}),
+			newValidatingWebhook("named", nil),
+			newValidatingWebhook("label-false", map[string]string{"LABEL": "false"}),
+			newValidatingWebhook("other", nil),
+		},
+	}
+
+	obj, err := selectList(list, "LABEL", []string{"named"})
+	require.NoError(t, err)
+	require.Equal(t, &admissionv1.ValidatingWebhookConfigurationList{
+		Items: []admissionv1.ValidatingWebhookConfiguration{
+			newValidatingWebhook("labeled", map[string]string{"LABEL": "true"}),
+			newValidatingWebhook("named", nil),
+		},
+	}, obj)
+
+	obj, err = selectList(list, "", []string{"other"})
+	require.NoError(t, err)
+	require.Equal(t, &admissionv1.ValidatingWebhookConfigurationList{
+		Items: []admissionv1.ValidatingWebhookConfiguration{
+			newValidatingWebhook("other", nil),
+		},
+	}, obj)
+}
+
+func TestSelectWatch(t *testing.T) {
+	fakeWatcher := watch.NewFake()
+	watcher := selectWatch(fakeWatcher, "", []string{"named"})
+	defer watcher.Stop()
+
+	go func() {
+		other := newValidatingWebhook("other", nil)
+		named := newValidatingWebhook("named", nil)
+		fakeWatcher.Add(&other)
+		fakeWatcher.Add(&named)
+	}()
+
+	event := <-watcher.ResultChan()
+	require.Equal(t, watch.Added, event.Type)
+	webhook, ok := event.Object.(*admissionv1.ValidatingWebhookConfiguration)
+	require.True(t, ok)
+	require.Equal(t, "named", webhook.Name)
+}
+
+func TestConfigureWatchesNamedObjects(t *testing.T) {
+	for _, configuration := range []string{
+		`validating_webhooks = ["spire-k8s-registrar-webhook"]`,
+		`mutating_webhooks = ["some-webhook"]`,
+		`api_services = ["v1.example.org"]`,
+	} {
+		test := setupWatcherTest("", newFakeKubeClient())
+		raw := test.loadPluginRaw(t, configuration)
+		require.NotNil(t, raw.cancelWatcher, configuration)
+	}
+}
+
+func newValidatingWebhook(name string, labels map[string]string) admissionv1.ValidatingWebhookConfiguration {
+	return admissionv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+}
+
 func TestBundleFailsToLoadIfHostServicesUnavailabler(t *testing.T) {
 	var err error
 	plugintest.Load(t, BuiltIn(), nil,
@@ -14,18 +14,23 @@ import (
 	"github.com/andres-erbsen/clock"
 	bundlev1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/bundle/v1"
 	server_util "github.com/spiffe/spire/cmd/spire-server/util"
+	"github.com/spiffe/spire/pkg/common/fips"
 	"github.com/spiffe/spire/pkg/common/health"
 	"github.com/spiffe/spire/pkg/common/profiling"
+	"github.com/spiffe/spire/pkg/common/systemd"
 	"github.com/spiffe/spire/pkg/common/telemetry"
 	"github.com/spiffe/spire/pkg/common/uptime"
 	"github.com/spiffe/spire/pkg/common/util"
 	bundle_client "github.com/spiffe/spire/pkg/server/bundle/client"
 	"github.com/spiffe/spire/pkg/server/ca"
 	"github.com/spiffe/spire/pkg/server/catalog"
+	"github.com/spiffe/spire/pkg/server/cloudevents"
 	"github.com/spiffe/spire/pkg/server/datastore"
 	"github.com/spiffe/spire/pkg/server/endpoints"
 	"github.com/spiffe/spire/pkg/server/hostservice/agentstore"
 	"github.com/spiffe/spire/pkg/server/hostservice/identityprovider"
+	"github.com/spiffe/spire/pkg/server/lastseen"
+	"github.com/spiffe/spire/pkg/server/nodeevents"
 	"github.com/spiffe/spire/pkg/server/registration"
 	"github.com/spiffe/spire/pkg/server/svid"
 	"google.golang.org/grpc"
@@ -59,6 +64,11 @@ func (s *Server) Run(ctx context.Context) error {
 }
 
 func (s *Server) run(ctx context.Context) (err error) {
+	if s.config.FIPSMode {
+		fips.Enable()
+		s.config.Log.WithField(telemetry.BoringCrypto, fips.BuildEnabled()).Info("FIPS mode enabled")
+	}
+
 	// create the data directory if needed
 	s.config.Log.Infof("Data directory: %q", s.config.DataDir)
 	if err := os.MkdirAll(s.config.DataDir, 0755); err != nil {
@@ -108,7 +118,7 @@ func (s *Server) run(ctx context.Context) (err error) {
 		return err
 	}
 
-	serverCA := s.newCA(metrics, healthChecker)
+	serverCA := s.newCA(cat, metrics, healthChecker)
 
 	// CA manager needs to be initialized before the rotator, otherwise the
 	// server CA plugin won't be able to sign CSRs
@@ -122,7 +132,25 @@ func (s *Server) run(ctx context.Context) (err error) {
 		return err
 	}
 
-	endpointsServer, err := s.newEndpointsServer(ctx, cat, svidRotator, serverCA, metrics, caManager)
+	var nodeEventsWebhook *nodeevents.Webhook
+	if s.config.NodeEventsWebhook != nil {
+		nodeEventsWebhook = s.newNodeEventsWebhook()
+	}
+
+	var cloudEventsPublisher *cloudevents.Publisher
+	if s.config.CloudEvents != nil {
+		cloudEventsPublisher = s.newCloudEventsPublisher()
+		// Publish the changes of the registration entries made through any
+		// of the APIs
+		cat.SetDataStore(cloudevents.WithEntryEvents(cat.GetDataStore(), cloudEventsPublisher))
+	}
+
+	var lastSeenTracker *lastseen.Tracker
+	if s.config.AgentLastSeen != nil {
+		lastSeenTracker = s.newLastSeenTracker(cat, metrics, nodeEventsNotifier(nodeEventsWebhook, cloudEventsPublisher))
+	}
+
+	endpointsServer, err := s.newEndpointsServer(ctx, cat, svidRotator, serverCA, metrics, caManager, nodeEventsWebhook, cloudEventsPublisher, lastSeenTracker)
 	if err != nil {
 		return err
 	}
@@ -157,7 +185,7 @@ func (s *Server) run(ctx context.Context) (err error) {
 		return fmt.Errorf("failed adding healthcheck: %w", err)
 	}
 
-	err = util.RunTasks(ctx,
+	tasks := []func(context.Context) error{
 		caManager.Run,
 		svidRotator.Run,
 		endpointsServer.ListenAndServe,
@@ -165,8 +193,20 @@ func (s *Server) run(ctx context.Context) (err error) {
 		bundleManager.Run,
 		registrationManager.Run,
 		util.SerialRun(s.waitForTestDial, healthChecker.ListenAndServe),
+		util.SerialRun(s.waitForTestDial, systemd.NewNotifier(s.config.Log.WithField(telemetry.SubsystemName, "systemd"), s).Run),
 		scanForBadEntries(s.config.Log, metrics, cat.GetDataStore()),
-	)
+	}
+	if nodeEventsWebhook != nil {
+		tasks = append(tasks, nodeEventsWebhook.Run)
+	}
+	if cloudEventsPublisher != nil {
+		tasks = append(tasks, cloudEventsPublisher.Run)
+	}
+	if lastSeenTracker != nil {
+		tasks = append(tasks, lastSeenTracker.Run)
+	}
+
+	err = util.RunTasks(ctx, tasks...)
 	if errors.Is(err, context.Canceled) {
 		err = nil
 	}
@@ -239,18 +279,22 @@ func (s *Server) loadCatalog(ctx context.Context, metrics telemetry.Metrics, ide
 		IdentityProvider: identityProvider,
 		AgentStore:       agentStore,
 		HealthChecker:    healthChecker,
+		DatastoreCache:   s.config.DatastoreCache,
 	})
 }
 
-func (s *Server) newCA(metrics telemetry.Metrics, healthChecker health.Checker) *ca.CA {
+func (s *Server) newCA(cat catalog.Catalog, metrics telemetry.Metrics, healthChecker health.Checker) *ca.CA {
 	return ca.NewCA(ca.Config{
-		Log:           s.config.Log.WithField(telemetry.SubsystemName, telemetry.CA),
-		Metrics:       metrics,
-		X509SVIDTTL:   s.config.SVIDTTL,
-		JWTIssuer:     s.config.JWTIssuer,
-		TrustDomain:   s.config.TrustDomain,
-		CASubject:     s.config.CASubject,
-		HealthChecker: healthChecker,
+		Log:                 s.config.Log.WithField(telemetry.SubsystemName, telemetry.CA),
+		Metrics:             metrics,
+		X509SVIDTTL:         s.config.SVIDTTL,
+		JWTIssuer:           s.config.JWTIssuer,
+		JWTX5C:              s.config.JWTX5C,
+		CredentialComposers: cat.GetCredentialComposers(),
+		TrustDomain:         s.config.TrustDomain,
+		CASubject:           s.config.CASubject,
+		HealthChecker:       healthChecker,
+		Backdate:            s.config.ClockSkewTolerance,
 	})
 }
 
@@ -267,6 +311,7 @@ func (s *Server) newCAManager(ctx context.Context, cat catalog.Catalog, metrics
 		X509CAKeyType: s.config.CAKeyType,
 		JWTKeyType:    s.config.JWTKeyType,
 		HealthChecker: healthChecker,
+		Backdate:      s.config.ClockSkewTolerance,
 	})
 	if err := caManager.Initialize(ctx); err != nil {
 		return nil, err
@@ -297,7 +342,47 @@ func (s *Server) newSVIDRotator(ctx context.Context, serverCA ca.ServerCA, metri
 	return svidRotator, nil
 }
 
-func (s *Server) newEndpointsServer(ctx context.Context, catalog catalog.Catalog, svidObserver svid.Observer, serverCA ca.ServerCA, metrics telemetry.Metrics, caManager *ca.Manager) (endpoints.Server, error) {
+func (s *Server) newNodeEventsWebhook() *nodeevents.Webhook {
+	config := *s.config.NodeEventsWebhook
+	config.Log = s.config.Log.WithField(telemetry.SubsystemName, telemetry.NodeEventsWebhook)
+	return nodeevents.NewWebhook(config)
+}
+
+func (s *Server) newCloudEventsPublisher() *cloudevents.Publisher {
+	config := *s.config.CloudEvents
+	if config.Source == "" {
+		config.Source = s.config.TrustDomain.IDString()
+	}
+	config.Log = s.config.Log.WithField(telemetry.SubsystemName, telemetry.CloudEvents)
+	return cloudevents.NewPublisher(config)
+}
+
+// nodeEventsNotifier returns the notifier of the attested node events, if
+// any is configured
+func nodeEventsNotifier(nodeEventsWebhook *nodeevents.Webhook, cloudEventsPublisher *cloudevents.Publisher) nodeevents.Notifier {
+	var nodeEvents nodeevents.Notifiers
+	if nodeEventsWebhook != nil {
+		nodeEvents = append(nodeEvents, nodeEventsWebhook)
+	}
+	if cloudEventsPublisher != nil {
+		nodeEvents = append(nodeEvents, cloudEventsPublisher)
+	}
+	if len(nodeEvents) == 0 {
+		return nil
+	}
+	return nodeEvents
+}
+
+func (s *Server) newLastSeenTracker(cat catalog.Catalog, metrics telemetry.Metrics, nodeEvents nodeevents.Notifier) *lastseen.Tracker {
+	config := *s.config.AgentLastSeen
+	config.DataStore = cat.GetDataStore()
+	config.Log = s.config.Log.WithField(telemetry.SubsystemName, telemetry.AgentLastSeen)
+	config.Metrics = metrics
+	config.NodeEvents = nodeEvents
+	return lastseen.New(config)
+}
+
+func (s *Server) newEndpointsServer(ctx context.Context, catalog catalog.Catalog, svidObserver svid.Observer, serverCA *ca.CA, metrics telemetry.Metrics, caManager *ca.Manager, nodeEventsWebhook *nodeevents.Webhook, cloudEventsPublisher *cloudevents.Publisher, lastSeenTracker *lastseen.Tracker) (endpoints.Server, error) {
 	config := endpoints.Config{
 		TCPAddr:             s.config.BindAddress,
 		UDSAddr:             s.config.BindUDSAddress,
@@ -309,15 +394,29 @@ func (s *Server) newEndpointsServer(ctx context.Context, catalog catalog.Catalog
 		Metrics:             metrics,
 		Manager:             caManager,
 		RateLimit:           s.config.RateLimit,
+		DownstreamPolicy:    s.config.DownstreamPolicy,
+		IDPolicy:            s.config.IDPolicy,
+		OwnershipPolicy:     s.config.OwnershipPolicy,
+		EntryTemplates:      s.config.EntryTemplates,
 		Uptime:              uptime.Uptime,
 		Clock:               clock.New(),
 		CacheReloadInterval: s.config.CacheReloadInterval,
 		AuditLogEnabled:     s.config.AuditLogEnabled,
+		DrainTimeout:        s.config.DrainTimeout,
+		NodeEvents:          nodeEventsNotifier(nodeEventsWebhook, cloudEventsPublisher),
+		AgentLastSeen:       lastSeenTracker,
+	}
+	if cloudEventsPublisher != nil {
+		config.X509SVIDEvents = cloudEventsPublisher
 	}
 	if s.config.Federation.BundleEndpoint != nil {
 		config.BundleEndpoint.Address = s.config.Federation.BundleEndpoint.Address
 		config.BundleEndpoint.ACME = s.config.Federation.BundleEndpoint.ACME
 	}
+	if s.config.AdminAPI != nil {
+		config.AdminAPI = *s.config.AdminAPI
+		config.CAState = serverCA
+	}
 	return endpoints.New(ctx, config)
 }
 
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// circuitBreaker stops the webhook from talking to the SPIRE server
+// synchronously after a number of consecutive failures, for a cooldown period
+// during which admission requests are handled asynchronously.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mtx       sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow returns false while the breaker is open. Once the cooldown has
+// elapsed, calls are allowed again, and a single failure opens the breaker
+// for another cooldown period.
+func (b *circuitBreaker) Allow() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return !b.now().Before(b.openUntil)
+}
+
+// Success closes the breaker
+func (b *circuitBreaker) Success() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.failures = 0
+}
+
+// Failure records a failed call, opening the breaker once the threshold of
+// consecutive failures is reached. It returns true if the breaker was opened.
+func (b *circuitBreaker) Failure() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.failures++
+	if b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = b.now().Add(b.cooldown)
+	return true
+}
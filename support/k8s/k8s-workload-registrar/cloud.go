@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/spiffe/spire/pkg/common/plugin/azure"
+	"github.com/zeebo/errs"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	cloudProviderGKE = "gke"
+	cloudProviderEKS = "eks"
+	cloudProviderAKS = "aks"
+
+	cloudContextTimeout = 10 * time.Second
+
+	defaultGCEMetadataEndpoint = "http://metadata.google.internal"
+	// eksClusterNameTag is set by EKS on the instances of managed node groups
+	eksClusterNameTag = "eks:cluster-name"
+	// aksNodeResourceGroupPrefix starts the name of the resource group AKS
+	// creates for the nodes of a cluster, MC_<resource group>_<cluster>_<location>
+	aksNodeResourceGroupPrefix = "MC_"
+)
+
+// cloudContext holds what the registrar learns at startup about the managed
+// Kubernetes cluster it runs on. Values that could not be discovered are
+// empty, and must then be configured.
+type cloudContext struct {
+	Cluster       string
+	AWSAccountID  string
+	AzureTenantID string
+}
+
+// discoverCloudContext discovers the context of the cluster from the metadata
+// services of the cloud provider of the node the registrar runs on
+var discoverCloudContext = func(ctx context.Context, provider string) (*cloudContext, error) {
+	ctx, cancel := context.WithTimeout(ctx, cloudContextTimeout)
+	defer cancel()
+
+	client := &http.Client{Timeout: cloudContextTimeout}
+	switch provider {
+	case cloudProviderGKE:
+		return discoverGKEContext(ctx, client, defaultGCEMetadataEndpoint)
+	case cloudProviderEKS:
+		return discoverEKSContext(client, "")
+	case cloudProviderAKS:
+		return discoverAKSContext(ctx, client)
+	default:
+		return nil, errs.New("unsupported cloud provider %q", provider)
+	}
+}
+
+// discoverGKEContext reads the cluster name from the attributes GKE sets on
+// the node instances
+func discoverGKEContext(ctx context.Context, client *http.Client, endpoint string) (*cloudContext, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/computeMetadata/v1/instance/attributes/cluster-name", nil)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errs.New("unable to query the GCE metadata server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// Not a GKE node
+		return &cloudContext{}, nil
+	default:
+		return nil, errs.New("unexpected status code %d from the GCE metadata server", resp.StatusCode)
+	}
+
+	clusterName, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errs.New("unable to read the GCE metadata server response: %v", err)
+	}
+	return &cloudContext{
+		Cluster: strings.TrimSpace(string(clusterName)),
+	}, nil
+}
+
+// discoverEKSContext reads the account from the instance identity document
+// of the node, and the cluster name from the tags of the instances of managed
+// node groups, which are only available when the instance metadata options
+// allow tags. The endpoint overrides the default one of the instance metadata
+// service if set.
+func discoverEKSContext(httpClient *http.Client, endpoint string) (*cloudContext, error) {
+	config := aws.NewConfig().WithHTTPClient(httpClient)
+	if endpoint != "" {
+		config.WithEndpoint(endpoint)
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	client := ec2metadata.New(sess)
+
+	doc, err := client.GetInstanceIdentityDocument()
+	if err != nil {
+		return nil, errs.New("unable to get the instance identity document: %v", err)
+	}
+
+	// Tags are not in the instance metadata by default
+	clusterName, err := client.GetMetadata("tags/instance/" + eksClusterNameTag)
+	if err != nil {
+		clusterName = ""
+	}
+
+	return &cloudContext{
+		Cluster:      clusterName,
+		AWSAccountID: doc.AccountID,
+	}, nil
+}
+
+// discoverAKSContext reads the tenant from the token of the managed identity
+// of the node, and the cluster name from the name of the node resource group
+// if it has the default name
+func discoverAKSContext(ctx context.Context, client azure.HTTPClient) (*cloudContext, error) {
+	token, err := azure.FetchMSIToken(ctx, client, azure.DefaultMSIResourceID)
+	if err != nil {
+		return nil, errs.New("unable to fetch the managed identity token: %v", err)
+	}
+	tenantID, err := msiTokenTenantID(token)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := azure.FetchInstanceMetadata(ctx, client)
+	if err != nil {
+		return nil, errs.New("unable to fetch the instance metadata: %v", err)
+	}
+
+	return &cloudContext{
+		Cluster:       aksClusterName(metadata.Compute.ResourceGroupName),
+		AzureTenantID: tenantID,
+	}, nil
+}
+
+// msiTokenTenantID returns the tenant of the managed identity token. The token
+// was just obtained from the instance metadata service, which is trusted, so
+// its signature is not verified.
+func msiTokenTenantID(token string) (string, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return "", errs.New("unable to parse the managed identity token: %v", err)
+	}
+	claims := new(azure.MSITokenClaims)
+	if err := parsed.UnsafeClaimsWithoutVerification(claims); err != nil {
+		return "", errs.New("unable to get the managed identity token claims: %v", err)
+	}
+	if claims.TenantID == "" {
+		return "", errs.New("the managed identity token has no tenant")
+	}
+	return claims.TenantID, nil
+}
+
+// aksClusterName returns the name of the cluster from the name of its node
+// resource group, or an empty string if the group doesn't have the default
+// name, or if the name is ambiguous because of underscores in the names of
+// the cluster or of its resource group
+func aksClusterName(nodeResourceGroup string) string {
+	if !strings.HasPrefix(nodeResourceGroup, aksNodeResourceGroupPrefix) {
+		return ""
+	}
+	parts := strings.Split(strings.TrimPrefix(nodeResourceGroup, aksNodeResourceGroupPrefix), "_")
+	if len(parts) != 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+// loadCloudContext discovers the context of the cluster when a cloud provider
+// is configured, and uses it for the cluster name unless one is configured
+func (c *CommonMode) loadCloudContext(ctx context.Context) error {
+	switch c.CloudProvider {
+	case "":
+		return nil
+	case cloudProviderGKE, cloudProviderEKS, cloudProviderAKS:
+	default:
+		return errs.New("invalid cloud_provider %q, valid values are %s, %s and %s", c.CloudProvider, cloudProviderGKE, cloudProviderEKS, cloudProviderAKS)
+	}
+
+	cc, err := discoverCloudContext(ctx, c.CloudProvider)
+	if err != nil {
+		return errs.New("unable to discover the %s cluster context: %v", c.CloudProvider, err)
+	}
+	c.cloudContext = cc
+	if c.Cluster == "" {
+		c.Cluster = cc.Cluster
+	}
+	return nil
+}
+
+// cloudContextHint returns a hint to add to the errors about settings that
+// may have been discovered from the cloud provider
+func (c *CommonMode) cloudContextHint() string {
+	if c.CloudProvider == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (it could not be discovered from the %s metadata)", c.CloudProvider)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spiffe/spire/pkg/common/plugin/azure"
+	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/controllers"
+	"github.com/spiffe/spire/test/spiretest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestDiscoverGKEContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+		if r.URL.Path != "/computeMetadata/v1/instance/attributes/cluster-name" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprint(w, "production\n")
+	}))
+	defer server.Close()
+
+	cc, err := discoverGKEContext(context.Background(), server.Client(), server.URL)
+	require.NoError(t, err)
+	require.Equal(t, &cloudContext{Cluster: "production"}, cc)
+
+	// Instances without the attribute are not GKE nodes
+	cc, err = discoverGKEContext(context.Background(), server.Client(), server.URL+"/other")
+	require.NoError(t, err)
+	require.Equal(t, &cloudContext{}, cc)
+}
+
+func TestDiscoverEKSContext(t *testing.T) {
+	tags := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			_, _ = fmt.Fprint(w, "token")
+		case r.URL.Path == "/latest/dynamic/instance-identity/document":
+			_, _ = fmt.Fprint(w, `{"accountId": "123456789012", "region": "us-east-1", "instanceId": "i-0123456789"}`)
+		case r.URL.Path == "/latest/meta-data/tags/instance/eks:cluster-name" && tags:
+			_, _ = fmt.Fprint(w, "production")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cc, err := discoverEKSContext(server.Client(), server.URL+"/latest")
+	require.NoError(t, err)
+	require.Equal(t, &cloudContext{Cluster: "production", AWSAccountID: "123456789012"}, cc)
+
+	// Tags are not available unless the instance metadata options allow them
+	tags = false
+	cc, err = discoverEKSContext(server.Client(), server.URL+"/latest")
+	require.NoError(t, err)
+	require.Equal(t, &cloudContext{AWSAccountID: "123456789012"}, cc)
+}
+
+func TestDiscoverAKSContext(t *testing.T) {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("key")}, nil)
+	require.NoError(t, err)
+	token, err := jwt.Signed(signer).Claims(azure.MSITokenClaims{TenantID: "TENANTID"}).CompactSerialize()
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.Header.Get("Metadata"))
+		switch r.URL.Path {
+		case "/metadata/identity/oauth2/token":
+			_ = json.NewEncoder(w).Encode(map[string]string{"access_token": token})
+		case "/metadata/instance":
+			_ = json.NewEncoder(w).Encode(azure.InstanceMetadata{
+				Compute: azure.ComputeMetadata{
+					Name:              "aks-nodepool1-12345678-vmss000000",
+					SubscriptionID:    "SUBSCRIPTIONID",
+					ResourceGroupName: "MC_rg_production_eastus",
+				},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// Requests to the instance metadata service are sent to the test server
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	client := azure.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		req.URL.Host = serverURL.Host
+		return server.Client().Do(req)
+	})
+
+	cc, err := discoverAKSContext(context.Background(), client)
+	require.NoError(t, err)
+	require.Equal(t, &cloudContext{Cluster: "production", AzureTenantID: "TENANTID"}, cc)
+}
+
+func TestAKSClusterName(t *testing.T) {
+	require.Equal(t, "production", aksClusterName("MC_rg_production_eastus"))
+	require.Empty(t, aksClusterName("custom-node-rg"))
+	require.Empty(t, aksClusterName("MC_my_rg_production_eastus"))
+}
+
+func TestLoadModeCloudContext(t *testing.T) {
+	var discoveredProvider string
+	cc := &cloudContext{
+		Cluster:       "discovered",
+		AWSAccountID:  "123456789012",
+		AzureTenantID: "TENANTID",
+	}
+	discoverCloudContextBefore := discoverCloudContext
+	discoverCloudContext = func(ctx context.Context, provider string) (*cloudContext, error) {
+		discoveredProvider = provider
+		return cc, nil
+	}
+	defer func() { discoverCloudContext = discoverCloudContextBefore }()
+
+	confPath := filepath.Join(spiretest.TempDir(t), "test.conf")
+	loadMode := func(config string) (Mode, error) {
+		require.NoError(t, os.WriteFile(confPath, []byte(`
+			trust_domain = "TRUSTDOMAIN"
+			server_socket_path = "SOCKETPATH"
+			mode = "crd"
+		`+config), 0600))
+		return LoadMode(confPath)
+	}
+
+	mode, err := loadMode(`
+		cloud_provider = "eks"
+		node_attestor = "aws_iid"
+	`)
+	require.NoError(t, err)
+	require.Equal(t, "eks", discoveredProvider)
+	crdMode := mode.(*CRDMode)
+	require.Equal(t, "discovered", crdMode.Cluster)
+	require.Equal(t, "123456789012", crdMode.nodeAttestorConfig().AWSAccountID)
+
+	// Configured values take precedence
+	mode, err = loadMode(`
+		cloud_provider = "aks"
+		cluster = "configured"
+		node_attestor = "azure_msi"
+		azure_tenant_id = "CONFIGURED"
+	`)
+	require.NoError(t, err)
+	crdMode = mode.(*CRDMode)
+	require.Equal(t, "configured", crdMode.Cluster)
+	require.Equal(t, controllers.NodeAttestorConfig{
+		Name:          controllers.NodeAttestorAzureMSI,
+		AzureTenantID: "CONFIGURED",
+	}, crdMode.nodeAttestorConfig())
+
+	cc = &cloudContext{}
+	_, err = loadMode(`cloud_provider = "gke"`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cluster must be specified (it could not be discovered from the gke metadata)")
+
+	_, err = loadMode(`cloud_provider = "openshift"`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid cloud_provider "openshift", valid values are gke, eks and aks`)
+}
@@ -3,18 +3,23 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/spiffe/go-spiffe/v2/logger"
+	agentv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/agent/v1"
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 
 	"github.com/hashicorp/hcl"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
 	"github.com/spiffe/go-spiffe/v2/workloadapi"
 	"github.com/spiffe/spire/pkg/common/log"
+	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/identity"
 	"github.com/zeebo/errs"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -43,12 +48,19 @@ type CommonMode struct {
 	ServerSocketPath   string   `hcl:"server_socket_path"`
 	AgentSocketPath    string   `hcl:"agent_socket_path"`
 	ServerAddress      string   `hcl:"server_address"`
+	RegistrarSpiffeID  string   `hcl:"registrar_spiffe_id"`
 	Cluster            string   `hcl:"cluster"`
+	CloudProvider      string   `hcl:"cloud_provider"`
 	PodLabel           string   `hcl:"pod_label"`
 	PodAnnotation      string   `hcl:"pod_annotation"`
 	Mode               string   `hcl:"mode"`
 	DisabledNamespaces []string `hcl:"disabled_namespaces"`
-	serverAPI          ServerAPIClients
+	// MaxSpiffeIDLength and MaxSpiffeIDPathDepth, if set, limit the SPIFFE
+	// IDs assigned to pods in the crd and webhook modes
+	MaxSpiffeIDLength    int `hcl:"max_spiffe_id_length"`
+	MaxSpiffeIDPathDepth int `hcl:"max_spiffe_id_path_depth"`
+	serverAPI            ServerAPIClients
+	cloudContext         *cloudContext
 }
 
 func (c *CommonMode) ParseConfig(hclConfig string) error {
@@ -67,14 +79,34 @@ func (c *CommonMode) ParseConfig(hclConfig string) error {
 			return errs.New("server_address or server_socket_path must be specified")
 		}
 	}
-	if !strings.HasPrefix(c.ServerAddress, "unix://") && c.AgentSocketPath == "" {
-		return errs.New("agent_socket_path must be specified if the server is not a local socket")
+	if !strings.HasPrefix(c.ServerAddress, "unix://") {
+		if c.AgentSocketPath == "" {
+			return errs.New("agent_socket_path must be specified if the server is not a local socket")
+		}
+		// Addresses with a gRPC naming scheme, e.g. dns:///, are resolved
+		// by gRPC as is
+		if !strings.Contains(c.ServerAddress, "://") {
+			if err := validateHostPort("server_address", c.ServerAddress); err != nil {
+				return err
+			}
+		}
 	}
 	if c.TrustDomain == "" {
 		return errs.New("trust_domain must be specified")
 	}
+	if c.RegistrarSpiffeID != "" {
+		if strings.HasPrefix(c.ServerAddress, "unix://") {
+			return errs.New("registrar_spiffe_id can only be specified if the server is not a local socket")
+		}
+		if err := validateRegistrarID(c.RegistrarSpiffeID, c.TrustDomain); err != nil {
+			return err
+		}
+	}
+	if err := c.loadCloudContext(context.Background()); err != nil {
+		return err
+	}
 	if c.Cluster == "" {
-		return errs.New("cluster must be specified")
+		return errs.New("cluster must be specified%s", c.cloudContextHint())
 	}
 	if c.PodLabel != "" && c.PodAnnotation != "" {
 		return errs.New("workload registration mode specification is incorrect, can't specify both pod_label and pod_annotation")
@@ -82,6 +114,12 @@ func (c *CommonMode) ParseConfig(hclConfig string) error {
 	if c.Mode != modeCRD && c.Mode != modeWebhook && c.Mode != modeReconcile {
 		return errs.New("invalid mode \"%s\", valid values are %s, %s and %s", c.Mode, modeCRD, modeWebhook, modeReconcile)
 	}
+	if c.MaxSpiffeIDLength < 0 || c.MaxSpiffeIDLength > identity.MaxIDLength {
+		return errs.New("max_spiffe_id_length must be between 0 and %d", identity.MaxIDLength)
+	}
+	if c.MaxSpiffeIDPathDepth < 0 {
+		return errs.New("max_spiffe_id_path_depth must not be negative")
+	}
 	if c.DisabledNamespaces == nil {
 		c.DisabledNamespaces = defaultDisabledNamespaces()
 	}
@@ -89,6 +127,32 @@ func (c *CommonMode) ParseConfig(hclConfig string) error {
 	return nil
 }
 
+// validateHostPort checks that the address is in the host:port format, which
+// requires IPv6 literals to be enclosed in brackets
+func validateHostPort(name, address string) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return errs.New("invalid %s %q: %v, IPv6 addresses must be enclosed in brackets, e.g. \"[fd00::1]:8081\"", name, address, err)
+	}
+	return nil
+}
+
+// validateRegistrarID checks that the SPIFFE ID of the registrar is a member
+// of the trust domain
+func validateRegistrarID(registrarID, trustDomain string) error {
+	id, err := spiffeid.FromString(registrarID)
+	if err != nil {
+		return errs.New("invalid registrar_spiffe_id %q: %v", registrarID, err)
+	}
+	td, err := spiffeid.TrustDomainFromString(trustDomain)
+	if err != nil {
+		return errs.New("invalid trust_domain %q: %v", trustDomain, err)
+	}
+	if !id.MemberOf(td) {
+		return errs.New("registrar_spiffe_id %q is not a member of trust domain %q", registrarID, trustDomain)
+	}
+	return nil
+}
+
 func defaultDisabledNamespaces() []string {
 	return []string{metav1.NamespaceSystem, metav1.NamespacePublic}
 }
@@ -98,7 +162,20 @@ func (c *CommonMode) SetupLogger() (*log.Logger, error) {
 }
 
 func (c *CommonMode) EntryClient(ctx context.Context, dialLogger logger.Logger) (entryv1.EntryClient, error) {
-	return c.serverAPI.EntryClient(ctx, dialLogger, c.ServerAddress, c.AgentSocketPath)
+	return c.serverAPI.EntryClient(ctx, dialLogger, c.serverAPIConfig())
+}
+
+func (c *CommonMode) AgentClient(ctx context.Context, dialLogger logger.Logger) (agentv1.AgentClient, error) {
+	return c.serverAPI.AgentClient(ctx, dialLogger, c.serverAPIConfig())
+}
+
+func (c *CommonMode) serverAPIConfig() ServerAPIConfig {
+	return ServerAPIConfig{
+		ServerAddress:     c.ServerAddress,
+		AgentSocketPath:   c.AgentSocketPath,
+		TrustDomain:       c.TrustDomain,
+		RegistrarSpiffeID: c.RegistrarSpiffeID,
+	}
 }
 
 func (c *CommonMode) Close() error {
@@ -136,49 +213,118 @@ func LoadMode(path string) (Mode, error) {
 	return mode, err
 }
 
+// ServerAPIConfig configures how the registrar connects to the server
+type ServerAPIConfig struct {
+	ServerAddress     string
+	AgentSocketPath   string
+	TrustDomain       string
+	RegistrarSpiffeID string
+}
+
 type ServerAPIClients struct {
 	serverConn   *grpc.ClientConn
 	workloadConn *workloadapi.X509Source
 }
 
-func (r *ServerAPIClients) dial(ctx context.Context, dialLog logger.Logger, serverAddress string, agentSocketPath string) error {
-	var conn *grpc.ClientConn
-	var err error
-
-	if strings.HasPrefix(serverAddress, "unix://") {
-		dialLog.Infof("Connecting to local registration server socket %s", serverAddress)
-		conn, err = grpc.DialContext(ctx, serverAddress, grpc.WithInsecure())
-		if err != nil {
-			return err
-		}
-	} else {
-		dialLog.Infof("Connecting to remote registration server %s with credentials from agent socket %s", serverAddress, agentSocketPath)
-		source, err := workloadapi.NewX509Source(ctx, workloadapi.WithClientOptions(workloadapi.WithAddr("unix://"+agentSocketPath), workloadapi.WithLogger(dialLog)))
-		r.workloadConn = source
+func (r *ServerAPIClients) dial(ctx context.Context, dialLog logger.Logger, config ServerAPIConfig) error {
+	if strings.HasPrefix(config.ServerAddress, "unix://") {
+		dialLog.Infof("Connecting to local registration server socket %s", config.ServerAddress)
+		conn, err := grpc.DialContext(ctx, config.ServerAddress, grpc.WithInsecure())
 		if err != nil {
 			return err
 		}
+		r.serverConn = conn
+		return nil
+	}
 
-		tlsConfig := tlsconfig.MTLSClientConfig(source, source, tlsconfig.AuthorizeAny())
-		conn, err = grpc.DialContext(ctx, serverAddress, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	td, err := spiffeid.TrustDomainFromString(config.TrustDomain)
+	if err != nil {
+		return err
+	}
+	var registrarID spiffeid.ID
+	if config.RegistrarSpiffeID != "" {
+		registrarID, err = spiffeid.FromString(config.RegistrarSpiffeID)
 		if err != nil {
 			return err
 		}
 	}
-	r.serverConn = conn
 
+	// The X509 source keeps the identity of the registrar rotated, and
+	// reconnects to the agent when the Workload API connection is lost. New
+	// connections to the server are authenticated with the current SVID.
+	dialLog.Infof("Connecting to remote registration server %s with credentials from agent socket %s", config.ServerAddress, config.AgentSocketPath)
+	sourceOptions := []workloadapi.X509SourceOption{
+		workloadapi.WithClientOptions(workloadapi.WithAddr("unix://"+config.AgentSocketPath), workloadapi.WithLogger(dialLog)),
+	}
+	if !registrarID.IsZero() {
+		sourceOptions = append(sourceOptions, workloadapi.WithDefaultX509SVIDPicker(registrarSVIDPicker(dialLog, registrarID)))
+	}
+	source, err := workloadapi.NewX509Source(ctx, sourceOptions...)
+	if err != nil {
+		return err
+	}
+
+	// Only the SPIRE server of the trust domain is trusted with the admin
+	// credentials of the registrar
+	tlsConfig := tlsconfig.MTLSClientConfig(source, source, tlsconfig.AuthorizeID(td.NewID("/spire/server")))
+	conn, err := grpc.DialContext(ctx, config.ServerAddress, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	if err != nil {
+		source.Close()
+		return err
+	}
+	go watchRegistrarIdentity(ctx, dialLog, source)
+
+	r.workloadConn = source
+	r.serverConn = conn
 	return nil
 }
 
-func (r *ServerAPIClients) EntryClient(ctx context.Context, dialLog logger.Logger, serverAddress string, agentSocketPath string) (entryv1.EntryClient, error) {
+// registrarSVIDPicker returns a picker of the SVID with the SPIFFE ID of the
+// registrar, out of the SVIDs of the pod
+func registrarSVIDPicker(log logger.Logger, registrarID spiffeid.ID) func([]*x509svid.SVID) *x509svid.SVID {
+	return func(svids []*x509svid.SVID) *x509svid.SVID {
+		for _, svid := range svids {
+			if svid.ID == registrarID {
+				return svid
+			}
+		}
+		log.Errorf("The agent returned no SVID for the registrar identity %s; check its admin registration entry", registrarID)
+		return nil
+	}
+}
+
+// watchRegistrarIdentity logs the rotations of the identity of the registrar
+func watchRegistrarIdentity(ctx context.Context, log logger.Logger, source *workloadapi.X509Source) {
+	for {
+		if svid, err := source.GetX509SVID(); err == nil {
+			log.Infof("Using registrar identity %s, valid until %s", svid.ID, svid.Certificates[0].NotAfter)
+		}
+		select {
+		case <-source.Updated():
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *ServerAPIClients) EntryClient(ctx context.Context, dialLog logger.Logger, config ServerAPIConfig) (entryv1.EntryClient, error) {
 	if r.serverConn == nil {
-		if err := r.dial(ctx, dialLog, serverAddress, agentSocketPath); err != nil {
+		if err := r.dial(ctx, dialLog, config); err != nil {
 			return nil, err
 		}
 	}
 	return entryv1.NewEntryClient(r.serverConn), nil
 }
 
+func (r *ServerAPIClients) AgentClient(ctx context.Context, dialLog logger.Logger, config ServerAPIConfig) (agentv1.AgentClient, error) {
+	if r.serverConn == nil {
+		if err := r.dial(ctx, dialLog, config); err != nil {
+			return nil, err
+		}
+	}
+	return agentv1.NewAgentClient(r.serverConn), nil
+}
+
 func (r *ServerAPIClients) Close() error {
 	var group errs.Group
 	if r.serverConn != nil {
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"math"
 	"os"
+	"time"
 
 	"github.com/hashicorp/hcl"
 	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
@@ -23,13 +25,47 @@ const (
 
 type CRDMode struct {
 	CommonMode
-	AddSvcDNSName   bool   `hcl:"add_svc_dns_name"`
-	LeaderElection  bool   `hcl:"leader_election"`
-	MetricsBindAddr string `hcl:"metrics_bind_addr"`
-	PodController   bool   `hcl:"pod_controller"`
-	WebhookEnabled  bool   `hcl:"webhook_enabled"`
-	WebhookCertDir  string `hcl:"webhook_cert_dir"`
-	WebhookPort     int    `hcl:"webhook_port"`
+	AddSvcDNSName            bool    `hcl:"add_svc_dns_name"`
+	ContainerIdentities      bool    `hcl:"container_identities"`
+	EntryBudgetAction        string  `hcl:"entry_budget_action"`
+	EntryBudgetDeviation     float64 `hcl:"entry_budget_deviation"`
+	FederationPolicies       bool    `hcl:"federation_policies"`
+	GroupLabel               string  `hcl:"group_label"`
+	IdentityCollisionPolicy  string  `hcl:"identity_collision_policy"`
+	IdentityReadinessGate    bool    `hcl:"identity_readiness_gate"`
+	IdentityPropagationDelay string  `hcl:"identity_propagation_delay"`
+	LeaderElection           bool    `hcl:"leader_election"`
+	ManagedEntriesOnly       bool    `hcl:"managed_entries_only"`
+	MaxEntriesPerNode        int     `hcl:"max_entries_per_node"`
+	MaxSVIDTTL               string  `hcl:"max_svid_ttl"`
+	MetricsBindAddr          string  `hcl:"metrics_bind_addr"`
+	NodeAttestor             string  `hcl:"node_attestor"`
+	AgentPathTemplate        string  `hcl:"agent_path_template"`
+	AWSAccountID             string  `hcl:"aws_account_id"`
+	AzureTenantID            string  `hcl:"azure_tenant_id"`
+	AzurePrincipalID         string  `hcl:"azure_principal_id"`
+	PodConcurrentReconciles  int     `hcl:"pod_concurrent_reconciles"`
+	PodController            bool    `hcl:"pod_controller"`
+	PodDNSName               bool    `hcl:"pod_dns_name"`
+	PodDNSNameTemplate       string  `hcl:"pod_dns_name_template"`
+	PodRequeueQPS            float64 `hcl:"pod_requeue_qps"`
+	PodRequeueBurst          int     `hcl:"pod_requeue_burst"`
+	RegistrarConfigName      string  `hcl:"registrar_config_name"`
+	SpiffeIDBatchSize        int     `hcl:"spiffeid_batch_size"`
+	SpiffeIDBatchInterval    string  `hcl:"spiffeid_batch_interval"`
+	SpiffeIDDriftPolicy      string  `hcl:"spiffeid_drift_policy"`
+	WebhookEnabled           bool    `hcl:"webhook_enabled"`
+	WebhookCertDir           string  `hcl:"webhook_cert_dir"`
+	WebhookPort              int     `hcl:"webhook_port"`
+	NodeGCGracePeriod        string  `hcl:"node_gc_grace_period"`
+	NodeGCAction             string  `hcl:"node_gc_action"`
+	OrphanedEntrySweep       string  `hcl:"orphaned_entry_sweep"`
+	TerminatingPodSVIDTTL    string  `hcl:"terminating_pod_svid_ttl"`
+	identityPropagationDelay time.Duration
+	maxSVIDTTL               time.Duration
+	nodeGCGracePeriod        time.Duration
+	spiffeIDBatchInterval    time.Duration
+	terminatingPodSVIDTTL    time.Duration
 }
 
 func (c *CRDMode) ParseConfig(hclConfig string) error {
@@ -42,6 +78,97 @@ func (c *CRDMode) ParseConfig(hclConfig string) error {
 	if c.MetricsBindAddr == "" {
 		c.MetricsBindAddr = defaultMetricsBindAddr
 	}
+	// "0" disables metrics
+	if c.MetricsBindAddr != "0" {
+		if err := validateHostPort("metrics_bind_addr", c.MetricsBindAddr); err != nil {
+			return err
+		}
+	}
+
+	switch c.IdentityCollisionPolicy {
+	case "":
+		c.IdentityCollisionPolicy = controllers.IdentityCollisionPolicyShare
+	case controllers.IdentityCollisionPolicyShare, controllers.IdentityCollisionPolicyReject, controllers.IdentityCollisionPolicySuffix:
+	default:
+		return errs.New("invalid identity_collision_policy %q, valid values are %s, %s and %s", c.IdentityCollisionPolicy,
+			controllers.IdentityCollisionPolicyShare, controllers.IdentityCollisionPolicyReject, controllers.IdentityCollisionPolicySuffix)
+	}
+
+	switch c.SpiffeIDDriftPolicy {
+	case "":
+		c.SpiffeIDDriftPolicy = controllers.SpecDriftPolicyRevert
+	case controllers.SpecDriftPolicyRevert, controllers.SpecDriftPolicyAccept, controllers.SpecDriftPolicyFlag:
+	default:
+		return errs.New("invalid spiffeid_drift_policy %q, valid values are %s, %s and %s", c.SpiffeIDDriftPolicy,
+			controllers.SpecDriftPolicyRevert, controllers.SpecDriftPolicyAccept, controllers.SpecDriftPolicyFlag)
+	}
+
+	if c.cloudContext != nil {
+		if c.AWSAccountID == "" {
+			c.AWSAccountID = c.cloudContext.AWSAccountID
+		}
+		if c.AzureTenantID == "" {
+			c.AzureTenantID = c.cloudContext.AzureTenantID
+		}
+	}
+
+	if err := c.validateNodeAttestor(); err != nil {
+		return err
+	}
+
+	if err := c.validateNodeGC(); err != nil {
+		return err
+	}
+
+	switch c.OrphanedEntrySweep {
+	case "":
+	case controllers.EntrySweepReport, controllers.EntrySweepPrune:
+		if c.NodeAttestor != controllers.NodeAttestorK8sPSAT {
+			return errs.New("orphaned_entry_sweep is only supported when node_attestor is %q", controllers.NodeAttestorK8sPSAT)
+		}
+	default:
+		return errs.New("invalid orphaned_entry_sweep %q, valid values are %s and %s", c.OrphanedEntrySweep,
+			controllers.EntrySweepReport, controllers.EntrySweepPrune)
+	}
+
+	if err := c.validateEntryBudget(); err != nil {
+		return err
+	}
+
+	if err := c.validatePodRateLimits(); err != nil {
+		return err
+	}
+
+	if c.IdentityPropagationDelay != "" {
+		delay, err := time.ParseDuration(c.IdentityPropagationDelay)
+		if err != nil {
+			return errs.New("invalid identity_propagation_delay %q: %v", c.IdentityPropagationDelay, err)
+		}
+		if delay <= 0 {
+			return errs.New("identity_propagation_delay must be positive")
+		}
+		c.identityPropagationDelay = delay
+	}
+
+	var err error
+	if c.maxSVIDTTL, err = parseSVIDTTL("max_svid_ttl", c.MaxSVIDTTL); err != nil {
+		return err
+	}
+	if c.terminatingPodSVIDTTL, err = parseSVIDTTL("terminating_pod_svid_ttl", c.TerminatingPodSVIDTTL); err != nil {
+		return err
+	}
+
+	if _, err := controllers.ParsePodDNSNameTemplate(c.PodDNSNameTemplate); err != nil {
+		return errs.New("invalid pod_dns_name_template: %v", err)
+	}
+
+	if c.RegistrarConfigName != "" && !c.PodController {
+		return errs.New("registrar_config_name requires pod_controller to be enabled")
+	}
+
+	if c.FederationPolicies && !c.PodController {
+		return errs.New("federation_policies requires pod_controller to be enabled")
+	}
 
 	if c.WebhookCertDir == "" {
 		c.WebhookCertDir = defaultWebhookCertDir
@@ -78,12 +205,17 @@ func (c *CRDMode) Run(ctx context.Context) error {
 
 	log.Info("Initializing SPIFFE ID CRD Mode")
 	err = controllers.NewSpiffeIDReconciler(controllers.SpiffeIDReconcilerConfig{
-		Client:      mgr.GetClient(),
-		Cluster:     c.Cluster,
-		Ctx:         ctx,
-		Log:         log,
-		E:           entryClient,
-		TrustDomain: c.TrustDomain,
+		Client:             mgr.GetClient(),
+		Cluster:            c.Cluster,
+		Ctx:                ctx,
+		Log:                log,
+		E:                  entryClient,
+		ManagedEntriesOnly: c.ManagedEntriesOnly,
+		MaxTTL:             c.maxSVIDTTL,
+		TrustDomain:        c.TrustDomain,
+
+		IdentityReadinessGate:    c.IdentityReadinessGate,
+		IdentityPropagationDelay: c.identityPropagationDelay,
 	}).SetupWithManager(mgr)
 	if err != nil {
 		return err
@@ -103,7 +235,9 @@ func (c *CRDMode) Run(ctx context.Context) error {
 		}
 	}
 
-	if c.PodController {
+	if c.PodController && c.NodeAttestor == controllers.NodeAttestorK8sPSAT {
+		// Node alias entries are only needed when agents are attested with k8s_psat,
+		// otherwise pod entries are parented directly to the agent ID
 		err = controllers.NewNodeReconciler(controllers.NodeReconcilerConfig{
 			Client:      mgr.GetClient(),
 			Cluster:     c.Cluster,
@@ -116,17 +250,114 @@ func (c *CRDMode) Run(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
-		err = controllers.NewPodReconciler(controllers.PodReconcilerConfig{
-			Client:             mgr.GetClient(),
-			Cluster:            c.Cluster,
-			Ctx:                ctx,
-			DisabledNamespaces: c.DisabledNamespaces,
-			Log:                log,
-			PodLabel:           c.PodLabel,
-			PodAnnotation:      c.PodAnnotation,
-			Scheme:             mgr.GetScheme(),
-			TrustDomain:        c.TrustDomain,
-		}).SetupWithManager(mgr)
+	}
+
+	var entryBudget *controllers.EntryBudget
+	if c.EntryBudgetAction != "" {
+		entryBudget = controllers.NewEntryBudget(controllers.EntryBudgetConfig{
+			Action:            c.EntryBudgetAction,
+			Client:            mgr.GetClient(),
+			Ctx:               ctx,
+			Deviation:         c.EntryBudgetDeviation,
+			Log:               log,
+			MaxEntriesPerNode: c.MaxEntriesPerNode,
+		})
+		if err := mgr.Add(entryBudget); err != nil {
+			return err
+		}
+	}
+
+	if c.PodController {
+		podReconciler := controllers.NewPodReconciler(controllers.PodReconcilerConfig{
+			Client:                  mgr.GetClient(),
+			Cluster:                 c.Cluster,
+			ContainerIdentities:     c.ContainerIdentities,
+			CreateBatchSize:         c.SpiffeIDBatchSize,
+			CreateBatchInterval:     c.spiffeIDBatchInterval,
+			Ctx:                     ctx,
+			DisabledNamespaces:      c.DisabledNamespaces,
+			EntryBudget:             entryBudget,
+			EventRecorder:           mgr.GetEventRecorderFor("k8s-workload-registrar"),
+			FederationPolicies:      c.FederationPolicies,
+			GroupLabel:              c.GroupLabel,
+			IdentityCollisionPolicy: c.IdentityCollisionPolicy,
+			Log:                     log,
+			MaxSpiffeIDLength:       c.MaxSpiffeIDLength,
+			MaxSpiffeIDPathDepth:    c.MaxSpiffeIDPathDepth,
+			MaxConcurrentReconciles: c.PodConcurrentReconciles,
+			NodeAttestor:            c.nodeAttestorConfig(),
+			PodLabel:                c.PodLabel,
+			PodAnnotation:           c.PodAnnotation,
+			PodDNSName:              c.PodDNSName,
+			PodDNSNameTemplate:      c.PodDNSNameTemplate,
+			RequeueQPS:              c.PodRequeueQPS,
+			RequeueBurst:            c.PodRequeueBurst,
+			RuntimeConfig:           c.RegistrarConfigName != "",
+			Scheme:                  mgr.GetScheme(),
+			SpecDriftPolicy:         c.SpiffeIDDriftPolicy,
+			TerminatingPodTTL:       c.terminatingPodSVIDTTL,
+			TrustDomain:             c.TrustDomain,
+		})
+		if err := podReconciler.SetupWithManager(mgr); err != nil {
+			return err
+		}
+
+		if c.RegistrarConfigName != "" {
+			err = controllers.NewRegistrarConfigReconciler(controllers.RegistrarConfigReconcilerConfig{
+				Client:        mgr.GetClient(),
+				Ctx:           ctx,
+				Log:           log,
+				Name:          c.RegistrarConfigName,
+				Namespace:     myNamespace,
+				PodReconciler: podReconciler,
+			}).SetupWithManager(mgr)
+			if err != nil {
+				return err
+			}
+		}
+
+		if c.FederationPolicies {
+			err = controllers.NewFederationPolicyReconciler(controllers.FederationPolicyReconcilerConfig{
+				Client:      mgr.GetClient(),
+				Ctx:         ctx,
+				Log:         log,
+				TrustDomain: c.TrustDomain,
+			}).SetupWithManager(mgr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.nodeGCGracePeriod > 0 {
+		agentClient, err := c.AgentClient(ctx, log)
+		if err != nil {
+			return errs.New("failed to dial server: %v", err)
+		}
+		err = mgr.Add(controllers.NewAgentGarbageCollector(controllers.AgentGarbageCollectorConfig{
+			Action:      c.NodeGCAction,
+			AgentClient: agentClient,
+			Client:      mgr.GetClient(),
+			Cluster:     c.Cluster,
+			Ctx:         ctx,
+			GracePeriod: c.nodeGCGracePeriod,
+			Log:         log,
+		}))
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.OrphanedEntrySweep != "" {
+		err = mgr.Add(controllers.NewEntrySweeper(controllers.EntrySweeperConfig{
+			Action:      c.OrphanedEntrySweep,
+			Client:      mgr.GetClient(),
+			Cluster:     c.Cluster,
+			Ctx:         ctx,
+			E:           entryClient,
+			Log:         log,
+			TrustDomain: c.TrustDomain,
+		}))
 		if err != nil {
 			return err
 		}
@@ -149,6 +380,143 @@ func (c *CRDMode) Run(ctx context.Context) error {
 	return mgr.Start(ctrl.SetupSignalHandler())
 }
 
+func (c *CRDMode) validateNodeGC() error {
+	if c.NodeGCGracePeriod == "" {
+		return nil
+	}
+
+	gracePeriod, err := time.ParseDuration(c.NodeGCGracePeriod)
+	if err != nil {
+		return errs.New("invalid node_gc_grace_period %q: %v", c.NodeGCGracePeriod, err)
+	}
+	if gracePeriod <= 0 {
+		return errs.New("node_gc_grace_period must be positive")
+	}
+	if c.NodeAttestor != controllers.NodeAttestorK8sPSAT {
+		return errs.New("node_gc_grace_period is only supported when node_attestor is %q", controllers.NodeAttestorK8sPSAT)
+	}
+	switch c.NodeGCAction {
+	case "":
+		c.NodeGCAction = controllers.AgentGCActionDelete
+	case controllers.AgentGCActionDelete, controllers.AgentGCActionBan:
+	default:
+		return errs.New("invalid node_gc_action %q, valid values are %s and %s", c.NodeGCAction,
+			controllers.AgentGCActionDelete, controllers.AgentGCActionBan)
+	}
+	c.nodeGCGracePeriod = gracePeriod
+	return nil
+}
+
+func (c *CRDMode) validatePodRateLimits() error {
+	if c.PodConcurrentReconciles < 0 {
+		return errs.New("pod_concurrent_reconciles cannot be negative")
+	}
+	if c.PodRequeueQPS < 0 {
+		return errs.New("pod_requeue_qps cannot be negative")
+	}
+	if c.PodRequeueBurst < 0 {
+		return errs.New("pod_requeue_burst cannot be negative")
+	}
+	if c.SpiffeIDBatchSize < 0 {
+		return errs.New("spiffeid_batch_size cannot be negative")
+	}
+
+	if c.SpiffeIDBatchInterval == "" {
+		return nil
+	}
+	if c.SpiffeIDBatchSize == 0 {
+		return errs.New("spiffeid_batch_interval requires spiffeid_batch_size")
+	}
+	interval, err := time.ParseDuration(c.SpiffeIDBatchInterval)
+	if err != nil {
+		return errs.New("invalid spiffeid_batch_interval %q: %v", c.SpiffeIDBatchInterval, err)
+	}
+	if interval <= 0 {
+		return errs.New("spiffeid_batch_interval must be positive")
+	}
+	c.spiffeIDBatchInterval = interval
+	return nil
+}
+
+func (c *CRDMode) validateEntryBudget() error {
+	if c.MaxEntriesPerNode < 0 {
+		return errs.New("max_entries_per_node cannot be negative")
+	}
+	if c.EntryBudgetDeviation != 0 && c.EntryBudgetDeviation <= 1 {
+		return errs.New("entry_budget_deviation must be greater than 1")
+	}
+
+	switch c.EntryBudgetAction {
+	case "":
+		if c.MaxEntriesPerNode > 0 || c.EntryBudgetDeviation > 0 {
+			c.EntryBudgetAction = controllers.EntryBudgetReport
+		}
+		return nil
+	case controllers.EntryBudgetReport, controllers.EntryBudgetThrottle:
+	default:
+		return errs.New("invalid entry_budget_action %q, valid values are %s and %s", c.EntryBudgetAction,
+			controllers.EntryBudgetReport, controllers.EntryBudgetThrottle)
+	}
+	if c.MaxEntriesPerNode == 0 && c.EntryBudgetDeviation == 0 {
+		return errs.New("entry_budget_action requires max_entries_per_node or entry_budget_deviation")
+	}
+	return nil
+}
+
+// parseSVIDTTL parses an optional SVID TTL setting, which must be a whole
+// number of seconds that fits in a registration entry TTL
+func parseSVIDTTL(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errs.New("invalid %s %q: %v", name, value, err)
+	}
+	if ttl < time.Second || ttl > math.MaxInt32*time.Second {
+		return 0, errs.New("%s must be between 1s and %v", name, math.MaxInt32*time.Second)
+	}
+	return ttl, nil
+}
+
+func (c *CRDMode) validateNodeAttestor() error {
+	if c.NodeAttestor == "" {
+		c.NodeAttestor = controllers.NodeAttestorK8sPSAT
+	}
+
+	switch c.NodeAttestor {
+	case controllers.NodeAttestorK8sPSAT:
+		return nil
+	case controllers.NodeAttestorAWSIID:
+		if c.AWSAccountID == "" && c.AgentPathTemplate == "" {
+			return errs.New("aws_account_id must be specified when node_attestor is %q%s", c.NodeAttestor, c.cloudContextHint())
+		}
+	case controllers.NodeAttestorGCPIIT:
+	case controllers.NodeAttestorAzureMSI:
+		if c.AzureTenantID == "" && c.AgentPathTemplate == "" {
+			return errs.New("azure_tenant_id must be specified when node_attestor is %q%s", c.NodeAttestor, c.cloudContextHint())
+		}
+	default:
+		return errs.New("invalid node_attestor %q, valid values are %s, %s, %s and %s", c.NodeAttestor,
+			controllers.NodeAttestorK8sPSAT, controllers.NodeAttestorAWSIID, controllers.NodeAttestorGCPIIT, controllers.NodeAttestorAzureMSI)
+	}
+
+	if _, err := c.nodeAttestorConfig().ParseAgentPathTemplate(); err != nil {
+		return errs.New("invalid agent_path_template: %v", err)
+	}
+	return nil
+}
+
+func (c *CRDMode) nodeAttestorConfig() controllers.NodeAttestorConfig {
+	return controllers.NodeAttestorConfig{
+		Name:              c.NodeAttestor,
+		AgentPathTemplate: c.AgentPathTemplate,
+		AWSAccountID:      c.AWSAccountID,
+		AzureTenantID:     c.AzureTenantID,
+		AzurePrincipalID:  c.AzurePrincipalID,
+	}
+}
+
 func getNamespace() (string, error) {
 	content, err := os.ReadFile(namespaceFile)
 	if err != nil {
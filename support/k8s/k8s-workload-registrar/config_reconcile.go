@@ -10,6 +10,8 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/hashicorp/hcl"
 
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
@@ -35,6 +37,10 @@ type ReconcileMode struct {
 	ControllerName string `hcl:"controller_name"`
 	AddPodDNSNames bool   `hcl:"add_pod_dns_names"`
 	ClusterDNSZone string `hcl:"cluster_dns_zone"`
+	// PodLabelSelector and PodFieldSelector restrict the pods watched by
+	// the registrar
+	PodLabelSelector string `hcl:"pod_label_selector"`
+	PodFieldSelector string `hcl:"pod_field_selector"`
 }
 
 func (c *ReconcileMode) ParseConfig(hclConfig string) error {
@@ -45,12 +51,24 @@ func (c *ReconcileMode) ParseConfig(hclConfig string) error {
 	if c.MetricsAddr == "" {
 		c.MetricsAddr = defaultMetricsAddr
 	}
+	// "0" disables metrics
+	if c.MetricsAddr != "0" {
+		if err := validateHostPort("metrics_addr", c.MetricsAddr); err != nil {
+			return err
+		}
+	}
 	if c.ControllerName == "" {
 		c.ControllerName = defaultControllerName
 	}
 	if c.ClusterDNSZone == "" {
 		c.ClusterDNSZone = defaultClusterDNSZone
 	}
+	if _, err := labels.Parse(c.PodLabelSelector); err != nil {
+		return errs.New("invalid pod_label_selector %q: %v", c.PodLabelSelector, err)
+	}
+	if _, err := fields.ParseSelector(c.PodFieldSelector); err != nil {
+		return errs.New("invalid pod_field_selector %q: %v", c.PodFieldSelector, err)
+	}
 
 	return nil
 }
@@ -79,12 +97,21 @@ func (c *ReconcileMode) Run(ctx context.Context) error {
 	_ = clientgoscheme.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	options := ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: c.MetricsAddr,
 		LeaderElection:     c.LeaderElection,
 		LeaderElectionID:   fmt.Sprintf("%s-leader-election", c.ControllerName),
-	})
+	}
+	if c.PodLabelSelector != "" || c.PodFieldSelector != "" {
+		options.NewCache, err = controllers.NewPodCacheFunc(c.PodLabelSelector, c.PodFieldSelector)
+		if err != nil {
+			setupLog.Error(err, "Unable to set up pod cache")
+			return err
+		}
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "Unable to start manager")
 		return err
@@ -118,6 +145,7 @@ func (c *ReconcileMode) Run(ctx context.Context) error {
 		ctrl.Log.WithName("controllers").WithName("Pod"),
 		mgr.GetScheme(),
 		c.TrustDomain,
+		c.Cluster,
 		rootID,
 		spireClient,
 		mode,
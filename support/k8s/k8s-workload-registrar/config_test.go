@@ -4,7 +4,12 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/spiffe/go-spiffe/v2/logger"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/controllers"
 	"github.com/spiffe/spire/test/spiretest"
 	"github.com/stretchr/testify/require"
 )
@@ -44,10 +49,12 @@ func TestLoadMode(t *testing.T) {
 			Mode:               "webhook",
 			DisabledNamespaces: []string{"kube-system", "kube-public"},
 		},
-		Addr:       ":8443",
-		CertPath:   defaultCertPath,
-		KeyPath:    defaultKeyPath,
-		CaCertPath: defaultCaCertPath,
+		Addr:                   ":8443",
+		CertPath:               defaultCertPath,
+		KeyPath:                defaultKeyPath,
+		CaCertPath:             defaultCaCertPath,
+		FailurePolicy:          FailurePolicyFail,
+		circuitBreakerCooldown: defaultCircuitBreakerCooldown,
 	}, config)
 
 	testCases := []struct {
@@ -74,6 +81,8 @@ func TestLoadMode(t *testing.T) {
 				KeyPath:                        defaultKeyPath,
 				CaCertPath:                     defaultCaCertPath,
 				InsecureSkipClientVerification: false,
+				FailurePolicy:                  FailurePolicyFail,
+				circuitBreakerCooldown:         defaultCircuitBreakerCooldown,
 			},
 		},
 		{
@@ -86,6 +95,9 @@ func TestLoadMode(t *testing.T) {
 				key_path = "KEYOVERRIDE"
 				cacert_path = "CACERTOVERRIDE"
 				insecure_skip_client_verification = true
+				failure_policy = "ignore"
+				circuit_breaker_threshold = 3
+				circuit_breaker_cooldown = "1m"
 				server_socket_path = "SOCKETPATHOVERRIDE"
 				trust_domain = "TRUSTDOMAINOVERRIDE"
 				cluster = "CLUSTEROVERRIDE"
@@ -108,8 +120,69 @@ func TestLoadMode(t *testing.T) {
 				KeyPath:                        "KEYOVERRIDE",
 				CaCertPath:                     "CACERTOVERRIDE",
 				InsecureSkipClientVerification: true,
+				FailurePolicy:                  FailurePolicyIgnore,
+				CircuitBreakerThreshold:        3,
+				CircuitBreakerCooldown:         "1m",
+				circuitBreakerCooldown:         time.Minute,
 			},
 		},
+		{
+			name: "registrar identity",
+			in: `
+				trust_domain = "example.org"
+				cluster = "CLUSTER"
+				server_address = "dns:///spire-server:8081"
+				agent_socket_path = "AGENTSOCKETPATH"
+				registrar_spiffe_id = "spiffe://example.org/registrar"
+			`,
+			out: &WebhookMode{
+				CommonMode: CommonMode{
+					LogLevel:           defaultLogLevel,
+					ServerAddress:      "dns:///spire-server:8081",
+					AgentSocketPath:    "AGENTSOCKETPATH",
+					RegistrarSpiffeID:  "spiffe://example.org/registrar",
+					TrustDomain:        "example.org",
+					Cluster:            "CLUSTER",
+					Mode:               "webhook",
+					DisabledNamespaces: []string{"kube-system", "kube-public"},
+				},
+				Addr:                   ":8443",
+				CertPath:               defaultCertPath,
+				KeyPath:                defaultKeyPath,
+				CaCertPath:             defaultCaCertPath,
+				FailurePolicy:          FailurePolicyFail,
+				circuitBreakerCooldown: defaultCircuitBreakerCooldown,
+			},
+		},
+		{
+			name: "registrar identity with a local server socket",
+			in: testMinimalConfig + `
+				registrar_spiffe_id = "spiffe://trustdomain/registrar"
+			`,
+			err: "registrar_spiffe_id can only be specified if the server is not a local socket",
+		},
+		{
+			name: "invalid registrar identity",
+			in: `
+				trust_domain = "example.org"
+				cluster = "CLUSTER"
+				server_address = "spire-server:8081"
+				agent_socket_path = "AGENTSOCKETPATH"
+				registrar_spiffe_id = "registrar"
+			`,
+			err: `invalid registrar_spiffe_id "registrar"`,
+		},
+		{
+			name: "registrar identity of another trust domain",
+			in: `
+				trust_domain = "example.org"
+				cluster = "CLUSTER"
+				server_address = "spire-server:8081"
+				agent_socket_path = "AGENTSOCKETPATH"
+				registrar_spiffe_id = "spiffe://other.org/registrar"
+			`,
+			err: `registrar_spiffe_id "spiffe://other.org/registrar" is not a member of trust domain "example.org"`,
+		},
 		{
 			name: "bad HCL",
 			in:   `INVALID`,
@@ -147,6 +220,92 @@ func TestLoadMode(t *testing.T) {
 			`,
 			err: "workload registration mode specification is incorrect, can't specify both pod_label and pod_annotation",
 		},
+		{
+			name: "SPIFFE ID limits",
+			in: testMinimalConfig + `
+				max_spiffe_id_length = 255
+				max_spiffe_id_path_depth = 4
+			`,
+			out: &WebhookMode{
+				CommonMode: CommonMode{
+					LogLevel:             defaultLogLevel,
+					ServerSocketPath:     "SOCKETPATH",
+					ServerAddress:        "unix://SOCKETPATH",
+					TrustDomain:          "TRUSTDOMAIN",
+					Cluster:              "CLUSTER",
+					Mode:                 "webhook",
+					DisabledNamespaces:   []string{"kube-system", "kube-public"},
+					MaxSpiffeIDLength:    255,
+					MaxSpiffeIDPathDepth: 4,
+				},
+				Addr:                   ":8443",
+				CertPath:               defaultCertPath,
+				KeyPath:                defaultKeyPath,
+				CaCertPath:             defaultCaCertPath,
+				FailurePolicy:          FailurePolicyFail,
+				circuitBreakerCooldown: defaultCircuitBreakerCooldown,
+			},
+		},
+		{
+			name: "max SPIFFE ID length above the SPIFFE specification",
+			in: testMinimalConfig + `
+				max_spiffe_id_length = 4096
+			`,
+			err: "max_spiffe_id_length must be between 0 and 2048",
+		},
+		{
+			name: "negative max SPIFFE ID path depth",
+			in: testMinimalConfig + `
+				max_spiffe_id_path_depth = -1
+			`,
+			err: "max_spiffe_id_path_depth must not be negative",
+		},
+		{
+			name: "invalid failure policy",
+			in: testMinimalConfig + `
+				failure_policy = "retry"
+			`,
+			err: `invalid failure_policy "retry", valid values are fail and ignore`,
+		},
+		{
+			name: "negative circuit breaker threshold",
+			in: testMinimalConfig + `
+				circuit_breaker_threshold = -1
+			`,
+			err: "circuit_breaker_threshold must not be negative",
+		},
+		{
+			name: "invalid circuit breaker cooldown",
+			in: testMinimalConfig + `
+				circuit_breaker_cooldown = "soon"
+			`,
+			err: `invalid circuit_breaker_cooldown "soon"`,
+		},
+		{
+			name: "IPv6 server address without brackets",
+			in: `
+				trust_domain = "TRUSTDOMAIN"
+				cluster = "CLUSTER"
+				server_address = "fd00::1:8081"
+				agent_socket_path = "AGENTSOCKETPATH"
+			`,
+			err: `invalid server_address "fd00::1:8081"`,
+		},
+		{
+			name: "IPv6 webhook address without brackets",
+			in: testMinimalConfig + `
+				addr = "::8443"
+			`,
+			err: `invalid addr "::8443"`,
+		},
+		{
+			name: "invalid crd mode metrics address",
+			in: testMinimalConfig + `
+				mode = "crd"
+				metrics_bind_addr = "fd00::1"
+			`,
+			err: `invalid metrics_bind_addr "fd00::1"`,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -166,3 +325,417 @@ func TestLoadMode(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistrarSVIDPicker(t *testing.T) {
+	registrarID := spiffeid.RequireFromString("spiffe://example.org/registrar")
+	podSVID := &x509svid.SVID{ID: spiffeid.RequireFromString("spiffe://example.org/pod")}
+	registrarSVID := &x509svid.SVID{ID: registrarID}
+
+	pick := registrarSVIDPicker(logger.Null, registrarID)
+	require.Equal(t, registrarSVID, pick([]*x509svid.SVID{podSVID, registrarSVID}))
+	require.Nil(t, pick([]*x509svid.SVID{podSVID}))
+	require.Nil(t, pick(nil))
+}
+
+func TestCRDModeNodeAttestor(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   string
+		out  controllers.NodeAttestorConfig
+		err  string
+	}{
+		{
+			name: "defaults to k8s_psat",
+			in:   testMinimalConfig,
+			out:  controllers.NodeAttestorConfig{Name: controllers.NodeAttestorK8sPSAT},
+		},
+		{
+			name: "aws_iid",
+			in: testMinimalConfig + `
+				node_attestor = "aws_iid"
+				aws_account_id = "123456789012"
+			`,
+			out: controllers.NodeAttestorConfig{
+				Name:         controllers.NodeAttestorAWSIID,
+				AWSAccountID: "123456789012",
+			},
+		},
+		{
+			name: "aws_iid without account",
+			in: testMinimalConfig + `
+				node_attestor = "aws_iid"
+			`,
+			err: `aws_account_id must be specified when node_attestor is "aws_iid"`,
+		},
+		{
+			name: "azure_msi",
+			in: testMinimalConfig + `
+				node_attestor = "azure_msi"
+				azure_tenant_id = "TENANTID"
+			`,
+			out: controllers.NodeAttestorConfig{
+				Name:          controllers.NodeAttestorAzureMSI,
+				AzureTenantID: "TENANTID",
+			},
+		},
+		{
+			name: "azure_msi without tenant",
+			in: testMinimalConfig + `
+				node_attestor = "azure_msi"
+			`,
+			err: `azure_tenant_id must be specified when node_attestor is "azure_msi"`,
+		},
+		{
+			name: "gcp_iit with agent path template",
+			in: testMinimalConfig + `
+				node_attestor = "gcp_iit"
+				agent_path_template = "{{ .PluginName }}/{{ .InstanceID }}"
+			`,
+			out: controllers.NodeAttestorConfig{
+				Name:              controllers.NodeAttestorGCPIIT,
+				AgentPathTemplate: "{{ .PluginName }}/{{ .InstanceID }}",
+			},
+		},
+		{
+			name: "invalid agent path template",
+			in: testMinimalConfig + `
+				node_attestor = "gcp_iit"
+				agent_path_template = "{{ .PluginName"
+			`,
+			err: "invalid agent_path_template",
+		},
+		{
+			name: "unsupported node attestor",
+			in: testMinimalConfig + `
+				node_attestor = "x509pop"
+			`,
+			err: `invalid node_attestor "x509pop"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			c := &CRDMode{}
+			err := c.ParseConfig(testCase.in)
+			if testCase.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), testCase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testCase.out, c.nodeAttestorConfig())
+		})
+	}
+}
+
+func TestCRDModeMaxSVIDTTL(t *testing.T) {
+	c := &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig))
+	require.Zero(t, c.maxSVIDTTL)
+
+	c = &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig+`
+		max_svid_ttl = "24h"
+	`))
+	require.Equal(t, 24*time.Hour, c.maxSVIDTTL)
+
+	c = &CRDMode{}
+	err := c.ParseConfig(testMinimalConfig + `
+		max_svid_ttl = "forever"
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid max_svid_ttl "forever"`)
+
+	c = &CRDMode{}
+	err = c.ParseConfig(testMinimalConfig + `
+		max_svid_ttl = "1ms"
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "max_svid_ttl must be between 1s and")
+}
+
+func TestCRDModeTerminatingPodSVIDTTL(t *testing.T) {
+	c := &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig+`
+		terminating_pod_svid_ttl = "30s"
+	`))
+	require.Equal(t, 30*time.Second, c.terminatingPodSVIDTTL)
+
+	c = &CRDMode{}
+	err := c.ParseConfig(testMinimalConfig + `
+		terminating_pod_svid_ttl = "0s"
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "terminating_pod_svid_ttl must be between 1s and")
+}
+
+func TestCRDModeIdentityReadinessGate(t *testing.T) {
+	c := &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig))
+	require.False(t, c.IdentityReadinessGate)
+	require.Zero(t, c.identityPropagationDelay)
+
+	c = &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig+`
+		identity_readiness_gate = true
+		identity_propagation_delay = "15s"
+	`))
+	require.True(t, c.IdentityReadinessGate)
+	require.Equal(t, 15*time.Second, c.identityPropagationDelay)
+
+	c = &CRDMode{}
+	err := c.ParseConfig(testMinimalConfig + `
+		identity_propagation_delay = "soon"
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid identity_propagation_delay "soon"`)
+
+	c = &CRDMode{}
+	err = c.ParseConfig(testMinimalConfig + `
+		identity_propagation_delay = "0s"
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "identity_propagation_delay must be positive")
+}
+
+func TestCRDModeOrphanedEntrySweep(t *testing.T) {
+	c := &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig+`
+		managed_entries_only = true
+		orphaned_entry_sweep = "prune"
+	`))
+	require.True(t, c.ManagedEntriesOnly)
+	require.Equal(t, controllers.EntrySweepPrune, c.OrphanedEntrySweep)
+
+	c = &CRDMode{}
+	err := c.ParseConfig(testMinimalConfig + `
+		orphaned_entry_sweep = "delete"
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid orphaned_entry_sweep "delete", valid values are report and prune`)
+
+	c = &CRDMode{}
+	err = c.ParseConfig(testMinimalConfig + `
+		orphaned_entry_sweep = "report"
+		node_attestor = "gcp_iit"
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `orphaned_entry_sweep is only supported when node_attestor is "k8s_psat"`)
+}
+
+func TestCRDModeRegistrarConfigName(t *testing.T) {
+	c := &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig+`
+		registrar_config_name = "registrar"
+	`))
+	require.Equal(t, "registrar", c.RegistrarConfigName)
+
+	c = &CRDMode{}
+	err := c.ParseConfig(testMinimalConfig + `
+		registrar_config_name = "registrar"
+		pod_controller = false
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "registrar_config_name requires pod_controller to be enabled")
+}
+
+func TestCRDModeFederationPolicies(t *testing.T) {
+	c := &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig+`
+		federation_policies = true
+	`))
+	require.True(t, c.FederationPolicies)
+
+	c = &CRDMode{}
+	err := c.ParseConfig(testMinimalConfig + `
+		federation_policies = true
+		pod_controller = false
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "federation_policies requires pod_controller to be enabled")
+}
+
+func TestCRDModeEntryBudget(t *testing.T) {
+	c := &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig))
+	require.Empty(t, c.EntryBudgetAction)
+
+	c = &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig+`
+		max_entries_per_node = 200
+		entry_budget_deviation = 2.5
+	`))
+	require.Equal(t, controllers.EntryBudgetReport, c.EntryBudgetAction)
+	require.Equal(t, 200, c.MaxEntriesPerNode)
+	require.Equal(t, 2.5, c.EntryBudgetDeviation)
+
+	c = &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig+`
+		entry_budget_action = "throttle"
+		entry_budget_deviation = 3
+	`))
+	require.Equal(t, controllers.EntryBudgetThrottle, c.EntryBudgetAction)
+
+	for _, tt := range []struct {
+		in  string
+		err string
+	}{
+		{in: `entry_budget_action = "block"`, err: `invalid entry_budget_action "block", valid values are report and throttle`},
+		{in: `entry_budget_action = "report"`, err: "entry_budget_action requires max_entries_per_node or entry_budget_deviation"},
+		{in: `max_entries_per_node = -1`, err: "max_entries_per_node cannot be negative"},
+		{in: `entry_budget_deviation = 0.5`, err: "entry_budget_deviation must be greater than 1"},
+	} {
+		c = &CRDMode{}
+		err := c.ParseConfig(testMinimalConfig + tt.in)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), tt.err)
+	}
+}
+
+func TestCRDModePodRateLimits(t *testing.T) {
+	c := &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig))
+	require.Zero(t, c.PodConcurrentReconciles)
+	require.Zero(t, c.SpiffeIDBatchSize)
+	require.Zero(t, c.spiffeIDBatchInterval)
+
+	c = &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig+`
+		pod_concurrent_reconciles = 4
+		pod_requeue_qps = 5.5
+		pod_requeue_burst = 50
+		spiffeid_batch_size = 100
+		spiffeid_batch_interval = "5s"
+	`))
+	require.Equal(t, 4, c.PodConcurrentReconciles)
+	require.Equal(t, 5.5, c.PodRequeueQPS)
+	require.Equal(t, 50, c.PodRequeueBurst)
+	require.Equal(t, 100, c.SpiffeIDBatchSize)
+	require.Equal(t, 5*time.Second, c.spiffeIDBatchInterval)
+
+	for _, tt := range []struct {
+		in  string
+		err string
+	}{
+		{in: `pod_concurrent_reconciles = -1`, err: "pod_concurrent_reconciles cannot be negative"},
+		{in: `pod_requeue_qps = -1`, err: "pod_requeue_qps cannot be negative"},
+		{in: `pod_requeue_burst = -1`, err: "pod_requeue_burst cannot be negative"},
+		{in: `spiffeid_batch_size = -1`, err: "spiffeid_batch_size cannot be negative"},
+		{in: `spiffeid_batch_interval = "5s"`, err: "spiffeid_batch_interval requires spiffeid_batch_size"},
+		{in: "spiffeid_batch_size = 10\nspiffeid_batch_interval = \"soon\"", err: `invalid spiffeid_batch_interval "soon"`},
+		{in: "spiffeid_batch_size = 10\nspiffeid_batch_interval = \"0s\"", err: "spiffeid_batch_interval must be positive"},
+	} {
+		c = &CRDMode{}
+		err := c.ParseConfig(testMinimalConfig + tt.in)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), tt.err)
+	}
+}
+
+func TestCRDModeSpiffeIDDriftPolicy(t *testing.T) {
+	c := &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig))
+	require.Equal(t, controllers.SpecDriftPolicyRevert, c.SpiffeIDDriftPolicy)
+
+	c = &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig+`
+		spiffeid_drift_policy = "flag"
+	`))
+	require.Equal(t, controllers.SpecDriftPolicyFlag, c.SpiffeIDDriftPolicy)
+
+	c = &CRDMode{}
+	err := c.ParseConfig(testMinimalConfig + `
+		spiffeid_drift_policy = "ignore"
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid spiffeid_drift_policy "ignore", valid values are revert, accept and flag`)
+}
+
+func TestCRDModePodDNSName(t *testing.T) {
+	c := &CRDMode{}
+	require.NoError(t, c.ParseConfig(testMinimalConfig+`
+		pod_dns_name = true
+		pod_dns_name_template = "{{ .PodName }}.{{ .Namespace }}.pod.example.org"
+	`))
+	require.True(t, c.PodDNSName)
+	require.Equal(t, "{{ .PodName }}.{{ .Namespace }}.pod.example.org", c.PodDNSNameTemplate)
+
+	c = &CRDMode{}
+	err := c.ParseConfig(testMinimalConfig + `
+		pod_dns_name_template = "{{ .PodName"
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid pod_dns_name_template")
+}
+
+func TestCRDModeNodeGC(t *testing.T) {
+	testCases := []struct {
+		name        string
+		in          string
+		gracePeriod time.Duration
+		action      string
+		err         string
+	}{
+		{
+			name: "disabled by default",
+			in:   testMinimalConfig,
+		},
+		{
+			name: "defaults to delete",
+			in: testMinimalConfig + `
+				node_gc_grace_period = "1h"
+			`,
+			gracePeriod: time.Hour,
+			action:      controllers.AgentGCActionDelete,
+		},
+		{
+			name: "ban",
+			in: testMinimalConfig + `
+				node_gc_grace_period = "10m"
+				node_gc_action = "ban"
+			`,
+			gracePeriod: 10 * time.Minute,
+			action:      controllers.AgentGCActionBan,
+		},
+		{
+			name: "invalid grace period",
+			in: testMinimalConfig + `
+				node_gc_grace_period = "later"
+			`,
+			err: `invalid node_gc_grace_period "later"`,
+		},
+		{
+			name: "invalid action",
+			in: testMinimalConfig + `
+				node_gc_grace_period = "1h"
+				node_gc_action = "evict"
+			`,
+			err: `invalid node_gc_action "evict", valid values are delete and ban`,
+		},
+		{
+			name: "unsupported node attestor",
+			in: testMinimalConfig + `
+				node_gc_grace_period = "1h"
+				node_attestor = "gcp_iit"
+			`,
+			err: `node_gc_grace_period is only supported when node_attestor is "k8s_psat"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			c := &CRDMode{}
+			err := c.ParseConfig(testCase.in)
+			if testCase.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), testCase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testCase.gracePeriod, c.nodeGCGracePeriod)
+			require.Equal(t, testCase.action, c.NodeGCAction)
+		})
+	}
+}
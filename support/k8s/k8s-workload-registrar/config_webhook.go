@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/hcl"
 	"github.com/zeebo/errs"
@@ -12,6 +13,8 @@ const (
 	defaultCertPath   = "cert.pem"
 	defaultKeyPath    = "key.pem"
 	defaultCaCertPath = "cacert.pem"
+
+	defaultCircuitBreakerCooldown = 30 * time.Second
 )
 
 type WebhookMode struct {
@@ -21,6 +24,10 @@ type WebhookMode struct {
 	CertPath                       string `hcl:"cert_path"`
 	InsecureSkipClientVerification bool   `hcl:"insecure_skip_client_verification"`
 	KeyPath                        string `hcl:"key_path"`
+	FailurePolicy                  string `hcl:"failure_policy"`
+	CircuitBreakerThreshold        int    `hcl:"circuit_breaker_threshold"`
+	CircuitBreakerCooldown         string `hcl:"circuit_breaker_cooldown"`
+	circuitBreakerCooldown         time.Duration
 }
 
 func (c *WebhookMode) ParseConfig(hclConfig string) error {
@@ -31,6 +38,9 @@ func (c *WebhookMode) ParseConfig(hclConfig string) error {
 	if c.Addr == "" {
 		c.Addr = defaultAddr
 	}
+	if err := validateHostPort("addr", c.Addr); err != nil {
+		return err
+	}
 	if c.CertPath == "" {
 		c.CertPath = defaultCertPath
 	}
@@ -40,6 +50,23 @@ func (c *WebhookMode) ParseConfig(hclConfig string) error {
 	if c.KeyPath == "" {
 		c.KeyPath = defaultKeyPath
 	}
+	if c.FailurePolicy == "" {
+		c.FailurePolicy = FailurePolicyFail
+	}
+	if c.FailurePolicy != FailurePolicyFail && c.FailurePolicy != FailurePolicyIgnore {
+		return errs.New("invalid failure_policy %q, valid values are %s and %s", c.FailurePolicy, FailurePolicyFail, FailurePolicyIgnore)
+	}
+	if c.CircuitBreakerThreshold < 0 {
+		return errs.New("circuit_breaker_threshold must not be negative")
+	}
+	c.circuitBreakerCooldown = defaultCircuitBreakerCooldown
+	if c.CircuitBreakerCooldown != "" {
+		cooldown, err := time.ParseDuration(c.CircuitBreakerCooldown)
+		if err != nil {
+			return errs.New("invalid circuit_breaker_cooldown %q: %v", c.CircuitBreakerCooldown, err)
+		}
+		c.circuitBreakerCooldown = cooldown
+	}
 
 	return nil
 }
@@ -68,12 +95,19 @@ func (c *WebhookMode) Run(ctx context.Context) error {
 		PodLabel:           c.PodLabel,
 		PodAnnotation:      c.PodAnnotation,
 		DisabledNamespaces: disabledNamespacesMap,
+		MaxIDLength:        c.MaxSpiffeIDLength,
+		MaxIDPathDepth:     c.MaxSpiffeIDPathDepth,
+
+		FailurePolicy:           c.FailurePolicy,
+		CircuitBreakerThreshold: c.CircuitBreakerThreshold,
+		CircuitBreakerCooldown:  c.circuitBreakerCooldown,
 	})
 
 	log.Info("Initializing registrar")
 	if err := controller.Initialize(ctx); err != nil {
 		return err
 	}
+	go controller.RetryPending(ctx)
 
 	server, err := NewServer(ServerConfig{
 		Log:                            log,
@@ -6,12 +6,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/entryprovenance"
 	"github.com/spiffe/spire/pkg/common/idutil"
 	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/federation"
+	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/identity"
 	"github.com/zeebo/errs"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -20,6 +24,25 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// FailurePolicyFail fails admission requests that could not be handled
+	// because of a SPIRE server error
+	FailurePolicyFail = "fail"
+	// FailurePolicyIgnore admits pods even if the SPIRE server could not be
+	// reached, and retries handling the request asynchronously
+	FailurePolicyIgnore = "ignore"
+
+	defaultRetryInterval = 5 * time.Second
+
+	// maxPendingOperations bounds the number of admission requests waiting
+	// to be retried asynchronously
+	maxPendingOperations = 10000
+	// maxRetryAttempts bounds the number of times an admission request is
+	// retried asynchronously, so a request that can never succeed doesn't
+	// hold up the ones queued after it
+	maxRetryAttempts = 60
+)
+
 type ControllerConfig struct {
 	Log                logrus.FieldLogger
 	E                  entryv1.EntryClient
@@ -28,20 +51,67 @@ type ControllerConfig struct {
 	PodLabel           string
 	PodAnnotation      string
 	DisabledNamespaces map[string]bool
+	MaxIDLength        int
+	MaxIDPathDepth     int
+	// FailurePolicy is either FailurePolicyFail (the default) or
+	// FailurePolicyIgnore
+	FailurePolicy string
+	// CircuitBreakerThreshold, if set, is the number of consecutive SPIRE
+	// server failures after which admission requests are handled
+	// asynchronously for CircuitBreakerCooldown
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
+	// RetryInterval is how often requests handled asynchronously are retried
+	RetryInterval time.Duration
 }
 
 type Controller struct {
-	c ControllerConfig
+	c        ControllerConfig
+	identity identity.Config
+	breaker  *circuitBreaker
+
+	pendingMtx sync.Mutex
+	// pending holds the admission requests to handle asynchronously, in the
+	// order they were received
+	pending []pendingOperation
+}
+
+// pendingOperation is an admission request waiting to be retried
+type pendingOperation struct {
+	log      logrus.FieldLogger
+	fn       func(ctx context.Context) error
+	attempts int
 }
 
 func NewController(config ControllerConfig) *Controller {
-	return &Controller{
+	if config.FailurePolicy == "" {
+		config.FailurePolicy = FailurePolicyFail
+	}
+	if config.RetryInterval == 0 {
+		config.RetryInterval = defaultRetryInterval
+	}
+
+	c := &Controller{
 		c: config,
+		identity: identity.Config{
+			TrustDomain:   config.TrustDomain,
+			PodLabel:      config.PodLabel,
+			PodAnnotation: config.PodAnnotation,
+			MaxIDLength:   config.MaxIDLength,
+			MaxPathDepth:  config.MaxIDPathDepth,
+		},
 	}
+	if config.CircuitBreakerThreshold > 0 {
+		c.breaker = newCircuitBreaker(config.CircuitBreakerThreshold, config.CircuitBreakerCooldown)
+	}
+	return c
 }
 
 func (c *Controller) Initialize(ctx context.Context) error {
 	// ensure there is a node registration entry for PSAT nodes in the cluster.
+	ctx = entryprovenance.AppendToOutgoingContext(ctx, entryprovenance.Provenance{
+		Cluster: c.c.Cluster,
+	})
 	return c.createEntry(ctx, &types.Entry{
 		ParentId: c.makeID("%s", idutil.ServerIDPath),
 		SpiffeId: c.nodeID(),
@@ -92,9 +162,13 @@ func (c *Controller) reviewAdmission(ctx context.Context, req *admv1beta1.Admiss
 		if err := json.Unmarshal(req.Object.Raw, pod); err != nil {
 			return errs.New("unable to unmarshal %s/%s object: %v", req.Kind.Version, req.Kind.Kind, err)
 		}
-		return c.createPodEntry(ctx, pod)
+		return c.handle(ctx, req, func(ctx context.Context) error {
+			return c.createPodEntry(ctx, pod)
+		})
 	case admv1beta1.Delete:
-		return c.deletePodEntry(ctx, req.Namespace, req.Name)
+		return c.handle(ctx, req, func(ctx context.Context) error {
+			return c.deletePodEntry(ctx, req.Namespace, req.Name)
+		})
 	default:
 		c.c.Log.WithFields(logrus.Fields{
 			"operation": req.Operation,
@@ -104,31 +178,138 @@ func (c *Controller) reviewAdmission(ctx context.Context, req *admv1beta1.Admiss
 	return nil
 }
 
-// podSpiffeID returns the desired spiffe ID for the pod, or nil if it should be ignored
-func (c *Controller) podSpiffeID(pod *corev1.Pod) *types.SPIFFEID {
-	if c.c.PodLabel != "" {
-		// the controller has been configured with a pod label. if the pod
-		// has that label, use the value to construct the pod entry. otherwise
-		// ignore the pod altogether.
-		if labelValue, ok := pod.Labels[c.c.PodLabel]; ok {
-			return c.makeID("/%s", labelValue)
-		}
+// handle calls the SPIRE server to handle the admission request, unless the
+// circuit breaker is open or earlier requests are waiting to be retried, in
+// which case it is queued to preserve ordering. Requests failing under the
+// ignore failure policy are queued as well.
+func (c *Controller) handle(ctx context.Context, req *admv1beta1.AdmissionRequest, fn func(ctx context.Context) error) error {
+	log := c.c.Log.WithFields(logrus.Fields{
+		"ns":        req.Namespace,
+		"pod":       req.Name,
+		"operation": req.Operation,
+	})
+
+	if c.hasPending() || (c.breaker != nil && !c.breaker.Allow()) {
+		c.enqueue(log, fn)
 		return nil
 	}
 
-	if c.c.PodAnnotation != "" {
-		// the controller has been configured with a pod annotation. if the pod
-		// has that annotation, use the value to construct the pod entry. otherwise
-		// ignore the pod altogether.
-		if annotationValue, ok := pod.Annotations[c.c.PodAnnotation]; ok {
-			return c.makeID("/%s", annotationValue)
-		}
+	err := fn(ctx)
+	if err == nil {
+		c.breakerSuccess()
 		return nil
 	}
+	opened := c.breakerFailure()
+	if !opened && c.c.FailurePolicy != FailurePolicyIgnore {
+		return err
+	}
+
+	log.WithError(err).Warn("Unable to handle admission request, retrying asynchronously")
+	c.enqueue(log, fn)
+	return nil
+}
+
+// RetryPending retries the admission requests queued by handle until the
+// context is done
+func (c *Controller) RetryPending(ctx context.Context) {
+	ticker := time.NewTicker(c.c.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.retryPending(ctx)
+		}
+	}
+}
+
+// retryPending handles the queued admission requests in order, stopping at
+// the first failure
+func (c *Controller) retryPending(ctx context.Context) {
+	for {
+		if c.breaker != nil && !c.breaker.Allow() {
+			return
+		}
+
+		c.pendingMtx.Lock()
+		if len(c.pending) == 0 {
+			c.pendingMtx.Unlock()
+			return
+		}
+		op := c.pending[0]
+		c.pendingMtx.Unlock()
+
+		if err := op.fn(ctx); err != nil {
+			c.breakerFailure()
+			// Only this goroutine removes requests, so the first one is still op
+			c.pendingMtx.Lock()
+			c.pending[0].attempts++
+			attempts := c.pending[0].attempts
+			c.pendingMtx.Unlock()
+			if attempts < maxRetryAttempts {
+				op.log.WithError(err).Warn("Unable to handle admission request asynchronously, will retry")
+				return
+			}
+			op.log.WithError(err).Error("Unable to handle admission request asynchronously, giving up")
+		} else {
+			c.breakerSuccess()
+			op.log.Info("Handled admission request asynchronously")
+		}
+
+		c.pendingMtx.Lock()
+		c.pending = c.pending[1:]
+		c.pendingMtx.Unlock()
+	}
+}
 
-	// the controller has not been configured with a pod label or a pod annotation.
-	// create an entry based on the service account.
-	return c.makeID("/ns/%s/sa/%s", pod.Namespace, pod.Spec.ServiceAccountName)
+func (c *Controller) enqueue(log logrus.FieldLogger, fn func(ctx context.Context) error) {
+	c.pendingMtx.Lock()
+	defer c.pendingMtx.Unlock()
+
+	if len(c.pending) >= maxPendingOperations {
+		log.Error("Too many admission requests waiting to be retried, dropping request")
+		return
+	}
+	c.pending = append(c.pending, pendingOperation{log: log, fn: fn})
+}
+
+func (c *Controller) hasPending() bool {
+	c.pendingMtx.Lock()
+	defer c.pendingMtx.Unlock()
+	return len(c.pending) > 0
+}
+
+func (c *Controller) breakerSuccess() {
+	if c.breaker != nil {
+		c.breaker.Success()
+	}
+}
+
+// breakerFailure records a SPIRE server failure, returning true if it opened
+// the circuit breaker
+func (c *Controller) breakerFailure() bool {
+	if c.breaker == nil {
+		return false
+	}
+	if c.breaker.Failure() {
+		c.c.Log.WithField("cooldown", c.c.CircuitBreakerCooldown).Warn("SPIRE server unavailable, handling admission requests asynchronously")
+		return true
+	}
+	return false
+}
+
+// podSpiffeID returns the desired spiffe ID for the pod, or nil if it should be ignored
+func (c *Controller) podSpiffeID(pod *corev1.Pod) *types.SPIFFEID {
+	path, ok := c.identity.PodPath(pod)
+	if !ok {
+		return nil
+	}
+	return &types.SPIFFEID{
+		TrustDomain: c.c.TrustDomain,
+		Path:        path,
+	}
 }
 
 func (c *Controller) createPodEntry(ctx context.Context, pod *corev1.Pod) error {
@@ -137,9 +318,21 @@ func (c *Controller) createPodEntry(ctx context.Context, pod *corev1.Pod) error
 	if spiffeID == nil {
 		return nil
 	}
+	if err := c.identity.Validate(c.identity.PodID(pod)); err != nil {
+		c.c.Log.WithError(err).WithFields(logrus.Fields{
+			"ns":  pod.Namespace,
+			"pod": pod.Name,
+		}).Warn("Not registering pod with invalid SPIFFE ID")
+		return nil
+	}
 
 	federationDomains := federation.GetFederationDomains(pod)
 
+	ctx = entryprovenance.AppendToOutgoingContext(ctx, entryprovenance.Provenance{
+		Cluster:   c.c.Cluster,
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+	})
 	return c.createEntry(ctx, &types.Entry{
 		ParentId: c.nodeID(),
 		SpiffeId: spiffeID,
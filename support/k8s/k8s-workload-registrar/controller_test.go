@@ -4,17 +4,21 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/entryprovenance"
 	"github.com/spiffe/spire/test/spiretest"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	admv1beta1 "k8s.io/api/admission/v1beta1"
@@ -120,6 +124,7 @@ func TestControllerInitialization(t *testing.T) {
 			},
 		},
 	}, r.GetEntries())
+	require.Equal(t, entryprovenance.Provenance{Cluster: "CLUSTER"}, r.GetProvenance("00000001"))
 }
 
 func TestControllerIgnoresKubeNamespaces(t *testing.T) {
@@ -219,6 +224,13 @@ func TestControllerServiceAccountBasedRegistration(t *testing.T) {
 			},
 		},
 	}, r.GetEntries())
+
+	// Assert that the entry is stamped with the pod it was created for
+	require.Equal(t, entryprovenance.Provenance{
+		Cluster:   "CLUSTER",
+		Namespace: "NAMESPACE",
+		Pod:       "PODNAME",
+	}, r.GetProvenance("00000001"))
 }
 
 func TestControllerCleansUpOnPodDeletion(t *testing.T) {
@@ -509,18 +521,121 @@ func TestControllerAnnotationBasedRegistrationIgnoresPodsWithoutLabel(t *testing
 	require.Len(t, r.GetEntries(), 0)
 }
 
+func TestControllerFailurePolicy(t *testing.T) {
+	createReq := &admv1beta1.AdmissionRequest{
+		UID: "uid",
+		Kind: metav1.GroupVersionKind{
+			Version: "v1",
+			Kind:    "Pod",
+		},
+		Namespace: "NAMESPACE",
+		Name:      "PODNAME",
+		Operation: "CREATE",
+		Object: runtime.RawExtension{
+			Raw: []byte(fakePodWithLabel),
+		},
+	}
+	unavailable := status.Error(codes.Unavailable, "server unavailable")
+
+	t.Run("fail", func(t *testing.T) {
+		controller, r := newTestController("", "")
+		r.SetError(unavailable)
+
+		requireReviewAdmissionFailure(t, controller, createReq, "server unavailable")
+		require.False(t, controller.hasPending())
+	})
+
+	t.Run("ignore", func(t *testing.T) {
+		controller, r := newTestControllerWithConfig(func(config *ControllerConfig) {
+			config.FailurePolicy = FailurePolicyIgnore
+		})
+		r.SetError(unavailable)
+
+		// The pod is admitted and registered once the server is back
+		requireReviewAdmissionSuccess(t, controller, createReq)
+		require.Empty(t, r.GetEntries())
+
+		controller.retryPending(context.Background())
+		require.Empty(t, r.GetEntries())
+
+		r.SetError(nil)
+		controller.retryPending(context.Background())
+		require.Len(t, r.GetEntries(), 1)
+		require.False(t, controller.hasPending())
+	})
+}
+
+func TestControllerCircuitBreaker(t *testing.T) {
+	controller, r := newTestControllerWithConfig(func(config *ControllerConfig) {
+		config.CircuitBreakerThreshold = 2
+		config.CircuitBreakerCooldown = time.Minute
+	})
+	now := time.Now()
+	controller.breaker.now = func() time.Time { return now }
+	r.SetError(status.Error(codes.Unavailable, "server unavailable"))
+
+	reviewPod := func(name, operation string) (*admv1beta1.AdmissionResponse, error) {
+		return controller.ReviewAdmission(context.Background(), &admv1beta1.AdmissionRequest{
+			UID: "uid",
+			Kind: metav1.GroupVersionKind{
+				Version: "v1",
+				Kind:    "Pod",
+			},
+			Namespace: "NAMESPACE",
+			Name:      name,
+			Operation: admv1beta1.Operation(operation),
+			Object: runtime.RawExtension{
+				Raw: []byte(strings.Replace(fakePodWithLabel, "PODNAME", name, 1)),
+			},
+		})
+	}
+
+	// The first failure fails the admission request
+	_, err := reviewPod("first", "CREATE")
+	require.Error(t, err)
+
+	// The second failure opens the breaker, and the pod is admitted
+	_, err = reviewPod("second", "CREATE")
+	require.NoError(t, err)
+
+	// While the breaker is open, the server is not called
+	calls := r.Calls()
+	_, err = reviewPod("third", "CREATE")
+	require.NoError(t, err)
+	_, err = reviewPod("second", "DELETE")
+	require.NoError(t, err)
+	controller.retryPending(context.Background())
+	require.Equal(t, calls, r.Calls())
+
+	// Once the cooldown has elapsed, the pending requests are handled in order
+	r.SetError(nil)
+	now = now.Add(time.Minute)
+	controller.retryPending(context.Background())
+	require.False(t, controller.hasPending())
+	entries := r.GetEntries()
+	require.Len(t, entries, 1)
+	require.Contains(t, entries[0].Selectors, podNameSelector("third"))
+}
+
 func newTestController(podLabel, podAnnotation string) (*Controller, *fakeEntryClient) {
+	return newTestControllerWithConfig(func(config *ControllerConfig) {
+		config.PodLabel = podLabel
+		config.PodAnnotation = podAnnotation
+	})
+}
+
+func newTestControllerWithConfig(configure func(*ControllerConfig)) (*Controller, *fakeEntryClient) {
 	log, _ := test.NewNullLogger()
 	e := newFakeEntryClient()
-	return NewController(ControllerConfig{
+	config := ControllerConfig{
 		Log:                log,
 		E:                  e,
 		TrustDomain:        "domain.test",
 		Cluster:            "CLUSTER",
-		PodLabel:           podLabel,
-		PodAnnotation:      podAnnotation,
 		DisabledNamespaces: map[string]bool{"kube-system": true, "kube-public": true},
-	}), e
+	}
+	configure(&config)
+	return NewController(config), e
 }
 
 func requireReviewAdmissionSuccess(t *testing.T, controller *Controller, req *admv1beta1.AdmissionRequest) {
@@ -542,17 +657,28 @@ func requireReviewAdmissionFailure(t *testing.T, controller *Controller, req *ad
 type fakeEntryClient struct {
 	entryv1.EntryClient
 
-	mu      sync.Mutex
-	nextID  int64
-	entries map[string]*types.Entry
+	mu          sync.Mutex
+	nextID      int64
+	entries     map[string]*types.Entry
+	provenances map[string]entryprovenance.Provenance
+	err         error
+	calls       int
 }
 
 func newFakeEntryClient() *fakeEntryClient {
 	return &fakeEntryClient{
-		entries: make(map[string]*types.Entry),
+		entries:     make(map[string]*types.Entry),
+		provenances: make(map[string]entryprovenance.Provenance),
 	}
 }
 
+// GetProvenance returns the provenance the entry was created with
+func (c *fakeEntryClient) GetProvenance(id string) entryprovenance.Provenance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.provenances[id]
+}
+
 func (c *fakeEntryClient) GetEntries() []*types.Entry {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -582,18 +708,53 @@ func (c *fakeEntryClient) CreateEntry(entry *types.Entry) *types.Entry {
 	return cloneEntry(entry)
 }
 
+// SetError makes the RPCs fail with the given error, or succeed if nil
+func (c *fakeEntryClient) SetError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// Calls returns the number of RPCs made
+func (c *fakeEntryClient) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+func (c *fakeEntryClient) call() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return c.err
+}
+
 func (c *fakeEntryClient) BatchCreateEntry(ctx context.Context, req *entryv1.BatchCreateEntryRequest, opts ...grpc.CallOption) (*entryv1.BatchCreateEntryResponse, error) {
+	if err := c.call(); err != nil {
+		return nil, err
+	}
+	// The provenance is sent as metadata, which the server receives as such
+	md, _ := metadata.FromOutgoingContext(ctx)
+	provenance := entryprovenance.FromIncomingContext(metadata.NewIncomingContext(ctx, md))
+
 	resp := new(entryv1.BatchCreateEntryResponse)
 	for _, entryIn := range req.Entries {
+		entry := c.CreateEntry(entryIn)
+		c.mu.Lock()
+		c.provenances[entry.Id] = provenance
+		c.mu.Unlock()
 		resp.Results = append(resp.Results, &entryv1.BatchCreateEntryResponse_Result{
 			Status: &types.Status{},
-			Entry:  c.CreateEntry(entryIn),
+			Entry:  entry,
 		})
 	}
 	return resp, nil
 }
 
 func (c *fakeEntryClient) BatchDeleteEntry(ctx context.Context, req *entryv1.BatchDeleteEntryRequest, opts ...grpc.CallOption) (*entryv1.BatchDeleteEntryResponse, error) {
+	if err := c.call(); err != nil {
+		return nil, err
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -618,6 +779,9 @@ func (c *fakeEntryClient) BatchDeleteEntry(ctx context.Context, req *entryv1.Bat
 }
 
 func (c *fakeEntryClient) ListEntries(ctx context.Context, req *entryv1.ListEntriesRequest, opts ...grpc.CallOption) (*entryv1.ListEntriesResponse, error) {
+	if err := c.call(); err != nil {
+		return nil, err
+	}
 	switch {
 	case req.Filter == nil:
 		return nil, status.Error(codes.InvalidArgument, "expecting filter")
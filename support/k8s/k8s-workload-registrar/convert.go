@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/cli"
+	"github.com/spiffe/spire/pkg/common/idutil"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/zeebo/errs"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	convertCommandName      = "convert"
+	defaultConvertNamespace = "default"
+)
+
+// convertCommand reads registration entries from the SPIRE server and emits
+// equivalent SpiffeID custom resource manifests, easing the migration of
+// manually managed entries to "crd" mode.
+type convertCommand struct {
+	configPath string
+	namespace  string
+	parentID   string
+	selectors  cli.StringsFlag
+	force      bool
+}
+
+func runConvert(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	cmd := &convertCommand{}
+
+	fs := flag.NewFlagSet(convertCommandName, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&cmd.configPath, "config", "k8s-workload-registrar.conf", "configuration file")
+	fs.StringVar(&cmd.namespace, "namespace", defaultConvertNamespace, "Namespace for resources whose entry has no namespace selector")
+	fs.StringVar(&cmd.parentID, "parentID", "", "Only convert entries with this parent ID")
+	fs.Var(&cmd.selectors, "selector", "Only convert entries with exactly these selectors (type:value). Can be used more than once")
+	fs.BoolVar(&cmd.force, "force", false, "Convert entries with properties that SpiffeID resources cannot represent, dropping those properties")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	hclBytes, err := os.ReadFile(cmd.configPath)
+	if err != nil {
+		return errs.New("unable to load configuration: %v", err)
+	}
+
+	c := &CommonMode{}
+	if err := c.ParseConfig(string(hclBytes)); err != nil {
+		return errs.New("error parsing common config: %v", err)
+	}
+	defer c.Close()
+
+	log, err := c.SetupLogger()
+	if err != nil {
+		return errs.New("error setting up logging: %v", err)
+	}
+	defer log.Close()
+
+	entryClient, err := c.EntryClient(ctx, log)
+	if err != nil {
+		return errs.New("failed to dial server: %v", err)
+	}
+
+	entries, err := cmd.fetchEntries(ctx, entryClient)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if dropped := droppedEntryFields(entry); len(dropped) > 0 {
+			entryLog := log.WithField("entryID", entry.Id).WithField("fields", strings.Join(dropped, ","))
+			if !cmd.force {
+				// The SpiffeID controller adopts the existing entry and would
+				// reset these fields the next time it updates it
+				entryLog.Warn("Skipping entry with properties that cannot be represented; use -force to convert it anyway")
+				continue
+			}
+			entryLog.Warn("Dropping entry properties that cannot be represented")
+		}
+
+		spiffeID, err := spiffeIDFromEntry(entry, cmd.namespace)
+		if err != nil {
+			log.WithError(err).WithField("entryID", entry.Id).Warn("Skipping entry")
+			continue
+		}
+		if err := writeSpiffeIDManifest(stdout, spiffeID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *convertCommand) fetchEntries(ctx context.Context, client entryv1.EntryClient) ([]*types.Entry, error) {
+	filter := &entryv1.ListEntriesRequest_Filter{}
+	if c.parentID != "" {
+		id, err := idutil.IDProtoFromString(c.parentID)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing parent ID %q: %w", c.parentID, err)
+		}
+		filter.ByParentId = id
+	}
+
+	if len(c.selectors) != 0 {
+		selectors := make([]*types.Selector, 0, len(c.selectors))
+		for _, s := range c.selectors {
+			parts := strings.SplitN(s, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("selector %q must be formatted as type:value", s)
+			}
+			selectors = append(selectors, &types.Selector{Type: parts[0], Value: parts[1]})
+		}
+		filter.BySelectors = &types.SelectorMatch{
+			Selectors: selectors,
+			Match:     types.SelectorMatch_MATCH_EXACT,
+		}
+	}
+
+	var entries []*types.Entry
+	pageToken := ""
+	for {
+		resp, err := client.ListEntries(ctx, &entryv1.ListEntriesRequest{
+			Filter:    filter,
+			PageToken: pageToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching entries: %w", err)
+		}
+		entries = append(entries, resp.Entries...)
+		if resp.NextPageToken == "" {
+			return entries, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// droppedEntryFields returns the names of the entry properties that are set
+// but have no equivalent in the SpiffeID resource. The revision number is
+// maintained by the server and is not considered.
+func droppedEntryFields(entry *types.Entry) []string {
+	var fields []string
+	if entry.Admin {
+		fields = append(fields, "admin")
+	}
+	if entry.Downstream {
+		fields = append(fields, "downstream")
+	}
+	if entry.Ttl != 0 {
+		fields = append(fields, "ttl")
+	}
+	if entry.ExpiresAt != 0 {
+		fields = append(fields, "expiresAt")
+	}
+	return fields
+}
+
+// spiffeIDFromEntry builds the SpiffeID resource equivalent to the given
+// registration entry. The resource is placed in the namespace targeted by
+// the entry's namespace selector, or in defaultNamespace if it has none.
+func spiffeIDFromEntry(entry *types.Entry, defaultNamespace string) (*spiffeidv1beta1.SpiffeID, error) {
+	spiffeID, err := idutil.IDFromProto(entry.SpiffeId)
+	if err != nil {
+		return nil, fmt.Errorf("malformed SPIFFE ID: %w", err)
+	}
+	parentID, err := idutil.IDFromProto(entry.ParentId)
+	if err != nil {
+		return nil, fmt.Errorf("malformed parent ID: %w", err)
+	}
+	selector, err := spiffeidv1beta1.SelectorFromTypes(entry.Selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := selector.Namespace
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+
+	return &spiffeidv1beta1.SpiffeID{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: spiffeidv1beta1.GroupVersion.String(),
+			Kind:       "SpiffeID",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			// Entry IDs are UUIDs, which are valid resource names
+			Name:      entry.Id,
+			Namespace: namespace,
+		},
+		Spec: spiffeidv1beta1.SpiffeIDSpec{
+			ParentId:      parentID.String(),
+			SpiffeId:      spiffeID.String(),
+			Selector:      selector,
+			DnsNames:      entry.DnsNames,
+			FederatesWith: entry.FederatesWith,
+		},
+	}, nil
+}
+
+func writeSpiffeIDManifest(w io.Writer, spiffeID *spiffeidv1beta1.SpiffeID) error {
+	out, err := yaml.Marshal(spiffeID)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "---\n%s", out); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSpiffeIDFromEntry(t *testing.T) {
+	testCases := []struct {
+		name  string
+		entry *types.Entry
+		out   *spiffeidv1beta1.SpiffeID
+		err   string
+	}{
+		{
+			name: "namespace selector",
+			entry: &types.Entry{
+				Id:       "5ba18c6b-2fcf-4d87-b48b-ce9b4b3c1e7a",
+				SpiffeId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/ns/foo/sa/bar"},
+				ParentId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/node"},
+				Selectors: []*types.Selector{
+					{Type: "k8s", Value: "ns:foo"},
+					{Type: "k8s", Value: "sa:bar"},
+					{Type: "k8s", Value: "pod-label:app:web"},
+					{Type: "k8s", Value: "pod-image-count:1"},
+				},
+				DnsNames:      []string{"bar.foo.svc"},
+				FederatesWith: []string{"domain.test"},
+			},
+			out: &spiffeidv1beta1.SpiffeID{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "spiffeid.spiffe.io/v1beta1",
+					Kind:       "SpiffeID",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "5ba18c6b-2fcf-4d87-b48b-ce9b4b3c1e7a",
+					Namespace: "foo",
+				},
+				Spec: spiffeidv1beta1.SpiffeIDSpec{
+					SpiffeId: "spiffe://example.org/ns/foo/sa/bar",
+					ParentId: "spiffe://example.org/node",
+					Selector: spiffeidv1beta1.Selector{
+						Namespace:      "foo",
+						ServiceAccount: "bar",
+						PodLabel:       map[string]string{"app": "web"},
+						Arbitrary:      []string{"pod-image-count:1"},
+					},
+					DnsNames:      []string{"bar.foo.svc"},
+					FederatesWith: []string{"domain.test"},
+				},
+			},
+		},
+		{
+			name: "default namespace",
+			entry: &types.Entry{
+				Id:       "08c9b4de-7e0e-4cc7-9a3d-d8a6e6b81f62",
+				SpiffeId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/node"},
+				ParentId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/spire/server"},
+				Selectors: []*types.Selector{
+					{Type: "k8s_psat", Value: "cluster:production"},
+					{Type: "k8s_psat", Value: "agent_node_uid:1234"},
+				},
+			},
+			out: &spiffeidv1beta1.SpiffeID{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "spiffeid.spiffe.io/v1beta1",
+					Kind:       "SpiffeID",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "08c9b4de-7e0e-4cc7-9a3d-d8a6e6b81f62",
+					Namespace: "spire",
+				},
+				Spec: spiffeidv1beta1.SpiffeIDSpec{
+					SpiffeId: "spiffe://example.org/node",
+					ParentId: "spiffe://example.org/spire/server",
+					Selector: spiffeidv1beta1.Selector{
+						Cluster:      "production",
+						AgentNodeUid: "1234",
+					},
+				},
+			},
+		},
+		{
+			name: "typed selectors",
+			entry: &types.Entry{
+				Id:       "7f9e1a3c-9a3e-4b6d-8c0f-2c1b0d5e6f70",
+				SpiffeId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/workload"},
+				ParentId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/node"},
+				Selectors: []*types.Selector{
+					{Type: "k8s", Value: "ns:foo"},
+					{Type: "unix", Value: "uid:1000"},
+					{Type: "docker", Value: "label:app:web"},
+					{Type: "k8s_psat", Value: "agent_node_label:pool:gpu"},
+				},
+			},
+			out: &spiffeidv1beta1.SpiffeID{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "spiffeid.spiffe.io/v1beta1",
+					Kind:       "SpiffeID",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "7f9e1a3c-9a3e-4b6d-8c0f-2c1b0d5e6f70",
+					Namespace: "foo",
+				},
+				Spec: spiffeidv1beta1.SpiffeIDSpec{
+					SpiffeId: "spiffe://example.org/workload",
+					ParentId: "spiffe://example.org/node",
+					Selector: spiffeidv1beta1.Selector{
+						Namespace: "foo",
+						Typed:     []string{"unix:uid:1000", "docker:label:app:web", "k8s_psat:agent_node_label:pool:gpu"},
+					},
+				},
+			},
+		},
+		{
+			name: "duplicate pod label selector",
+			entry: &types.Entry{
+				Id:       "7f9e1a3c-9a3e-4b6d-8c0f-2c1b0d5e6f70",
+				SpiffeId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/workload"},
+				ParentId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/node"},
+				Selectors: []*types.Selector{
+					{Type: "k8s", Value: "pod-label:app:web"},
+					{Type: "k8s", Value: "pod-label:app:db"},
+				},
+			},
+			err: `duplicate pod-label selector for label "app"`,
+		},
+		{
+			name: "duplicate namespace selector",
+			entry: &types.Entry{
+				Id:       "7f9e1a3c-9a3e-4b6d-8c0f-2c1b0d5e6f70",
+				SpiffeId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/workload"},
+				ParentId: &types.SPIFFEID{TrustDomain: "example.org", Path: "/node"},
+				Selectors: []*types.Selector{
+					{Type: "k8s", Value: "ns:foo"},
+					{Type: "k8s", Value: "ns:bar"},
+				},
+			},
+			err: `duplicate k8s selector "ns:bar"`,
+		},
+		{
+			name: "malformed SPIFFE ID",
+			entry: &types.Entry{
+				Id:        "7f9e1a3c-9a3e-4b6d-8c0f-2c1b0d5e6f70",
+				SpiffeId:  &types.SPIFFEID{TrustDomain: "EXAMPLE.ORG", Path: "/workload"},
+				ParentId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/node"},
+				Selectors: []*types.Selector{{Type: "k8s", Value: "ns:foo"}},
+			},
+			err: "malformed SPIFFE ID",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			out, err := spiffeIDFromEntry(testCase.entry, "spire")
+			if testCase.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), testCase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testCase.out, out)
+		})
+	}
+}
+
+func TestDroppedEntryFields(t *testing.T) {
+	require.Empty(t, droppedEntryFields(&types.Entry{
+		Id:             "5ba18c6b-2fcf-4d87-b48b-ce9b4b3c1e7a",
+		DnsNames:       []string{"bar.foo.svc"},
+		RevisionNumber: 3,
+	}))
+	require.Equal(t, []string{"admin", "downstream", "ttl", "expiresAt"}, droppedEntryFields(&types.Entry{
+		Id:         "5ba18c6b-2fcf-4d87-b48b-ce9b4b3c1e7a",
+		Admin:      true,
+		Downstream: true,
+		Ttl:        60,
+		ExpiresAt:  1600000000,
+	}))
+}
+
+func TestWriteSpiffeIDManifest(t *testing.T) {
+	spiffeID, err := spiffeIDFromEntry(&types.Entry{
+		Id:        "5ba18c6b-2fcf-4d87-b48b-ce9b4b3c1e7a",
+		SpiffeId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/workload"},
+		ParentId:  &types.SPIFFEID{TrustDomain: "example.org", Path: "/node"},
+		Selectors: []*types.Selector{{Type: "k8s", Value: "ns:foo"}},
+	}, "default")
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	require.NoError(t, writeSpiffeIDManifest(out, spiffeID))
+	require.Contains(t, out.String(), "---\napiVersion: spiffeid.spiffe.io/v1beta1\nkind: SpiffeID\n")
+	require.Contains(t, out.String(), "  spiffeId: spiffe://example.org/workload\n")
+	require.Contains(t, out.String(), "    namespace: foo\n")
+}
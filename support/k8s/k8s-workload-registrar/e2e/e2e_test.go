@@ -0,0 +1,208 @@
+// +build integration
+
+// Package e2e runs the registrar end-to-end against a kind cluster with a
+// SPIRE server and agent, and asserts that workloads actually receive SVIDs
+// with the SPIFFE ID the registrar is expected to assign them.
+//
+// The tests reuse the manifests of the Kubernetes integration test suites and
+// expect the spire-server, spire-agent and k8s-workload-registrar images to be
+// available locally with the latest-local tag (see `make images`). Run them
+// with:
+//
+//	go test -tags integration -timeout 30m ./support/k8s/k8s-workload-registrar/e2e
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/identity"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	trustDomain = "example.org"
+
+	rolloutTimeout = 3 * time.Minute
+	fetchTimeout   = 2 * time.Minute
+	fetchInterval  = 2 * time.Second
+)
+
+var (
+	images = []string{
+		"spire-server:latest-local",
+		"spire-agent:latest-local",
+		"k8s-workload-registrar:latest-local",
+	}
+
+	spiffeIDRE = regexp.MustCompile(`SPIFFE ID:\s+(\S+)`)
+)
+
+// suite describes a registrar deployment from the integration test suites
+type suite struct {
+	// name of the suite directory under test/integration/suites
+	name string
+	// kustomizations applied after the server and before the agent
+	extraKustomizations []string
+	// identity is how the registrar is configured to derive SPIFFE IDs
+	identity identity.Config
+}
+
+func TestRegistrar(t *testing.T) {
+	for _, bin := range []string{"docker", "kind", "kubectl"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s is required to run the end-to-end tests", bin)
+		}
+	}
+
+	suites := []suite{
+		{
+			name:                "k8s",
+			extraKustomizations: []string{"webhook"},
+			identity:            identity.Config{TrustDomain: trustDomain},
+		},
+		{
+			name:     "k8s-reconcile",
+			identity: identity.Config{TrustDomain: trustDomain},
+		},
+	}
+
+	for _, s := range suites {
+		s := s
+		t.Run(s.name, func(t *testing.T) {
+			runSuite(t, s)
+		})
+	}
+}
+
+func runSuite(t *testing.T, s suite) {
+	c := newCluster(t, s)
+
+	c.kubectl("create", "namespace", "spire")
+	c.kubectl("apply", "-k", c.confPath("server"))
+	c.waitForRollout("deployment/spire-server")
+	for _, kustomization := range s.extraKustomizations {
+		c.kubectl("apply", "-k", c.confPath(kustomization))
+	}
+	c.kubectl("apply", "-k", c.confPath("agent"))
+	c.waitForRollout("daemonset/spire-agent")
+
+	// The workload is applied once the SPIRE infrastructure has been rolled
+	// out, otherwise the registrar could miss its chance to register it
+	c.kubectl("apply", "-f", c.confPath("workload.yaml"))
+	c.waitForRollout("deployment/example-workload")
+
+	pod := c.workloadPod()
+	expected := s.identity.PodID(pod)
+	require.NotEmpty(t, expected, "workload pod is not expected to be registered")
+
+	deadline := time.Now().Add(fetchTimeout)
+	for {
+		out, err := c.tryKubectl("exec", "-t", pod.Name, "--",
+			"/opt/spire/bin/spire-agent", "api", "fetch", "-socketPath", "/tmp/spire-agent/public/api.sock")
+		if err == nil {
+			if m := spiffeIDRE.FindStringSubmatch(out); m != nil {
+				require.Equal(t, expected, m[1], "workload received an unexpected SPIFFE ID")
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for workload to obtain an SVID: %v: %s", err, out)
+		}
+		time.Sleep(fetchInterval)
+	}
+}
+
+// cluster is a kind cluster running the manifests of a suite
+type cluster struct {
+	t          *testing.T
+	name       string
+	confDir    string
+	kubeconfig string
+}
+
+func newCluster(t *testing.T, s suite) *cluster {
+	_, file, _, ok := runtime.Caller(0)
+	require.True(t, ok)
+	suiteConf := filepath.Join(filepath.Dir(file), "..", "..", "..", "..", "test", "integration", "suites", s.name, "conf")
+
+	// The kind configuration must point to the absolute path of the
+	// configuration directory, so work on a copy of it
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf")
+	runCommand(t, "cp", "-r", suiteConf, confDir)
+	kindConfig, err := os.ReadFile(filepath.Join(confDir, "kind-config.yaml"))
+	require.NoError(t, err)
+	kindConfig = bytes.ReplaceAll(kindConfig, []byte("CONFDIR"), []byte(confDir))
+	require.NoError(t, os.WriteFile(filepath.Join(confDir, "kind-config.yaml"), kindConfig, 0600))
+
+	c := &cluster{
+		t:          t,
+		name:       "registrar-e2e-" + s.name,
+		confDir:    confDir,
+		kubeconfig: filepath.Join(dir, "kubeconfig"),
+	}
+
+	runCommand(t, "kind", "create", "cluster", "--name", c.name, "--config", filepath.Join(confDir, "kind-config.yaml"), "--kubeconfig", c.kubeconfig)
+	t.Cleanup(func() {
+		if t.Failed() {
+			c.dumpLogs()
+		}
+		runCommand(t, "kind", "delete", "cluster", "--name", c.name, "--kubeconfig", c.kubeconfig)
+	})
+
+	for _, image := range images {
+		runCommand(t, "kind", "load", "docker-image", "--name", c.name, image)
+	}
+	return c
+}
+
+func (c *cluster) confPath(name string) string {
+	return filepath.Join(c.confDir, name)
+}
+
+func (c *cluster) kubectl(args ...string) string {
+	out, err := c.tryKubectl(args...)
+	require.NoError(c.t, err, out)
+	return out
+}
+
+func (c *cluster) tryKubectl(args ...string) (string, error) {
+	args = append([]string{"--kubeconfig", c.kubeconfig, "-n", "spire"}, args...)
+	out, err := exec.Command("kubectl", args...).CombinedOutput()
+	return string(out), err
+}
+
+func (c *cluster) waitForRollout(object string) {
+	c.kubectl("rollout", "status", object, fmt.Sprintf("--timeout=%s", rolloutTimeout))
+}
+
+func (c *cluster) workloadPod() *corev1.Pod {
+	out := c.kubectl("get", "pod", "-l", "app=example-workload", "-o", "json")
+	podList := corev1.PodList{}
+	require.NoError(c.t, json.Unmarshal([]byte(out), &podList))
+	require.Len(c.t, podList.Items, 1)
+	return &podList.Items[0]
+}
+
+func (c *cluster) dumpLogs() {
+	for _, object := range []string{"deployment/spire-server", "daemonset/spire-agent", "deployment/example-workload"} {
+		out, _ := c.tryKubectl("logs", object, "--all-containers")
+		c.t.Logf("logs for %s:\n%s", object, out)
+	}
+}
+
+func runCommand(t *testing.T, name string, args ...string) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	require.NoError(t, err, "%s %s: %s", name, strings.Join(args, " "), out)
+}
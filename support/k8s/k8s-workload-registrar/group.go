@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/controllers"
+	"github.com/zeebo/errs"
+)
+
+const groupCommandName = "group"
+
+// groupCommand disables, enables or deletes all the SpiffeID resources of a
+// group at once, e.g. to quickly revoke the identities of a team's workloads
+// when they are compromised. Only the resources are changed; the registrar
+// running in "crd" mode updates the registration entries accordingly.
+type groupCommand struct {
+	action    string
+	group     string
+	namespace string
+}
+
+func runGroup(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	cmd, err := parseGroupCommand(args, stderr)
+	if err != nil {
+		return err
+	}
+
+	c, err := controllers.NewClient()
+	if err != nil {
+		return errs.New("unable to create kubernetes client: %v", err)
+	}
+
+	affected, err := controllers.ApplyGroupAction(ctx, c, cmd.action, cmd.group, cmd.namespace)
+	for _, name := range affected {
+		fmt.Fprintf(stdout, "%s: %s\n", name, cmd.action)
+	}
+	if err != nil {
+		return err
+	}
+	if len(affected) == 0 {
+		fmt.Fprintf(stdout, "No SpiffeID resources of group %q to %s\n", cmd.group, cmd.action)
+	}
+	return nil
+}
+
+func parseGroupCommand(args []string, stderr io.Writer) (*groupCommand, error) {
+	usage := fmt.Sprintf("usage: %s <%s|%s|%s> -group NAME [-namespace NAMESPACE]", groupCommandName,
+		controllers.GroupActionDisable, controllers.GroupActionEnable, controllers.GroupActionDelete)
+	if len(args) == 0 {
+		return nil, errs.New("%s", usage)
+	}
+
+	cmd := &groupCommand{action: args[0]}
+	switch cmd.action {
+	case controllers.GroupActionDisable, controllers.GroupActionEnable, controllers.GroupActionDelete:
+	default:
+		return nil, errs.New("invalid group action %q; %s", cmd.action, usage)
+	}
+
+	fs := flag.NewFlagSet(groupCommandName, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&cmd.group, "group", "", "Group of the SpiffeID resources, i.e. the value of their "+controllers.SpiffeIDGroupLabel+" label")
+	fs.StringVar(&cmd.namespace, "namespace", "", "Only act on the resources in this namespace (default all namespaces)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return nil, err
+	}
+	if cmd.group == "" {
+		return nil, errs.New("-group is required")
+	}
+
+	return cmd, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGroupCommand(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []string
+		cmd  *groupCommand
+		err  string
+	}{
+		{
+			name: "disable",
+			args: []string{"disable", "-group", "payments"},
+			cmd:  &groupCommand{action: "disable", group: "payments"},
+		},
+		{
+			name: "delete in namespace",
+			args: []string{"delete", "-group", "payments", "-namespace", "ns"},
+			cmd:  &groupCommand{action: "delete", group: "payments", namespace: "ns"},
+		},
+		{
+			name: "missing action",
+			err:  "usage: group <disable|enable|delete> -group NAME [-namespace NAMESPACE]",
+		},
+		{
+			name: "invalid action",
+			args: []string{"ban", "-group", "payments"},
+			err:  `invalid group action "ban"; usage: group <disable|enable|delete> -group NAME [-namespace NAMESPACE]`,
+		},
+		{
+			name: "missing group",
+			args: []string{"enable"},
+			err:  "-group is required",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := parseGroupCommand(tt.args, ioutil.Discard)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.cmd, cmd)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Package identity computes the SPIFFE IDs the k8s-workload-registrar assigns
+// to pods. It is shared by all the registrar modes, and can be used by other
+// controllers and admission webhooks that need to know the SPIFFE ID a pod
+// will be issued without talking to the registrar or the SPIRE server.
+package identity
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/spire/pkg/common/idutil"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// MaxIDLength is the maximum length in bytes of a SPIFFE ID, as mandated by
+// the SPIFFE specification
+const MaxIDLength = 2048
+
+// Config determines how SPIFFE IDs are derived from pods. It mirrors the
+// trust_domain, pod_label and pod_annotation registrar configurables.
+type Config struct {
+	// TrustDomain of the SPIFFE IDs
+	TrustDomain string
+
+	// PodLabel, if set, is the label whose value is used as the SPIFFE ID
+	// path. Pods without the label are not assigned a SPIFFE ID.
+	PodLabel string
+
+	// PodAnnotation, if set, is the annotation whose value is used as the
+	// SPIFFE ID path. Pods without the annotation are not assigned a SPIFFE
+	// ID. It is ignored if PodLabel is set.
+	PodAnnotation string
+
+	// MaxIDLength, if set, further limits the length in bytes of the SPIFFE
+	// IDs accepted by Validate
+	MaxIDLength int
+
+	// MaxPathDepth, if set, limits the number of path segments of the SPIFFE
+	// IDs accepted by Validate
+	MaxPathDepth int
+}
+
+// PodPath returns the path of the SPIFFE ID for the pod. It returns false if
+// the pod is not assigned a SPIFFE ID and must be ignored.
+func (c Config) PodPath(pod *corev1.Pod) (string, bool) {
+	if c.PodLabel != "" {
+		labelValue, ok := pod.Labels[c.PodLabel]
+		if !ok {
+			return "", false
+		}
+		return idutil.FormatPath("%s", labelValue), true
+	}
+
+	if c.PodAnnotation != "" {
+		annotationValue, ok := pod.Annotations[c.PodAnnotation]
+		if !ok {
+			return "", false
+		}
+		return idutil.FormatPath("%s", annotationValue), true
+	}
+
+	// Neither a pod label nor a pod annotation has been configured. The
+	// SPIFFE ID is based on the service account.
+	return idutil.FormatPath("ns/%s/sa/%s", pod.Namespace, pod.Spec.ServiceAccountName), true
+}
+
+// PodID returns the SPIFFE ID for the pod, or an empty string if the pod is
+// not assigned a SPIFFE ID and must be ignored. It does not account for
+// identity collisions, which the registrar resolves against the state of the
+// cluster: with the "suffix" identity_collision_policy, a colliding pod is
+// assigned PodID suffixed with CollisionSuffix instead.
+func (c Config) PodID(pod *corev1.Pod) string {
+	path, ok := c.PodPath(pod)
+	if !ok {
+		return ""
+	}
+	return c.makeID(path)
+}
+
+// ContainerID returns the SPIFFE ID for a container of the pod when the
+// registrar is configured with per-container identities, or an empty string
+// if the pod is not assigned a SPIFFE ID and must be ignored.
+func (c Config) ContainerID(pod *corev1.Pod, containerName string) string {
+	path, ok := c.PodPath(pod)
+	if !ok {
+		return ""
+	}
+	return c.makeID(ContainerPath(path, containerName))
+}
+
+// ContainerPath returns the path of the SPIFFE ID for a container, given the
+// path of the SPIFFE ID for its pod.
+func ContainerPath(podPath, containerName string) string {
+	return podPath + idutil.FormatPath("container/%s", containerName)
+}
+
+// CollisionSuffix returns the suffix appended to the SPIFFE ID of a pod
+// colliding with a pod in a different namespace or with a different service
+// account, when the registrar is configured with the "suffix"
+// identity_collision_policy.
+func CollisionSuffix(pod *corev1.Pod) string {
+	return idutil.FormatPath("ns/%s/sa/%s", pod.Namespace, pod.Spec.ServiceAccountName)
+}
+
+// Validate checks that the SPIFFE ID is well formed and within the length and
+// path depth limits of the SPIFFE specification and of the configuration. Pods
+// whose SPIFFE ID is not valid are not registered.
+func (c Config) Validate(id string) error {
+	maxLength := MaxIDLength
+	if c.MaxIDLength > 0 && c.MaxIDLength < maxLength {
+		maxLength = c.MaxIDLength
+	}
+	if len(id) > maxLength {
+		return fmt.Errorf("SPIFFE ID is %d bytes long, exceeding the limit of %d", len(id), maxLength)
+	}
+
+	parsed, err := spiffeid.FromString(id)
+	if err != nil {
+		return fmt.Errorf("invalid SPIFFE ID %q: %w", id, err)
+	}
+
+	if c.MaxPathDepth > 0 {
+		if depth := len(strings.Split(strings.Trim(parsed.Path(), "/"), "/")); depth > c.MaxPathDepth {
+			return fmt.Errorf("SPIFFE ID %q has %d path segments, exceeding the limit of %d", id, depth, c.MaxPathDepth)
+		}
+	}
+	return nil
+}
+
+func (c Config) makeID(path string) string {
+	id := url.URL{
+		Scheme: "spiffe",
+		Host:   c.TrustDomain,
+		Path:   path,
+	}
+	return id.String()
+}
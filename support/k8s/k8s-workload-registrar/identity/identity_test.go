@@ -0,0 +1,145 @@
+package identity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodID(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "bar",
+			Labels:      map[string]string{"spiffe": "label-value"},
+			Annotations: map[string]string{"spiffe.io/spiffe-id": "annotation/value"},
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "sa",
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		config      Config
+		id          string
+		containerID string
+	}{
+		{
+			name:        "service account",
+			config:      Config{TrustDomain: "example.org"},
+			id:          "spiffe://example.org/ns/bar/sa/sa",
+			containerID: "spiffe://example.org/ns/bar/sa/sa/container/app",
+		},
+		{
+			name:        "pod label",
+			config:      Config{TrustDomain: "example.org", PodLabel: "spiffe"},
+			id:          "spiffe://example.org/label-value",
+			containerID: "spiffe://example.org/label-value/container/app",
+		},
+		{
+			name:   "missing pod label",
+			config: Config{TrustDomain: "example.org", PodLabel: "other"},
+		},
+		{
+			name:        "pod annotation",
+			config:      Config{TrustDomain: "example.org", PodAnnotation: "spiffe.io/spiffe-id"},
+			id:          "spiffe://example.org/annotation/value",
+			containerID: "spiffe://example.org/annotation/value/container/app",
+		},
+		{
+			name:   "missing pod annotation",
+			config: Config{TrustDomain: "example.org", PodAnnotation: "other"},
+		},
+		{
+			name:        "pod label takes precedence over pod annotation",
+			config:      Config{TrustDomain: "example.org", PodLabel: "spiffe", PodAnnotation: "spiffe.io/spiffe-id"},
+			id:          "spiffe://example.org/label-value",
+			containerID: "spiffe://example.org/label-value/container/app",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.id, testCase.config.PodID(pod))
+			require.Equal(t, testCase.containerID, testCase.config.ContainerID(pod, "app"))
+		})
+	}
+}
+
+func TestCollisionSuffix(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "bar",
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "sa",
+		},
+	}
+	require.Equal(t, "/ns/bar/sa/sa", CollisionSuffix(pod))
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config Config
+		id     string
+		err    string
+	}{
+		{
+			name: "valid",
+			id:   "spiffe://example.org/ns/bar/sa/sa",
+		},
+		{
+			name: "longer than the SPIFFE specification allows",
+			id:   "spiffe://example.org/" + strings.Repeat("a", MaxIDLength),
+			err:  "exceeding the limit of 2048",
+		},
+		{
+			name:   "longer than configured",
+			config: Config{MaxIDLength: 32},
+			id:     "spiffe://example.org/ns/bar/sa/sa",
+			err:    "SPIFFE ID is 33 bytes long, exceeding the limit of 32",
+		},
+		{
+			name:   "configured length above the SPIFFE specification",
+			config: Config{MaxIDLength: 4096},
+			id:     "spiffe://example.org/" + strings.Repeat("a", MaxIDLength),
+			err:    "exceeding the limit of 2048",
+		},
+		{
+			name:   "within configured depth",
+			config: Config{MaxPathDepth: 4},
+			id:     "spiffe://example.org/ns/bar/sa/sa",
+		},
+		{
+			name:   "deeper than configured",
+			config: Config{MaxPathDepth: 3},
+			id:     "spiffe://example.org/ns/bar/sa/sa",
+			err:    `SPIFFE ID "spiffe://example.org/ns/bar/sa/sa" has 4 path segments, exceeding the limit of 3`,
+		},
+		{
+			name: "malformed",
+			id:   "https://example.org/foo",
+			err:  `invalid SPIFFE ID "https://example.org/foo"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			err := testCase.config.Validate(testCase.id)
+			if testCase.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), testCase.err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -12,6 +12,28 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == convertCommandName {
+		if err := runConvert(context.Background(), os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == groupCommandName {
+		if err := runGroup(context.Background(), os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == simulateCommandName {
+		if err := runSimulate(context.Background(), os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.Parse()
 	if err := run(context.Background(), *configFlag); err != nil {
 		fmt.Fprintf(os.Stderr, "%+v\n", err)
@@ -0,0 +1,83 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FederationPolicyConditionApplied is the type of the condition reporting
+// whether the spec of a FederationPolicy resource is applied by the registrar
+const FederationPolicyConditionApplied = "Applied"
+
+// FederationPolicySpec declares which SPIFFE IDs of the pods in the namespace
+// of the FederationPolicy federate with which trust domains
+type FederationPolicySpec struct {
+	// SpiffeIDs are patterns matching the SPIFFE IDs the policy applies to,
+	// e.g. spiffe://example.org/ns/payments/sa/*. Patterns have the syntax of
+	// Go's path.Match, where * does not match a /.
+	SpiffeIDs []string `json:"spiffeIDs"`
+	// FederatesWith are the trust domains the matching SPIFFE IDs federate
+	// with
+	FederatesWith []string `json:"federatesWith"`
+}
+
+// FederationPolicyCondition describes an aspect of the observed state of
+// FederationPolicy
+type FederationPolicyCondition struct {
+	// Type of the condition
+	Type string `json:"type"`
+	// Status of the condition, one of True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// LastTransitionTime is when the condition last changed its status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a machine readable reason for the last transition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description of the last transition
+	Message string `json:"message,omitempty"`
+}
+
+// FederationPolicyStatus defines the observed state of FederationPolicy
+type FederationPolicyStatus struct {
+	// ObservedGeneration is the generation of the spec last processed by
+	// the registrar
+	ObservedGeneration int64                       `json:"observedGeneration,omitempty"`
+	Conditions         []FederationPolicyCondition `json:"conditions,omitempty"`
+	// ValidationErrors lists why the spec was rejected, if it was. A
+	// rejected policy does not apply to any SPIFFE ID.
+	ValidationErrors []string `json:"validationErrors,omitempty"`
+}
+
+// FederationPolicy is the Schema for the FederationPolicies API
+type FederationPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FederationPolicySpec   `json:"spec,omitempty"`
+	Status FederationPolicyStatus `json:"status,omitempty"`
+}
+
+// FederationPolicyList contains a list of FederationPolicy
+type FederationPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FederationPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FederationPolicy{}, &FederationPolicyList{})
+}
@@ -0,0 +1,100 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RegistrarConfigModeServiceAccount derives the SPIFFE IDs of pods from
+	// their namespace and service account
+	RegistrarConfigModeServiceAccount = "serviceAccount"
+	// RegistrarConfigModeLabel derives the SPIFFE IDs of pods from the value
+	// of their label named by the key of the RegistrarConfig
+	RegistrarConfigModeLabel = "label"
+	// RegistrarConfigModeAnnotation derives the SPIFFE IDs of pods from the
+	// value of their annotation named by the key of the RegistrarConfig
+	RegistrarConfigModeAnnotation = "annotation"
+)
+
+// RegistrarConfigConditionApplied is the type of the condition reporting
+// whether the spec of a RegistrarConfig resource is applied by the registrar
+const RegistrarConfigConditionApplied = "Applied"
+
+// RegistrarConfigSpec defines the settings of the registrar that can be
+// changed at runtime. Fields left unset fall back to the registrar config
+// file.
+type RegistrarConfigSpec struct {
+	// Mode is how the SPIFFE IDs of pods are derived, one of serviceAccount,
+	// label or annotation
+	Mode string `json:"mode,omitempty"`
+	// Key is the pod label or annotation used by the label and annotation
+	// modes
+	Key string `json:"key,omitempty"`
+	// PodDNSNameTemplate is the template of the DNS name added to the SVIDs
+	// of pods, in the namespaces it is enabled for
+	PodDNSNameTemplate string `json:"podDNSNameTemplate,omitempty"`
+	// DisabledNamespaces are the namespaces whose pods are not registered
+	DisabledNamespaces []string `json:"disabledNamespaces,omitempty"`
+}
+
+// RegistrarConfigCondition describes an aspect of the observed state of
+// RegistrarConfig
+type RegistrarConfigCondition struct {
+	// Type of the condition
+	Type string `json:"type"`
+	// Status of the condition, one of True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// LastTransitionTime is when the condition last changed its status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a machine readable reason for the last transition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description of the last transition
+	Message string `json:"message,omitempty"`
+}
+
+// RegistrarConfigStatus defines the observed state of RegistrarConfig
+type RegistrarConfigStatus struct {
+	// ObservedGeneration is the generation of the spec last processed by
+	// the registrar
+	ObservedGeneration int64                      `json:"observedGeneration,omitempty"`
+	Conditions         []RegistrarConfigCondition `json:"conditions,omitempty"`
+	// ValidationErrors lists why the spec was rejected, if it was. The
+	// registrar keeps applying the last valid spec meanwhile.
+	ValidationErrors []string `json:"validationErrors,omitempty"`
+}
+
+// RegistrarConfig is the Schema for the RegistrarConfigs API
+type RegistrarConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RegistrarConfigSpec   `json:"spec,omitempty"`
+	Status RegistrarConfigStatus `json:"status,omitempty"`
+}
+
+// RegistrarConfigList contains a list of RegistrarConfig
+type RegistrarConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RegistrarConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RegistrarConfig{}, &RegistrarConfigList{})
+}
@@ -16,6 +16,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
@@ -43,6 +44,10 @@ type Selector struct {
 	NodeName string `json:"nodeName,omitempty"`
 	// Arbitrary k8s selectors
 	Arbitrary []string `json:"arbitrary,omitempty"`
+	// Typed are selectors of other types than k8s, formatted as
+	// "<type>:<value>", e.g. "unix:uid:1000" or "docker:label:app:web", for
+	// the selectors produced by the other workload attestors of the agent
+	Typed []string `json:"typed,omitempty"`
 }
 
 // SpiffeIDSpec defines the desired state of SpiffeID
@@ -52,11 +57,65 @@ type SpiffeIDSpec struct {
 	Selector      Selector `json:"selector"`
 	DnsNames      []string `json:"dnsNames,omitempty"`
 	FederatesWith []string `json:"federatesWith,omitempty"`
+	// MaxTtl is the maximum TTL, in seconds, of the SVIDs issued for this
+	// spiffe ID, within the max_svid_ttl of the registrar, if any
+	MaxTtl int32 `json:"maxTtl,omitempty"`
+	// Disabled removes the registration entry of this spiffe ID, until it is
+	// enabled again, without deleting the resource
+	Disabled bool `json:"disabled,omitempty"`
+	// NodeSelector restricts the spiffe ID to the agents running on the nodes
+	// matching it. The registrar creates node alias entries selecting those
+	// agents by their k8s_psat agent_node_label selectors, and parents the
+	// entry to them, so parentId must not be set. Only the matchLabels and
+	// the In operator are supported, as agent selectors can only be matched
+	// exactly.
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+	// Ownership tells who manages this spiffe ID, one of "registrar" or
+	// "user". The registrar only changes or deletes the spiffe IDs it owns,
+	// i.e. the ones it creates for pods and nodes. Defaults to "registrar"
+	// for the spiffe IDs controlled by a pod or node, and to "user"
+	// otherwise. It cannot be changed once set.
+	Ownership string `json:"ownership,omitempty"`
+}
+
+const (
+	// OwnershipRegistrar is the ownership of the spiffe IDs created by the
+	// registrar for pods and nodes
+	OwnershipRegistrar = "registrar"
+	// OwnershipUser is the ownership of the spiffe IDs created by users
+	OwnershipUser = "user"
+)
+
+// SpiffeIDConditionSpecDrifted is the type of the condition reporting that
+// the spec of a SpiffeID resource created for a pod has been changed by hand
+const SpiffeIDConditionSpecDrifted = "SpecDrifted"
+
+// SpiffeIDConditionConflict is the type of the condition reporting that the
+// registration entry of a SpiffeID resource is already claimed by another
+// SpiffeID resource
+const SpiffeIDConditionConflict = "Conflict"
+
+// SpiffeIDCondition describes an aspect of the observed state of SpiffeID
+type SpiffeIDCondition struct {
+	// Type of the condition
+	Type string `json:"type"`
+	// Status of the condition, one of True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// LastTransitionTime is when the condition last changed its status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a machine readable reason for the last transition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description of the last transition
+	Message string `json:"message,omitempty"`
 }
 
 // SpiffeIDStatus defines the observed state of SpiffeID
 type SpiffeIDStatus struct {
-	EntryId *string `json:"entryId,omitempty"`
+	EntryId    *string             `json:"entryId,omitempty"`
+	Conditions []SpiffeIDCondition `json:"conditions,omitempty"`
+	// NodeAliasEntryIds are the IDs of the node alias entries created for
+	// the nodeSelector, if any
+	NodeAliasEntryIds []string `json:"nodeAliasEntryIds,omitempty"`
 }
 
 // SpiffeID is the Schema for the SpiffeIds API
@@ -16,11 +16,21 @@ limitations under the License.
 package v1beta1
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 )
 
+// MaxNodeAliasSelectorSets is the maximum number of node alias entries
+// created for the nodeSelector of a SpiffeID resource, i.e. of combinations
+// of the values of its In expressions
+const MaxNodeAliasSelectorSets = 16
+
 // TypesSelector converts the selectors from the CRD to the types.Selector
 // format needed to create the entry on the SPIRE server
 func (s *SpiffeID) TypesSelector() []*types.Selector {
@@ -91,6 +101,212 @@ func (s *SpiffeID) TypesSelector() []*types.Selector {
 			Value: v,
 		})
 	}
+	for _, v := range s.Spec.Selector.Typed {
+		selectorType, value := splitSelectorValue(v)
+		commonSelector = append(commonSelector, &types.Selector{
+			Type:  selectorType,
+			Value: value,
+		})
+	}
 
 	return commonSelector
 }
+
+// SelectorFromTypes converts selectors in the types.Selector format used by
+// the SPIRE server into the CRD selector. It is the inverse of TypesSelector.
+// Selectors of types other than "k8s", and "k8s_psat" selectors other than
+// "cluster" and "agent_node_uid", are kept as typed selectors.
+func SelectorFromTypes(selectors []*types.Selector) (Selector, error) {
+	selector := Selector{}
+	for _, s := range selectors {
+		var err error
+		switch s.Type {
+		case "k8s_psat":
+			name, value := splitSelectorValue(s.Value)
+			switch name {
+			case "cluster":
+				err = setSelectorValue(&selector.Cluster, s, value)
+			case "agent_node_uid":
+				err = setSelectorUID(&selector.AgentNodeUid, s, value)
+			default:
+				selector.Typed = append(selector.Typed, s.Type+":"+s.Value)
+			}
+		case "k8s":
+			name, value := splitSelectorValue(s.Value)
+			switch name {
+			case "pod-label":
+				err = addSelectorPodLabel(&selector, s, value)
+			case "pod-name":
+				err = setSelectorValue(&selector.PodName, s, value)
+			case "pod-uid":
+				err = setSelectorUID(&selector.PodUid, s, value)
+			case "ns":
+				err = setSelectorValue(&selector.Namespace, s, value)
+			case "sa":
+				err = setSelectorValue(&selector.ServiceAccount, s, value)
+			case "container-name":
+				err = setSelectorValue(&selector.ContainerName, s, value)
+			case "container-image":
+				err = setSelectorValue(&selector.ContainerImage, s, value)
+			case "node-name":
+				err = setSelectorValue(&selector.NodeName, s, value)
+			default:
+				selector.Arbitrary = append(selector.Arbitrary, s.Value)
+			}
+		default:
+			selector.Typed = append(selector.Typed, s.Type+":"+s.Value)
+		}
+		if err != nil {
+			return Selector{}, err
+		}
+	}
+
+	return selector, nil
+}
+
+// setSelectorValue sets a single valued selector field. The CRD selector can
+// only hold one value per field, so a second selector of the same kind would
+// silently change the entry and is rejected instead.
+func setSelectorValue(field *string, s *types.Selector, value string) error {
+	if *field != "" {
+		return fmt.Errorf("duplicate %s selector %q", s.Type, s.Value)
+	}
+	*field = value
+	return nil
+}
+
+func setSelectorUID(field *k8stypes.UID, s *types.Selector, value string) error {
+	if *field != "" {
+		return fmt.Errorf("duplicate %s selector %q", s.Type, s.Value)
+	}
+	*field = k8stypes.UID(value)
+	return nil
+}
+
+func addSelectorPodLabel(selector *Selector, s *types.Selector, value string) error {
+	labelParts := strings.SplitN(value, ":", 2)
+	if len(labelParts) != 2 {
+		return fmt.Errorf("malformed pod-label selector %q", s.Value)
+	}
+	if _, ok := selector.PodLabel[labelParts[0]]; ok {
+		return fmt.Errorf("duplicate pod-label selector for label %q", labelParts[0])
+	}
+	if selector.PodLabel == nil {
+		selector.PodLabel = make(map[string]string)
+	}
+	selector.PodLabel[labelParts[0]] = labelParts[1]
+	return nil
+}
+
+func splitSelectorValue(value string) (string, string) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return value, ""
+	}
+	return parts[0], parts[1]
+}
+
+// Ownership returns who manages the SpiffeID resource: its spec.ownership if
+// set, or else the registrar if the resource is controlled by a pod or node,
+// and users otherwise
+func (s *SpiffeID) Ownership() string {
+	if s.Spec.Ownership != "" {
+		return s.Spec.Ownership
+	}
+	if ownerRef := metav1.GetControllerOf(s); ownerRef != nil && (ownerRef.Kind == "Pod" || ownerRef.Kind == "Node") {
+		return OwnershipRegistrar
+	}
+	return OwnershipUser
+}
+
+// NodeAliasSelectors returns the selectors of the node alias entries matching
+// the agents of the cluster running on the nodes selected by the nodeSelector,
+// one set of selectors per combination of the values of its In expressions.
+// Agents only have the agent_node_label selectors of the labels allowed by the
+// k8s_psat node attestor of the server.
+func (s *SpiffeID) NodeAliasSelectors(cluster string) ([][]*types.Selector, error) {
+	nodeSelector := s.Spec.NodeSelector
+	if nodeSelector == nil {
+		return nil, nil
+	}
+
+	values := make(map[string][]string)
+	for key, value := range nodeSelector.MatchLabels {
+		values[key] = []string{value}
+	}
+	for _, expr := range nodeSelector.MatchExpressions {
+		if expr.Operator != metav1.LabelSelectorOpIn {
+			return nil, fmt.Errorf("unsupported operator %q for node label %q, only %q can be matched by agent selectors",
+				expr.Operator, expr.Key, metav1.LabelSelectorOpIn)
+		}
+		exprValues := sortedUniqueStrings(expr.Values)
+		if current, ok := values[expr.Key]; ok {
+			exprValues = intersectStrings(current, exprValues)
+		}
+		if len(exprValues) == 0 {
+			return nil, fmt.Errorf("node label %q can never match", expr.Key)
+		}
+		values[expr.Key] = exprValues
+	}
+	if len(values) == 0 {
+		return nil, errors.New("node selector must select at least one node label")
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	selectorSets := [][]*types.Selector{{{
+		Type:  "k8s_psat",
+		Value: fmt.Sprintf("cluster:%s", cluster),
+	}}}
+	for _, key := range keys {
+		var next [][]*types.Selector
+		for _, selectors := range selectorSets {
+			for _, value := range values[key] {
+				// Copy the selectors, as they are shared by the combinations
+				combination := make([]*types.Selector, 0, len(selectors)+1)
+				combination = append(combination, selectors...)
+				combination = append(combination, &types.Selector{
+					Type:  "k8s_psat",
+					Value: fmt.Sprintf("agent_node_label:%s:%s", key, value),
+				})
+				next = append(next, combination)
+			}
+		}
+		if len(next) > MaxNodeAliasSelectorSets {
+			return nil, fmt.Errorf("node selector has more than %d combinations of node label values", MaxNodeAliasSelectorSets)
+		}
+		selectorSets = next
+	}
+
+	return selectorSets, nil
+}
+
+func sortedUniqueStrings(values []string) []string {
+	set := make(map[string]bool, len(values))
+	var unique []string
+	for _, value := range values {
+		if !set[value] {
+			set[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+func intersectStrings(as, bs []string) []string {
+	var intersection []string
+	for _, a := range as {
+		for _, b := range bs {
+			if a == b {
+				intersection = append(intersection, a)
+				break
+			}
+		}
+	}
+	return intersection
+}
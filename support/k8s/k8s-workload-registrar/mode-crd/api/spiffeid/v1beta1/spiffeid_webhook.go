@@ -27,7 +27,10 @@ import (
 	"github.com/spiffe/spire/pkg/common/x509util"
 	"github.com/zeebo/errs"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
@@ -95,7 +98,16 @@ func (s *SpiffeID) ValidateCreate() error {
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (s *SpiffeID) ValidateUpdate(old runtime.Object) error {
-	return s.validateSpiffeID()
+	if err := s.validateSpiffeID(); err != nil {
+		return err
+	}
+
+	// Both the registrar and users would otherwise be able to take over the
+	// resources of the other
+	if oldSpiffeID, ok := old.(*SpiffeID); ok && oldSpiffeID.Ownership() != s.Ownership() {
+		return errs.New("spec.ownership cannot be changed from %q to %q", oldSpiffeID.Ownership(), s.Ownership())
+	}
+	return nil
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
@@ -107,8 +119,20 @@ func (s *SpiffeID) ValidateDelete() error {
 func (s *SpiffeID) validateSpiffeID() error {
 	spiffeIDPrefix := "spiffe://" + c.TrustDomain
 
-	// Validate Spiffe and Parent IDs have the correct format
-	if !strings.HasPrefix(s.Spec.ParentId, spiffeIDPrefix) {
+	// Validate Spiffe and Parent IDs have the correct format. The entries of
+	// resources with a node selector are parented to the node alias entries
+	// created for it instead.
+	if s.Spec.NodeSelector != nil {
+		if s.Spec.ParentId != "" {
+			return errs.New("spec.parentId must not be set with spec.nodeSelector")
+		}
+		if errList := metav1validation.ValidateLabelSelector(s.Spec.NodeSelector, field.NewPath("spec", "nodeSelector")); len(errList) > 0 {
+			return errList.ToAggregate()
+		}
+		if _, err := s.NodeAliasSelectors(""); err != nil {
+			return fmt.Errorf("invalid spec.nodeSelector: %w", err)
+		}
+	} else if !strings.HasPrefix(s.Spec.ParentId, spiffeIDPrefix) {
 		return errs.New("spec.parentId must begin with " + spiffeIDPrefix)
 	}
 
@@ -116,10 +140,15 @@ func (s *SpiffeID) validateSpiffeID() error {
 		return errs.New("spec.spiffeId must begin with " + spiffeIDPrefix)
 	}
 
-	if s.Spec.Selector.Cluster != "" || s.Spec.Selector.AgentNodeUid != "" {
+	hasPSATSelectors, err := validateTypedSelectors(s.Spec.Selector.Typed)
+	if err != nil {
+		return err
+	}
+
+	if s.Spec.Selector.Cluster != "" || s.Spec.Selector.AgentNodeUid != "" || hasPSATSelectors {
 		// k8s_psat selectors can only be used from the k8s-workload-registrar namespace
 		if s.ObjectMeta.Namespace != c.Namespace {
-			return errs.New("spec.Selector.Cluster and spec.Selector.AgentNodeUid can " +
+			return errs.New("spec.Selector.Cluster, spec.Selector.AgentNodeUid and k8s_psat typed selectors can " +
 				"only be used by the k8s-workload-registrar")
 		}
 	} else {
@@ -129,6 +158,20 @@ func (s *SpiffeID) validateSpiffeID() error {
 		}
 	}
 
+	switch s.Spec.Ownership {
+	case "", OwnershipUser:
+	case OwnershipRegistrar:
+		if ownerRef := metav1.GetControllerOf(s); ownerRef == nil || (ownerRef.Kind != "Pod" && ownerRef.Kind != "Node") {
+			return errs.New("spec.ownership can only be %q for resources controlled by a pod or node", OwnershipRegistrar)
+		}
+	default:
+		return errs.New("spec.ownership must be %q or %q", OwnershipRegistrar, OwnershipUser)
+	}
+
+	if s.Spec.MaxTtl < 0 {
+		return errs.New("spec.maxTtl must not be negative")
+	}
+
 	for _, dnsName := range s.Spec.DnsNames {
 		if err := x509util.ValidateDNS(dnsName); err != nil {
 			return fmt.Errorf("invalid DNS name %q: %w", dnsName, err)
@@ -137,3 +180,23 @@ func (s *SpiffeID) validateSpiffeID() error {
 
 	return nil
 }
+
+// validateTypedSelectors checks that the typed selectors are formatted as
+// "<type>:<value>", returning whether any of them is a k8s_psat selector. The
+// k8s selectors have their own fields, so that each selector has a single
+// representation.
+func validateTypedSelectors(typed []string) (bool, error) {
+	hasPSATSelectors := false
+	for _, selector := range typed {
+		selectorType, value := splitSelectorValue(selector)
+		switch {
+		case selectorType == "" || value == "":
+			return false, fmt.Errorf("invalid typed selector %q: expected <type>:<value>", selector)
+		case selectorType == "k8s":
+			return false, fmt.Errorf("invalid typed selector %q: k8s selectors must be set with the other selector fields", selector)
+		case selectorType == "k8s_psat":
+			hasPSATSelectors = true
+		}
+	}
+	return hasPSATSelectors, nil
+}
@@ -0,0 +1,213 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	agentv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/agent/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// AgentGCActionDelete deletes the agents of deleted nodes, which can
+	// attest again
+	AgentGCActionDelete = "delete"
+	// AgentGCActionBan bans the agents of deleted nodes, which can't attest
+	// again until they are deleted
+	AgentGCActionBan = "ban"
+
+	agentGCInterval = time.Minute
+	agentsPageSize  = 1000
+)
+
+// AgentGarbageCollectorConfig holds the config passed in when creating the garbage collector
+type AgentGarbageCollectorConfig struct {
+	// Action is either AgentGCActionDelete or AgentGCActionBan
+	Action      string
+	AgentClient agentv1.AgentClient
+	Client      client.Client
+	Cluster     string
+	Ctx         context.Context
+	// GracePeriod is how long the node of an agent must have been missing
+	// before the agent is evicted
+	GracePeriod time.Duration
+	Log         logrus.FieldLogger
+}
+
+// AgentGarbageCollector evicts the k8s_psat agents of the cluster whose node
+// has been deleted from Kubernetes, e.g. by the cluster autoscaler
+type AgentGarbageCollector struct {
+	c   AgentGarbageCollectorConfig
+	now func() time.Time
+
+	// missingSince holds when the node of an agent was first found missing,
+	// by agent SPIFFE ID
+	missingSince map[string]time.Time
+}
+
+// NewAgentGarbageCollector creates a new AgentGarbageCollector object
+func NewAgentGarbageCollector(config AgentGarbageCollectorConfig) *AgentGarbageCollector {
+	if config.Action == "" {
+		config.Action = AgentGCActionDelete
+	}
+	return &AgentGarbageCollector{
+		c:            config,
+		now:          time.Now,
+		missingSince: make(map[string]time.Time),
+	}
+}
+
+// Start implements manager.Runnable. As it doesn't implement
+// LeaderElectionRunnable, it only runs on the leader.
+func (g *AgentGarbageCollector) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(agentGCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if err := g.collect(g.c.Ctx); err != nil {
+				g.c.Log.WithError(err).Error("Unable to garbage collect agents")
+			}
+		}
+	}
+}
+
+// collect evicts the agents whose node has been missing for longer than the
+// grace period
+func (g *AgentGarbageCollector) collect(ctx context.Context) error {
+	nodeList := corev1.NodeList{}
+	if err := g.c.Client.List(ctx, &nodeList); err != nil {
+		return err
+	}
+	nodeUIDs := make(map[string]bool, len(nodeList.Items))
+	for _, node := range nodeList.Items {
+		nodeUIDs[string(node.UID)] = true
+	}
+
+	agents, err := g.listAgents(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := g.now()
+	missing := make(map[string]time.Time)
+	for _, agent := range agents {
+		nodeUID, ok := g.agentNodeUID(agent)
+		if !ok || nodeUIDs[nodeUID] {
+			continue
+		}
+
+		agentID := agentIDString(agent.Id)
+		since, ok := g.missingSince[agentID]
+		if !ok {
+			since = now
+		}
+		if now.Sub(since) < g.c.GracePeriod {
+			missing[agentID] = since
+			continue
+		}
+
+		log := g.c.Log.WithFields(logrus.Fields{
+			"agentID": agentID,
+			"nodeUID": nodeUID,
+			"action":  g.c.Action,
+		})
+		if err := g.evict(ctx, agent.Id); err != nil {
+			log.WithError(err).Error("Unable to evict agent of deleted node")
+			missing[agentID] = since
+			continue
+		}
+		log.Info("Evicted agent of deleted node")
+	}
+	// Agents whose node came back or that are gone are forgotten
+	g.missingSince = missing
+	return nil
+}
+
+// listAgents returns the k8s_psat agents, other than banned ones
+func (g *AgentGarbageCollector) listAgents(ctx context.Context) ([]*types.Agent, error) {
+	var agents []*types.Agent
+	pageToken := ""
+	for {
+		resp, err := g.c.AgentClient.ListAgents(ctx, &agentv1.ListAgentsRequest{
+			Filter: &agentv1.ListAgentsRequest_Filter{
+				ByAttestationType: NodeAttestorK8sPSAT,
+			},
+			OutputMask: &types.AgentMask{Selectors: true, Banned: true},
+			PageSize:   agentsPageSize,
+			PageToken:  pageToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, agent := range resp.Agents {
+			if !agent.Banned {
+				agents = append(agents, agent)
+			}
+		}
+		if resp.NextPageToken == "" {
+			return agents, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// agentNodeUID returns the UID of the node of the agent, if it belongs to the cluster
+func (g *AgentGarbageCollector) agentNodeUID(agent *types.Agent) (string, bool) {
+	var cluster, nodeUID string
+	for _, selector := range agent.Selectors {
+		if selector.Type != NodeAttestorK8sPSAT {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(selector.Value, "cluster:"):
+			cluster = strings.TrimPrefix(selector.Value, "cluster:")
+		case strings.HasPrefix(selector.Value, "agent_node_uid:"):
+			nodeUID = strings.TrimPrefix(selector.Value, "agent_node_uid:")
+		}
+	}
+	return nodeUID, cluster == g.c.Cluster && nodeUID != ""
+}
+
+func (g *AgentGarbageCollector) evict(ctx context.Context, id *types.SPIFFEID) error {
+	var err error
+	switch g.c.Action {
+	case AgentGCActionBan:
+		_, err = g.c.AgentClient.BanAgent(ctx, &agentv1.BanAgentRequest{Id: id})
+	default:
+		_, err = g.c.AgentClient.DeleteAgent(ctx, &agentv1.DeleteAgentRequest{Id: id})
+	}
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return err
+}
+
+func agentIDString(id *types.SPIFFEID) string {
+	return makeID(id.TrustDomain, "%s", id.Path)
+}
@@ -0,0 +1,156 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	agentv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/agent/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake" // nolint: staticcheck // No longer deprecated in newer versions.
+)
+
+func TestAgentGarbageCollector(t *testing.T) {
+	for _, action := range []string{AgentGCActionDelete, AgentGCActionBan} {
+		action := action
+		t.Run(action, func(t *testing.T) {
+			ctx := context.Background()
+			log, _ := test.NewNullLogger()
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: "uid-1"}}
+			k8sClient := fake.NewFakeClientWithScheme(scheme.Scheme, node)
+			agentClient := &fakeAgentClient{
+				agents: []*types.Agent{
+					psatAgent("agent-1", Cluster, "uid-1"),
+					psatAgent("agent-2", Cluster, "uid-2"),
+					psatAgent("agent-3", "other-cluster", "uid-3"),
+				},
+			}
+
+			g := NewAgentGarbageCollector(AgentGarbageCollectorConfig{
+				Action:      action,
+				AgentClient: agentClient,
+				Client:      k8sClient,
+				Cluster:     Cluster,
+				GracePeriod: 5 * time.Minute,
+				Log:         log,
+			})
+			now := time.Now()
+			g.now = func() time.Time { return now }
+
+			// The agent is not evicted before the grace period has elapsed
+			require.NoError(t, g.collect(ctx))
+			now = now.Add(4 * time.Minute)
+			require.NoError(t, g.collect(ctx))
+			require.Empty(t, agentClient.evicted)
+
+			// Only the agent of the deleted node of the cluster is evicted
+			now = now.Add(time.Minute)
+			require.NoError(t, g.collect(ctx))
+			require.Equal(t, []string{action + ":/spire/agent/k8s_psat/agent-2"}, agentClient.evicted)
+		})
+	}
+}
+
+func TestAgentGarbageCollectorNodeBack(t *testing.T) {
+	ctx := context.Background()
+	log, _ := test.NewNullLogger()
+	k8sClient := fake.NewFakeClientWithScheme(scheme.Scheme)
+	agentClient := &fakeAgentClient{
+		agents: []*types.Agent{psatAgent("agent-1", Cluster, "uid-1")},
+	}
+
+	g := NewAgentGarbageCollector(AgentGarbageCollectorConfig{
+		AgentClient: agentClient,
+		Client:      k8sClient,
+		Cluster:     Cluster,
+		GracePeriod: 5 * time.Minute,
+		Log:         log,
+	})
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	require.NoError(t, g.collect(ctx))
+
+	// The node shows up again, e.g. it was only missing from the cache
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: "uid-1"}}
+	require.NoError(t, k8sClient.Create(ctx, node))
+	now = now.Add(4 * time.Minute)
+	require.NoError(t, g.collect(ctx))
+
+	// Missing again, the grace period starts over
+	require.NoError(t, k8sClient.Delete(ctx, node))
+	now = now.Add(4 * time.Minute)
+	require.NoError(t, g.collect(ctx))
+	require.Empty(t, agentClient.evicted)
+}
+
+func psatAgent(name, cluster, nodeUID string) *types.Agent {
+	return &types.Agent{
+		Id: &types.SPIFFEID{TrustDomain: TrustDomain, Path: "/spire/agent/k8s_psat/" + name},
+		Selectors: []*types.Selector{
+			{Type: NodeAttestorK8sPSAT, Value: "cluster:" + cluster},
+			{Type: NodeAttestorK8sPSAT, Value: "agent_node_uid:" + nodeUID},
+		},
+	}
+}
+
+type fakeAgentClient struct {
+	agentv1.AgentClient
+
+	agents  []*types.Agent
+	evicted []string
+}
+
+func (c *fakeAgentClient) ListAgents(ctx context.Context, req *agentv1.ListAgentsRequest, opts ...grpc.CallOption) (*agentv1.ListAgentsResponse, error) {
+	var agents []*types.Agent
+	for _, agent := range c.agents {
+		if !agent.Banned {
+			agents = append(agents, agent)
+		}
+	}
+	return &agentv1.ListAgentsResponse{Agents: agents}, nil
+}
+
+func (c *fakeAgentClient) DeleteAgent(ctx context.Context, req *agentv1.DeleteAgentRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	c.evict(AgentGCActionDelete, req.Id)
+	return &emptypb.Empty{}, nil
+}
+
+func (c *fakeAgentClient) BanAgent(ctx context.Context, req *agentv1.BanAgentRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	c.evict(AgentGCActionBan, req.Id)
+	return &emptypb.Empty{}, nil
+}
+
+func (c *fakeAgentClient) evict(action string, id *types.SPIFFEID) {
+	c.evicted = append(c.evicted, action+":"+id.Path)
+	agents := c.agents[:0]
+	for _, agent := range c.agents {
+		if agent.Id.Path != id.Path {
+			agents = append(agents, agent)
+		}
+	}
+	c.agents = agents
+}
@@ -0,0 +1,762 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	spireTypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/spiffe/spire/test/fakes/fakeentryclient"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake" // nolint: staticcheck // No longer deprecated in newer versions.
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	chaosSeed     = flag.Int64("chaos.seed", 1, "Seed of the cluster changes and faults of TestChaos")
+	chaosRounds   = flag.Int("chaos.rounds", 30, "Number of rounds of cluster changes made by TestChaos")
+	chaosFailRate = flag.Float64("chaos.fail-rate", 0.2, "Probability of each call and watch event to be disrupted by TestChaos")
+)
+
+const (
+	// chaosMaxLatency is the maximum latency added to the API server calls
+	chaosMaxLatency = 2 * time.Millisecond
+	// chaosRoundPasses is how many passes of reconciliation each round gets,
+	// converged or not
+	chaosRoundPasses = 5
+	// chaosConvergencePasses is how many passes of reconciliation the
+	// reconcilers get to converge once the faults stop
+	chaosConvergencePasses = 50
+)
+
+var chaosLabels = []string{"web", "db", "cache"}
+
+// TestChaos runs the pod and SpiffeID reconcilers concurrently while pods are
+// created, relabeled, deleted and recreated, with the SPIRE server failing
+// calls or losing their responses, the API server being slow and failing
+// calls, and watch events being lost. Once the faults stop and the informers
+// resync, the reconcilers must converge: no SpiffeID resource outlives its
+// pod, and each SpiffeID resource has exactly one registration entry.
+//
+// The seed makes the cluster changes and the faults reproducible, though not
+// the interleaving of the two reconcilers. Run it longer or with another seed
+// with e.g. -chaos.rounds=500 -chaos.seed=42.
+func TestChaos(t *testing.T) {
+	require.NoError(t, spiffeidv1beta1.AddToScheme(scheme.Scheme))
+	t.Logf("Running %d rounds with seed %d", *chaosRounds, *chaosSeed)
+
+	h := newChaosHarness(t, *chaosSeed, *chaosFailRate)
+	for round := 0; round < *chaosRounds; round++ {
+		changes := 1 + h.rand.Intn(3)
+		for i := 0; i < changes; i++ {
+			h.changeCluster(t)
+		}
+		h.reconcile(t, chaosRoundPasses)
+	}
+	require.NotZero(t, h.injectedFaults(), "no fault was injected")
+
+	// Stop the faults and resync, as the informers eventually do, so the
+	// lost events are delivered
+	h.setFaults(false)
+	h.resync(t)
+	require.True(t, h.reconcile(t, chaosConvergencePasses), "reconcilers did not converge")
+
+	// Entries whose creation was not recorded in the status of their
+	// SpiffeID resource before the resource changed or went away are left
+	// behind, which the entry sweeper removes once found in two sweeps
+	sweeper := NewEntrySweeper(EntrySweeperConfig{
+		Action:      EntrySweepPrune,
+		Client:      h.cluster,
+		Cluster:     Cluster,
+		Ctx:         h.ctx,
+		E:           h.entryClient,
+		Log:         h.log,
+		TrustDomain: TrustDomain,
+	})
+	require.NoError(t, sweeper.sweep(h.ctx))
+	require.NoError(t, sweeper.sweep(h.ctx))
+
+	h.checkInvariants(t, sweeper)
+}
+
+type chaosHarness struct {
+	ctx  context.Context
+	log  *test.Logger
+	rand *rand.Rand
+
+	cluster     *chaosCluster
+	entryClient *fakeentryclient.Client
+
+	podReconciler      reconcile.Reconciler
+	spiffeIDReconciler reconcile.Reconciler
+	faults             []*faultInjector
+
+	nextPod      int
+	nextUID      int
+	deletedNames []string
+}
+
+func newChaosHarness(t *testing.T, seed int64, failRate float64) *chaosHarness {
+	ctx := context.Background()
+	log, _ := test.NewNullLogger()
+
+	watchFaults := newFaultInjector(seed+1, failRate)
+	podFaults := newFaultInjector(seed+2, failRate)
+	spiffeIDFaults := newFaultInjector(seed+3, failRate)
+	entryFaults := newFaultInjector(seed+4, failRate)
+
+	cluster := &chaosCluster{
+		Client:    fake.NewFakeClientWithScheme(scheme.Scheme),
+		watch:     watchFaults,
+		pods:      newRequestQueue(),
+		spiffeIDs: newRequestQueue(),
+	}
+	entryClient := fakeentryclient.New(t, spiffeid.RequireTrustDomainFromString(TrustDomain), nil, nil)
+
+	return &chaosHarness{
+		ctx:         ctx,
+		log:         log,
+		rand:        rand.New(rand.NewSource(seed)),
+		cluster:     cluster,
+		entryClient: entryClient,
+		podReconciler: NewPodReconciler(PodReconcilerConfig{
+			Client:      chaosClient{Client: cluster, f: podFaults},
+			Cluster:     Cluster,
+			Ctx:         ctx,
+			Log:         log,
+			PodLabel:    "spiffe",
+			Scheme:      scheme.Scheme,
+			TrustDomain: TrustDomain,
+		}),
+		spiffeIDReconciler: NewSpiffeIDReconciler(SpiffeIDReconcilerConfig{
+			Client:      chaosClient{Client: cluster, f: spiffeIDFaults},
+			Cluster:     Cluster,
+			Ctx:         ctx,
+			Log:         log,
+			E:           chaosEntryClient{EntryClient: entryClient, f: entryFaults},
+			TrustDomain: TrustDomain,
+		}),
+		faults: []*faultInjector{watchFaults, podFaults, spiffeIDFaults, entryFaults},
+	}
+}
+
+// changeCluster makes a random change to the pods of the cluster
+func (h *chaosHarness) changeCluster(t *testing.T) {
+	pods := h.listPods(t)
+	n := h.rand.Intn(4)
+	switch {
+	case len(pods) < 2 || n == 0:
+		h.createPod(t, "")
+	case n == 1:
+		pod := pods[h.rand.Intn(len(pods))]
+		pod.Labels["spiffe"] = chaosLabels[h.rand.Intn(len(chaosLabels))]
+		require.NoError(t, h.cluster.Update(h.ctx, &pod))
+	case n == 2:
+		pod := pods[h.rand.Intn(len(pods))]
+		require.NoError(t, h.cluster.Delete(h.ctx, &pod))
+		h.deletedNames = append(h.deletedNames, pod.Name)
+	default:
+		// Recreate a pod, e.g. of a StatefulSet, with the same name but a
+		// new UID, or a deleted one if any
+		name := pods[h.rand.Intn(len(pods))].Name
+		if len(h.deletedNames) > 0 && h.rand.Intn(2) == 0 {
+			i := h.rand.Intn(len(h.deletedNames))
+			name = h.deletedNames[i]
+			h.deletedNames = append(h.deletedNames[:i], h.deletedNames[i+1:]...)
+		} else {
+			require.NoError(t, h.cluster.Delete(h.ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: PodNamespace},
+			}))
+		}
+		h.createPod(t, name)
+	}
+}
+
+func (h *chaosHarness) createPod(t *testing.T, name string) {
+	if name == "" {
+		name = fmt.Sprintf("pod-%d", h.nextPod)
+		h.nextPod++
+	}
+	h.nextUID++
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: PodNamespace,
+			UID:       types.UID(fmt.Sprintf("uid-%d", h.nextUID)),
+			Labels:    map[string]string{"spiffe": chaosLabels[h.rand.Intn(len(chaosLabels))]},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "workload",
+				Image: "workload",
+			}},
+			NodeName: fmt.Sprintf("node-%d", h.rand.Intn(2)),
+		},
+	}
+	require.NoError(t, h.cluster.Create(h.ctx, pod))
+}
+
+func (h *chaosHarness) listPods(t *testing.T) []corev1.Pod {
+	podList := corev1.PodList{}
+	require.NoError(t, h.cluster.List(h.ctx, &podList))
+	sort.Slice(podList.Items, func(i, j int) bool {
+		return podList.Items[i].Name < podList.Items[j].Name
+	})
+	return podList.Items
+}
+
+func (h *chaosHarness) listSpiffeIDs(t *testing.T) []spiffeidv1beta1.SpiffeID {
+	spiffeIDList := spiffeidv1beta1.SpiffeIDList{}
+	require.NoError(t, h.cluster.List(h.ctx, &spiffeIDList))
+	return spiffeIDList.Items
+}
+
+// reconcile runs both reconcilers concurrently, like the manager does, on
+// the pending requests until there are none left. It returns false if there
+// were requests still pending after maxPasses passes.
+func (h *chaosHarness) reconcile(t *testing.T, maxPasses int) bool {
+	for pass := 0; pass < maxPasses; pass++ {
+		h.collectGarbage(t)
+
+		pods, spiffeIDs := h.cluster.pods.drain(), h.cluster.spiffeIDs.drain()
+		if len(pods) == 0 && len(spiffeIDs) == 0 {
+			return true
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			reconcileRequests(h.podReconciler, h.cluster.pods, pods)
+		}()
+		go func() {
+			defer wg.Done()
+			reconcileRequests(h.spiffeIDReconciler, h.cluster.spiffeIDs, spiffeIDs)
+		}()
+		wg.Wait()
+	}
+	return false
+}
+
+// reconcileRequests reconciles the requests, requeuing the failed ones
+func reconcileRequests(r reconcile.Reconciler, queue *requestQueue, requests []ctrl.Request) {
+	for _, req := range requests {
+		result, err := r.Reconcile(req)
+		if err != nil || result.Requeue || result.RequeueAfter > 0 {
+			queue.add(req.NamespacedName)
+		}
+	}
+}
+
+// collectGarbage deletes the SpiffeID resources of the deleted pods, like
+// the garbage collector of the cluster does with the owned resources
+func (h *chaosHarness) collectGarbage(t *testing.T) {
+	for _, spiffeID := range h.listSpiffeIDs(t) {
+		spiffeID := spiffeID
+		ownerRef := metav1.GetControllerOf(&spiffeID)
+		if ownerRef == nil {
+			continue
+		}
+
+		pod := corev1.Pod{}
+		err := h.cluster.Get(h.ctx, client.ObjectKey{Namespace: spiffeID.Namespace, Name: ownerRef.Name}, &pod)
+		switch {
+		case k8serrors.IsNotFound(err):
+		case err != nil:
+			require.NoError(t, err)
+		case pod.UID == ownerRef.UID:
+			continue
+		}
+		err = h.cluster.Delete(h.ctx, &spiffeID)
+		require.NoError(t, client.IgnoreNotFound(err))
+	}
+}
+
+// resync enqueues all the pods and SpiffeID resources
+func (h *chaosHarness) resync(t *testing.T) {
+	for _, pod := range h.listPods(t) {
+		h.cluster.pods.add(client.ObjectKey{Namespace: pod.Namespace, Name: pod.Name})
+	}
+	for _, spiffeID := range h.listSpiffeIDs(t) {
+		h.cluster.spiffeIDs.add(client.ObjectKey{Namespace: spiffeID.Namespace, Name: spiffeID.Name})
+	}
+}
+
+func (h *chaosHarness) setFaults(enabled bool) {
+	for _, f := range h.faults {
+		f.setEnabled(enabled)
+	}
+}
+
+func (h *chaosHarness) injectedFaults() int {
+	var injected int
+	for _, f := range h.faults {
+		injected += f.injectedFaults()
+	}
+	return injected
+}
+
+// checkInvariants checks that each pod has a SpiffeID resource, that no
+// SpiffeID resource outlives its pod, and that each SpiffeID resource has
+// exactly one registration entry, matching the resource
+func (h *chaosHarness) checkInvariants(t *testing.T, sweeper *EntrySweeper) {
+	pods := make(map[string]corev1.Pod)
+	for _, pod := range h.listPods(t) {
+		pods[pod.Name] = pod
+	}
+
+	entryOwners := make(map[string]string)
+	spiffeIDs := make(map[string]bool)
+	for _, spiffeID := range h.listSpiffeIDs(t) {
+		spiffeID := spiffeID
+		ownerRef := metav1.GetControllerOf(&spiffeID)
+		require.NotNil(t, ownerRef, "SpiffeID resource %s has no owner", spiffeID.Name)
+		pod, ok := pods[ownerRef.Name]
+		require.True(t, ok && pod.UID == ownerRef.UID, "SpiffeID resource %s outlives its pod", spiffeID.Name)
+		require.Nil(t, spiffeID.DeletionTimestamp, "SpiffeID resource %s is still being deleted", spiffeID.Name)
+		spiffeIDs[ownerRef.Name] = true
+
+		require.NotNil(t, spiffeID.Status.EntryId, "SpiffeID resource %s has no entry", spiffeID.Name)
+		entryID := *spiffeID.Status.EntryId
+		owner, shared := entryOwners[entryID]
+		require.False(t, shared, "SpiffeID resources %s and %s share entry %s", owner, spiffeID.Name, entryID)
+		entryOwners[entryID] = spiffeID.Name
+
+		entry, err := h.entryClient.GetEntry(h.ctx, &entryv1.GetEntryRequest{Id: entryID})
+		require.NoError(t, err, "SpiffeID resource %s has no entry", spiffeID.Name)
+		expected, err := entryFromCRD(&spiffeID, spiffeID.Spec.ParentId)
+		require.NoError(t, err)
+		require.Empty(t, entryDiff(entry, expected), "entry of SpiffeID resource %s does not match it", spiffeID.Name)
+	}
+
+	for name := range pods {
+		require.True(t, spiffeIDs[name], "pod %s has no SpiffeID resource", name)
+	}
+
+	entries, err := sweeper.listClusterEntries(h.ctx)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		_, ok := entryOwners[entry.Id]
+		require.True(t, ok, "entry %s (%s) has no SpiffeID resource", entry.Id, spiffeIDString(entry.SpiffeId))
+	}
+	require.Len(t, entries, len(entryOwners), "duplicate entries")
+}
+
+// faultInjector decides which calls fail and how long they take, or which
+// watch events are lost
+type faultInjector struct {
+	mu       sync.Mutex
+	rand     *rand.Rand
+	failRate float64
+	enabled  bool
+	injected int
+}
+
+func newFaultInjector(seed int64, failRate float64) *faultInjector {
+	return &faultInjector{
+		rand:     rand.New(rand.NewSource(seed)),
+		failRate: failRate,
+		enabled:  true,
+	}
+}
+
+// fault returns true if a fault must be injected
+func (f *faultInjector) fault() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.enabled || f.rand.Float64() >= f.failRate {
+		return false
+	}
+	f.injected++
+	return true
+}
+
+// delay adds latency to a call
+func (f *faultInjector) delay() {
+	f.mu.Lock()
+	var latency time.Duration
+	if f.enabled {
+		latency = time.Duration(f.rand.Int63n(int64(chaosMaxLatency)))
+	}
+	f.mu.Unlock()
+	time.Sleep(latency)
+}
+
+func (f *faultInjector) setEnabled(enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.enabled = enabled
+}
+
+func (f *faultInjector) injectedFaults() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.injected
+}
+
+var (
+	errServerUnavailable = status.Error(codes.Unavailable, "chaos: server unavailable")
+	errServerTimeout     = status.Error(codes.DeadlineExceeded, "chaos: response lost")
+)
+
+// chaosEntryClient fails the calls to the SPIRE server. Some of the changes
+// are made before failing, as when the response is lost.
+type chaosEntryClient struct {
+	entryv1.EntryClient
+	f *faultInjector
+}
+
+func (c chaosEntryClient) GetEntry(ctx context.Context, in *entryv1.GetEntryRequest, opts ...grpc.CallOption) (*spireTypes.Entry, error) {
+	if c.f.fault() {
+		return nil, errServerUnavailable
+	}
+	return c.EntryClient.GetEntry(ctx, in, opts...)
+}
+
+func (c chaosEntryClient) ListEntries(ctx context.Context, in *entryv1.ListEntriesRequest, opts ...grpc.CallOption) (*entryv1.ListEntriesResponse, error) {
+	if c.f.fault() {
+		return nil, errServerUnavailable
+	}
+	return c.EntryClient.ListEntries(ctx, in, opts...)
+}
+
+func (c chaosEntryClient) BatchCreateEntry(ctx context.Context, in *entryv1.BatchCreateEntryRequest, opts ...grpc.CallOption) (*entryv1.BatchCreateEntryResponse, error) {
+	if c.f.fault() {
+		return nil, errServerUnavailable
+	}
+	resp, err := c.EntryClient.BatchCreateEntry(ctx, in, opts...)
+	if err == nil && c.f.fault() {
+		return nil, errServerTimeout
+	}
+	return resp, err
+}
+
+func (c chaosEntryClient) BatchUpdateEntry(ctx context.Context, in *entryv1.BatchUpdateEntryRequest, opts ...grpc.CallOption) (*entryv1.BatchUpdateEntryResponse, error) {
+	if c.f.fault() {
+		return nil, errServerUnavailable
+	}
+	resp, err := c.EntryClient.BatchUpdateEntry(ctx, in, opts...)
+	if err == nil && c.f.fault() {
+		return nil, errServerTimeout
+	}
+	return resp, err
+}
+
+func (c chaosEntryClient) BatchDeleteEntry(ctx context.Context, in *entryv1.BatchDeleteEntryRequest, opts ...grpc.CallOption) (*entryv1.BatchDeleteEntryResponse, error) {
+	if c.f.fault() {
+		return nil, errServerUnavailable
+	}
+	resp, err := c.EntryClient.BatchDeleteEntry(ctx, in, opts...)
+	if err == nil && c.f.fault() {
+		return nil, errServerTimeout
+	}
+	return resp, err
+}
+
+// chaosClient slows down and fails the calls to the API server. Some of the
+// writes are made before failing, as when the response is lost, and some of
+// the updates fail with a conflict, as when another client wrote first.
+type chaosClient struct {
+	client.Client
+	f *faultInjector
+}
+
+func (c chaosClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	c.f.delay()
+	if c.f.fault() {
+		return k8serrors.NewServiceUnavailable("chaos: API server unavailable")
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func (c chaosClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	c.f.delay()
+	if c.f.fault() {
+		return k8serrors.NewServiceUnavailable("chaos: API server unavailable")
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c chaosClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	return chaosWrite(c.f, obj, false, func() error {
+		return c.Client.Create(ctx, obj, opts...)
+	})
+}
+
+func (c chaosClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return chaosWrite(c.f, obj, true, func() error {
+		return c.Client.Update(ctx, obj, opts...)
+	})
+}
+
+func (c chaosClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return chaosWrite(c.f, obj, false, func() error {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	})
+}
+
+func (c chaosClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	return chaosWrite(c.f, obj, false, func() error {
+		return c.Client.Delete(ctx, obj, opts...)
+	})
+}
+
+func (c chaosClient) Status() client.StatusWriter {
+	return chaosStatusWriter{StatusWriter: c.Client.Status(), f: c.f}
+}
+
+type chaosStatusWriter struct {
+	client.StatusWriter
+	f *faultInjector
+}
+
+func (w chaosStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return chaosWrite(w.f, obj, true, func() error {
+		return w.StatusWriter.Update(ctx, obj, opts...)
+	})
+}
+
+func (w chaosStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return chaosWrite(w.f, obj, false, func() error {
+		return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+	})
+}
+
+// chaosWrite makes a write to the API server, injecting latency and faults
+func chaosWrite(f *faultInjector, obj runtime.Object, conflicts bool, write func() error) error {
+	f.delay()
+	if f.fault() {
+		if conflicts {
+			name := ""
+			if accessor, err := meta.Accessor(obj); err == nil {
+				name = accessor.GetName()
+			}
+			return k8serrors.NewConflict(schema.GroupResource{}, name, errors.New("chaos: object was modified"))
+		}
+		return k8serrors.NewServiceUnavailable("chaos: API server unavailable")
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	if f.fault() {
+		return k8serrors.NewTimeoutError("chaos: response lost", 0)
+	}
+	return nil
+}
+
+// chaosCluster emulates what the reconcilers rely on from the API server
+// that the fake client lacks: objects with finalizers are only deleted once
+// their finalizers are removed, and writes produce watch events, some of
+// which are lost. Writes are serialized, as they are atomic in the API
+// server.
+type chaosCluster struct {
+	client.Client
+	mu        sync.Mutex
+	watch     *faultInjector
+	pods      *requestQueue
+	spiffeIDs *requestQueue
+}
+
+func (c *chaosCluster) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.Client.Create(ctx, obj, opts...); err != nil {
+		return err
+	}
+	c.notify(obj)
+	return nil
+}
+
+func (c *chaosCluster) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.Client.Update(ctx, obj, opts...); err != nil {
+		return err
+	}
+	return c.written(ctx, obj)
+}
+
+func (c *chaosCluster) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.Client.Patch(ctx, obj, patch, opts...); err != nil {
+		return err
+	}
+	return c.written(ctx, obj)
+}
+
+// Delete marks the objects with finalizers as being deleted, and deletes the
+// others
+func (c *chaosCluster) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	current := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+	if err := c.Client.Get(ctx, client.ObjectKey{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}, current); err != nil {
+		return err
+	}
+	currentAccessor, err := meta.Accessor(current)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(currentAccessor.GetFinalizers()) == 0:
+		err = c.Client.Delete(ctx, current, opts...)
+	case currentAccessor.GetDeletionTimestamp() == nil:
+		now := metav1.Now()
+		currentAccessor.SetDeletionTimestamp(&now)
+		err = c.Client.Update(ctx, current)
+	default:
+		// Already being deleted
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.notify(current)
+	return nil
+}
+
+func (c *chaosCluster) Status() client.StatusWriter {
+	return chaosClusterStatusWriter{c: c}
+}
+
+type chaosClusterStatusWriter struct {
+	c *chaosCluster
+}
+
+func (w chaosClusterStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+	if err := w.c.Client.Status().Update(ctx, obj, opts...); err != nil {
+		return err
+	}
+	return w.c.written(ctx, obj)
+}
+
+func (w chaosClusterStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+	if err := w.c.Client.Status().Patch(ctx, obj, patch, opts...); err != nil {
+		return err
+	}
+	return w.c.written(ctx, obj)
+}
+
+// written deletes the written object if it was waiting for its finalizers to
+// be removed, and notifies the watchers
+func (c *chaosCluster) written(ctx context.Context, obj runtime.Object) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if accessor.GetDeletionTimestamp() != nil && len(accessor.GetFinalizers()) == 0 {
+		if err := c.Client.Delete(ctx, obj); err != nil {
+			return err
+		}
+	}
+	c.notify(obj)
+	return nil
+}
+
+// notify enqueues the reconciliation of the written object, unless the watch
+// event is lost
+func (c *chaosCluster) notify(obj runtime.Object) {
+	var queue *requestQueue
+	switch obj.(type) {
+	case *corev1.Pod:
+		queue = c.pods
+	case *spiffeidv1beta1.SpiffeID:
+		queue = c.spiffeIDs
+	default:
+		return
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil || c.watch.fault() {
+		return
+	}
+	queue.add(client.ObjectKey{Namespace: accessor.GetNamespace(), Name: accessor.GetName()})
+}
+
+// requestQueue holds the pending reconcile requests of a reconciler. Like a
+// workqueue, a request added several times is only reconciled once.
+type requestQueue struct {
+	mu      sync.Mutex
+	pending map[client.ObjectKey]bool
+}
+
+func newRequestQueue() *requestQueue {
+	return &requestQueue{
+		pending: make(map[client.ObjectKey]bool),
+	}
+}
+
+func (q *requestQueue) add(key client.ObjectKey) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending[key] = true
+}
+
+// drain removes the pending requests and returns them, sorted
+func (q *requestQueue) drain() []ctrl.Request {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	requests := make([]ctrl.Request, 0, len(q.pending))
+	for key := range q.pending {
+		requests = append(requests, ctrl.Request{NamespacedName: key})
+	}
+	q.pending = make(map[client.ObjectKey]bool)
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].String() < requests[j].String()
+	})
+	return requests
+}
@@ -0,0 +1,225 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/identity"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// IdentityCollisionPolicyShare lets incompatible pods share the SPIFFE ID
+	IdentityCollisionPolicyShare = "share"
+	// IdentityCollisionPolicyReject refuses to register a pod whose SPIFFE ID is
+	// already used by an incompatible pod
+	IdentityCollisionPolicyReject = "reject"
+	// IdentityCollisionPolicySuffix disambiguates the SPIFFE ID of a colliding pod
+	// by suffixing it with the namespace and service account of the pod
+	IdentityCollisionPolicySuffix = "suffix"
+
+	spiffeIDField = "spec.spiffeId"
+
+	identityCollisionRequeueInterval = time.Minute
+)
+
+// collisionKey identifies the SpiffeID resource of a pod, or of one of its
+// containers, in the collisions known to the reconciler
+type collisionKey struct {
+	pod       types.NamespacedName
+	container string
+}
+
+// indexSpiffeIDField indexes SpiffeID resources by SPIFFE ID so pods claiming
+// the same SPIFFE ID can be looked up efficiently
+func indexSpiffeIDField(mgr ctrl.Manager) error {
+	return mgr.GetFieldIndexer().IndexField(context.Background(), &spiffeidv1beta1.SpiffeID{}, spiffeIDField, func(rawObj runtime.Object) []string {
+		spiffeID := rawObj.(*spiffeidv1beta1.SpiffeID)
+		return []string{spiffeID.Spec.SpiffeId}
+	})
+}
+
+// resolveIdentityCollision checks whether the SPIFFE ID of the given resource is
+// already used by a pod with a different namespace or service account, and
+// applies the configured policy. It returns false if the resource must not be
+// created. existing is the current SpiffeID resource of the pod for the same
+// container, if any.
+func (r *PodReconciler) resolveIdentityCollision(ctx context.Context, pod *corev1.Pod, spiffeID, existing *spiffeidv1beta1.SpiffeID) (bool, error) {
+	colliding, err := r.findCollidingPod(ctx, pod, spiffeID.Spec.SpiffeId)
+	if err != nil {
+		return false, err
+	}
+
+	key := collisionKey{
+		pod:       types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name},
+		container: spiffeID.Spec.Selector.ContainerName,
+	}
+	if colliding == nil {
+		r.forgetCollision(key)
+
+		// A pod keeps the suffixed SPIFFE ID it was registered with after the
+		// colliding pod goes away, so its identity doesn't change while it runs
+		if r.c.IdentityCollisionPolicy == IdentityCollisionPolicySuffix && existing != nil &&
+			existing.Spec.SpiffeId == spiffeID.Spec.SpiffeId+identity.CollisionSuffix(pod) {
+			spiffeID.Spec.SpiffeId = existing.Spec.SpiffeId
+		}
+		return true, nil
+	}
+
+	// Collisions are only reported the first time they are detected, not on
+	// every reconciliation of the pod
+	report := r.trackCollision(key, spiffeID.Spec.SpiffeId)
+	if report {
+		identityCollisions.WithLabelValues(pod.Namespace, r.c.IdentityCollisionPolicy).Inc()
+		r.c.Log.WithFields(logrus.Fields{
+			"spiffeID":     spiffeID.Spec.SpiffeId,
+			"pod":          pod.Name,
+			"namespace":    pod.Namespace,
+			"collidingPod": colliding.Name,
+			"collidingNs":  colliding.Namespace,
+			"policy":       r.c.IdentityCollisionPolicy,
+		}).Warn("Identity collision detected")
+	}
+
+	switch r.c.IdentityCollisionPolicy {
+	case IdentityCollisionPolicyReject:
+		if report {
+			r.recordEvent(pod, corev1.EventTypeWarning, "IdentityCollision",
+				"SPIFFE ID %q is already used by pod %s/%s with a different namespace or service account, not registering",
+				spiffeID.Spec.SpiffeId, colliding.Namespace, colliding.Name)
+		}
+		return false, nil
+	case IdentityCollisionPolicySuffix:
+		spiffeID.Spec.SpiffeId += identity.CollisionSuffix(pod)
+		if report {
+			r.recordEvent(pod, corev1.EventTypeWarning, "IdentityCollision",
+				"SPIFFE ID is already used by pod %s/%s with a different namespace or service account, registering as %q",
+				colliding.Namespace, colliding.Name, spiffeID.Spec.SpiffeId)
+		}
+		return true, nil
+	default:
+		if report {
+			r.recordEvent(pod, corev1.EventTypeWarning, "IdentityCollision",
+				"SPIFFE ID %q is shared with pod %s/%s with a different namespace or service account",
+				spiffeID.Spec.SpiffeId, colliding.Namespace, colliding.Name)
+		}
+		return true, nil
+	}
+}
+
+// trackCollision remembers that the SpiffeID resource identified by key
+// collides on the given SPIFFE ID. It returns false if the collision was
+// already known.
+func (r *PodReconciler) trackCollision(key collisionKey, spiffeIDURI string) bool {
+	r.collisionsMtx.Lock()
+	defer r.collisionsMtx.Unlock()
+
+	previous, ok := r.collisions[key]
+	if ok && previous == spiffeIDURI {
+		return false
+	}
+	if !ok {
+		collidingIdentities.WithLabelValues(key.pod.Namespace, r.c.IdentityCollisionPolicy).Inc()
+	}
+	r.collisions[key] = spiffeIDURI
+	return true
+}
+
+// forgetCollision forgets the collision of the SpiffeID resource identified by key, if any
+func (r *PodReconciler) forgetCollision(key collisionKey) {
+	r.collisionsMtx.Lock()
+	defer r.collisionsMtx.Unlock()
+
+	if _, ok := r.collisions[key]; ok {
+		delete(r.collisions, key)
+		collidingIdentities.WithLabelValues(key.pod.Namespace, r.c.IdentityCollisionPolicy).Dec()
+	}
+}
+
+// forgetPodCollisions forgets the collisions of all the SpiffeID resources of
+// the pod, e.g. once it has been deleted
+func (r *PodReconciler) forgetPodCollisions(pod types.NamespacedName) {
+	r.collisionsMtx.Lock()
+	defer r.collisionsMtx.Unlock()
+
+	for key := range r.collisions {
+		if key.pod == pod {
+			delete(r.collisions, key)
+			collidingIdentities.WithLabelValues(key.pod.Namespace, r.c.IdentityCollisionPolicy).Dec()
+		}
+	}
+}
+
+// findCollidingPod returns a pod, other than the given one, owning a SpiffeID
+// resource with the given SPIFFE ID and a different namespace or service
+// account, or nil if there is none.
+func (r *PodReconciler) findCollidingPod(ctx context.Context, pod *corev1.Pod, spiffeIDURI string) (*corev1.Pod, error) {
+	spiffeIDList := spiffeidv1beta1.SpiffeIDList{}
+	if err := r.List(ctx, &spiffeIDList, client.MatchingFields{spiffeIDField: spiffeIDURI}); err != nil {
+		return nil, err
+	}
+
+	for _, other := range spiffeIDList.Items {
+		other := other
+		// The field index is not available on every client, so filter again
+		if other.Spec.SpiffeId != spiffeIDURI {
+			continue
+		}
+
+		// Only consider SpiffeID resources created for other pods
+		podUID, ok := other.Labels["podUid"]
+		if !ok || podUID == string(pod.UID) {
+			continue
+		}
+		ownerRef := metav1.GetControllerOf(&other)
+		if ownerRef == nil || ownerRef.Kind != "Pod" {
+			continue
+		}
+
+		otherPod := corev1.Pod{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: other.Namespace, Name: ownerRef.Name}, &otherPod); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		if otherPod.Namespace != pod.Namespace || otherPod.Spec.ServiceAccountName != pod.Spec.ServiceAccountName {
+			return &otherPod, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// recordEvent records an event on the given object if an event recorder is configured
+func (r *PodReconciler) recordEvent(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.c.EventRecorder == nil {
+		return
+	}
+	r.c.EventRecorder.Eventf(object, eventType, reason, messageFmt, args...)
+}
@@ -0,0 +1,224 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// SpecDriftPolicyRevert reverts the manual changes made to the spec of the
+	// SpiffeID resources of pods
+	SpecDriftPolicyRevert = "revert"
+	// SpecDriftPolicyAccept keeps the manual changes made to the spec of the
+	// SpiffeID resources of pods
+	SpecDriftPolicyAccept = "accept"
+	// SpecDriftPolicyFlag keeps the manual changes made to the spec of the
+	// SpiffeID resources of pods, and reports them with the SpecDrifted
+	// condition of the resources and a metric
+	SpecDriftPolicyFlag = "flag"
+
+	// specTemplateHashAnnotation holds the hash of the spec last derived from
+	// the pod, which tells manual changes apart from changes of the pod
+	specTemplateHashAnnotation = "spiffeid.spiffe.io/spec-template-hash"
+
+	specDriftReasonManualChange = "ManualChange"
+	specDriftReasonNoDrift      = "NoDrift"
+)
+
+// specTemplate holds the fields of the spec of a SpiffeID resource that are
+// derived from its pod. The DNS names, maxTtl and disabled fields are left
+// out, as they are also managed by other controllers or by users.
+type specTemplate struct {
+	SpiffeID      string                   `json:"spiffeId"`
+	ParentID      string                   `json:"parentId"`
+	Selector      spiffeidv1beta1.Selector `json:"selector"`
+	FederatesWith []string                 `json:"federatesWith,omitempty"`
+}
+
+func specTemplateOf(spiffeID *spiffeidv1beta1.SpiffeID) specTemplate {
+	t := specTemplate{
+		SpiffeID: spiffeID.Spec.SpiffeId,
+		ParentID: spiffeID.Spec.ParentId,
+		Selector: spiffeID.Spec.Selector,
+	}
+	// Empty and missing lists are the same once stored
+	if len(spiffeID.Spec.FederatesWith) > 0 {
+		t.FederatesWith = spiffeID.Spec.FederatesWith
+	}
+	return t
+}
+
+func (t specTemplate) hash() string {
+	// Marshaling plain strings and string collections cannot fail
+	b, _ := json.Marshal(t)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (t specTemplate) apply(spiffeID *spiffeidv1beta1.SpiffeID) {
+	spiffeID.Spec.SpiffeId = t.SpiffeID
+	spiffeID.Spec.ParentId = t.ParentID
+	spiffeID.Spec.Selector = t.Selector
+	spiffeID.Spec.FederatesWith = t.FederatesWith
+	setSpecTemplateHash(spiffeID, t.hash())
+}
+
+// diff returns the names of the fields that differ between the templates
+func (t specTemplate) diff(other specTemplate) []string {
+	var fields []string
+	if t.SpiffeID != other.SpiffeID {
+		fields = append(fields, "spiffeId")
+	}
+	if t.ParentID != other.ParentID {
+		fields = append(fields, "parentId")
+	}
+	// Selectors are compared the way they are stored, where empty and missing
+	// collections are the same
+	if (specTemplate{Selector: t.Selector}).hash() != (specTemplate{Selector: other.Selector}).hash() {
+		fields = append(fields, "selector")
+	}
+	if !reflect.DeepEqual(t.FederatesWith, other.FederatesWith) {
+		fields = append(fields, "federatesWith")
+	}
+	return fields
+}
+
+func setSpecTemplateHash(spiffeID *spiffeidv1beta1.SpiffeID, hash string) {
+	if spiffeID.Annotations == nil {
+		spiffeID.Annotations = make(map[string]string)
+	}
+	spiffeID.Annotations[specTemplateHashAnnotation] = hash
+}
+
+// reconcileSpecDrift updates the fields of the existing SpiffeID resource that
+// are derived from the pod, as given by the desired resource. Fields changed by
+// hand since the registrar last set them are reverted or kept according to the
+// spec drift policy; kept changes hold the resource back from further changes
+// of the pod until they are undone. It returns whether the existing resource
+// has been changed, and the fields that have drifted and were kept, if any.
+func (r *PodReconciler) reconcileSpecDrift(existing, desired *spiffeidv1beta1.SpiffeID) (bool, []string) {
+	current := specTemplateOf(existing)
+	template := specTemplateOf(desired)
+
+	// Resources created before the hash was recorded are not known to have
+	// drifted, and take the template
+	lastHash := existing.Annotations[specTemplateHashAnnotation]
+	drifted := lastHash != "" && current.hash() != lastHash
+
+	diff := current.diff(template)
+	if len(diff) == 0 {
+		if lastHash == template.hash() {
+			return false, nil
+		}
+		setSpecTemplateHash(existing, template.hash())
+		return true, nil
+	}
+
+	if drifted {
+		log := r.c.Log.WithFields(logrus.Fields{
+			"name":      existing.Name,
+			"namespace": existing.Namespace,
+			"fields":    strings.Join(diff, ","),
+			"policy":    r.c.SpecDriftPolicy,
+		})
+		if r.c.SpecDriftPolicy != SpecDriftPolicyRevert {
+			log.Debug("Keeping manual changes to SpiffeID resource")
+			return false, diff
+		}
+		log.Info("Reverting manual changes to SpiffeID resource")
+		specDrifts.WithLabelValues(existing.Namespace, r.c.SpecDriftPolicy).Inc()
+	}
+
+	template.apply(existing)
+	return true, nil
+}
+
+// setSpecDriftCondition sets the SpecDrifted condition of the SpiffeID
+// resource, if it changed. The condition is only added once the resource
+// drifts, and the metric is updated when it starts drifting.
+func (r *PodReconciler) setSpecDriftCondition(ctx context.Context, spiffeID *spiffeidv1beta1.SpiffeID, drift []string) error {
+	condition := spiffeidv1beta1.SpiffeIDCondition{
+		Type:   spiffeidv1beta1.SpiffeIDConditionSpecDrifted,
+		Status: corev1.ConditionFalse,
+		Reason: specDriftReasonNoDrift,
+	}
+	if len(drift) > 0 {
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = specDriftReasonManualChange
+		condition.Message = "Fields changed by hand and no longer derived from the pod: " + strings.Join(drift, ", ")
+	}
+
+	key := client.ObjectKey{Namespace: spiffeID.Namespace, Name: spiffeID.Name}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := r.Get(ctx, key, spiffeID); err != nil {
+			return err
+		}
+
+		current := findSpiffeIDCondition(spiffeID.Status.Conditions, condition.Type)
+		wasDrifted := current != nil && current.Status == corev1.ConditionTrue
+		switch {
+		case current == nil && condition.Status == corev1.ConditionFalse:
+			return nil
+		case current == nil:
+			condition.LastTransitionTime = metav1.Now()
+			spiffeID.Status.Conditions = append(spiffeID.Status.Conditions, condition)
+		case current.Status == condition.Status && current.Message == condition.Message:
+			return nil
+		default:
+			condition.LastTransitionTime = current.LastTransitionTime
+			if current.Status != condition.Status {
+				condition.LastTransitionTime = metav1.Now()
+			}
+			*current = condition
+		}
+
+		if err := r.Status().Update(ctx, spiffeID); err != nil {
+			return err
+		}
+		if condition.Status == corev1.ConditionTrue && !wasDrifted {
+			r.c.Log.WithFields(logrus.Fields{
+				"name":      spiffeID.Name,
+				"namespace": spiffeID.Namespace,
+				"fields":    strings.Join(drift, ","),
+			}).Warn("SpiffeID resource was changed by hand")
+			specDrifts.WithLabelValues(spiffeID.Namespace, r.c.SpecDriftPolicy).Inc()
+		}
+		return nil
+	})
+}
+
+func findSpiffeIDCondition(conditions []spiffeidv1beta1.SpiffeIDCondition, conditionType string) *spiffeidv1beta1.SpiffeIDCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
@@ -111,8 +111,12 @@ func (e *EndpointReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 				}, nil
 			}
 
-			// Iterate through the list of SPIFFE ID resources and update to add the DNS name
+			// Iterate through the list of SPIFFE ID resources and update to add the DNS name.
+			// The resources of users are left alone.
 			for _, spiffeID := range spiffeIDList.Items {
+				if spiffeID.Ownership() != spiffeidv1beta1.OwnershipRegistrar {
+					continue
+				}
 				if !containsString(spiffeID.Spec.DnsNames, svcName) {
 					spiffeID := spiffeID
 					spiffeID.Spec.DnsNames = append(spiffeID.Spec.DnsNames, svcName)
@@ -153,6 +157,11 @@ func (e *EndpointReconciler) deleteExternalResources(namespacedName types.Namesp
 	}
 
 	for _, spiffeID := range spiffeIDList.Items {
+		// The DNS names of the resources of users are theirs
+		if spiffeID.Ownership() != spiffeidv1beta1.OwnershipRegistrar {
+			continue
+		}
+
 		e.c.Log.WithFields(logrus.Fields{
 			"spiffeID": spiffeID.ObjectMeta.Name,
 		}).Info("Removing DNS names")
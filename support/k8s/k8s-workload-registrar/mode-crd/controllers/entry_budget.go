@@ -0,0 +1,218 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// EntryBudgetReport logs the nodes over their registration entry budget
+	EntryBudgetReport = "report"
+	// EntryBudgetThrottle also stops registering new pods on the nodes over
+	// their registration entry budget, until they are back within it
+	EntryBudgetThrottle = "throttle"
+
+	entryBudgetInterval = time.Minute
+
+	// A node is only compared to the cluster norm once it has at least
+	// deviationMinEntries entries, and the cluster has at least
+	// deviationMinNodes nodes with entries, so small clusters and nodes
+	// don't trip the deviation check
+	deviationMinEntries = 20
+	deviationMinNodes   = 3
+)
+
+// EntryBudgetConfig holds the config passed in when creating the entry budget
+type EntryBudgetConfig struct {
+	// Action is either EntryBudgetReport or EntryBudgetThrottle
+	Action string
+	Client client.Client
+	Ctx    context.Context
+	Log    logrus.FieldLogger
+	// MaxEntriesPerNode, if set, is the number of entries a node can parent
+	MaxEntriesPerNode int
+	// Deviation, if set, is the number of times the median number of entries
+	// per node a node can parent
+	Deviation float64
+}
+
+// EntryBudget tracks the number of registration entries parented to each
+// node, i.e. to its node alias or agent ID, and finds the nodes exceeding
+// their budget, either the configured maximum or a multiple of the cluster
+// norm. Such nodes are usually the sign of a runaway workload or of a
+// compromised node registering workloads.
+type EntryBudget struct {
+	c EntryBudgetConfig
+
+	mtx sync.RWMutex
+	// overBudget holds the parent IDs of the nodes over budget
+	overBudget map[string]bool
+	// counted holds the parent IDs reported in the node entries metric, so
+	// the nodes without entries anymore can be removed from it
+	counted map[string]bool
+}
+
+// NewEntryBudget creates a new EntryBudget object
+func NewEntryBudget(config EntryBudgetConfig) *EntryBudget {
+	if config.Action == "" {
+		config.Action = EntryBudgetReport
+	}
+	return &EntryBudget{
+		c:          config,
+		overBudget: make(map[string]bool),
+		counted:    make(map[string]bool),
+	}
+}
+
+// Start implements manager.Runnable. As it doesn't implement
+// LeaderElectionRunnable, it only runs on the leader.
+func (b *EntryBudget) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(entryBudgetInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := b.check(b.c.Ctx); err != nil {
+			b.c.Log.WithError(err).Error("Unable to check registration entry budget")
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Allows returns whether new entries can be parented to the given node. It
+// is always true unless the action is EntryBudgetThrottle.
+func (b *EntryBudget) Allows(parentID string) bool {
+	if b.c.Action != EntryBudgetThrottle {
+		return true
+	}
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	return !b.overBudget[parentID]
+}
+
+// check counts the entries of the SpiffeID resources parented to each node
+// and updates the nodes over budget
+func (b *EntryBudget) check(ctx context.Context) error {
+	spiffeIDList := spiffeidv1beta1.SpiffeIDList{}
+	if err := b.c.Client.List(ctx, &spiffeIDList); err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, spiffeID := range spiffeIDList.Items {
+		// Node alias entries are parented to the server, not to a node
+		if _, ok := spiffeID.Labels["nodeUid"]; ok {
+			continue
+		}
+		// Entries of node selectors are parented to node alias entries of
+		// their own, which may match many nodes
+		if spiffeID.Spec.NodeSelector != nil {
+			continue
+		}
+		counts[spiffeID.Spec.ParentId]++
+	}
+
+	limit := b.limit(counts)
+	overBudget := make(map[string]bool)
+	for parentID, count := range counts {
+		nodeEntries.WithLabelValues(parentID).Set(float64(count))
+		if limit == 0 || count <= limit {
+			continue
+		}
+		overBudget[parentID] = true
+	}
+	for parentID := range b.counted {
+		if _, ok := counts[parentID]; !ok {
+			nodeEntries.DeleteLabelValues(parentID)
+		}
+	}
+	overBudgetNodes.Set(float64(len(overBudget)))
+
+	b.mtx.Lock()
+	previous := b.overBudget
+	b.overBudget = overBudget
+	b.mtx.Unlock()
+
+	b.counted = make(map[string]bool, len(counts))
+	for parentID := range counts {
+		b.counted[parentID] = true
+	}
+
+	// Changes are only reported once, not on every check
+	for parentID := range overBudget {
+		if previous[parentID] {
+			continue
+		}
+		b.c.Log.WithFields(logrus.Fields{
+			"parentID": parentID,
+			"entries":  counts[parentID],
+			"limit":    limit,
+			"action":   b.c.Action,
+		}).Warn("Node is over its registration entry budget")
+	}
+	for parentID := range previous {
+		if overBudget[parentID] {
+			continue
+		}
+		b.c.Log.WithFields(logrus.Fields{
+			"parentID": parentID,
+			"entries":  counts[parentID],
+		}).Info("Node is back within its registration entry budget")
+	}
+	return nil
+}
+
+// limit returns the number of entries a node can parent given the number of
+// entries of every node, or 0 if unlimited. It is the lowest of the
+// configured maximum and of the deviation from the median.
+func (b *EntryBudget) limit(counts map[string]int) int {
+	limit := b.c.MaxEntriesPerNode
+	if b.c.Deviation <= 0 || len(counts) < deviationMinNodes {
+		return limit
+	}
+
+	sorted := make([]int, 0, len(counts))
+	for _, count := range counts {
+		sorted = append(sorted, count)
+	}
+	sort.Ints(sorted)
+	median := float64(sorted[len(sorted)/2])
+	if len(sorted)%2 == 0 {
+		median = (median + float64(sorted[len(sorted)/2-1])) / 2
+	}
+
+	deviationLimit := int(median * b.c.Deviation)
+	if deviationLimit < deviationMinEntries {
+		deviationLimit = deviationMinEntries
+	}
+	if limit == 0 || deviationLimit < limit {
+		limit = deviationLimit
+	}
+	return limit
+}
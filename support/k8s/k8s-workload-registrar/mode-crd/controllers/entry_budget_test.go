@@ -0,0 +1,143 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake" // nolint: staticcheck // No longer deprecated in newer versions.
+)
+
+func TestEntryBudget(t *testing.T) {
+	require.NoError(t, spiffeidv1beta1.AddToScheme(scheme.Scheme))
+	ctx := context.Background()
+
+	node := func(name string) string {
+		return makeID(TrustDomain, "k8s-workload-registrar/%s/node/%s", Cluster, name)
+	}
+	var objects []runtime.Object
+	addSpiffeIDs := func(nodeName string, count int) {
+		for i := 0; i < count; i++ {
+			objects = append(objects, &spiffeidv1beta1.SpiffeID{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-pod-%d", nodeName, i), Namespace: "default"},
+				Spec:       spiffeidv1beta1.SpiffeIDSpec{ParentId: node(nodeName)},
+			})
+		}
+	}
+	addSpiffeIDs("node-1", 10)
+	addSpiffeIDs("node-2", 12)
+	addSpiffeIDs("node-3", 14)
+	addSpiffeIDs("node-4", 45)
+	// Node alias entries are not counted
+	objects = append(objects, &spiffeidv1beta1.SpiffeID{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Namespace: "spire", Labels: map[string]string{"nodeUid": "uid"}},
+		Spec:       spiffeidv1beta1.SpiffeIDSpec{ParentId: makeID(TrustDomain, "spire/server")},
+	})
+
+	for _, tt := range []struct {
+		name       string
+		config     EntryBudgetConfig
+		overBudget []string
+	}{
+		{
+			name:   "no budget",
+			config: EntryBudgetConfig{Action: EntryBudgetThrottle},
+		},
+		{
+			name:       "max entries",
+			config:     EntryBudgetConfig{Action: EntryBudgetThrottle, MaxEntriesPerNode: 12},
+			overBudget: []string{node("node-3"), node("node-4")},
+		},
+		{
+			// The median is 13, so the budget is 39
+			name:       "deviation",
+			config:     EntryBudgetConfig{Action: EntryBudgetThrottle, Deviation: 3},
+			overBudget: []string{node("node-4")},
+		},
+		{
+			// The budget is never lower than deviationMinEntries
+			name:       "deviation floor",
+			config:     EntryBudgetConfig{Action: EntryBudgetThrottle, Deviation: 1.1, MaxEntriesPerNode: 50},
+			overBudget: []string{node("node-4")},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			log, hook := test.NewNullLogger()
+			tt.config.Client = fake.NewFakeClientWithScheme(scheme.Scheme, objects...)
+			tt.config.Log = log
+			b := NewEntryBudget(tt.config)
+
+			require.NoError(t, b.check(ctx))
+			require.Equal(t, float64(45), testutil.ToFloat64(nodeEntries.WithLabelValues(node("node-4"))))
+			require.Equal(t, float64(len(tt.overBudget)), testutil.ToFloat64(overBudgetNodes))
+			for _, parentID := range tt.overBudget {
+				require.False(t, b.Allows(parentID))
+			}
+			require.True(t, b.Allows(node("node-1")))
+
+			// Nodes over budget are only reported once
+			require.Len(t, hook.AllEntries(), len(tt.overBudget))
+			require.NoError(t, b.check(ctx))
+			require.Len(t, hook.AllEntries(), len(tt.overBudget))
+		})
+	}
+}
+
+func TestEntryBudgetReport(t *testing.T) {
+	require.NoError(t, spiffeidv1beta1.AddToScheme(scheme.Scheme))
+	ctx := context.Background()
+	log, hook := test.NewNullLogger()
+
+	parentID := makeID(TrustDomain, "k8s-workload-registrar/%s/node/node-1", Cluster)
+	spiffeID := &spiffeidv1beta1.SpiffeID{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"},
+		Spec:       spiffeidv1beta1.SpiffeIDSpec{ParentId: parentID},
+	}
+	k8sClient := fake.NewFakeClientWithScheme(scheme.Scheme, spiffeID, &spiffeidv1beta1.SpiffeID{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-2", Namespace: "default"},
+		Spec:       spiffeidv1beta1.SpiffeIDSpec{ParentId: parentID},
+	})
+	b := NewEntryBudget(EntryBudgetConfig{
+		Client:            k8sClient,
+		Log:               log,
+		MaxEntriesPerNode: 1,
+	})
+
+	// Nodes over budget are reported, but not throttled
+	require.NoError(t, b.check(ctx))
+	require.True(t, b.Allows(parentID))
+	require.Len(t, hook.AllEntries(), 1)
+	require.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	require.Equal(t, "Node is over its registration entry budget", hook.LastEntry().Message)
+
+	require.NoError(t, k8sClient.Delete(ctx, spiffeID))
+	require.NoError(t, b.check(ctx))
+	require.Len(t, hook.AllEntries(), 2)
+	require.Equal(t, logrus.InfoLevel, hook.LastEntry().Level)
+	require.Equal(t, "Node is back within its registration entry budget", hook.LastEntry().Message)
+}
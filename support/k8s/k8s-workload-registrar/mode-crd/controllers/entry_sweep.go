@@ -0,0 +1,190 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// EntrySweepReport logs the registration entries of the cluster that
+	// have no SpiffeID resource, without deleting them
+	EntrySweepReport = "report"
+	// EntrySweepPrune deletes the registration entries of the cluster that
+	// have no SpiffeID resource
+	EntrySweepPrune = "prune"
+
+	entrySweepInterval = 10 * time.Minute
+	entriesPageSize    = 1000
+)
+
+// EntrySweeperConfig holds the config passed in when creating the sweeper
+type EntrySweeperConfig struct {
+	// Action is either EntrySweepReport or EntrySweepPrune
+	Action      string
+	Client      client.Client
+	Cluster     string
+	Ctx         context.Context
+	E           entryv1.EntryClient
+	Log         logrus.FieldLogger
+	TrustDomain string
+}
+
+// EntrySweeper finds the registration entries of the cluster, i.e. the
+// entries parented to or identifying its nodes, that are not backed by a
+// SpiffeID resource, so the server state converges with the cluster
+type EntrySweeper struct {
+	c EntrySweeperConfig
+
+	// candidates holds the IDs of the entries without SpiffeID resource found
+	// by the previous sweep. Entries are only reported once they are found
+	// in two consecutive sweeps, as the status of a SpiffeID resource is
+	// updated after its entry is created.
+	candidates map[string]bool
+}
+
+// NewEntrySweeper creates a new EntrySweeper object
+func NewEntrySweeper(config EntrySweeperConfig) *EntrySweeper {
+	if config.Action == "" {
+		config.Action = EntrySweepReport
+	}
+	return &EntrySweeper{
+		c:          config,
+		candidates: make(map[string]bool),
+	}
+}
+
+// Start implements manager.Runnable. As it doesn't implement
+// LeaderElectionRunnable, it only runs on the leader.
+func (s *EntrySweeper) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(entrySweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if err := s.sweep(s.c.Ctx); err != nil {
+				s.c.Log.WithError(err).Error("Unable to sweep registration entries")
+			}
+		}
+	}
+}
+
+// sweep reports or deletes the entries of the cluster that have had no
+// SpiffeID resource for two consecutive sweeps
+func (s *EntrySweeper) sweep(ctx context.Context) error {
+	spiffeIDList := spiffeidv1beta1.SpiffeIDList{}
+	if err := s.c.Client.List(ctx, &spiffeIDList); err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(spiffeIDList.Items))
+	for _, spiffeID := range spiffeIDList.Items {
+		if spiffeID.Status.EntryId != nil {
+			known[*spiffeID.Status.EntryId] = true
+		}
+		for _, entryID := range spiffeID.Status.NodeAliasEntryIds {
+			known[entryID] = true
+		}
+	}
+
+	entries, err := s.listClusterEntries(ctx)
+	if err != nil {
+		return err
+	}
+
+	candidates := make(map[string]bool)
+	var orphans int
+	for _, entry := range entries {
+		if known[entry.Id] {
+			continue
+		}
+		if !s.candidates[entry.Id] {
+			candidates[entry.Id] = true
+			continue
+		}
+		orphans++
+
+		log := s.c.Log.WithFields(logrus.Fields{
+			"entryID":  entry.Id,
+			"spiffeID": spiffeIDString(entry.SpiffeId),
+			"parentID": spiffeIDString(entry.ParentId),
+		})
+		if s.c.Action != EntrySweepPrune {
+			log.Warn("Found registration entry without SpiffeID resource (dry run, not deleted)")
+			candidates[entry.Id] = true
+			continue
+		}
+		if err := deleteRegistrationEntry(ctx, s.c.E, entry.Id); err != nil {
+			log.WithError(err).Error("Unable to delete registration entry without SpiffeID resource")
+			candidates[entry.Id] = true
+			continue
+		}
+		log.Info("Deleted registration entry without SpiffeID resource")
+	}
+	s.candidates = candidates
+	orphanedEntries.Set(float64(orphans))
+	return nil
+}
+
+// listClusterEntries returns the entries parented to or identifying the
+// nodes of the cluster
+func (s *EntrySweeper) listClusterEntries(ctx context.Context) ([]*types.Entry, error) {
+	var entries []*types.Entry
+	pageToken := ""
+	for {
+		resp, err := s.c.E.ListEntries(ctx, &entryv1.ListEntriesRequest{
+			OutputMask: &types.EntryMask{SpiffeId: true, ParentId: true},
+			PageSize:   entriesPageSize,
+			PageToken:  pageToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range resp.Entries {
+			if isClusterEntry(s.c.TrustDomain, s.c.Cluster, entry) {
+				entries = append(entries, entry)
+			}
+		}
+		if resp.NextPageToken == "" {
+			return entries, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// isClusterEntry returns true if the entry is parented to or identifies a
+// node of the cluster, i.e. its parent or SPIFFE ID is under
+// spiffe://<trust domain>/k8s-workload-registrar/<cluster>/
+func isClusterEntry(trustDomain, cluster string, entry *types.Entry) bool {
+	prefix := "/k8s-workload-registrar/" + cluster + "/"
+	for _, id := range []*types.SPIFFEID{entry.ParentId, entry.SpiffeId} {
+		if id != nil && id.TrustDomain == trustDomain && strings.HasPrefix(id.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/spiffe/spire/test/fakes/fakeentryclient"
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake" // nolint: staticcheck // No longer deprecated in newer versions.
+)
+
+func TestEntrySweeper(t *testing.T) {
+	require.NoError(t, spiffeidv1beta1.AddToScheme(scheme.Scheme))
+
+	for _, action := range []string{EntrySweepReport, EntrySweepPrune} {
+		action := action
+		t.Run(action, func(t *testing.T) {
+			ctx := context.Background()
+			log, _ := test.NewNullLogger()
+			entryClient := fakeentryclient.New(t, spiffeid.RequireTrustDomainFromString(TrustDomain), nil, nil)
+
+			nodeID := "/k8s-workload-registrar/" + Cluster + "/node/node-1"
+			backed := createSweepEntry(ctx, t, entryClient, nodeID, "/backed")
+			orphan := createSweepEntry(ctx, t, entryClient, nodeID, "/orphan")
+			other := createSweepEntry(ctx, t, entryClient, "/k8s-workload-registrar/other-cluster/node/node-1", "/other")
+
+			k8sClient := fake.NewFakeClientWithScheme(scheme.Scheme, &spiffeidv1beta1.SpiffeID{
+				ObjectMeta: metav1.ObjectMeta{Name: "backed", Namespace: "default"},
+				Status:     spiffeidv1beta1.SpiffeIDStatus{EntryId: &backed},
+			})
+
+			s := NewEntrySweeper(EntrySweeperConfig{
+				Action:      action,
+				Client:      k8sClient,
+				Cluster:     Cluster,
+				E:           entryClient,
+				Log:         log,
+				TrustDomain: TrustDomain,
+			})
+
+			// Entries are only handled once found in two consecutive sweeps
+			require.NoError(t, s.sweep(ctx))
+			require.ElementsMatch(t, []string{backed, orphan, other}, listSweepEntryIDs(ctx, t, entryClient))
+
+			require.NoError(t, s.sweep(ctx))
+			if action == EntrySweepPrune {
+				require.ElementsMatch(t, []string{backed, other}, listSweepEntryIDs(ctx, t, entryClient))
+			} else {
+				require.ElementsMatch(t, []string{backed, orphan, other}, listSweepEntryIDs(ctx, t, entryClient))
+			}
+		})
+	}
+}
+
+func TestIsClusterEntry(t *testing.T) {
+	id := func(path string) *types.SPIFFEID {
+		return &types.SPIFFEID{TrustDomain: TrustDomain, Path: path}
+	}
+
+	require.True(t, isClusterEntry(TrustDomain, Cluster, &types.Entry{
+		ParentId: id("/k8s-workload-registrar/" + Cluster + "/node/node-1"),
+		SpiffeId: id("/ns/default/sa/default"),
+	}))
+	require.True(t, isClusterEntry(TrustDomain, Cluster, &types.Entry{
+		ParentId: id("/spire/server"),
+		SpiffeId: id("/k8s-workload-registrar/" + Cluster + "/node/node-1"),
+	}))
+	require.False(t, isClusterEntry(TrustDomain, Cluster, &types.Entry{
+		ParentId: id("/k8s-workload-registrar/" + Cluster + "-2/node/node-1"),
+		SpiffeId: id("/ns/default/sa/default"),
+	}))
+	require.False(t, isClusterEntry("other.org", Cluster, &types.Entry{
+		ParentId: id("/k8s-workload-registrar/" + Cluster + "/node/node-1"),
+		SpiffeId: id("/ns/default/sa/default"),
+	}))
+}
+
+func createSweepEntry(ctx context.Context, t *testing.T, entryClient entryv1.EntryClient, parentPath, path string) string {
+	resp, err := entryClient.BatchCreateEntry(ctx, &entryv1.BatchCreateEntryRequest{
+		Entries: []*types.Entry{{
+			ParentId:  &types.SPIFFEID{TrustDomain: TrustDomain, Path: parentPath},
+			SpiffeId:  &types.SPIFFEID{TrustDomain: TrustDomain, Path: path},
+			Selectors: []*types.Selector{{Type: "k8s", Value: "ns:default"}},
+		}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, errorFromStatus(resp.Results[0].Status))
+	return resp.Results[0].Entry.Id
+}
+
+func listSweepEntryIDs(ctx context.Context, t *testing.T, entryClient entryv1.EntryClient) []string {
+	resp, err := entryClient.ListEntries(ctx, &entryv1.ListEntriesRequest{})
+	require.NoError(t, err)
+	var ids []string
+	for _, entry := range resp.Entries {
+		ids = append(ids, entry.Id)
+	}
+	return ids
+}
@@ -0,0 +1,259 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	federationPolicyReasonApplied = "Applied"
+	federationPolicyReasonInvalid = "InvalidSpec"
+)
+
+// validateFederationPolicy returns why the FederationPolicy spec is invalid,
+// if it is
+func validateFederationPolicy(trustDomain string, spec *spiffeidv1beta1.FederationPolicySpec) []string {
+	var errs []string
+	if len(spec.SpiffeIDs) == 0 {
+		errs = append(errs, "spiffeIDs must not be empty")
+	}
+	prefix := "spiffe://" + trustDomain + "/"
+	for _, pattern := range spec.SpiffeIDs {
+		if !strings.HasPrefix(pattern, prefix) {
+			errs = append(errs, fmt.Sprintf("invalid SPIFFE ID pattern %q: must start with %q", pattern, prefix))
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid SPIFFE ID pattern %q: %v", pattern, err))
+		}
+	}
+
+	if len(spec.FederatesWith) == 0 {
+		errs = append(errs, "federatesWith must not be empty")
+	}
+	for _, federatesWith := range spec.FederatesWith {
+		td, err := spiffeid.TrustDomainFromString(federatesWith)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Sprintf("invalid trust domain %q: %v", federatesWith, err))
+		case td.String() == trustDomain:
+			errs = append(errs, fmt.Sprintf("invalid trust domain %q: cannot federate with the trust domain of the cluster", federatesWith))
+		}
+	}
+	return errs
+}
+
+// federationPolicyDomains returns the trust domains the valid policies
+// federate the SPIFFE ID with, sorted
+func federationPolicyDomains(trustDomain string, policies []spiffeidv1beta1.FederationPolicy, spiffeID string) []string {
+	domains := make(map[string]struct{})
+	for i := range policies {
+		spec := &policies[i].Spec
+		if len(validateFederationPolicy(trustDomain, spec)) > 0 || !matchesAny(spec.SpiffeIDs, spiffeID) {
+			continue
+		}
+		for _, federatesWith := range spec.FederatesWith {
+			// Validated above
+			td, _ := spiffeid.TrustDomainFromString(federatesWith)
+			domains[td.String()] = struct{}{}
+		}
+	}
+
+	sorted := make([]string, 0, len(domains))
+	for domain := range domains {
+		sorted = append(sorted, domain)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// matchesAny returns true if the SPIFFE ID matches one of the patterns
+func matchesAny(patterns []string, spiffeID string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, spiffeID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeFederatesWith appends the trust domains of the policies to those
+// requested by the pod, unless already requested
+func mergeFederatesWith(requested, policyDomains []string) []string {
+	seen := make(map[string]bool, len(requested))
+	for _, federatesWith := range requested {
+		seen[normalizeTrustDomain(federatesWith)] = true
+	}
+
+	merged := requested
+	for _, domain := range policyDomains {
+		if !seen[domain] {
+			merged = append(merged, domain)
+		}
+	}
+	return merged
+}
+
+// normalizeTrustDomain returns the name of the trust domain, which may be
+// given as a SPIFFE ID, or the trust domain as is if it is invalid
+func normalizeTrustDomain(trustDomain string) string {
+	td, err := spiffeid.TrustDomainFromString(trustDomain)
+	if err != nil {
+		return trustDomain
+	}
+	return td.String()
+}
+
+// federationPolicies returns the FederationPolicy resources of the namespace,
+// or none if federation policies are not enabled
+func (r *PodReconciler) federationPolicies(ctx context.Context, namespace string) ([]spiffeidv1beta1.FederationPolicy, error) {
+	if !r.c.FederationPolicies {
+		return nil, nil
+	}
+
+	policyList := spiffeidv1beta1.FederationPolicyList{}
+	if err := r.List(ctx, &policyList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	return policyList.Items, nil
+}
+
+// federationPolicyPods returns a reconcile request for each pod of the
+// namespace of the FederationPolicy resource
+func (r *PodReconciler) federationPolicyPods(a handler.MapObject) []reconcile.Request {
+	return r.podsInNamespace(a.Meta.GetNamespace())
+}
+
+// FederationPolicyReconcilerConfig holds the config passed in when creating
+// the reconciler
+type FederationPolicyReconcilerConfig struct {
+	Client      client.Client
+	Ctx         context.Context
+	Log         logrus.FieldLogger
+	TrustDomain string
+}
+
+// FederationPolicyReconciler validates the FederationPolicy resources and
+// reports in their status whether they are applied. The policies are applied
+// by the PodReconciler when deriving the SpiffeID resources of the pods.
+type FederationPolicyReconciler struct {
+	client.Client
+	c FederationPolicyReconcilerConfig
+}
+
+// NewFederationPolicyReconciler creates a new FederationPolicyReconciler object
+func NewFederationPolicyReconciler(config FederationPolicyReconcilerConfig) *FederationPolicyReconciler {
+	return &FederationPolicyReconciler{
+		Client: config.Client,
+		c:      config,
+	}
+}
+
+// SetupWithManager adds a controller manager to manage this reconciler
+func (r *FederationPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&spiffeidv1beta1.FederationPolicy{}).
+		Complete(r)
+}
+
+// Reconcile validates the FederationPolicy resource and updates its status
+func (r *FederationPolicyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := r.c.Ctx
+	log := r.c.Log.WithFields(logrus.Fields{
+		"name":      req.Name,
+		"namespace": req.Namespace,
+	})
+
+	policy := spiffeidv1beta1.FederationPolicy{}
+	if err := r.Get(ctx, req.NamespacedName, &policy); err != nil {
+		if !errors.IsNotFound(err) {
+			log.WithError(err).Error("Unable to get FederationPolicy")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	validationErrors := validateFederationPolicy(r.c.TrustDomain, &policy.Spec)
+	if len(validationErrors) > 0 && policy.Status.ObservedGeneration != policy.Generation {
+		log.WithField("errors", strings.Join(validationErrors, "; ")).Warn("Not applying invalid FederationPolicy")
+	}
+
+	return ctrl.Result{}, r.updateStatus(ctx, req.NamespacedName, validationErrors)
+}
+
+// updateStatus sets the Applied condition and the validation errors of the
+// FederationPolicy resource, if they changed
+func (r *FederationPolicyReconciler) updateStatus(ctx context.Context, key client.ObjectKey, validationErrors []string) error {
+	condition := spiffeidv1beta1.FederationPolicyCondition{
+		Type:    spiffeidv1beta1.FederationPolicyConditionApplied,
+		Status:  corev1.ConditionTrue,
+		Reason:  federationPolicyReasonApplied,
+		Message: "Policy applied to the matching SPIFFE IDs of the namespace",
+	}
+	if len(validationErrors) > 0 {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = federationPolicyReasonInvalid
+		condition.Message = "Spec rejected, the policy applies to no SPIFFE ID"
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		policy := spiffeidv1beta1.FederationPolicy{}
+		if err := r.Get(ctx, key, &policy); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		status := spiffeidv1beta1.FederationPolicyStatus{
+			ObservedGeneration: policy.Generation,
+			ValidationErrors:   validationErrors,
+		}
+		condition.LastTransitionTime = metav1.Now()
+		for _, current := range policy.Status.Conditions {
+			if current.Type != condition.Type {
+				status.Conditions = append(status.Conditions, current)
+				continue
+			}
+			if current.Status == condition.Status {
+				condition.LastTransitionTime = current.LastTransitionTime
+			}
+		}
+		status.Conditions = append(status.Conditions, condition)
+
+		if reflect.DeepEqual(policy.Status, status) {
+			return nil
+		}
+		policy.Status = status
+		return r.Status().Update(ctx, &policy)
+	})
+}
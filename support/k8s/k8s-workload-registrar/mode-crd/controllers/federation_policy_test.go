@@ -0,0 +1,215 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/federation"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake" // nolint: staticcheck // No longer deprecated in newer versions.
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+func TestValidateFederationPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		spec spiffeidv1beta1.FederationPolicySpec
+		errs []string
+	}{
+		{
+			name: "valid",
+			spec: spiffeidv1beta1.FederationPolicySpec{
+				SpiffeIDs:     []string{"spiffe://example.org/ns/payments/sa/*", "spiffe://example.org/web"},
+				FederatesWith: []string{"domain1.test", "spiffe://domain2.test"},
+			},
+		},
+		{
+			name: "empty",
+			errs: []string{"spiffeIDs must not be empty", "federatesWith must not be empty"},
+		},
+		{
+			name: "invalid patterns",
+			spec: spiffeidv1beta1.FederationPolicySpec{
+				SpiffeIDs:     []string{"spiffe://other.test/web", "spiffe://example.org/[web"},
+				FederatesWith: []string{"domain1.test"},
+			},
+			errs: []string{
+				`invalid SPIFFE ID pattern "spiffe://other.test/web": must start with "spiffe://example.org/"`,
+				`invalid SPIFFE ID pattern "spiffe://example.org/[web": syntax error in pattern`,
+			},
+		},
+		{
+			name: "invalid trust domains",
+			spec: spiffeidv1beta1.FederationPolicySpec{
+				SpiffeIDs:     []string{"spiffe://example.org/web"},
+				FederatesWith: []string{"example.org", "http://domain1.test"},
+			},
+			errs: []string{
+				`invalid trust domain "example.org": cannot federate with the trust domain of the cluster`,
+				`invalid trust domain "http://domain1.test": spiffeid: invalid scheme`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.errs, validateFederationPolicy(TrustDomain, &tt.spec))
+		})
+	}
+}
+
+func TestFederationPolicyReconciler(t *testing.T) {
+	require.NoError(t, spiffeidv1beta1.AddToScheme(scheme.Scheme))
+
+	ctx := context.Background()
+	log, _ := test.NewNullLogger()
+	key := types.NamespacedName{Namespace: PodNamespace, Name: "partners"}
+	k8sClient := fake.NewFakeClientWithScheme(scheme.Scheme)
+
+	r := NewFederationPolicyReconciler(FederationPolicyReconcilerConfig{
+		Client:      k8sClient,
+		Ctx:         ctx,
+		Log:         log,
+		TrustDomain: TrustDomain,
+	})
+	reconcile := func() {
+		_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+		require.NoError(t, err)
+	}
+	requireStatus := func(status corev1.ConditionStatus, reason string, validationErrors []string) {
+		policy := spiffeidv1beta1.FederationPolicy{}
+		require.NoError(t, k8sClient.Get(ctx, key, &policy))
+		require.Len(t, policy.Status.Conditions, 1)
+		require.Equal(t, spiffeidv1beta1.FederationPolicyConditionApplied, policy.Status.Conditions[0].Type)
+		require.Equal(t, status, policy.Status.Conditions[0].Status)
+		require.Equal(t, reason, policy.Status.Conditions[0].Reason)
+		require.Equal(t, validationErrors, policy.Status.ValidationErrors)
+	}
+
+	// Deleted policies are ignored
+	reconcile()
+
+	policy := &spiffeidv1beta1.FederationPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Spec: spiffeidv1beta1.FederationPolicySpec{
+			SpiffeIDs:     []string{"spiffe://example.org/web"},
+			FederatesWith: []string{"domain1.test"},
+		},
+	}
+	require.NoError(t, k8sClient.Create(ctx, policy))
+	reconcile()
+	requireStatus(corev1.ConditionTrue, federationPolicyReasonApplied, nil)
+
+	require.NoError(t, k8sClient.Get(ctx, key, policy))
+	policy.Spec.FederatesWith = []string{"example.org"}
+	require.NoError(t, k8sClient.Update(ctx, policy))
+	reconcile()
+	requireStatus(corev1.ConditionFalse, federationPolicyReasonInvalid, []string{
+		`invalid trust domain "example.org": cannot federate with the trust domain of the cluster`,
+	})
+}
+
+func TestPodReconcilerFederationPolicies(t *testing.T) {
+	require.NoError(t, spiffeidv1beta1.AddToScheme(scheme.Scheme))
+
+	ctx := context.Background()
+	log, _ := test.NewNullLogger()
+	k8sClient := fake.NewFakeClientWithScheme(scheme.Scheme)
+
+	r := NewPodReconciler(PodReconcilerConfig{
+		Client:             k8sClient,
+		Cluster:            Cluster,
+		Ctx:                ctx,
+		FederationPolicies: true,
+		Log:                log,
+		PodLabel:           "spiffe",
+		Scheme:             scheme.Scheme,
+		TrustDomain:        TrustDomain,
+	})
+	reconcile := func() {
+		_, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: PodNamespace, Name: PodName}})
+		require.NoError(t, err)
+	}
+	requireFederatesWith := func(expected []string) {
+		spiffeIDs := spiffeidv1beta1.SpiffeIDList{}
+		require.NoError(t, k8sClient.List(ctx, &spiffeIDs, client.InNamespace(PodNamespace)))
+		require.Len(t, spiffeIDs.Items, 1)
+		require.Equal(t, expected, spiffeIDs.Items[0].Spec.FederatesWith)
+	}
+	createPolicy := func(namespace, name string, spec spiffeidv1beta1.FederationPolicySpec) *spiffeidv1beta1.FederationPolicy {
+		policy := &spiffeidv1beta1.FederationPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       spec,
+		}
+		require.NoError(t, k8sClient.Create(ctx, policy))
+		return policy
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        PodName,
+			Namespace:   PodNamespace,
+			UID:         "uid",
+			Labels:      map[string]string{"spiffe": "web"},
+			Annotations: map[string]string{federation.FederationAnnotation: "domain1.test"},
+		},
+		Spec: corev1.PodSpec{NodeName: "node"},
+	}
+	require.NoError(t, k8sClient.Create(ctx, pod))
+	reconcile()
+	requireFederatesWith([]string{"domain1.test"})
+
+	// Only the valid policies of the namespace matching the SPIFFE ID of the
+	// pod apply, on top of the annotation
+	matching := createPolicy(PodNamespace, "matching", spiffeidv1beta1.FederationPolicySpec{
+		SpiffeIDs:     []string{"spiffe://example.org/db", "spiffe://example.org/w*"},
+		FederatesWith: []string{"spiffe://domain3.test", "domain1.test", "domain2.test"},
+	})
+	createPolicy(PodNamespace, "not-matching", spiffeidv1beta1.FederationPolicySpec{
+		SpiffeIDs:     []string{"spiffe://example.org/db"},
+		FederatesWith: []string{"domain4.test"},
+	})
+	createPolicy(PodNamespace, "invalid", spiffeidv1beta1.FederationPolicySpec{
+		SpiffeIDs:     []string{"spiffe://example.org/web"},
+		FederatesWith: []string{"domain5.test", "example.org"},
+	})
+	createPolicy("other", "other-namespace", spiffeidv1beta1.FederationPolicySpec{
+		SpiffeIDs:     []string{"spiffe://example.org/web"},
+		FederatesWith: []string{"domain6.test"},
+	})
+	reconcile()
+	requireFederatesWith([]string{"domain1.test", "domain2.test", "domain3.test"})
+
+	// The pods of the namespace are reconciled again when the policies change
+	requests := r.federationPolicyPods(handler.MapObject{Meta: matching, Object: matching})
+	require.Equal(t, []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: PodNamespace, Name: PodName}}}, requests)
+
+	require.NoError(t, k8sClient.Delete(ctx, matching))
+	reconcile()
+	requireFederatesWith([]string{"domain1.test"})
+}
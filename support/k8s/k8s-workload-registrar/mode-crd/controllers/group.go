@@ -0,0 +1,122 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// SpiffeIDGroupLabel is the label holding the group of a SpiffeID
+	// resource. It is set in the resource manifest, or by the pod controller
+	// from the pod label configured as the group label.
+	SpiffeIDGroupLabel = "spiffeid.spiffe.io/group"
+
+	// GroupActionDisable disables the SpiffeID resources of a group, which
+	// removes their registration entries
+	GroupActionDisable = "disable"
+	// GroupActionEnable enables the SpiffeID resources of a group again
+	GroupActionEnable = "enable"
+	// GroupActionDelete deletes the SpiffeID resources of a group, along
+	// with their registration entries
+	GroupActionDelete = "delete"
+)
+
+// ApplyGroupAction applies the action to all the SpiffeID resources of the
+// group, in the given namespace or in all namespaces if empty, and returns
+// the namespaced names of the resources affected. The registration entries are
+// updated by the SpiffeID controller as it reconciles the resources.
+func ApplyGroupAction(ctx context.Context, c client.Client, action, group, namespace string) ([]string, error) {
+	switch action {
+	case GroupActionDisable, GroupActionEnable, GroupActionDelete:
+	default:
+		return nil, fmt.Errorf("invalid group action %q, valid values are %s, %s and %s", action,
+			GroupActionDisable, GroupActionEnable, GroupActionDelete)
+	}
+	if group == "" {
+		return nil, errors.New("group is required")
+	}
+
+	opts := []client.ListOption{client.MatchingLabels{SpiffeIDGroupLabel: group}}
+	if namespace != "" {
+		opts = append(opts, client.InNamespace(namespace))
+	}
+
+	spiffeIDList := spiffeidv1beta1.SpiffeIDList{}
+	if err := c.List(ctx, &spiffeIDList, opts...); err != nil {
+		return nil, fmt.Errorf("unable to list SpiffeID resources of group %q: %w", group, err)
+	}
+
+	var affected []string
+	for i := range spiffeIDList.Items {
+		spiffeID := &spiffeIDList.Items[i]
+		key := client.ObjectKey{Namespace: spiffeID.Namespace, Name: spiffeID.Name}
+
+		var changed bool
+		var err error
+		if action == GroupActionDelete {
+			changed, err = deleteGroupSpiffeID(ctx, c, spiffeID)
+		} else {
+			changed, err = setSpiffeIDDisabled(ctx, c, key, action == GroupActionDisable)
+		}
+		if err != nil {
+			return affected, fmt.Errorf("unable to %s SpiffeID resource %s: %w", action, key, err)
+		}
+		if changed {
+			affected = append(affected, key.String())
+		}
+	}
+
+	return affected, nil
+}
+
+func deleteGroupSpiffeID(ctx context.Context, c client.Client, spiffeID *spiffeidv1beta1.SpiffeID) (bool, error) {
+	if err := c.Delete(ctx, spiffeID); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func setSpiffeIDDisabled(ctx context.Context, c client.Client, key client.ObjectKey, disabled bool) (bool, error) {
+	var changed bool
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		spiffeID := spiffeidv1beta1.SpiffeID{}
+		if err := c.Get(ctx, key, &spiffeID); err != nil {
+			return err
+		}
+		if spiffeID.Spec.Disabled == disabled {
+			changed = false
+			return nil
+		}
+		spiffeID.Spec.Disabled = disabled
+		changed = true
+		return c.Update(ctx, &spiffeID)
+	})
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	return changed, err
+}
@@ -0,0 +1,99 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestApplyGroupAction(t *testing.T) {
+	s := NewCommonControllerTestSuite(t)
+
+	createGroupSpiffeID := func(name, namespace, group string) {
+		spiffeID := &spiffeidv1beta1.SpiffeID{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: spiffeidv1beta1.SpiffeIDSpec{
+				SpiffeId: makeID(s.trustDomain, "%s", name),
+				ParentId: makeID(s.trustDomain, "spire/server"),
+				Selector: spiffeidv1beta1.Selector{Namespace: namespace},
+			},
+		}
+		if group != "" {
+			spiffeID.Labels = map[string]string{SpiffeIDGroupLabel: group}
+		}
+		require.NoError(t, s.k8sClient.Create(s.ctx, spiffeID))
+	}
+	isDisabled := func(name, namespace string) bool {
+		spiffeID := &spiffeidv1beta1.SpiffeID{}
+		require.NoError(t, s.k8sClient.Get(s.ctx, client.ObjectKey{Name: name, Namespace: namespace}, spiffeID))
+		return spiffeID.Spec.Disabled
+	}
+
+	createGroupSpiffeID("a", "ns1", "payments")
+	createGroupSpiffeID("b", "ns2", "payments")
+	createGroupSpiffeID("c", "ns1", "billing")
+	createGroupSpiffeID("d", "ns1", "")
+
+	t.Run("invalid action", func(t *testing.T) {
+		_, err := ApplyGroupAction(s.ctx, s.k8sClient, "ban", "payments", "")
+		require.EqualError(t, err, `invalid group action "ban", valid values are disable, enable and delete`)
+	})
+
+	t.Run("missing group", func(t *testing.T) {
+		_, err := ApplyGroupAction(s.ctx, s.k8sClient, GroupActionDisable, "", "")
+		require.EqualError(t, err, "group is required")
+	})
+
+	t.Run("disable in namespace", func(t *testing.T) {
+		affected, err := ApplyGroupAction(s.ctx, s.k8sClient, GroupActionDisable, "payments", "ns1")
+		require.NoError(t, err)
+		require.Equal(t, []string{"ns1/a"}, affected)
+		require.True(t, isDisabled("a", "ns1"))
+		require.False(t, isDisabled("b", "ns2"))
+	})
+
+	t.Run("disable in all namespaces", func(t *testing.T) {
+		// Resources already disabled are not affected
+		affected, err := ApplyGroupAction(s.ctx, s.k8sClient, GroupActionDisable, "payments", "")
+		require.NoError(t, err)
+		require.Equal(t, []string{"ns2/b"}, affected)
+		require.True(t, isDisabled("b", "ns2"))
+		require.False(t, isDisabled("c", "ns1"))
+		require.False(t, isDisabled("d", "ns1"))
+	})
+
+	t.Run("enable", func(t *testing.T) {
+		affected, err := ApplyGroupAction(s.ctx, s.k8sClient, GroupActionEnable, "payments", "")
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"ns1/a", "ns2/b"}, affected)
+		require.False(t, isDisabled("a", "ns1"))
+		require.False(t, isDisabled("b", "ns2"))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		affected, err := ApplyGroupAction(s.ctx, s.k8sClient, GroupActionDelete, "billing", "")
+		require.NoError(t, err)
+		require.Equal(t, []string{"ns1/c"}, affected)
+		err = s.k8sClient.Get(s.ctx, client.ObjectKey{Name: "c", Namespace: "ns1"}, &spiffeidv1beta1.SpiffeID{})
+		require.True(t, k8serrors.IsNotFound(err))
+	})
+}
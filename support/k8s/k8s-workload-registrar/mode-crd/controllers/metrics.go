@@ -0,0 +1,73 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "k8s_workload_registrar"
+
+var (
+	identityCollisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "identity_collisions_total",
+		Help:      "Number of times a pod was found to resolve to a SPIFFE ID already used by an incompatible pod",
+	}, []string{"namespace", "policy"})
+	collidingIdentities = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "colliding_identities",
+		Help:      "Number of pod SPIFFE IDs currently colliding with the SPIFFE ID of an incompatible pod",
+	}, []string{"namespace", "policy"})
+	podRegistrationLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "pod_registration_latency_seconds",
+		Help:      "Time from the creation of a pod to the creation of its registration entry on the SPIRE server",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	})
+	specDrifts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "spiffeid_spec_drifts_total",
+		Help:      "Number of times the SpiffeID resource of a pod was found changed by hand, and reverted or flagged",
+	}, []string{"namespace", "policy"})
+	orphanedEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "orphaned_entries",
+		Help:      "Number of registration entries of the cluster found without SpiffeID resource by the last sweep",
+	})
+	nodeEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_entries",
+		Help:      "Number of registration entries parented to each node alias or agent",
+	}, []string{"parent_id"})
+	overBudgetNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "over_budget_nodes",
+		Help:      "Number of nodes found over their registration entry budget by the last check",
+	})
+	deferredSpiffeIDCreates = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "deferred_spiffeid_creates_total",
+		Help:      "Number of times the creation of the SpiffeID resource of a pod was deferred to a later batch",
+	})
+)
+
+func init() {
+	// Metrics are served by the controller manager on metrics_bind_addr
+	metrics.Registry.MustRegister(identityCollisions, collidingIdentities, podRegistrationLatency, specDrifts, orphanedEntries,
+		nodeEntries, overBudgetNodes, deferredSpiffeIDCreates)
+}
@@ -0,0 +1,187 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/spiffe/spire/pkg/common/idutil"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// NodeAttestorK8sPSAT is used when agents are attested with k8s_psat. Node
+	// alias entries are created for each node and used as parent of pod entries
+	NodeAttestorK8sPSAT = "k8s_psat"
+	// NodeAttestorAWSIID is used when agents are attested with aws_iid
+	NodeAttestorAWSIID = "aws_iid"
+	// NodeAttestorGCPIIT is used when agents are attested with gcp_iit
+	NodeAttestorGCPIIT = "gcp_iit"
+	// NodeAttestorAzureMSI is used when agents are attested with azure_msi
+	NodeAttestorAzureMSI = "azure_msi"
+
+	// gcpInstanceIDAnnotation is set by GKE on nodes with the ID of the backing instance
+	gcpInstanceIDAnnotation = "container.googleapis.com/instance_id"
+	// AzurePrincipalIDAnnotation can be set on nodes with the principal ID of
+	// the managed identity of the backing VM
+	AzurePrincipalIDAnnotation = "spiffe.io/azure-principal-id"
+)
+
+var defaultAgentPathTemplates = map[string]*template.Template{
+	NodeAttestorAWSIID:   template.Must(template.New("agent-path").Parse("{{ .PluginName }}/{{ .AccountID }}/{{ .Region }}/{{ .InstanceID }}")),
+	NodeAttestorGCPIIT:   template.Must(template.New("agent-path").Parse("{{ .PluginName }}/{{ .ProjectID }}/{{ .InstanceID }}")),
+	NodeAttestorAzureMSI: template.Must(template.New("agent-path").Parse("{{ .PluginName }}/{{ .TenantID }}/{{ .PrincipalID }}")),
+}
+
+// NodeAttestorConfig describes how the agents running on the cluster nodes
+// are attested, so pod entries can be parented directly to the agent ID when
+// node alias entries cannot be used.
+type NodeAttestorConfig struct {
+	// Name of the node attestor used by the agents
+	Name string
+	// AgentPathTemplate overrides the default agent path for the node
+	// attestor. It must match the agent_path_template configured on the
+	// server node attestor, if any.
+	AgentPathTemplate string
+	// AWSAccountID is the AWS account of the nodes, used by aws_iid
+	AWSAccountID string
+	// AzureTenantID is the tenant of the node managed identity, used by azure_msi
+	AzureTenantID string
+	// AzurePrincipalID is the principal ID of a managed identity shared by
+	// all the nodes, used by azure_msi for nodes without the
+	// AzurePrincipalIDAnnotation annotation
+	AzurePrincipalID string
+}
+
+// agentPathTemplateData holds the values available to agent path templates
+type agentPathTemplateData struct {
+	PluginName  string
+	NodeName    string
+	AccountID   string
+	ProjectID   string
+	Region      string
+	Zone        string
+	InstanceID  string
+	TenantID    string
+	PrincipalID string
+}
+
+// ParseAgentPathTemplate validates the agent path template of the config, if any
+func (c NodeAttestorConfig) ParseAgentPathTemplate() (*template.Template, error) {
+	if c.AgentPathTemplate == "" {
+		tmpl, ok := defaultAgentPathTemplates[c.Name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported node attestor %q", c.Name)
+		}
+		return tmpl, nil
+	}
+	return template.New("agent-path").Parse(c.AgentPathTemplate)
+}
+
+// agentIDForNode returns the SPIFFE ID of the agent running on the given node,
+// derived from the provider ID of the node as the server node attestor would.
+func agentIDForNode(trustDomain string, config NodeAttestorConfig, node *corev1.Node) (string, error) {
+	tmpl, err := config.ParseAgentPathTemplate()
+	if err != nil {
+		return "", err
+	}
+
+	data := agentPathTemplateData{
+		PluginName: config.Name,
+		NodeName:   node.Name,
+	}
+
+	switch config.Name {
+	case NodeAttestorAWSIID:
+		// aws:///<zone>/<instance-id>
+		parts, err := splitProviderID(node.Spec.ProviderID, "aws", 2)
+		if err != nil {
+			return "", err
+		}
+		data.AccountID = config.AWSAccountID
+		data.Zone = parts[0]
+		data.InstanceID = parts[1]
+		// The region can't be reliably derived from the zone, e.g. for Local Zones
+		data.Region = nodeRegion(node)
+		if data.Region == "" {
+			return "", fmt.Errorf("node %q is missing the %q label", node.Name, corev1.LabelZoneRegionStable)
+		}
+	case NodeAttestorGCPIIT:
+		// gce://<project>/<zone>/<instance-name>
+		parts, err := splitProviderID(node.Spec.ProviderID, "gce", 3)
+		if err != nil {
+			return "", err
+		}
+		data.ProjectID = parts[0]
+		data.Zone = parts[1]
+		data.InstanceID = node.Annotations[gcpInstanceIDAnnotation]
+		if data.InstanceID == "" {
+			return "", fmt.Errorf("node %q is missing the %q annotation", node.Name, gcpInstanceIDAnnotation)
+		}
+	case NodeAttestorAzureMSI:
+		data.TenantID = config.AzureTenantID
+		// Each VM has its own system-assigned identity, unless the nodes
+		// share a user-assigned identity
+		data.PrincipalID = node.Annotations[AzurePrincipalIDAnnotation]
+		if data.PrincipalID == "" {
+			data.PrincipalID = config.AzurePrincipalID
+		}
+		if data.PrincipalID == "" {
+			return "", fmt.Errorf("node %q is missing the %q annotation", node.Name, AzurePrincipalIDAnnotation)
+		}
+	default:
+		return "", fmt.Errorf("unsupported node attestor %q", config.Name)
+	}
+
+	var agentPath bytes.Buffer
+	if err := tmpl.Execute(&agentPath, data); err != nil {
+		return "", err
+	}
+
+	return idutil.AgentURI(trustDomain, agentPath.String()).String(), nil
+}
+
+// nodeRegion returns the region of the node from its well-known topology labels
+func nodeRegion(node *corev1.Node) string {
+	if region := node.Labels[corev1.LabelZoneRegionStable]; region != "" {
+		return region
+	}
+	return node.Labels[corev1.LabelZoneRegion]
+}
+
+// splitProviderID splits the path of a node provider ID with the given scheme
+// into the expected number of segments
+func splitProviderID(providerID, scheme string, segments int) ([]string, error) {
+	prefix := scheme + "://"
+	if !strings.HasPrefix(providerID, prefix) {
+		return nil, fmt.Errorf("provider ID %q does not have the %q prefix", providerID, prefix)
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(providerID, prefix), "/"), "/")
+	if len(parts) != segments {
+		return nil, fmt.Errorf("malformed provider ID %q", providerID)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("malformed provider ID %q", providerID)
+		}
+	}
+
+	return parts, nil
+}
@@ -0,0 +1,173 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAgentIDForNode(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      NodeAttestorConfig
+		providerID  string
+		labels      map[string]string
+		annotations map[string]string
+		expected    string
+		err         string
+	}{
+		{
+			name: "aws_iid",
+			config: NodeAttestorConfig{
+				Name:         NodeAttestorAWSIID,
+				AWSAccountID: "123456789012",
+			},
+			providerID: "aws:///us-east-1a/i-0123456789abcdef0",
+			labels:     map[string]string{corev1.LabelZoneRegionStable: "us-east-1"},
+			expected:   "spiffe://example.org/spire/agent/aws_iid/123456789012/us-east-1/i-0123456789abcdef0",
+		},
+		{
+			name: "aws_iid in a local zone",
+			config: NodeAttestorConfig{
+				Name:         NodeAttestorAWSIID,
+				AWSAccountID: "123456789012",
+			},
+			providerID: "aws:///us-west-2-lax-1a/i-0123456789abcdef0",
+			labels:     map[string]string{corev1.LabelZoneRegionStable: "us-west-2"},
+			expected:   "spiffe://example.org/spire/agent/aws_iid/123456789012/us-west-2/i-0123456789abcdef0",
+		},
+		{
+			name: "aws_iid with beta region label",
+			config: NodeAttestorConfig{
+				Name:         NodeAttestorAWSIID,
+				AWSAccountID: "123456789012",
+			},
+			providerID: "aws:///us-east-1a/i-0123456789abcdef0",
+			labels:     map[string]string{corev1.LabelZoneRegion: "us-east-1"},
+			expected:   "spiffe://example.org/spire/agent/aws_iid/123456789012/us-east-1/i-0123456789abcdef0",
+		},
+		{
+			name: "aws_iid without region label",
+			config: NodeAttestorConfig{
+				Name:         NodeAttestorAWSIID,
+				AWSAccountID: "123456789012",
+			},
+			providerID: "aws:///us-east-1a/i-0123456789abcdef0",
+			err:        `node "test-node" is missing the "topology.kubernetes.io/region" label`,
+		},
+		{
+			name: "aws_iid with malformed provider ID",
+			config: NodeAttestorConfig{
+				Name:         NodeAttestorAWSIID,
+				AWSAccountID: "123456789012",
+			},
+			providerID: "aws:///i-0123456789abcdef0",
+			err:        `malformed provider ID "aws:///i-0123456789abcdef0"`,
+		},
+		{
+			name: "aws_iid with custom template",
+			config: NodeAttestorConfig{
+				Name:              NodeAttestorAWSIID,
+				AgentPathTemplate: "{{ .PluginName }}/{{ .Zone }}/{{ .NodeName }}",
+			},
+			providerID: "aws:///us-east-1a/i-0123456789abcdef0",
+			labels:     map[string]string{corev1.LabelZoneRegionStable: "us-east-1"},
+			expected:   "spiffe://example.org/spire/agent/aws_iid/us-east-1a/test-node",
+		},
+		{
+			name:        "gcp_iit",
+			config:      NodeAttestorConfig{Name: NodeAttestorGCPIIT},
+			providerID:  "gce://my-project/us-central1-a/gke-node-1",
+			annotations: map[string]string{gcpInstanceIDAnnotation: "1234567890"},
+			expected:    "spiffe://example.org/spire/agent/gcp_iit/my-project/1234567890",
+		},
+		{
+			name:       "gcp_iit without instance ID",
+			config:     NodeAttestorConfig{Name: NodeAttestorGCPIIT},
+			providerID: "gce://my-project/us-central1-a/gke-node-1",
+			err:        `node "test-node" is missing the "container.googleapis.com/instance_id" annotation`,
+		},
+		{
+			name:       "gcp_iit with wrong provider",
+			config:     NodeAttestorConfig{Name: NodeAttestorGCPIIT},
+			providerID: "aws:///us-east-1a/i-0123456789abcdef0",
+			err:        `does not have the "gce://" prefix`,
+		},
+		{
+			name: "azure_msi",
+			config: NodeAttestorConfig{
+				Name:          NodeAttestorAzureMSI,
+				AzureTenantID: "TENANTID",
+			},
+			providerID:  "azure:///subscriptions/SUB/resourceGroups/RG/providers/Microsoft.Compute/virtualMachines/vm",
+			annotations: map[string]string{AzurePrincipalIDAnnotation: "NODEPRINCIPALID"},
+			expected:    "spiffe://example.org/spire/agent/azure_msi/TENANTID/NODEPRINCIPALID",
+		},
+		{
+			name: "azure_msi with shared identity",
+			config: NodeAttestorConfig{
+				Name:             NodeAttestorAzureMSI,
+				AzureTenantID:    "TENANTID",
+				AzurePrincipalID: "PRINCIPALID",
+			},
+			providerID: "azure:///subscriptions/SUB/resourceGroups/RG/providers/Microsoft.Compute/virtualMachines/vm",
+			expected:   "spiffe://example.org/spire/agent/azure_msi/TENANTID/PRINCIPALID",
+		},
+		{
+			name: "azure_msi without principal ID",
+			config: NodeAttestorConfig{
+				Name:          NodeAttestorAzureMSI,
+				AzureTenantID: "TENANTID",
+			},
+			providerID: "azure:///subscriptions/SUB/resourceGroups/RG/providers/Microsoft.Compute/virtualMachines/vm",
+			err:        `node "test-node" is missing the "spiffe.io/azure-principal-id" annotation`,
+		},
+		{
+			name:   "unsupported",
+			config: NodeAttestorConfig{Name: "x509pop"},
+			err:    `unsupported node attestor "x509pop"`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test-node",
+					Labels:      test.labels,
+					Annotations: test.annotations,
+				},
+				Spec: corev1.NodeSpec{
+					ProviderID: test.providerID,
+				},
+			}
+
+			agentID, err := agentIDForNode(TrustDomain, test.config, node)
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, agentID)
+		})
+	}
+}
@@ -104,6 +104,7 @@ func (n *NodeReconciler) updateorCreateNodeEntry(ctx context.Context, node *core
 				Cluster:      n.c.Cluster,
 				AgentNodeUid: node.ObjectMeta.UID,
 			},
+			Ownership: spiffeidv1beta1.OwnershipRegistrar,
 		},
 	}
 	err = setOwnerRef(node, spiffeID, n.c.Scheme)
@@ -126,6 +127,14 @@ func (n *NodeReconciler) updateorCreateNodeEntry(ctx context.Context, node *core
 		return ctrl.Result{}, err
 	}
 
+	// A resource of a user with the name of the node is never replaced
+	if existing.Ownership() != spiffeidv1beta1.OwnershipRegistrar {
+		n.c.Log.WithFields(logrus.Fields{
+			"node":      node.Name,
+			"namespace": spiffeID.Namespace,
+		}).Warn("Not registering node whose SpiffeID resource name is taken by a resource owned by a user")
+	}
+
 	// Nothing to do
 	return ctrl.Result{}, nil
 }
@@ -0,0 +1,136 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/idutil"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+)
+
+// nodeSelectorAliasID returns the SPIFFE ID of the node alias entries created
+// for the nodeSelector of the SpiffeID resource, to which its entry is parented
+func (r *SpiffeIDReconciler) nodeSelectorAliasID(spiffeID *spiffeidv1beta1.SpiffeID) string {
+	return makeID(r.c.TrustDomain, "k8s-workload-registrar/%s/node-selector/%s/%s", r.c.Cluster, spiffeID.Namespace, spiffeID.Name)
+}
+
+// entryParentID returns the parent ID of the entry of the SpiffeID resource
+func (r *SpiffeIDReconciler) entryParentID(spiffeID *spiffeidv1beta1.SpiffeID) string {
+	if spiffeID.Spec.NodeSelector != nil {
+		return r.nodeSelectorAliasID(spiffeID)
+	}
+	return spiffeID.Spec.ParentId
+}
+
+// syncNodeAliasEntries creates the node alias entries of the nodeSelector of
+// the SpiffeID resource that don't exist yet. It returns the IDs of the node
+// alias entries of the nodeSelector, and those of the stale ones, e.g. left
+// behind by a previous nodeSelector, which are to be deleted once the entry of
+// the resource no longer relies on them.
+func (r *SpiffeIDReconciler) syncNodeAliasEntries(ctx context.Context, spiffeID *spiffeidv1beta1.SpiffeID) ([]string, []string, error) {
+	if spiffeID.Spec.NodeSelector == nil && len(spiffeID.Status.NodeAliasEntryIds) == 0 {
+		return nil, nil, nil
+	}
+
+	selectorSets, err := spiffeID.NodeAliasSelectors(r.c.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	trustDomain, err := spiffeid.TrustDomainFromString(r.c.TrustDomain)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverID, err := spiffeIDFromString(idutil.ServerID(trustDomain).String())
+	if err != nil {
+		return nil, nil, err
+	}
+	aliasID, err := spiffeIDFromString(r.nodeSelectorAliasID(spiffeID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := r.c.E.ListEntries(ctx, &entryv1.ListEntriesRequest{
+		Filter: &entryv1.ListEntriesRequest_Filter{
+			BySpiffeId: aliasID,
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var current []string
+	matched := make(map[string]bool)
+	for _, selectors := range selectorSets {
+		entry := findEntryWithSelectors(resp.Entries, selectors)
+		if entry == nil {
+			entry, _, err = r.createEntry(ctx, spiffeID, &types.Entry{
+				ParentId:  serverID,
+				SpiffeId:  aliasID,
+				Selectors: selectors,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			r.c.Log.WithFields(logrus.Fields{
+				"entryID":  entry.Id,
+				"spiffeID": spiffeIDString(aliasID),
+			}).Info("Created node alias entry")
+		}
+		matched[entry.Id] = true
+		current = append(current, entry.Id)
+	}
+
+	var stale []string
+	for _, entry := range resp.Entries {
+		if !matched[entry.Id] {
+			stale = append(stale, entry.Id)
+		}
+	}
+
+	sort.Strings(current)
+	sort.Strings(stale)
+	return current, stale, nil
+}
+
+// deleteNodeAliasEntries deletes the given node alias entries of the SpiffeID
+// resource
+func (r *SpiffeIDReconciler) deleteNodeAliasEntries(ctx context.Context, spiffeID *spiffeidv1beta1.SpiffeID, entryIDs []string) error {
+	for _, entryID := range entryIDs {
+		if err := deleteRegistrationEntry(ctx, r.c.E, entryID); err != nil {
+			return err
+		}
+		r.c.Log.WithFields(logrus.Fields{
+			"entryID":  entryID,
+			"spiffeID": r.nodeSelectorAliasID(spiffeID),
+		}).Info("Deleted node alias entry")
+	}
+	return nil
+}
+
+func findEntryWithSelectors(entries []*types.Entry, selectors []*types.Selector) *types.Entry {
+	for _, entry := range entries {
+		if selectorSetsEqual(entry.Selectors, selectors) {
+			return entry
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"testing"
+
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	spireTypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func (s *SpiffeIDControllerTestSuite) TestNodeSelector() {
+	spiffeID := &spiffeidv1beta1.SpiffeID{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu", Namespace: "default"},
+		Spec: spiffeidv1beta1.SpiffeIDSpec{
+			SpiffeId: makeID(s.trustDomain, "gpu"),
+			Selector: spiffeidv1beta1.Selector{Namespace: "default"},
+			NodeSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"pool": "gpu"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{{
+					Key:      "zone",
+					Operator: metav1.LabelSelectorOpIn,
+					Values:   []string{"b", "a"},
+				}},
+			},
+		},
+	}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, spiffeID))
+	key := types.NamespacedName{Name: "gpu", Namespace: "default"}
+	aliasID := makeID(s.trustDomain, "k8s-workload-registrar/%s/node-selector/default/gpu", s.cluster)
+
+	reconcile := func() {
+		_, err := s.r.Reconcile(ctrl.Request{NamespacedName: key})
+		s.Require().NoError(err)
+		s.Require().NoError(s.k8sClient.Get(s.ctx, key, spiffeID))
+	}
+	requireAliasSelectors := func(expected ...[]string) {
+		var actual [][]string
+		for _, entryID := range spiffeID.Status.NodeAliasEntryIds {
+			entry, err := s.entryClient.GetEntry(s.ctx, &entryv1.GetEntryRequest{Id: entryID})
+			s.Require().NoError(err)
+			s.Require().Equal(aliasID, stringFromID(entry.SpiffeId))
+			s.Require().Equal(makeID(s.trustDomain, "spire/server"), stringFromID(entry.ParentId))
+			actual = append(actual, selectorStrings(entry.Selectors))
+		}
+		s.Require().ElementsMatch(expected, actual)
+	}
+	requireDeleted := func(entryIDs []string) {
+		for _, entryID := range entryIDs {
+			_, err := s.entryClient.GetEntry(s.ctx, &entryv1.GetEntryRequest{Id: entryID})
+			s.Require().Equal(codes.NotFound, status.Code(err))
+		}
+	}
+
+	// A node alias entry is created per zone, and the entry is parented to them
+	reconcile()
+	s.Require().NotNil(spiffeID.Status.EntryId)
+	entry, err := s.entryClient.GetEntry(s.ctx, &entryv1.GetEntryRequest{Id: *spiffeID.Status.EntryId})
+	s.Require().NoError(err)
+	s.Require().Equal(aliasID, stringFromID(entry.ParentId))
+	requireAliasSelectors(
+		[]string{"k8s_psat:agent_node_label:pool:gpu", "k8s_psat:agent_node_label:zone:a", "k8s_psat:cluster:test-cluster"},
+		[]string{"k8s_psat:agent_node_label:pool:gpu", "k8s_psat:agent_node_label:zone:b", "k8s_psat:cluster:test-cluster"},
+	)
+
+	// Narrowing the node selector deletes the node alias entries no longer needed
+	previous := spiffeID.Status.NodeAliasEntryIds
+	spiffeID.Spec.NodeSelector.MatchExpressions[0].Values = []string{"a"}
+	s.Require().NoError(s.k8sClient.Update(s.ctx, spiffeID))
+	reconcile()
+	requireAliasSelectors(
+		[]string{"k8s_psat:agent_node_label:pool:gpu", "k8s_psat:agent_node_label:zone:a", "k8s_psat:cluster:test-cluster"},
+	)
+	s.Require().Subset(previous, spiffeID.Status.NodeAliasEntryIds)
+	var stale []string
+	for _, entryID := range previous {
+		if !containsString(spiffeID.Status.NodeAliasEntryIds, entryID) {
+			stale = append(stale, entryID)
+		}
+	}
+	s.Require().Len(stale, 1)
+	requireDeleted(stale)
+
+	// Removing the node selector reparents the entry and deletes the node alias entries
+	previous = spiffeID.Status.NodeAliasEntryIds
+	spiffeID.Spec.NodeSelector = nil
+	spiffeID.Spec.ParentId = makeID(s.trustDomain, "spire/server")
+	s.Require().NoError(s.k8sClient.Update(s.ctx, spiffeID))
+	reconcile()
+	s.Require().Empty(spiffeID.Status.NodeAliasEntryIds)
+	entry, err = s.entryClient.GetEntry(s.ctx, &entryv1.GetEntryRequest{Id: *spiffeID.Status.EntryId})
+	s.Require().NoError(err)
+	s.Require().Equal(spiffeID.Spec.ParentId, stringFromID(entry.ParentId))
+	requireDeleted(previous)
+}
+
+func TestNodeAliasSelectors(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		nodeSelector *metav1.LabelSelector
+		expected     [][]string
+		expectErr    string
+	}{
+		{
+			name: "no node selector",
+		},
+		{
+			name:         "match labels",
+			nodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "gpu", "arch": "arm64"}},
+			expected: [][]string{
+				{"k8s_psat:agent_node_label:arch:arm64", "k8s_psat:agent_node_label:pool:gpu", "k8s_psat:cluster:test-cluster"},
+			},
+		},
+		{
+			name: "intersected values",
+			nodeSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"pool": "gpu"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "pool", Operator: metav1.LabelSelectorOpIn, Values: []string{"cpu", "gpu"}},
+				},
+			},
+			expected: [][]string{
+				{"k8s_psat:agent_node_label:pool:gpu", "k8s_psat:cluster:test-cluster"},
+			},
+		},
+		{
+			name:         "empty",
+			nodeSelector: &metav1.LabelSelector{},
+			expectErr:    "node selector must select at least one node label",
+		},
+		{
+			name: "unsupported operator",
+			nodeSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "pool", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"cpu"}},
+				},
+			},
+			expectErr: `unsupported operator "NotIn" for node label "pool", only "In" can be matched by agent selectors`,
+		},
+		{
+			name: "never matching",
+			nodeSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"pool": "gpu"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "pool", Operator: metav1.LabelSelectorOpIn, Values: []string{"cpu"}},
+				},
+			},
+			expectErr: `node label "pool" can never match`,
+		},
+		{
+			name: "too many combinations",
+			nodeSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "a", Operator: metav1.LabelSelectorOpIn, Values: []string{"1", "2", "3", "4", "5"}},
+					{Key: "b", Operator: metav1.LabelSelectorOpIn, Values: []string{"1", "2", "3", "4"}},
+				},
+			},
+			expectErr: "node selector has more than 16 combinations of node label values",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			spiffeID := &spiffeidv1beta1.SpiffeID{
+				Spec: spiffeidv1beta1.SpiffeIDSpec{NodeSelector: tt.nodeSelector},
+			}
+			selectorSets, err := spiffeID.NodeAliasSelectors(Cluster)
+			if tt.expectErr != "" {
+				require.EqualError(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+
+			var actual [][]string
+			for _, selectors := range selectorSets {
+				actual = append(actual, selectorStrings(selectors))
+			}
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+// selectorStrings returns the sorted selectors in the type:value form
+func selectorStrings(selectors []*spireTypes.Selector) []string {
+	var strs []string
+	for _, selector := range selectors {
+		strs = append(strs, selector.Type+":"+selector.Value)
+	}
+	sort.Strings(strs)
+	return strs
+}
@@ -0,0 +1,235 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// legacySpiffeIDFinalizer is the finalizer set on SpiffeID resources
+	// before finalizers told apart their ownership
+	legacySpiffeIDFinalizer = "finalizers.spiffeid.spiffe.io"
+	// registrarSpiffeIDFinalizer is the finalizer of the SpiffeID resources
+	// owned by the registrar
+	registrarSpiffeIDFinalizer = "finalizers.spiffeid.spiffe.io/registrar"
+	// userSpiffeIDFinalizer is the finalizer of the SpiffeID resources owned
+	// by users
+	userSpiffeIDFinalizer = "finalizers.spiffeid.spiffe.io/user"
+
+	entryIDField = "status.entryId"
+
+	conflictReasonEntryClaimed = "EntryClaimed"
+	conflictReasonNoConflict   = "NoConflict"
+
+	ownershipConflictRequeueInterval = time.Minute
+)
+
+// spiffeIDFinalizers are all the finalizers the SpiffeID reconciler sets
+var spiffeIDFinalizers = []string{legacySpiffeIDFinalizer, registrarSpiffeIDFinalizer, userSpiffeIDFinalizer}
+
+// spiffeIDFinalizer returns the finalizer of the SpiffeID resource for its
+// ownership
+func spiffeIDFinalizer(spiffeID *spiffeidv1beta1.SpiffeID) string {
+	if spiffeID.Ownership() == spiffeidv1beta1.OwnershipRegistrar {
+		return registrarSpiffeIDFinalizer
+	}
+	return userSpiffeIDFinalizer
+}
+
+// setSpiffeIDFinalizer sets the finalizer of the SpiffeID resource for its
+// ownership, replacing the other finalizers of the reconciler, e.g. the legacy
+// one. It returns whether the finalizers have changed.
+func setSpiffeIDFinalizer(spiffeID *spiffeidv1beta1.SpiffeID) bool {
+	finalizer := spiffeIDFinalizer(spiffeID)
+	finalizers := append([]string(nil), spiffeID.GetFinalizers()...)
+	for _, other := range spiffeIDFinalizers {
+		if other != finalizer {
+			finalizers = removeStringIf(finalizers, other)
+		}
+	}
+	if !containsString(finalizers, finalizer) {
+		finalizers = append(finalizers, finalizer)
+	}
+
+	if equalStringSlice(finalizers, spiffeID.GetFinalizers()) {
+		return false
+	}
+	spiffeID.SetFinalizers(finalizers)
+	return true
+}
+
+// hasSpiffeIDFinalizer returns whether the SpiffeID resource has any of the
+// finalizers of the reconciler
+func hasSpiffeIDFinalizer(spiffeID *spiffeidv1beta1.SpiffeID) bool {
+	for _, finalizer := range spiffeIDFinalizers {
+		if containsString(spiffeID.GetFinalizers(), finalizer) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeSpiffeIDFinalizers removes all the finalizers of the reconciler from
+// the SpiffeID resource
+func removeSpiffeIDFinalizers(spiffeID *spiffeidv1beta1.SpiffeID) {
+	finalizers := append([]string(nil), spiffeID.GetFinalizers()...)
+	for _, finalizer := range spiffeIDFinalizers {
+		finalizers = removeStringIf(finalizers, finalizer)
+	}
+	spiffeID.SetFinalizers(finalizers)
+}
+
+// entryClaimedError is returned when the registration entry of a SpiffeID
+// resource already exists and is the entry of another SpiffeID resource.
+// Adopting it would have the entry deleted along with either resource.
+type entryClaimedError struct {
+	entryID   string
+	claimedBy client.ObjectKey
+	ownership string
+}
+
+func (e *entryClaimedError) Error() string {
+	return fmt.Sprintf("entry %s is already the entry of SpiffeID resource %s, owned by the %s", e.entryID, e.claimedBy, e.ownership)
+}
+
+// indexEntryIDField indexes SpiffeID resources by the ID of their entry so the
+// resource claiming an entry can be looked up efficiently
+func indexEntryIDField(mgr ctrl.Manager) error {
+	return mgr.GetFieldIndexer().IndexField(context.Background(), &spiffeidv1beta1.SpiffeID{}, entryIDField, func(rawObj runtime.Object) []string {
+		spiffeID := rawObj.(*spiffeidv1beta1.SpiffeID)
+		if spiffeID.Status.EntryId == nil {
+			return nil
+		}
+		return []string{*spiffeID.Status.EntryId}
+	})
+}
+
+// checkEntryClaim returns an entryClaimedError if a SpiffeID resource other
+// than the given one has the entry with the given ID
+func (r *SpiffeIDReconciler) checkEntryClaim(ctx context.Context, spiffeID *spiffeidv1beta1.SpiffeID, entryID string) error {
+	spiffeIDList := spiffeidv1beta1.SpiffeIDList{}
+	if err := r.List(ctx, &spiffeIDList, client.MatchingFields{entryIDField: entryID}); err != nil {
+		return err
+	}
+
+	for _, other := range spiffeIDList.Items {
+		other := other
+		// The field index is not available on every client, so filter again
+		if other.Status.EntryId == nil || *other.Status.EntryId != entryID {
+			continue
+		}
+		if other.Namespace == spiffeID.Namespace && other.Name == spiffeID.Name {
+			continue
+		}
+		return &entryClaimedError{
+			entryID:   entryID,
+			claimedBy: client.ObjectKey{Namespace: other.Namespace, Name: other.Name},
+			ownership: other.Ownership(),
+		}
+	}
+	return nil
+}
+
+// setConflictCondition sets the Conflict condition of the SpiffeID resource,
+// if it changed. The condition is only added once the resource conflicts with
+// another one.
+func (r *SpiffeIDReconciler) setConflictCondition(ctx context.Context, key client.ObjectKey, claimed *entryClaimedError) error {
+	condition := spiffeidv1beta1.SpiffeIDCondition{
+		Type:   spiffeidv1beta1.SpiffeIDConditionConflict,
+		Status: corev1.ConditionFalse,
+		Reason: conflictReasonNoConflict,
+	}
+	if claimed != nil {
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = conflictReasonEntryClaimed
+		condition.Message = "Not adopting the existing entry: " + claimed.Error()
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		spiffeID := spiffeidv1beta1.SpiffeID{}
+		if err := r.Get(ctx, key, &spiffeID); err != nil {
+			return err
+		}
+
+		current := findSpiffeIDCondition(spiffeID.Status.Conditions, condition.Type)
+		wasConflicting := current != nil && current.Status == corev1.ConditionTrue
+		switch {
+		case current == nil && condition.Status == corev1.ConditionFalse:
+			return nil
+		case current == nil:
+			condition.LastTransitionTime = metav1.Now()
+			spiffeID.Status.Conditions = append(spiffeID.Status.Conditions, condition)
+		case current.Status == condition.Status && current.Message == condition.Message:
+			return nil
+		default:
+			condition.LastTransitionTime = current.LastTransitionTime
+			if current.Status != condition.Status {
+				condition.LastTransitionTime = metav1.Now()
+			}
+			*current = condition
+		}
+
+		if err := r.Status().Update(ctx, &spiffeID); err != nil {
+			return err
+		}
+		if claimed != nil && !wasConflicting {
+			r.c.Log.WithFields(logrus.Fields{
+				"name":      spiffeID.Name,
+				"namespace": spiffeID.Namespace,
+			}).WithError(claimed).Warn("Not adopting the entry of another SpiffeID resource")
+		}
+		return nil
+	})
+}
+
+// resolveNameConflict handles a SpiffeID resource of the pod that cannot be
+// created because its name is taken. The resource of a deleted pod is
+// eventually garbage collected, but the resource of a user is never replaced.
+func (r *PodReconciler) resolveNameConflict(ctx context.Context, pod *corev1.Pod, spiffeID *spiffeidv1beta1.SpiffeID) (ctrl.Result, error) {
+	other := spiffeidv1beta1.SpiffeID{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: spiffeID.Namespace, Name: spiffeID.Name}, &other); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if other.Ownership() == spiffeidv1beta1.OwnershipRegistrar {
+		// Already deleted pod is taking up the name, retry after it has deleted
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	r.c.Log.WithFields(logrus.Fields{
+		"pod":       pod.Name,
+		"namespace": pod.Namespace,
+		"name":      spiffeID.Name,
+	}).Warn("Not registering pod whose SpiffeID resource name is taken by a resource owned by a user")
+	r.recordEvent(pod, corev1.EventTypeWarning, "SpiffeIDNameConflict",
+		"SpiffeID resource %s is owned by a user, not registering", spiffeID.Name)
+	return ctrl.Result{RequeueAfter: ownershipConflictRequeueInterval}, nil
+}
@@ -17,6 +17,11 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	federation "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/federation"
@@ -27,47 +32,188 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// containerNameHashLength is the length of the hash suffixed to the names of
+// per-container SpiffeID resources
+const containerNameHashLength = 16
+
 // PodReconcilerConfig holds the config passed in when creating the reconciler
 type PodReconcilerConfig struct {
-	Client             client.Client
-	Cluster            string
-	Ctx                context.Context
-	DisabledNamespaces []string
-	Log                logrus.FieldLogger
-	PodLabel           string
-	PodAnnotation      string
-	Scheme             *runtime.Scheme
-	TrustDomain        string
+	Client  client.Client
+	Cluster string
+	// ContainerIdentities creates a distinct SPIFFE ID for each container
+	// in the pod instead of a single SPIFFE ID for the whole pod
+	ContainerIdentities bool
+	// CreateBatchSize, if set, is the number of SpiffeID resources created
+	// per CreateBatchInterval, DefaultCreateBatchInterval if unset. The
+	// pods beyond the current batch are requeued to the next one.
+	CreateBatchSize     int
+	CreateBatchInterval time.Duration
+	Ctx                 context.Context
+	DisabledNamespaces  []string
+	// EntryBudget, if set, withholds the registration of new pods on the
+	// nodes it doesn't allow
+	EntryBudget   *EntryBudget
+	EventRecorder record.EventRecorder
+	// FederationPolicies adds the trust domains of the FederationPolicy
+	// resources matching the SPIFFE IDs of the pods to those the pods
+	// federate with
+	FederationPolicies bool
+	// GroupLabel, if set, is the pod label whose value is stamped on the
+	// SpiffeID resources of the pod as their group
+	GroupLabel string
+	// IdentityCollisionPolicy is applied when a pod resolves to a SPIFFE ID
+	// already used by a pod with a different namespace or service account
+	IdentityCollisionPolicy string
+	Log                     logrus.FieldLogger
+	// MaxSpiffeIDLength and MaxSpiffeIDPathDepth, if set, limit the SPIFFE
+	// IDs assigned to pods. Pods exceeding them are not registered.
+	MaxSpiffeIDLength    int
+	MaxSpiffeIDPathDepth int
+	// MaxConcurrentReconciles is the number of pods reconciled concurrently,
+	// 1 if unset
+	MaxConcurrentReconciles int
+	// NodeAttestor describes how the agents on the cluster nodes are attested
+	NodeAttestor  NodeAttestorConfig
+	PodLabel      string
+	PodAnnotation string
+	// PodDNSName adds the DNS name rendered from PodDNSNameTemplate to the
+	// SVIDs of the pods in all namespaces, other than those opted out with
+	// the PodDNSNameAnnotation annotation. If only PodDNSNameTemplate is
+	// set, the DNS name is added in the namespaces opted in instead.
+	PodDNSName         bool
+	PodDNSNameTemplate string
+	// RequeueQPS and RequeueBurst limit the overall rate at which pods are
+	// requeued, e.g. after failing to be reconciled, DefaultRequeueQPS and
+	// DefaultRequeueBurst if unset
+	RequeueQPS   float64
+	RequeueBurst int
+	// RuntimeConfig is set when the identity, pod DNS name template and
+	// disabled namespaces may be changed at runtime by a RegistrarConfig
+	// resource
+	RuntimeConfig bool
+	Scheme        *runtime.Scheme
+	// SpecDriftPolicy is applied when the SpiffeID resource of a pod has been
+	// changed by hand
+	SpecDriftPolicy string
+	// TerminatingPodTTL, if set, is the maxTtl set on the SpiffeID resources
+	// of terminating pods, so the SVIDs issued to them are short-lived
+	TerminatingPodTTL time.Duration
+	TrustDomain       string
 }
 
 // PodReconciler holds the runtime configuration and state of this controller
 type PodReconciler struct {
 	client.Client
 	c PodReconcilerConfig
+
+	settingsMtx sync.RWMutex
+	settings    podSettings
+	// resync, once the reconciler is set up, enqueues pods to reconcile them
+	// again after the settings have changed
+	resync chan event.GenericEvent
+
+	collisionsMtx sync.Mutex
+	// collisions holds the SPIFFE ID of the resources found to collide with
+	// the SPIFFE ID of an incompatible pod, so they are only reported once
+	collisions map[collisionKey]string
+	// invalidIDs holds the invalid SPIFFE ID of the resources that could not
+	// be registered, so they are only reported once
+	invalidIDs map[collisionKey]string
+
+	// batcher, if set, paces the creation of SpiffeID resources in batches
+	batcher *createBatcher
 }
 
 // NewPodReconciler creates a new PodReconciler object
 func NewPodReconciler(config PodReconcilerConfig) *PodReconciler {
-	return &PodReconciler{
-		Client: config.Client,
-		c:      config,
+	if config.IdentityCollisionPolicy == "" {
+		config.IdentityCollisionPolicy = IdentityCollisionPolicyShare
+	}
+	if config.NodeAttestor.Name == "" {
+		config.NodeAttestor.Name = NodeAttestorK8sPSAT
+	}
+	if config.SpecDriftPolicy == "" {
+		config.SpecDriftPolicy = SpecDriftPolicyRevert
+	}
+
+	r := &PodReconciler{
+		Client:     config.Client,
+		c:          config,
+		settings:   staticPodSettings(config),
+		collisions: make(map[collisionKey]string),
+		invalidIDs: make(map[collisionKey]string),
 	}
+	if config.CreateBatchSize > 0 {
+		r.batcher = newCreateBatcher(config.CreateBatchSize, config.CreateBatchInterval)
+	}
+	return r
 }
 
 // SetupWithManager adds a controller manager to manage this reconciler
 func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if err := indexSpiffeIDField(mgr); err != nil {
+		return err
+	}
+
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Pod{}).
-		Complete(r)
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.c.MaxConcurrentReconciles,
+			RateLimiter:             podRateLimiter(r.c.RequeueQPS, r.c.RequeueBurst),
+		})
+	if r.c.RuntimeConfig {
+		r.resync = make(chan event.GenericEvent)
+		builder = builder.Watches(&source.Channel{Source: r.resync}, &handler.EnqueueRequestForObject{})
+	}
+	if r.c.PodDNSName || r.c.PodDNSNameTemplate != "" || r.c.RuntimeConfig {
+		// Pods are reconciled again when the PodDNSNameAnnotation annotation
+		// of their namespace changes
+		builder = builder.Watches(&source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.namespacePods)})
+	}
+	if r.c.FederationPolicies {
+		// Pods are reconciled again when the FederationPolicy resources of
+		// their namespace change
+		builder = builder.Watches(&source.Kind{Type: &spiffeidv1beta1.FederationPolicy{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.federationPolicyPods)})
+	}
+	return builder.Complete(r)
+}
+
+// namespacePods returns a reconcile request for each pod of the namespace
+func (r *PodReconciler) namespacePods(a handler.MapObject) []reconcile.Request {
+	return r.podsInNamespace(a.Meta.GetName())
+}
+
+// podsInNamespace returns a reconcile request for each pod of the namespace
+func (r *PodReconciler) podsInNamespace(namespace string) []reconcile.Request {
+	podList := corev1.PodList{}
+	if err := r.List(r.c.Ctx, &podList, client.InNamespace(namespace)); err != nil {
+		r.c.Log.WithError(err).WithField("namespace", namespace).Error("Unable to list pods")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(podList.Items))
+	for _, pod := range podList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name},
+		})
+	}
+	return requests
 }
 
 // Reconcile creates a new SPIFFE ID when pods are created
 func (r *PodReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	if containsString(r.c.DisabledNamespaces, req.NamespacedName.Namespace) {
+	if containsString(r.currentSettings().disabledNamespaces, req.NamespacedName.Namespace) {
 		return ctrl.Result{}, nil
 	}
 
@@ -80,6 +226,7 @@ func (r *PodReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			return ctrl.Result{}, err
 		}
 
+		r.forgetPod(req.NamespacedName)
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
@@ -91,102 +238,365 @@ func (r *PodReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	return r.updateorCreatePodEntry(ctx, &pod)
 }
 
-// updateorCreatePodEntry attempts to create a new SpiffeID resource.
+// updateorCreatePodEntry attempts to create a new SpiffeID resource, or one
+// per container when container identities are enabled. SpiffeID resources of
+// the pod that are no longer desired, e.g. after container identities have
+// been turned on or off, are deleted.
 func (r *PodReconciler) updateorCreatePodEntry(ctx context.Context, pod *corev1.Pod) (ctrl.Result, error) {
 	spiffeIDURI := r.podSpiffeID(pod)
 	// If we have no spiffe ID for the pod, do nothing
 	if spiffeIDURI == "" {
+		r.forgetPod(types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name})
 		return ctrl.Result{}, nil
 	}
 
-	federationDomains := federation.GetFederationDomains(pod)
+	parentID, err := r.podParentID(ctx, pod.Spec.NodeName)
+	if err != nil {
+		r.c.Log.WithFields(logrus.Fields{
+			"pod":       pod.Name,
+			"namespace": pod.Namespace,
+			"node":      pod.Spec.NodeName,
+		}).WithError(err).Error("Unable to determine parent ID")
+		return ctrl.Result{}, err
+	}
+
+	var desired []*spiffeidv1beta1.SpiffeID
+	if r.c.ContainerIdentities {
+		for _, containerName := range podContainerNames(pod) {
+			containerSpiffeID := r.currentSettings().identity.ContainerID(pod, containerName)
+			desired = append(desired, r.newPodSpiffeID(pod, containerSpiffeID, parentID, containerName))
+		}
+	} else {
+		desired = append(desired, r.newPodSpiffeID(pod, spiffeIDURI, parentID, ""))
+	}
+
+	dnsName, err := r.podDNSName(ctx, pod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	policies, err := r.federationPolicies(ctx, pod.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, spiffeID := range desired {
+		setPodDNSName(spiffeID, dnsName)
+		if len(policies) > 0 {
+			policyDomains := federationPolicyDomains(r.c.TrustDomain, policies, spiffeID.Spec.SpiffeId)
+			spiffeID.Spec.FederatesWith = mergeFederatesWith(spiffeID.Spec.FederatesWith, policyDomains)
+		}
+		if r.c.TerminatingPodTTL > 0 && pod.DeletionTimestamp != nil {
+			spiffeID.Spec.MaxTtl = int32(r.c.TerminatingPodTTL / time.Second)
+		}
+	}
+
+	// Existing resources are keyed by the container they are restricted to,
+	// or by an empty string for the resource covering the whole pod
+	existing, err := r.podSpiffeIDs(ctx, pod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	result := ctrl.Result{}
+	for _, spiffeID := range desired {
+		containerName := spiffeID.Spec.Selector.ContainerName
+		spiffeIDResult, err := r.updateOrCreateSpiffeID(ctx, pod, spiffeID, existing[containerName])
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		delete(existing, containerName)
+
+		result.Requeue = result.Requeue || spiffeIDResult.Requeue
+		if spiffeIDResult.RequeueAfter > 0 && (result.RequeueAfter == 0 || spiffeIDResult.RequeueAfter < result.RequeueAfter) {
+			result.RequeueAfter = spiffeIDResult.RequeueAfter
+		}
+	}
+
+	for _, stale := range existing {
+		if err := r.Delete(ctx, stale); err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return result, nil
+}
+
+// podSpiffeIDs returns the SpiffeID resources created for the pod, keyed by
+// the name of the container they are restricted to.
+func (r *PodReconciler) podSpiffeIDs(ctx context.Context, pod *corev1.Pod) (map[string]*spiffeidv1beta1.SpiffeID, error) {
+	spiffeIDList := spiffeidv1beta1.SpiffeIDList{}
+	if err := r.List(ctx, &spiffeIDList, client.InNamespace(pod.Namespace), client.MatchingLabels{"podUid": string(pod.UID)}); err != nil {
+		return nil, err
+	}
+
+	spiffeIDs := make(map[string]*spiffeidv1beta1.SpiffeID, len(spiffeIDList.Items))
+	for i := range spiffeIDList.Items {
+		spiffeID := &spiffeIDList.Items[i]
+		// Resources of users are left alone, even if they are controlled by
+		// the pod
+		if !metav1.IsControlledBy(spiffeID, pod) || spiffeID.Ownership() != spiffeidv1beta1.OwnershipRegistrar {
+			continue
+		}
+		spiffeIDs[spiffeID.Spec.Selector.ContainerName] = spiffeID
+	}
+	return spiffeIDs, nil
+}
+
+// newPodSpiffeID sets up the SpiffeID resource for the pod. If containerName
+// is set, the resource is restricted to that container of the pod.
+func (r *PodReconciler) newPodSpiffeID(pod *corev1.Pod, spiffeIDURI, parentID, containerName string) *spiffeidv1beta1.SpiffeID {
+	name := pod.Name
+	if containerName != "" {
+		name = containerSpiffeIDName(pod.Name, containerName)
+	}
+
+	labels := map[string]string{
+		"podUid": string(pod.ObjectMeta.UID),
+	}
+	if group := r.podGroup(pod); group != "" {
+		labels[SpiffeIDGroupLabel] = group
+	}
 
-	// Set up new SPIFFE ID
-	spiffeID := &spiffeidv1beta1.SpiffeID{
+	return &spiffeidv1beta1.SpiffeID{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      pod.Name,
+			Name:      name,
 			Namespace: pod.Namespace,
-			Labels: map[string]string{
-				"podUid": string(pod.ObjectMeta.UID),
-			},
+			Labels:    labels,
 		},
 		Spec: spiffeidv1beta1.SpiffeIDSpec{
 			SpiffeId:      spiffeIDURI,
-			ParentId:      r.podParentID(pod.Spec.NodeName),
+			ParentId:      parentID,
 			DnsNames:      []string{pod.Name}, // Set pod name as first DNS name
-			FederatesWith: federationDomains,
+			FederatesWith: federation.GetFederationDomains(pod),
+			Ownership:     spiffeidv1beta1.OwnershipRegistrar,
 			Selector: spiffeidv1beta1.Selector{
-				PodUid:    pod.GetUID(),
-				Namespace: pod.Namespace,
-				NodeName:  pod.Spec.NodeName,
+				PodUid:        pod.GetUID(),
+				Namespace:     pod.Namespace,
+				NodeName:      pod.Spec.NodeName,
+				ContainerName: containerName,
 			},
 		},
 	}
+}
+
+// podGroup returns the group of the pod, i.e. the value of its group label
+func (r *PodReconciler) podGroup(pod *corev1.Pod) string {
+	if r.c.GroupLabel == "" {
+		return ""
+	}
+	return pod.Labels[r.c.GroupLabel]
+}
+
+// setGroup sets the group label of the SpiffeID resource, removing it if the
+// group is empty. It returns whether the label has changed.
+func setGroup(spiffeID *spiffeidv1beta1.SpiffeID, group string) bool {
+	if spiffeID.Labels[SpiffeIDGroupLabel] == group {
+		return false
+	}
+	if group == "" {
+		delete(spiffeID.Labels, SpiffeIDGroupLabel)
+		return true
+	}
+	if spiffeID.Labels == nil {
+		spiffeID.Labels = make(map[string]string)
+	}
+	spiffeID.Labels[SpiffeIDGroupLabel] = group
+	return true
+}
+
+// containerSpiffeIDName returns the name of the SpiffeID resource for a
+// container of the pod. Joining the pod and container names is ambiguous and
+// may exceed the maximum resource name length, so the pod name, truncated if
+// needed, is suffixed with a hash of both names instead.
+func containerSpiffeIDName(podName, containerName string) string {
+	sum := sha256.Sum256([]byte(podName + "/" + containerName))
+	suffix := hex.EncodeToString(sum[:])[:containerNameHashLength]
+
+	maxPrefixLength := validation.DNS1123SubdomainMaxLength - len(suffix) - 1
+	if len(podName) > maxPrefixLength {
+		podName = strings.TrimRight(podName[:maxPrefixLength], ".-")
+	}
+	return podName + "-" + suffix
+}
+
+// updateOrCreateSpiffeID creates the given SpiffeID resource if the pod has
+// no existing one for the same container, or updates the existing one if its
+// SPIFFE ID, parent ID, selector, federated trust domains, pod DNS name or
+// group has changed, or if its maxTtl must be shortened. A resource of a user
+// with the same name is never replaced.
+func (r *PodReconciler) updateOrCreateSpiffeID(ctx context.Context, pod *corev1.Pod, spiffeID, existing *spiffeidv1beta1.SpiffeID) (ctrl.Result, error) {
 	err := setOwnerRef(pod, spiffeID, r.c.Scheme)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	// Check for existing entry
-	existing := spiffeidv1beta1.SpiffeID{}
-	err = r.Get(ctx, types.NamespacedName{
-		Name:      spiffeID.ObjectMeta.Name,
-		Namespace: spiffeID.ObjectMeta.Namespace,
-	}, &existing)
+	register, err := r.resolveIdentityCollision(ctx, pod, spiffeID, existing)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			// Create new entry
-			return ctrl.Result{}, r.Create(ctx, spiffeID)
+		return ctrl.Result{}, err
+	}
+	if !register {
+		// The pod must not keep a registration it held before colliding,
+		// e.g. after its label was changed to a value used by another pod
+		if existing != nil {
+			if err := r.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
 		}
+		// Check again later, the colliding pod may have gone away
+		return ctrl.Result{RequeueAfter: identityCollisionRequeueInterval}, nil
+	}
 
-		return ctrl.Result{}, err
+	// Validated after resolving collisions, as the suffix policy lengthens
+	// the SPIFFE ID
+	if !r.validateSpiffeID(pod, spiffeID) {
+		if existing != nil {
+			if err := r.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
 	}
 
-	if spiffeID.Spec.Selector.PodUid != existing.Spec.Selector.PodUid {
-		// Already deleted pod is taking up the name, retry after it has deleted
-		return ctrl.Result{Requeue: true}, nil
+	if existing == nil {
+		if r.c.EntryBudget != nil && !r.c.EntryBudget.Allows(spiffeID.Spec.ParentId) {
+			r.c.Log.WithFields(logrus.Fields{
+				"pod":       pod.Name,
+				"namespace": pod.Namespace,
+				"parentID":  spiffeID.Spec.ParentId,
+			}).Debug("Not registering pod on node over its registration entry budget")
+			r.recordEvent(pod, corev1.EventTypeWarning, "EntryBudgetExceeded",
+				"Node %s is over its registration entry budget, not registering", pod.Spec.NodeName)
+			// Check again once the budget has been checked again
+			return ctrl.Result{RequeueAfter: entryBudgetInterval}, nil
+		}
+
+		var batchStart time.Time
+		if r.batcher != nil {
+			var wait time.Duration
+			if batchStart, wait = r.batcher.reserve(); wait > 0 {
+				r.c.Log.WithFields(logrus.Fields{
+					"pod":       pod.Name,
+					"namespace": pod.Namespace,
+					"name":      spiffeID.Name,
+				}).Debug("Deferring SpiffeID resource creation to the next batch")
+				deferredSpiffeIDCreates.Inc()
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+		}
+
+		setSpecTemplateHash(spiffeID, specTemplateOf(spiffeID).hash())
+		err := r.Create(ctx, spiffeID)
+		if err != nil && r.batcher != nil {
+			// Nothing was created, so the next pods can take the slot
+			r.batcher.release(batchStart)
+		}
+		if errors.IsAlreadyExists(err) {
+			return r.resolveNameConflict(ctx, pod, spiffeID)
+		}
+		return ctrl.Result{}, err
 	}
 
-	// Check if label or annotation has changed
-	if spiffeID.Spec.SpiffeId != existing.Spec.SpiffeId {
-		existing.Spec.SpiffeId = spiffeID.Spec.SpiffeId
-		err := r.Update(r.c.Ctx, &existing)
+	// Check if label or annotation, the node attestor, the pod DNS name or the
+	// group has changed, or if the pod is terminating. Groups set by hand are
+	// left alone unless groups are derived from pod labels. Manual changes to
+	// the fields derived from the pod are handled by the spec drift policy.
+	templateChanged, drift := r.reconcileSpecDrift(existing, spiffeID)
+	dnsNameChanged := setPodDNSName(existing, spiffeID.Annotations[podDNSNameSpiffeIDAnnotation])
+	groupChanged := r.c.GroupLabel != "" && setGroup(existing, spiffeID.Labels[SpiffeIDGroupLabel])
+	ttlShortened := spiffeID.Spec.MaxTtl > 0 && (existing.Spec.MaxTtl == 0 || spiffeID.Spec.MaxTtl < existing.Spec.MaxTtl)
+	// Resources created before their ownership was recorded get it set
+	ownershipUnset := existing.Spec.Ownership == ""
+	if templateChanged || dnsNameChanged || groupChanged || ttlShortened || ownershipUnset {
+		if ttlShortened {
+			existing.Spec.MaxTtl = spiffeID.Spec.MaxTtl
+		}
+		existing.Spec.Ownership = spiffeidv1beta1.OwnershipRegistrar
+		err := r.Update(ctx, existing)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
-	// Nothing to do
+	if r.c.SpecDriftPolicy == SpecDriftPolicyFlag {
+		if err := r.setSpecDriftCondition(ctx, existing, drift); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	return ctrl.Result{}, nil
 }
 
-// podSpiffeID returns the desired spiffe ID for the pod, or nil if it should be ignored
-func (r *PodReconciler) podSpiffeID(pod *corev1.Pod) string {
-	if r.c.PodLabel != "" {
-		// the controller has been configured with a pod label. if the pod
-		// has that label, use the value to construct the pod entry. otherwise
-		// ignore the pod altogether.
-		if labelValue, ok := pod.Labels[r.c.PodLabel]; ok {
-			return makeID(r.c.TrustDomain, "%s", labelValue)
-		}
-		return ""
+// validateSpiffeID checks the SPIFFE ID of the resource against the SPIFFE
+// specification and the configured limits. Invalid SPIFFE IDs are reported once
+// with a warning event on the pod.
+func (r *PodReconciler) validateSpiffeID(pod *corev1.Pod, spiffeID *spiffeidv1beta1.SpiffeID) bool {
+	key := collisionKey{
+		pod:       types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name},
+		container: spiffeID.Spec.Selector.ContainerName,
+	}
+
+	err := r.currentSettings().identity.Validate(spiffeID.Spec.SpiffeId)
+
+	r.collisionsMtx.Lock()
+	defer r.collisionsMtx.Unlock()
+
+	if err == nil {
+		delete(r.invalidIDs, key)
+		return true
+	}
+
+	if previous, ok := r.invalidIDs[key]; !ok || previous != spiffeID.Spec.SpiffeId {
+		r.invalidIDs[key] = spiffeID.Spec.SpiffeId
+		r.c.Log.WithError(err).WithFields(logrus.Fields{
+			"pod":       pod.Name,
+			"namespace": pod.Namespace,
+		}).Warn("Not registering pod with invalid SPIFFE ID")
+		r.recordEvent(pod, corev1.EventTypeWarning, "InvalidSpiffeID", "Not registering pod: %v", err)
 	}
+	return false
+}
 
-	if r.c.PodAnnotation != "" {
-		// the controller has been configured with a pod annotation. if the pod
-		// has that annotation, use the value to construct the pod entry. otherwise
-		// ignore the pod altogether.
-		if annotationValue, ok := pod.Annotations[r.c.PodAnnotation]; ok {
-			return makeID(r.c.TrustDomain, "%s", annotationValue)
+// forgetPod forgets the collisions and invalid SPIFFE IDs of all the SpiffeID
+// resources of the pod, e.g. once it has been deleted
+func (r *PodReconciler) forgetPod(pod types.NamespacedName) {
+	r.forgetPodCollisions(pod)
+
+	r.collisionsMtx.Lock()
+	defer r.collisionsMtx.Unlock()
+	for key := range r.invalidIDs {
+		if key.pod == pod {
+			delete(r.invalidIDs, key)
 		}
-		return ""
 	}
+}
 
-	// the controller has not been configured with a pod label or a pod annotation.
-	// create an entry based on the service account.
-	return makeID(r.c.TrustDomain, "ns/%s/sa/%s", pod.Namespace, pod.Spec.ServiceAccountName)
+// podSpiffeID returns the desired spiffe ID for the pod, or an empty string if it should be ignored
+func (r *PodReconciler) podSpiffeID(pod *corev1.Pod) string {
+	return r.currentSettings().identity.PodID(pod)
 }
 
-func (r *PodReconciler) podParentID(nodeName string) string {
-	return makeID(r.c.TrustDomain, "k8s-workload-registrar/%s/node/%s", r.c.Cluster, nodeName)
+// podParentID returns the parent ID of entries for pods running on the given
+// node. It is the node alias entry when agents are attested with k8s_psat, and
+// the ID of the agent running on the node otherwise.
+func (r *PodReconciler) podParentID(ctx context.Context, nodeName string) (string, error) {
+	if r.c.NodeAttestor.Name == NodeAttestorK8sPSAT {
+		return makeID(r.c.TrustDomain, "k8s-workload-registrar/%s/node/%s", r.c.Cluster, nodeName), nil
+	}
+
+	node := corev1.Node{}
+	if err := r.Get(ctx, types.NamespacedName{Name: nodeName}, &node); err != nil {
+		return "", err
+	}
+	return agentIDForNode(r.c.TrustDomain, r.c.NodeAttestor, &node)
+}
+
+// podContainerNames returns the names of the init and regular containers of the pod
+func podContainerNames(pod *corev1.Pod) []string {
+	names := make([]string, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for _, container := range pod.Spec.InitContainers {
+		names = append(names, container.Name)
+	}
+	for _, container := range pod.Spec.Containers {
+		names = append(names, container.Name)
+	}
+	return names
 }
@@ -16,15 +16,24 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -142,6 +151,870 @@ func (s *PodControllerTestSuite) TestPodLabel() {
 	}
 }
 
+// TestPodScheduling checks that pods are registered as soon as they are
+// scheduled, without waiting for them to run
+func (s *PodControllerTestSuite) TestPodScheduling() {
+	p := NewPodReconciler(PodReconcilerConfig{
+		Client:      s.k8sClient,
+		Cluster:     s.cluster,
+		Ctx:         s.ctx,
+		Log:         s.log,
+		PodLabel:    "spiffe",
+		Scheme:      s.scheme,
+		TrustDomain: s.trustDomain,
+	})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "scheduled-pod",
+			Namespace: PodNamespace,
+			Labels:    map[string]string{"spiffe": "scheduled"},
+			UID:       "scheduled-pod",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "test-pod",
+				Image: "test-pod",
+			}},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+		},
+	}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, pod))
+
+	// Pods not scheduled yet have no parent ID
+	s.reconcilePod(p, pod)
+	s.Require().Empty(s.listPodSpiffeIDs(pod))
+
+	// Scheduled pods are registered while still pending
+	pod.Spec.NodeName = "test-node"
+	s.Require().NoError(s.k8sClient.Update(s.ctx, pod))
+	s.reconcilePod(p, pod)
+	spiffeIDs := s.listPodSpiffeIDs(pod)
+	s.Require().Len(spiffeIDs, 1)
+	s.Require().Equal(makeID(s.trustDomain, "scheduled"), spiffeIDs[0].Spec.SpiffeId)
+	s.Require().Equal("test-node", spiffeIDs[0].Spec.Selector.NodeName)
+
+	s.deletePodSpiffeIDs(pod)
+}
+
+// TestContainerIdentities checks that a distinct SPIFFE ID is generated for
+// each container of a pod when container identities are enabled, and that the
+// SpiffeID resources are replaced when container identities are toggled.
+func (s *PodControllerTestSuite) TestContainerIdentities() {
+	config := PodReconcilerConfig{
+		Client:      s.k8sClient,
+		Cluster:     s.cluster,
+		Ctx:         s.ctx,
+		Log:         s.log,
+		PodLabel:    "spiffe",
+		Scheme:      s.scheme,
+		TrustDomain: s.trustDomain,
+	}
+	podIdentities := NewPodReconciler(config)
+	config.ContainerIdentities = true
+	containerIdentities := NewPodReconciler(config)
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      PodName,
+			Namespace: PodNamespace,
+			Labels:    map[string]string{"spiffe": "test-label"},
+			UID:       "container-identities",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "app",
+					Image: "app",
+				},
+				{
+					Name:  "envoy",
+					Image: "envoy",
+				},
+			},
+			NodeName: "test-node",
+		},
+	}
+	err := s.k8sClient.Create(s.ctx, &pod)
+	s.Require().NoError(err)
+
+	// Start with a single SPIFFE ID for the whole pod
+	s.reconcilePod(podIdentities, &pod)
+	spiffeIDs := s.listPodSpiffeIDs(&pod)
+	s.Require().Len(spiffeIDs, 1)
+	s.Require().Equal(PodName, spiffeIDs[0].Name)
+	s.Require().Empty(spiffeIDs[0].Spec.Selector.ContainerName)
+
+	// Turning container identities on replaces it with one per container
+	s.reconcilePod(containerIdentities, &pod)
+	spiffeIDs = s.listPodSpiffeIDs(&pod)
+	s.Require().Len(spiffeIDs, 2)
+
+	actual := make(map[string]spiffeidv1beta1.SpiffeID)
+	for _, spiffeID := range spiffeIDs {
+		actual[spiffeID.Name] = spiffeID
+	}
+	for _, containerName := range []string{"app", "envoy"} {
+		spiffeID, ok := actual[containerSpiffeIDName(PodName, containerName)]
+		s.Require().True(ok)
+		s.Require().Equal(makeID(s.trustDomain, "test-label/container/%s", containerName), spiffeID.Spec.SpiffeId)
+		s.Require().Equal(containerName, spiffeID.Spec.Selector.ContainerName)
+	}
+
+	// Turning container identities off goes back to a single SPIFFE ID
+	s.reconcilePod(podIdentities, &pod)
+	spiffeIDs = s.listPodSpiffeIDs(&pod)
+	s.Require().Len(spiffeIDs, 1)
+	s.Require().Equal(PodName, spiffeIDs[0].Name)
+	s.Require().Equal(makeID(s.trustDomain, "test-label"), spiffeIDs[0].Spec.SpiffeId)
+
+	s.deletePodSpiffeIDs(&pod)
+}
+
+func TestContainerSpiffeIDName(t *testing.T) {
+	// Joining the names would make both of these "web-app-db"
+	require.NotEqual(t, containerSpiffeIDName("web", "app-db"), containerSpiffeIDName("web-app", "db"))
+
+	name := containerSpiffeIDName(strings.Repeat("a", validation.DNS1123SubdomainMaxLength), "app")
+	require.Len(t, name, validation.DNS1123SubdomainMaxLength)
+	require.Empty(t, validation.IsDNS1123Subdomain(name))
+
+	name = containerSpiffeIDName(strings.Repeat("a", 235)+".b", "app")
+	require.Empty(t, validation.IsDNS1123Subdomain(name))
+}
+
+// TestIdentityCollision checks that the configured policy is applied when two pods
+// with different namespaces resolve to the same SPIFFE ID.
+func (s *PodControllerTestSuite) TestIdentityCollision() {
+	tests := []struct {
+		policy           string
+		expectedSpiffeID string
+		expectEntry      bool
+	}{
+		{
+			policy:           IdentityCollisionPolicyShare,
+			expectedSpiffeID: makeID(s.trustDomain, "shared"),
+			expectEntry:      true,
+		},
+		{
+			policy:      IdentityCollisionPolicyReject,
+			expectEntry: false,
+		},
+		{
+			policy:           IdentityCollisionPolicySuffix,
+			expectedSpiffeID: makeID(s.trustDomain, "shared/ns/other/sa/other-sa"),
+			expectEntry:      true,
+		},
+	}
+
+	for _, test := range tests {
+		recorder := record.NewFakeRecorder(10)
+		p := NewPodReconciler(PodReconcilerConfig{
+			Client:                  s.k8sClient,
+			Cluster:                 s.cluster,
+			Ctx:                     s.ctx,
+			EventRecorder:           recorder,
+			IdentityCollisionPolicy: test.policy,
+			Log:                     s.log,
+			PodLabel:                "spiffe",
+			Scheme:                  s.scheme,
+			TrustDomain:             s.trustDomain,
+		})
+
+		first := s.createLabeledPod("first", PodNamespace, "first-sa", "shared")
+		second := s.createLabeledPod("second", "other", "other-sa", "shared")
+		collisions := testutil.ToFloat64(identityCollisions.WithLabelValues("other", test.policy))
+
+		// Reconciling the colliding pod again must not report the collision again
+		for _, pod := range []*corev1.Pod{first, second, second} {
+			s.reconcilePod(p, pod)
+		}
+
+		spiffeIDList := spiffeidv1beta1.SpiffeIDList{}
+		err := s.k8sClient.List(s.ctx, &spiffeIDList, &client.ListOptions{
+			LabelSelector: labels.Set(map[string]string{
+				"podUid": string(second.ObjectMeta.UID),
+			}).AsSelector(),
+		})
+		s.Require().NoError(err)
+		if test.expectEntry {
+			s.Require().Len(spiffeIDList.Items, 1)
+			s.Require().Equal(test.expectedSpiffeID, spiffeIDList.Items[0].Spec.SpiffeId)
+		} else {
+			s.Require().Empty(spiffeIDList.Items)
+		}
+		s.Require().Len(recorder.Events, 1)
+		s.Require().Contains(<-recorder.Events, "IdentityCollision")
+		s.Require().Equal(collisions+1, testutil.ToFloat64(identityCollisions.WithLabelValues("other", test.policy)))
+		s.Require().Equal(1.0, testutil.ToFloat64(collidingIdentities.WithLabelValues("other", test.policy)))
+
+		for _, pod := range []*corev1.Pod{first, second} {
+			s.deletePodSpiffeIDs(pod)
+			s.reconcilePod(p, pod)
+		}
+		s.Require().Equal(0.0, testutil.ToFloat64(collidingIdentities.WithLabelValues("other", test.policy)))
+	}
+}
+
+// TestIdentityCollisionExistingSpiffeID checks how the collision policies
+// apply to a pod that was already registered before colliding.
+func (s *PodControllerTestSuite) TestIdentityCollisionExistingSpiffeID() {
+	s.Run("reject removes the existing registration", func() {
+		p := NewPodReconciler(PodReconcilerConfig{
+			Client:                  s.k8sClient,
+			Cluster:                 s.cluster,
+			Ctx:                     s.ctx,
+			IdentityCollisionPolicy: IdentityCollisionPolicyReject,
+			Log:                     s.log,
+			PodLabel:                "spiffe",
+			Scheme:                  s.scheme,
+			TrustDomain:             s.trustDomain,
+		})
+
+		first := s.createLabeledPod("first", PodNamespace, "first-sa", "shared")
+		second := s.createLabeledPod("second", "other", "other-sa", "own")
+		s.reconcilePod(p, first)
+		s.reconcilePod(p, second)
+		s.Require().Len(s.listPodSpiffeIDs(second), 1)
+
+		// The label of the second pod now collides with the first pod
+		second.Labels["spiffe"] = "shared"
+		s.Require().NoError(s.k8sClient.Update(s.ctx, second))
+		s.reconcilePod(p, second)
+		s.Require().Empty(s.listPodSpiffeIDs(second))
+
+		for _, pod := range []*corev1.Pod{first, second} {
+			s.deletePodSpiffeIDs(pod)
+			s.reconcilePod(p, pod)
+		}
+	})
+
+	s.Run("suffix keeps the suffixed SPIFFE ID", func() {
+		p := NewPodReconciler(PodReconcilerConfig{
+			Client:                  s.k8sClient,
+			Cluster:                 s.cluster,
+			Ctx:                     s.ctx,
+			IdentityCollisionPolicy: IdentityCollisionPolicySuffix,
+			Log:                     s.log,
+			PodLabel:                "spiffe",
+			Scheme:                  s.scheme,
+			TrustDomain:             s.trustDomain,
+		})
+
+		first := s.createLabeledPod("first", PodNamespace, "first-sa", "shared")
+		second := s.createLabeledPod("second", "other", "other-sa", "shared")
+		s.reconcilePod(p, first)
+		s.reconcilePod(p, second)
+
+		suffixed := makeID(s.trustDomain, "shared/ns/other/sa/other-sa")
+		spiffeIDs := s.listPodSpiffeIDs(second)
+		s.Require().Len(spiffeIDs, 1)
+		s.Require().Equal(suffixed, spiffeIDs[0].Spec.SpiffeId)
+
+		// The SPIFFE ID of the second pod doesn't change once the first pod is gone
+		s.deletePodSpiffeIDs(first)
+		s.reconcilePod(p, first)
+		s.reconcilePod(p, second)
+		spiffeIDs = s.listPodSpiffeIDs(second)
+		s.Require().Len(spiffeIDs, 1)
+		s.Require().Equal(suffixed, spiffeIDs[0].Spec.SpiffeId)
+
+		s.deletePodSpiffeIDs(second)
+		s.reconcilePod(p, second)
+	})
+}
+
+// TestNodeAttestor checks that pod entries are parented to the agent ID when
+// agents are not attested with k8s_psat, and that the parent ID of existing
+// SpiffeID resources follows node_attestor changes.
+func (s *PodControllerTestSuite) TestNodeAttestor() {
+	config := PodReconcilerConfig{
+		Client:      s.k8sClient,
+		Cluster:     s.cluster,
+		Ctx:         s.ctx,
+		Log:         s.log,
+		PodLabel:    "spiffe",
+		Scheme:      s.scheme,
+		TrustDomain: s.trustDomain,
+	}
+	psat := NewPodReconciler(config)
+	config.NodeAttestor = NodeAttestorConfig{
+		Name:         NodeAttestorAWSIID,
+		AWSAccountID: "123456789012",
+	}
+	awsIID := NewPodReconciler(config)
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "aws-node",
+			Labels: map[string]string{corev1.LabelZoneRegionStable: "us-east-1"},
+		},
+		Spec: corev1.NodeSpec{
+			ProviderID: "aws:///us-east-1a/i-0123456789abcdef0",
+		},
+	}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, node))
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "aws-pod",
+			Namespace: PodNamespace,
+			Labels:    map[string]string{"spiffe": "aws-workload"},
+			UID:       "aws-pod",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "test-pod",
+				Image: "test-pod",
+			}},
+			NodeName: node.Name,
+		},
+	}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, pod))
+
+	s.reconcilePod(psat, pod)
+	spiffeIDs := s.listPodSpiffeIDs(pod)
+	s.Require().Len(spiffeIDs, 1)
+	s.Require().Equal(makeID(s.trustDomain, "k8s-workload-registrar/%s/node/%s", s.cluster, node.Name), spiffeIDs[0].Spec.ParentId)
+
+	s.reconcilePod(awsIID, pod)
+	spiffeIDs = s.listPodSpiffeIDs(pod)
+	s.Require().Len(spiffeIDs, 1)
+	s.Require().Equal("spiffe://example.org/spire/agent/aws_iid/123456789012/us-east-1/i-0123456789abcdef0", spiffeIDs[0].Spec.ParentId)
+	s.Require().Equal(makeID(s.trustDomain, "aws-workload"), spiffeIDs[0].Spec.SpiffeId)
+
+	s.deletePodSpiffeIDs(pod)
+	s.Require().NoError(s.k8sClient.Delete(s.ctx, node))
+}
+
+func (s *PodControllerTestSuite) TestSpiffeIDLimits() {
+	recorder := record.NewFakeRecorder(10)
+	p := NewPodReconciler(PodReconcilerConfig{
+		Client:               s.k8sClient,
+		Cluster:              s.cluster,
+		Ctx:                  s.ctx,
+		EventRecorder:        recorder,
+		Log:                  s.log,
+		MaxSpiffeIDPathDepth: 2,
+		PodLabel:             "spiffe",
+		Scheme:               s.scheme,
+		TrustDomain:          s.trustDomain,
+	})
+
+	pod := s.createLabeledPod("limited", PodNamespace, "sa", "a/b")
+	s.reconcilePod(p, pod)
+	s.Require().Len(s.listPodSpiffeIDs(pod), 1)
+
+	// Changing the label to a deeper path removes the registration, and is
+	// only reported once
+	pod.Labels["spiffe"] = "a/b/c"
+	s.Require().NoError(s.k8sClient.Update(s.ctx, pod))
+	s.reconcilePod(p, pod)
+	s.reconcilePod(p, pod)
+	s.Require().Empty(s.listPodSpiffeIDs(pod))
+	s.Require().Len(recorder.Events, 1)
+	s.Require().Contains(<-recorder.Events, "InvalidSpiffeID")
+
+	s.deletePodSpiffeIDs(pod)
+	s.reconcilePod(p, pod)
+}
+
+func (s *PodControllerTestSuite) TestPodDNSName() {
+	p := NewPodReconciler(PodReconcilerConfig{
+		Client:      s.k8sClient,
+		Cluster:     s.cluster,
+		Ctx:         s.ctx,
+		Log:         s.log,
+		PodDNSName:  true,
+		PodLabel:    "spiffe",
+		Scheme:      s.scheme,
+		TrustDomain: s.trustDomain,
+	})
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dns"}}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, ns))
+	pod := s.createLabeledPod("web", "dns", "sa", "web")
+	s.reconcilePod(p, pod)
+	spiffeIDs := s.listPodSpiffeIDs(pod)
+	s.Require().Len(spiffeIDs, 1)
+	s.Require().Equal([]string{"web", "web.dns.pod.cluster.local"}, spiffeIDs[0].Spec.DnsNames)
+
+	// DNS names added by the endpoint controller are kept when the template changes
+	spiffeIDs[0].Spec.DnsNames = append(spiffeIDs[0].Spec.DnsNames, "svc.dns.svc")
+	s.Require().NoError(s.k8sClient.Update(s.ctx, &spiffeIDs[0]))
+	p.c.PodDNSNameTemplate = "{{ .ServiceAccount }}.{{ .Namespace }}.example.org"
+	s.reconcilePod(p, pod)
+	spiffeIDs = s.listPodSpiffeIDs(pod)
+	s.Require().Equal([]string{"web", "sa.dns.example.org", "svc.dns.svc"}, spiffeIDs[0].Spec.DnsNames)
+
+	// Opting the namespace out removes the pod DNS name
+	ns.Annotations = map[string]string{PodDNSNameAnnotation: "false"}
+	s.Require().NoError(s.k8sClient.Update(s.ctx, ns))
+	s.reconcilePod(p, pod)
+	spiffeIDs = s.listPodSpiffeIDs(pod)
+	s.Require().Equal([]string{"web", "svc.dns.svc"}, spiffeIDs[0].Spec.DnsNames)
+
+	// Opting the namespace in adds it back when not enabled for all namespaces
+	p.c.PodDNSName = false
+	ns.Annotations[PodDNSNameAnnotation] = "true"
+	s.Require().NoError(s.k8sClient.Update(s.ctx, ns))
+	s.reconcilePod(p, pod)
+	spiffeIDs = s.listPodSpiffeIDs(pod)
+	s.Require().Equal([]string{"web", "sa.dns.example.org", "svc.dns.svc"}, spiffeIDs[0].Spec.DnsNames)
+
+	s.deletePodSpiffeIDs(pod)
+	s.Require().NoError(s.k8sClient.Delete(s.ctx, ns))
+}
+
+func (s *PodControllerTestSuite) TestPodDNSNamePolicy() {
+	recorder := record.NewFakeRecorder(10)
+	p := NewPodReconciler(PodReconcilerConfig{
+		Client:        s.k8sClient,
+		Cluster:       s.cluster,
+		Ctx:           s.ctx,
+		EventRecorder: recorder,
+		Log:           s.log,
+		PodDNSName:    true,
+		PodLabel:      "spiffe",
+		Scheme:        s.scheme,
+		TrustDomain:   s.trustDomain,
+	})
+
+	// The namespace suffix replaces the template
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name: "dns-policy",
+		Annotations: map[string]string{
+			PodDNSNameSuffixAnnotation: ".Tenant.Example.org",
+		},
+	}}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, ns))
+	pod := s.createLabeledPod("web", "dns-policy", "sa", "web")
+	s.reconcilePod(p, pod)
+	spiffeIDs := s.listPodSpiffeIDs(pod)
+	s.Require().Len(spiffeIDs, 1)
+	s.Require().Equal([]string{"web", "web.tenant.example.org"}, spiffeIDs[0].Spec.DnsNames)
+
+	// Pod DNS names under the allowed suffixes are kept
+	ns.Annotations[PodDNSNameAllowedSuffixesAnnotation] = "other.example.org, example.org"
+	s.Require().NoError(s.k8sClient.Update(s.ctx, ns))
+	s.reconcilePod(p, pod)
+	spiffeIDs = s.listPodSpiffeIDs(pod)
+	s.Require().Equal([]string{"web", "web.tenant.example.org"}, spiffeIDs[0].Spec.DnsNames)
+	s.Require().Len(recorder.Events, 0)
+
+	// Others are removed
+	delete(ns.Annotations, PodDNSNameSuffixAnnotation)
+	s.Require().NoError(s.k8sClient.Update(s.ctx, ns))
+	s.reconcilePod(p, pod)
+	spiffeIDs = s.listPodSpiffeIDs(pod)
+	s.Require().Equal([]string{"web"}, spiffeIDs[0].Spec.DnsNames)
+	s.Require().Len(recorder.Events, 1)
+	s.Require().Contains(<-recorder.Events, "PodDNSNameNotAllowed")
+
+	s.deletePodSpiffeIDs(pod)
+	s.Require().NoError(s.k8sClient.Delete(s.ctx, ns))
+}
+
+func TestPodDNSNamePolicyAllows(t *testing.T) {
+	policy := podDNSNamePolicy{allowedSuffixes: []string{"example.org"}}
+	require.True(t, policy.allows("web.example.org"))
+	require.True(t, policy.allows("example.org"))
+	require.False(t, policy.allows("web.badexample.org"))
+	require.False(t, policy.allows("web.example.org.evil.com"))
+	require.True(t, podDNSNamePolicy{}.allows("web.example.com"))
+}
+
+func (s *PodControllerTestSuite) TestGroupLabel() {
+	p := NewPodReconciler(PodReconcilerConfig{
+		Client:      s.k8sClient,
+		Cluster:     s.cluster,
+		Ctx:         s.ctx,
+		GroupLabel:  "team",
+		Log:         s.log,
+		PodLabel:    "spiffe",
+		Scheme:      s.scheme,
+		TrustDomain: s.trustDomain,
+	})
+
+	pod := s.createLabeledPod("grouped", PodNamespace, "sa", "grouped")
+	pod.Labels["team"] = "payments"
+	s.Require().NoError(s.k8sClient.Update(s.ctx, pod))
+	s.reconcilePod(p, pod)
+	spiffeIDs := s.listPodSpiffeIDs(pod)
+	s.Require().Len(spiffeIDs, 1)
+	s.Require().Equal("payments", spiffeIDs[0].Labels[SpiffeIDGroupLabel])
+
+	// The group follows the pod label, and the resource stays disabled
+	spiffeIDs[0].Spec.Disabled = true
+	s.Require().NoError(s.k8sClient.Update(s.ctx, &spiffeIDs[0]))
+	pod.Labels["team"] = "billing"
+	s.Require().NoError(s.k8sClient.Update(s.ctx, pod))
+	s.reconcilePod(p, pod)
+	spiffeIDs = s.listPodSpiffeIDs(pod)
+	s.Require().Equal("billing", spiffeIDs[0].Labels[SpiffeIDGroupLabel])
+	s.Require().True(spiffeIDs[0].Spec.Disabled)
+
+	// Removing the pod label removes the group
+	delete(pod.Labels, "team")
+	s.Require().NoError(s.k8sClient.Update(s.ctx, pod))
+	s.reconcilePod(p, pod)
+	spiffeIDs = s.listPodSpiffeIDs(pod)
+	s.Require().NotContains(spiffeIDs[0].Labels, SpiffeIDGroupLabel)
+
+	s.deletePodSpiffeIDs(pod)
+}
+
+func (s *PodControllerTestSuite) TestSpecDrift() {
+	for _, tt := range []struct {
+		policy  string
+		kept    bool
+		flagged bool
+	}{
+		{policy: SpecDriftPolicyRevert},
+		{policy: SpecDriftPolicyAccept, kept: true},
+		{policy: SpecDriftPolicyFlag, kept: true, flagged: true},
+	} {
+		tt := tt
+		s.Run(tt.policy, func() {
+			p := NewPodReconciler(PodReconcilerConfig{
+				Client:          s.k8sClient,
+				Cluster:         s.cluster,
+				Ctx:             s.ctx,
+				Log:             s.log,
+				PodLabel:        "spiffe",
+				Scheme:          s.scheme,
+				SpecDriftPolicy: tt.policy,
+				TrustDomain:     s.trustDomain,
+			})
+
+			pod := s.createLabeledPod("drift-"+tt.policy, PodNamespace, "sa", "drift")
+			s.reconcilePod(p, pod)
+			spiffeIDs := s.listPodSpiffeIDs(pod)
+			s.Require().Len(spiffeIDs, 1)
+			derived := spiffeIDs[0].Spec.SpiffeId
+
+			// Change the resource by hand
+			manual := makeID(s.trustDomain, "manual")
+			spiffeIDs[0].Spec.SpiffeId = manual
+			spiffeIDs[0].Spec.Selector.ServiceAccount = "other"
+			s.Require().NoError(s.k8sClient.Update(s.ctx, &spiffeIDs[0]))
+			s.reconcilePod(p, pod)
+			spiffeIDs = s.listPodSpiffeIDs(pod)
+			if tt.kept {
+				s.Require().Equal(manual, spiffeIDs[0].Spec.SpiffeId)
+				s.Require().Equal("other", spiffeIDs[0].Spec.Selector.ServiceAccount)
+			} else {
+				s.Require().Equal(derived, spiffeIDs[0].Spec.SpiffeId)
+				s.Require().Empty(spiffeIDs[0].Spec.Selector.ServiceAccount)
+			}
+			condition := findSpiffeIDCondition(spiffeIDs[0].Status.Conditions, spiffeidv1beta1.SpiffeIDConditionSpecDrifted)
+			if tt.flagged {
+				s.Require().NotNil(condition)
+				s.Require().Equal(corev1.ConditionTrue, condition.Status)
+				s.Require().Equal("Fields changed by hand and no longer derived from the pod: spiffeId, selector", condition.Message)
+			} else {
+				s.Require().Nil(condition)
+			}
+
+			// Kept changes hold back changes of the pod until they are undone
+			if tt.kept {
+				pod.Labels["spiffe"] = "drift-relabeled"
+				s.Require().NoError(s.k8sClient.Update(s.ctx, pod))
+				s.reconcilePod(p, pod)
+				spiffeIDs = s.listPodSpiffeIDs(pod)
+				s.Require().Equal(manual, spiffeIDs[0].Spec.SpiffeId)
+
+				spiffeIDs[0].Spec.SpiffeId = derived
+				spiffeIDs[0].Spec.Selector.ServiceAccount = ""
+				s.Require().NoError(s.k8sClient.Update(s.ctx, &spiffeIDs[0]))
+				s.reconcilePod(p, pod)
+				spiffeIDs = s.listPodSpiffeIDs(pod)
+				s.Require().Equal(makeID(s.trustDomain, "drift-relabeled"), spiffeIDs[0].Spec.SpiffeId)
+			}
+			if tt.flagged {
+				condition = findSpiffeIDCondition(spiffeIDs[0].Status.Conditions, spiffeidv1beta1.SpiffeIDConditionSpecDrifted)
+				s.Require().NotNil(condition)
+				s.Require().Equal(corev1.ConditionFalse, condition.Status)
+			}
+
+			s.deletePodSpiffeIDs(pod)
+		})
+	}
+}
+
+func (s *PodControllerTestSuite) TestTerminatingPodTTL() {
+	p := NewPodReconciler(PodReconcilerConfig{
+		Client:            s.k8sClient,
+		Cluster:           s.cluster,
+		Ctx:               s.ctx,
+		Log:               s.log,
+		PodLabel:          "spiffe",
+		Scheme:            s.scheme,
+		TerminatingPodTTL: 30 * time.Second,
+		TrustDomain:       s.trustDomain,
+	})
+
+	pod := s.createLabeledPod("terminating", PodNamespace, "sa", "terminating")
+	s.reconcilePod(p, pod)
+	spiffeIDs := s.listPodSpiffeIDs(pod)
+	s.Require().Len(spiffeIDs, 1)
+	s.Require().Zero(spiffeIDs[0].Spec.MaxTtl)
+
+	now := metav1.Now()
+	pod.DeletionTimestamp = &now
+	s.Require().NoError(s.k8sClient.Update(s.ctx, pod))
+	s.reconcilePod(p, pod)
+	spiffeIDs = s.listPodSpiffeIDs(pod)
+	s.Require().Len(spiffeIDs, 1)
+	s.Require().Equal(int32(30), spiffeIDs[0].Spec.MaxTtl)
+
+	s.deletePodSpiffeIDs(pod)
+}
+
+func (s *PodControllerTestSuite) TestEntryBudgetThrottle() {
+	budget := NewEntryBudget(EntryBudgetConfig{
+		Action:            EntryBudgetThrottle,
+		Client:            s.k8sClient,
+		Ctx:               s.ctx,
+		Log:               s.log,
+		MaxEntriesPerNode: 1,
+	})
+	recorder := record.NewFakeRecorder(10)
+	p := NewPodReconciler(PodReconcilerConfig{
+		Client:        s.k8sClient,
+		Cluster:       s.cluster,
+		Ctx:           s.ctx,
+		EntryBudget:   budget,
+		EventRecorder: recorder,
+		Log:           s.log,
+		PodLabel:      "spiffe",
+		Scheme:        s.scheme,
+		TrustDomain:   s.trustDomain,
+	})
+
+	first := s.createLabeledPod("budget-1", PodNamespace, "sa", "budget-1")
+	second := s.createLabeledPod("budget-2", PodNamespace, "sa", "budget-2")
+	s.reconcilePod(p, first)
+	s.reconcilePod(p, second)
+	s.Require().Len(s.listPodSpiffeIDs(second), 1)
+
+	// New pods are not registered once the node is found over budget
+	s.Require().NoError(budget.check(s.ctx))
+	throttled := s.createLabeledPod("budget-3", PodNamespace, "sa", "budget-3")
+	s.reconcilePod(p, throttled)
+	s.Require().Empty(s.listPodSpiffeIDs(throttled))
+	s.Require().Len(recorder.Events, 1)
+	s.Require().Contains(<-recorder.Events, "EntryBudgetExceeded")
+
+	s.deletePodSpiffeIDs(first)
+	s.deletePodSpiffeIDs(second)
+	s.deletePodSpiffeIDs(throttled)
+}
+
+// TestCreateBatch checks that the SpiffeID resources of pods are created a
+// batch at a time, and that the pods beyond the batch are requeued
+func (s *PodControllerTestSuite) TestCreateBatch() {
+	p := NewPodReconciler(PodReconcilerConfig{
+		Client:              s.k8sClient,
+		Cluster:             s.cluster,
+		CreateBatchInterval: time.Minute,
+		CreateBatchSize:     1,
+		Ctx:                 s.ctx,
+		Log:                 s.log,
+		PodLabel:            "spiffe",
+		Scheme:              s.scheme,
+		TrustDomain:         s.trustDomain,
+	})
+
+	first := s.createLabeledPod("batch-1", PodNamespace, "sa", "batch-1")
+	second := s.createLabeledPod("batch-2", PodNamespace, "sa", "batch-2")
+	s.reconcilePod(p, first)
+	s.Require().Len(s.listPodSpiffeIDs(first), 1)
+
+	deferred := testutil.ToFloat64(deferredSpiffeIDCreates)
+	result, err := p.Reconcile(ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      second.Name,
+			Namespace: second.Namespace,
+		},
+	})
+	s.Require().NoError(err)
+	s.Require().True(result.RequeueAfter > 0 && result.RequeueAfter <= time.Minute)
+	s.Require().Empty(s.listPodSpiffeIDs(second))
+	s.Require().Equal(deferred+1, testutil.ToFloat64(deferredSpiffeIDCreates))
+
+	// Updates of existing resources are not deferred
+	first.Labels["spiffe"] = "batch-1-updated"
+	s.Require().NoError(s.k8sClient.Update(s.ctx, first))
+	s.reconcilePod(p, first)
+	spiffeIDs := s.listPodSpiffeIDs(first)
+	s.Require().Len(spiffeIDs, 1)
+	s.Require().Equal(makeID(s.trustDomain, "batch-1-updated"), spiffeIDs[0].Spec.SpiffeId)
+
+	// The pod is registered with the next batch
+	p.batcher.now = func() time.Time { return time.Now().Add(time.Minute) }
+	s.reconcilePod(p, second)
+	s.Require().Len(s.listPodSpiffeIDs(second), 1)
+
+	s.deletePodSpiffeIDs(first)
+	s.deletePodSpiffeIDs(second)
+}
+
+// TestCreateBatchFailure checks that failed creations don't use up the batch
+func (s *PodControllerTestSuite) TestCreateBatchFailure() {
+	failing := &failingCreateClient{Client: s.k8sClient, failures: 1}
+	p := NewPodReconciler(PodReconcilerConfig{
+		Client:              failing,
+		Cluster:             s.cluster,
+		CreateBatchInterval: time.Minute,
+		CreateBatchSize:     1,
+		Ctx:                 s.ctx,
+		Log:                 s.log,
+		PodLabel:            "spiffe",
+		Scheme:              s.scheme,
+		TrustDomain:         s.trustDomain,
+	})
+
+	pod := s.createLabeledPod("batch-failure", PodNamespace, "sa", "batch-failure")
+	_, err := p.Reconcile(ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	})
+	s.Require().EqualError(err, "create failed")
+	s.Require().Empty(s.listPodSpiffeIDs(pod))
+
+	// The retry is created within the same batch
+	s.reconcilePod(p, pod)
+	s.Require().Len(s.listPodSpiffeIDs(pod), 1)
+
+	s.deletePodSpiffeIDs(pod)
+}
+
+// failingCreateClient fails the given number of creations
+type failingCreateClient struct {
+	client.Client
+	failures int
+}
+
+func (c *failingCreateClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("create failed")
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+// TestUserSpiffeIDNameConflict checks that a SpiffeID resource owned by a user
+// is not taken over by the pod it is named after
+func (s *PodControllerTestSuite) TestUserSpiffeIDNameConflict() {
+	recorder := record.NewFakeRecorder(10)
+	p := NewPodReconciler(PodReconcilerConfig{
+		Client:        s.k8sClient,
+		Cluster:       s.cluster,
+		Ctx:           s.ctx,
+		EventRecorder: recorder,
+		Log:           s.log,
+		PodLabel:      "spiffe",
+		Scheme:        s.scheme,
+		TrustDomain:   s.trustDomain,
+	})
+
+	userSpiffeID := &spiffeidv1beta1.SpiffeID{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "name-conflict",
+			Namespace: PodNamespace,
+		},
+		Spec: spiffeidv1beta1.SpiffeIDSpec{
+			SpiffeId: makeID(s.trustDomain, "user"),
+			ParentId: makeID(s.trustDomain, "parent"),
+			Selector: spiffeidv1beta1.Selector{
+				Namespace: PodNamespace,
+			},
+		},
+	}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, userSpiffeID))
+
+	pod := s.createLabeledPod("name-conflict", PodNamespace, "sa", "name-conflict")
+	result, err := p.Reconcile(ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	})
+	s.Require().NoError(err)
+	s.Require().Equal(ctrl.Result{RequeueAfter: ownershipConflictRequeueInterval}, result)
+	s.Require().Len(recorder.Events, 1)
+	s.Require().Contains(<-recorder.Events, "SpiffeIDNameConflict")
+
+	// The resource of the user is left untouched
+	actual := spiffeidv1beta1.SpiffeID{}
+	s.Require().NoError(s.k8sClient.Get(s.ctx, client.ObjectKey{Namespace: PodNamespace, Name: "name-conflict"}, &actual))
+	s.Require().Equal(userSpiffeID.Spec, actual.Spec)
+	s.Require().Empty(actual.OwnerReferences)
+	s.Require().Equal(spiffeidv1beta1.OwnershipUser, actual.Ownership())
+
+	s.Require().NoError(s.k8sClient.Delete(s.ctx, &actual))
+	s.deletePodSpiffeIDs(pod)
+}
+
+func (s *PodControllerTestSuite) createLabeledPod(name, namespace, serviceAccount, label string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"spiffe": label},
+			UID:       types.UID(namespace + "-" + name),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "test-pod",
+				Image: "test-pod",
+			}},
+			NodeName:           "test-node",
+			ServiceAccountName: serviceAccount,
+		},
+	}
+	err := s.k8sClient.Create(s.ctx, pod)
+	s.Require().NoError(err)
+	return pod
+}
+
+func (s *PodControllerTestSuite) listPodSpiffeIDs(pod *corev1.Pod) []spiffeidv1beta1.SpiffeID {
+	spiffeIDList := spiffeidv1beta1.SpiffeIDList{}
+	err := s.k8sClient.List(s.ctx, &spiffeIDList, &client.ListOptions{
+		LabelSelector: labels.Set(map[string]string{
+			"podUid": string(pod.ObjectMeta.UID),
+		}).AsSelector(),
+	})
+	s.Require().NoError(err)
+	return spiffeIDList.Items
+}
+
+func (s *PodControllerTestSuite) deletePodSpiffeIDs(pod *corev1.Pod) {
+	for _, spiffeID := range s.listPodSpiffeIDs(pod) {
+		spiffeID := spiffeID
+		err := s.k8sClient.Delete(s.ctx, &spiffeID)
+		s.Require().NoError(err)
+	}
+
+	err := s.k8sClient.Delete(s.ctx, pod)
+	s.Require().NoError(err)
+}
+
+func (s *PodControllerTestSuite) reconcilePod(p *PodReconciler, pod *corev1.Pod) {
+	_, err := p.Reconcile(ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	})
+	s.Require().NoError(err)
+}
+
 func (s *PodControllerTestSuite) reconcile(p *PodReconciler) {
 	req := ctrl.Request{
 		NamespacedName: types.NamespacedName{
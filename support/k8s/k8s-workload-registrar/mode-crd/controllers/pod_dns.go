@@ -0,0 +1,232 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultPodDNSNameTemplate is the DNS name added to pod SVIDs when pod
+	// DNS names are enabled and no template is configured
+	DefaultPodDNSNameTemplate = "{{ .PodName }}.{{ .Namespace }}.pod.cluster.local"
+	// PodDNSNameAnnotation can be set to "false" on a namespace to not add
+	// the pod DNS name to the SVIDs of its pods, or to "true" to add it even
+	// if pod DNS names are not enabled for all namespaces
+	PodDNSNameAnnotation = "spiffe.io/pod-dns-name"
+	// PodDNSNameSuffixAnnotation can be set on a namespace to name its pods
+	// <pod>.<suffix> instead of rendering the pod DNS name template
+	PodDNSNameSuffixAnnotation = "spiffe.io/pod-dns-name-suffix"
+	// PodDNSNameAllowedSuffixesAnnotation can be set on a namespace to a
+	// comma separated list of DNS suffixes. Pod DNS names not under any of
+	// them are not added to the SVIDs of the pods of the namespace.
+	PodDNSNameAllowedSuffixesAnnotation = "spiffe.io/pod-dns-name-allowed-suffixes"
+	// podDNSNameSpiffeIDAnnotation records the pod DNS name added to a
+	// SpiffeID resource, so it can be removed when it is no longer desired
+	podDNSNameSpiffeIDAnnotation = "spiffe.io/added-pod-dns-name"
+)
+
+// podDNSNameTemplateData holds the values available to pod DNS name templates
+type podDNSNameTemplateData struct {
+	PodName        string
+	Namespace      string
+	ServiceAccount string
+}
+
+// ParsePodDNSNameTemplate parses a pod DNS name template, or the default one
+// if empty
+func ParsePodDNSNameTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultPodDNSNameTemplate
+	}
+	return template.New("pod-dns-name").Option("missingkey=error").Parse(text)
+}
+
+// podDNSNamePolicy holds the pod DNS name settings of a namespace
+type podDNSNamePolicy struct {
+	// enabled tells whether the pods of the namespace get a pod DNS name
+	enabled bool
+	// suffix, if set, replaces the pod DNS name template
+	suffix string
+	// allowedSuffixes, if set, are the only DNS suffixes pod DNS names may
+	// be under
+	allowedSuffixes []string
+}
+
+// allows returns whether the DNS name is under one of the allowed suffixes, if
+// any
+func (p podDNSNamePolicy) allows(dnsName string) bool {
+	if len(p.allowedSuffixes) == 0 {
+		return true
+	}
+	for _, suffix := range p.allowedSuffixes {
+		if dnsName == suffix || strings.HasSuffix(dnsName, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// podDNSName returns the DNS name to add to the SVIDs of the pod, or an empty
+// string if the pod DNS name is disabled for the namespace of the pod. Pods
+// whose DNS name can't be rendered, or is not allowed in their namespace, are
+// registered without it.
+func (r *PodReconciler) podDNSName(ctx context.Context, pod *corev1.Pod) (string, error) {
+	podDNSNameTemplate := r.currentSettings().podDNSNameTemplate
+	if podDNSNameTemplate == "" && !r.c.PodDNSName {
+		// The feature is not configured, namespaces are not looked up
+		return "", nil
+	}
+
+	policy, err := r.podDNSNamePolicy(ctx, pod.Namespace)
+	if err != nil || !policy.enabled {
+		return "", err
+	}
+
+	log := r.c.Log.WithFields(logrus.Fields{
+		"pod":       pod.Name,
+		"namespace": pod.Namespace,
+	})
+
+	var dnsName string
+	if policy.suffix != "" {
+		dnsName, err = validatePodDNSName(pod.Name + "." + policy.suffix)
+	} else {
+		dnsName, err = renderPodDNSName(podDNSNameTemplate, pod)
+	}
+	if err != nil {
+		log.WithError(err).Warn("Unable to render pod DNS name")
+		return "", nil
+	}
+
+	if !policy.allows(dnsName) {
+		log.WithField("dnsName", dnsName).Warn("Pod DNS name is not under the DNS suffixes allowed in the namespace")
+		r.recordEvent(pod, corev1.EventTypeWarning, "PodDNSNameNotAllowed",
+			"Pod DNS name %s is not under the DNS suffixes allowed in namespace %s, not adding it", dnsName, pod.Namespace)
+		return "", nil
+	}
+	return dnsName, nil
+}
+
+// renderPodDNSName renders the pod DNS name template for the pod
+func renderPodDNSName(text string, pod *corev1.Pod) (string, error) {
+	tmpl, err := ParsePodDNSNameTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, podDNSNameTemplateData{
+		PodName:        pod.Name,
+		Namespace:      pod.Namespace,
+		ServiceAccount: pod.Spec.ServiceAccountName,
+	}); err != nil {
+		return "", err
+	}
+	return validatePodDNSName(buf.String())
+}
+
+// validatePodDNSName lowercases the pod DNS name and checks it is a valid DNS
+// name
+func validatePodDNSName(dnsName string) (string, error) {
+	dnsName = strings.ToLower(dnsName)
+	if errs := validation.IsDNS1123Subdomain(dnsName); len(errs) > 0 {
+		return "", fmt.Errorf("invalid pod DNS name %q: %s", dnsName, strings.Join(errs, ", "))
+	}
+	return dnsName, nil
+}
+
+// podDNSNamePolicy returns the pod DNS name policy of the namespace. Whether
+// the pod DNS name is added to the SVIDs of the pods in the namespace is set by
+// the PodDNSNameAnnotation annotation of the namespace or else by the
+// registrar configuration. Namespace owners may also set the suffix of the pod
+// DNS names, and restrict them to some suffixes.
+func (r *PodReconciler) podDNSNamePolicy(ctx context.Context, namespace string) (podDNSNamePolicy, error) {
+	ns := corev1.Namespace{}
+	if err := r.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+		if !errors.IsNotFound(err) {
+			return podDNSNamePolicy{}, err
+		}
+	}
+
+	policy := podDNSNamePolicy{
+		suffix: normalizeDNSSuffix(ns.Annotations[PodDNSNameSuffixAnnotation]),
+	}
+	switch ns.Annotations[PodDNSNameAnnotation] {
+	case "true":
+		policy.enabled = true
+	case "false":
+		policy.enabled = false
+	default:
+		policy.enabled = r.c.PodDNSName
+	}
+	for _, suffix := range strings.Split(ns.Annotations[PodDNSNameAllowedSuffixesAnnotation], ",") {
+		if suffix = normalizeDNSSuffix(suffix); suffix != "" {
+			policy.allowedSuffixes = append(policy.allowedSuffixes, suffix)
+		}
+	}
+	return policy, nil
+}
+
+// normalizeDNSSuffix lowercases the DNS suffix and strips its surrounding dots
+// and spaces, so ".Example.org." and "example.org" are the same suffix
+func normalizeDNSSuffix(suffix string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(suffix), "."))
+}
+
+// setPodDNSName makes the pod DNS name, if any, the second DNS name of the
+// resource, after the pod name, and removes the pod DNS name previously set
+// if it has changed. DNS names added by the endpoint controller are kept.
+// It returns true if the resource was modified.
+func setPodDNSName(spiffeID *spiffeidv1beta1.SpiffeID, dnsName string) bool {
+	previous := spiffeID.Annotations[podDNSNameSpiffeIDAnnotation]
+	if previous == dnsName && (dnsName == "" || containsString(spiffeID.Spec.DnsNames, dnsName)) {
+		return false
+	}
+
+	if previous != "" {
+		spiffeID.Spec.DnsNames = removeStringIf(spiffeID.Spec.DnsNames, previous)
+		delete(spiffeID.Annotations, podDNSNameSpiffeIDAnnotation)
+	}
+	if dnsName == "" {
+		return true
+	}
+
+	if !containsString(spiffeID.Spec.DnsNames, dnsName) {
+		i := 0
+		if len(spiffeID.Spec.DnsNames) > 0 {
+			i = 1
+		}
+		dnsNames := append([]string{}, spiffeID.Spec.DnsNames[:i]...)
+		dnsNames = append(dnsNames, dnsName)
+		spiffeID.Spec.DnsNames = append(dnsNames, spiffeID.Spec.DnsNames[i:]...)
+	}
+	if spiffeID.Annotations == nil {
+		spiffeID.Annotations = make(map[string]string)
+	}
+	spiffeID.Annotations[podDNSNameSpiffeIDAnnotation] = dnsName
+	return true
+}
@@ -0,0 +1,115 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// DefaultRequeueQPS and DefaultRequeueBurst are the overall requeue rate
+	// limits of the controller-runtime default work queue rate limiter
+	DefaultRequeueQPS   = 10
+	DefaultRequeueBurst = 100
+	// DefaultCreateBatchInterval is the interval between the batches of
+	// SpiffeID resources created when only the batch size is set
+	DefaultCreateBatchInterval = time.Second
+
+	// Per-pod requeue delays of the controller-runtime default work queue
+	// rate limiter, doubled on each consecutive failure of the pod
+	requeueBaseDelay = 5 * time.Millisecond
+	requeueMaxDelay  = 1000 * time.Second
+)
+
+// podRateLimiter returns the rate limiter of the pod work queue. It delays
+// the requeues of each pod exponentially with its consecutive failures, and
+// limits the overall requeue rate to the given QPS and burst, or to the
+// defaults if unset.
+func podRateLimiter(qps float64, burst int) workqueue.RateLimiter {
+	if qps <= 0 {
+		qps = DefaultRequeueQPS
+	}
+	if burst <= 0 {
+		burst = DefaultRequeueBurst
+	}
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(requeueBaseDelay, requeueMaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	)
+}
+
+// createBatcher paces the creation of SpiffeID resources in batches: at most
+// size resources are created in each interval. When the pods of a large
+// cluster are all reconciled at once, e.g. when the registrar starts, their
+// resources are created a batch at a time rather than all together, which
+// would burst entry creations onto the SPIRE server.
+type createBatcher struct {
+	size     int
+	interval time.Duration
+	now      func() time.Time
+
+	mtx sync.Mutex
+	// batchStart is when the current batch started, and created the number
+	// of resources created in it
+	batchStart time.Time
+	created    int
+}
+
+func newCreateBatcher(size int, interval time.Duration) *createBatcher {
+	if interval <= 0 {
+		interval = DefaultCreateBatchInterval
+	}
+	return &createBatcher{
+		size:     size,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// reserve reserves the creation of a resource in the current batch. It
+// returns the start of the batch and zero if the resource can be created now,
+// or how long until the next batch starts if the current batch is full.
+func (b *createBatcher) reserve() (time.Time, time.Duration) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := b.now()
+	if next := b.batchStart.Add(b.interval); !now.Before(next) {
+		b.batchStart = now
+		b.created = 0
+	}
+	if b.created < b.size {
+		b.created++
+		return b.batchStart, 0
+	}
+	return b.batchStart, b.batchStart.Add(b.interval).Sub(now)
+}
+
+// release returns a reservation made in the batch started at the given time,
+// when the resource could not be created after all, so failed creations
+// don't use up the batch. Reservations of past batches are not returned.
+func (b *createBatcher) release(batchStart time.Time) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.batchStart.Equal(batchStart) && b.created > 0 {
+		b.created--
+	}
+}
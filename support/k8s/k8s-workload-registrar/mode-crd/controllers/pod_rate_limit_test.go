@@ -0,0 +1,75 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateBatcher(t *testing.T) {
+	now := time.Now()
+	b := newCreateBatcher(2, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	reserve := func() time.Duration {
+		_, wait := b.reserve()
+		return wait
+	}
+
+	// The first batch starts with the first creation
+	first, wait := b.reserve()
+	require.Zero(t, wait)
+	require.Equal(t, now, first)
+	now = now.Add(4 * time.Second)
+	require.Zero(t, reserve())
+	require.Equal(t, 6*time.Second, reserve())
+
+	// Released reservations can be taken again
+	b.release(first)
+	require.Zero(t, reserve())
+	require.Equal(t, 6*time.Second, reserve())
+
+	// The next batch starts once the interval has elapsed
+	now = now.Add(6 * time.Second)
+	require.Zero(t, reserve())
+	require.Zero(t, reserve())
+	now = now.Add(time.Second)
+	require.Equal(t, 9*time.Second, reserve())
+
+	// Reservations of past batches are not returned to the current one
+	b.release(first)
+	require.Equal(t, 9*time.Second, reserve())
+
+	require.Equal(t, DefaultCreateBatchInterval, newCreateBatcher(1, 0).interval)
+}
+
+func TestPodRateLimiter(t *testing.T) {
+	// Requeues of a pod are delayed exponentially with its failures
+	limiter := podRateLimiter(0, 0)
+	require.Equal(t, requeueBaseDelay, limiter.When("pod"))
+	require.Equal(t, 2*requeueBaseDelay, limiter.When("pod"))
+	require.Equal(t, 2, limiter.NumRequeues("pod"))
+	limiter.Forget("pod")
+	require.Zero(t, limiter.NumRequeues("pod"))
+
+	// Once the burst is used up, requeues wait for the overall rate
+	limiter = podRateLimiter(1, 1)
+	require.Equal(t, requeueBaseDelay, limiter.When("pod"))
+	require.InDelta(t, float64(time.Second), float64(limiter.When("other")), float64(100*time.Millisecond))
+}
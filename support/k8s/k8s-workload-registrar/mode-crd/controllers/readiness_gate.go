@@ -0,0 +1,163 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// IdentityReadyCondition is the type of the pod condition set by the
+// registrar once the registration entries of the pod are deemed propagated
+// to the agents. Pods opt in by listing it in their readiness gates.
+const IdentityReadyCondition corev1.PodConditionType = "spiffe.io/identity-ready"
+
+// DefaultIdentityPropagationDelay is how long the entries of a pod are
+// assumed to take to reach the agents, if not overridden by the config. It
+// covers the entry cache reload of the server and the synchronization of the
+// agents, which both happen every 5 seconds by default.
+const DefaultIdentityPropagationDelay = 10 * time.Second
+
+const (
+	identityReadyReasonPropagating = "EntryPropagating"
+	identityReadyReasonPropagated  = "EntryPropagated"
+)
+
+// updatePodReadiness sets the IdentityReadyCondition of the pod owning the
+// SpiffeID resource, if the pod has the readiness gate. The condition turns
+// False once the entries of all the SpiffeID resources of the pod have been
+// created, and True once the propagation delay has elapsed since. A pod
+// stays ready once it is.
+func (r *SpiffeIDReconciler) updatePodReadiness(ctx context.Context, spiffeID *spiffeidv1beta1.SpiffeID) (ctrl.Result, error) {
+	ownerRef := metav1.GetControllerOf(spiffeID)
+	if ownerRef == nil || ownerRef.Kind != "Pod" {
+		return ctrl.Result{}, nil
+	}
+
+	pod := corev1.Pod{}
+	key := client.ObjectKey{Namespace: spiffeID.Namespace, Name: ownerRef.Name}
+	if err := r.Get(ctx, key, &pod); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if pod.UID != ownerRef.UID || !hasReadinessGate(&pod, IdentityReadyCondition) {
+		return ctrl.Result{}, nil
+	}
+
+	current := findPodCondition(pod.Status.Conditions, IdentityReadyCondition)
+	if current != nil && current.Status == corev1.ConditionTrue {
+		return ctrl.Result{}, nil
+	}
+
+	registered, err := r.podEntriesCreated(ctx, &pod)
+	if err != nil || !registered {
+		return ctrl.Result{}, err
+	}
+
+	delay := r.c.IdentityPropagationDelay
+	if current == nil || current.Reason != identityReadyReasonPropagating {
+		return ctrl.Result{RequeueAfter: delay}, r.setIdentityReadyCondition(ctx, key, corev1.PodCondition{
+			Type:    IdentityReadyCondition,
+			Status:  corev1.ConditionFalse,
+			Reason:  identityReadyReasonPropagating,
+			Message: "Registration entries created, waiting for the agent to sync them",
+		})
+	}
+
+	if elapsed := r.now().Sub(current.LastTransitionTime.Time); elapsed < delay {
+		return ctrl.Result{RequeueAfter: delay - elapsed}, nil
+	}
+
+	if err := r.setIdentityReadyCondition(ctx, key, corev1.PodCondition{
+		Type:    IdentityReadyCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  identityReadyReasonPropagated,
+		Message: "Registration entries propagated to the agent",
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.c.Log.WithFields(logrus.Fields{
+		"pod":       pod.Name,
+		"namespace": pod.Namespace,
+	}).Debug("Pod identity is ready")
+	return ctrl.Result{}, nil
+}
+
+// podEntriesCreated returns whether the entries of all the SpiffeID resources
+// of the pod have been created
+func (r *SpiffeIDReconciler) podEntriesCreated(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	spiffeIDList := spiffeidv1beta1.SpiffeIDList{}
+	if err := r.List(ctx, &spiffeIDList, client.InNamespace(pod.Namespace), client.MatchingLabels{"podUid": string(pod.UID)}); err != nil {
+		return false, err
+	}
+
+	found := false
+	for i := range spiffeIDList.Items {
+		spiffeID := &spiffeIDList.Items[i]
+		if !metav1.IsControlledBy(spiffeID, pod) {
+			continue
+		}
+		if spiffeID.Status.EntryId == nil {
+			return false, nil
+		}
+		found = true
+	}
+	return found, nil
+}
+
+// setIdentityReadyCondition replaces the IdentityReadyCondition of the pod
+func (r *SpiffeIDReconciler) setIdentityReadyCondition(ctx context.Context, key client.ObjectKey, condition corev1.PodCondition) error {
+	condition.LastTransitionTime = metav1.NewTime(r.now())
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		pod := corev1.Pod{}
+		if err := r.Get(ctx, key, &pod); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		if current := findPodCondition(pod.Status.Conditions, condition.Type); current != nil {
+			*current = condition
+		} else {
+			pod.Status.Conditions = append(pod.Status.Conditions, condition)
+		}
+		return r.Status().Update(ctx, &pod)
+	})
+}
+
+func hasReadinessGate(pod *corev1.Pod, conditionType corev1.PodConditionType) bool {
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == conditionType {
+			return true
+		}
+	}
+	return false
+}
+
+func findPodCondition(conditions []corev1.PodCondition, conditionType corev1.PodConditionType) *corev1.PodCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
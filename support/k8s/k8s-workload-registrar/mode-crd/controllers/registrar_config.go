@@ -0,0 +1,283 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/identity"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	registrarConfigReasonApplied = "Applied"
+	registrarConfigReasonInvalid = "InvalidSpec"
+)
+
+// podSettings are the settings of the PodReconciler that can be changed at
+// runtime by a RegistrarConfig resource
+type podSettings struct {
+	identity           identity.Config
+	podDNSNameTemplate string
+	disabledNamespaces []string
+}
+
+// staticPodSettings returns the settings from the registrar configuration
+func staticPodSettings(config PodReconcilerConfig) podSettings {
+	return podSettings{
+		identity: identity.Config{
+			TrustDomain:   config.TrustDomain,
+			PodLabel:      config.PodLabel,
+			PodAnnotation: config.PodAnnotation,
+			MaxIDLength:   config.MaxSpiffeIDLength,
+			MaxPathDepth:  config.MaxSpiffeIDPathDepth,
+		},
+		podDNSNameTemplate: config.PodDNSNameTemplate,
+		disabledNamespaces: config.DisabledNamespaces,
+	}
+}
+
+func (r *PodReconciler) currentSettings() podSettings {
+	r.settingsMtx.RLock()
+	defer r.settingsMtx.RUnlock()
+	return r.settings
+}
+
+// applyRegistrarConfig overrides the settings from the registrar
+// configuration with those set by the spec, or reverts to them if the spec is
+// nil. The spec must have been validated. It returns whether the settings
+// have changed.
+func (r *PodReconciler) applyRegistrarConfig(spec *spiffeidv1beta1.RegistrarConfigSpec) bool {
+	settings := staticPodSettings(r.c)
+	if spec != nil {
+		switch spec.Mode {
+		case spiffeidv1beta1.RegistrarConfigModeServiceAccount:
+			settings.identity.PodLabel = ""
+			settings.identity.PodAnnotation = ""
+		case spiffeidv1beta1.RegistrarConfigModeLabel:
+			settings.identity.PodLabel = spec.Key
+			settings.identity.PodAnnotation = ""
+		case spiffeidv1beta1.RegistrarConfigModeAnnotation:
+			settings.identity.PodLabel = ""
+			settings.identity.PodAnnotation = spec.Key
+		}
+		if spec.PodDNSNameTemplate != "" {
+			settings.podDNSNameTemplate = spec.PodDNSNameTemplate
+		}
+		if spec.DisabledNamespaces != nil {
+			settings.disabledNamespaces = append([]string(nil), spec.DisabledNamespaces...)
+		}
+	}
+
+	r.settingsMtx.Lock()
+	defer r.settingsMtx.Unlock()
+	if reflect.DeepEqual(r.settings, settings) {
+		return false
+	}
+	r.settings = settings
+	return true
+}
+
+// resyncPods reconciles all the pods again, so they are registered according
+// to the current settings. It is a no-op until the reconciler is set up.
+func (r *PodReconciler) resyncPods(ctx context.Context) error {
+	if r.resync == nil {
+		return nil
+	}
+
+	podList := corev1.PodList{}
+	if err := r.List(ctx, &podList); err != nil {
+		return err
+	}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		select {
+		case r.resync <- event.GenericEvent{Meta: pod, Object: pod}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// validateRegistrarConfig returns why the RegistrarConfig spec is invalid, if
+// it is
+func validateRegistrarConfig(spec *spiffeidv1beta1.RegistrarConfigSpec) []string {
+	var errs []string
+	switch spec.Mode {
+	case "", spiffeidv1beta1.RegistrarConfigModeServiceAccount:
+		if spec.Key != "" {
+			errs = append(errs, fmt.Sprintf("key must not be set with the %q mode", spec.Mode))
+		}
+	case spiffeidv1beta1.RegistrarConfigModeLabel, spiffeidv1beta1.RegistrarConfigModeAnnotation:
+		if spec.Key == "" {
+			errs = append(errs, fmt.Sprintf("key is required with the %q mode", spec.Mode))
+			break
+		}
+		for _, msg := range validation.IsQualifiedName(spec.Key) {
+			errs = append(errs, fmt.Sprintf("invalid key %q: %s", spec.Key, msg))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("invalid mode %q, valid values are %s, %s and %s", spec.Mode,
+			spiffeidv1beta1.RegistrarConfigModeServiceAccount, spiffeidv1beta1.RegistrarConfigModeLabel, spiffeidv1beta1.RegistrarConfigModeAnnotation))
+	}
+
+	if spec.PodDNSNameTemplate != "" {
+		if _, err := ParsePodDNSNameTemplate(spec.PodDNSNameTemplate); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid podDNSNameTemplate: %v", err))
+		}
+	}
+
+	for _, namespace := range spec.DisabledNamespaces {
+		for _, msg := range validation.IsDNS1123Label(namespace) {
+			errs = append(errs, fmt.Sprintf("invalid disabled namespace %q: %s", namespace, msg))
+		}
+	}
+	return errs
+}
+
+// RegistrarConfigReconcilerConfig holds the config passed in when creating
+// the reconciler
+type RegistrarConfigReconcilerConfig struct {
+	Client client.Client
+	Ctx    context.Context
+	Log    logrus.FieldLogger
+	// Name and Namespace of the RegistrarConfig resource applied by the
+	// registrar. Other RegistrarConfig resources are ignored.
+	Name          string
+	Namespace     string
+	PodReconciler *PodReconciler
+}
+
+// RegistrarConfigReconciler applies the RegistrarConfig resource to the
+// PodReconciler, and reports in its status whether it was applied
+type RegistrarConfigReconciler struct {
+	client.Client
+	c RegistrarConfigReconcilerConfig
+}
+
+// NewRegistrarConfigReconciler creates a new RegistrarConfigReconciler object
+func NewRegistrarConfigReconciler(config RegistrarConfigReconcilerConfig) *RegistrarConfigReconciler {
+	return &RegistrarConfigReconciler{
+		Client: config.Client,
+		c:      config,
+	}
+}
+
+// SetupWithManager adds a controller manager to manage this reconciler
+func (r *RegistrarConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&spiffeidv1beta1.RegistrarConfig{}).
+		Complete(r)
+}
+
+// Reconcile applies the RegistrarConfig resource if it is valid. The last
+// valid spec keeps being applied while the resource is invalid, and the
+// registrar configuration is restored once the resource is deleted.
+func (r *RegistrarConfigReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	if req.Namespace != r.c.Namespace || req.Name != r.c.Name {
+		return ctrl.Result{}, nil
+	}
+
+	ctx := r.c.Ctx
+	log := r.c.Log.WithFields(logrus.Fields{
+		"name":      req.Name,
+		"namespace": req.Namespace,
+	})
+
+	config := spiffeidv1beta1.RegistrarConfig{}
+	if err := r.Get(ctx, req.NamespacedName, &config); err != nil {
+		if !errors.IsNotFound(err) {
+			log.WithError(err).Error("Unable to get RegistrarConfig")
+			return ctrl.Result{}, err
+		}
+		if r.c.PodReconciler.applyRegistrarConfig(nil) {
+			log.Info("RegistrarConfig deleted, restored the registrar configuration")
+			return ctrl.Result{}, r.c.PodReconciler.resyncPods(ctx)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	validationErrors := validateRegistrarConfig(&config.Spec)
+	if len(validationErrors) > 0 {
+		log.WithField("errors", strings.Join(validationErrors, "; ")).Warn("Not applying invalid RegistrarConfig")
+	} else if r.c.PodReconciler.applyRegistrarConfig(&config.Spec) {
+		log.Info("Applied RegistrarConfig")
+		if err := r.c.PodReconciler.resyncPods(ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, r.updateStatus(ctx, req.NamespacedName, validationErrors)
+}
+
+// updateStatus sets the Applied condition and the validation errors of the
+// RegistrarConfig resource, if they changed
+func (r *RegistrarConfigReconciler) updateStatus(ctx context.Context, key client.ObjectKey, validationErrors []string) error {
+	condition := spiffeidv1beta1.RegistrarConfigCondition{
+		Type:    spiffeidv1beta1.RegistrarConfigConditionApplied,
+		Status:  corev1.ConditionTrue,
+		Reason:  registrarConfigReasonApplied,
+		Message: "Spec applied by the registrar",
+	}
+	if len(validationErrors) > 0 {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = registrarConfigReasonInvalid
+		condition.Message = "Spec rejected, the last valid spec is still applied"
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		config := spiffeidv1beta1.RegistrarConfig{}
+		if err := r.Get(ctx, key, &config); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		status := spiffeidv1beta1.RegistrarConfigStatus{
+			ObservedGeneration: config.Generation,
+			ValidationErrors:   validationErrors,
+		}
+		condition.LastTransitionTime = metav1.Now()
+		for _, current := range config.Status.Conditions {
+			if current.Type != condition.Type {
+				status.Conditions = append(status.Conditions, current)
+				continue
+			}
+			if current.Status == condition.Status {
+				condition.LastTransitionTime = current.LastTransitionTime
+			}
+		}
+		status.Conditions = append(status.Conditions, condition)
+
+		if reflect.DeepEqual(config.Status, status) {
+			return nil
+		}
+		config.Status = status
+		return r.Status().Update(ctx, &config)
+	})
+}
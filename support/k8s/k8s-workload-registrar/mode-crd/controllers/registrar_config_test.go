@@ -0,0 +1,166 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake" // nolint: staticcheck // No longer deprecated in newer versions.
+)
+
+func TestRegistrarConfigReconciler(t *testing.T) {
+	require.NoError(t, spiffeidv1beta1.AddToScheme(scheme.Scheme))
+
+	ctx := context.Background()
+	log, _ := test.NewNullLogger()
+	key := types.NamespacedName{Namespace: "spire", Name: "registrar"}
+	k8sClient := fake.NewFakeClientWithScheme(scheme.Scheme)
+
+	pods := NewPodReconciler(PodReconcilerConfig{
+		Client:             k8sClient,
+		Ctx:                ctx,
+		DisabledNamespaces: []string{"kube-system"},
+		Log:                log,
+		PodAnnotation:      "spiffe",
+		Scheme:             scheme.Scheme,
+		TrustDomain:        TrustDomain,
+	})
+	r := NewRegistrarConfigReconciler(RegistrarConfigReconcilerConfig{
+		Client:        k8sClient,
+		Ctx:           ctx,
+		Log:           log,
+		Name:          key.Name,
+		Namespace:     key.Namespace,
+		PodReconciler: pods,
+	})
+	static := pods.currentSettings()
+
+	reconcile := func(key types.NamespacedName) {
+		_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+		require.NoError(t, err)
+	}
+	requireStatus := func(status corev1.ConditionStatus, reason string, validationErrors []string) {
+		config := spiffeidv1beta1.RegistrarConfig{}
+		require.NoError(t, k8sClient.Get(ctx, key, &config))
+		require.Len(t, config.Status.Conditions, 1)
+		require.Equal(t, spiffeidv1beta1.RegistrarConfigConditionApplied, config.Status.Conditions[0].Type)
+		require.Equal(t, status, config.Status.Conditions[0].Status)
+		require.Equal(t, reason, config.Status.Conditions[0].Reason)
+		require.Equal(t, validationErrors, config.Status.ValidationErrors)
+	}
+
+	config := &spiffeidv1beta1.RegistrarConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Spec: spiffeidv1beta1.RegistrarConfigSpec{
+			Mode:               spiffeidv1beta1.RegistrarConfigModeLabel,
+			Key:                "spire-workload",
+			PodDNSNameTemplate: "{{ .PodName }}.example.org",
+		},
+	}
+	require.NoError(t, k8sClient.Create(ctx, config))
+
+	// RegistrarConfig resources with another name are ignored
+	other := config.DeepCopy()
+	other.Namespace = "default"
+	require.NoError(t, k8sClient.Create(ctx, other))
+	reconcile(types.NamespacedName{Namespace: other.Namespace, Name: other.Name})
+	require.Equal(t, static, pods.currentSettings())
+
+	// The spec is applied, unset fields keep the static settings
+	reconcile(key)
+	settings := pods.currentSettings()
+	require.Equal(t, "spire-workload", settings.identity.PodLabel)
+	require.Empty(t, settings.identity.PodAnnotation)
+	require.Equal(t, "{{ .PodName }}.example.org", settings.podDNSNameTemplate)
+	require.Equal(t, []string{"kube-system"}, settings.disabledNamespaces)
+	requireStatus(corev1.ConditionTrue, registrarConfigReasonApplied, nil)
+
+	// An invalid spec is rejected and the last valid one is kept
+	require.NoError(t, k8sClient.Get(ctx, key, config))
+	config.Spec.Mode = "pod"
+	require.NoError(t, k8sClient.Update(ctx, config))
+	reconcile(key)
+	require.Equal(t, settings, pods.currentSettings())
+	requireStatus(corev1.ConditionFalse, registrarConfigReasonInvalid, []string{
+		`invalid mode "pod", valid values are serviceAccount, label and annotation`,
+	})
+
+	// The static settings are restored once the resource is deleted
+	require.NoError(t, k8sClient.Delete(ctx, config))
+	reconcile(key)
+	require.Equal(t, static, pods.currentSettings())
+}
+
+func TestValidateRegistrarConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		spec       spiffeidv1beta1.RegistrarConfigSpec
+		expectErrs []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "service account mode",
+			spec: spiffeidv1beta1.RegistrarConfigSpec{Mode: spiffeidv1beta1.RegistrarConfigModeServiceAccount},
+		},
+		{
+			name: "annotation mode",
+			spec: spiffeidv1beta1.RegistrarConfigSpec{Mode: spiffeidv1beta1.RegistrarConfigModeAnnotation, Key: "spiffe.io/id"},
+		},
+		{
+			name:       "key with service account mode",
+			spec:       spiffeidv1beta1.RegistrarConfigSpec{Mode: spiffeidv1beta1.RegistrarConfigModeServiceAccount, Key: "spiffe"},
+			expectErrs: []string{`key must not be set with the "serviceAccount" mode`},
+		},
+		{
+			name:       "missing key",
+			spec:       spiffeidv1beta1.RegistrarConfigSpec{Mode: spiffeidv1beta1.RegistrarConfigModeLabel},
+			expectErrs: []string{`key is required with the "label" mode`},
+		},
+		{
+			name:       "invalid key",
+			spec:       spiffeidv1beta1.RegistrarConfigSpec{Mode: spiffeidv1beta1.RegistrarConfigModeLabel, Key: "spiffe.io/"},
+			expectErrs: []string{`invalid key "spiffe.io/": name part must be non-empty`},
+		},
+		{
+			name:       "invalid template",
+			spec:       spiffeidv1beta1.RegistrarConfigSpec{PodDNSNameTemplate: "{{ end }}"},
+			expectErrs: []string{`invalid podDNSNameTemplate: template: pod-dns-name:1: unexpected {{end}}`},
+		},
+		{
+			name:       "invalid disabled namespace",
+			spec:       spiffeidv1beta1.RegistrarConfigSpec{DisabledNamespaces: []string{"default", "Default"}},
+			expectErrs: []string{`invalid disabled namespace "Default": ` + validation.IsDNS1123Label("Default")[0]},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expectErrs, validateRegistrarConfig(&tt.spec))
+		})
+	}
+}
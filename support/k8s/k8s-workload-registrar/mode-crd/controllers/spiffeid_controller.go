@@ -18,48 +18,80 @@ package controllers
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/entryprovenance"
 	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
 	"github.com/zeebo/errs"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// EntryDiffAnnotation holds the changes last applied to the registration entry
+// of a SpiffeID resource, one per line
+const EntryDiffAnnotation = "spiffeid.spiffe.io/last-entry-diff"
+
 // SpiffeIDReconcilerConfig holds the config passed in when creating the reconciler
 type SpiffeIDReconcilerConfig struct {
-	Client      client.Client
-	Cluster     string
-	Ctx         context.Context
-	Log         logrus.FieldLogger
-	E           entryv1.EntryClient
+	Client  client.Client
+	Cluster string
+	Ctx     context.Context
+	Log     logrus.FieldLogger
+	E       entryv1.EntryClient
+	// IdentityReadinessGate sets the IdentityReadyCondition of the pods
+	// with the readiness gate once their entries are deemed propagated, i.e.
+	// IdentityPropagationDelay after the entries have been created
+	IdentityReadinessGate    bool
+	IdentityPropagationDelay time.Duration
+	// ManagedEntriesOnly prevents adopting existing entries that are not
+	// parented to or identifying a node of the cluster, so entries created
+	// by other means are never updated or deleted
+	ManagedEntriesOnly bool
+	// MaxTTL, if set, caps the TTL of the SVIDs issued for every SpiffeID
+	// resource, whether or not it sets a maxTtl
+	MaxTTL      time.Duration
 	TrustDomain string
 }
 
 // SpiffeIDReconciler holds the runtime configuration and state of this controller
 type SpiffeIDReconciler struct {
 	client.Client
-	c SpiffeIDReconcilerConfig
+	c   SpiffeIDReconcilerConfig
+	now func() time.Time
 }
 
 // NewSpiffeIDReconciler creates a new SpiffeIDReconciler object
 func NewSpiffeIDReconciler(config SpiffeIDReconcilerConfig) *SpiffeIDReconciler {
+	if config.IdentityPropagationDelay == 0 {
+		config.IdentityPropagationDelay = DefaultIdentityPropagationDelay
+	}
 	return &SpiffeIDReconciler{
 		Client: config.Client,
 		c:      config,
+		now:    time.Now,
 	}
 }
 
 // SetupWithManager adds a controller manager to manage this reconciler
 func (r *SpiffeIDReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := indexEntryIDField(mgr); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&spiffeidv1beta1.SpiffeID{}).
 		Complete(r)
@@ -82,29 +114,31 @@ func (r *SpiffeIDReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	myFinalizerName := "finalizers.spiffeid.spiffe.io"
 	if spiffeID.ObjectMeta.DeletionTimestamp.IsZero() {
-		// Add our finalizer if it doesn't already exist
-		if !containsString(spiffeID.GetFinalizers(), myFinalizerName) {
-			spiffeID.SetFinalizers(append(spiffeID.GetFinalizers(), myFinalizerName))
+		// Add the finalizer for the ownership of the resource if it doesn't
+		// already exist
+		if setSpiffeIDFinalizer(&spiffeID) {
 			if err := r.Update(ctx, &spiffeID); err != nil {
 				return ctrl.Result{}, err
 			}
 		}
 	} else {
 		// Delete event
-		if containsString(spiffeID.GetFinalizers(), myFinalizerName) {
+		if hasSpiffeIDFinalizer(&spiffeID) {
 			if err := r.deleteSpiffeID(ctx, &spiffeID); err != nil {
-				r.c.Log.WithFields(logrus.Fields{
+				log := r.c.Log.WithFields(logrus.Fields{
 					"name":      spiffeID.Name,
 					"namespace": spiffeID.Namespace,
-					"entryID":   *spiffeID.Status.EntryId,
-				}).WithError(err).Error("Unable to delete registration entry")
+				})
+				if spiffeID.Status.EntryId != nil {
+					log = log.WithField("entryID", *spiffeID.Status.EntryId)
+				}
+				log.WithError(err).Error("Unable to delete registration entry")
 				return ctrl.Result{}, err
 			}
 
-			// Remove our finalizer from the list and update it.
-			spiffeID.SetFinalizers(removeStringIf(spiffeID.GetFinalizers(), myFinalizerName))
+			// Remove our finalizers from the list and update it.
+			removeSpiffeIDFinalizers(&spiffeID)
 			if err := r.Update(ctx, &spiffeID); err != nil {
 				return ctrl.Result{}, err
 			}
@@ -116,7 +150,26 @@ func (r *SpiffeIDReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, nil
 	}
 
+	if spiffeID.Spec.Disabled {
+		return ctrl.Result{}, r.disableSpiffeID(ctx, req.NamespacedName, &spiffeID)
+	}
+
+	nodeAliasEntryIDs, staleNodeAliasEntryIDs, err := r.syncNodeAliasEntries(ctx, &spiffeID)
+	if err != nil {
+		r.c.Log.WithFields(logrus.Fields{
+			"name":      spiffeID.Name,
+			"namespace": spiffeID.Namespace,
+		}).WithError(err).Error("Unable to create node alias entries")
+		return ctrl.Result{}, err
+	}
+
 	entryID, preexisting, err := r.updateOrCreateSpiffeID(ctx, &spiffeID)
+	var claimed *entryClaimedError
+	if errors.As(err, &claimed) {
+		// The entry is not adopted, like an existing entry not managed by the
+		// registrar, but the node alias entries are still recorded
+		preexisting, err = true, nil
+	}
 	if err != nil {
 		// If the entry doesn't exist on the Spire Server but it should have, fall through
 		// to clear the EntryID on the SPIFFE ID resource and recreate the entry
@@ -129,12 +182,22 @@ func (r *SpiffeIDReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		}
 	}
 
-	if !preexisting || spiffeID.Status.EntryId == nil {
+	// The entry is no longer parented to the stale node alias entries
+	if err := r.deleteNodeAliasEntries(ctx, &spiffeID, staleNodeAliasEntryIDs); err != nil {
+		r.c.Log.WithFields(logrus.Fields{
+			"name":      spiffeID.Name,
+			"namespace": spiffeID.Namespace,
+		}).WithError(err).Error("Unable to delete stale node alias entries")
+		return ctrl.Result{}, err
+	}
+
+	if !preexisting || spiffeID.Status.EntryId == nil || !equalStringSlice(spiffeID.Status.NodeAliasEntryIds, nodeAliasEntryIDs) {
 		retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
 			if err := r.Get(ctx, req.NamespacedName, &spiffeID); err != nil {
 				return err
 			}
 			spiffeID.Status.EntryId = entryID
+			spiffeID.Status.NodeAliasEntryIds = nodeAliasEntryIDs
 			return r.Status().Update(ctx, &spiffeID)
 		})
 		if retryErr != nil {
@@ -146,15 +209,96 @@ func (r *SpiffeIDReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		}
 	}
 
+	if err := r.setConflictCondition(ctx, req.NamespacedName, claimed); err != nil {
+		r.c.Log.WithFields(logrus.Fields{
+			"name":      spiffeID.Name,
+			"namespace": spiffeID.Namespace,
+		}).WithError(err).Error("Unable to update SPIFFE ID conflict condition")
+		return ctrl.Result{}, err
+	}
+	if claimed != nil {
+		// Check again later, the other resource may have gone away
+		return ctrl.Result{RequeueAfter: ownershipConflictRequeueInterval}, nil
+	}
+
+	if !preexisting && entryID != nil {
+		r.observeRegistrationLatency(ctx, &spiffeID)
+	}
+
+	if r.c.IdentityReadinessGate {
+		return r.updatePodReadiness(ctx, &spiffeID)
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// disableSpiffeID deletes the entry of the disabled SpiffeID resource, if any,
+// and clears its entry ID so the entry is created again once it is enabled
+func (r *SpiffeIDReconciler) disableSpiffeID(ctx context.Context, name client.ObjectKey, spiffeID *spiffeidv1beta1.SpiffeID) error {
+	if spiffeID.Status.EntryId == nil && len(spiffeID.Status.NodeAliasEntryIds) == 0 {
+		return nil
+	}
+
+	log := r.c.Log.WithFields(logrus.Fields{
+		"name":      spiffeID.Name,
+		"namespace": spiffeID.Namespace,
+	})
+	if spiffeID.Status.EntryId != nil {
+		log = log.WithField("entryID", *spiffeID.Status.EntryId)
+	}
+	if err := r.deleteSpiffeID(ctx, spiffeID); err != nil {
+		log.WithError(err).Error("Unable to delete registration entry of disabled SPIFFE ID")
+		return err
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := r.Get(ctx, name, spiffeID); err != nil {
+			return err
+		}
+		spiffeID.Status.EntryId = nil
+		spiffeID.Status.NodeAliasEntryIds = nil
+		return r.Status().Update(ctx, spiffeID)
+	})
+	if err != nil {
+		log.WithError(err).Error("Unable to update SPIFFE ID status")
+		return err
+	}
+
+	log.Info("Disabled SPIFFE ID resource")
+	return nil
+}
+
+// observeRegistrationLatency records the time elapsed since the creation of the
+// pod owning the SpiffeID resource, if any, now that its entry has been created
+func (r *SpiffeIDReconciler) observeRegistrationLatency(ctx context.Context, spiffeID *spiffeidv1beta1.SpiffeID) {
+	ownerRef := metav1.GetControllerOf(spiffeID)
+	if ownerRef == nil || ownerRef.Kind != "Pod" {
+		return
+	}
+
+	pod := corev1.Pod{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: spiffeID.Namespace, Name: ownerRef.Name}, &pod); err != nil {
+		// The pod may be gone already, which is not worth failing the reconciliation for
+		r.c.Log.WithFields(logrus.Fields{
+			"name":      spiffeID.Name,
+			"namespace": spiffeID.Namespace,
+		}).WithError(err).Debug("Unable to get pod to observe registration latency")
+		return
+	}
+	if pod.UID != ownerRef.UID {
+		return
+	}
+
+	podRegistrationLatency.Observe(time.Since(pod.CreationTimestamp.Time).Seconds())
+}
+
 // updateOrCreateSpiffeID attempts to create a new entry. if the entry already exists, it updates it.
 func (r *SpiffeIDReconciler) updateOrCreateSpiffeID(ctx context.Context, spiffeID *spiffeidv1beta1.SpiffeID) (*string, bool, error) {
-	entry, err := entryFromCRD(spiffeID)
+	entry, err := entryFromCRD(spiffeID, r.entryParentID(spiffeID))
 	if err != nil {
 		return nil, false, err
 	}
+	entry.Ttl = r.entryTTL(spiffeID)
 
 	var existing *types.Entry
 	var entryID string
@@ -172,24 +316,43 @@ func (r *SpiffeIDReconciler) updateOrCreateSpiffeID(ctx context.Context, spiffeI
 		preexisting = true
 	} else {
 		// Create new entry
-		existing, preexisting, err = r.createEntry(ctx, entry)
+		existing, preexisting, err = r.createEntry(ctx, spiffeID, entry)
 		if err != nil {
 			return nil, false, err
 		}
+		if preexisting && r.c.ManagedEntriesOnly && !isClusterEntry(r.c.TrustDomain, r.c.Cluster, existing) {
+			r.c.Log.WithFields(logrus.Fields{
+				"entryID":  existing.Id,
+				"spiffeID": spiffeID.Spec.SpiffeId,
+			}).Warn("Not adopting existing entry that is not managed by the registrar")
+			return nil, true, nil
+		}
+		if preexisting {
+			if err := r.checkEntryClaim(ctx, spiffeID, existing.Id); err != nil {
+				return nil, false, err
+			}
+		}
 		entryID = existing.Id
 	}
 
 	if preexisting {
-		if !entryEqual(existing, entry) {
+		if diff := entryDiff(existing, entry); len(diff) > 0 {
+			log := r.c.Log.WithFields(logrus.Fields{
+				"entryID":  entryID,
+				"spiffeID": spiffeID.Spec.SpiffeId,
+				"diff":     strings.Join(diff, "; "),
+			})
+
 			entry.Id = entryID
 			if err := r.updateEntry(ctx, entry); err != nil {
 				return nil, false, err
 			}
+			log.Info("Updated entry")
 
-			r.c.Log.WithFields(logrus.Fields{
-				"entryID":  entryID,
-				"spiffeID": spiffeID.Spec.SpiffeId,
-			}).Info("Updated entry")
+			// Record what changed on the resource to help review unexpected entry churn
+			if err := r.recordEntryDiff(ctx, spiffeID, diff); err != nil {
+				log.WithError(err).Warn("Unable to record entry diff")
+			}
 		}
 	} else {
 		r.c.Log.WithFields(logrus.Fields{
@@ -201,7 +364,34 @@ func (r *SpiffeIDReconciler) updateOrCreateSpiffeID(ctx context.Context, spiffeI
 	return &entryID, preexisting, nil
 }
 
-// deleteSpiffeID deletes the specified entry on the SPIRE Server
+// entryTTL returns the TTL of the entry of the SpiffeID resource, which is the
+// lowest of the maxTtl of the resource and the configured MaxTTL, or zero for
+// the default TTL of the server if neither is set
+func (r *SpiffeIDReconciler) entryTTL(spiffeID *spiffeidv1beta1.SpiffeID) int32 {
+	ttl := spiffeID.Spec.MaxTtl
+	maxTTL := int32(r.c.MaxTTL / time.Second)
+	if maxTTL > 0 && (ttl <= 0 || ttl > maxTTL) {
+		ttl = maxTTL
+	}
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// recordEntryDiff records the changes last applied to the entry of the
+// SpiffeID resource in the EntryDiffAnnotation annotation
+func (r *SpiffeIDReconciler) recordEntryDiff(ctx context.Context, spiffeID *spiffeidv1beta1.SpiffeID, diff []string) error {
+	patch := client.MergeFrom(spiffeID.DeepCopy())
+	if spiffeID.Annotations == nil {
+		spiffeID.Annotations = make(map[string]string)
+	}
+	spiffeID.Annotations[EntryDiffAnnotation] = strings.Join(diff, "\n")
+	return r.Patch(ctx, spiffeID, patch)
+}
+
+// deleteSpiffeID deletes the specified entry on the SPIRE Server, along with
+// the node alias entries it is parented to, if any
 func (r *SpiffeIDReconciler) deleteSpiffeID(ctx context.Context, spiffeID *spiffeidv1beta1.SpiffeID) error {
 	if spiffeID.Status.EntryId != nil {
 		err := deleteRegistrationEntry(ctx, r.c.E, *spiffeID.Status.EntryId)
@@ -215,10 +405,21 @@ func (r *SpiffeIDReconciler) deleteSpiffeID(ctx context.Context, spiffeID *spiff
 		}).Info("Deleted entry")
 	}
 
-	return nil
+	return r.deleteNodeAliasEntries(ctx, spiffeID, spiffeID.Status.NodeAliasEntryIds)
 }
 
-func (r *SpiffeIDReconciler) createEntry(ctx context.Context, entry *types.Entry) (*types.Entry, bool, error) {
+// createEntry creates an entry for the SpiffeID resource, stamped with the
+// cluster, and the namespace and pod of the resource
+func (r *SpiffeIDReconciler) createEntry(ctx context.Context, spiffeID *spiffeidv1beta1.SpiffeID, entry *types.Entry) (*types.Entry, bool, error) {
+	provenance := entryprovenance.Provenance{
+		Cluster:   r.c.Cluster,
+		Namespace: spiffeID.Namespace,
+	}
+	if ownerRef := metav1.GetControllerOf(spiffeID); ownerRef != nil && ownerRef.Kind == "Pod" {
+		provenance.Pod = ownerRef.Name
+	}
+	ctx = entryprovenance.AppendToOutgoingContext(ctx, provenance)
+
 	resp, err := r.c.E.BatchCreateEntry(ctx, &entryv1.BatchCreateEntryRequest{
 		Entries: []*types.Entry{entry},
 	})
@@ -271,8 +472,8 @@ func errorFromStatus(s *types.Status) error {
 	return status.Error(codes.Code(s.Code), s.Message)
 }
 
-func entryFromCRD(crd *spiffeidv1beta1.SpiffeID) (*types.Entry, error) {
-	parentID, err := spiffeIDFromString(crd.Spec.ParentId)
+func entryFromCRD(crd *spiffeidv1beta1.SpiffeID, rawParentID string) (*types.Entry, error) {
+	parentID, err := spiffeIDFromString(rawParentID)
 	if err != nil {
 		return nil, errs.New("malformed CRD parent ID: %v", err)
 	}
@@ -302,10 +503,93 @@ func spiffeIDFromString(rawID string) (*types.SPIFFEID, error) {
 
 // entryEqual checks if the current SPIRE Server registration entry and SPIFFE ID resource are equal
 func entryEqual(existing, current *types.Entry) bool {
-	return equalStringSlice(existing.DnsNames, current.DnsNames) &&
-		selectorSetsEqual(existing.Selectors, current.Selectors) &&
-		spiffeIDEqual(existing.SpiffeId, current.SpiffeId) &&
-		spiffeIDEqual(existing.ParentId, current.ParentId)
+	return len(entryDiff(existing, current)) == 0
+}
+
+// entryDiff returns a field-level description of the changes needed to make
+// the current SPIRE Server registration entry match the SPIFFE ID resource
+func entryDiff(existing, current *types.Entry) []string {
+	var diff []string
+	if !spiffeIDEqual(existing.SpiffeId, current.SpiffeId) {
+		diff = append(diff, fmt.Sprintf("spiffeId: %s -> %s", spiffeIDString(existing.SpiffeId), spiffeIDString(current.SpiffeId)))
+	}
+	if !spiffeIDEqual(existing.ParentId, current.ParentId) {
+		diff = append(diff, fmt.Sprintf("parentId: %s -> %s", spiffeIDString(existing.ParentId), spiffeIDString(current.ParentId)))
+	}
+	if !selectorSetsEqual(existing.Selectors, current.Selectors) {
+		diff = append(diff, "selectors: "+selectorSetsDiff(existing.Selectors, current.Selectors))
+	}
+	if !equalStringSlice(existing.DnsNames, current.DnsNames) {
+		diff = append(diff, fmt.Sprintf("dnsNames: %v -> %v", existing.DnsNames, current.DnsNames))
+	}
+	if changes := trustDomainSetsDiff(existing.FederatesWith, current.FederatesWith); changes != "" {
+		diff = append(diff, "federatesWith: "+changes)
+	}
+	if existing.Ttl != current.Ttl {
+		diff = append(diff, fmt.Sprintf("ttl: %d -> %d", existing.Ttl, current.Ttl))
+	}
+	return diff
+}
+
+func spiffeIDString(id *types.SPIFFEID) string {
+	if id == nil {
+		return "<none>"
+	}
+	return makeID(id.TrustDomain, "%s", id.Path)
+}
+
+// selectorSetsDiff describes the selectors added (+) and removed (-) to go from as to bs
+func selectorSetsDiff(as, bs []*types.Selector) string {
+	toSet := func(selectors []*types.Selector) map[string]struct{} {
+		set := make(map[string]struct{}, len(selectors))
+		for _, selector := range selectors {
+			set[selector.Type+":"+selector.Value] = struct{}{}
+		}
+		return set
+	}
+	aSet, bSet := toSet(as), toSet(bs)
+
+	var changes []string
+	for selector := range bSet {
+		if _, ok := aSet[selector]; !ok {
+			changes = append(changes, "+"+selector)
+		}
+	}
+	for selector := range aSet {
+		if _, ok := bSet[selector]; !ok {
+			changes = append(changes, "-"+selector)
+		}
+	}
+	sort.Strings(changes)
+	return strings.Join(changes, " ")
+}
+
+// trustDomainSetsDiff describes the trust domains added to and removed from
+// as in bs, or returns an empty string if they are the same. Trust domains
+// given as SPIFFE IDs are the same as their name, which the server returns.
+func trustDomainSetsDiff(as, bs []string) string {
+	toSet := func(trustDomains []string) map[string]struct{} {
+		set := make(map[string]struct{}, len(trustDomains))
+		for _, trustDomain := range trustDomains {
+			set[normalizeTrustDomain(trustDomain)] = struct{}{}
+		}
+		return set
+	}
+	aSet, bSet := toSet(as), toSet(bs)
+
+	var changes []string
+	for trustDomain := range bSet {
+		if _, ok := aSet[trustDomain]; !ok {
+			changes = append(changes, "+"+trustDomain)
+		}
+	}
+	for trustDomain := range aSet {
+		if _, ok := bSet[trustDomain]; !ok {
+			changes = append(changes, "-"+trustDomain)
+		}
+	}
+	sort.Strings(changes)
+	return strings.Join(changes, " ")
 }
 
 func spiffeIDEqual(existing, current *types.SPIFFEID) bool {
@@ -18,11 +18,16 @@ package controllers
 import (
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	spireTypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/server/datastore"
 	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
 	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -115,6 +120,57 @@ func (s *SpiffeIDControllerTestSuite) TestCreateSpiffeID() {
 	s.Require().Equal(createdSpiffeID.Spec.SpiffeId, stringFromID(entry.SpiffeId))
 	s.Require().Equal(createdSpiffeID.Spec.ParentId, stringFromID(entry.ParentId))
 	s.Require().Equal(createdSpiffeID.Spec.Selector.PodName, "test")
+
+	// Check the changes were recorded on the resource
+	updatedSpiffeID := &spiffeidv1beta1.SpiffeID{}
+	err = s.k8sClient.Get(s.ctx, spiffeIDLookupKey, updatedSpiffeID)
+	s.Require().NoError(err)
+	s.Require().Contains(updatedSpiffeID.Annotations[EntryDiffAnnotation], "spiffeId: ")
+	s.Require().Contains(updatedSpiffeID.Annotations[EntryDiffAnnotation], "parentId: ")
+	s.Require().Contains(updatedSpiffeID.Annotations[EntryDiffAnnotation], "selectors: +k8s:pod-name:test")
+}
+
+func (s *SpiffeIDControllerTestSuite) TestDisableSpiffeID() {
+	spiffeID := &spiffeidv1beta1.SpiffeID{
+		ObjectMeta: metav1.ObjectMeta{Name: "disabled", Namespace: "default"},
+		Spec: spiffeidv1beta1.SpiffeIDSpec{
+			SpiffeId: makeID(s.trustDomain, "disabled"),
+			ParentId: makeID(s.trustDomain, "spire/server"),
+			Selector: spiffeidv1beta1.Selector{Namespace: "default"},
+		},
+	}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, spiffeID))
+	key := types.NamespacedName{Name: "disabled", Namespace: "default"}
+	_, err := s.r.Reconcile(ctrl.Request{NamespacedName: key})
+	s.Require().NoError(err)
+	s.Require().NoError(s.k8sClient.Get(s.ctx, key, spiffeID))
+	s.Require().NotNil(spiffeID.Status.EntryId)
+	entryID := *spiffeID.Status.EntryId
+
+	// Disabling the resource deletes its entry
+	spiffeID.Spec.Disabled = true
+	s.Require().NoError(s.k8sClient.Update(s.ctx, spiffeID))
+	_, err = s.r.Reconcile(ctrl.Request{NamespacedName: key})
+	s.Require().NoError(err)
+	s.Require().NoError(s.k8sClient.Get(s.ctx, key, spiffeID))
+	s.Require().Nil(spiffeID.Status.EntryId)
+	_, err = s.entryClient.GetEntry(s.ctx, &entryv1.GetEntryRequest{Id: entryID})
+	s.Require().Equal(codes.NotFound, status.Code(err))
+
+	// Reconciling a disabled resource again is a no-op
+	_, err = s.r.Reconcile(ctrl.Request{NamespacedName: key})
+	s.Require().NoError(err)
+
+	// Enabling it again creates a new entry
+	spiffeID.Spec.Disabled = false
+	s.Require().NoError(s.k8sClient.Update(s.ctx, spiffeID))
+	_, err = s.r.Reconcile(ctrl.Request{NamespacedName: key})
+	s.Require().NoError(err)
+	s.Require().NoError(s.k8sClient.Get(s.ctx, key, spiffeID))
+	s.Require().NotNil(spiffeID.Status.EntryId)
+	entry, err := s.entryClient.GetEntry(s.ctx, &entryv1.GetEntryRequest{Id: *spiffeID.Status.EntryId})
+	s.Require().NoError(err)
+	s.Require().Equal(spiffeID.Spec.SpiffeId, stringFromID(entry.SpiffeId))
 }
 
 func (s *SpiffeIDControllerTestSuite) TestSpiffeIDEqual() {
@@ -139,6 +195,422 @@ func (s *SpiffeIDControllerTestSuite) TestSpiffeIDEqual() {
 	s.Require().False(spiffeIDEqual(existing, current))
 }
 
+func (s *SpiffeIDControllerTestSuite) TestRegistrationLatency() {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "latency-pod",
+			Namespace:         "latency",
+			UID:               "latency-pod",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Minute)),
+		},
+	}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, pod))
+
+	isController := true
+	spiffeID := &spiffeidv1beta1.SpiffeID{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "latency-pod",
+			Namespace: "latency",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Name:       pod.Name,
+				UID:        pod.UID,
+				Controller: &isController,
+			}},
+		},
+		Spec: spiffeidv1beta1.SpiffeIDSpec{
+			SpiffeId: makeID(s.trustDomain, "latency"),
+			ParentId: makeID(s.trustDomain, "spire/server"),
+			Selector: spiffeidv1beta1.Selector{
+				PodName: pod.Name,
+			},
+		},
+	}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, spiffeID))
+
+	count, sum := s.registrationLatency()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: spiffeID.Name, Namespace: spiffeID.Namespace}}
+	_, err := s.r.Reconcile(req)
+	s.Require().NoError(err)
+
+	newCount, newSum := s.registrationLatency()
+	s.Require().Equal(count+1, newCount)
+	s.Require().GreaterOrEqual(newSum-sum, (2 * time.Minute).Seconds())
+
+	// Reconciling an already registered SpiffeID must not be observed again
+	_, err = s.r.Reconcile(req)
+	s.Require().NoError(err)
+	newCount, _ = s.registrationLatency()
+	s.Require().Equal(count+1, newCount)
+}
+
+func (s *SpiffeIDControllerTestSuite) TestProvenance() {
+	isController := true
+	spiffeID := &spiffeidv1beta1.SpiffeID{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "provenance-pod",
+			Namespace: "provenance",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Name:       "provenance-pod",
+				UID:        "provenance-pod",
+				Controller: &isController,
+			}},
+		},
+		Spec: spiffeidv1beta1.SpiffeIDSpec{
+			SpiffeId: makeID(s.trustDomain, "provenance"),
+			ParentId: makeID(s.trustDomain, "spire/server"),
+			Selector: spiffeidv1beta1.Selector{
+				PodName: "provenance-pod",
+			},
+		},
+	}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, spiffeID))
+
+	_, err := s.r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: spiffeID.Name, Namespace: spiffeID.Namespace}})
+	s.Require().NoError(err)
+
+	// The entry is stamped with the cluster, namespace and pod of the resource
+	resp, err := s.ds.ListRegistrationEntries(s.ctx, &datastore.ListRegistrationEntriesRequest{
+		ByProvenance: &datastore.Provenance{
+			Cluster:   s.cluster,
+			Namespace: "provenance",
+			Pod:       "provenance-pod",
+		},
+	})
+	s.Require().NoError(err)
+	s.Require().Len(resp.Entries, 1)
+	s.Require().Equal("spiffe://example.org/provenance", resp.Entries[0].SpiffeId)
+}
+
+func (s *SpiffeIDControllerTestSuite) TestIdentityReadinessGate() {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ready-pod",
+			Namespace: "ready",
+			UID:       "ready-pod",
+		},
+		Spec: corev1.PodSpec{
+			ReadinessGates: []corev1.PodReadinessGate{{ConditionType: IdentityReadyCondition}},
+		},
+	}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, pod))
+
+	isController := true
+	spiffeID := &spiffeidv1beta1.SpiffeID{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ready-pod",
+			Namespace: "ready",
+			Labels:    map[string]string{"podUid": string(pod.UID)},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Name:       pod.Name,
+				UID:        pod.UID,
+				Controller: &isController,
+			}},
+		},
+		Spec: spiffeidv1beta1.SpiffeIDSpec{
+			SpiffeId: makeID(s.trustDomain, "ready"),
+			ParentId: makeID(s.trustDomain, "spire/server"),
+			Selector: spiffeidv1beta1.Selector{
+				PodName: pod.Name,
+			},
+		},
+	}
+	s.Require().NoError(s.k8sClient.Create(s.ctx, spiffeID))
+
+	r := NewSpiffeIDReconciler(SpiffeIDReconcilerConfig{
+		Client:                s.k8sClient,
+		Cluster:               s.cluster,
+		Ctx:                   s.ctx,
+		Log:                   s.log,
+		E:                     s.entryClient,
+		TrustDomain:           s.trustDomain,
+		IdentityReadinessGate: true,
+	})
+	// Conditions are stored with a precision of a second
+	now := time.Now().Truncate(time.Second)
+	r.now = func() time.Time { return now }
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: spiffeID.Name, Namespace: spiffeID.Namespace}}
+	podCondition := func() *corev1.PodCondition {
+		s.Require().NoError(s.k8sClient.Get(s.ctx, types.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}, pod))
+		return findPodCondition(pod.Status.Conditions, IdentityReadyCondition)
+	}
+
+	// The pod is not ready until the entry is deemed propagated
+	result, err := r.Reconcile(req)
+	s.Require().NoError(err)
+	s.Require().Equal(DefaultIdentityPropagationDelay, result.RequeueAfter)
+	condition := podCondition()
+	s.Require().NotNil(condition)
+	s.Require().Equal(corev1.ConditionFalse, condition.Status)
+	s.Require().Equal(identityReadyReasonPropagating, condition.Reason)
+
+	now = now.Add(DefaultIdentityPropagationDelay / 2)
+	result, err = r.Reconcile(req)
+	s.Require().NoError(err)
+	s.Require().Equal(DefaultIdentityPropagationDelay/2, result.RequeueAfter)
+	s.Require().Equal(corev1.ConditionFalse, podCondition().Status)
+
+	now = now.Add(DefaultIdentityPropagationDelay / 2)
+	result, err = r.Reconcile(req)
+	s.Require().NoError(err)
+	s.Require().Zero(result.RequeueAfter)
+	condition = podCondition()
+	s.Require().Equal(corev1.ConditionTrue, condition.Status)
+	s.Require().Equal(identityReadyReasonPropagated, condition.Reason)
+
+	// Pods without the readiness gate are left alone
+	pod.Spec.ReadinessGates = nil
+	pod.Status.Conditions = nil
+	s.Require().NoError(s.k8sClient.Update(s.ctx, pod))
+	s.Require().NoError(s.k8sClient.Status().Update(s.ctx, pod))
+	result, err = r.Reconcile(req)
+	s.Require().NoError(err)
+	s.Require().Zero(result.RequeueAfter)
+	s.Require().Nil(podCondition())
+}
+
+// registrationLatency returns the number of observations and their sum in the
+// pod registration latency histogram
+func (s *SpiffeIDControllerTestSuite) registrationLatency() (uint64, float64) {
+	registry := prometheus.NewRegistry()
+	s.Require().NoError(registry.Register(podRegistrationLatency))
+	metricFamilies, err := registry.Gather()
+	s.Require().NoError(err)
+	s.Require().Len(metricFamilies, 1)
+	histogram := metricFamilies[0].GetMetric()[0].GetHistogram()
+	return histogram.GetSampleCount(), histogram.GetSampleSum()
+}
+
 func stringFromID(id *spireTypes.SPIFFEID) string {
 	return fmt.Sprintf("spiffe://%s%s", id.TrustDomain, id.Path)
 }
+
+func (s *SpiffeIDControllerTestSuite) TestEntryDiff() {
+	existing := &spireTypes.Entry{
+		SpiffeId:      &spireTypes.SPIFFEID{TrustDomain: s.trustDomain, Path: "/old"},
+		ParentId:      &spireTypes.SPIFFEID{TrustDomain: s.trustDomain, Path: "/node"},
+		Selectors:     []*spireTypes.Selector{{Type: "k8s", Value: "ns:foo"}, {Type: "k8s", Value: "pod-name:old"}},
+		DnsNames:      []string{"old"},
+		FederatesWith: []string{"domain1.test", "domain2.test"},
+	}
+	s.Require().Empty(entryDiff(existing, existing))
+
+	// Trust domains given as SPIFFE IDs are the same as their name
+	s.Require().Empty(entryDiff(existing, &spireTypes.Entry{
+		SpiffeId:      existing.SpiffeId,
+		ParentId:      existing.ParentId,
+		Selectors:     existing.Selectors,
+		DnsNames:      existing.DnsNames,
+		FederatesWith: []string{"spiffe://domain2.test", "domain1.test"},
+	}))
+
+	current := &spireTypes.Entry{
+		SpiffeId:      &spireTypes.SPIFFEID{TrustDomain: s.trustDomain, Path: "/new"},
+		ParentId:      &spireTypes.SPIFFEID{TrustDomain: s.trustDomain, Path: "/node"},
+		Selectors:     []*spireTypes.Selector{{Type: "k8s", Value: "ns:foo"}, {Type: "k8s", Value: "pod-name:new"}},
+		DnsNames:      []string{"new"},
+		FederatesWith: []string{"domain1.test", "domain3.test"},
+		Ttl:           3600,
+	}
+	s.Require().Equal([]string{
+		"spiffeId: spiffe://example.org/old -> spiffe://example.org/new",
+		"selectors: +k8s:pod-name:new -k8s:pod-name:old",
+		"dnsNames: [old] -> [new]",
+		"federatesWith: +domain3.test -domain2.test",
+		"ttl: 0 -> 3600",
+	}, entryDiff(existing, current))
+}
+
+func (s *SpiffeIDControllerTestSuite) TestManagedEntriesOnly() {
+	r := NewSpiffeIDReconciler(SpiffeIDReconcilerConfig{
+		Client:             s.k8sClient,
+		Cluster:            s.cluster,
+		Ctx:                s.ctx,
+		Log:                s.log,
+		E:                  s.entryClient,
+		ManagedEntriesOnly: true,
+		TrustDomain:        s.trustDomain,
+	})
+
+	for _, tt := range []struct {
+		name     string
+		parentID string
+		adopted  bool
+	}{
+		{name: "unmanaged", parentID: makeID(s.trustDomain, "spire/agent/other")},
+		{name: "managed", parentID: makeID(s.trustDomain, "k8s-workload-registrar/%s/node/node-1", s.cluster), adopted: true},
+	} {
+		tt := tt
+		s.Run(tt.name, func() {
+			// The entry exists before the resource is created
+			parentID, err := spiffeIDFromString(tt.parentID)
+			s.Require().NoError(err)
+			entryID := createSweepEntry(s.ctx, s.T(), s.entryClient, parentID.Path, "/"+tt.name)
+
+			spiffeID := &spiffeidv1beta1.SpiffeID{
+				ObjectMeta: metav1.ObjectMeta{Name: tt.name, Namespace: "default"},
+				Spec: spiffeidv1beta1.SpiffeIDSpec{
+					SpiffeId: makeID(s.trustDomain, "%s", tt.name),
+					ParentId: tt.parentID,
+					Selector: spiffeidv1beta1.Selector{Namespace: "default"},
+				},
+			}
+			s.Require().NoError(s.k8sClient.Create(s.ctx, spiffeID))
+			key := types.NamespacedName{Name: tt.name, Namespace: "default"}
+			_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+			s.Require().NoError(err)
+
+			s.Require().NoError(s.k8sClient.Get(s.ctx, key, spiffeID))
+			if tt.adopted {
+				s.Require().NotNil(spiffeID.Status.EntryId)
+				s.Require().Equal(entryID, *spiffeID.Status.EntryId)
+			} else {
+				s.Require().Nil(spiffeID.Status.EntryId)
+			}
+		})
+	}
+}
+
+func (s *SpiffeIDControllerTestSuite) TestEntryTTL() {
+	for _, tt := range []struct {
+		name   string
+		maxTtl int32
+		maxTTL time.Duration
+		ttl    int32
+	}{
+		{name: "server default"},
+		{name: "resource max", maxTtl: 600, ttl: 600},
+		{name: "registrar max", maxTTL: time.Hour, ttl: 3600},
+		{name: "resource max within registrar max", maxTtl: 600, maxTTL: time.Hour, ttl: 600},
+		{name: "resource max capped by registrar max", maxTtl: 7200, maxTTL: time.Hour, ttl: 3600},
+	} {
+		tt := tt
+		s.Run(tt.name, func() {
+			r := NewSpiffeIDReconciler(SpiffeIDReconcilerConfig{MaxTTL: tt.maxTTL})
+			spiffeID := &spiffeidv1beta1.SpiffeID{Spec: spiffeidv1beta1.SpiffeIDSpec{MaxTtl: tt.maxTtl}}
+			s.Require().Equal(tt.ttl, r.entryTTL(spiffeID))
+		})
+	}
+}
+
+func (s *SpiffeIDControllerTestSuite) TestOwnershipFinalizers() {
+	for _, tt := range []struct {
+		name            string
+		ownerKind       string
+		ownership       string
+		expectFinalizer string
+	}{
+		{name: "user", expectFinalizer: userSpiffeIDFinalizer},
+		{name: "pod", ownerKind: "Pod", expectFinalizer: registrarSpiffeIDFinalizer},
+		{name: "explicit-user", ownerKind: "Pod", ownership: spiffeidv1beta1.OwnershipUser, expectFinalizer: userSpiffeIDFinalizer},
+	} {
+		tt := tt
+		s.Run(tt.name, func() {
+			spiffeID := &spiffeidv1beta1.SpiffeID{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "finalizer-" + tt.name,
+					Namespace: "default",
+					// Resources reconciled before finalizers told apart their
+					// ownership have the legacy finalizer
+					Finalizers: []string{"other", legacySpiffeIDFinalizer},
+				},
+				Spec: spiffeidv1beta1.SpiffeIDSpec{
+					SpiffeId:  makeID(s.trustDomain, "finalizer-%s", tt.name),
+					ParentId:  makeID(s.trustDomain, "spire/server"),
+					Selector:  spiffeidv1beta1.Selector{Namespace: "default"},
+					Ownership: tt.ownership,
+				},
+			}
+			if tt.ownerKind != "" {
+				controller := true
+				spiffeID.OwnerReferences = []metav1.OwnerReference{{
+					APIVersion: "v1",
+					Kind:       tt.ownerKind,
+					Name:       "owner",
+					UID:        "owner-uid",
+					Controller: &controller,
+				}}
+			}
+			s.Require().NoError(s.k8sClient.Create(s.ctx, spiffeID))
+			key := types.NamespacedName{Name: spiffeID.Name, Namespace: "default"}
+			_, err := s.r.Reconcile(ctrl.Request{NamespacedName: key})
+			s.Require().NoError(err)
+
+			s.Require().NoError(s.k8sClient.Get(s.ctx, key, spiffeID))
+			s.Require().Equal([]string{"other", tt.expectFinalizer}, spiffeID.Finalizers)
+			s.Require().NoError(s.k8sClient.Delete(s.ctx, spiffeID))
+		})
+	}
+}
+
+func (s *SpiffeIDControllerTestSuite) TestEntryClaimConflict() {
+	newSpiffeID := func(name string, ownerKind string) *spiffeidv1beta1.SpiffeID {
+		spiffeID := &spiffeidv1beta1.SpiffeID{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: spiffeidv1beta1.SpiffeIDSpec{
+				SpiffeId: makeID(s.trustDomain, "claimed"),
+				ParentId: makeID(s.trustDomain, "spire/server"),
+				Selector: spiffeidv1beta1.Selector{Namespace: "default", PodName: "claimed"},
+			},
+		}
+		if ownerKind != "" {
+			controller := true
+			spiffeID.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       ownerKind,
+				Name:       "claimed",
+				UID:        "claimed-uid",
+				Controller: &controller,
+			}}
+		}
+		s.Require().NoError(s.k8sClient.Create(s.ctx, spiffeID))
+		return spiffeID
+	}
+
+	// The registrar creates the entry for a pod
+	registrarKey := types.NamespacedName{Name: "claimed-registrar", Namespace: "default"}
+	registrarSpiffeID := newSpiffeID(registrarKey.Name, "Pod")
+	_, err := s.r.Reconcile(ctrl.Request{NamespacedName: registrarKey})
+	s.Require().NoError(err)
+	s.Require().NoError(s.k8sClient.Get(s.ctx, registrarKey, registrarSpiffeID))
+	s.Require().NotNil(registrarSpiffeID.Status.EntryId)
+	entryID := *registrarSpiffeID.Status.EntryId
+
+	// A user resource with the same entry doesn't adopt it, so deleting
+	// either resource doesn't delete the entry of the other
+	userKey := types.NamespacedName{Name: "claimed-user", Namespace: "default"}
+	userSpiffeID := newSpiffeID(userKey.Name, "")
+	result, err := s.r.Reconcile(ctrl.Request{NamespacedName: userKey})
+	s.Require().NoError(err)
+	s.Require().Equal(ownershipConflictRequeueInterval, result.RequeueAfter)
+	s.Require().NoError(s.k8sClient.Get(s.ctx, userKey, userSpiffeID))
+	s.Require().Nil(userSpiffeID.Status.EntryId)
+	condition := findSpiffeIDCondition(userSpiffeID.Status.Conditions, spiffeidv1beta1.SpiffeIDConditionConflict)
+	s.Require().NotNil(condition)
+	s.Require().Equal(corev1.ConditionTrue, condition.Status)
+	s.Require().Equal(conflictReasonEntryClaimed, condition.Reason)
+	s.Require().Equal(fmt.Sprintf("Not adopting the existing entry: entry %s is already the entry of SpiffeID resource default/claimed-registrar, owned by the registrar", entryID), condition.Message)
+
+	// Once the resource of the registrar is gone with its entry, the user
+	// resource gets its own
+	s.Require().NoError(s.k8sClient.Delete(s.ctx, registrarSpiffeID))
+	_, err = s.entryClient.BatchDeleteEntry(s.ctx, &entryv1.BatchDeleteEntryRequest{Ids: []string{entryID}})
+	s.Require().NoError(err)
+	result, err = s.r.Reconcile(ctrl.Request{NamespacedName: userKey})
+	s.Require().NoError(err)
+	s.Require().Zero(result.RequeueAfter)
+	s.Require().NoError(s.k8sClient.Get(s.ctx, userKey, userSpiffeID))
+	s.Require().NotNil(userSpiffeID.Status.EntryId)
+	condition = findSpiffeIDCondition(userSpiffeID.Status.Conditions, spiffeidv1beta1.SpiffeIDConditionConflict)
+	s.Require().NotNil(condition)
+	s.Require().Equal(corev1.ConditionFalse, condition.Status)
+	s.Require().Equal(conflictReasonNoConflict, condition.Reason)
+
+	s.Require().NoError(s.k8sClient.Delete(s.ctx, userSpiffeID))
+}
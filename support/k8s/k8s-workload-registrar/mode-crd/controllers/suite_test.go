@@ -23,6 +23,7 @@ import (
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/spiffe/spire/test/fakes/fakedatastore"
 	"github.com/spiffe/spire/test/fakes/fakeentryclient"
 	"github.com/stretchr/testify/require"
 
@@ -40,6 +41,7 @@ const (
 type CommonControllerTestSuite struct {
 	cluster     string
 	ctx         context.Context
+	ds          *fakedatastore.DataStore
 	k8sClient   client.Client
 	entryClient *fakeentryclient.Client
 	log         logrus.FieldLogger
@@ -53,12 +55,14 @@ func NewCommonControllerTestSuite(t *testing.T) CommonControllerTestSuite {
 	require.NoError(t, err)
 
 	log, _ := test.NewNullLogger()
+	ds := fakedatastore.New(t)
 	c := CommonControllerTestSuite{
 		cluster:     Cluster,
 		ctx:         context.Background(),
+		ds:          ds,
 		log:         log,
 		k8sClient:   fake.NewFakeClientWithScheme(scheme.Scheme),
-		entryClient: fakeentryclient.New(t, spiffeid.RequireTrustDomainFromString(TrustDomain), nil, nil),
+		entryClient: fakeentryclient.New(t, spiffeid.RequireTrustDomainFromString(TrustDomain), ds, nil),
 		scheme:      scheme.Scheme,
 		trustDomain: TrustDomain,
 	}
@@ -31,14 +31,12 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 func NewManager(leaderElection bool, metricsBindAddr, webhookCertDir string, webhookPort int) (ctrl.Manager, error) {
-	scheme := runtime.NewScheme()
-	_ = clientgoscheme.AddToScheme(scheme)
-	_ = spiffeidv1beta1.AddToScheme(scheme)
-	_ = corev1.AddToScheme(scheme)
+	scheme := newScheme()
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		CertDir:            webhookCertDir,
@@ -55,6 +53,25 @@ func NewManager(leaderElection bool, metricsBindAddr, webhookCertDir string, web
 	return mgr, nil
 }
 
+// NewClient creates a client for the SpiffeID resources and the core
+// resources of the cluster, for one-off operations outside of the manager
+func NewClient() (client.Client, error) {
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.New(config, client.Options{Scheme: newScheme()})
+}
+
+func newScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = spiffeidv1beta1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	return scheme
+}
+
 // setOwnerRef sets the owner object as owner of a new SPIFFE ID resource locally
 func setOwnerRef(owner metav1.Object, spiffeID *spiffeidv1beta1.SpiffeID, scheme *runtime.Scheme) error {
 	err := controllerutil.SetControllerReference(owner, spiffeID, scheme)
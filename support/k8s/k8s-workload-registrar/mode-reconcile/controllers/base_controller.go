@@ -21,12 +21,14 @@ import (
 
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	spiretypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/common/entryprovenance"
 	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/federation"
 	"github.com/zeebo/errs"
 
 	"github.com/go-logr/logr"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -74,6 +76,8 @@ type BaseReconciler struct {
 	RootID      *spiretypes.SPIFFEID
 	SpireClient entryv1.EntryClient
 	Log         logr.Logger
+	// Cluster is the cluster the entries are stamped with
+	Cluster string
 }
 
 type RuntimeObject = runtime.Object
@@ -130,7 +134,7 @@ func (r *BaseReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	var myEntryID string
 
 	if len(matchedEntries) == 0 {
-		createdEntry, preExisting, err := r.createEntry(ctx, myEntry)
+		createdEntry, preExisting, err := r.createEntry(r.withProvenance(ctx, obj), myEntry)
 		if err != nil {
 			reqLogger.Error(err, "Failed to create or update spire entry")
 			return ctrl.Result{}, err
@@ -198,6 +202,20 @@ func (r *BaseReconciler) updateEntry(ctx context.Context, updatedEntry *spiretyp
 	return err
 }
 
+// withProvenance returns a context whose requests stamp the entries created
+// with the cluster, and the namespace and name of the pod they are created
+// for, if any
+func (r *BaseReconciler) withProvenance(ctx context.Context, obj ObjectWithMetadata) context.Context {
+	provenance := entryprovenance.Provenance{
+		Cluster: r.Cluster,
+	}
+	if _, ok := obj.(*corev1.Pod); ok {
+		provenance.Namespace = obj.GetNamespace()
+		provenance.Pod = obj.GetName()
+	}
+	return entryprovenance.AppendToOutgoingContext(ctx, provenance)
+}
+
 func (r *BaseReconciler) createEntry(ctx context.Context, entryToCreate *spiretypes.Entry) (*spiretypes.Entry, bool, error) {
 	createEntryResponse, err := r.SpireClient.BatchCreateEntry(ctx, &entryv1.BatchCreateEntryRequest{Entries: []*spiretypes.Entry{entryToCreate}})
 	if err != nil {
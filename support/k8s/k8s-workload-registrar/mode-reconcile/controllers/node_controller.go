@@ -139,6 +139,7 @@ func NewNodeReconciler(client client.Client, log logr.Logger, scheme *runtime.Sc
 		RootID:      rootID,
 		SpireClient: spireClient,
 		Log:         log,
+		Cluster:     cluster,
 		ObjectReconciler: &NodeReconciler{
 			RootID:      rootID,
 			SpireClient: spireClient,
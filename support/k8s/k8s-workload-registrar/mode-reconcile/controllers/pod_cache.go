@@ -0,0 +1,179 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultPodResync matches the default resync period of the controller-runtime cache
+const defaultPodResync = 10 * time.Hour
+
+// NewPodCacheFunc returns a function creating a manager cache which only holds
+// the pods matching the given label and field selectors, so the API server
+// only sends those pods to the registrar. Other objects are cached as usual.
+// Pods not matching the selectors are handled as if they did not exist, and
+// their registration entries are removed.
+func NewPodCacheFunc(labelSelector, fieldSelector string) (cache.NewCacheFunc, error) {
+	if _, err := labels.Parse(labelSelector); err != nil {
+		return nil, fmt.Errorf("invalid pod label selector %q: %w", labelSelector, err)
+	}
+	if _, err := fields.ParseSelector(fieldSelector); err != nil {
+		return nil, fmt.Errorf("invalid pod field selector %q: %w", fieldSelector, err)
+	}
+
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		objectCache, err := cache.New(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+
+		resync := defaultPodResync
+		if opts.Resync != nil {
+			resync = *opts.Resync
+		}
+		pods := coreinformers.NewFilteredPodInformer(clientset, opts.Namespace, resync,
+			toolscache.Indexers{toolscache.NamespaceIndex: toolscache.MetaNamespaceIndexFunc},
+			func(options *metav1.ListOptions) {
+				options.LabelSelector = labelSelector
+				options.FieldSelector = fieldSelector
+			})
+
+		return &podCache{
+			Cache: objectCache,
+			pods:  pods,
+		}, nil
+	}, nil
+}
+
+// podCache serves pods from a dedicated filtered informer, and every other
+// object from the embedded cache
+type podCache struct {
+	cache.Cache
+	pods toolscache.SharedIndexInformer
+}
+
+// Get implements client.Reader
+func (c *podCache) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return c.Cache.Get(ctx, key, obj)
+	}
+
+	item, exists, err := c.pods.GetIndexer().GetByKey(key.String())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return apierrors.NewNotFound(corev1.Resource("pods"), key.Name)
+	}
+	item.(*corev1.Pod).DeepCopyInto(pod)
+	return nil
+}
+
+// List implements client.Reader. Pods can only be filtered by namespace and labels.
+func (c *podCache) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	podList, ok := list.(*corev1.PodList)
+	if !ok {
+		return c.Cache.List(ctx, list, opts...)
+	}
+
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if listOpts.FieldSelector != nil && !listOpts.FieldSelector.Empty() {
+		return errors.New("field selectors are not supported when listing pods")
+	}
+
+	var items []interface{}
+	if listOpts.Namespace != "" {
+		var err error
+		items, err = c.pods.GetIndexer().ByIndex(toolscache.NamespaceIndex, listOpts.Namespace)
+		if err != nil {
+			return err
+		}
+	} else {
+		items = c.pods.GetIndexer().List()
+	}
+
+	podList.Items = make([]corev1.Pod, 0, len(items))
+	for _, item := range items {
+		pod := item.(*corev1.Pod)
+		if listOpts.LabelSelector != nil && !listOpts.LabelSelector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		podList.Items = append(podList.Items, *pod.DeepCopy())
+	}
+	return nil
+}
+
+// GetInformer implements cache.Informers
+func (c *podCache) GetInformer(ctx context.Context, obj runtime.Object) (cache.Informer, error) {
+	if _, ok := obj.(*corev1.Pod); ok {
+		return c.pods, nil
+	}
+	return c.Cache.GetInformer(ctx, obj)
+}
+
+// GetInformerForKind implements cache.Informers
+func (c *podCache) GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind) (cache.Informer, error) {
+	if gvk == corev1.SchemeGroupVersion.WithKind("Pod") {
+		return c.pods, nil
+	}
+	return c.Cache.GetInformerForKind(ctx, gvk)
+}
+
+// Start implements cache.Informers
+func (c *podCache) Start(stopCh <-chan struct{}) error {
+	go c.pods.Run(stopCh)
+	return c.Cache.Start(stopCh)
+}
+
+// WaitForCacheSync implements cache.Informers
+func (c *podCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	if !toolscache.WaitForCacheSync(stop, c.pods.HasSynced) {
+		return false
+	}
+	return c.Cache.WaitForCacheSync(stop)
+}
+
+// IndexField implements client.FieldIndexer
+func (c *podCache) IndexField(ctx context.Context, obj runtime.Object, field string, extractValue client.IndexerFunc) error {
+	if _, ok := obj.(*corev1.Pod); ok {
+		return errors.New("indexing pods is not supported")
+	}
+	return c.Cache.IndexField(ctx, obj, field, extractValue)
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestNewPodCacheFunc(t *testing.T) {
+	_, err := NewPodCacheFunc("app=foo", "spec.nodeName=node")
+	require.NoError(t, err)
+
+	_, err = NewPodCacheFunc("app in (", "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid pod label selector")
+
+	_, err = NewPodCacheFunc("", "spec.nodeName")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid pod field selector")
+}
+
+func TestPodCache(t *testing.T) {
+	ctx := context.Background()
+	pods := toolscache.NewSharedIndexInformer(&toolscache.ListWatch{}, &corev1.Pod{}, 0,
+		toolscache.Indexers{toolscache.NamespaceIndex: toolscache.MetaNamespaceIndexFunc})
+	for _, pod := range []*corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "ns1", Labels: map[string]string{"app": "foo"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "ns1", Labels: map[string]string{"app": "bar"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "ns2", Labels: map[string]string{"app": "foo"}}},
+	} {
+		require.NoError(t, pods.GetIndexer().Add(pod))
+	}
+	c := &podCache{pods: pods}
+
+	pod := corev1.Pod{}
+	require.NoError(t, c.Get(ctx, types.NamespacedName{Namespace: "ns1", Name: "foo"}, &pod))
+	require.Equal(t, "foo", pod.Labels["app"])
+
+	err := c.Get(ctx, types.NamespacedName{Namespace: "ns1", Name: "baz"}, &pod)
+	require.True(t, apierrors.IsNotFound(err))
+
+	podList := corev1.PodList{}
+	require.NoError(t, c.List(ctx, &podList, client.InNamespace("ns1")))
+	require.Len(t, podList.Items, 2)
+
+	require.NoError(t, c.List(ctx, &podList, client.MatchingLabels{"app": "foo"}))
+	require.Len(t, podList.Items, 2)
+
+	require.NoError(t, c.List(ctx, &podList, client.InNamespace("ns1"), client.MatchingLabels{"app": "foo"}))
+	require.Len(t, podList.Items, 1)
+
+	err = c.List(ctx, &podList, client.MatchingFields{"spec.nodeName": "node"})
+	require.EqualError(t, err, "field selectors are not supported when listing pods")
+
+	informer, err := c.GetInformer(ctx, &corev1.Pod{})
+	require.NoError(t, err)
+	require.Equal(t, pods, informer)
+
+	informer, err = c.GetInformerForKind(ctx, corev1.SchemeGroupVersion.WithKind("Pod"))
+	require.NoError(t, err)
+	require.Equal(t, pods, informer)
+}
@@ -24,6 +24,7 @@ import (
 	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
 	spiretypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
 	"github.com/spiffe/spire/pkg/common/idutil"
+	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/identity"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
@@ -226,26 +227,24 @@ func (r *PodReconciler) fillEntryForObject(ctx context.Context, entry *spiretype
 }
 
 func (r *PodReconciler) makeSpiffeIDForPod(pod *corev1.Pod) *spiretypes.SPIFFEID {
-	var spiffeID *spiretypes.SPIFFEID
+	config := identity.Config{TrustDomain: r.TrustDomain}
 	switch r.Mode {
 	case PodReconcilerModeServiceAccount:
-		spiffeID = r.makeID("ns", pod.Namespace, "sa", pod.Spec.ServiceAccountName)
+		// the SPIFFE ID is based on the service account
 	case PodReconcilerModeLabel:
-		if val, ok := pod.GetLabels()[r.Value]; ok {
-			spiffeID = r.makeID(val)
-		}
+		config.PodLabel = r.Value
 	case PodReconcilerModeAnnotation:
-		if val, ok := pod.GetAnnotations()[r.Value]; ok {
-			spiffeID = r.makeID(val)
-		}
+		config.PodAnnotation = r.Value
+	default:
+		return nil
+	}
+	path, ok := config.PodPath(pod)
+	if !ok {
+		return nil
 	}
-	return spiffeID
-}
-
-func (r *PodReconciler) makeID(segments ...string) *spiretypes.SPIFFEID {
 	return &spiretypes.SPIFFEID{
 		TrustDomain: r.TrustDomain,
-		Path:        idutil.JoinPathSegments(segments...),
+		Path:        path,
 	}
 }
 
@@ -352,7 +351,7 @@ func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager, builder *ctrlBuilder.
 	return nil
 }
 
-func NewPodReconciler(client client.Client, log logr.Logger, scheme *runtime.Scheme, trustDomain string, rootID *spiretypes.SPIFFEID, spireClient entryv1.EntryClient, mode PodReconcilerMode, value string, clusterDNSZone string, addPodDNSNames bool, disabledNamespaces []string) *BaseReconciler {
+func NewPodReconciler(client client.Client, log logr.Logger, scheme *runtime.Scheme, trustDomain string, cluster string, rootID *spiretypes.SPIFFEID, spireClient entryv1.EntryClient, mode PodReconcilerMode, value string, clusterDNSZone string, addPodDNSNames bool, disabledNamespaces []string) *BaseReconciler {
 	disabledNamespacesMap := make(map[string]bool, len(disabledNamespaces))
 	for _, ns := range disabledNamespaces {
 		disabledNamespacesMap[ns] = true
@@ -364,6 +363,7 @@ func NewPodReconciler(client client.Client, log logr.Logger, scheme *runtime.Sch
 		RootID:      rootID,
 		SpireClient: spireClient,
 		Log:         log,
+		Cluster:     cluster,
 		ObjectReconciler: &PodReconciler{
 			Client:             client,
 			RootID:             rootID,
@@ -11,6 +11,7 @@ import (
 
 	"github.com/go-logr/logr"
 	spiretypes "github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/spiffe/spire/pkg/server/datastore"
 	"github.com/spiffe/spire/proto/spire/common"
 	"github.com/spiffe/spire/test/fakes/fakedatastore"
 	"github.com/spiffe/spire/test/fakes/fakeentryclient"
@@ -26,7 +27,10 @@ import (
 	"github.com/spiffe/spire/test/spiretest"
 )
 
-const podControllerTestTrustDomain = "example.test"
+const (
+	podControllerTestTrustDomain = "example.test"
+	podControllerTestCluster     = "test-cluster"
+)
 
 func TestPodController(t *testing.T) {
 	spiretest.Run(t, new(PodControllerTestSuite))
@@ -90,6 +94,7 @@ func (s *PodControllerTestSuite) TestAddChangeRemovePod() {
 				s.log,
 				scheme.Scheme,
 				podControllerTestTrustDomain,
+				podControllerTestCluster,
 				&spiretypes.SPIFFEID{
 					TrustDomain: nodeControllerTestTrustDomain,
 					Path:        "/foo/node",
@@ -139,6 +144,17 @@ func (s *PodControllerTestSuite) TestAddChangeRemovePod() {
 			s.Assert().NoError(err)
 			s.Assert().Len(es, 1)
 
+			// The entry is stamped with the pod it was created for
+			resp, err := s.ds.ListRegistrationEntries(ctx, &datastore.ListRegistrationEntriesRequest{
+				ByProvenance: &datastore.Provenance{
+					Cluster:   podControllerTestCluster,
+					Namespace: "bar",
+					Pod:       "foo",
+				},
+			})
+			s.Assert().NoError(err)
+			s.Assert().Len(resp.Entries, 1)
+
 			pod.Labels["spiffe"] = "label2"
 			pod.Annotations["spiffe"] = "annotation2"
 			pod.Spec.ServiceAccountName = "sa2"
@@ -194,6 +210,7 @@ func (s *PodControllerTestSuite) TestAddDnsNames() {
 		s.log,
 		scheme.Scheme,
 		podControllerTestTrustDomain,
+		podControllerTestCluster,
 		&spiretypes.SPIFFEID{
 			TrustDomain: nodeControllerTestTrustDomain,
 			Path:        "/foo/node",
@@ -306,6 +323,7 @@ func (s *PodControllerTestSuite) TestDottedPodNamesDns() {
 		s.log,
 		scheme.Scheme,
 		podControllerTestTrustDomain,
+		podControllerTestCluster,
 		&spiretypes.SPIFFEID{
 			TrustDomain: nodeControllerTestTrustDomain,
 			Path:        "/foo/node",
@@ -396,6 +414,7 @@ func (s *PodControllerTestSuite) TestDottedServiceNamesDns() {
 		s.log,
 		scheme.Scheme,
 		podControllerTestTrustDomain,
+		podControllerTestCluster,
 		&spiretypes.SPIFFEID{
 			TrustDomain: nodeControllerTestTrustDomain,
 			Path:        "/foo/node",
@@ -478,6 +497,7 @@ func (s *PodControllerTestSuite) TestSkipsDisabledNamespace() {
 		s.log,
 		scheme.Scheme,
 		podControllerTestTrustDomain,
+		podControllerTestCluster,
 		&spiretypes.SPIFFEID{
 			TrustDomain: nodeControllerTestTrustDomain,
 			Path:        "/foo/node",
@@ -519,3 +539,21 @@ func (s *PodControllerTestSuite) TestSkipsDisabledNamespace() {
 	s.Assert().NoError(err)
 	s.Assert().Len(es, 0)
 }
+
+func (s *PodControllerTestSuite) TestUnknownModeIgnoresPods() {
+	r := &PodReconciler{
+		TrustDomain: podControllerTestTrustDomain,
+		Mode:        PodReconcilerMode(42),
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "bar",
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "sa1",
+		},
+	}
+	s.Assert().Nil(r.makeSpiffeIDForPod(pod))
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	agentv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/agent/v1"
+	entryv1 "github.com/spiffe/spire-api-sdk/proto/spire/api/server/entry/v1"
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	k8sattestor "github.com/spiffe/spire/pkg/agent/plugin/workloadattestor/k8s"
+	"github.com/spiffe/spire/pkg/common/idutil"
+	spiffeidv1beta1 "github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/api/spiffeid/v1beta1"
+	"github.com/spiffe/spire/support/k8s/k8s-workload-registrar/mode-crd/controllers"
+	"github.com/zeebo/errs"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	corev1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	simulateCommandName = "simulate"
+
+	workloadSelectorType = "k8s"
+	psatSelectorType     = "k8s_psat"
+)
+
+// simulateCommand shows, for the containers of a pod, the selectors the k8s
+// workload attestor of the SPIRE agent is expected to produce, and whether the
+// registration entries of the pod match them and are delivered to the agent of
+// the node of the pod. It helps tracking down why a workload is issued no
+// identity, e.g. entries parented to node aliases with k8s_psat selectors while
+// the agents are attested with k8s_sat.
+type simulateCommand struct {
+	configPath string
+	namespace  string
+	pod        string
+	container  string
+	agentID    string
+	spiffeID   string
+}
+
+func runSimulate(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	cmd, err := parseSimulateCommand(args, stderr)
+	if err != nil {
+		return err
+	}
+
+	hclBytes, err := os.ReadFile(cmd.configPath)
+	if err != nil {
+		return errs.New("unable to load configuration: %v", err)
+	}
+
+	c := &CommonMode{}
+	if err := c.ParseConfig(string(hclBytes)); err != nil {
+		return errs.New("error parsing common config: %v", err)
+	}
+	defer c.Close()
+
+	log, err := c.SetupLogger()
+	if err != nil {
+		return errs.New("error setting up logging: %v", err)
+	}
+	defer log.Close()
+
+	entryClient, err := c.EntryClient(ctx, log)
+	if err != nil {
+		return errs.New("failed to dial server: %v", err)
+	}
+	agentClient, err := c.AgentClient(ctx, log)
+	if err != nil {
+		return errs.New("failed to dial server: %v", err)
+	}
+
+	k8sClient, err := controllers.NewClient()
+	if err != nil {
+		return errs.New("unable to create kubernetes client: %v", err)
+	}
+
+	pod := &corev1.Pod{}
+	if err := k8sClient.Get(ctx, k8stypes.NamespacedName{Namespace: cmd.namespace, Name: cmd.pod}, pod); err != nil {
+		return errs.New("unable to get pod: %v", err)
+	}
+
+	agents, err := cmd.fetchAgents(ctx, agentClient, c.Cluster, pod.Spec.NodeName)
+	if err != nil {
+		return err
+	}
+
+	// The entries of the pod that may not match it are looked up from the
+	// SpiffeID resources of the pod in "crd" mode, and from the SPIFFE ID
+	// given on the command line
+	var podEntryIDs []string
+	if c.Mode == modeCRD {
+		if podEntryIDs, err = podSpiffeIDEntryIDs(ctx, k8sClient, pod); err != nil {
+			return err
+		}
+	}
+	podEntries, err := fetchEntriesByID(ctx, entryClient, podEntryIDs)
+	if err != nil {
+		return err
+	}
+	if cmd.spiffeID != "" {
+		id, err := idutil.IDProtoFromString(cmd.spiffeID)
+		if err != nil {
+			return errs.New("error parsing SPIFFE ID %q: %v", cmd.spiffeID, err)
+		}
+		entries, err := listEntries(ctx, entryClient, &entryv1.ListEntriesRequest_Filter{BySpiffeId: id})
+		if err != nil {
+			return err
+		}
+		podEntries = append(podEntries, entries...)
+	}
+
+	serverID := &types.SPIFFEID{TrustDomain: c.TrustDomain, Path: "/spire/server"}
+	nodeAliases := make(map[string][]*types.Entry)
+	sim := &simulation{pod: pod, agents: agents}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		status := status
+		if cmd.container != "" && status.Name != cmd.container {
+			continue
+		}
+
+		container := &containerSimulation{status: &status}
+		sim.containers = append(sim.containers, container)
+		// The agent can't attest containers before they are started
+		if status.ContainerID == "" {
+			continue
+		}
+		container.selectors = containerSelectors(pod, &status)
+
+		matching, err := listEntries(ctx, entryClient, &entryv1.ListEntriesRequest_Filter{
+			BySelectors: &types.SelectorMatch{
+				Selectors: container.selectors,
+				Match:     types.SelectorMatch_MATCH_SUBSET,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range dedupeEntries(podEntries, matching) {
+			if forOtherContainer(entry, status.Name) {
+				continue
+			}
+			parentID := idString(entry.ParentId)
+			if _, ok := nodeAliases[parentID]; !ok {
+				nodeAliases[parentID], err = listEntries(ctx, entryClient, &entryv1.ListEntriesRequest_Filter{
+					BySpiffeId: entry.ParentId,
+					ByParentId: serverID,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			container.entries = append(container.entries, matchEntry(entry, container.selectors, agents, nodeAliases[parentID]))
+		}
+	}
+	if cmd.container != "" && len(sim.containers) == 0 {
+		return errs.New("pod has no container %q with a status", cmd.container)
+	}
+
+	return sim.write(stdout)
+}
+
+func parseSimulateCommand(args []string, stderr io.Writer) (*simulateCommand, error) {
+	cmd := &simulateCommand{}
+
+	fs := flag.NewFlagSet(simulateCommandName, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&cmd.configPath, "config", "k8s-workload-registrar.conf", "configuration file")
+	fs.StringVar(&cmd.namespace, "namespace", "default", "Namespace of the pod")
+	fs.StringVar(&cmd.pod, "pod", "", "Name of the pod")
+	fs.StringVar(&cmd.container, "container", "", "Only simulate this container of the pod (default all containers)")
+	fs.StringVar(&cmd.agentID, "agentID", "", "SPIFFE ID of the agent of the node of the pod (default the k8s_psat agents of the node)")
+	fs.StringVar(&cmd.spiffeID, "spiffeID", "", "Also check the entries with this SPIFFE ID, e.g. the one the pod is expected to get")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if cmd.pod == "" {
+		return nil, errs.New("-pod is required")
+	}
+
+	return cmd, nil
+}
+
+// fetchAgents returns the agent given on the command line or, by default, the
+// agents attested with k8s_psat on the node of the pod
+func (c *simulateCommand) fetchAgents(ctx context.Context, client agentv1.AgentClient, cluster, nodeName string) ([]*types.Agent, error) {
+	if c.agentID != "" {
+		id, err := idutil.IDProtoFromString(c.agentID)
+		if err != nil {
+			return nil, errs.New("error parsing agent ID %q: %v", c.agentID, err)
+		}
+		agent, err := client.GetAgent(ctx, &agentv1.GetAgentRequest{Id: id})
+		if err != nil {
+			return nil, errs.New("error fetching agent: %v", err)
+		}
+		return []*types.Agent{agent}, nil
+	}
+
+	// Only agents attested with k8s_psat can be told apart by node
+	if cluster == "" || nodeName == "" {
+		return nil, nil
+	}
+
+	// The node is looked up on the client side, since the server only lists
+	// the agents whose selectors are all given
+	nodeSelectors := []*types.Selector{
+		{Type: psatSelectorType, Value: "cluster:" + cluster},
+		{Type: psatSelectorType, Value: "agent_node_name:" + nodeName},
+	}
+	var agents []*types.Agent
+	req := &agentv1.ListAgentsRequest{
+		Filter: &agentv1.ListAgentsRequest_Filter{
+			ByAttestationType: psatSelectorType,
+			ByBanned:          wrapperspb.Bool(false),
+		},
+	}
+	for {
+		resp, err := client.ListAgents(ctx, req)
+		if err != nil {
+			return nil, errs.New("error fetching agents: %v", err)
+		}
+		for _, agent := range resp.Agents {
+			if hasSelectors(selectorSet(agent.Selectors), nodeSelectors) {
+				agents = append(agents, agent)
+			}
+		}
+		if resp.NextPageToken == "" {
+			return agents, nil
+		}
+		req.PageToken = resp.NextPageToken
+	}
+}
+
+// podSpiffeIDEntryIDs returns the IDs of the entries of the SpiffeID
+// resources owned by the pod
+func podSpiffeIDEntryIDs(ctx context.Context, c client.Client, pod *corev1.Pod) ([]string, error) {
+	spiffeIDs := &spiffeidv1beta1.SpiffeIDList{}
+	if err := c.List(ctx, spiffeIDs, client.InNamespace(pod.Namespace)); err != nil {
+		return nil, errs.New("unable to list SpiffeID resources: %v", err)
+	}
+
+	var entryIDs []string
+	for _, spiffeID := range spiffeIDs.Items {
+		for _, owner := range spiffeID.OwnerReferences {
+			if owner.UID == pod.UID && spiffeID.Status.EntryId != nil {
+				entryIDs = append(entryIDs, *spiffeID.Status.EntryId)
+			}
+		}
+	}
+	return entryIDs, nil
+}
+
+func fetchEntriesByID(ctx context.Context, client entryv1.EntryClient, ids []string) ([]*types.Entry, error) {
+	entries := make([]*types.Entry, 0, len(ids))
+	for _, id := range ids {
+		entry, err := client.GetEntry(ctx, &entryv1.GetEntryRequest{Id: id})
+		if err != nil {
+			return nil, errs.New("error fetching entry %q: %v", id, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func listEntries(ctx context.Context, client entryv1.EntryClient, filter *entryv1.ListEntriesRequest_Filter) ([]*types.Entry, error) {
+	var entries []*types.Entry
+	req := &entryv1.ListEntriesRequest{Filter: filter}
+	for {
+		resp, err := client.ListEntries(ctx, req)
+		if err != nil {
+			return nil, errs.New("error fetching entries: %v", err)
+		}
+		entries = append(entries, resp.Entries...)
+		if resp.NextPageToken == "" {
+			return entries, nil
+		}
+		req.PageToken = resp.NextPageToken
+	}
+}
+
+// containerSelectors returns the selectors the k8s workload attestor of the
+// agent produces for the container, sorted
+func containerSelectors(pod *corev1.Pod, status *corev1.ContainerStatus) []*types.Selector {
+	values := k8sattestor.SelectorValuesFromPod(pod, status)
+	sort.Strings(values)
+
+	selectors := make([]*types.Selector, 0, len(values))
+	for _, value := range values {
+		selectors = append(selectors, &types.Selector{Type: workloadSelectorType, Value: value})
+	}
+	return selectors
+}
+
+func dedupeEntries(lists ...[]*types.Entry) []*types.Entry {
+	seen := make(map[string]bool)
+	var deduped []*types.Entry
+	for _, entries := range lists {
+		for _, entry := range entries {
+			if !seen[entry.Id] {
+				seen[entry.Id] = true
+				deduped = append(deduped, entry)
+			}
+		}
+	}
+	return deduped
+}
+
+// forOtherContainer returns whether the entry is explicitly for another
+// container than the given one, like the per-container entries of "crd" mode
+func forOtherContainer(entry *types.Entry, containerName string) bool {
+	for _, selector := range entry.Selectors {
+		if selector.Type == workloadSelectorType && strings.HasPrefix(selector.Value, "container-name:") &&
+			selector.Value != "container-name:"+containerName {
+			return true
+		}
+	}
+	return false
+}
+
+// entryMatch is how a registration entry matches a container
+type entryMatch struct {
+	entry *types.Entry
+	// missing are the k8s selectors of the entry that are not produced for
+	// the container
+	missing []string
+	// other are the selectors of the entry of other types than k8s, which
+	// other workload attestors of the agent may produce
+	other []string
+	// agentID is the agent the entry is delivered to, if any
+	agentID string
+	// nodeAliasID is the node alias entry through which the entry is
+	// delivered to the agent, if any
+	nodeAliasID string
+}
+
+// matchEntry matches the entry against the selectors of the container and the
+// agents. Like the server, it delivers the entry to an agent if it is parented
+// to the agent, or to a node alias entry whose selectors the agent has.
+func matchEntry(entry *types.Entry, selectors []*types.Selector, agents []*types.Agent, nodeAliases []*types.Entry) *entryMatch {
+	match := &entryMatch{entry: entry}
+
+	produced := selectorSet(selectors)
+	for _, selector := range entry.Selectors {
+		s := selectorString(selector)
+		switch {
+		case selector.Type != workloadSelectorType:
+			match.other = append(match.other, s)
+		case !produced[s]:
+			match.missing = append(match.missing, s)
+		}
+	}
+
+	parentID := idString(entry.ParentId)
+	for _, agent := range agents {
+		agentID := idString(agent.Id)
+		if parentID == agentID {
+			match.agentID = agentID
+			return match
+		}
+
+		agentSelectors := selectorSet(agent.Selectors)
+		for _, alias := range nodeAliases {
+			if hasSelectors(agentSelectors, alias.Selectors) {
+				match.agentID = agentID
+				match.nodeAliasID = alias.Id
+				return match
+			}
+		}
+	}
+	return match
+}
+
+func selectorSet(selectors []*types.Selector) map[string]bool {
+	set := make(map[string]bool, len(selectors))
+	for _, selector := range selectors {
+		set[selectorString(selector)] = true
+	}
+	return set
+}
+
+func hasSelectors(set map[string]bool, selectors []*types.Selector) bool {
+	for _, selector := range selectors {
+		if !set[selectorString(selector)] {
+			return false
+		}
+	}
+	return true
+}
+
+func selectorString(selector *types.Selector) string {
+	return selector.Type + ":" + selector.Value
+}
+
+func idString(id *types.SPIFFEID) string {
+	return "spiffe://" + id.TrustDomain + id.Path
+}
+
+// simulation is the outcome of the simulation of the attestation of a pod
+type simulation struct {
+	pod        *corev1.Pod
+	agents     []*types.Agent
+	containers []*containerSimulation
+}
+
+type containerSimulation struct {
+	status    *corev1.ContainerStatus
+	selectors []*types.Selector
+	entries   []*entryMatch
+}
+
+func (s *simulation) write(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Pod %s/%s on node %q\n", s.pod.Namespace, s.pod.Name, s.pod.Spec.NodeName)
+	if len(s.agents) == 0 {
+		b.WriteString("No k8s_psat agent found for the node; agents attested with k8s_sat have no selectors identifying their node, " +
+			"so they are not delivered entries parented to node aliases with k8s_psat selectors. Use -agentID to simulate a given agent.\n")
+	}
+	for _, agent := range s.agents {
+		fmt.Fprintf(&b, "Agent %s\n", idString(agent.Id))
+	}
+
+	for _, container := range s.containers {
+		fmt.Fprintf(&b, "\nContainer %q:\n", container.status.Name)
+		if container.status.ContainerID == "" {
+			b.WriteString("  Not started; the agent can't attest it yet\n")
+			continue
+		}
+
+		b.WriteString("  Selectors produced by the k8s workload attestor:\n")
+		for _, selector := range container.selectors {
+			fmt.Fprintf(&b, "    %s\n", selectorString(selector))
+		}
+
+		if len(container.entries) == 0 {
+			b.WriteString("  No entries found for the container\n")
+		}
+		for _, match := range container.entries {
+			match.write(&b, len(s.agents) > 0)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (m *entryMatch) write(b *strings.Builder, agentsKnown bool) {
+	delivered := m.agentID != "" || !agentsKnown
+	verdict := "matches"
+	switch {
+	case len(m.missing) > 0 || !delivered:
+		verdict = "does not match"
+	case len(m.other) > 0:
+		verdict = "matches if the other workload attestors of the agent produce its selectors of other types"
+	}
+	fmt.Fprintf(b, "  Entry %s (%s) %s\n", m.entry.Id, idString(m.entry.SpiffeId), verdict)
+
+	for _, selector := range m.missing {
+		fmt.Fprintf(b, "    Selector %s is not produced for the container\n", selector)
+	}
+	for _, selector := range m.other {
+		fmt.Fprintf(b, "    Selector %s is not simulated\n", selector)
+	}
+
+	parentID := idString(m.entry.ParentId)
+	switch {
+	case !agentsKnown:
+		fmt.Fprintf(b, "    Parent %s not checked against the agent\n", parentID)
+	case m.nodeAliasID != "":
+		fmt.Fprintf(b, "    Parent %s is a node alias of agent %s (entry %s)\n", parentID, m.agentID, m.nodeAliasID)
+	case m.agentID != "":
+		fmt.Fprintf(b, "    Parent %s is the agent\n", parentID)
+	default:
+		fmt.Fprintf(b, "    Parent %s is neither the agent nor a node alias whose selectors the agent has\n", parentID)
+	}
+}
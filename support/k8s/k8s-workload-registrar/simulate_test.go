@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/spiffe/spire-api-sdk/proto/spire/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	simulatedAgent = &types.Agent{
+		Id: mustIDFromString("spiffe://example.org/spire/agent/k8s_psat/demo/node-uid"),
+		Selectors: []*types.Selector{
+			{Type: "k8s_psat", Value: "cluster:demo"},
+			{Type: "k8s_psat", Value: "agent_node_name:node-1"},
+			{Type: "k8s_psat", Value: "agent_node_uid:node-uid"},
+		},
+	}
+	simulatedNodeAlias = &types.Entry{
+		Id:       "alias",
+		SpiffeId: mustIDFromString("spiffe://example.org/k8s-workload-registrar/demo/node/node-1"),
+		ParentId: mustIDFromString("spiffe://example.org/spire/server"),
+		Selectors: []*types.Selector{
+			{Type: "k8s_psat", Value: "cluster:demo"},
+			{Type: "k8s_psat", Value: "agent_node_uid:node-uid"},
+		},
+	}
+)
+
+func TestParseSimulateCommand(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []string
+		cmd  *simulateCommand
+		err  string
+	}{
+		{
+			name: "defaults",
+			args: []string{"-pod", "web"},
+			cmd:  &simulateCommand{configPath: "k8s-workload-registrar.conf", namespace: "default", pod: "web"},
+		},
+		{
+			name: "all flags",
+			args: []string{"-config", "registrar.conf", "-namespace", "ns", "-pod", "web", "-container", "app",
+				"-agentID", "spiffe://example.org/agent", "-spiffeID", "spiffe://example.org/web"},
+			cmd: &simulateCommand{configPath: "registrar.conf", namespace: "ns", pod: "web", container: "app",
+				agentID: "spiffe://example.org/agent", spiffeID: "spiffe://example.org/web"},
+		},
+		{
+			name: "missing pod",
+			err:  "-pod is required",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := parseSimulateCommand(tt.args, ioutil.Discard)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.cmd, cmd)
+		})
+	}
+}
+
+func TestMatchEntry(t *testing.T) {
+	pod, status := simulatedPod()
+	selectors := containerSelectors(pod, status)
+
+	for _, tt := range []struct {
+		name          string
+		entry         *types.Entry
+		agents        []*types.Agent
+		nodeAliases   []*types.Entry
+		expectMissing []string
+		expectOther   []string
+		expectAgentID string
+		expectAliasID string
+	}{
+		{
+			name: "parented to the node alias",
+			entry: simulatedEntry("spiffe://example.org/k8s-workload-registrar/demo/node/node-1",
+				"k8s:ns:default", "k8s:pod-uid:pod-uid"),
+			agents:        []*types.Agent{simulatedAgent},
+			nodeAliases:   []*types.Entry{simulatedNodeAlias},
+			expectAgentID: "spiffe://example.org/spire/agent/k8s_psat/demo/node-uid",
+			expectAliasID: "alias",
+		},
+		{
+			name: "parented to the agent",
+			entry: simulatedEntry("spiffe://example.org/spire/agent/k8s_psat/demo/node-uid",
+				"k8s:ns:default", "k8s:pod-name:web"),
+			agents:        []*types.Agent{simulatedAgent},
+			expectAgentID: "spiffe://example.org/spire/agent/k8s_psat/demo/node-uid",
+		},
+		{
+			name: "stale pod UID and other selector types",
+			entry: simulatedEntry("spiffe://example.org/spire/agent/k8s_psat/demo/node-uid",
+				"k8s:ns:default", "k8s:pod-uid:old-pod-uid", "unix:uid:1000"),
+			agents:        []*types.Agent{simulatedAgent},
+			expectMissing: []string{"k8s:pod-uid:old-pod-uid"},
+			expectOther:   []string{"unix:uid:1000"},
+			expectAgentID: "spiffe://example.org/spire/agent/k8s_psat/demo/node-uid",
+		},
+		{
+			name: "node alias the agent doesn't match",
+			entry: simulatedEntry("spiffe://example.org/k8s-workload-registrar/demo/node/node-1",
+				"k8s:ns:default"),
+			agents: []*types.Agent{{
+				Id: mustIDFromString("spiffe://example.org/spire/agent/k8s_sat/demo/agent-uid"),
+				Selectors: []*types.Selector{
+					{Type: "k8s_sat", Value: "cluster:demo"},
+					{Type: "k8s_sat", Value: "agent_sa:spire-agent"},
+				},
+			}},
+			nodeAliases: []*types.Entry{simulatedNodeAlias},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			match := matchEntry(tt.entry, selectors, tt.agents, tt.nodeAliases)
+			assert.Equal(t, tt.expectMissing, match.missing)
+			assert.Equal(t, tt.expectOther, match.other)
+			assert.Equal(t, tt.expectAgentID, match.agentID)
+			assert.Equal(t, tt.expectAliasID, match.nodeAliasID)
+		})
+	}
+}
+
+func TestForOtherContainer(t *testing.T) {
+	require.False(t, forOtherContainer(simulatedEntry("spiffe://example.org/parent", "k8s:ns:default"), "app"))
+	require.False(t, forOtherContainer(simulatedEntry("spiffe://example.org/parent", "k8s:container-name:app"), "app"))
+	require.True(t, forOtherContainer(simulatedEntry("spiffe://example.org/parent", "k8s:container-name:sidecar"), "app"))
+}
+
+func TestWriteSimulation(t *testing.T) {
+	pod, status := simulatedPod()
+	selectors := containerSelectors(pod, status)
+	agents := []*types.Agent{simulatedAgent}
+	nodeAliases := []*types.Entry{simulatedNodeAlias}
+
+	matching := simulatedEntry("spiffe://example.org/k8s-workload-registrar/demo/node/node-1", "k8s:ns:default", "k8s:pod-uid:pod-uid")
+	matching.Id = "matching"
+	stale := simulatedEntry("spiffe://example.org/k8s-workload-registrar/demo/node/other", "k8s:pod-uid:old-pod-uid", "unix:uid:1000")
+	stale.Id = "stale"
+
+	sim := &simulation{
+		pod:    pod,
+		agents: agents,
+		containers: []*containerSimulation{
+			{status: &corev1.ContainerStatus{Name: "init"}},
+			{
+				status:    status,
+				selectors: selectors,
+				entries: []*entryMatch{
+					matchEntry(matching, selectors, agents, nodeAliases),
+					matchEntry(stale, selectors, agents, nil),
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, sim.write(&buf))
+	require.Equal(t, `Pod default/web on node "node-1"
+Agent spiffe://example.org/spire/agent/k8s_psat/demo/node-uid
+
+Container "init":
+  Not started; the agent can't attest it yet
+
+Container "app":
+  Selectors produced by the k8s workload attestor:
+    k8s:container-image:nginx:1.21
+    k8s:container-image:nginx@sha256:0123
+    k8s:container-name:app
+    k8s:node-name:node-1
+    k8s:ns:default
+    k8s:pod-image-count:1
+    k8s:pod-image:nginx:1.21
+    k8s:pod-image:nginx@sha256:0123
+    k8s:pod-init-image-count:0
+    k8s:pod-label:app:web
+    k8s:pod-name:web
+    k8s:pod-uid:pod-uid
+    k8s:sa:web
+  Entry matching (spiffe://example.org/web) matches
+    Parent spiffe://example.org/k8s-workload-registrar/demo/node/node-1 is a node alias of agent spiffe://example.org/spire/agent/k8s_psat/demo/node-uid (entry alias)
+  Entry stale (spiffe://example.org/web) does not match
+    Selector k8s:pod-uid:old-pod-uid is not produced for the container
+    Selector unix:uid:1000 is not simulated
+    Parent spiffe://example.org/k8s-workload-registrar/demo/node/other is neither the agent nor a node alias whose selectors the agent has
+`, buf.String())
+
+	// Without agents, the parents of the entries are not checked
+	sim.agents = nil
+	sim.containers = sim.containers[1:]
+	sim.containers[0].entries = []*entryMatch{matchEntry(matching, selectors, nil, nodeAliases)}
+	buf.Reset()
+	require.NoError(t, sim.write(&buf))
+	assert.Contains(t, buf.String(), "No k8s_psat agent found for the node;")
+	assert.Contains(t, buf.String(), "  Entry matching (spiffe://example.org/web) matches\n"+
+		"    Parent spiffe://example.org/k8s-workload-registrar/demo/node/node-1 not checked against the agent\n")
+}
+
+func simulatedPod() (*corev1.Pod, *corev1.ContainerStatus) {
+	status := corev1.ContainerStatus{
+		Name:        "app",
+		ContainerID: "containerd://0123",
+		Image:       "nginx:1.21",
+		ImageID:     "nginx@sha256:0123",
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "web",
+			UID:       "pod-uid",
+			Labels:    map[string]string{"app": "web"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:           "node-1",
+			ServiceAccountName: "web",
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{status},
+		},
+	}
+	return pod, &status
+}
+
+func simulatedEntry(parentID string, selectors ...string) *types.Entry {
+	entry := &types.Entry{
+		Id:       "entry",
+		SpiffeId: mustIDFromString("spiffe://example.org/web"),
+		ParentId: mustIDFromString(parentID),
+	}
+	for _, s := range selectors {
+		parts := strings.SplitN(s, ":", 2)
+		entry.Selectors = append(entry.Selectors, &types.Selector{Type: parts[0], Value: parts[1]})
+	}
+	return entry
+}
@@ -54,6 +54,30 @@ type Config struct {
 	// Workload API is the configuration for using the SPIFFE Workload API
 	// as the source for the public keys. Only one source can be configured.
 	WorkloadAPI *WorkloadAPIConfig `hcl:"workload_api"`
+
+	// JWKS shapes the JWKS served to relying parties that do not ask for
+	// a specific audience.
+	JWKS *JWKSConfig `hcl:"jwks"`
+
+	// Audiences shapes the JWKS served to relying parties asking for a
+	// specific audience, keyed by audience. Unset values are inherited from
+	// the JWKS configuration.
+	Audiences map[string]JWKSConfig `hcl:"audience"`
+}
+
+type JWKSConfig struct {
+	// KeyTypes restricts the keys in the JWKS to the given key types (i.e.
+	// "RSA" or "EC"). If empty, keys of all types are served.
+	KeyTypes []string `hcl:"key_types"`
+
+	// CacheMaxAge is how long relying parties may cache the JWKS. If zero,
+	// caching is disabled. This value is calculated by
+	// LoadConfig()/ParseConfig() from RawCacheMaxAge.
+	CacheMaxAge time.Duration `hcl:"-"`
+
+	// RawCacheMaxAge holds the string version of the CacheMaxAge. Consumers
+	// should use CacheMaxAge instead.
+	RawCacheMaxAge string `hcl:"cache_max_age"`
 }
 
 type ACMEConfig struct {
@@ -221,9 +245,54 @@ func ParseConfig(hclConfig string) (_ *Config, err error) {
 		return nil, errs.New("the server_api, workload_api, and deprecated registration_api sections are mutually exclusive")
 	}
 
+	if c.JWKS != nil {
+		if err := parseJWKSConfig(c.JWKS, JWKSConfig{}); err != nil {
+			return nil, errs.New("%v in the jwks configuration section", err)
+		}
+	}
+
+	for audience, jwksConfig := range c.Audiences {
+		if audience == "" {
+			return nil, errs.New("audience name must not be empty")
+		}
+		var defaults JWKSConfig
+		if c.JWKS != nil {
+			defaults = *c.JWKS
+		}
+		if err := parseJWKSConfig(&jwksConfig, defaults); err != nil {
+			return nil, errs.New("%v in the %q audience configuration section", err, audience)
+		}
+		c.Audiences[audience] = jwksConfig
+	}
+
 	return c, nil
 }
 
+func parseJWKSConfig(c *JWKSConfig, defaults JWKSConfig) (err error) {
+	for _, keyType := range c.KeyTypes {
+		switch keyType {
+		case "RSA", "EC":
+		default:
+			return errs.New("invalid key type %q; expected \"RSA\" or \"EC\"", keyType)
+		}
+	}
+	if len(c.KeyTypes) == 0 {
+		c.KeyTypes = defaults.KeyTypes
+	}
+
+	c.CacheMaxAge = defaults.CacheMaxAge
+	if c.RawCacheMaxAge != "" {
+		c.CacheMaxAge, err = time.ParseDuration(c.RawCacheMaxAge)
+		if err != nil {
+			return errs.New("invalid cache_max_age: %v", err)
+		}
+		if c.CacheMaxAge < 0 {
+			return errs.New("invalid cache_max_age: must not be negative")
+		}
+	}
+	return nil
+}
+
 func parsePollInterval(rawPollInterval string) (pollInterval time.Duration, err error) {
 	if rawPollInterval != "" {
 		pollInterval, err = time.ParseDuration(rawPollInterval)
@@ -523,6 +523,90 @@ func TestParseConfig(t *testing.T) {
 			`,
 			err: "trust_domain must be configured in the workload_api configuration section",
 		},
+		{
+			name: "jwks and audience config",
+			in: `
+				domain = "domain.test"
+				acme {
+					email = "admin@domain.test"
+					tos_accepted = true
+				}
+				server_api {
+					address = "unix:///some/socket/path"
+				}
+				jwks {
+					cache_max_age = "5m"
+				}
+				audience "sts.amazonaws.com" {
+					key_types = ["RSA"]
+				}
+				audience "nocache" {
+					cache_max_age = "0s"
+					key_types = ["EC"]
+				}
+			`,
+			out: &Config{
+				LogLevel: defaultLogLevel,
+				Domain:   "domain.test",
+				ACME: &ACMEConfig{
+					CacheDir:    defaultCacheDir,
+					Email:       "admin@domain.test",
+					ToSAccepted: true,
+				},
+				ServerAPI: &ServerAPIConfig{
+					Address:      "unix:///some/socket/path",
+					PollInterval: defaultPollInterval,
+				},
+				JWKS: &JWKSConfig{
+					CacheMaxAge:    5 * time.Minute,
+					RawCacheMaxAge: "5m",
+				},
+				Audiences: map[string]JWKSConfig{
+					"sts.amazonaws.com": {
+						KeyTypes:    []string{"RSA"},
+						CacheMaxAge: 5 * time.Minute,
+					},
+					"nocache": {
+						KeyTypes:       []string{"EC"},
+						RawCacheMaxAge: "0s",
+					},
+				},
+			},
+		},
+		{
+			name: "jwks config invalid cache max age",
+			in: `
+				domain = "domain.test"
+				acme {
+					email = "admin@domain.test"
+					tos_accepted = true
+				}
+				server_api {
+					address = "unix:///some/socket/path"
+				}
+				jwks {
+					cache_max_age = "forever"
+				}
+			`,
+			err: "invalid cache_max_age",
+		},
+		{
+			name: "audience config invalid key type",
+			in: `
+				domain = "domain.test"
+				acme {
+					email = "admin@domain.test"
+					tos_accepted = true
+				}
+				server_api {
+					address = "unix:///some/socket/path"
+				}
+				audience "sts.amazonaws.com" {
+					key_types = ["OKP"]
+				}
+			`,
+			err: `invalid key type "OKP"`,
+		},
 	}
 
 	for _, testCase := range testCases {
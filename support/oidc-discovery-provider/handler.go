@@ -2,22 +2,39 @@ package main
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
+
+	"gopkg.in/square/go-jose.v2"
 )
 
 type Handler struct {
-	domain string
-	source JWKSSource
+	domain    string
+	source    JWKSSource
+	jwks      JWKSConfig
+	audiences map[string]JWKSConfig
 
 	http.Handler
 }
 
-func NewHandler(domain string, source JWKSSource) *Handler {
+// NewHandler returns a handler serving the discovery document and the JWKS.
+// The jwks configuration, if any, shapes the JWKS served by default while
+// the audience configurations shape the JWKS served when the relying party
+// asks for a specific audience with the "audience" query parameter.
+func NewHandler(domain string, source JWKSSource, jwks *JWKSConfig, audiences map[string]JWKSConfig) *Handler {
 	h := &Handler{
-		domain: domain,
-		source: source,
+		domain:    domain,
+		source:    source,
+		audiences: audiences,
+	}
+	if jwks != nil {
+		h.jwks = *jwks
 	}
 
 	mux := http.NewServeMux()
@@ -44,6 +61,13 @@ func (h *Handler) serveWellKnown(w http.ResponseWriter, r *http.Request) {
 		Host:   h.domain,
 		Path:   "/keys",
 	}
+	if audience := r.URL.Query().Get("audience"); audience != "" {
+		if _, ok := h.audiences[audience]; !ok {
+			http.Error(w, "unknown audience", http.StatusNotFound)
+			return
+		}
+		jwksURI.RawQuery = url.Values{"audience": {audience}}.Encode()
+	}
 
 	doc := struct {
 		Issuer  string `json:"issuer"`
@@ -81,23 +105,73 @@ func (h *Handler) serveKeys(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	config := h.jwks
+	if audience := r.URL.Query().Get("audience"); audience != "" {
+		var ok bool
+		config, ok = h.audiences[audience]
+		if !ok {
+			http.Error(w, "unknown audience", http.StatusNotFound)
+			return
+		}
+	}
+
 	jwks, modTime, ok := h.source.FetchKeySet()
 	if !ok {
 		http.Error(w, "document not available", http.StatusInternalServerError)
 		return
 	}
 
-	jwksBytes, err := json.MarshalIndent(jwks, "", "  ")
+	jwksBytes, err := json.MarshalIndent(filterKeySet(jwks, config.KeyTypes), "", "  ")
 	if err != nil {
 		http.Error(w, "failed to marshal JWKS", http.StatusInternalServerError)
 		return
 	}
 
-	// Disable caching
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-	w.Header().Set("Pragma", "no-cache")
-	w.Header().Set("Expires", "0")
+	if config.CacheMaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int64(config.CacheMaxAge.Seconds())))
+	} else {
+		// Disable caching
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		w.Header().Set("Pragma", "no-cache")
+		w.Header().Set("Expires", "0")
+	}
+
+	// The ETag lets relying parties revalidate the JWKS with a conditional
+	// request, which ServeContent answers with a 304 if it is unchanged.
+	sum := sha256.Sum256(jwksBytes)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
 
 	w.Header().Set("Content-Type", "application/json")
 	http.ServeContent(w, r, "keys", modTime, bytes.NewReader(jwksBytes))
 }
+
+// filterKeySet returns the key set restricted to the keys of the given key
+// types, or the key set itself if no key types are given.
+func filterKeySet(jwks *jose.JSONWebKeySet, keyTypes []string) *jose.JSONWebKeySet {
+	if len(keyTypes) == 0 {
+		return jwks
+	}
+
+	filtered := new(jose.JSONWebKeySet)
+	for _, key := range jwks.Keys {
+		for _, keyType := range keyTypes {
+			if jwkKeyType(key) == keyType {
+				filtered.Keys = append(filtered.Keys, key)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// jwkKeyType returns the "kty" of the key as it is marshaled in the JWKS
+func jwkKeyType(key jose.JSONWebKey) string {
+	switch key.Key.(type) {
+	case *rsa.PublicKey:
+		return "RSA"
+	case *ecdsa.PublicKey:
+		return "EC"
+	default:
+		return ""
+	}
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/spiffe/spire/test/testkey"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/square/go-jose.v2"
@@ -112,7 +114,7 @@ func TestHandler(t *testing.T) {
 			require.NoError(t, err)
 			w := httptest.NewRecorder()
 
-			h := NewHandler("domain.test", source)
+			h := NewHandler("domain.test", source, nil, nil)
 			h.ServeHTTP(w, r)
 
 			t.Logf("HEADERS: %q", w.Header())
@@ -122,6 +124,168 @@ func TestHandler(t *testing.T) {
 	}
 }
 
+func TestHandlerKeysShaping(t *testing.T) {
+	source := new(FakeKeySetSource)
+	source.SetKeySet(&jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{
+			{
+				Key:       ec256Pubkey,
+				KeyID:     "EC",
+				Algorithm: "ES256",
+			},
+			{
+				Key:       testkey.MustRSA2048().Public(),
+				KeyID:     "RSA",
+				Algorithm: "RS256",
+			},
+		},
+	}, time.Time{})
+
+	h := NewHandler("domain.test", source, &JWKSConfig{
+		CacheMaxAge: time.Minute,
+	}, map[string]JWKSConfig{
+		"sts.amazonaws.com": {
+			KeyTypes:    []string{"RSA"},
+			CacheMaxAge: time.Hour,
+		},
+		"nocache": {},
+	})
+
+	testCases := []struct {
+		name         string
+		path         string
+		ifNoneMatch  string
+		code         int
+		cacheControl string
+		keyIDs       []string
+	}{
+		{
+			name:         "default",
+			path:         "/keys",
+			code:         http.StatusOK,
+			cacheControl: "public, max-age=60",
+			keyIDs:       []string{"EC", "RSA"},
+		},
+		{
+			name:         "audience with key types",
+			path:         "/keys?audience=sts.amazonaws.com",
+			code:         http.StatusOK,
+			cacheControl: "public, max-age=3600",
+			keyIDs:       []string{"RSA"},
+		},
+		{
+			name:         "audience with caching disabled",
+			path:         "/keys?audience=nocache",
+			code:         http.StatusOK,
+			cacheControl: "no-cache, no-store, must-revalidate",
+			keyIDs:       []string{"EC", "RSA"},
+		},
+		{
+			name: "unknown audience",
+			path: "/keys?audience=unknown",
+			code: http.StatusNotFound,
+		},
+		{
+			name:         "etag mismatch",
+			path:         "/keys",
+			ifNoneMatch:  `"stale"`,
+			code:         http.StatusOK,
+			cacheControl: "public, max-age=60",
+			keyIDs:       []string{"EC", "RSA"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			r, err := http.NewRequest("GET", "http://localhost"+testCase.path, nil)
+			require.NoError(t, err)
+			if testCase.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", testCase.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			require.Equal(t, testCase.code, w.Code)
+			if testCase.code != http.StatusOK {
+				return
+			}
+			assert.Equal(t, testCase.cacheControl, w.Header().Get("Cache-Control"))
+			assert.NotEmpty(t, w.Header().Get("ETag"))
+
+			jwks := new(jose.JSONWebKeySet)
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), jwks))
+			var keyIDs []string
+			for _, key := range jwks.Keys {
+				keyIDs = append(keyIDs, key.KeyID)
+			}
+			assert.Equal(t, testCase.keyIDs, keyIDs)
+		})
+	}
+}
+
+func TestHandlerKeysNotModified(t *testing.T) {
+	source := new(FakeKeySetSource)
+	source.SetKeySet(&jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{
+			{
+				Key:       ec256Pubkey,
+				KeyID:     "KEYID",
+				Algorithm: "ES256",
+			},
+		},
+	}, time.Time{})
+	h := NewHandler("domain.test", source, nil, nil)
+
+	r, err := http.NewRequest("GET", "http://localhost/keys", nil)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// Revalidating an unchanged key set does not send the key set again
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// The ETag changes with the key set
+	source.SetKeySet(new(jose.JSONWebKeySet), time.Time{})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestHandlerWellKnownAudience(t *testing.T) {
+	h := NewHandler("domain.test", new(FakeKeySetSource), nil, map[string]JWKSConfig{
+		"sts.amazonaws.com": {},
+	})
+
+	r, err := http.NewRequest("GET", "http://localhost/.well-known/openid-configuration?audience=sts.amazonaws.com", nil)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	doc := struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "https://domain.test", doc.Issuer)
+	assert.Equal(t, "https://domain.test/keys?audience=sts.amazonaws.com", doc.JWKSURI)
+
+	r, err = http.NewRequest("GET", "http://localhost/.well-known/openid-configuration?audience=unknown", nil)
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 type FakeKeySetSource struct {
 	mu      sync.Mutex
 	jwks    *jose.JSONWebKeySet
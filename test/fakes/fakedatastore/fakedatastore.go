@@ -157,6 +157,20 @@ func (s *DataStore) DeleteAttestedNode(ctx context.Context, spiffeID string) (*c
 	return s.ds.DeleteAttestedNode(ctx, spiffeID)
 }
 
+func (s *DataStore) SetNodeLastSeen(ctx context.Context, spiffeID string, lastSeen time.Time) error {
+	if err := s.getNextError(); err != nil {
+		return err
+	}
+	return s.ds.SetNodeLastSeen(ctx, spiffeID, lastSeen)
+}
+
+func (s *DataStore) ListNodesLastSeen(ctx context.Context) (map[string]time.Time, error) {
+	if err := s.getNextError(); err != nil {
+		return nil, err
+	}
+	return s.ds.ListNodesLastSeen(ctx)
+}
+
 func (s *DataStore) SetNodeSelectors(ctx context.Context, spiffeID string, selectors []*common.Selector) error {
 	if err := s.getNextError(); err != nil {
 		return err
@@ -204,6 +218,13 @@ func (s *DataStore) FetchRegistrationEntry(ctx context.Context, entryID string)
 	return s.ds.FetchRegistrationEntry(ctx, entryID)
 }
 
+func (s *DataStore) FetchRegistrationEntryOwner(ctx context.Context, entryID string) (string, error) {
+	if err := s.getNextError(); err != nil {
+		return "", err
+	}
+	return s.ds.FetchRegistrationEntryOwner(ctx, entryID)
+}
+
 func (s *DataStore) ListRegistrationEntries(ctx context.Context, req *datastore.ListRegistrationEntriesRequest) (*datastore.ListRegistrationEntriesResponse, error) {
 	if err := s.getNextError(); err != nil {
 		return nil, err
@@ -216,6 +237,13 @@ func (s *DataStore) ListRegistrationEntries(ctx context.Context, req *datastore.
 	return resp, err
 }
 
+func (s *DataStore) ListRegistrationEntryRevisions(ctx context.Context, entryID string) ([]*datastore.RegistrationEntryRevision, error) {
+	if err := s.getNextError(); err != nil {
+		return nil, err
+	}
+	return s.ds.ListRegistrationEntryRevisions(ctx, entryID)
+}
+
 func (s *DataStore) UpdateRegistrationEntry(ctx context.Context, entry *common.RegistrationEntry, mask *common.RegistrationEntryMask) (*common.RegistrationEntry, error) {
 	if err := s.getNextError(); err != nil {
 		return nil, err
@@ -2,6 +2,7 @@ package fakeservercatalog
 
 import (
 	"github.com/spiffe/spire/pkg/server/datastore"
+	"github.com/spiffe/spire/pkg/server/plugin/credentialcomposer"
 	"github.com/spiffe/spire/pkg/server/plugin/keymanager"
 	"github.com/spiffe/spire/pkg/server/plugin/nodeattestor"
 	"github.com/spiffe/spire/pkg/server/plugin/noderesolver"
@@ -14,6 +15,7 @@ func New() *Catalog {
 }
 
 type Catalog struct {
+	credentialComposerRepository
 	dataStoreRepository
 	keyManagerRepository
 	nodeAttestorRepository
@@ -24,6 +26,7 @@ type Catalog struct {
 
 // We need distinct type names to embed in the Catalog above, since the types
 // we want to actually embed are all named the same.
+type credentialComposerRepository struct{ credentialcomposer.Repository }
 type dataStoreRepository struct{ datastore.Repository }
 type keyManagerRepository struct{ keymanager.Repository }
 type nodeAttestorRepository struct{ nodeattestor.Repository }
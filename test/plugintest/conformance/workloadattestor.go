@@ -0,0 +1,128 @@
+// Package conformance provides tests that plugins, including out-of-tree
+// plugins built with the SPIRE plugin SDK, can run to check that they
+// behave as SPIRE expects.
+package conformance
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spiffe/spire/pkg/agent/plugin/workloadattestor"
+	"github.com/spiffe/spire/pkg/common/catalog"
+	"github.com/spiffe/spire/proto/spire/common"
+	"github.com/spiffe/spire/test/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// attestTimeout is how long an attestation is given to complete. The
+	// agent attests workloads while their Workload API calls wait.
+	attestTimeout = 10 * time.Second
+
+	concurrentAttestations = 8
+)
+
+// TestWorkloadAttestor loads the workload attestor built-in with the given
+// options, which should configure the plugin as it would be in production,
+// and checks that:
+//   - the agent process can be attested, since the agent attests itself when
+//     its health is checked, and its selectors are well formed
+//   - attesting the same process returns the same selectors
+//   - concurrent attestations are safe
+//   - attesting a process that no longer exists completes in a timely manner
+//
+// Out-of-tree plugins can wrap their implementation with catalog.MakeBuiltIn
+// to run the tests, e.g.:
+//
+//	conformance.TestWorkloadAttestor(t,
+//	    catalog.MakeBuiltIn("my_attestor", workloadattestorv1.WorkloadAttestorPluginServer(p), configv1.ConfigServiceServer(p)),
+//	    plugintest.Configure(`my_option = "value"`))
+func TestWorkloadAttestor(t *testing.T, builtIn catalog.BuiltIn, options ...plugintest.Option) {
+	attestor := new(workloadattestor.V1)
+	plugintest.Load(t, builtIn, attestor, options...)
+
+	t.Run("AttestsAgentProcess", func(t *testing.T) {
+		selectors, err := attest(attestor, os.Getpid())
+		require.NoError(t, err, "the agent process must be attestable")
+		requireWellFormedSelectors(t, builtIn.Name, selectors)
+	})
+
+	t.Run("ReturnsConsistentSelectors", func(t *testing.T) {
+		first, err := attest(attestor, os.Getpid())
+		require.NoError(t, err)
+		second, err := attest(attestor, os.Getpid())
+		require.NoError(t, err)
+		require.ElementsMatch(t, selectorValues(first), selectorValues(second),
+			"attesting the same process must return the same selectors")
+	})
+
+	t.Run("AttestsConcurrently", func(t *testing.T) {
+		expected, err := attest(attestor, os.Getpid())
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := 0; i < concurrentAttestations; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				selectors, err := attest(attestor, os.Getpid())
+				if assert.NoError(t, err) {
+					assert.ElementsMatch(t, selectorValues(expected), selectorValues(selectors))
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("AttestsExitedProcess", func(t *testing.T) {
+		// The selectors of a process that has exited are up to the plugin,
+		// but the attestation must not hang until the workload gives up
+		selectors, err := attest(attestor, exitedPID(t))
+		require.NotEqual(t, codes.DeadlineExceeded, status.Code(err),
+			"attesting a process that has exited must complete within %s", attestTimeout)
+		if err == nil {
+			requireWellFormedSelectors(t, builtIn.Name, selectors)
+		}
+	})
+}
+
+func attest(attestor workloadattestor.WorkloadAttestor, pid int) ([]*common.Selector, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), attestTimeout)
+	defer cancel()
+	return attestor.Attest(ctx, pid)
+}
+
+// requireWellFormedSelectors requires that the selectors have a value and are
+// not duplicated. Selectors are typed with the plugin name by the agent.
+func requireWellFormedSelectors(t *testing.T, pluginName string, selectors []*common.Selector) {
+	seen := make(map[string]bool, len(selectors))
+	for _, selector := range selectors {
+		require.Equal(t, pluginName, selector.Type)
+		require.NotEmpty(t, selector.Value, "selector values must not be empty")
+		require.False(t, seen[selector.Value], "selector value %q is duplicated", selector.Value)
+		seen[selector.Value] = true
+	}
+}
+
+func selectorValues(selectors []*common.Selector) []string {
+	values := make([]string, 0, len(selectors))
+	for _, selector := range selectors {
+		values = append(values, selector.Value)
+	}
+	return values
+}
+
+// exitedPID runs the test binary without running any test and returns its
+// PID once it has exited
+func exitedPID(t *testing.T) int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	require.NoError(t, cmd.Run())
+	return cmd.Process.Pid
+}